@@ -0,0 +1,182 @@
+package accounting
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type Kind string
+
+const (
+	Received Kind = "received"
+	Sent     Kind = "sent"
+)
+
+// Entry is a settled invoice or a complete payment. Msatoshi is what was
+// received or what reached the destination, fees are apart.
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Kind        Kind      `json:"kind"`
+	CheckingID  string    `json:"checkingID"`
+	Msatoshi    int64     `json:"msatoshi"`
+	FeeMsatoshi int64     `json:"feeMsatoshi"`
+	Description string    `json:"description,omitempty"`
+	Label       string    `json:"label,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Preimage    string    `json:"preimage,omitempty"`
+}
+
+// FromInvoice only makes entries for paid invoices.
+func FromInvoice(status rp.InvoiceStatus) (Entry, bool) {
+	if !status.Paid || status.Held {
+		return Entry{}, false
+	}
+	return Entry{
+		Time:        timeOrNow(status.SettledAt),
+		Kind:        Received,
+		CheckingID:  status.CheckingID,
+		Msatoshi:    status.MSatoshiReceived,
+		Description: status.Description,
+		Label:       status.Label,
+	}, true
+}
+
+// FromPayment only makes entries for complete payments.
+func FromPayment(status rp.PaymentStatus) (Entry, bool) {
+	if status.Status != rp.Complete {
+		return Entry{}, false
+	}
+	return Entry{
+		Time:        timeOrNow(status.ResolvedAt),
+		Kind:        Sent,
+		CheckingID:  status.CheckingID,
+		Msatoshi:    status.Msatoshi,
+		FeeMsatoshi: status.FeePaid,
+		Description: status.Description,
+		Destination: status.Destination,
+		Preimage:    status.Preimage,
+	}, true
+}
+
+func timeOrNow(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+type Store interface {
+	// Add saves the entry unless one of the same kind and CheckingID was
+	// already saved, in which case it returns false.
+	Add(Entry) (bool, error)
+
+	// Entries returns the entries from from (inclusive) to to (exclusive),
+	// oldest first. Zero times leave that side open.
+	Entries(from, to time.Time) ([]Entry, error)
+}
+
+type Params struct {
+	Wallet rp.Wallet
+	Store  Store
+}
+
+// Recorder saves an entry for every settled invoice and complete payment the
+// wallet streams, to be exported later.
+type Recorder struct {
+	store Store
+}
+
+func Start(params Params) (*Recorder, error) {
+	if params.Store == nil {
+		params.Store = NewMemoryStore()
+	}
+
+	invoices, err := params.Wallet.PaidInvoicesStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to invoices: %w", err)
+	}
+	payments, err := params.Wallet.PaymentsStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+	}
+
+	r := &Recorder{store: params.Store}
+
+	go func() {
+		for status := range invoices {
+			if entry, ok := FromInvoice(status); ok {
+				r.store.Add(entry)
+			}
+		}
+	}()
+	go func() {
+		for status := range payments {
+			if entry, ok := FromPayment(status); ok {
+				r.store.Add(entry)
+			}
+		}
+	}()
+
+	return r, nil
+}
+
+// Add records an entry that didn't come from the streams, like payments made
+// before the recorder was started.
+func (r *Recorder) Add(entry Entry) error {
+	_, err := r.store.Add(entry)
+	return err
+}
+
+func (r *Recorder) Entries(from, to time.Time) ([]Entry, error) {
+	return r.store.Entries(from, to)
+}
+
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries []Entry // sorted by time
+	seen    map[string]bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{seen: make(map[string]bool)}
+}
+
+func (m *MemoryStore) Add(entry Entry) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := string(entry.Kind) + ":" + entry.CheckingID
+	if m.seen[key] {
+		return false, nil
+	}
+	m.seen[key] = true
+
+	i := sort.Search(len(m.entries), func(i int) bool {
+		return m.entries[i].Time.After(entry.Time)
+	})
+	m.entries = append(m.entries, Entry{})
+	copy(m.entries[i+1:], m.entries[i:])
+	m.entries[i] = entry
+	return true, nil
+}
+
+func (m *MemoryStore) Entries(from, to time.Time) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []Entry
+	for _, entry := range m.entries {
+		if !from.IsZero() && entry.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !entry.Time.Before(to) {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,70 @@
+package accounting
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	day := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	store.Add(Entry{Time: day.Add(2 * time.Hour), Kind: Sent, CheckingID: "b"})
+	store.Add(Entry{Time: day.Add(time.Hour), Kind: Received, CheckingID: "a"})
+	store.Add(Entry{Time: day.Add(48 * time.Hour), Kind: Received, CheckingID: "c"})
+	if isNew, _ := store.Add(Entry{Time: day, Kind: Received, CheckingID: "a"}); isNew {
+		t.Errorf("got a duplicate added, wanted it ignored")
+	}
+
+	got, _ := store.Entries(day, day.Add(24*time.Hour))
+	if len(got) != 2 || got[0].CheckingID != "a" || got[1].CheckingID != "b" {
+		t.Errorf("got %v, wanted a and b in order", got)
+	}
+}
+
+func TestFromPayment(t *testing.T) {
+	if _, ok := FromPayment(rp.PaymentStatus{Status: rp.Pending}); ok {
+		t.Errorf("got an entry, wanted none for a pending payment")
+	}
+	entry, ok := FromPayment(rp.PaymentStatus{
+		CheckingID: "ff", Status: rp.Complete, Msatoshi: 10000, FeePaid: 12,
+		ResolvedAt: time.Unix(1600000000, 0),
+	})
+	if !ok || entry.Kind != Sent || entry.Msatoshi != 10000 || entry.FeeMsatoshi != 12 {
+		t.Errorf("got %v, wanted a sent entry for 10000 msat and 12 in fees", entry)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+	WriteCSV(&b, []Entry{{
+		Time: time.Unix(1600000000, 0), Kind: Received, CheckingID: "ff",
+		Msatoshi: 5000, Description: "coffee, large",
+	}})
+	want := "time,kind,checking_id,msatoshi,fee_msatoshi,description,label,destination,preimage\n" +
+		"2020-09-13T12:26:40Z,received,ff,5000,0,\"coffee, large\",,,\n"
+	if b.String() != want {
+		t.Errorf("got %q, wanted %q", b.String(), want)
+	}
+}
+
+func TestWriteBeancount(t *testing.T) {
+	var b bytes.Buffer
+	WriteBeancount(&b, []Entry{{
+		Time: time.Unix(1600000000, 0), Kind: Sent, CheckingID: "ff",
+		Msatoshi: 100000000, FeeMsatoshi: 1500,
+	}}, Accounts{})
+	want := `2020-09-13 * "sent"
+  checking_id: "ff"
+  Assets:Lightning  -0.00100001500 BTC
+  Expenses:Lightning  0.00100000000 BTC
+  Expenses:Fees:Lightning  0.00000001500 BTC
+
+`
+	if b.String() != want {
+		t.Errorf("got %q, wanted %q", b.String(), want)
+	}
+}
@@ -0,0 +1,110 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteCSV writes a header and a row per entry, amounts in msatoshi and times
+// in RFC3339 UTC.
+func WriteCSV(w io.Writer, entries []Entry) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{
+		"time", "kind", "checking_id", "msatoshi", "fee_msatoshi",
+		"description", "label", "destination", "preimage",
+	})
+	for _, entry := range entries {
+		c.Write([]string{
+			entry.Time.UTC().Format(time.RFC3339),
+			string(entry.Kind),
+			entry.CheckingID,
+			strconv.FormatInt(entry.Msatoshi, 10),
+			strconv.FormatInt(entry.FeeMsatoshi, 10),
+			entry.Description,
+			entry.Label,
+			entry.Destination,
+			entry.Preimage,
+		})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+func WriteJSON(w io.Writer, entries []Entry) error {
+	if entries == nil {
+		entries = []Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// Accounts are the beancount accounts the entries are posted to.
+type Accounts struct {
+	Wallet   string // defaults to Assets:Lightning
+	Income   string // defaults to Income:Lightning
+	Expenses string // defaults to Expenses:Lightning
+	Fees     string // defaults to Expenses:Fees:Lightning
+}
+
+// WriteBeancount writes a transaction per entry, in BTC with the 11 decimals
+// needed to keep msatoshi.
+func WriteBeancount(w io.Writer, entries []Entry, accounts Accounts) error {
+	if accounts.Wallet == "" {
+		accounts.Wallet = "Assets:Lightning"
+	}
+	if accounts.Income == "" {
+		accounts.Income = "Income:Lightning"
+	}
+	if accounts.Expenses == "" {
+		accounts.Expenses = "Expenses:Lightning"
+	}
+	if accounts.Fees == "" {
+		accounts.Fees = "Expenses:Fees:Lightning"
+	}
+
+	for _, entry := range entries {
+		narration := entry.Description
+		if narration == "" {
+			narration = string(entry.Kind)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s * %s\n", entry.Time.UTC().Format("2006-01-02"), strconv.Quote(narration))
+		fmt.Fprintf(&b, "  checking_id: %s\n", strconv.Quote(entry.CheckingID))
+		if entry.Label != "" {
+			fmt.Fprintf(&b, "  label: %s\n", strconv.Quote(entry.Label))
+		}
+
+		switch entry.Kind {
+		case Received:
+			fmt.Fprintf(&b, "  %s  %s BTC\n", accounts.Wallet, btc(entry.Msatoshi))
+			fmt.Fprintf(&b, "  %s  %s BTC\n", accounts.Income, btc(-entry.Msatoshi))
+		case Sent:
+			fmt.Fprintf(&b, "  %s  %s BTC\n", accounts.Wallet, btc(-entry.Msatoshi-entry.FeeMsatoshi))
+			fmt.Fprintf(&b, "  %s  %s BTC\n", accounts.Expenses, btc(entry.Msatoshi))
+			if entry.FeeMsatoshi != 0 {
+				fmt.Fprintf(&b, "  %s  %s BTC\n", accounts.Fees, btc(entry.FeeMsatoshi))
+			}
+		}
+		b.WriteString("\n")
+
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func btc(msatoshi int64) string {
+	sign := ""
+	if msatoshi < 0 {
+		sign = "-"
+		msatoshi = -msatoshi
+	}
+	return fmt.Sprintf("%s%d.%011d", sign, msatoshi/100000000000, msatoshi%100000000000)
+}
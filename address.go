@@ -0,0 +1,132 @@
+package relampago
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LightningAddressClient is the http client used to resolve lightning
+// addresses, replace it to go through a proxy.
+var LightningAddressClient = &http.Client{Timeout: 15 * time.Second}
+
+var ErrLightningAddress = errors.New("failed to resolve lightning address")
+
+// PayToLightningAddress pays msatoshi to a lightning address like
+// alice@example.com: the LNURL-pay endpoint behind it is asked for an invoice,
+// which is checked to be for the amount and the endpoint metadata before it is
+// paid with wallet.
+func PayToLightningAddress(ctx context.Context, wallet Wallet, address string, msatoshi int64) (PaymentData, error) {
+	invoice, err := ResolveLightningAddress(ctx, address, msatoshi)
+	if err != nil {
+		return PaymentData{}, err
+	}
+	return wallet.MakePayment(PaymentParams{Invoice: invoice})
+}
+
+type lnurlPayRequest struct {
+	Status      string `json:"status"`
+	Reason      string `json:"reason"`
+	Tag         string `json:"tag"`
+	Callback    string `json:"callback"`
+	MinSendable int64  `json:"minSendable"`
+	MaxSendable int64  `json:"maxSendable"`
+	Metadata    string `json:"metadata"`
+}
+
+type lnurlPayResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	PR     string `json:"pr"`
+}
+
+// ResolveLightningAddress gets an invoice for msatoshi from a lightning
+// address without paying it.
+func ResolveLightningAddress(ctx context.Context, address string, msatoshi int64) (string, error) {
+	parts := strings.Split(address, "@")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("%w: '%s' is not a lightning address", ErrLightningAddress, address)
+	}
+	user, domain := parts[0], parts[1]
+
+	scheme := "https"
+	if strings.HasSuffix(domain, ".onion") {
+		scheme = "http"
+	}
+
+	var params lnurlPayRequest
+	endpoint := scheme + "://" + domain + "/.well-known/lnurlp/" + url.PathEscape(user)
+	if err := getLNURL(ctx, endpoint, &params); err != nil {
+		return "", err
+	}
+	if params.Status == "ERROR" {
+		return "", fmt.Errorf("%w: %s", ErrLightningAddress, params.Reason)
+	}
+	if params.Tag != "payRequest" {
+		return "", fmt.Errorf("%w: got a '%s' instead of a payRequest", ErrLightningAddress, params.Tag)
+	}
+	if msatoshi < params.MinSendable || msatoshi > params.MaxSendable {
+		return "", fmt.Errorf("%w: amount must be between %d and %d msat",
+			ErrLightningAddress, params.MinSendable, params.MaxSendable)
+	}
+
+	callback, err := url.Parse(params.Callback)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid callback '%s'", ErrLightningAddress, params.Callback)
+	}
+	q := callback.Query()
+	q.Set("amount", strconv.FormatInt(msatoshi, 10))
+	callback.RawQuery = q.Encode()
+
+	var res lnurlPayResponse
+	if err := getLNURL(ctx, callback.String(), &res); err != nil {
+		return "", err
+	}
+	if res.Status == "ERROR" {
+		return "", fmt.Errorf("%w: %s", ErrLightningAddress, res.Reason)
+	}
+
+	// the invoice must be the one we asked for, or the endpoint could make us
+	// pay anything
+	inv, err := DecodeBolt11(res.PR)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid invoice '%s': %v", ErrLightningAddress, res.PR, err)
+	}
+	if inv.MSatoshi != msatoshi {
+		return "", fmt.Errorf("%w: got an invoice for %d msat instead of %d",
+			ErrLightningAddress, inv.MSatoshi, msatoshi)
+	}
+	if inv.DescriptionHash != hex.EncodeToString(DescriptionHash(params.Metadata)) {
+		return "", fmt.Errorf("%w: the invoice doesn't commit to the metadata", ErrLightningAddress)
+	}
+
+	return res.PR, nil
+}
+
+func getLNURL(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLightningAddress, err)
+	}
+
+	resp, err := LightningAddressClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLightningAddress, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: %s returned %s", ErrLightningAddress, endpoint, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: invalid response from %s: %v", ErrLightningAddress, endpoint, err)
+	}
+	return nil
+}
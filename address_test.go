@@ -0,0 +1,48 @@
+package relampago_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+func TestPayToLightningAddress_Errors(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/lnurlp/alice":
+			w.Write([]byte(`{"tag":"payRequest","callback":"https://` + r.Host + `/cb","minSendable":1000,"maxSendable":100000,"metadata":"[]"}`))
+		case "/.well-known/lnurlp/bob":
+			w.Write([]byte(`{"status":"ERROR","reason":"no such user"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := rp.LightningAddressClient
+	rp.LightningAddressClient = srv.Client()
+	defer func() { rp.LightningAddressClient = client }()
+
+	domain := strings.TrimPrefix(srv.URL, "https://")
+	for _, c := range []struct {
+		address  string
+		msatoshi int64
+		reason   string
+	}{
+		{"alice", 5000, "not a lightning address"},
+		{"alice@" + domain, 500, "amount must be between"},
+		{"bob@" + domain, 5000, "no such user"},
+		{"carol@" + domain, 5000, "404"},
+	} {
+		_, err := rp.PayToLightningAddress(context.Background(), void.VoidWallet{}, c.address, c.msatoshi)
+		if !errors.Is(err, rp.ErrLightningAddress) || !strings.Contains(err.Error(), c.reason) {
+			t.Errorf("%s: got %v, wanted an error about '%s'", c.address, err, c.reason)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package relampago
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// MsatKeys are the JSON keys holding msat amounts besides "msatoshi" and the
+// ones ending in "Msatoshi", which always are. Apps can add their own.
+var MsatKeys = map[string]bool{
+	"msatoshiReceived": true,
+	"feePaid":          true,
+	"customAmount":     true,
+}
+
+func isMsatKey(key string) bool {
+	return key == "msatoshi" || strings.HasSuffix(key, "Msatoshi") || MsatKeys[key]
+}
+
+// MarshalJSON encodes v like json.Marshal. With stringAmounts the msat amounts
+// are strings, as JavaScript parses every number as a double and amounts above
+// 2^53 msat would lose precision.
+func MarshalJSON(v interface{}, stringAmounts bool) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || !stringAmounts {
+		return data, err
+	}
+
+	var tree interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return json.Marshal(convertAmounts(tree, func(n json.Number) interface{} {
+		return n.String()
+	}, nil))
+}
+
+// UnmarshalJSON decodes data like json.Unmarshal, taking msat amounts both as
+// numbers and as the strings made by MarshalJSON with stringAmounts.
+func UnmarshalJSON(data []byte, v interface{}) error {
+	var tree interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(convertAmounts(tree, nil, func(s string) interface{} {
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return s
+		}
+		return json.Number(s)
+	}))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// convertAmounts applies fromNumber or fromString to the msat amounts in a
+// decoded JSON tree.
+func convertAmounts(
+	tree interface{},
+	fromNumber func(json.Number) interface{},
+	fromString func(string) interface{},
+) interface{} {
+	switch node := tree.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			switch amount := value.(type) {
+			case json.Number:
+				if fromNumber != nil && isMsatKey(key) {
+					node[key] = fromNumber(amount)
+					continue
+				}
+			case string:
+				if fromString != nil && isMsatKey(key) {
+					node[key] = fromString(amount)
+					continue
+				}
+			}
+			node[key] = convertAmounts(value, fromNumber, fromString)
+		}
+	case []interface{}:
+		for i, value := range node {
+			node[i] = convertAmounts(value, fromNumber, fromString)
+		}
+	}
+	return tree
+}
@@ -0,0 +1,48 @@
+package relampago_test
+
+import (
+	"strings"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	// above 2^53, which JavaScript can't represent exactly
+	status := rp.PaymentStatus{
+		CheckingID:       "abc",
+		Status:           rp.Complete,
+		FeePaid:          9007199254740993,
+		InFlightMsatoshi: 1,
+	}
+
+	numbers, err := rp.MarshalJSON(status, false)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if !strings.Contains(string(numbers), `"feePaid":9007199254740993`) {
+		t.Errorf("got %s, wanted feePaid as a number", numbers)
+	}
+
+	strs, err := rp.MarshalJSON([]rp.PaymentStatus{status}, true)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	for _, expected := range []string{
+		`"feePaid":"9007199254740993"`, `"inFlightMsatoshi":"1"`, `"checkingID":"abc"`,
+	} {
+		if !strings.Contains(string(strs), expected) {
+			t.Errorf("got %s, wanted %s", strs, expected)
+		}
+	}
+
+	for _, data := range [][]byte{numbers, strs[1 : len(strs)-1]} {
+		var decoded rp.PaymentStatus
+		if err := rp.UnmarshalJSON(data, &decoded); err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+		if decoded.FeePaid != status.FeePaid || decoded.InFlightMsatoshi != 1 || decoded.CheckingID != "abc" {
+			t.Errorf("got %+v from %s, wanted %+v", decoded, data, status)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package relampago
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// Bolt11 is what DecodeBolt11 reads from an invoice.
+type Bolt11 struct {
+	Currency           string        `json:"currency"`
+	MSatoshi           int64         `json:"msatoshi"`
+	CreatedAt          time.Time     `json:"createdAt"`
+	Expiry             time.Duration `json:"expiry"`
+	Payee              string        `json:"payee"`
+	PaymentHash        string        `json:"paymentHash"`
+	Description        string        `json:"description,omitempty"`
+	DescriptionHash    string        `json:"descriptionHash,omitempty"`
+	MinFinalCLTVExpiry int64         `json:"minFinalCltvExpiry"`
+}
+
+var ErrInvalidBolt11 = errors.New("invalid bolt11 invoice")
+
+// DecodeBolt11 decodes the fields of an invoice that are needed to check it
+// before paying, without depending on lnd. The payee is recovered from the
+// signature, or is the n field when there is one, which the signature must
+// then be from.
+func DecodeBolt11(invoice string) (Bolt11, error) {
+	invoice = strings.ToLower(strings.TrimSpace(invoice))
+	invoice = strings.TrimPrefix(invoice, "lightning:")
+
+	sep := strings.LastIndexByte(invoice, '1')
+	if sep < 0 || len(invoice)-sep-1 < 7+104+6 {
+		return Bolt11{}, fmt.Errorf("%w: too short", ErrInvalidBolt11)
+	}
+	hrp := invoice[:sep]
+
+	words := make([]byte, len(invoice)-sep-1)
+	for i, c := range invoice[sep+1:] {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return Bolt11{}, fmt.Errorf("%w: invalid character '%c'", ErrInvalidBolt11, c)
+		}
+		words[i] = byte(v)
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), words...)) != 1 {
+		return Bolt11{}, fmt.Errorf("%w: bad checksum", ErrInvalidBolt11)
+	}
+	words = words[:len(words)-6]
+
+	var inv Bolt11
+	if err := inv.parseHRP(hrp); err != nil {
+		return Bolt11{}, err
+	}
+
+	signed, signature := words[:len(words)-104], words[len(words)-104:]
+	inv.CreatedAt = time.Unix(int64(wordsToUint(signed[:7])), 0)
+	inv.Expiry = time.Hour
+	inv.MinFinalCLTVExpiry = 18
+
+	var payee []byte
+	for data := signed[7:]; len(data) > 0; {
+		if len(data) < 3 {
+			return Bolt11{}, fmt.Errorf("%w: truncated field", ErrInvalidBolt11)
+		}
+		tag, length := data[0], int(data[1])<<5|int(data[2])
+		if len(data) < 3+length {
+			return Bolt11{}, fmt.Errorf("%w: truncated field", ErrInvalidBolt11)
+		}
+		value := data[3 : 3+length]
+		data = data[3+length:]
+
+		switch bech32Charset[tag] {
+		case 'p':
+			if length == 52 {
+				inv.PaymentHash = hex.EncodeToString(convertWords(value, 5, 8, false))
+			}
+		case 'h':
+			if length == 52 {
+				inv.DescriptionHash = hex.EncodeToString(convertWords(value, 5, 8, false))
+			}
+		case 'd':
+			inv.Description = string(convertWords(value, 5, 8, false))
+		case 'x':
+			inv.Expiry = time.Duration(wordsToUint(value)) * time.Second
+		case 'c':
+			inv.MinFinalCLTVExpiry = int64(wordsToUint(value))
+		case 'n':
+			if length == 53 {
+				payee = convertWords(value, 5, 8, false)
+			}
+		}
+	}
+	if inv.PaymentHash == "" {
+		return Bolt11{}, fmt.Errorf("%w: missing payment hash", ErrInvalidBolt11)
+	}
+
+	// the recovered key is the one the signature is valid for
+	sig := convertWords(signature, 5, 8, false)
+	if sig[64] > 3 {
+		return Bolt11{}, fmt.Errorf("%w: invalid recovery id %d", ErrInvalidBolt11, sig[64])
+	}
+	hash := sha256.Sum256(append([]byte(hrp), convertWords(signed, 5, 8, true)...))
+	compact := append([]byte{27 + 4 + sig[64]}, sig[:64]...)
+	pubkey, _, err := ecdsa.RecoverCompact(compact, hash[:])
+	if err != nil {
+		return Bolt11{}, fmt.Errorf("%w: %v", ErrInvalidBolt11, err)
+	}
+	inv.Payee = hex.EncodeToString(pubkey.SerializeCompressed())
+	if payee != nil && hex.EncodeToString(payee) != inv.Payee {
+		return Bolt11{}, fmt.Errorf("%w: not signed by the payee %x", ErrInvalidBolt11, payee)
+	}
+
+	return inv, nil
+}
+
+func (inv *Bolt11) parseHRP(hrp string) error {
+	if !strings.HasPrefix(hrp, "ln") {
+		return fmt.Errorf("%w: not an invoice", ErrInvalidBolt11)
+	}
+	rest := hrp[2:]
+
+	end := strings.IndexAny(rest, "0123456789")
+	if end < 0 {
+		inv.Currency = rest
+		return nil
+	}
+	inv.Currency, rest = rest[:end], rest[end:]
+
+	multiplier := rest[len(rest)-1]
+	if multiplier >= '0' && multiplier <= '9' {
+		multiplier = 0
+	} else {
+		rest = rest[:len(rest)-1]
+	}
+	amount, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid amount '%s'", ErrInvalidBolt11, rest)
+	}
+
+	switch multiplier {
+	case 0:
+		inv.MSatoshi = amount * 100000000000
+	case 'm':
+		inv.MSatoshi = amount * 100000000
+	case 'u':
+		inv.MSatoshi = amount * 100000
+	case 'n':
+		inv.MSatoshi = amount * 100
+	case 'p':
+		if amount%10 != 0 {
+			return fmt.Errorf("%w: amount has sub-millisatoshi precision", ErrInvalidBolt11)
+		}
+		inv.MSatoshi = amount / 10
+	default:
+		return fmt.Errorf("%w: invalid multiplier '%c'", ErrInvalidBolt11, multiplier)
+	}
+	return nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// convertWords regroups bits, the last incomplete group is padded with zeros
+// when pad is set and dropped otherwise.
+func convertWords(data []byte, from, to uint, pad bool) []byte {
+	var acc uint32
+	var bits uint
+	var out []byte
+	maxv := uint32(1)<<to - 1
+	for _, b := range data {
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad && bits > 0 {
+		out = append(out, byte(acc<<(to-bits)&maxv))
+	}
+	return out
+}
+
+func wordsToUint(words []byte) uint64 {
+	var n uint64
+	for _, w := range words {
+		n = n<<5 | uint64(w)
+	}
+	return n
+}
+
+// FillPaymentDetails fills the destination, amount and description of a
+// payment status that are missing with the ones in the invoice paid, for
+// backends that don't report them.
+func FillPaymentDetails(status PaymentStatus, invoice string) PaymentStatus {
+	if invoice == "" {
+		return status
+	}
+	inv, err := DecodeBolt11(invoice)
+	if err != nil {
+		return status
+	}
+	if status.Destination == "" {
+		status.Destination = inv.Payee
+	}
+	if status.Msatoshi == 0 {
+		status.Msatoshi = inv.MSatoshi
+	}
+	if status.Description == "" {
+		status.Description = inv.Description
+	}
+	return status
+}
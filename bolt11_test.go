@@ -0,0 +1,160 @@
+package relampago_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	rp "github.com/lnbits/relampago"
+)
+
+func TestDecodeBolt11(t *testing.T) {
+	// from the BOLT11 examples, "1 cup coffee" within one minute
+	inv, err := rp.DecodeBolt11("lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srp")
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	expected := rp.Bolt11{
+		Currency:           "bc",
+		MSatoshi:           250000000,
+		CreatedAt:          time.Unix(1496314658, 0),
+		Expiry:             time.Minute,
+		Payee:              "03e7156ae33b0a208d0744199163177e909e80176e55d97a2f221ede0f934dd9ad",
+		PaymentHash:        "0001020304050607080900010203040506070809000102030405060708090102",
+		Description:        "1 cup coffee",
+		MinFinalCLTVExpiry: 18,
+	}
+	if inv != expected {
+		t.Errorf("got %+v, wanted %+v", inv, expected)
+	}
+}
+
+func TestDecodeBolt11_Invalid(t *testing.T) {
+	for _, invoice := range []string{
+		"",
+		"lnbc1qqqqqq",
+		// last character changed
+		"lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srq",
+	} {
+		if _, err := rp.DecodeBolt11(invoice); err == nil {
+			t.Errorf("%s: got %v, wanted an error", invoice, err)
+		}
+	}
+}
+
+func TestDecodeBolt11_Payee(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes([]byte(strings.Repeat("k", 32)))
+	other, _ := btcec.PrivKeyFromBytes([]byte(strings.Repeat("o", 32)))
+	payee := key.PubKey().SerializeCompressed()
+
+	inv, err := rp.DecodeBolt11(signBolt11(key, payee))
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if inv.Payee != hex.EncodeToString(payee) {
+		t.Errorf("got %v, wanted %x", inv.Payee, payee)
+	}
+
+	// the n field says other, but key signed it
+	if _, err := rp.DecodeBolt11(signBolt11(key, other.PubKey().SerializeCompressed())); !errors.Is(err, rp.ErrInvalidBolt11) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrInvalidBolt11)
+	}
+}
+
+// signBolt11 re-signs the coffee invoice of the BOLT11 examples with key,
+// adding an n field with payee.
+func signBolt11(key *btcec.PrivateKey, payee []byte) string {
+	const coffee = "lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srp"
+	const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	hrp, data := "lnbc2500u", coffee[len("lnbc2500u1"):]
+
+	var words []byte
+	for _, c := range data[:len(data)-104-6] {
+		words = append(words, byte(strings.IndexRune(charset, c)))
+	}
+	words = append(words, byte(strings.IndexRune(charset, 'n')), 1, 21) // 53 words
+	words = append(words, regroup(payee, 8, 5)...)
+
+	hash := sha256.Sum256(append([]byte(hrp), regroup(words, 5, 8)...))
+	compact, _ := ecdsa.SignCompact(key, hash[:], true)
+	sig := append(compact[1:], compact[0]-27-4)
+	words = append(words, regroup(sig, 8, 5)...)
+
+	values := []byte{}
+	for _, c := range hrp {
+		values = append(values, byte(c)>>5)
+	}
+	values = append(values, 0)
+	for _, c := range hrp {
+		values = append(values, byte(c)&31)
+	}
+	values = append(append(values, words...), 0, 0, 0, 0, 0, 0)
+	checksum := polymod(values) ^ 1
+	for i := 0; i < 6; i++ {
+		words = append(words, byte(checksum>>uint(5*(5-i))&31))
+	}
+
+	invoice := hrp + "1"
+	for _, w := range words {
+		invoice += string(charset[w])
+	}
+	return invoice
+}
+
+func regroup(data []byte, from, to uint) []byte {
+	var acc uint32
+	var bits uint
+	var out []byte
+	for _, b := range data {
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&(1<<to-1)))
+		}
+	}
+	if bits > 0 {
+		out = append(out, byte(acc<<(to-bits)&(1<<to-1)))
+	}
+	return out
+}
+
+func polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func TestFillPaymentDetails(t *testing.T) {
+	invoice := "lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srp"
+
+	status := rp.FillPaymentDetails(rp.PaymentStatus{CheckingID: "ab", Msatoshi: 1000}, invoice)
+	expected := rp.PaymentStatus{
+		CheckingID:  "ab",
+		Destination: "03e7156ae33b0a208d0744199163177e909e80176e55d97a2f221ede0f934dd9ad",
+		Msatoshi:    1000, // kept, it may have been a custom amount
+		Description: "1 cup coffee",
+	}
+	if status != expected {
+		t.Errorf("got %+v, wanted %+v", status, expected)
+	}
+
+	if status := rp.FillPaymentDetails(rp.PaymentStatus{CheckingID: "ab"}, "invalid"); status.Description != "" {
+		t.Errorf("got %+v, wanted nothing filled from an invalid invoice", status)
+	}
+}
@@ -0,0 +1,333 @@
+package breez
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/breez/breez-sdk-go/breez_sdk"
+	rp "github.com/lnbits/relampago"
+)
+
+type Params struct {
+	APIKey   string
+	Mnemonic string
+
+	// InviteCode is only needed the first time, when the greenlight node is
+	// registered.
+	InviteCode string
+
+	WorkingDir string // where the sdk keeps its state, defaults to the current directory
+	Staging    bool
+}
+
+// BreezWallet runs a Greenlight node through the Breez SDK, so apps can receive
+// and send without hosting a node.
+type BreezWallet struct {
+	Params
+	sdk     *breez_sdk.BlockingBreezServices
+	network breez_sdk.Network
+
+	invoices rp.InvoiceBroadcaster
+	payments rp.PaymentBroadcaster
+}
+
+func Start(params Params) (*BreezWallet, error) {
+	seed, err := breez_sdk.MnemonicToSeed(params.Mnemonic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic: %w", err)
+	}
+
+	environment := breez_sdk.EnvironmentTypeProduction
+	if params.Staging {
+		environment = breez_sdk.EnvironmentTypeStaging
+	}
+	var inviteCode *string
+	if params.InviteCode != "" {
+		inviteCode = &params.InviteCode
+	}
+	config := breez_sdk.DefaultConfig(environment, params.APIKey, breez_sdk.NodeConfigGreenlight{
+		Config: breez_sdk.GreenlightNodeConfig{InviteCode: inviteCode},
+	})
+	if params.WorkingDir != "" {
+		config.WorkingDir = params.WorkingDir
+	}
+
+	b := &BreezWallet{
+		Params:  params,
+		network: config.Network,
+	}
+
+	sdk, err := breez_sdk.Connect(breez_sdk.ConnectRequest{Config: config, Seed: seed}, listener{b})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to breez: %w", err)
+	}
+	b.sdk = sdk
+
+	return b, nil
+}
+
+// Disconnect stops the sdk, which should be done before exiting.
+func (b *BreezWallet) Disconnect() error {
+	return b.sdk.Disconnect()
+}
+
+// Compile time check to ensure that BreezWallet fully implements rp.Wallet
+var _ rp.Wallet = (*BreezWallet)(nil)
+
+func (b *BreezWallet) Kind() string {
+	return "breez"
+}
+
+func (b *BreezWallet) Capabilities() rp.Capabilities {
+	return rp.Capabilities{
+		MaxDescriptionLength: rp.MaxBolt11DescriptionLength,
+	}
+}
+
+func (b *BreezWallet) GetInfo() (rp.WalletInfo, error) {
+	state, err := b.sdk.NodeInfo()
+	if err != nil {
+		return rp.WalletInfo{}, fmt.Errorf("error getting node info: %w", err)
+	}
+
+	return rp.WalletInfo{Balance: int64(state.ChannelsBalanceMsat / 1000)}, nil
+}
+
+// Compile time check to ensure that BreezWallet implements rp.NodeInfoProvider
+var _ rp.NodeInfoProvider = (*BreezWallet)(nil)
+
+func (b *BreezWallet) GetNodeInfo() (rp.NodeInfo, error) {
+	state, err := b.sdk.NodeInfo()
+	if err != nil {
+		return rp.NodeInfo{}, fmt.Errorf("error getting node info: %w", err)
+	}
+
+	network := "mainnet"
+	switch b.network {
+	case breez_sdk.NetworkTestnet:
+		network = "testnet"
+	case breez_sdk.NetworkSignet:
+		network = "signet"
+	case breez_sdk.NetworkRegtest:
+		network = "regtest"
+	}
+
+	return rp.NodeInfo{
+		Pubkey:      state.Id,
+		Network:     network,
+		BlockHeight: int64(state.BlockHeight),
+	}, nil
+}
+
+func (b *BreezWallet) Health(ctx context.Context) (rp.HealthStatus, error) {
+	if _, err := b.sdk.NodeInfo(); err != nil {
+		return rp.HealthStatus{}, fmt.Errorf("error getting node info: %w", err)
+	}
+
+	// greenlight nodes are kept synced by blockstream
+	return rp.HealthStatus{
+		Connected:     true,
+		SyncedToChain: true,
+		SyncedToGraph: true,
+		StreamsAlive:  true,
+	}, nil
+}
+
+func (b *BreezWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	if err := rp.ValidateInvoiceParams(b.Capabilities(), params); err != nil {
+		return rp.InvoiceData{}, err
+	}
+	if params.DescriptionHash != nil && params.Description == "" {
+		return rp.InvoiceData{}, fmt.Errorf(
+			"%w: breez needs the description to make a description hash invoice", rp.ErrUnsupported)
+	}
+
+	preimage, err := rp.InvoicePreimage(params)
+	if err != nil {
+		return rp.InvoiceData{}, err
+	}
+
+	req := breez_sdk.ReceivePaymentRequest{
+		AmountMsat:  uint64(params.Msatoshi),
+		Description: params.Description,
+		Preimage:    &preimage,
+	}
+	if params.DescriptionHash != nil {
+		useHash := true
+		req.UseDescriptionHash = &useHash
+	}
+	if params.Expiry != nil {
+		expiry := uint32(params.Expiry.Seconds())
+		req.Expiry = &expiry
+	}
+
+	res, err := b.sdk.ReceivePayment(req)
+	if err != nil {
+		return rp.InvoiceData{}, fmt.Errorf("error creating invoice: %w", err)
+	}
+
+	return rp.InvoiceData{
+		Invoice:    res.LnInvoice.Bolt11,
+		Preimage:   hex.EncodeToString(preimage),
+		CheckingID: res.LnInvoice.PaymentHash,
+	}, nil
+}
+
+// GetInvoiceStatus only knows about paid invoices, as the sdk doesn't list the
+// others, so any other one is reported as existing and unpaid.
+func (b *BreezWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	payment, err := b.sdk.PaymentByHash(checkingID)
+	if err != nil {
+		return rp.InvoiceLookupFailed(checkingID,
+			fmt.Errorf("error getting payment %s: %w", checkingID, err))
+	}
+	if payment == nil || payment.PaymentType != breez_sdk.PaymentTypeReceived {
+		return rp.InvoiceStatus{CheckingID: checkingID, Exists: true}, nil
+	}
+
+	return invoiceStatus(checkingID, *payment), nil
+}
+
+func (b *BreezWallet) CancelInvoice(checkingID string) error {
+	return fmt.Errorf("%w: breez can't cancel invoices", rp.ErrUnsupported)
+}
+
+func (b *BreezWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	listener, _ := b.invoices.Subscribe()
+	return listener, nil
+}
+
+func (b *BreezWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	inv, err := rp.DecodeBolt11(params.Invoice)
+	if err != nil {
+		return rp.PaymentData{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+	}
+
+	amount := inv.MSatoshi
+	if params.CustomAmount != 0 {
+		amount = params.CustomAmount
+	}
+	if err := rp.ValidatePayment(b.Capabilities(), params, amount); err != nil {
+		return rp.PaymentData{}, err
+	}
+
+	req := breez_sdk.SendPaymentRequest{Bolt11: params.Invoice}
+	if params.CustomAmount != 0 {
+		custom := uint64(params.CustomAmount)
+		req.AmountMsat = &custom
+	}
+
+	// the result comes as an event
+	go b.sdk.SendPayment(req)
+
+	return rp.PaymentData{
+		CheckingID: inv.PaymentHash,
+	}, nil
+}
+
+func (b *BreezWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	payment, err := b.sdk.PaymentByHash(checkingID)
+	if err != nil {
+		return rp.PaymentStatus{}, fmt.Errorf("error getting payment %s: %w", checkingID, err)
+	}
+	if payment == nil || payment.PaymentType != breez_sdk.PaymentTypeSent {
+		return rp.PaymentStatus{CheckingID: checkingID, Status: rp.NeverTried}, nil
+	}
+
+	return paymentStatus(checkingID, *payment), nil
+}
+
+func (b *BreezWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	listener, _ := b.payments.Subscribe()
+	return listener, nil
+}
+
+// Compile time check to ensure that BreezWallet implements rp.Subscriber
+var _ rp.Subscriber = (*BreezWallet)(nil)
+
+func (b *BreezWallet) SubscribePaidInvoices() (<-chan rp.InvoiceStatus, func()) {
+	return b.invoices.Subscribe()
+}
+
+func (b *BreezWallet) SubscribePayments() (<-chan rp.PaymentStatus, func()) {
+	return b.payments.Subscribe()
+}
+
+// listener gets the sdk events, it is given to the sdk before it connects.
+type listener struct{ b *BreezWallet }
+
+func (l listener) OnEvent(e breez_sdk.BreezEvent) {
+	switch e := e.(type) {
+	case breez_sdk.BreezEventInvoicePaid:
+		if e.Details.Payment == nil {
+			l.b.invoices.Publish(rp.InvoiceStatus{
+				CheckingID: e.Details.PaymentHash,
+				Exists:     true,
+				Paid:       true,
+			})
+			return
+		}
+		l.b.invoices.Publish(invoiceStatus(e.Details.PaymentHash, *e.Details.Payment))
+	case breez_sdk.BreezEventPaymentSucceed:
+		if details, ok := e.Details.Details.(breez_sdk.PaymentDetailsLn); ok {
+			l.b.payments.Publish(paymentStatus(details.Data.PaymentHash, e.Details))
+		}
+	case breez_sdk.BreezEventPaymentFailed:
+		if e.Details.Invoice != nil {
+			l.b.payments.Publish(rp.PaymentStatus{
+				CheckingID: e.Details.Invoice.PaymentHash,
+				Status:     rp.Failed,
+				ResolvedAt: time.Now(),
+			})
+		}
+	}
+}
+
+func invoiceStatus(checkingID string, payment breez_sdk.Payment) rp.InvoiceStatus {
+	status := rp.InvoiceStatus{
+		CheckingID: checkingID,
+		Exists:     true,
+		Paid:       payment.Status == breez_sdk.PaymentStatusComplete,
+	}
+	if status.Paid {
+		status.MSatoshiReceived = int64(payment.AmountMsat)
+		status.SettledAt = time.Unix(payment.PaymentTime, 0)
+	}
+	if payment.Description != nil {
+		status.Description = *payment.Description
+	}
+	return status
+}
+
+func paymentStatus(checkingID string, payment breez_sdk.Payment) rp.PaymentStatus {
+	status := rp.PaymentStatus{
+		CheckingID: checkingID,
+		Msatoshi:   int64(payment.AmountMsat),
+	}
+	if payment.Description != nil {
+		status.Description = *payment.Description
+	}
+	if details, ok := payment.Details.(breez_sdk.PaymentDetailsLn); ok {
+		status.Destination = details.Data.DestinationPubkey
+		status = rp.FillPaymentDetails(status, details.Data.Bolt11)
+	}
+	switch payment.Status {
+	case breez_sdk.PaymentStatusPending:
+		status.Status = rp.Pending
+	case breez_sdk.PaymentStatusFailed:
+		status.Status = rp.Failed
+		status.ResolvedAt = time.Unix(payment.PaymentTime, 0)
+	case breez_sdk.PaymentStatusComplete:
+		status.Status = rp.Complete
+		status.FeePaid = int64(payment.FeeMsat)
+		status.ResolvedAt = time.Unix(payment.PaymentTime, 0)
+		if details, ok := payment.Details.(breez_sdk.PaymentDetailsLn); ok {
+			status.Preimage = details.Data.PaymentPreimage
+		}
+	default:
+		status.Status = rp.Unknown
+	}
+	return status
+}
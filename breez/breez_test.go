@@ -0,0 +1,59 @@
+package breez
+
+import (
+	"testing"
+	"time"
+
+	"github.com/breez/breez-sdk-go/breez_sdk"
+	rp "github.com/lnbits/relampago"
+)
+
+func TestPaymentStatus(t *testing.T) {
+	details := breez_sdk.PaymentDetailsLn{Data: breez_sdk.LnPaymentDetails{PaymentHash: "ab", PaymentPreimage: "cd"}}
+	for _, c := range []struct {
+		name    string
+		payment breez_sdk.Payment
+		want    rp.PaymentStatus
+	}{
+		{
+			name:    "pending",
+			payment: breez_sdk.Payment{Status: breez_sdk.PaymentStatusPending, Details: details},
+			want:    rp.PaymentStatus{CheckingID: "ab", Status: rp.Pending},
+		},
+		{
+			name:    "failed",
+			payment: breez_sdk.Payment{Status: breez_sdk.PaymentStatusFailed, PaymentTime: 1600000000},
+			want:    rp.PaymentStatus{CheckingID: "ab", Status: rp.Failed, ResolvedAt: time.Unix(1600000000, 0)},
+		},
+		{
+			name: "complete",
+			payment: breez_sdk.Payment{
+				Status: breez_sdk.PaymentStatusComplete, PaymentTime: 1600000000,
+				FeeMsat: 12, Details: details,
+			},
+			want: rp.PaymentStatus{
+				CheckingID: "ab", Status: rp.Complete, FeePaid: 12, Preimage: "cd",
+				ResolvedAt: time.Unix(1600000000, 0),
+			},
+		},
+	} {
+		if got := paymentStatus("ab", c.payment); got != c.want {
+			t.Errorf("%s: got %+v, wanted %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestInvoiceStatus(t *testing.T) {
+	description := "coffee"
+	got := invoiceStatus("ab", breez_sdk.Payment{
+		Status: breez_sdk.PaymentStatusComplete, AmountMsat: 5000,
+		PaymentTime: 1600000000, Description: &description,
+	})
+	want := rp.InvoiceStatus{
+		CheckingID: "ab", Exists: true, Paid: true, MSatoshiReceived: 5000,
+		Description: "coffee", SettledAt: time.Unix(1600000000, 0),
+	}
+	if got != want {
+		t.Errorf("got %+v, wanted %+v", got, want)
+	}
+}
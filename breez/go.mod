@@ -0,0 +1,13 @@
+module github.com/lnbits/relampago/breez
+
+go 1.18
+
+require (
+	github.com/breez/breez-sdk-go v0.5.2
+	github.com/lnbits/relampago v0.1.0
+)
+
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.2.1 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+)
@@ -0,0 +1,204 @@
+package relampago
+
+import "sync"
+
+// OverflowPolicy is what a broadcaster does when a subscriber's buffer is
+// full.
+type OverflowPolicy int
+
+const (
+	// Backpressure waits until the subscriber reads, which holds back the
+	// updates of every other subscriber too.
+	Backpressure OverflowPolicy = iota
+
+	// Drop skips the update for the subscriber that isn't keeping up.
+	Drop
+
+	// Block is the old name of Backpressure.
+	//
+	// Deprecated: use Backpressure.
+	Block = Backpressure
+)
+
+// StreamBufferSize is how many updates each subscriber channel buffers.
+var StreamBufferSize = 16
+
+// Subscriber is implemented by wallets whose streams can be unsubscribed
+// from. Calling the returned func stops the updates and closes the channel.
+type Subscriber interface {
+	SubscribePaidInvoices() (<-chan InvoiceStatus, func())
+	SubscribePayments() (<-chan PaymentStatus, func())
+}
+
+// InvoiceBroadcaster fans invoice updates out to its subscribers. The zero
+// value is ready to use and it is safe for concurrent use.
+type InvoiceBroadcaster struct {
+	Policy OverflowPolicy
+	b      broadcaster
+}
+
+func (s *InvoiceBroadcaster) Subscribe() (<-chan InvoiceStatus, func()) {
+	ch := make(chan InvoiceStatus, StreamBufferSize)
+	cancel := s.b.subscribe(func(v interface{}, done <-chan struct{}, policy OverflowPolicy) {
+		if policy == Drop {
+			select {
+			case ch <- v.(InvoiceStatus):
+			default:
+			}
+			return
+		}
+		select {
+		case ch <- v.(InvoiceStatus):
+		case <-done:
+		}
+	}, func() { close(ch) })
+	return ch, cancel
+}
+
+func (s *InvoiceBroadcaster) Publish(status InvoiceStatus) {
+	s.b.publish(status, s.Policy)
+}
+
+// PaymentBroadcaster is like InvoiceBroadcaster for payment updates.
+type PaymentBroadcaster struct {
+	Policy OverflowPolicy
+	b      broadcaster
+}
+
+func (s *PaymentBroadcaster) Subscribe() (<-chan PaymentStatus, func()) {
+	ch := make(chan PaymentStatus, StreamBufferSize)
+	cancel := s.b.subscribe(func(v interface{}, done <-chan struct{}, policy OverflowPolicy) {
+		if policy == Drop {
+			select {
+			case ch <- v.(PaymentStatus):
+			default:
+			}
+			return
+		}
+		select {
+		case ch <- v.(PaymentStatus):
+		case <-done:
+		}
+	}, func() { close(ch) })
+	return ch, cancel
+}
+
+func (s *PaymentBroadcaster) Publish(status PaymentStatus) {
+	s.b.publish(status, s.Policy)
+}
+
+// OnchainTxBroadcaster is like InvoiceBroadcaster for onchain transactions.
+type OnchainTxBroadcaster struct {
+	Policy OverflowPolicy
+	b      broadcaster
+}
+
+func (s *OnchainTxBroadcaster) Subscribe() (<-chan OnchainTransaction, func()) {
+	ch := make(chan OnchainTransaction, StreamBufferSize)
+	cancel := s.b.subscribe(func(v interface{}, done <-chan struct{}, policy OverflowPolicy) {
+		if policy == Drop {
+			select {
+			case ch <- v.(OnchainTransaction):
+			default:
+			}
+			return
+		}
+		select {
+		case ch <- v.(OnchainTransaction):
+		case <-done:
+		}
+	}, func() { close(ch) })
+	return ch, cancel
+}
+
+func (s *OnchainTxBroadcaster) Publish(tx OnchainTransaction) {
+	s.b.publish(tx, s.Policy)
+}
+
+// EventBroadcaster is like InvoiceBroadcaster for events.
+type EventBroadcaster struct {
+	Policy OverflowPolicy
+	b      broadcaster
+}
+
+func (s *EventBroadcaster) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, StreamBufferSize)
+	cancel := s.b.subscribe(func(v interface{}, done <-chan struct{}, policy OverflowPolicy) {
+		if policy == Drop {
+			select {
+			case ch <- v.(Event):
+			default:
+			}
+			return
+		}
+		select {
+		case ch <- v.(Event):
+		case <-done:
+		}
+	}, func() { close(ch) })
+	return ch, cancel
+}
+
+func (s *EventBroadcaster) Publish(event Event) {
+	s.b.publish(event, s.Policy)
+}
+
+// broadcaster does the locking for the typed broadcasters above, which only
+// know how to send to their own channels.
+type broadcaster struct {
+	mu     sync.RWMutex
+	subs   map[int]*subscription
+	nextID int
+}
+
+type subscription struct {
+	// send blocks, following the policy, until v is sent or done is closed
+	send    func(v interface{}, done <-chan struct{}, policy OverflowPolicy)
+	closeCh func()
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (b *broadcaster) subscribe(
+	send func(v interface{}, done <-chan struct{}, policy OverflowPolicy),
+	closeCh func(),
+) func() {
+	sub := &subscription{send: send, closeCh: closeCh, done: make(chan struct{})}
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[int]*subscription)
+	}
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+	b.mu.Unlock()
+
+	return func() {
+		sub.once.Do(func() {
+			// unblock a publish waiting on this subscriber before taking the
+			// lock, then nothing can be sending on the channel when it closes
+			close(sub.done)
+
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+
+			sub.closeCh()
+		})
+	}
+}
+
+func (b *broadcaster) publish(v interface{}, policy OverflowPolicy) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subs {
+		select {
+		case <-sub.done:
+			continue
+		default:
+		}
+		sub.send(v, sub.done, policy)
+	}
+}
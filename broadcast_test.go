@@ -0,0 +1,58 @@
+package relampago
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBroadcasterUnsubscribe(t *testing.T) {
+	var b PaymentBroadcaster
+	first, cancelFirst := b.Subscribe()
+	second, cancelSecond := b.Subscribe()
+	defer cancelSecond()
+
+	b.Publish(PaymentStatus{CheckingID: "a"})
+	cancelFirst()
+	cancelFirst() // twice is fine
+	b.Publish(PaymentStatus{CheckingID: "b"})
+
+	var got []string
+	for status := range first {
+		got = append(got, status.CheckingID)
+	}
+	if len(got) != 1 || got[0] != "a" {
+		t.Errorf("got %v, wanted only %v", got, "a")
+	}
+	if status := <-second; status.CheckingID != "a" {
+		t.Errorf("got %v, wanted %v", status.CheckingID, "a")
+	}
+	if status := <-second; status.CheckingID != "b" {
+		t.Errorf("got %v, wanted %v", status.CheckingID, "b")
+	}
+}
+
+func TestBroadcasterPolicy(t *testing.T) {
+	dropping := InvoiceBroadcaster{Policy: Drop}
+	stream, cancel := dropping.Subscribe()
+	for i := 0; i < StreamBufferSize+5; i++ {
+		dropping.Publish(InvoiceStatus{})
+	}
+	if len(stream) != StreamBufferSize {
+		t.Errorf("got %v, wanted %v buffered", len(stream), StreamBufferSize)
+	}
+	cancel()
+
+	// a blocked publish gives up when the subscriber leaves
+	var blocking InvoiceBroadcaster
+	_, cancel = blocking.Subscribe()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < StreamBufferSize+1; i++ {
+			blocking.Publish(InvoiceStatus{})
+		}
+	}()
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,214 @@
+package budget
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	rp "github.com/lnbits/relampago"
+)
+
+var ErrInsufficientBudget = errors.New("insufficient budget")
+
+type Params struct {
+	Wallet rp.Wallet
+
+	// Limit is the total amount in msatoshi that can be spent, fees included.
+	Limit int64
+
+	// FeeReserve is how much is reserved for fees on top of each payment,
+	// defaults to 1% of the amount with a minimum of 2 sat.
+	FeeReserve func(msatoshi int64) int64
+}
+
+// BudgetWallet wraps another wallet so concurrent payments can't collectively
+// spend more than the budget: each payment reserves its amount plus the maximum
+// fee before being sent, then the reservation is committed with the actual fee
+// when the payment succeeds or released when it fails. The fee reserve is
+// passed on as MaxFeeMsatoshi, so backends that support it can't pay more.
+type BudgetWallet struct {
+	rp.Wallet
+	feeReserve func(int64) int64
+
+	mu           sync.Mutex
+	limit        int64
+	spent        int64
+	reservations map[string]reservation
+	counted      map[string]bool // checking ids of the payments in spent
+	nextPending  int
+	inFlight     int
+
+	// statuses that arrived while a MakePayment call was still in flight, in
+	// case they belong to it
+	early map[string]rp.PaymentStatus
+}
+
+type reservation struct {
+	amount int64
+	total  int64 // amount plus fee allowance
+}
+
+func Start(params Params) (*BudgetWallet, error) {
+	if params.FeeReserve == nil {
+		params.FeeReserve = defaultFeeReserve
+	}
+
+	payments, err := params.Wallet.PaymentsStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+	}
+
+	b := &BudgetWallet{
+		Wallet:       params.Wallet,
+		feeReserve:   params.FeeReserve,
+		limit:        params.Limit,
+		reservations: make(map[string]reservation),
+		counted:      make(map[string]bool),
+		early:        make(map[string]rp.PaymentStatus),
+	}
+
+	go func() {
+		for status := range payments {
+			b.settle(status)
+		}
+	}()
+
+	return b, nil
+}
+
+func defaultFeeReserve(msatoshi int64) int64 {
+	fee := msatoshi / 100
+	if fee < 2000 {
+		fee = 2000
+	}
+	return fee
+}
+
+func (b *BudgetWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	inv, err := rp.DecodeBolt11(params.Invoice)
+	if err != nil {
+		return rp.PaymentData{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+	}
+	amount := inv.MSatoshi
+	if params.CustomAmount != 0 {
+		amount = params.CustomAmount
+	}
+	fee := b.feeReserve(amount)
+	if params.MaxFeeMsatoshi == 0 || params.MaxFeeMsatoshi > fee {
+		params.MaxFeeMsatoshi = fee
+	} else {
+		fee = params.MaxFeeMsatoshi
+	}
+	reserve := reservation{amount: amount, total: amount + fee}
+
+	b.mu.Lock()
+	if available := b.available(); reserve.total > available {
+		b.mu.Unlock()
+		return rp.PaymentData{}, fmt.Errorf("%w: payment needs %d msat, %d msat available",
+			ErrInsufficientBudget, reserve.total, available)
+	}
+	// reserve under a temporary key until we know the checking id
+	b.nextPending++
+	key := fmt.Sprintf("pending:%d", b.nextPending)
+	b.reservations[key] = reserve
+	b.inFlight++
+	b.mu.Unlock()
+
+	data, err := b.Wallet.MakePayment(params)
+
+	// an error doesn't mean nothing was sent, after a timeout the payment may
+	// still be in flight, so keep the reservation until it's final
+	release := false
+	if err != nil {
+		data.CheckingID = inv.PaymentHash
+		status, serr := b.Wallet.GetPaymentStatus(inv.PaymentHash)
+		release = serr == nil && (status.Status == rp.Failed || status.Status == rp.NeverTried)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.reservations, key)
+	b.inFlight--
+	if !release && !b.counted[data.CheckingID] {
+		b.reservations[data.CheckingID] = reserve
+		if status, ok := b.early[data.CheckingID]; ok {
+			b.settleLocked(status)
+		}
+	}
+	if b.inFlight == 0 {
+		b.early = make(map[string]rp.PaymentStatus)
+	}
+
+	if err != nil {
+		return rp.PaymentData{}, err
+	}
+	return data, nil
+}
+
+func (b *BudgetWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	status, err := b.Wallet.GetPaymentStatus(checkingID)
+	if err == nil {
+		b.settle(status)
+	}
+	return status, err
+}
+
+// settle commits or releases the reservation for a payment that reached a
+// terminal status.
+func (b *BudgetWallet) settle(status rp.PaymentStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.settleLocked(status)
+}
+
+func (b *BudgetWallet) settleLocked(status rp.PaymentStatus) {
+	reserve, ok := b.reservations[status.CheckingID]
+	if !ok {
+		if b.inFlight > 0 {
+			b.early[status.CheckingID] = status
+		}
+		return
+	}
+
+	switch status.Status {
+	case rp.Complete:
+		// a payment can be reported complete again, by the stream and by
+		// GetPaymentStatus, or reserved again by paying its invoice twice
+		if !b.counted[status.CheckingID] {
+			b.spent += reserve.amount + status.FeePaid
+			b.counted[status.CheckingID] = true
+		}
+		delete(b.reservations, status.CheckingID)
+	case rp.Failed, rp.NeverTried:
+		delete(b.reservations, status.CheckingID)
+	}
+}
+
+// Available is the budget minus what was spent and what is reserved.
+func (b *BudgetWallet) Available() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.available()
+}
+
+func (b *BudgetWallet) available() int64 {
+	available := b.limit - b.spent
+	for _, reserve := range b.reservations {
+		available -= reserve.total
+	}
+	return available
+}
+
+func (b *BudgetWallet) Spent() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spent
+}
+
+// AddBudget raises (or lowers, when negative) the limit.
+func (b *BudgetWallet) AddBudget(msatoshi int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit += msatoshi
+}
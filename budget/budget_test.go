@@ -0,0 +1,142 @@
+package budget
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+// the BOLT11 spec's 250000 sat invoice
+const coffee = "lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srp"
+
+type countingWallet struct {
+	void.VoidWallet
+	n        int
+	statuses chan rp.PaymentStatus
+	maxFee   int64
+
+	err    error     // returned by MakePayment
+	status rp.Status // returned by GetPaymentStatus
+}
+
+func (w *countingWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	w.n++
+	w.maxFee = params.MaxFeeMsatoshi
+	if w.err != nil {
+		return rp.PaymentData{}, w.err
+	}
+	return rp.PaymentData{CheckingID: strconv.Itoa(w.n)}, nil
+}
+
+func (w *countingWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	return rp.PaymentStatus{CheckingID: checkingID, Status: w.status}, nil
+}
+
+func (w *countingWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	return w.statuses, nil
+}
+
+func TestReservations(t *testing.T) {
+	wallet := &countingWallet{statuses: make(chan rp.PaymentStatus)}
+	b, err := Start(Params{Wallet: wallet, Limit: 250000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	// each one reserves 100000 + 2000
+	for i := 0; i < 2; i++ {
+		if _, err := b.MakePayment(rp.PaymentParams{Invoice: coffee, CustomAmount: 100000}); err != nil {
+			t.Errorf("got %v, wanted %v", err, nil)
+		}
+	}
+	if wallet.maxFee != 2000 {
+		t.Errorf("got %v, wanted %v max fee", wallet.maxFee, 2000)
+	}
+	if _, err := b.MakePayment(rp.PaymentParams{Invoice: coffee, CustomAmount: 100000}); !errors.Is(err, ErrInsufficientBudget) {
+		t.Errorf("got %v, wanted %v", err, ErrInsufficientBudget)
+	}
+	if got := b.Available(); got != 46000 {
+		t.Errorf("got %v, wanted %v available", got, 46000)
+	}
+
+	wallet.statuses <- rp.PaymentStatus{CheckingID: "1", Status: rp.Complete, FeePaid: 500}
+	wallet.statuses <- rp.PaymentStatus{CheckingID: "2", Status: rp.Failed}
+	wallet.statuses <- rp.PaymentStatus{}
+
+	if got := b.Spent(); got != 100500 {
+		t.Errorf("got %v, wanted %v spent", got, 100500)
+	}
+	if got := b.Available(); got != 149500 {
+		t.Errorf("got %v, wanted %v available", got, 149500)
+	}
+}
+
+func TestReservations_MaxFee(t *testing.T) {
+	wallet := &countingWallet{statuses: make(chan rp.PaymentStatus)}
+	b, err := Start(Params{Wallet: wallet, Limit: 250000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	// a lower cap from the caller is kept and reserves less
+	if _, err := b.MakePayment(rp.PaymentParams{Invoice: coffee, CustomAmount: 100000, MaxFeeMsatoshi: 500}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if wallet.maxFee != 500 {
+		t.Errorf("got %v, wanted %v max fee", wallet.maxFee, 500)
+	}
+	if got := b.Available(); got != 149500 {
+		t.Errorf("got %v, wanted %v available", got, 149500)
+	}
+}
+
+func TestReservations_FailedMakePayment(t *testing.T) {
+	const hash = "0001020304050607080900010203040506070809000102030405060708090102"
+	wallet := &countingWallet{statuses: make(chan rp.PaymentStatus), err: errors.New("timeout")}
+	b, err := Start(Params{Wallet: wallet, Limit: 250000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	// nothing was sent, so nothing stays reserved
+	wallet.status = rp.Failed
+	if _, err := b.MakePayment(rp.PaymentParams{Invoice: coffee, CustomAmount: 100000}); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+	if got := b.Available(); got != 250000 {
+		t.Errorf("got %v, wanted %v available", got, 250000)
+	}
+
+	// the payment may still be in flight, so it stays reserved until it's final
+	wallet.status = rp.Pending
+	if _, err := b.MakePayment(rp.PaymentParams{Invoice: coffee, CustomAmount: 100000}); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+	if got := b.Available(); got != 148000 {
+		t.Errorf("got %v, wanted %v available", got, 148000)
+	}
+
+	wallet.statuses <- rp.PaymentStatus{CheckingID: hash, Status: rp.Complete, FeePaid: 500}
+	wallet.statuses <- rp.PaymentStatus{}
+	if got := b.Spent(); got != 100500 {
+		t.Errorf("got %v, wanted %v spent", got, 100500)
+	}
+	// paying the invoice again fails as it is paid already, which isn't
+	// another spend however often it is reported complete
+	wallet.status = rp.Complete
+	if _, err := b.MakePayment(rp.PaymentParams{Invoice: coffee, CustomAmount: 100000}); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+	b.GetPaymentStatus(hash)
+	wallet.statuses <- rp.PaymentStatus{CheckingID: hash, Status: rp.Complete, FeePaid: 500}
+	wallet.statuses <- rp.PaymentStatus{}
+	if got := b.Spent(); got != 100500 {
+		t.Errorf("got %v, wanted %v spent", got, 100500)
+	}
+	if got := b.Available(); got != 149500 {
+		t.Errorf("got %v, wanted %v available", got, 149500)
+	}
+}
@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type Params struct {
+	Wallet rp.Wallet
+
+	// TTL is how long a status is reused, defaults to 2 seconds. Paid
+	// invoices and complete payments can't change anymore, so they are kept
+	// for FinalTTL, defaults to 10 minutes.
+	TTL      time.Duration
+	FinalTTL time.Duration
+}
+
+// CacheWallet answers GetInvoiceStatus and GetPaymentStatus from memory while
+// the last answer is fresh, so many clients polling the same invoice turn into
+// one lookup on the node per TTL. Stream events update the cached statuses, so
+// a settlement shows up right away instead of after the TTL.
+type CacheWallet struct {
+	rp.Wallet
+	ttl      time.Duration
+	finalTTL time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	invoices  map[string]invoiceEntry
+	payments  map[string]paymentEntry
+	lastSweep time.Time
+}
+
+type invoiceEntry struct {
+	status  rp.InvoiceStatus
+	expires time.Time
+}
+
+type paymentEntry struct {
+	status  rp.PaymentStatus
+	expires time.Time
+}
+
+func Start(params Params) (*CacheWallet, error) {
+	if params.TTL == 0 {
+		params.TTL = 2 * time.Second
+	}
+	if params.FinalTTL == 0 {
+		params.FinalTTL = 10 * time.Minute
+	}
+
+	invoices, err := params.Wallet.PaidInvoicesStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to invoices: %w", err)
+	}
+	payments, err := params.Wallet.PaymentsStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+	}
+
+	c := &CacheWallet{
+		Wallet:   params.Wallet,
+		ttl:      params.TTL,
+		finalTTL: params.FinalTTL,
+		now:      time.Now,
+		invoices: make(map[string]invoiceEntry),
+		payments: make(map[string]paymentEntry),
+	}
+
+	go func() {
+		for status := range invoices {
+			c.setInvoice(status)
+		}
+	}()
+	go func() {
+		for status := range payments {
+			c.setPayment(status)
+		}
+	}()
+
+	return c, nil
+}
+
+// Compile time check to ensure that CacheWallet fully implements rp.Wallet
+var _ rp.Wallet = (*CacheWallet)(nil)
+
+func (c *CacheWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	c.mu.Lock()
+	entry, ok := c.invoices[checkingID]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.status, nil
+	}
+
+	// errors aren't cached, the next call tries again
+	status, err := c.Wallet.GetInvoiceStatus(checkingID)
+	if err == nil {
+		c.setInvoice(status)
+	}
+	return status, err
+}
+
+func (c *CacheWallet) CancelInvoice(checkingID string) error {
+	err := c.Wallet.CancelInvoice(checkingID)
+	c.Forget(checkingID)
+	return err
+}
+
+func (c *CacheWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	data, err := c.Wallet.MakePayment(params)
+	if err == nil {
+		c.Forget(data.CheckingID)
+	}
+	return data, err
+}
+
+func (c *CacheWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	c.mu.Lock()
+	entry, ok := c.payments[checkingID]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.status, nil
+	}
+
+	status, err := c.Wallet.GetPaymentStatus(checkingID)
+	if err == nil {
+		c.setPayment(status)
+	}
+	return status, err
+}
+
+// Forget drops the cached statuses for a checking id, so the next lookup goes
+// to the backend.
+func (c *CacheWallet) Forget(checkingID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.invoices, checkingID)
+	delete(c.payments, checkingID)
+}
+
+func (c *CacheWallet) setInvoice(status rp.InvoiceStatus) {
+	ttl := c.ttl
+	if status.Paid && !status.Held {
+		ttl = c.finalTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	c.invoices[status.CheckingID] = invoiceEntry{status: status, expires: c.now().Add(ttl)}
+}
+
+func (c *CacheWallet) setPayment(status rp.PaymentStatus) {
+	ttl := c.ttl
+	if status.Status == rp.Complete {
+		ttl = c.finalTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	c.payments[status.CheckingID] = paymentEntry{status: status, expires: c.now().Add(ttl)}
+}
+
+// sweep drops expired entries, at most once per TTL.
+func (c *CacheWallet) sweep() {
+	now := c.now()
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+
+	for id, entry := range c.invoices {
+		if !now.Before(entry.expires) {
+			delete(c.invoices, id)
+		}
+	}
+	for id, entry := range c.payments {
+		if !now.Before(entry.expires) {
+			delete(c.payments, id)
+		}
+	}
+}
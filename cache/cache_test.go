@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+type countingWallet struct {
+	void.VoidWallet
+	lookups  int
+	paid     bool
+	invoices chan rp.InvoiceStatus
+}
+
+func (w *countingWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	w.lookups++
+	return rp.InvoiceStatus{CheckingID: checkingID, Exists: true, Paid: w.paid}, nil
+}
+
+func (w *countingWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	return w.invoices, nil
+}
+
+func TestInvoiceStatus(t *testing.T) {
+	wallet := &countingWallet{invoices: make(chan rp.InvoiceStatus)}
+	c, err := Start(Params{Wallet: wallet, TTL: time.Second})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	now := time.Unix(1600000000, 0)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		c.GetInvoiceStatus("ff")
+	}
+	if wallet.lookups != 1 {
+		t.Errorf("got %d lookups, wanted %d", wallet.lookups, 1)
+	}
+
+	now = now.Add(time.Second)
+	c.GetInvoiceStatus("ff")
+	if wallet.lookups != 2 {
+		t.Errorf("got %d lookups, wanted the expired status looked up again", wallet.lookups)
+	}
+
+	// a settlement replaces the cached status right away
+	wallet.invoices <- rp.InvoiceStatus{CheckingID: "ff", Exists: true, Paid: true}
+	wallet.invoices <- rp.InvoiceStatus{CheckingID: "other"}
+	if got, _ := c.GetInvoiceStatus("ff"); !got.Paid {
+		t.Errorf("got %v, wanted the paid status from the stream", got)
+	}
+
+	// and being final it is kept past the ttl
+	now = now.Add(time.Minute)
+	if got, _ := c.GetInvoiceStatus("ff"); !got.Paid || wallet.lookups != 2 {
+		t.Errorf("got %v after %d lookups, wanted the paid status from the cache", got, wallet.lookups)
+	}
+}
@@ -0,0 +1,46 @@
+package relampago
+
+import "strings"
+
+// Kinds are the backend kinds ParseCanonicalID recognizes, backends from
+// outside this module can add theirs.
+var Kinds = []string{
+	"lndgrpc", "eclair", "sparko", "commando", "breez", "nwc", "unified", "simnet", "test", "void",
+}
+
+// CanonicalID is a checking id in the "kind:opaque" format, where kind is the
+// Kind of the backend that issued it and opaque its own checking id. That is
+// the payment hash on most backends, so canonical ids stay resolvable by other
+// backends after a swap and the kind is only a hint of where to look first.
+// Invoices from sparko and commando are checked by their label instead, so
+// only those backends resolve them.
+func CanonicalID(kind string, checkingID string) string {
+	return kind + ":" + checkingID
+}
+
+// ParseCanonicalID splits a canonical id. Legacy ids, without one of the Kinds
+// before the first ':', like labels such as "order:123", are returned as they
+// are with an empty kind.
+func ParseCanonicalID(id string) (kind string, checkingID string) {
+	i := strings.IndexByte(id, ':')
+	if i < 0 {
+		return "", id
+	}
+	for _, known := range Kinds {
+		if id[:i] == known {
+			return known, id[i+1:]
+		}
+	}
+	return "", id
+}
+
+// MigrateCheckingID rewrites a legacy checking id issued by a backend of the
+// given kind to the canonical format, ids that already are canonical are
+// returned unchanged. Legacy eclair payment ids, which are uuids and not
+// payment hashes, still need that backend to be resolved.
+func MigrateCheckingID(id string, kind string) string {
+	if k, _ := ParseCanonicalID(id); k != "" {
+		return id
+	}
+	return CanonicalID(kind, id)
+}
@@ -0,0 +1,36 @@
+package relampago_test
+
+import (
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+)
+
+func TestMigrateCheckingID(t *testing.T) {
+	for id, expected := range map[string]string{
+		"d1a2":          "lndgrpc:d1a2",
+		"lndgrpc:d1a2":  "lndgrpc:d1a2",
+		"eclair:d1a2":   "eclair:d1a2",
+		"6f0e-uuid-ish": "lndgrpc:6f0e-uuid-ish",
+	} {
+		if got := rp.MigrateCheckingID(id, "lndgrpc"); got != expected {
+			t.Errorf("%s: got %s, wanted %s", id, got, expected)
+		}
+	}
+
+	if kind, id := rp.ParseCanonicalID("eclair:d1a2"); kind != "eclair" || id != "d1a2" {
+		t.Errorf("got %s and %s, wanted eclair and d1a2", kind, id)
+	}
+}
+
+func TestParseCanonicalID_Labels(t *testing.T) {
+	if kind, id := rp.ParseCanonicalID("order:123"); kind != "" || id != "order:123" {
+		t.Errorf("got %s and %s, wanted a legacy id", kind, id)
+	}
+	if kind, id := rp.ParseCanonicalID("sparko:order:123"); kind != "sparko" || id != "order:123" {
+		t.Errorf("got %s and %s, wanted sparko and order:123", kind, id)
+	}
+	if got := rp.MigrateCheckingID("order:123", "sparko"); got != "sparko:order:123" {
+		t.Errorf("got %s, wanted sparko:order:123", got)
+	}
+}
@@ -1,7 +1,7 @@
 package cliche
 
 import (
-	"crypto/rand"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"strings"
@@ -18,8 +18,8 @@ type Params struct {
 type ClicheWallet struct {
 	control *clichelib.Control
 
-	invoiceStatusListeners []chan rp.InvoiceStatus
-	paymentStatusListeners []chan rp.PaymentStatus
+	invoices rp.InvoiceBroadcaster
+	payments rp.PaymentBroadcaster
 }
 
 func Start(params Params) (*ClicheWallet, error) {
@@ -36,38 +36,32 @@ func Start(params Params) (*ClicheWallet, error) {
 
 	go func() {
 		for event := range e.control.PaymentSuccesses {
-			for _, listener := range e.paymentStatusListeners {
-				listener <- rp.PaymentStatus{
-					CheckingID: event.PaymentHash,
-					Status:     rp.Complete,
-					FeePaid:    event.FeeMsatoshi,
-					Preimage:   event.Preimage,
-				}
-			}
+			e.payments.Publish(rp.PaymentStatus{
+				CheckingID: event.PaymentHash,
+				Status:     rp.Complete,
+				FeePaid:    event.FeeMsatoshi,
+				Preimage:   event.Preimage,
+			})
 		}
 	}()
 
 	go func() {
 		for event := range e.control.PaymentFailures {
-			for _, listener := range e.paymentStatusListeners {
-				listener <- rp.PaymentStatus{
-					CheckingID: event.PaymentHash,
-					Status:     rp.Failed,
-				}
-			}
+			e.payments.Publish(rp.PaymentStatus{
+				CheckingID: event.PaymentHash,
+				Status:     rp.Failed,
+			})
 		}
 	}()
 
 	go func() {
 		for event := range e.control.IncomingPayments {
-			for _, listener := range e.invoiceStatusListeners {
-				listener <- rp.InvoiceStatus{
-					CheckingID:       event.PaymentHash,
-					Exists:           true,
-					Paid:             true,
-					MSatoshiReceived: event.Msatoshi,
-				}
-			}
+			e.invoices.Publish(rp.InvoiceStatus{
+				CheckingID:       event.PaymentHash,
+				Exists:           true,
+				Paid:             true,
+				MSatoshiReceived: event.Msatoshi,
+			})
 		}
 	}()
 
@@ -81,6 +75,13 @@ func (e *ClicheWallet) Kind() string {
 	return "eclair"
 }
 
+func (e *ClicheWallet) Capabilities() rp.Capabilities {
+	return rp.Capabilities{
+		MaxDescriptionLength: rp.MaxBolt11DescriptionLength,
+		RouteHints:           true, // hosted channels are always hinted
+	}
+}
+
 func (e *ClicheWallet) GetInfo() (rp.WalletInfo, error) {
 	info, err := e.control.GetInfo()
 	if err != nil {
@@ -95,20 +96,40 @@ func (e *ClicheWallet) GetInfo() (rp.WalletInfo, error) {
 	return rp.WalletInfo{Balance: balance}, nil
 }
 
+func (e *ClicheWallet) Health(ctx context.Context) (rp.HealthStatus, error) {
+	if _, err := e.control.GetInfo(); err != nil {
+		return rp.HealthStatus{}, fmt.Errorf("error calling 'get-info': %w", err)
+	}
+
+	// cliche syncs through electrum servers and doesn't tell us how it went
+	return rp.HealthStatus{
+		Connected:     true,
+		SyncedToChain: true,
+		SyncedToGraph: true,
+		StreamsAlive:  true,
+	}, nil
+}
+
 func (e *ClicheWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
-	preimageB := make([]byte, 32)
-	if _, err := rand.Read(preimageB); err != nil {
-		return rp.InvoiceData{},
-			fmt.Errorf("failed to generate random preimage: %w", err)
+	if err := rp.ValidateInvoiceParams(e.Capabilities(), params); err != nil {
+		return rp.InvoiceData{}, err
+	}
+
+	preimageB, err := rp.InvoicePreimage(params)
+	if err != nil {
+		return rp.InvoiceData{}, err
 	}
 	preimage := hex.EncodeToString(preimageB)
 
-	inv, err := e.control.CreateInvoice(clichelib.CreateInvoiceParams{
+	args := clichelib.CreateInvoiceParams{
 		Msatoshi:        params.Msatoshi,
-		Description:     params.Description,
 		DescriptionHash: hex.EncodeToString(params.DescriptionHash),
 		Preimage:        preimage,
-	})
+	}
+	if params.DescriptionHash == nil {
+		args.Description = params.Description
+	}
+	inv, err := e.control.CreateInvoice(args)
 	if err != nil {
 		return rp.InvoiceData{}, fmt.Errorf("'create-invoice' call failed: %w", err)
 	}
@@ -123,39 +144,60 @@ func (e *ClicheWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, er
 	info, err := e.control.CheckPayment(checkingID)
 	if err != nil {
 		if strings.Contains(err.Error(), "couldn't get payment") {
-			return rp.InvoiceStatus{
-				CheckingID: checkingID,
-				Exists:     false,
-			}, nil
+			return rp.InvoiceNotFound(checkingID)
 		}
 
-		return rp.InvoiceStatus{},
-			fmt.Errorf("error on 'check-payment' hash=%s: %w", checkingID, err)
+		return rp.InvoiceLookupFailed(checkingID,
+			fmt.Errorf("error on 'check-payment' hash=%s: %w", checkingID, err))
 	}
 
 	if !info.IsIncoming {
 		// this is actually a payment we sent
-		return rp.InvoiceStatus{
-			CheckingID: checkingID,
-			Exists:     false,
-		}, nil
+		return rp.InvoiceNotFound(checkingID)
 	}
 
-	return rp.InvoiceStatus{
-		CheckingID:       checkingID,
-		Exists:           true,
-		Paid:             info.Status == "complete",
-		MSatoshiReceived: info.Msatoshi,
-	}, nil
+	// the amount is the requested one until the invoice is paid
+	status := rp.InvoiceStatus{
+		CheckingID: checkingID,
+		Exists:     true,
+		Paid:       info.Status == "complete",
+	}
+	if status.Paid {
+		status.MSatoshiReceived = info.Msatoshi
+	} else {
+		status.Msatoshi = info.Msatoshi
+	}
+	return status, nil
+}
+
+// CancelInvoice isn't supported, cliche can't delete invoices.
+func (e *ClicheWallet) CancelInvoice(checkingID string) error {
+	return fmt.Errorf("%w: cliche can't cancel invoices", rp.ErrUnsupported)
 }
 
 func (e *ClicheWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
-	listener := make(chan rp.InvoiceStatus)
-	e.invoiceStatusListeners = append(e.invoiceStatusListeners, listener)
+	listener, _ := e.invoices.Subscribe()
 	return listener, nil
 }
 
 func (e *ClicheWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	if len(params.RestrictToPeers) > 0 || len(params.OutgoingChannelIDs) > 0 || params.LastHopPubkey != "" {
+		return rp.PaymentData{}, fmt.Errorf("%w: cliche can't restrict payments to peers or channels",
+			rp.ErrUnsupported)
+	}
+
+	inv, err := rp.DecodeBolt11(params.Invoice)
+	if err != nil {
+		return rp.PaymentData{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+	}
+	amount := inv.MSatoshi
+	if params.CustomAmount != 0 {
+		amount = params.CustomAmount
+	}
+	if err := rp.ValidatePayment(e.Capabilities(), params, amount); err != nil {
+		return rp.PaymentData{}, err
+	}
+
 	resp, err := e.control.PayInvoice(clichelib.PayInvoiceParams{
 		Invoice:  params.Invoice,
 		Msatoshi: params.CustomAmount,
@@ -213,7 +255,17 @@ func (e *ClicheWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, er
 }
 
 func (e *ClicheWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
-	listener := make(chan rp.PaymentStatus)
-	e.paymentStatusListeners = append(e.paymentStatusListeners, listener)
+	listener, _ := e.payments.Subscribe()
 	return listener, nil
 }
+
+// Compile time check to ensure that ClicheWallet implements rp.Subscriber
+var _ rp.Subscriber = (*ClicheWallet)(nil)
+
+func (e *ClicheWallet) SubscribePaidInvoices() (<-chan rp.InvoiceStatus, func()) {
+	return e.invoices.Subscribe()
+}
+
+func (e *ClicheWallet) SubscribePayments() (<-chan rp.PaymentStatus, func()) {
+	return e.payments.Subscribe()
+}
@@ -0,0 +1,230 @@
+// Command relampago talks to a backend directly, to check its configuration
+// works:
+//
+//	relampago info
+//	relampago invoice create [-expiry 1h] [-label order-42] <msatoshi> [description]
+//	relampago invoice status <checking id>
+//	relampago pay [-amount msatoshi] [-timeout 1m] <invoice>
+//	relampago payments watch
+//
+// The backend is given with -backend <uri> or -config <file>, see
+// config.FromURI and config.FromFile, or else taken from the environment as
+// config.FromEnv does.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/config"
+)
+
+const usage = `usage: relampago [-backend uri | -config file] <command>
+
+commands:
+  info
+  invoice create [-expiry 1h] [-label order-42] <msatoshi> [description]
+  invoice status <checking id>
+  pay [-amount msatoshi] [-timeout 1m] <invoice>
+  payments watch
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	backend := flag.String("backend", "", "backend uri")
+	configPath := flag.String("config", "", "file with the backend uri")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		wallet rp.Wallet
+		err    error
+	)
+	switch {
+	case *backend != "":
+		wallet, err = config.FromURI(*backend)
+	case *configPath != "":
+		wallet, err = config.FromFile(*configPath)
+	default:
+		wallet, err = config.FromEnv()
+	}
+	if err != nil {
+		fail(fmt.Errorf("failed to start backend: %w", err))
+	}
+
+	if err := run(wallet, args); err != nil {
+		fail(err)
+	}
+}
+
+func run(wallet rp.Wallet, args []string) error {
+	command := args[0]
+	if len(args) > 1 && (command == "invoice" || command == "payments") {
+		command += " " + args[1]
+		args = args[1:]
+	}
+
+	switch command {
+	case "info":
+		return info(wallet)
+	case "invoice create":
+		return createInvoice(wallet, args[1:])
+	case "invoice status":
+		if len(args) != 2 {
+			return errors.New("usage: relampago invoice status <checking id>")
+		}
+		status, err := wallet.GetInvoiceStatus(args[1])
+		if err != nil {
+			return err
+		}
+		return output(status)
+	case "pay":
+		return pay(wallet, args[1:])
+	case "payments watch":
+		payments, err := wallet.PaymentsStream()
+		if err != nil {
+			return err
+		}
+		for status := range payments {
+			if err := output(status); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	flag.Usage()
+	os.Exit(2)
+	return nil
+}
+
+func info(wallet rp.Wallet) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	out := map[string]interface{}{
+		"kind":         wallet.Kind(),
+		"capabilities": wallet.Capabilities(),
+	}
+
+	health, err := wallet.Health(ctx)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	out["health"] = health
+
+	walletInfo, err := wallet.GetInfo()
+	if err != nil {
+		return err
+	}
+	out["balance"] = walletInfo.Balance
+
+	if provider, ok := wallet.(rp.NodeInfoProvider); ok {
+		if node, err := provider.GetNodeInfo(); err == nil {
+			out["node"] = node
+		}
+	}
+
+	return output(out)
+}
+
+func createInvoice(wallet rp.Wallet, args []string) error {
+	flags := flag.NewFlagSet("invoice create", flag.ExitOnError)
+	expiry := flags.Duration("expiry", 0, "invoice expiry")
+	label := flags.String("label", "", "label returned with the invoice status")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		return errors.New("usage: relampago invoice create [-expiry 1h] [-label order-42] <msatoshi> [description]")
+	}
+	msatoshi, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount '%s': %w", flags.Arg(0), err)
+	}
+
+	params := rp.InvoiceParams{
+		Msatoshi:    msatoshi,
+		Description: strings.Join(flags.Args()[1:], " "),
+		Label:       *label,
+	}
+	if *expiry != 0 {
+		params.Expiry = expiry
+	}
+
+	data, err := wallet.CreateInvoice(params)
+	if err != nil {
+		return err
+	}
+	return output(data)
+}
+
+func pay(wallet rp.Wallet, args []string) error {
+	flags := flag.NewFlagSet("pay", flag.ExitOnError)
+	amount := flags.Int64("amount", 0, "msatoshi to pay, for invoices without an amount")
+	timeout := flags.Duration("timeout", time.Minute, "how long to wait for the payment")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: relampago pay [-amount msatoshi] [-timeout 1m] <invoice>")
+	}
+
+	payment, err := wallet.MakePayment(rp.PaymentParams{
+		Invoice:      flags.Arg(0),
+		CustomAmount: *amount,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	updates, err := rp.TrackPayment(ctx, wallet, payment.CheckingID)
+	if err != nil {
+		return err
+	}
+
+	var last rp.PaymentStatus
+	received := false
+	for last = range updates {
+		received = true
+	}
+	if !received {
+		return fmt.Errorf("no status for payment %s", payment.CheckingID)
+	}
+	if err := output(last); err != nil {
+		return err
+	}
+	switch last.Status {
+	case rp.Complete:
+		return nil
+	case rp.Failed:
+		return errors.New("payment failed")
+	default:
+		// the timeout ended tracking before the payment was resolved
+		return fmt.Errorf("payment still %s", last.Status)
+	}
+}
+
+func output(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,395 @@
+package commando
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/sparko"
+	"github.com/tidwall/gjson"
+	"golang.org/x/net/websocket"
+)
+
+type Params struct {
+	// Host is the host:port of the node's lightning port or a ws:// url of its
+	// websocket port (the bind-addr=ws: option).
+	Host string
+
+	NodeID  string
+	Rune    string
+	Timeout time.Duration // optional, defaults to 15s
+
+	InvoiceLabelPrefix string // optional, defaults to 'relampago'
+}
+
+// CommandoWallet talks to Core Lightning through the commando plugin, which
+// runs commands sent as lightning messages by peers with a rune, so remote
+// nodes can be used without access to their RPC socket.
+type CommandoWallet struct {
+	Params
+	*sparko.Lightningd
+
+	nodeID *btcec.PublicKey
+
+	mu      sync.Mutex
+	conn    *noiseConn
+	lastID  uint64
+	pending map[uint64]chan reply
+
+	invoices rp.InvoiceBroadcaster
+	payments rp.PaymentBroadcaster
+}
+
+const (
+	msgInit            = 16
+	msgPing            = 18
+	msgPong            = 19
+	msgCommand         = 0x4c4f
+	msgReplyContinues  = 0x594b
+	msgReplyTerminates = 0x594d
+)
+
+// errRuneRejected is the code commando answers with when the rune doesn't
+// allow the command.
+const errRuneRejected = 0x4c51
+
+var retryDelay = 5 * time.Second
+
+type reply struct {
+	data []byte
+	err  error
+}
+
+func Start(params Params) (*CommandoWallet, error) {
+	if params.Timeout == 0 {
+		params.Timeout = 15 * time.Second
+	}
+
+	nodeID, err := hex.DecodeString(params.NodeID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node id '%s': %w", params.NodeID, err)
+	}
+	pub, err := btcec.ParsePubKey(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node id '%s': %w", params.NodeID, err)
+	}
+
+	c := &CommandoWallet{
+		Params:  params,
+		nodeID:  pub,
+		pending: make(map[uint64]chan reply),
+	}
+	c.Lightningd = &sparko.Lightningd{Caller: c, LabelPrefix: params.InvoiceLabelPrefix}
+
+	// fail early on a wrong host, node id or rune
+	if _, err := c.call(params.Timeout, "getinfo", nil); err != nil {
+		return nil, fmt.Errorf("error calling getinfo: %w", err)
+	}
+
+	go c.waitInvoices()
+
+	return c, nil
+}
+
+// Error is an error returned by a command. Those for commands the rune doesn't
+// allow match rp.ErrInsufficientPermissions with errors.Is.
+type Error struct {
+	Method  string
+	Code    int64
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s failed with %d: %s", e.Method, e.Code, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	return target == rp.ErrInsufficientPermissions && e.Code == errRuneRejected
+}
+
+// Compile time check to ensure that CommandoWallet fully implements rp.Wallet
+var _ rp.Wallet = (*CommandoWallet)(nil)
+
+func (c *CommandoWallet) Kind() string {
+	return "commando"
+}
+
+// Call runs a command on the node, waiting for it until the deadline of ctx,
+// or for Timeout when it has none.
+func (c *CommandoWallet) Call(ctx context.Context, method string, params map[string]interface{}) (gjson.Result, error) {
+	timeout := c.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	return c.call(timeout, method, params)
+}
+
+func (c *CommandoWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	listener, _ := c.invoices.Subscribe()
+	return listener, nil
+}
+
+func (c *CommandoWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	args, checkingID, err := sparko.PayArgs(params)
+	if err != nil {
+		return rp.PaymentData{}, err
+	}
+	go func() {
+		// pay only returns when the payment is resolved
+		if _, err := c.call(0, "pay", args); err != nil {
+			var cmdErr *Error
+			if !errors.As(err, &cmdErr) {
+				// we lost the connection, the payment may still be going
+				return
+			}
+		}
+
+		status, err := c.GetPaymentStatus(checkingID)
+		if err != nil {
+			return
+		}
+		c.payments.Publish(status)
+	}()
+
+	return rp.PaymentData{
+		CheckingID: checkingID,
+	}, nil
+}
+
+func (c *CommandoWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	listener, _ := c.payments.Subscribe()
+	return listener, nil
+}
+
+// Compile time check to ensure that CommandoWallet implements rp.Subscriber
+var _ rp.Subscriber = (*CommandoWallet)(nil)
+
+func (c *CommandoWallet) SubscribePaidInvoices() (<-chan rp.InvoiceStatus, func()) {
+	return c.invoices.Subscribe()
+}
+
+func (c *CommandoWallet) SubscribePayments() (<-chan rp.PaymentStatus, func()) {
+	return c.payments.Subscribe()
+}
+
+// waitInvoices publishes paid invoices as waitanyinvoice returns them, starting
+// from the last one paid before we connected.
+func (c *CommandoWallet) waitInvoices() {
+	index := int64(-1)
+	for {
+		if index < 0 {
+			res, err := c.call(c.Timeout, "listinvoices", nil)
+			if err != nil {
+				time.Sleep(retryDelay)
+				continue
+			}
+			index = 0
+			for _, invoice := range res.Get("invoices").Array() {
+				if payIndex := invoice.Get("pay_index").Int(); payIndex > index {
+					index = payIndex
+				}
+			}
+		}
+
+		res, err := c.call(0, "waitanyinvoice", map[string]interface{}{"lastpay_index": index})
+		if err != nil {
+			time.Sleep(retryDelay)
+			continue
+		}
+		index = res.Get("pay_index").Int()
+		if res.Get("status").String() == "paid" {
+			c.invoices.Publish(sparko.InvoiceToStatus(res.Get("label").String(), res))
+		}
+	}
+}
+
+// call runs a command on the node, connecting first if needed. A zero timeout
+// waits until the connection is lost.
+func (c *CommandoWallet) call(timeout time.Duration, method string, params map[string]interface{}) (gjson.Result, error) {
+	conn, err := c.connection()
+	if err != nil {
+		return gjson.Result{}, fmt.Errorf("error connecting to %s: %w", c.Host, err)
+	}
+
+	done := make(chan reply, 1)
+	c.mu.Lock()
+	c.lastID++
+	id := c.lastID
+	c.pending[id] = done
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"method": method,
+		"params": params,
+		"rune":   c.Rune,
+		"id":     "relampago:" + method + "#" + strconv.FormatUint(id, 10),
+	})
+	if err != nil {
+		return gjson.Result{}, err
+	}
+
+	msg := make([]byte, 10, 10+len(body))
+	binary.BigEndian.PutUint16(msg, msgCommand)
+	binary.BigEndian.PutUint64(msg[2:], id)
+	if err := conn.WriteMessage(append(msg, body...)); err != nil {
+		c.disconnect(conn, err)
+		return gjson.Result{}, fmt.Errorf("error sending %s: %w", method, err)
+	}
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return gjson.Result{}, r.err
+		}
+		res := gjson.ParseBytes(r.data)
+		if e := res.Get("error"); e.Exists() {
+			return gjson.Result{}, &Error{
+				Method:  method,
+				Code:    e.Get("code").Int(),
+				Message: e.Get("message").String(),
+			}
+		}
+		return res.Get("result"), nil
+	case <-timer:
+		return gjson.Result{}, fmt.Errorf("%s timed out after %s", method, timeout)
+	}
+}
+
+// connection returns the current connection or makes a new one.
+func (c *CommandoWallet) connection() (*noiseConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	var (
+		nc  net.Conn
+		err error
+	)
+	if strings.HasPrefix(c.Host, "ws://") || strings.HasPrefix(c.Host, "wss://") {
+		var ws *websocket.Conn
+		ws, err = websocket.Dial(c.Host, "", "http://localhost/")
+		if err == nil {
+			ws.PayloadType = websocket.BinaryFrame
+			nc = ws
+		}
+	} else {
+		nc, err = net.DialTimeout("tcp", c.Host, c.Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nc.SetDeadline(time.Now().Add(c.Timeout))
+	conn, err := handshake(nc, c.nodeID)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	// an init without features, we only need the node to talk to us
+	if err := conn.WriteMessage([]byte{0, msgInit, 0, 0, 0, 0}); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+
+	c.conn = conn
+	go c.read(conn)
+	return conn, nil
+}
+
+// read delivers replies until the connection fails.
+func (c *CommandoWallet) read(conn *noiseConn) {
+	replies := make(map[uint64][]byte)
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			c.disconnect(conn, err)
+			return
+		}
+		if len(msg) < 2 {
+			continue
+		}
+
+		switch kind := binary.BigEndian.Uint16(msg); kind {
+		case msgPing:
+			if len(msg) < 4 {
+				continue
+			}
+			size := binary.BigEndian.Uint16(msg[2:])
+			if size >= 65532 {
+				continue // no pong expected
+			}
+			pong := make([]byte, 4+int(size))
+			binary.BigEndian.PutUint16(pong, msgPong)
+			binary.BigEndian.PutUint16(pong[2:], size)
+			conn.WriteMessage(pong)
+		case msgReplyContinues, msgReplyTerminates:
+			if len(msg) < 10 {
+				continue
+			}
+			id := binary.BigEndian.Uint64(msg[2:])
+			replies[id] = append(replies[id], msg[10:]...)
+			if kind == msgReplyContinues {
+				continue
+			}
+
+			c.mu.Lock()
+			done, ok := c.pending[id]
+			c.mu.Unlock()
+			if ok {
+				done <- reply{data: replies[id]}
+			}
+			delete(replies, id)
+		}
+	}
+}
+
+// disconnect drops a failed connection, failing the calls waiting on it.
+func (c *CommandoWallet) disconnect(conn *noiseConn, err error) {
+	if closer, ok := conn.rw.(io.Closer); ok {
+		closer.Close()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != conn {
+		return
+	}
+	c.conn = nil
+	for id, done := range c.pending {
+		select {
+		case done <- reply{err: fmt.Errorf("connection lost: %w", err)}:
+		default:
+		}
+		delete(c.pending, id)
+	}
+}
@@ -0,0 +1,45 @@
+module github.com/lnbits/relampago/commando
+
+go 1.18
+
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.2.1
+	github.com/lnbits/relampago v0.1.0
+	github.com/lnbits/relampago/sparko v0.1.0
+	github.com/tidwall/gjson v1.8.1
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+	golang.org/x/net v0.0.0-20210913180222-943fd674d43e
+)
+
+require (
+	github.com/aead/siphash v1.0.1 // indirect
+	github.com/btcsuite/btcd v0.20.1-beta.0.20200515232429-9f0179fd2c46 // indirect
+	github.com/btcsuite/btclog v0.0.0-20170628155309-84c8d2346e9f // indirect
+	github.com/btcsuite/btcutil v1.0.2 // indirect
+	github.com/btcsuite/btcwallet v0.11.1-0.20200515224913-e0e62245ecbe // indirect
+	github.com/btcsuite/btcwallet/wallet/txauthor v1.0.0 // indirect
+	github.com/btcsuite/btcwallet/wallet/txrules v1.0.0 // indirect
+	github.com/btcsuite/btcwallet/wallet/txsizes v1.0.0 // indirect
+	github.com/btcsuite/btcwallet/walletdb v1.3.1 // indirect
+	github.com/btcsuite/btcwallet/wtxmgr v1.1.1-0.20200515224913-e0e62245ecbe // indirect
+	github.com/btcsuite/go-socks v0.0.0-20170105172521-4720035b7bfd // indirect
+	github.com/btcsuite/websocket v0.0.0-20150119174127-31079b680792 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	github.com/fiatjaf/lightningd-gjson-rpc v1.4.1 // indirect
+	github.com/fiatjaf/ln-decodepay v1.1.0 // indirect
+	github.com/go-errors/errors v1.0.1 // indirect
+	github.com/kkdai/bstream v0.0.0-20181106074824-b3251f7901ec // indirect
+	github.com/lightninglabs/gozmq v0.0.0-20191113021534-d20a764486bf // indirect
+	github.com/lightninglabs/neutrino v0.11.1-0.20200316235139-bffc52e8f200 // indirect
+	github.com/lightningnetwork/lnd v0.10.1-beta // indirect
+	github.com/lightningnetwork/lnd/queue v1.0.3 // indirect
+	github.com/lightningnetwork/lnd/ticker v1.0.0 // indirect
+	github.com/miekg/dns v0.0.0-20171125082028-79bfde677fa8 // indirect
+	github.com/r3labs/sse/v2 v2.3.6 // indirect
+	github.com/tidwall/match v1.0.3 // indirect
+	github.com/tidwall/pretty v1.1.0 // indirect
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1 // indirect
+	gopkg.in/cenkalti/backoff.v1 v1.1.0 // indirect
+)
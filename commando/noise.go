@@ -0,0 +1,213 @@
+package commando
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// noiseConn is a BOLT8 encrypted connection to a lightning node, the transport
+// commando messages go through.
+type noiseConn struct {
+	rw io.ReadWriter
+
+	writeMu sync.Mutex
+	sk, sck []byte
+	sn      uint64
+
+	rk, rck []byte
+	rn      uint64
+}
+
+const (
+	protocolName = "Noise_XK_secp256k1_ChaChaPoly_SHA256"
+	prologue     = "lightning"
+	maxMessage   = 65535
+)
+
+// handshake runs the three acts of BOLT8 as the initiator, with a new random
+// static key as nodes don't care who connects to them.
+func handshake(rw io.ReadWriter, remote *btcec.PublicKey) (*noiseConn, error) {
+	static, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	defer ephemeral.Zero()
+	return initiate(rw, remote, static, ephemeral)
+}
+
+func initiate(rw io.ReadWriter, remote *btcec.PublicKey, static, ephemeral *btcec.PrivateKey) (*noiseConn, error) {
+	h := sha256.Sum256([]byte(protocolName))
+	ck := h[:]
+	hs := h[:]
+	hs = mixHash(hs, []byte(prologue))
+	hs = mixHash(hs, remote.SerializeCompressed())
+
+	// act one
+	ePub := ephemeral.PubKey().SerializeCompressed()
+	hs = mixHash(hs, ePub)
+	ck, temp := hkdf2(ck, ecdh(ephemeral, remote))
+	c, err := encryptWithAD(temp, 0, hs, nil)
+	if err != nil {
+		return nil, err
+	}
+	hs = mixHash(hs, c)
+	if _, err := rw.Write(append(append([]byte{0}, ePub...), c...)); err != nil {
+		return nil, fmt.Errorf("act one: %w", err)
+	}
+
+	// act two
+	act2 := make([]byte, 50)
+	if _, err := io.ReadFull(rw, act2); err != nil {
+		return nil, fmt.Errorf("act two: %w", err)
+	}
+	if act2[0] != 0 {
+		return nil, errors.New("act two: unknown handshake version")
+	}
+	re, err := btcec.ParsePubKey(act2[1:34])
+	if err != nil {
+		return nil, fmt.Errorf("act two: %w", err)
+	}
+	hs = mixHash(hs, act2[1:34])
+	ck, temp = hkdf2(ck, ecdh(ephemeral, re))
+	if _, err := decryptWithAD(temp, 0, hs, act2[34:]); err != nil {
+		return nil, fmt.Errorf("act two: %w", err)
+	}
+	hs = mixHash(hs, act2[34:])
+
+	// act three
+	c, err = encryptWithAD(temp, 1, hs, static.PubKey().SerializeCompressed())
+	if err != nil {
+		return nil, err
+	}
+	hs = mixHash(hs, c)
+	ck, temp = hkdf2(ck, ecdh(static, re))
+	t, err := encryptWithAD(temp, 0, hs, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rw.Write(append(append([]byte{0}, c...), t...)); err != nil {
+		return nil, fmt.Errorf("act three: %w", err)
+	}
+
+	sk, rk := hkdf2(ck, nil)
+	return &noiseConn{rw: rw, sk: sk, sck: ck, rk: rk, rck: ck}, nil
+}
+
+func (c *noiseConn) WriteMessage(msg []byte) error {
+	if len(msg) > maxMessage {
+		return fmt.Errorf("message of %d bytes is too big", len(msg))
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(msg)))
+	lc, err := c.encrypt(length)
+	if err != nil {
+		return err
+	}
+	body, err := c.encrypt(msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.rw.Write(append(lc, body...))
+	return err
+}
+
+// ReadMessage must only be called from one goroutine.
+func (c *noiseConn) ReadMessage() ([]byte, error) {
+	lc := make([]byte, 18)
+	if _, err := io.ReadFull(c.rw, lc); err != nil {
+		return nil, err
+	}
+	length, err := c.decrypt(lc)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, int(binary.BigEndian.Uint16(length))+16)
+	if _, err := io.ReadFull(c.rw, body); err != nil {
+		return nil, err
+	}
+	return c.decrypt(body)
+}
+
+func (c *noiseConn) encrypt(plaintext []byte) ([]byte, error) {
+	ciphertext, err := encryptWithAD(c.sk, c.sn, nil, plaintext)
+	c.sn++
+	if c.sn == 1000 {
+		c.sck, c.sk = hkdf2(c.sck, c.sk)
+		c.sn = 0
+	}
+	return ciphertext, err
+}
+
+func (c *noiseConn) decrypt(ciphertext []byte) ([]byte, error) {
+	plaintext, err := decryptWithAD(c.rk, c.rn, nil, ciphertext)
+	c.rn++
+	if c.rn == 1000 {
+		c.rck, c.rk = hkdf2(c.rck, c.rk)
+		c.rn = 0
+	}
+	return plaintext, err
+}
+
+// ecdh is the BOLT8 shared secret, the hash of the compressed shared point.
+func ecdh(priv *btcec.PrivateKey, pub *btcec.PublicKey) []byte {
+	var point, shared btcec.JacobianPoint
+	pub.AsJacobian(&point)
+	btcec.ScalarMultNonConst(&priv.Key, &point, &shared)
+	shared.ToAffine()
+	hash := sha256.Sum256(btcec.NewPublicKey(&shared.X, &shared.Y).SerializeCompressed())
+	return hash[:]
+}
+
+func mixHash(h []byte, data []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, h...), data...))
+	return sum[:]
+}
+
+func hkdf2(salt []byte, ikm []byte) ([]byte, []byte) {
+	out := make([]byte, 64)
+	io.ReadFull(hkdf.New(sha256.New, ikm, salt, nil), out)
+	return out[:32], out[32:]
+}
+
+func nonce(n uint64) []byte {
+	b := make([]byte, 12)
+	binary.LittleEndian.PutUint64(b[4:], n)
+	return b
+}
+
+func encryptWithAD(k []byte, n uint64, ad []byte, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(k)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce(n), plaintext, ad), nil
+}
+
+func decryptWithAD(k []byte, n uint64, ad []byte, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(k)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce(n), ciphertext, ad)
+	if err != nil {
+		return nil, errors.New("failed to decrypt, the node id may be wrong")
+	}
+	return plaintext, nil
+}
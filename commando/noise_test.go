@@ -0,0 +1,72 @@
+package commando
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// the initiator test vectors from BOLT8
+func TestHandshake(t *testing.T) {
+	remote, _ := btcec.ParsePubKey(
+		decode("028d7500dd4c12685d1f568b4c2b5048e8534b873319f3a8daa612b469132ec7f7"))
+	static := testKey(0x11)
+	ephemeral := testKey(0x12)
+
+	sent := new(bytes.Buffer)
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{
+		bytes.NewReader(decode("0002466d7fcae563e5cb09a0d1870bb580344804617879a14949cf22285f1bae3f276e2470b93aac583c9ef6eafca3f730ae")),
+		sent,
+	}
+
+	conn, err := initiate(rw, remote, static, ephemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "00036360e856310ce5d294e8be33fc807077dc56ac80d95d9cd4ddbd21325eff73f70df6086551151f58b8afe6c195782c6a" +
+		"00b9e3a702e93e3a9948c2ed6e5fd7590a6e1c3a0344cfc9d5b57357049aa22355361aa02e55a8fc28fef5bd6d71ad0c38228dc68b1c466263b47fdf31e560e139ba"
+	if got := hex.EncodeToString(sent.Bytes()); got != expected {
+		t.Fatalf("got acts %s, wanted %s", got, expected)
+	}
+	if hex.EncodeToString(conn.sk) != "969ab31b4d288cedf6218839b27a3e2140827047f2c0f01bf5c04435d43511a9" ||
+		hex.EncodeToString(conn.rk) != "bb9020b8965f4df047e07f955f3c4b88418984aadc5cdb35096b9ea8fa5c3442" {
+		t.Fatalf("got keys %x and %x", conn.sk, conn.rk)
+	}
+
+	// messages, with the keys rotated every 1000 nonces
+	outputs := map[int]string{
+		0:    "cf2b30ddf0cf3f80e7c35a6e6730b59fe802473180f396d88a8fb0db8cbcf25d2f214cf9ea1d95",
+		1:    "72887022101f0b6753e0c7de21657d35a4cb2a1f5cde2650528bbc8f837d0f0d7ad833b1a256a1",
+		500:  "178cb9d7387190fa34db9c2d50027d21793c9bc2d40b1e14dcf30ebeeeb220f48364f7a4c68bf8",
+		501:  "1b186c57d44eb6de4c057c49940d79bb838a145cb528d6e8fd26dbe50a60ca2c104b56b60e45bd",
+		1000: "4a2f3cc3b5e78ddb83dcb426d9863d9d9a723b0337c89dd0b005d89f8d3c05c52b76b29b740f09",
+		1001: "2ecd8c8a5629d0d02ab457a0fdd0f7b90a192cd46be5ecb6ca570bfc5e268338b1a16cf4ef2d36",
+	}
+	conn.rw = sent
+	for i := 0; i <= 1001; i++ {
+		sent.Reset()
+		if err := conn.WriteMessage([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if expected, ok := outputs[i]; ok && hex.EncodeToString(sent.Bytes()) != expected {
+			t.Errorf("message %d: got %x, wanted %s", i, sent.Bytes(), expected)
+		}
+	}
+}
+
+func testKey(b byte) *btcec.PrivateKey {
+	key, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{b}, 32))
+	return key
+}
+
+func decode(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/cliche"
+	"github.com/lnbits/relampago/commando"
+	relampago_connect "github.com/lnbits/relampago/connect"
+	"github.com/lnbits/relampago/eclair"
+	"github.com/lnbits/relampago/lnd"
+	"github.com/lnbits/relampago/nwc"
+	"github.com/lnbits/relampago/readonly"
+	"github.com/lnbits/relampago/sparko"
+	"github.com/lnbits/relampago/void"
+)
+
+// FromURI starts the backend described by uri, which is one of
+//
+//	lnd://host:10009?cert=/path/tls.cert&macaroon=/path/admin.macaroon&timeout=15s
+//	lnd://host:10009?cert=/path/tls.cert&macaroonhex=0201036c6e64...
+//	lnd://mynode.m.voltageapp.io:10009?systemcerts=true&macaroonhex=0201036c6e64...
+//	lnd://host:10009?certhex=2d2d2d2d2d424547...&macaroonhex=0201036c6e64...
+//	lnd://host:10009?cert=/path/tls.cert&invoicemacaroon=/path/invoice.macaroon&readonlymacaroon=/path/readonly.macaroon
+//	sparko://key@host:9737 (or sparko+https://key@host)
+//	commando://rune@host:9735?nodeid=02abc... (or commando+ws://rune@host:9736)
+//	eclair://:password@host:8080
+//	cliche:///path/to/cliche.jar?datadir=/path/to/datadir
+//	nostr+walletconnect://<wallet pubkey>?relay=wss://relay.example.com&secret=<hex>
+//	void://
+//
+// lnd, sparko and eclair can also take proxy=127.0.0.1:9050&isolate=true to
+// connect through a socks5 proxy like tor. lnd also takes keepalive=30s,
+// maxmsgsize=209715200, block=false, network=mainnet, requiresynced=true and
+// waitforsync=10m, see the lnd options.
+//
+// Any backend takes readonly=true to refuse payments, see readonly.
+func FromURI(uri string) (rp.Wallet, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend uri: %w", err)
+	}
+	wallet, err := fromURI(u, uri)
+	if err != nil || u.Query().Get("readonly") != "true" {
+		return wallet, err
+	}
+	return readonly.Start(readonly.Params{Wallet: wallet})
+}
+
+func fromURI(u *url.URL, uri string) (rp.Wallet, error) {
+	var err error
+	q := u.Query()
+
+	timeout := 15 * time.Second
+	if t := q.Get("timeout"); t != "" {
+		timeout, err = time.ParseDuration(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout '%s': %w", t, err)
+		}
+	}
+
+	proxy := q.Get("proxy")
+	isolate := q.Get("isolate") == "true"
+
+	switch u.Scheme {
+	case "lnd", "lndgrpc":
+		opts := []lnd.Option{lnd.WithTimeout(timeout)}
+		if proxy != "" {
+			opts = append(opts, lnd.WithProxy(proxy, isolate))
+		}
+		if cert := q.Get("cert"); cert != "" {
+			opts = append(opts, lnd.WithCertPath(cert))
+		}
+		if certHex := q.Get("certhex"); certHex != "" {
+			cert, err := hex.DecodeString(certHex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certhex: %w", err)
+			}
+			opts = append(opts, lnd.WithCertBytes(cert))
+		}
+		if q.Get("insecure") == "true" {
+			opts = append(opts, lnd.WithInsecure())
+		}
+		if q.Get("systemcerts") == "true" {
+			opts = append(opts, lnd.WithSystemCerts())
+		}
+		if k := q.Get("keepalive"); k != "" {
+			interval, err := time.ParseDuration(k)
+			if err != nil {
+				return nil, fmt.Errorf("invalid keepalive '%s': %w", k, err)
+			}
+			opts = append(opts, lnd.WithKeepalive(interval, lnd.DefaultKeepalive.Timeout))
+		}
+		if size := q.Get("maxmsgsize"); size != "" {
+			bytes, err := strconv.Atoi(size)
+			if err != nil {
+				return nil, fmt.Errorf("invalid maxmsgsize '%s': %w", size, err)
+			}
+			opts = append(opts, lnd.WithMaxMessageSize(bytes))
+		}
+		if q.Get("block") == "false" {
+			opts = append(opts, lnd.WithNonBlocking())
+		}
+		if network := q.Get("network"); network != "" {
+			opts = append(opts, lnd.WithNetwork(network))
+		}
+		if q.Get("requiresynced") == "true" {
+			opts = append(opts, lnd.WithRequireSynced())
+		}
+		if w := q.Get("waitforsync"); w != "" {
+			syncTimeout, err := time.ParseDuration(w)
+			if err != nil {
+				return nil, fmt.Errorf("invalid waitforsync '%s': %w", w, err)
+			}
+			opts = append(opts, lnd.WithWaitForSync(syncTimeout))
+		}
+		if q.Get("readonly") == "true" {
+			opts = append(opts, lnd.WithRequiredMethods(lnd.ReadOnlyMethods...))
+		}
+		if path := q.Get("invoicemacaroon"); path != "" {
+			opts = append(opts, lnd.WithInvoiceMacaroonPath(path))
+		}
+		if path := q.Get("readonlymacaroon"); path != "" {
+			opts = append(opts, lnd.WithReadonlyMacaroonPath(path))
+		}
+		if macHex := q.Get("macaroonhex"); macHex != "" {
+			opts = append(opts, lnd.WithMacaroonHex(macHex))
+		} else if path := q.Get("macaroon"); path != "" {
+			opts = append(opts, lnd.WithMacaroonPath(path))
+		}
+		return lnd.Connect(u.Host, opts...)
+	case "sparko", "sparko+http", "sparko+https":
+		scheme := "http"
+		if u.Scheme == "sparko+https" {
+			scheme = "https"
+		}
+		return sparko.Start(sparko.Params{
+			Host:               scheme + "://" + u.Host,
+			Key:                u.User.Username(),
+			ConnectTimeout:     timeout,
+			InvoiceLabelPrefix: q.Get("labelprefix"),
+			Proxy:              proxy,
+			IsolateProxy:       isolate,
+		})
+	case "commando", "commando+ws", "commando+wss":
+		host := u.Host
+		if u.Scheme != "commando" {
+			host = strings.TrimPrefix(u.Scheme, "commando+") + "://" + u.Host + u.Path
+		}
+		return commando.Start(commando.Params{
+			Host:               host,
+			NodeID:             q.Get("nodeid"),
+			Rune:               u.User.Username(),
+			Timeout:            timeout,
+			InvoiceLabelPrefix: q.Get("labelprefix"),
+		})
+	case "eclair", "eclair+http", "eclair+https":
+		scheme := "http"
+		if u.Scheme == "eclair+https" {
+			scheme = "https"
+		}
+		password, _ := u.User.Password()
+		return eclair.Start(eclair.Params{
+			Host:         scheme + "://" + u.Host,
+			Password:     password,
+			Proxy:        proxy,
+			IsolateProxy: isolate,
+		})
+	case "cliche":
+		return cliche.Start(cliche.Params{
+			JARPath: u.Path,
+			DataDir: q.Get("datadir"),
+		})
+	case "nostr+walletconnect", "nostrwalletconnect":
+		return nwc.Connect(nwc.WalletParams{URI: uri, Timeout: timeout})
+	case "void":
+		return void.Start()
+	}
+
+	return nil, fmt.Errorf("unsupported backend '%s'", u.Scheme)
+}
+
+// FromFile reads a backend uri from a file, like a mounted secret. Empty lines
+// and lines starting with # are skipped.
+func FromFile(path string) (rp.Wallet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return FromURI(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("no backend uri found in %s", path)
+}
+
+// FromEnv uses LIGHTNING_BACKEND_URI or a file pointed to by
+// LIGHTNING_BACKEND_URI_FILE, falling back to the variables read by
+// relampago_connect.Connect.
+func FromEnv() (rp.Wallet, error) {
+	if uri := os.Getenv("LIGHTNING_BACKEND_URI"); uri != "" {
+		return FromURI(uri)
+	}
+	if path := os.Getenv("LIGHTNING_BACKEND_URI_FILE"); path != "" {
+		return FromFile(path)
+	}
+	return relampago_connect.Connect()
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/readonly"
+)
+
+func TestFromURI(t *testing.T) {
+	wallet, err := FromURI("void://")
+	if err != nil || wallet.Kind() != "void" {
+		t.Fatalf("got %v, %v, wanted a void wallet", wallet, err)
+	}
+
+	wallet, err = FromURI("void://?readonly=true")
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if _, ok := wallet.(*readonly.ReadOnlyWallet); !ok {
+		t.Errorf("got %T, wanted a read-only wallet", wallet)
+	}
+	if _, err := wallet.MakePayment(rp.PaymentParams{Invoice: "lnbc1"}); !errors.Is(err, rp.ErrReadOnly) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrReadOnly)
+	}
+}
+
+func TestFromURI_Invalid(t *testing.T) {
+	for _, uri := range []string{
+		"bitcoin://host",
+		"void://?timeout=soon",
+		"lnd://host:10009?certhex=zz&macaroonhex=0201",
+		"lnd://host:10009?cert=/tls.cert&keepalive=1s&macaroonhex=0201",
+		"://",
+	} {
+		if _, err := FromURI(uri); err == nil {
+			t.Errorf("%s: got %v, wanted an error", uri, err)
+		}
+	}
+}
+
+func TestFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backend")
+	ioutil.WriteFile(path, []byte("# the node\n\nvoid://\n"), 0600)
+	if wallet, err := FromFile(path); err != nil || wallet.Kind() != "void" {
+		t.Errorf("got %v, %v, wanted a void wallet", wallet, err)
+	}
+
+	ioutil.WriteFile(path, []byte("# nothing here\n"), 0600)
+	if _, err := FromFile(path); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	os.Setenv("LIGHTNING_BACKEND_URI", "void://")
+	defer os.Unsetenv("LIGHTNING_BACKEND_URI")
+	if wallet, err := FromEnv(); err != nil || wallet.Kind() != "void" {
+		t.Errorf("got %v, %v, wanted a void wallet", wallet, err)
+	}
+}
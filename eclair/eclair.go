@@ -1,26 +1,38 @@
 package eclair
 
 import (
-	"crypto/rand"
+	"context"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/fiatjaf/eclair-go"
+	decodepay "github.com/fiatjaf/ln-decodepay"
 	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/proxy"
+	"github.com/tidwall/gjson"
 )
 
 type Params struct {
 	Host     string
 	Password string
+
+	// optional, a socks5 proxy like tor's at 127.0.0.1:9050, only for http hosts
+	Proxy        string
+	IsolateProxy bool
 }
 
 type EclairWallet struct {
 	Params
 
-	client                 *eclair.Client
-	invoiceStatusListeners []chan rp.InvoiceStatus
-	paymentStatusListeners []chan rp.PaymentStatus
+	client         *eclair.Client
+	forwarder      io.Closer // to the proxy, if any
+	websocketAlive int32     // accessed atomically
+	invoices       rp.InvoiceBroadcaster
+	payments       rp.PaymentBroadcaster
 }
 
 func Start(params Params) (*EclairWallet, error) {
@@ -28,48 +40,66 @@ func Start(params Params) (*EclairWallet, error) {
 		params.Host = "http://" + params.Host
 	}
 
+	host := params.Host
+	var forwarder io.Closer
+	if params.Proxy != "" {
+		dialer, err := proxy.SOCKS5(params.Proxy, params.IsolateProxy)
+		if err != nil {
+			return nil, err
+		}
+		host, forwarder, err = proxy.ForwardURL(dialer, params.Host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	e := &EclairWallet{
 		Params: params,
 		client: &eclair.Client{
-			Host:     params.Host,
+			Host:     host,
 			Password: params.Password,
 		},
+		forwarder: forwarder,
 	}
 
 	if ws, err := e.client.Websocket(); err != nil {
 		panic(err)
 	} else {
+		atomic.StoreInt32(&e.websocketAlive, 1)
 		go func() {
+			defer atomic.StoreInt32(&e.websocketAlive, 0)
 			for event := range ws {
 				switch event.Get("type").String() {
 				case "payment-received":
 					var msats int64
+					var settledAt time.Time
 					for _, part := range event.Get("parts").Array() {
 						msats += part.Get("amount").Int()
+						settledAt = latest(settledAt, eclairTime(part.Get("timestamp")))
 					}
 
-					for _, listener := range e.invoiceStatusListeners {
-						listener <- rp.InvoiceStatus{
-							CheckingID:       event.Get("paymentHash").String(),
-							Exists:           true,
-							Paid:             true,
-							MSatoshiReceived: msats,
-						}
-					}
+					e.invoices.Publish(rp.InvoiceStatus{
+						CheckingID:       event.Get("paymentHash").String(),
+						Exists:           true,
+						Paid:             true,
+						MSatoshiReceived: msats,
+						SettledAt:        settledAt,
+					})
 				case "payment-sent":
 					var feePaid int64
+					var resolvedAt time.Time
 					for _, part := range event.Get("parts").Array() {
 						feePaid += part.Get("feesPaid").Int()
+						resolvedAt = latest(resolvedAt, eclairTime(part.Get("timestamp")))
 					}
 
-					for _, listener := range e.paymentStatusListeners {
-						listener <- rp.PaymentStatus{
-							CheckingID: event.Get("id").String(),
-							Status:     rp.Complete,
-							FeePaid:    feePaid,
-							Preimage:   event.Get("paymentPreimage").String(),
-						}
-					}
+					e.payments.Publish(rp.PaymentStatus{
+						CheckingID: event.Get("paymentHash").String(),
+						Status:     rp.Complete,
+						FeePaid:    feePaid,
+						Preimage:   event.Get("paymentPreimage").String(),
+						ResolvedAt: resolvedAt,
+					})
 				}
 			}
 		}()
@@ -81,10 +111,26 @@ func Start(params Params) (*EclairWallet, error) {
 // Compile time check to ensure that EclairWallet fully implements rp.Wallet
 var _ rp.Wallet = (*EclairWallet)(nil)
 
+// Close stops forwarding connections through the proxy, when one is used.
+func (e *EclairWallet) Close() error {
+	if e.forwarder == nil {
+		return nil
+	}
+	return e.forwarder.Close()
+}
+
 func (e *EclairWallet) Kind() string {
 	return "eclair"
 }
 
+func (e *EclairWallet) Capabilities() rp.Capabilities {
+	return rp.Capabilities{
+		MaxDescriptionLength: rp.MaxBolt11DescriptionLength,
+		RouteHints:           true, // eclair always adds them for private channels
+		FallbackAddresses:    true,
+	}
+}
+
 func (e *EclairWallet) GetInfo() (rp.WalletInfo, error) {
 	res, err := e.client.Call("channels", map[string]interface{}{})
 	if err != nil {
@@ -99,9 +145,51 @@ func (e *EclairWallet) GetInfo() (rp.WalletInfo, error) {
 	return rp.WalletInfo{Balance: balance}, nil
 }
 
+// Compile time check to ensure that EclairWallet implements rp.NodeInfoProvider
+var _ rp.NodeInfoProvider = (*EclairWallet)(nil)
+
+func (e *EclairWallet) GetNodeInfo() (rp.NodeInfo, error) {
+	res, err := e.client.Call("getinfo", map[string]interface{}{})
+	if err != nil {
+		return rp.NodeInfo{}, fmt.Errorf("error calling 'getinfo': %w", err)
+	}
+
+	return rp.NodeInfo{
+		Pubkey:      res.Get("nodeId").String(),
+		Alias:       res.Get("alias").String(),
+		Network:     res.Get("network").String(),
+		BlockHeight: res.Get("blockHeight").Int(),
+		Version:     res.Get("version").String(),
+	}, nil
+}
+
+func (e *EclairWallet) Health(ctx context.Context) (rp.HealthStatus, error) {
+	if _, err := e.client.Call("getinfo", map[string]interface{}{}); err != nil {
+		return rp.HealthStatus{}, fmt.Errorf("error calling 'getinfo': %w", err)
+	}
+
+	// eclair only answers once it is synced
+	health := rp.HealthStatus{
+		Connected:     true,
+		SyncedToChain: true,
+		SyncedToGraph: true,
+		StreamsAlive:  atomic.LoadInt32(&e.websocketAlive) == 1,
+	}
+	if !health.StreamsAlive {
+		health.Detail = "websocket disconnected"
+	}
+
+	return health, nil
+}
+
 func (e *EclairWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
-	args := map[string]interface{}{
-		"amountMsat": params.Msatoshi,
+	if err := rp.ValidateInvoiceParams(e.Capabilities(), params); err != nil {
+		return rp.InvoiceData{}, err
+	}
+
+	args := map[string]interface{}{}
+	if params.Msatoshi != 0 {
+		args["amountMsat"] = params.Msatoshi // eclair makes invoices for any amount without it
 	}
 
 	if params.DescriptionHash == nil {
@@ -110,9 +198,8 @@ func (e *EclairWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, e
 		args["descriptionHash"] = hex.EncodeToString(params.DescriptionHash)
 	}
 
-	preimage := make([]byte, 32)
-	if _, err := rand.Read(preimage); err != nil {
-		return rp.InvoiceData{}, fmt.Errorf("failed to make random preimage: %w", err)
+	if preimage, err := rp.InvoicePreimage(params); err != nil {
+		return rp.InvoiceData{}, err
 	} else {
 		args["paymentPreimage"] = hex.EncodeToString(preimage)
 	}
@@ -121,6 +208,10 @@ func (e *EclairWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, e
 		args["expireIn"] = params.Expiry.Seconds()
 	}
 
+	if params.FallbackAddress != "" {
+		args["fallbackAddress"] = params.FallbackAddress
+	}
+
 	inv, err := e.client.Call("createinvoice", args)
 	if err != nil {
 		return rp.InvoiceData{}, fmt.Errorf("'createinvoice' call failed: %w", err)
@@ -138,31 +229,54 @@ func (e *EclairWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, er
 	})
 	if err != nil {
 		if strings.Contains(err.Error(), "Not found") {
-			return rp.InvoiceStatus{
-				CheckingID: checkingID,
-				Exists:     false,
-			}, nil
+			return rp.InvoiceNotFound(checkingID)
 		}
 
-		return rp.InvoiceStatus{},
-			fmt.Errorf("error on 'getreceivedinfo' hash=%s: %w", checkingID, err)
+		return rp.InvoiceLookupFailed(checkingID,
+			fmt.Errorf("error on 'getreceivedinfo' hash=%s: %w", checkingID, err))
 	}
 
-	return rp.InvoiceStatus{
+	status := rp.InvoiceStatus{
 		CheckingID:       checkingID,
 		Exists:           true,
 		Paid:             res.Get("status.type").String() == "received",
 		MSatoshiReceived: res.Get("status.amount").Int(),
-	}, nil
+		SettledAt:        eclairTime(res.Get("status.receivedAt")),
+	}
+	if status.Paid {
+		status.Preimage = res.Get("paymentPreimage").String()
+	}
+	return status, nil
+}
+
+// CancelInvoice isn't supported, eclair can't delete invoices.
+func (e *EclairWallet) CancelInvoice(checkingID string) error {
+	return fmt.Errorf("%w: eclair can't cancel invoices", rp.ErrUnsupported)
 }
 
 func (e *EclairWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
-	listener := make(chan rp.InvoiceStatus)
-	e.invoiceStatusListeners = append(e.invoiceStatusListeners, listener)
+	listener, _ := e.invoices.Subscribe()
 	return listener, nil
 }
 
 func (e *EclairWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	inv, err := decodepay.Decodepay(params.Invoice)
+	if err != nil {
+		return rp.PaymentData{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+	}
+
+	amount := inv.MSatoshi
+	if params.CustomAmount != 0 {
+		amount = params.CustomAmount
+	}
+	if err := rp.ValidatePayment(e.Capabilities(), params, amount); err != nil {
+		return rp.PaymentData{}, err
+	}
+
+	if params.TrampolineNodeID != "" {
+		return e.payWithTrampoline(params, inv.PaymentHash, inv.Payee, amount)
+	}
+
 	args := map[string]interface{}{
 		"invoice":   params.Invoice,
 		"blocking":  false,
@@ -172,21 +286,64 @@ func (e *EclairWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, err
 		args["amountMsat"] = params.CustomAmount
 	}
 
-	id, err := e.client.Call("payinvoice", args)
-	if err != nil {
+	if _, err := e.client.Call("payinvoice", args); err != nil {
 		return rp.PaymentData{}, fmt.Errorf("error calling 'payinvoice' with '%s': %w",
 			params.Invoice, err)
 	}
 
 	return rp.PaymentData{
-		CheckingID: id.Value().(string),
+		CheckingID: inv.PaymentHash,
+	}, nil
+}
+
+func (e *EclairWallet) payWithTrampoline(
+	params rp.PaymentParams,
+	paymentHash string,
+	payee string,
+	amount int64,
+) (rp.PaymentData, error) {
+	info, err := e.client.Call("getinfo", map[string]interface{}{})
+	if err != nil {
+		return rp.PaymentData{}, fmt.Errorf("error calling 'getinfo': %w", err)
+	}
+
+	fee := params.TrampolineFeeMsatoshi
+	if fee == 0 {
+		fee = amount / 100
+	}
+	cltv := params.TrampolineCltvExpiry
+	if cltv == 0 {
+		cltv = 576
+	}
+
+	args := map[string]interface{}{
+		"invoice":              params.Invoice,
+		"amountMsat":           amount,
+		"nodeIds":              info.Get("nodeId").String() + "," + params.TrampolineNodeID,
+		"trampolineNodes":      params.TrampolineNodeID + "," + payee,
+		"trampolineFeesMsat":   fee,
+		"trampolineCltvExpiry": cltv,
+	}
+
+	if _, err := e.client.Call("sendtoroute", args); err != nil {
+		return rp.PaymentData{}, fmt.Errorf("error calling 'sendtoroute' with '%s' through %s: %w",
+			params.Invoice, params.TrampolineNodeID, err)
+	}
+
+	return rp.PaymentData{
+		CheckingID: paymentHash,
 	}, nil
 }
 
 func (e *EclairWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
-	res, err := e.client.Call("getsentinfo", map[string]interface{}{
-		"id": checkingID,
-	})
+	// checking ids used to be eclair payment ids, which are uuids, so those
+	// stored before are still looked up by id
+	args := map[string]interface{}{"paymentHash": checkingID}
+	if strings.Count(checkingID, "-") == 4 {
+		args = map[string]interface{}{"id": checkingID}
+	}
+
+	res, err := e.client.Call("getsentinfo", args)
 	if err != nil {
 		return rp.PaymentStatus{},
 			fmt.Errorf("error getting payment %s: %w", checkingID, err)
@@ -198,24 +355,27 @@ func (e *EclairWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, er
 			Status:     rp.NeverTried,
 		}, nil
 	} else {
+		var failedAt time.Time
 		for _, attempt := range res.Array() {
 			status := attempt.Get("status")
 
 			switch status.Get("type").String() {
 			case "sent":
-				return rp.PaymentStatus{
+				return sentDetails(rp.PaymentStatus{
 					CheckingID: checkingID,
 					Status:     rp.Complete,
 					FeePaid:    status.Get("feesPaid").Int(),
 					Preimage:   status.Get("paymentPreimage").String(),
-				}, nil
+					ResolvedAt: eclairTime(status.Get("completedAt")),
+				}, attempt), nil
 			case "pending":
-				return rp.PaymentStatus{
+				return sentDetails(rp.PaymentStatus{
 					CheckingID: checkingID,
 					Status:     rp.Pending,
-				}, nil
+				}, attempt), nil
 			case "failed":
 				// this one failed, but keep checking the others
+				failedAt = latest(failedAt, eclairTime(status.Get("completedAt")))
 				continue
 			default:
 				// what is this?
@@ -227,15 +387,57 @@ func (e *EclairWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, er
 		}
 
 		// if we reached here that's because all attempts are failed
-		return rp.PaymentStatus{
+		return sentDetails(rp.PaymentStatus{
 			CheckingID: checkingID,
 			Status:     rp.Failed,
-		}, nil
+			ResolvedAt: failedAt,
+		}, res.Get("0")), nil
 	}
 }
 
+// sentDetails fills the destination, amount and description of a payment from
+// a getsentinfo attempt.
+func sentDetails(status rp.PaymentStatus, attempt gjson.Result) rp.PaymentStatus {
+	status.Destination = attempt.Get("recipientNodeId").String()
+	status.Msatoshi = attempt.Get("recipientAmount").Int()
+	status.Description = attempt.Get("paymentRequest.description").String()
+	return rp.FillPaymentDetails(status, attempt.Get("paymentRequest.serialized").String())
+}
+
 func (e *EclairWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
-	listener := make(chan rp.PaymentStatus)
-	e.paymentStatusListeners = append(e.paymentStatusListeners, listener)
+	listener, _ := e.payments.Subscribe()
 	return listener, nil
 }
+
+// Compile time check to ensure that EclairWallet implements rp.Subscriber
+var _ rp.Subscriber = (*EclairWallet)(nil)
+
+func (e *EclairWallet) SubscribePaidInvoices() (<-chan rp.InvoiceStatus, func()) {
+	return e.invoices.Subscribe()
+}
+
+func (e *EclairWallet) SubscribePayments() (<-chan rp.PaymentStatus, func()) {
+	return e.payments.Subscribe()
+}
+
+// eclairTime reads eclair timestamps, which are milliseconds in older versions
+// and objects with the unix seconds in newer ones.
+func eclairTime(field gjson.Result) time.Time {
+	if field.IsObject() {
+		if unix := field.Get("unix").Int(); unix != 0 {
+			return time.Unix(unix, 0)
+		}
+		return time.Time{}
+	}
+	if ms := field.Int(); ms != 0 {
+		return time.Unix(0, ms*int64(time.Millisecond))
+	}
+	return time.Time{}
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
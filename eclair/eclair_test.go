@@ -0,0 +1,26 @@
+package eclair
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestEclairTime(t *testing.T) {
+	for _, c := range []struct {
+		json string
+		want time.Time
+	}{
+		{`{}`, time.Time{}},
+		// older versions give milliseconds
+		{`{"at": 1640995200123}`, time.Unix(1640995200, 123e6)},
+		// newer ones an object with both forms
+		{`{"at": {"iso": "2022-01-01T00:00:00Z", "unix": 1640995200}}`, time.Unix(1640995200, 0)},
+		{`{"at": {"iso": "2022-01-01T00:00:00Z"}}`, time.Time{}},
+	} {
+		if got := eclairTime(gjson.Get(c.json, "at")); !got.Equal(c.want) {
+			t.Errorf("got %v, wanted %v for %s", got, c.want, c.json)
+		}
+	}
+}
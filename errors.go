@@ -0,0 +1,75 @@
+package relampago
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInsufficientPermissions = errors.New("insufficient permissions")
+
+var ErrUnsupported = errors.New("not supported by this backend")
+
+// PermissionError is returned when the backend rejects a call because the
+// credentials it was given can't make it, like paying with an invoice
+// macaroon. It matches ErrInsufficientPermissions with errors.Is.
+type PermissionError struct {
+	Method      string
+	Permissions []string // the permissions needed, when known
+	Err         error
+}
+
+func (e *PermissionError) Error() string {
+	if len(e.Permissions) == 0 {
+		return fmt.Sprintf("%s: %s was denied: %s",
+			ErrInsufficientPermissions, e.Method, e.Err)
+	}
+	return fmt.Sprintf("%s: %s needs %s: %s",
+		ErrInsufficientPermissions, e.Method, strings.Join(e.Permissions, ", "), e.Err)
+}
+
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrInsufficientPermissions
+}
+
+func (e *PermissionError) Unwrap() error {
+	return e.Err
+}
+
+var ErrNotFound = errors.New("not found")
+
+// ErrReadOnly is returned by wallets made read-only for every call that would
+// spend, like MakePayment.
+var ErrReadOnly = errors.New("wallet is read-only")
+
+// ErrBackendUnavailable is returned without calling the backend when it has
+// been failing, so callers don't pile up on it.
+var ErrBackendUnavailable = errors.New("backend unavailable")
+
+// ErrSelfPayment is returned by MakePayment for invoices issued by the same
+// node, when the backend can't settle them internally.
+var ErrSelfPayment = errors.New("invoice was issued by this wallet")
+
+// LegacyInvoiceLookups restores the old GetInvoiceStatus behavior, where every
+// failed lookup, connectivity failures included, was reported as an invoice
+// that doesn't exist and no error.
+var LegacyInvoiceLookups = false
+
+// InvoiceNotFound is what backends return from GetInvoiceStatus for invoices
+// they don't have.
+func InvoiceNotFound(checkingID string) (InvoiceStatus, error) {
+	status := InvoiceStatus{CheckingID: checkingID, Exists: false}
+	if LegacyInvoiceLookups {
+		return status, nil
+	}
+	return status, fmt.Errorf("%w: invoice %s", ErrNotFound, checkingID)
+}
+
+// InvoiceLookupFailed is what backends return from GetInvoiceStatus when they
+// couldn't tell if they have the invoice.
+func InvoiceLookupFailed(checkingID string, err error) (InvoiceStatus, error) {
+	if LegacyInvoiceLookups {
+		return InvoiceStatus{CheckingID: checkingID, Exists: false}, nil
+	}
+	return InvoiceStatus{}, err
+}
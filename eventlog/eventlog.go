@@ -0,0 +1,159 @@
+package eventlog
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Store persists paid invoice events until they are acknowledged.
+type Store interface {
+	// Append saves the event unless one with the same CheckingID was already
+	// saved, in which case it returns false.
+	Append(rp.InvoiceStatus) (bool, error)
+
+	// Pending returns all events not yet acknowledged, oldest first.
+	Pending() ([]rp.InvoiceStatus, error)
+
+	Ack(checkingID string) error
+}
+
+type Params struct {
+	Wallet rp.Wallet
+	Store  Store
+}
+
+// EventLogWallet wraps another wallet so paid invoices are delivered at least
+// once: every settlement is saved to the store before being emitted and keeps
+// being replayed to new subscribers until Ack is called for it.
+type EventLogWallet struct {
+	rp.Wallet
+	store Store
+
+	invoices rp.InvoiceBroadcaster
+}
+
+func Start(params Params) (*EventLogWallet, error) {
+	if params.Store == nil {
+		params.Store = NewMemoryStore()
+	}
+
+	invoices, err := params.Wallet.PaidInvoicesStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to invoices: %w", err)
+	}
+
+	e := &EventLogWallet{
+		Wallet: params.Wallet,
+		store:  params.Store,
+	}
+
+	go func() {
+		for status := range invoices {
+			isNew, err := e.store.Append(status)
+			if err != nil {
+				// it's still delivered, just not replayable
+				log.Printf("Failed to save invoice event %s: %v", status.CheckingID, err)
+				isNew = true
+			}
+			if !isNew {
+				continue // duplicate settlement event
+			}
+
+			e.invoices.Publish(status)
+		}
+	}()
+
+	return e, nil
+}
+
+// PaidInvoicesStream replays all settlements that weren't acknowledged yet
+// besides emitting new ones as they come.
+func (e *EventLogWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	// subscribe before loading the pending events so the ones saved in between
+	// aren't missed, those that end up in both are only emitted once
+	live, cancel := e.invoices.Subscribe()
+	pending, err := e.store.Pending()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to load pending events: %w", err)
+	}
+	if len(pending) == 0 {
+		return live, nil
+	}
+
+	listener := make(chan rp.InvoiceStatus, rp.StreamBufferSize)
+	go func() {
+		defer close(listener)
+
+		replayed := make(map[string]bool, len(pending))
+		for _, status := range pending {
+			replayed[status.CheckingID] = true
+			listener <- status
+		}
+		for status := range live {
+			if !replayed[status.CheckingID] {
+				listener <- status
+			}
+		}
+	}()
+
+	return listener, nil
+}
+
+// Ack marks the settlement as processed so it's not replayed anymore.
+func (e *EventLogWallet) Ack(checkingID string) error {
+	return e.store.Ack(checkingID)
+}
+
+type MemoryStore struct {
+	mu     sync.Mutex
+	events []rp.InvoiceStatus
+	seen   map[string]bool
+	acked  map[string]bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		seen:  make(map[string]bool),
+		acked: make(map[string]bool),
+	}
+}
+
+func (m *MemoryStore) Append(status rp.InvoiceStatus) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.seen[status.CheckingID] {
+		return false, nil
+	}
+	m.seen[status.CheckingID] = true
+	m.events = append(m.events, status)
+	return true, nil
+}
+
+func (m *MemoryStore) Pending() ([]rp.InvoiceStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []rp.InvoiceStatus
+	for _, status := range m.events {
+		if !m.acked[status.CheckingID] {
+			pending = append(pending, status)
+		}
+	}
+	return pending, nil
+}
+
+func (m *MemoryStore) Ack(checkingID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.seen[checkingID] {
+		return fmt.Errorf("unknown event %s", checkingID)
+	}
+	m.acked[checkingID] = true
+	return nil
+}
@@ -0,0 +1,100 @@
+package eventlog
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type streamWallet struct {
+	void.VoidWallet
+	invoices chan rp.InvoiceStatus
+}
+
+func (w *streamWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	return w.invoices, nil
+}
+
+func paid(checkingID string) rp.InvoiceStatus {
+	return rp.InvoiceStatus{CheckingID: checkingID, Exists: true, Paid: true}
+}
+
+func receive(t *testing.T, stream <-chan rp.InvoiceStatus, want ...string) {
+	t.Helper()
+	for _, checkingID := range want {
+		if got := <-stream; got.CheckingID != checkingID {
+			t.Errorf("got %v, wanted %v", got.CheckingID, checkingID)
+		}
+	}
+}
+
+func testStores(t *testing.T) map[string]Store {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlStore, err := NewSQLStore(db, "sqlite", "")
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	return map[string]Store{"memory": NewMemoryStore(), "sql": sqlStore}
+}
+
+func TestEventLog(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			wallet := &streamWallet{invoices: make(chan rp.InvoiceStatus)}
+			e, err := Start(Params{Wallet: wallet, Store: store})
+			if err != nil {
+				t.Fatalf("got %v, wanted %v", err, nil)
+			}
+
+			first, _ := e.PaidInvoicesStream()
+			wallet.invoices <- paid("a")
+			wallet.invoices <- paid("a") // duplicate
+			wallet.invoices <- paid("b")
+			receive(t, first, "a", "b")
+
+			if err := e.Ack("a"); err != nil {
+				t.Errorf("got %v, wanted %v", err, nil)
+			}
+			if err := e.Ack("unknown"); err == nil {
+				t.Errorf("got %v, wanted an error", err)
+			}
+
+			// only the unacknowledged one is replayed, then new ones follow
+			second, _ := e.PaidInvoicesStream()
+			receive(t, second, "b")
+			wallet.invoices <- paid("c")
+			receive(t, second, "c")
+			receive(t, first, "c")
+		})
+	}
+}
+
+func TestEventLog_Restart(t *testing.T) {
+	store := NewMemoryStore()
+	wallet := &streamWallet{invoices: make(chan rp.InvoiceStatus)}
+	e, _ := Start(Params{Wallet: wallet, Store: store})
+	stream, _ := e.PaidInvoicesStream()
+	wallet.invoices <- paid("a")
+	receive(t, stream, "a")
+	close(wallet.invoices)
+
+	// never acknowledged, so delivered again after a restart
+	wallet = &streamWallet{invoices: make(chan rp.InvoiceStatus)}
+	e, _ = Start(Params{Wallet: wallet, Store: store})
+	stream, _ = e.PaidInvoicesStream()
+	receive(t, stream, "a")
+
+	// and not twice when the backend emits it again
+	wallet.invoices <- paid("a")
+	wallet.invoices <- paid("b")
+	receive(t, stream, "b")
+}
@@ -0,0 +1,105 @@
+package eventlog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/internal/sqldialect"
+)
+
+// SQLStore keeps the event log in a table on any database/sql database. The
+// driver must be registered by the caller, both "sqlite" and "postgres"
+// dialects are supported.
+type SQLStore struct {
+	db      *sql.DB
+	table   string
+	dialect string
+}
+
+func NewSQLStore(db *sql.DB, dialect string, table string) (*SQLStore, error) {
+	if err := sqldialect.Check(dialect); err != nil {
+		return nil, err
+	}
+	if table == "" {
+		table = "relampago_invoice_events"
+	}
+
+	s := &SQLStore{db: db, table: table, dialect: dialect}
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS ` + table + ` (
+  checking_id TEXT PRIMARY KEY,
+  event TEXT NOT NULL,
+  received_at BIGINT NOT NULL,
+  acked BOOLEAN NOT NULL DEFAULT false
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+
+	return s, nil
+}
+
+func (s *SQLStore) Append(status rp.InvoiceStatus) (bool, error) {
+	event, err := json.Marshal(status)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := s.db.Exec(s.rebind(`
+INSERT INTO `+s.table+` (checking_id, event, received_at) VALUES (?, ?, ?)
+ON CONFLICT (checking_id) DO NOTHING`),
+		status.CheckingID, string(event), time.Now().UnixNano())
+	if err != nil {
+		return false, fmt.Errorf("failed to insert event %s: %w", status.CheckingID, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *SQLStore) Pending() ([]rp.InvoiceStatus, error) {
+	rows, err := s.db.Query(`SELECT event FROM ` + s.table +
+		` WHERE NOT acked ORDER BY received_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending events: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []rp.InvoiceStatus
+	for rows.Next() {
+		var event string
+		if err := rows.Scan(&event); err != nil {
+			return nil, err
+		}
+
+		var status rp.InvoiceStatus
+		if err := json.Unmarshal([]byte(event), &status); err != nil {
+			return nil, fmt.Errorf("corrupted event '%s': %w", event, err)
+		}
+		pending = append(pending, status)
+	}
+
+	return pending, rows.Err()
+}
+
+func (s *SQLStore) Ack(checkingID string) error {
+	res, err := s.db.Exec(s.rebind(`UPDATE `+s.table+` SET acked = true WHERE checking_id = ?`),
+		checkingID)
+	if err != nil {
+		return fmt.Errorf("failed to ack event %s: %w", checkingID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("unknown event %s", checkingID)
+	}
+	return nil
+}
+
+func (s *SQLStore) rebind(query string) string {
+	return sqldialect.Rebind(s.dialect, query)
+}
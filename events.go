@@ -0,0 +1,129 @@
+package relampago
+
+import (
+	"context"
+	"time"
+)
+
+type EventType string
+
+const (
+	InvoiceCreated   EventType = "invoice-created"
+	InvoiceSettled   EventType = "invoice-settled"
+	InvoiceExpired   EventType = "invoice-expired"
+	InvoiceCanceled  EventType = "invoice-canceled"
+	PaymentPending   EventType = "payment-pending"
+	PaymentSucceeded EventType = "payment-succeeded"
+	PaymentFailed    EventType = "payment-failed"
+	ChannelOpened    EventType = "channel-opened"
+	ChannelClosed    EventType = "channel-closed"
+	PeerOnline       EventType = "peer-online"
+	PeerOffline      EventType = "peer-offline"
+)
+
+// Event is one thing that happened on the node. Only the field matching its
+// type is set: Invoice for invoice events, Payment for payment events and so
+// on.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+
+	Invoice *InvoiceStatus `json:"invoice,omitempty"`
+	Payment *PaymentStatus `json:"payment,omitempty"`
+	Channel *ChannelInfo   `json:"channel,omitempty"`
+	Peer    string         `json:"peer,omitempty"` // pubkey
+}
+
+type ChannelInfo struct {
+	ID          string `json:"id"`
+	Peer        string `json:"peer"`
+	CapacitySat int64  `json:"capacitySat"`
+}
+
+// EventSource is implemented by wallets that emit every kind of Event on a
+// single stream. The stream stops and its channel is closed once ctx is done.
+type EventSource interface {
+	Events(ctx context.Context) (<-chan Event, error)
+}
+
+// Events streams the wallet events until ctx is done. For wallets that aren't
+// EventSources only settled invoices and payment outcomes are emitted.
+func Events(ctx context.Context, wallet Wallet) (<-chan Event, error) {
+	if source, ok := wallet.(EventSource); ok {
+		return source.Events(ctx)
+	}
+
+	invoices, cancelInvoices, err := SubscribePaidInvoices(ctx, wallet)
+	if err != nil {
+		return nil, err
+	}
+	payments, cancelPayments, err := SubscribePayments(ctx, wallet)
+	if err != nil {
+		cancelInvoices()
+		return nil, err
+	}
+
+	listener := make(chan Event)
+	go func() {
+		defer close(listener)
+		defer cancelInvoices()
+		defer cancelPayments()
+
+		for invoices != nil || payments != nil {
+			var event Event
+			select {
+			case status, ok := <-invoices:
+				if !ok {
+					invoices = nil
+					continue
+				}
+				event = InvoiceEvent(status)
+			case status, ok := <-payments:
+				if !ok {
+					payments = nil
+					continue
+				}
+				event = PaymentEvent(status)
+			}
+
+			select {
+			case listener <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return listener, nil
+}
+
+// InvoiceEvent is the event for an invoice that was settled, canceled or that
+// expired.
+func InvoiceEvent(status InvoiceStatus) Event {
+	event := Event{Type: InvoiceSettled, Time: status.SettledAt, Invoice: &status}
+	switch {
+	case status.Expired:
+		event.Type = InvoiceExpired
+	case status.Canceled:
+		event.Type = InvoiceCanceled
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	return event
+}
+
+// PaymentEvent is the event for a payment update.
+func PaymentEvent(status PaymentStatus) Event {
+	event := Event{Type: PaymentPending, Time: status.ResolvedAt, Payment: &status}
+	switch status.Status {
+	case Complete:
+		event.Type = PaymentSucceeded
+	case Failed:
+		event.Type = PaymentFailed
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	return event
+}
@@ -0,0 +1,193 @@
+// Package feesim generates routing fees like the ones seen on the network, so
+// budgets, fee estimators and anything else that depends on fees can be tested
+// and tuned against different fee regimes without paying on mainnet.
+package feesim
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+// Regime describes the fees charged along routes. Every route has between
+// MinHops and MaxHops hops that charge fees and each one charges a base fee
+// plus a proportional fee.
+type Regime struct {
+	MinHops int
+	MaxHops int
+
+	// BaseFeeMsatoshi is the base fee of every hop, drawn uniformly between
+	// the two values.
+	BaseFeeMsatoshi [2]int64
+
+	// The proportional fee of every hop, in parts per million, follows a
+	// log-normal distribution with this median and sigma, which gives the long
+	// tail of expensive channels seen in practice.
+	FeeRateMedianPPM float64
+	FeeRateSigma     float64
+
+	// SpikeProbability is the chance that a hop charges SpikeFeeRatePPM
+	// instead, like channels that are being drained or rebalanced.
+	SpikeProbability float64
+	SpikeFeeRatePPM  int64
+
+	// FailureProbability is the chance that a payment fails, see Pay.
+	FailureProbability float64
+}
+
+var (
+	// Cheap is a network of well connected nodes with low fees.
+	Cheap = Regime{
+		MinHops:          1,
+		MaxHops:          3,
+		BaseFeeMsatoshi:  [2]int64{0, 1000},
+		FeeRateMedianPPM: 10,
+		FeeRateSigma:     1,
+	}
+
+	// Typical resembles the fees paid by routing nodes today.
+	Typical = Regime{
+		MinHops:            2,
+		MaxHops:            4,
+		BaseFeeMsatoshi:    [2]int64{0, 1000},
+		FeeRateMedianPPM:   100,
+		FeeRateSigma:       1.2,
+		SpikeProbability:   0.02,
+		SpikeFeeRatePPM:    2500,
+		FailureProbability: 0.05,
+	}
+
+	// Congested is a network where liquidity is scarce and fees are high.
+	Congested = Regime{
+		MinHops:            3,
+		MaxHops:            6,
+		BaseFeeMsatoshi:    [2]int64{1000, 5000},
+		FeeRateMedianPPM:   800,
+		FeeRateSigma:       1.5,
+		SpikeProbability:   0.1,
+		SpikeFeeRatePPM:    10000,
+		FailureProbability: 0.2,
+	}
+)
+
+// cltv delta assumed for every hop when estimating
+const hopTimeLockDelta = 40
+
+// Sim draws fees from a Regime. It is seeded so runs can be reproduced and is
+// safe for concurrent use.
+type Sim struct {
+	Regime Regime
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func New(regime Regime, seed int64) *Sim {
+	return &Sim{Regime: regime, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Compile time check to ensure that Sim implements rp.FeeEstimator
+var _ rp.FeeEstimator = (*Sim)(nil)
+
+// Fee is the total fee of a route for a payment of msatoshi.
+func (s *Sim) Fee(msatoshi int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fee, _ := s.route(msatoshi)
+	return fee
+}
+
+// Sample draws the fees of n payments of msatoshi.
+func (s *Sim) Sample(msatoshi int64, n int) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fees := make([]int64, n)
+	for i := range fees {
+		fees[i], _ = s.route(msatoshi)
+	}
+	return fees
+}
+
+// EstimatePaymentFee quotes a fee drawn from the regime, as a real estimator
+// would give a different answer for every route it finds. Only Msatoshi is
+// used from the params.
+func (s *Sim) EstimatePaymentFee(params rp.FeeEstimateParams) (rp.FeeEstimate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fee, hops := s.route(params.Msatoshi)
+	return rp.FeeEstimate{
+		FeeMsatoshi:   fee,
+		TimeLockDelay: int64(hops * hopTimeLockDelta),
+	}, nil
+}
+
+// Pay resolves a payment made on a testwallet with a fee drawn from the
+// regime, or fails it with the regime FailureProbability. The fee is returned,
+// zero when the payment failed.
+func (s *Sim) Pay(wallet *testwallet.TestWallet, checkingID string, msatoshi int64) (int64, error) {
+	s.mu.Lock()
+	failed := s.rng.Float64() < s.Regime.FailureProbability
+	fee, _ := s.route(msatoshi)
+	s.mu.Unlock()
+
+	if failed {
+		return 0, wallet.FailPayment(checkingID)
+	}
+	return fee, wallet.CompletePayment(checkingID, "", fee)
+}
+
+// route draws the fee and the number of hops of a route, with s.mu held.
+func (s *Sim) route(msatoshi int64) (int64, int) {
+	r := s.Regime
+
+	hops := r.MinHops
+	if r.MaxHops > r.MinHops {
+		hops += s.rng.Intn(r.MaxHops - r.MinHops + 1)
+	}
+
+	var fee int64
+	for i := 0; i < hops; i++ {
+		base := r.BaseFeeMsatoshi[0]
+		if spread := r.BaseFeeMsatoshi[1] - r.BaseFeeMsatoshi[0]; spread > 0 {
+			base += s.rng.Int63n(spread + 1)
+		}
+
+		var ppm int64
+		if s.rng.Float64() < r.SpikeProbability {
+			ppm = r.SpikeFeeRatePPM
+		} else if r.FeeRateMedianPPM > 0 {
+			ppm = int64(r.FeeRateMedianPPM * math.Exp(r.FeeRateSigma*s.rng.NormFloat64()))
+		}
+
+		// every hop charges on the amount it forwards, which includes the fees
+		// of the hops after it
+		fee += base + (msatoshi+fee)*ppm/1000000
+	}
+	return fee, hops
+}
+
+// Percentile returns the fee below which p percent of the fees are.
+func Percentile(fees []int64, p float64) int64 {
+	if len(fees) == 0 {
+		return 0
+	}
+
+	sorted := append([]int64(nil), fees...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
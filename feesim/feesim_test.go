@@ -0,0 +1,57 @@
+package feesim
+
+import (
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+func TestSample_Reproducible(t *testing.T) {
+	a := New(Typical, 42).Sample(100000000, 50)
+	b := New(Typical, 42).Sample(100000000, 50)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("got %d and %d at %d, wanted the same fees for the same seed", a[i], b[i], i)
+		}
+	}
+}
+
+func TestSample_Regimes(t *testing.T) {
+	var medians []int64
+	for _, regime := range []Regime{Cheap, Typical, Congested} {
+		fees := New(regime, 1).Sample(100000000, 1000)
+		medians = append(medians, Percentile(fees, 50))
+	}
+	if !(medians[0] < medians[1] && medians[1] < medians[2]) {
+		t.Errorf("got medians %v, wanted them increasing from Cheap to Congested", medians)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	fees := []int64{5, 1, 4, 2, 3}
+	for p, expected := range map[float64]int64{0: 1, 50: 3, 90: 5, 100: 5} {
+		if got := Percentile(fees, p); got != expected {
+			t.Errorf("p%v: got %d, wanted %d", p, got, expected)
+		}
+	}
+}
+
+func TestPay(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	sim := New(Regime{MinHops: 1, MaxHops: 1, BaseFeeMsatoshi: [2]int64{1000, 1000}}, 1)
+
+	data, _ := tw.MakePayment(rp.PaymentParams{Invoice: "lnbc1"})
+	fee, err := sim.Pay(tw, data.CheckingID, 50000)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if fee != 1000 {
+		t.Errorf("got fee %d, wanted %d", fee, 1000)
+	}
+
+	status, _ := tw.GetPaymentStatus(data.CheckingID)
+	if status.Status != rp.Complete || status.FeePaid != 1000 {
+		t.Errorf("got %v, wanted a complete payment with the simulated fee", status)
+	}
+}
@@ -1,24 +1,15 @@
 module github.com/lnbits/relampago
 
-go 1.16
+go 1.18
 
 require (
-	cloud.google.com/go v0.99.0 // indirect
-	github.com/cespare/xxhash/v2 v2.1.2 // indirect
-	github.com/fiatjaf/eclair-go v0.2.3
-	github.com/fiatjaf/go-cliche v0.1.0
-	github.com/fiatjaf/lightningd-gjson-rpc v1.4.1
-	github.com/fiatjaf/ln-decodepay v1.1.0
-	github.com/json-iterator/go v1.1.12 // indirect
-	github.com/kelseyhightower/envconfig v1.4.0
-	github.com/kr/pretty v0.2.0 // indirect
-	github.com/lightningnetwork/lnd v0.14.1-beta
-	github.com/r3labs/sse/v2 v2.3.6
-	github.com/tidwall/gjson v1.8.1
-	go.etcd.io/etcd/client/v2 v2.305.1 // indirect
-	golang.org/x/sys v0.0.0-20211210111614-af8b64212486 // indirect
-	golang.org/x/text v0.3.7 // indirect
-	google.golang.org/genproto v0.0.0-20211208223120-3a66f561d7aa // indirect
-	google.golang.org/grpc v1.43.0
-	gopkg.in/macaroon.v2 v2.0.0
+	github.com/btcsuite/btcd/btcec/v2 v2.2.1
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/net v0.0.0-20210913180222-943fd674d43e
+)
+
+require (
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
 )
@@ -0,0 +1,128 @@
+package grant
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Grant allows its holder to create invoices within the given limits until it
+// expires, without holding any node credentials. Grants are signed offline by
+// the operator and only the public key is needed to verify them.
+type Grant struct {
+	ID          string `json:"id"`
+	Holder      string `json:"holder,omitempty"`
+	MinMsatoshi int64  `json:"minMsatoshi"`
+	MaxMsatoshi int64  `json:"maxMsatoshi"`
+	MaxExpiry   int64  `json:"maxExpiry,omitempty"` // seconds, 0 means no limit
+	NotAfter    int64  `json:"notAfter"`            // unix timestamp
+}
+
+var (
+	ErrMalformed        = errors.New("malformed grant")
+	ErrInvalidSig       = errors.New("invalid grant signature")
+	ErrExpired          = errors.New("grant has expired")
+	ErrAmountNotInRange = errors.New("amount not allowed by grant")
+	ErrExpiryTooLong    = errors.New("invoice expiry not allowed by grant")
+)
+
+// Issue signs a grant valid for the given duration and returns its token.
+func Issue(key ed25519.PrivateKey, g Grant, validFor time.Duration) (string, error) {
+	if g.MaxMsatoshi < g.MinMsatoshi {
+		return "", fmt.Errorf("maxMsatoshi %d is lower than minMsatoshi %d",
+			g.MaxMsatoshi, g.MinMsatoshi)
+	}
+	if g.ID == "" {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return "", fmt.Errorf("failed to make random grant id: %w", err)
+		}
+		g.ID = hex.EncodeToString(id)
+	}
+	g.NotAfter = time.Now().Add(validFor).Unix()
+
+	payload, err := json.Marshal(g)
+	if err != nil {
+		return "", err
+	}
+	sig := ed25519.Sign(key, payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Verify checks the token signature and expiration and returns the grant.
+func Verify(key ed25519.PublicKey, token string) (Grant, error) {
+	spl := strings.Split(token, ".")
+	if len(spl) != 2 {
+		return Grant{}, ErrMalformed
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(spl[0])
+	if err != nil {
+		return Grant{}, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(spl[1])
+	if err != nil {
+		return Grant{}, ErrMalformed
+	}
+
+	if !ed25519.Verify(key, payload, sig) {
+		return Grant{}, ErrInvalidSig
+	}
+
+	var g Grant
+	if err := json.Unmarshal(payload, &g); err != nil {
+		return Grant{}, ErrMalformed
+	}
+	if time.Now().Unix() > g.NotAfter {
+		return g, ErrExpired
+	}
+
+	return g, nil
+}
+
+// Allows checks if the invoice described by params can be created under g.
+func (g Grant) Allows(params rp.InvoiceParams) error {
+	if params.Msatoshi < g.MinMsatoshi || params.Msatoshi > g.MaxMsatoshi {
+		return fmt.Errorf("%w: %d not in [%d, %d]",
+			ErrAmountNotInRange, params.Msatoshi, g.MinMsatoshi, g.MaxMsatoshi)
+	}
+	if g.MaxExpiry != 0 &&
+		(params.Expiry == nil || int64(params.Expiry.Seconds()) > g.MaxExpiry) {
+		return fmt.Errorf("%w: max is %ds", ErrExpiryTooLong, g.MaxExpiry)
+	}
+	return nil
+}
+
+// CreateInvoice verifies the token and creates the invoice on the wallet if the
+// grant allows it. When the grant limits the expiry and none was requested the
+// maximum allowed is used.
+func CreateInvoice(
+	wallet rp.Wallet,
+	key ed25519.PublicKey,
+	token string,
+	params rp.InvoiceParams,
+) (rp.InvoiceData, error) {
+	g, err := Verify(key, token)
+	if err != nil {
+		return rp.InvoiceData{}, err
+	}
+
+	if g.MaxExpiry != 0 && params.Expiry == nil {
+		expiry := time.Duration(g.MaxExpiry) * time.Second
+		params.Expiry = &expiry
+	}
+	if err := g.Allows(params); err != nil {
+		return rp.InvoiceData{}, err
+	}
+
+	return wallet.CreateInvoice(params)
+}
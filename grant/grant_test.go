@@ -0,0 +1,62 @@
+package grant
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+func TestIssueVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+
+	token, err := Issue(priv, Grant{Holder: "pos-1", MinMsatoshi: 1000, MaxMsatoshi: 50000}, time.Hour)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	g, err := Verify(pub, token)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if g.Holder != "pos-1" || g.MaxMsatoshi != 50000 || g.ID == "" {
+		t.Errorf("got %v, wanted the issued grant", g)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	if _, err := Verify(otherPub, token); !errors.Is(err, ErrInvalidSig) {
+		t.Errorf("got %v, wanted %v", err, ErrInvalidSig)
+	}
+	if _, err := Verify(pub, token[1:]); err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+
+	expired, _ := Issue(priv, Grant{MaxMsatoshi: 1}, -time.Minute)
+	if _, err := Verify(pub, expired); !errors.Is(err, ErrExpired) {
+		t.Errorf("got %v, wanted %v", err, ErrExpired)
+	}
+}
+
+func TestCreateInvoice(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	token, _ := Issue(priv, Grant{MinMsatoshi: 1000, MaxMsatoshi: 50000, MaxExpiry: 600}, time.Hour)
+	wallet, _ := void.Start()
+
+	if _, err := CreateInvoice(wallet, pub, token, rp.InvoiceParams{Msatoshi: 2000}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+
+	_, err := CreateInvoice(wallet, pub, token, rp.InvoiceParams{Msatoshi: 100000})
+	if !errors.Is(err, ErrAmountNotInRange) {
+		t.Errorf("got %v, wanted %v", err, ErrAmountNotInRange)
+	}
+
+	expiry := time.Hour
+	_, err = CreateInvoice(wallet, pub, token, rp.InvoiceParams{Msatoshi: 2000, Expiry: &expiry})
+	if !errors.Is(err, ErrExpiryTooLong) {
+		t.Errorf("got %v, wanted %v", err, ErrExpiryTooLong)
+	}
+}
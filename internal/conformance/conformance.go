@@ -0,0 +1,157 @@
+// Package conformance checks that a backend behaves like the Wallet interface
+// says against real nodes, where payer must be able to pay invoices made by
+// payee. It adds to walletest what needs two nodes.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/walletest"
+)
+
+// Timeout bounds each wait for a payment or a stream event.
+var Timeout = 30 * time.Second
+
+func Run(t *testing.T, payer, payee rp.Wallet) {
+	t.Run("GetInfo", func(t *testing.T) { getInfo(t, payer) })
+	t.Run("Health", func(t *testing.T) { health(t, payee) })
+	t.Run("Wallet", func(t *testing.T) {
+		walletest.Run(t, func() rp.Wallet { return payee })
+	})
+	t.Run("Pay", func(t *testing.T) { pay(t, payer, payee) })
+	t.Run("CancelInvoice", func(t *testing.T) { cancelInvoice(t, payer, payee) })
+}
+
+func getInfo(t *testing.T, w rp.Wallet) {
+	info, err := w.GetInfo()
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if info.Balance <= 0 {
+		t.Errorf("got %d, wanted the payer to have a balance", info.Balance)
+	}
+}
+
+func health(t *testing.T, w rp.Wallet) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	status, err := w.Health(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if !status.Connected || !status.SyncedToChain {
+		t.Errorf("got %+v, wanted connected and synced", status)
+	}
+}
+
+func pay(t *testing.T, payer, payee rp.Wallet) {
+	invoices, err := payee.PaidInvoicesStream()
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	payments, err := payer.PaymentsStream()
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	inv, err := payee.CreateInvoice(rp.InvoiceParams{Msatoshi: 21000, Description: "conformance"})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	status, err := payee.GetInvoiceStatus(inv.CheckingID)
+	if err != nil || !status.Exists || status.Paid {
+		t.Fatalf("got %v, %v, wanted an unpaid invoice", status, err)
+	}
+
+	payment, err := payer.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	select {
+	case paid := <-waitInvoice(invoices, inv.CheckingID):
+		if !paid.Paid || paid.MSatoshiReceived != 21000 {
+			t.Errorf("got %v, wanted 21000 msat received", paid)
+		}
+	case <-time.After(Timeout):
+		t.Fatalf("got no paid invoice event after %v", Timeout)
+	}
+	select {
+	case done := <-waitPayment(payments, payment.CheckingID):
+		if done.Status != rp.Complete || done.Preimage != inv.Preimage {
+			t.Errorf("got %v, wanted it complete with preimage %s", done, inv.Preimage)
+		}
+	case <-time.After(Timeout):
+		t.Fatalf("got no complete payment event after %v", Timeout)
+	}
+
+	if status, err := payee.GetInvoiceStatus(inv.CheckingID); err != nil || !status.Paid {
+		t.Errorf("got %v, %v, wanted the invoice paid", status, err)
+	}
+	if status, err := payer.GetPaymentStatus(payment.CheckingID); err != nil || status.Status != rp.Complete {
+		t.Errorf("got %v, %v, wanted the payment complete", status, err)
+	}
+}
+
+func cancelInvoice(t *testing.T, payer, payee rp.Wallet) {
+	inv, err := payee.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	err = payee.CancelInvoice(inv.CheckingID)
+	if errors.Is(err, rp.ErrUnsupported) {
+		t.Skip("the backend can't cancel invoices")
+	}
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if status, _ := payee.GetInvoiceStatus(inv.CheckingID); !status.Canceled {
+		t.Errorf("got %v, wanted the invoice canceled", status)
+	}
+
+	payment, err := payer.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if err != nil {
+		return // refused right away
+	}
+	deadline := time.Now().Add(Timeout)
+	for time.Now().Before(deadline) {
+		status, err := payer.GetPaymentStatus(payment.CheckingID)
+		if err == nil && status.Status == rp.Failed {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+	t.Errorf("got the payment of a canceled invoice not failing after %v", Timeout)
+}
+
+func waitInvoice(stream <-chan rp.InvoiceStatus, checkingID string) <-chan rp.InvoiceStatus {
+	found := make(chan rp.InvoiceStatus, 1)
+	go func() {
+		for status := range stream {
+			if status.CheckingID == checkingID {
+				found <- status
+				return
+			}
+		}
+	}()
+	return found
+}
+
+func waitPayment(stream <-chan rp.PaymentStatus, checkingID string) <-chan rp.PaymentStatus {
+	found := make(chan rp.PaymentStatus, 1)
+	go func() {
+		for status := range stream {
+			if status.CheckingID == checkingID && status.Status != rp.Pending {
+				found <- status
+				return
+			}
+		}
+	}()
+	return found
+}
@@ -0,0 +1,36 @@
+// Package sqldialect holds what the SQLStores share to run the same queries on
+// sqlite and postgres.
+package sqldialect
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Check fails for dialects other than "sqlite" and "postgres".
+func Check(dialect string) error {
+	if dialect != "sqlite" && dialect != "postgres" {
+		return fmt.Errorf("unsupported dialect '%s'", dialect)
+	}
+	return nil
+}
+
+// Rebind replaces ? placeholders with $n ones for postgres.
+func Rebind(dialect string, query string) string {
+	if dialect != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,16 @@
+package sqldialect
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	query := `SELECT a FROM t WHERE b = ? AND c = ?`
+	if got := Rebind("sqlite", query); got != query {
+		t.Errorf("got %s, wanted %s", got, query)
+	}
+	if got, want := Rebind("postgres", query), `SELECT a FROM t WHERE b = $1 AND c = $2`; got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+	if err := Check("mysql"); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+}
@@ -0,0 +1,149 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrUnbalanced = errors.New("postings don't add up to zero")
+
+// Posting moves Msatoshi into Account, or out of it when negative.
+type Posting struct {
+	Account  string `json:"account"`
+	Msatoshi int64  `json:"msatoshi"`
+}
+
+// Transaction is a set of postings that add up to zero, so money is never
+// created or lost, only moved between accounts.
+type Transaction struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Memo     string    `json:"memo,omitempty"`
+	Postings []Posting `json:"postings"`
+}
+
+type Store interface {
+	// Post saves all postings of the transaction or none.
+	Post(tx Transaction) error
+
+	// BalanceAt is the sum of the postings to account up to and including t.
+	BalanceAt(account string, t time.Time) (int64, error)
+}
+
+// Ledger is a double-entry ledger with one account per tenant, plus whatever
+// accounts the money comes from and goes to, like the node or fees.
+type Ledger struct {
+	store Store
+}
+
+// New uses an in-memory store when store is nil.
+func New(store Store) *Ledger {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Ledger{store: store}
+}
+
+func (l *Ledger) Post(tx Transaction) error {
+	if tx.ID == "" {
+		return errors.New("transaction id is required")
+	}
+	if len(tx.Postings) < 2 {
+		return fmt.Errorf("%w: transaction %s needs at least two postings", ErrUnbalanced, tx.ID)
+	}
+	var sum int64
+	for _, posting := range tx.Postings {
+		sum += posting.Msatoshi
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: transaction %s is off by %d msat", ErrUnbalanced, tx.ID, sum)
+	}
+	if tx.Time.IsZero() {
+		tx.Time = time.Now()
+	}
+
+	return l.store.Post(tx)
+}
+
+// BalanceAt is what the tenant had at time t, so past balances can be
+// answered without restoring backups.
+func (l *Ledger) BalanceAt(tenant string, t time.Time) (int64, error) {
+	return l.store.BalanceAt(tenant, t)
+}
+
+func (l *Ledger) Balance(tenant string) (int64, error) {
+	return l.store.BalanceAt(tenant, time.Now())
+}
+
+// MemoryStore keeps, for each account, its postings sorted by time with the
+// balance after each one, so BalanceAt is a binary search.
+type MemoryStore struct {
+	mu       sync.Mutex
+	accounts map[string][]point
+	seen     map[string]bool
+}
+
+type point struct {
+	time    time.Time
+	balance int64 // after this posting
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: make(map[string][]point),
+		seen:     make(map[string]bool),
+	}
+}
+
+func (m *MemoryStore) Post(tx Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.seen[tx.ID] {
+		return fmt.Errorf("transaction %s was already posted", tx.ID)
+	}
+	m.seen[tx.ID] = true
+
+	for _, posting := range tx.Postings {
+		points := m.accounts[posting.Account]
+
+		// after every posting at the same time, to keep the posting order
+		i := sort.Search(len(points), func(i int) bool {
+			return points[i].time.After(tx.Time)
+		})
+		var before int64
+		if i > 0 {
+			before = points[i-1].balance
+		}
+
+		points = append(points, point{})
+		copy(points[i+1:], points[i:])
+		points[i] = point{time: tx.Time, balance: before + posting.Msatoshi}
+
+		// backdated postings change every balance after them
+		for j := i + 1; j < len(points); j++ {
+			points[j].balance += posting.Msatoshi
+		}
+
+		m.accounts[posting.Account] = points
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) BalanceAt(account string, t time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	points := m.accounts[account]
+	i := sort.Search(len(points), func(i int) bool {
+		return points[i].time.After(t)
+	})
+	if i == 0 {
+		return 0, nil
+	}
+	return points[i-1].balance, nil
+}
@@ -0,0 +1,52 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBalanceAt(t *testing.T) {
+	l := New(nil)
+	monday := time.Date(2022, 1, 3, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	post := func(id string, at time.Time, msatoshi int64) {
+		err := l.Post(Transaction{ID: id, Time: at, Postings: []Posting{
+			{Account: "node", Msatoshi: -msatoshi},
+			{Account: "alice", Msatoshi: msatoshi},
+		}})
+		if err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+	}
+	post("deposit", monday, 5000)
+	post("withdrawal", monday.Add(2*day), -2000)
+	post("backdated", monday.Add(day), 1000)
+
+	for _, tc := range []struct {
+		at   time.Time
+		want int64
+	}{
+		{monday.Add(-time.Second), 0},
+		{monday, 5000},
+		{monday.Add(day), 6000},
+		{monday.Add(2 * day), 4000},
+		{monday.Add(30 * day), 4000},
+	} {
+		if got, _ := l.BalanceAt("alice", tc.at); got != tc.want {
+			t.Errorf("got %v, wanted %v at %s", got, tc.want, tc.at)
+		}
+	}
+	if got, _ := l.BalanceAt("node", monday.Add(30*day)); got != -4000 {
+		t.Errorf("got %v, wanted %v", got, -4000)
+	}
+
+	err := l.Post(Transaction{ID: "broken", Postings: []Posting{
+		{Account: "node", Msatoshi: -1000},
+		{Account: "alice", Msatoshi: 999},
+	}})
+	if !errors.Is(err, ErrUnbalanced) {
+		t.Errorf("got %v, wanted %v", err, ErrUnbalanced)
+	}
+}
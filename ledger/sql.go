@@ -0,0 +1,127 @@
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lnbits/relampago/internal/sqldialect"
+)
+
+// SQLStore keeps postings in a table on any database/sql database. The
+// driver must be registered by the caller, both "sqlite" and "postgres"
+// dialects are supported.
+//
+// Each row stores the account balance after it and rows are indexed by
+// account and time, so BalanceAt reads a single row however many postings
+// the account has. seq orders postings made at the same time.
+//
+// As every posting depends on the balances before it, transactions are posted
+// one at a time. On postgres the table is locked so other processes posting to
+// it wait too, on sqlite their posts fail with a busy error instead.
+type SQLStore struct {
+	db      *sql.DB
+	table   string
+	dialect string
+
+	mu sync.Mutex
+}
+
+func NewSQLStore(db *sql.DB, dialect string, table string) (*SQLStore, error) {
+	if err := sqldialect.Check(dialect); err != nil {
+		return nil, err
+	}
+	if table == "" {
+		table = "relampago_ledger_postings"
+	}
+
+	s := &SQLStore{db: db, table: table, dialect: dialect}
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS ` + table + ` (
+  seq BIGINT NOT NULL UNIQUE,
+  tx_id TEXT NOT NULL,
+  account TEXT NOT NULL,
+  msatoshi BIGINT NOT NULL,
+  balance BIGINT NOT NULL,
+  posted_at BIGINT NOT NULL,
+  memo TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (tx_id, account)
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + table + `_account_time ON ` +
+		table + ` (account, posted_at, seq)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index on %s: %w", table, err)
+	}
+
+	return s, nil
+}
+
+func (s *SQLStore) Post(tx Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dbtx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	if s.dialect == "postgres" {
+		// conflicts with itself but not with reads
+		_, err := dbtx.Exec(`LOCK TABLE ` + s.table + ` IN SHARE ROW EXCLUSIVE MODE`)
+		if err != nil {
+			return fmt.Errorf("failed to lock %s: %w", s.table, err)
+		}
+	}
+
+	postedAt := tx.Time.UnixNano()
+	for _, posting := range tx.Postings {
+		var before int64
+		err := dbtx.QueryRow(s.rebind(`
+SELECT balance FROM `+s.table+` WHERE account = ? AND posted_at <= ?
+ORDER BY posted_at DESC, seq DESC LIMIT 1`), posting.Account, postedAt).Scan(&before)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to get balance of %s: %w", posting.Account, err)
+		}
+
+		// backdated postings change every balance after them
+		_, err = dbtx.Exec(s.rebind(`
+UPDATE `+s.table+` SET balance = balance + ? WHERE account = ? AND posted_at > ?`),
+			posting.Msatoshi, posting.Account, postedAt)
+		if err != nil {
+			return fmt.Errorf("failed to update balances of %s: %w", posting.Account, err)
+		}
+
+		_, err = dbtx.Exec(s.rebind(`
+INSERT INTO `+s.table+` (seq, tx_id, account, msatoshi, balance, posted_at, memo)
+VALUES ((SELECT COALESCE(MAX(seq), 0) + 1 FROM `+s.table+`), ?, ?, ?, ?, ?, ?)`),
+			tx.ID, posting.Account, posting.Msatoshi, before+posting.Msatoshi, postedAt, tx.Memo)
+		if err != nil {
+			return fmt.Errorf("failed to insert posting %s of %s: %w", tx.ID, posting.Account, err)
+		}
+	}
+
+	return dbtx.Commit()
+}
+
+func (s *SQLStore) BalanceAt(account string, t time.Time) (int64, error) {
+	var balance int64
+	err := s.db.QueryRow(s.rebind(`
+SELECT balance FROM `+s.table+` WHERE account = ? AND posted_at <= ?
+ORDER BY posted_at DESC, seq DESC LIMIT 1`), account, t.UnixNano()).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get balance of %s: %w", account, err)
+	}
+	return balance, nil
+}
+
+func (s *SQLStore) rebind(query string) string {
+	return sqldialect.Rebind(s.dialect, query)
+}
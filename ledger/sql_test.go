@@ -0,0 +1,100 @@
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func testSQLStore(t *testing.T) *SQLStore {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "ledger.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s, err := NewSQLStore(db, "sqlite", "")
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	return s
+}
+
+func TestSQLStore_BalanceAt(t *testing.T) {
+	l := New(testSQLStore(t))
+	monday := time.Date(2022, 1, 3, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	post := func(id string, at time.Time, msatoshi int64) {
+		err := l.Post(Transaction{ID: id, Time: at, Postings: []Posting{
+			{Account: "node", Msatoshi: -msatoshi},
+			{Account: "alice", Msatoshi: msatoshi},
+		}})
+		if err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+	}
+	post("deposit", monday, 5000)
+	post("withdrawal", monday.Add(2*day), -2000)
+	post("backdated", monday.Add(day), 1000)
+
+	for _, tc := range []struct {
+		at   time.Time
+		want int64
+	}{
+		{monday.Add(-time.Second), 0},
+		{monday, 5000},
+		{monday.Add(day), 6000},
+		{monday.Add(2 * day), 4000},
+	} {
+		if got, _ := l.BalanceAt("alice", tc.at); got != tc.want {
+			t.Errorf("got %v, wanted %v at %s", got, tc.want, tc.at)
+		}
+	}
+}
+
+func TestSQLStore_ConcurrentPosts(t *testing.T) {
+	s := testSQLStore(t)
+	start := time.Date(2022, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// every other one backdated before the ones already posted
+			at := start.Add(time.Duration(i) * time.Minute)
+			if i%2 == 1 {
+				at = start.Add(-time.Duration(i) * time.Minute)
+			}
+			errs <- s.Post(Transaction{ID: fmt.Sprint(i), Time: at, Postings: []Posting{
+				{Account: "node", Msatoshi: -1000},
+				{Account: "alice", Msatoshi: 1000},
+			}})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+	}
+
+	if got, _ := s.BalanceAt("alice", start.Add(time.Hour)); got != 20000 {
+		t.Errorf("got %v, wanted %v", got, 20000)
+	}
+	if got, _ := s.BalanceAt("node", start.Add(time.Hour)); got != -20000 {
+		t.Errorf("got %v, wanted %v", got, -20000)
+	}
+	// the balance of each row is the sum of the postings up to it
+	if got, _ := s.BalanceAt("alice", start); got != 11000 {
+		t.Errorf("got %v, wanted %v", got, 11000)
+	}
+}
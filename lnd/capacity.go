@@ -0,0 +1,67 @@
+package lnd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.OutboundCapacity
+var _ rp.OutboundCapacity = (*LndWallet)(nil)
+
+func (l *LndWallet) SpendableMsatoshi() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.ListChannels(ctx, &lnrpc.ListChannelsRequest{ActiveOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("error calling ListChannels: %w", err)
+	}
+	return SpendableMsatoshi(res.Channels), nil
+}
+
+func (l *LndWallet) CanSend(msatoshi int64) (bool, error) {
+	spendable, err := l.SpendableMsatoshi()
+	if err != nil {
+		return false, err
+	}
+	return msatoshi <= spendable, nil
+}
+
+// Compile time check to ensure that LndWallet implements rp.ChannelLister
+var _ rp.ChannelLister = (*LndWallet)(nil)
+
+func (l *LndWallet) ListChannels() ([]rp.Channel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.ListChannels(ctx, &lnrpc.ListChannelsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error calling ListChannels: %w", err)
+	}
+	channels := make([]rp.Channel, len(res.Channels))
+	for i, channel := range res.Channels {
+		channels[i] = ChannelToRP(channel)
+	}
+	return channels, nil
+}
+
+// SpendableMsatoshi sums what can be sent through each channel, which is its
+// local balance, already without pending htlcs and commitment fees, minus the
+// reserve the peer requires from us.
+func SpendableMsatoshi(channels []*lnrpc.Channel) int64 {
+	var spendable int64
+	for _, channel := range channels {
+		reserve := channel.LocalChanReserveSat
+		if c := channel.LocalConstraints; c != nil {
+			reserve = int64(c.ChanReserveSat)
+		}
+		if available := channel.LocalBalance - reserve; available > 0 {
+			spendable += available * 1000
+		}
+	}
+	return spendable
+}
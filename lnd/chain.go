@@ -0,0 +1,61 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/chainrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.ChainWatcher
+var _ rp.ChainWatcher = (*LndWallet)(nil)
+
+func (l *LndWallet) BlockHeight() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return 0, fmt.Errorf("error calling GetInfo: %w", err)
+	}
+
+	return int64(res.BlockHeight), nil
+}
+
+// BlockStream uses the chain notifier, so lnd must be built with the chainrpc
+// tag, as it is in the release binaries.
+func (l *LndWallet) BlockStream(ctx context.Context) (<-chan rp.BlockEpoch, error) {
+	stream, err := l.Chain.RegisterBlockEpochNtfn(ctx, &chainrpc.BlockEpoch{})
+	if err != nil {
+		return nil, fmt.Errorf("error calling RegisterBlockEpochNtfn: %w", err)
+	}
+
+	listener := make(chan rp.BlockEpoch)
+	go func() {
+		defer close(listener)
+		for {
+			epoch, err := stream.Recv()
+			if err != nil {
+				return
+			}
+
+			// lnd sends the hash in the internal byte order
+			hash := make([]byte, len(epoch.Hash))
+			for i, b := range epoch.Hash {
+				hash[len(hash)-1-i] = b
+			}
+
+			select {
+			case listener <- rp.BlockEpoch{Height: int64(epoch.Height), Hash: hex.EncodeToString(hash)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return listener, nil
+}
@@ -0,0 +1,29 @@
+package lnd
+
+import (
+	"net"
+	"strings"
+)
+
+// ConnectCloud connects to lnd run by a hosting provider, like Voltage, given
+// the node's API endpoint and a hex-encoded macaroon. The endpoint can be a url
+// as copied from the provider's dashboard, the grpc port 10009 is used when it
+// has none. TLS is verified against the system roots, so no cert is needed.
+func ConnectCloud(endpoint string, macaroonHex string, opts ...Option) (*LndWallet, error) {
+	opts = append([]Option{WithSystemCerts(), WithMacaroonHex(macaroonHex)}, opts...)
+	return Connect(cloudHost(endpoint), opts...)
+}
+
+func cloudHost(endpoint string) string {
+	host := strings.TrimSpace(endpoint)
+	if i := strings.Index(host, "://"); i != -1 {
+		host = host[i+3:]
+	}
+	if i := strings.Index(host, "/"); i != -1 {
+		host = host[:i]
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "10009")
+	}
+	return host
+}
@@ -0,0 +1,342 @@
+package lnd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// The conversions between lnd and relampago types, for apps that call lnd
+// directly too and want the same results as the backend.
+
+// InvoiceToStatus converts an invoice from lnd, as returned by LookupInvoice
+// or SubscribeInvoices, the way the backend does. The checking id is the hex
+// payment hash.
+func InvoiceToStatus(invoice *lnrpc.Invoice) rp.InvoiceStatus {
+	status := rp.InvoiceStatus{
+		CheckingID:       hex.EncodeToString(invoice.RHash),
+		Exists:           true,
+		Paid:             invoice.State == lnrpc.Invoice_SETTLED,
+		Held:             invoice.State == lnrpc.Invoice_ACCEPTED,
+		Canceled:         invoice.State == lnrpc.Invoice_CANCELED,
+		Expired:          invoice.State == lnrpc.Invoice_CANCELED && invoiceExpired(invoice),
+		MSatoshiReceived: invoice.AmtPaidMsat,
+		Msatoshi:         invoice.ValueMsat,
+		Description:      invoice.Memo,
+		SettleIndex:      invoice.SettleIndex,
+		SettledAt:        unixTime(invoice.SettleDate),
+	}
+	if status.Paid {
+		status.Settlements = 1
+		status.Preimage = hex.EncodeToString(invoice.RPreimage)
+	}
+
+	// AMP invoices stay open to be paid again, every payment is a set of htlcs
+	// settled on its own
+	if set, ok := latestAMPSettlement(invoice); ok {
+		status.Paid = true
+		status.SettleIndex = set.SettleIndex
+		status.SettledAt = unixTime(set.SettleTime)
+		for _, set := range invoice.AmpInvoiceState {
+			if set.State == lnrpc.InvoiceHTLCState_SETTLED {
+				status.Settlements++
+			}
+		}
+	}
+	return status
+}
+
+func latestAMPSettlement(invoice *lnrpc.Invoice) (*lnrpc.AMPInvoiceState, bool) {
+	var latest *lnrpc.AMPInvoiceState
+	for _, set := range invoice.AmpInvoiceState {
+		if set.State == lnrpc.InvoiceHTLCState_SETTLED && (latest == nil || set.SettleIndex > latest.SettleIndex) {
+			latest = set
+		}
+	}
+	return latest, latest != nil
+}
+
+// invoiceSettlement is the stream event for the last time the invoice was
+// paid, which for AMP invoices only has the amount of that payment.
+func invoiceSettlement(invoice *lnrpc.Invoice) (rp.InvoiceStatus, bool) {
+	status := InvoiceToStatus(invoice)
+	if set, ok := latestAMPSettlement(invoice); ok {
+		status.MSatoshiReceived = set.AmtPaidMsat
+	}
+	return status, status.Paid
+}
+
+// InvoiceToHTLCs converts the settled htlcs of an invoice.
+func InvoiceToHTLCs(invoice *lnrpc.Invoice) []rp.InvoiceHTLC {
+	var htlcs []rp.InvoiceHTLC
+	for _, htlc := range invoice.Htlcs {
+		if htlc.State != lnrpc.InvoiceHTLCState_SETTLED {
+			continue
+		}
+		converted := rp.InvoiceHTLC{
+			Msatoshi:  int64(htlc.AmtMsat),
+			SettledAt: unixTime(htlc.ResolveTime),
+		}
+		if htlc.Amp != nil {
+			converted.SetID = hex.EncodeToString(htlc.Amp.SetId)
+		}
+		htlcs = append(htlcs, converted)
+	}
+	return htlcs
+}
+
+// invoiceExpired tells apart the invoices lnd canceled as they expired from
+// the ones canceled before, which look the same otherwise.
+func invoiceExpired(invoice *lnrpc.Invoice) bool {
+	if invoice.CreationDate == 0 || invoice.Expiry == 0 {
+		return false
+	}
+	return !time.Now().Before(time.Unix(invoice.CreationDate+invoice.Expiry, 0))
+}
+
+// paymentResolvedAt is when the last htlc of the payment was resolved.
+func paymentResolvedAt(payment *lnrpc.Payment) time.Time {
+	var last int64
+	for _, htlc := range payment.Htlcs {
+		if htlc.ResolveTimeNs > last {
+			last = htlc.ResolveTimeNs
+		}
+	}
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
+// PaymentToStatus converts a payment from lnd, as returned by ListPayments or
+// TrackPaymentV2, the way the backend does. Payments that failed without
+// sending any htlc were never tried.
+func PaymentToStatus(payment *lnrpc.Payment) rp.PaymentStatus {
+	status := rp.FillPaymentDetails(rp.PaymentStatus{
+		CheckingID: payment.PaymentHash,
+		Status:     rp.Unknown,
+		FeePaid:    0,
+		Preimage:   "",
+		Msatoshi:   payment.ValueMsat,
+	}, payment.PaymentRequest)
+
+	switch payment.Status {
+	case lnrpc.Payment_IN_FLIGHT:
+		status.Status = rp.Pending
+		return status
+	case lnrpc.Payment_FAILED:
+		if len(payment.Htlcs) == 0 {
+			status.Status = rp.NeverTried
+		} else {
+			status.Status = rp.Failed
+			status.ResolvedAt = paymentResolvedAt(payment)
+		}
+		status.FailureReason = FailureReasonToRP(payment.FailureReason)
+		return status
+	case lnrpc.Payment_SUCCEEDED:
+		status.Status = rp.Complete
+		status.FeePaid = payment.FeeMsat
+		status.Preimage = payment.PaymentPreimage
+		status.ResolvedAt = paymentResolvedAt(payment)
+		return status
+	default:
+		return status
+	}
+}
+
+// FailureReasonToRP converts the reason lnd gives for a failed payment.
+func FailureReasonToRP(reason lnrpc.PaymentFailureReason) rp.FailureReason {
+	switch reason {
+	case lnrpc.PaymentFailureReason_FAILURE_REASON_TIMEOUT:
+		return rp.FailureTimeout
+	case lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE:
+		return rp.FailureNoRoute
+	case lnrpc.PaymentFailureReason_FAILURE_REASON_INSUFFICIENT_BALANCE:
+		return rp.FailureInsufficientBalance
+	case lnrpc.PaymentFailureReason_FAILURE_REASON_INCORRECT_PAYMENT_DETAILS:
+		return rp.FailureIncorrectPaymentDetails
+	case lnrpc.PaymentFailureReason_FAILURE_REASON_ERROR:
+		return rp.FailureError
+	}
+	return ""
+}
+
+// TransactionToOnchain converts an on-chain transaction from lnd, as returned
+// by GetTransactions or SubscribeTransactions.
+func TransactionToOnchain(tx *lnrpc.Transaction) rp.OnchainTransaction {
+	return rp.OnchainTransaction{
+		TxID:          tx.TxHash,
+		Amount:        tx.Amount,
+		Fee:           tx.TotalFees,
+		Confirmations: tx.NumConfirmations,
+		BlockHeight:   tx.BlockHeight,
+		Addresses:     tx.DestAddresses,
+	}
+}
+
+// ChannelEventToEvent converts a channel opening or closing from
+// SubscribeChannelEvents, other updates aren't events and return false.
+func ChannelEventToEvent(update *lnrpc.ChannelEventUpdate) (rp.Event, bool) {
+	switch update.Type {
+	case lnrpc.ChannelEventUpdate_OPEN_CHANNEL:
+		channel := update.GetOpenChannel()
+		return rp.Event{
+			Type: rp.ChannelOpened,
+			Time: time.Now(),
+			Channel: &rp.ChannelInfo{
+				ID:          strconv.FormatUint(channel.ChanId, 10),
+				Peer:        channel.RemotePubkey,
+				CapacitySat: channel.Capacity,
+			},
+		}, true
+	case lnrpc.ChannelEventUpdate_CLOSED_CHANNEL:
+		channel := update.GetClosedChannel()
+		return rp.Event{
+			Type: rp.ChannelClosed,
+			Time: time.Now(),
+			Channel: &rp.ChannelInfo{
+				ID:          strconv.FormatUint(channel.ChanId, 10),
+				Peer:        channel.RemotePubkey,
+				CapacitySat: channel.Capacity,
+			},
+		}, true
+	}
+	return rp.Event{}, false
+}
+
+// RouteHintsToLnd converts route hints for AddInvoice, with short channel ids
+// either like 700000x1x0 or as the integer lnd uses.
+func RouteHintsToLnd(hints [][]rp.HopHint) ([]*lnrpc.RouteHint, error) {
+	var routeHints []*lnrpc.RouteHint
+	for _, hint := range hints {
+		routeHint := &lnrpc.RouteHint{}
+		for _, hop := range hint {
+			chanID, err := ShortChannelIDToLnd(hop.ShortChannelID)
+			if err != nil {
+				return nil, err
+			}
+			routeHint.HopHints = append(routeHint.HopHints, &lnrpc.HopHint{
+				NodeId:                    hop.NodeID,
+				ChanId:                    chanID,
+				FeeBaseMsat:               uint32(hop.FeeBaseMsatoshi),
+				FeeProportionalMillionths: uint32(hop.FeeProportionalMillionths),
+				CltvExpiryDelta:           hop.CltvExpiryDelta,
+			})
+		}
+		routeHints = append(routeHints, routeHint)
+	}
+	return routeHints, nil
+}
+
+// ShortChannelIDFromLnd formats the integer lnd uses for channels like
+// 700000x1x0.
+func ShortChannelIDFromLnd(id uint64) string {
+	return fmt.Sprintf("%dx%dx%d", id>>40, id>>16&0xffffff, id&0xffff)
+}
+
+func ShortChannelIDToLnd(scid string) (uint64, error) {
+	parts := strings.Split(scid, "x")
+	if len(parts) == 1 {
+		id, err := strconv.ParseUint(scid, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid short channel id '%s'", rp.ErrInvalidParams, scid)
+		}
+		return id, nil
+	}
+
+	// block height, transaction index and output index
+	var n [3]uint64
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("%w: invalid short channel id '%s'", rp.ErrInvalidParams, scid)
+	}
+	for i, bits := range []int{24, 24, 16} {
+		v, err := strconv.ParseUint(parts[i], 10, bits)
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid short channel id '%s'", rp.ErrInvalidParams, scid)
+		}
+		n[i] = v
+	}
+	return n[0]<<40 | n[1]<<16 | n[2], nil
+}
+
+// ChannelToRP converts a channel from ListChannels.
+func ChannelToRP(channel *lnrpc.Channel) rp.Channel {
+	return rp.Channel{
+		ChannelInfo: rp.ChannelInfo{
+			ID:          strconv.FormatUint(channel.ChanId, 10),
+			Peer:        channel.RemotePubkey,
+			CapacitySat: channel.Capacity,
+		},
+		Active:         channel.Active,
+		LocalMsatoshi:  channel.LocalBalance * 1000,
+		RemoteMsatoshi: channel.RemoteBalance * 1000,
+	}
+}
+
+// LightningNodeToGraph converts a node from GetNodeInfo or DescribeGraph.
+func LightningNodeToGraph(node *lnrpc.LightningNode) rp.GraphNode {
+	graphNode := rp.GraphNode{
+		Pubkey: node.PubKey,
+		Alias:  node.Alias,
+		Color:  node.Color,
+	}
+	for _, address := range node.Addresses {
+		graphNode.Addresses = append(graphNode.Addresses, address.Addr)
+	}
+	if node.LastUpdate != 0 {
+		graphNode.LastUpdate = time.Unix(int64(node.LastUpdate), 0)
+	}
+	return graphNode
+}
+
+// ChannelEdgeToGraph converts a channel from GetChanInfo or DescribeGraph.
+func ChannelEdgeToGraph(edge *lnrpc.ChannelEdge) rp.GraphChannel {
+	return rp.GraphChannel{
+		ShortChannelID: ShortChannelIDFromLnd(edge.ChannelId),
+		Node1:          edge.Node1Pub,
+		Node2:          edge.Node2Pub,
+		CapacitySat:    edge.Capacity,
+		Node1Policy:    RoutingPolicyToRP(edge.Node1Policy),
+		Node2Policy:    RoutingPolicyToRP(edge.Node2Policy),
+	}
+}
+
+// ChannelPolicyToRP picks the policy of the node from the edge of one of its
+// channels, it is false when the node hasn't set one yet.
+func ChannelPolicyToRP(channel *lnrpc.Channel, edge *lnrpc.ChannelEdge) (rp.ChannelPolicy, bool) {
+	policy := edge.Node1Policy
+	if edge.Node1Pub == channel.RemotePubkey {
+		policy = edge.Node2Policy
+	}
+	if policy == nil {
+		return rp.ChannelPolicy{}, false
+	}
+	return rp.ChannelPolicy{
+		ChannelInfo:   ChannelToRP(channel).ChannelInfo,
+		ChannelPoint:  channel.ChannelPoint,
+		RoutingPolicy: *RoutingPolicyToRP(policy),
+	}, true
+}
+
+func RoutingPolicyToRP(policy *lnrpc.RoutingPolicy) *rp.RoutingPolicy {
+	if policy == nil {
+		return nil
+	}
+	converted := &rp.RoutingPolicy{
+		FeeBaseMsatoshi:           policy.FeeBaseMsat,
+		FeeProportionalMillionths: policy.FeeRateMilliMsat,
+		TimeLockDelta:             policy.TimeLockDelta,
+		MinHtlcMsatoshi:           policy.MinHtlc,
+		MaxHtlcMsatoshi:           int64(policy.MaxHtlcMsat),
+		Disabled:                  policy.Disabled,
+	}
+	if policy.LastUpdate != 0 {
+		converted.LastUpdate = time.Unix(int64(policy.LastUpdate), 0)
+	}
+	return converted
+}
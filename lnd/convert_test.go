@@ -0,0 +1,261 @@
+package lnd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+func TestInvoiceToStatus(t *testing.T) {
+	hash := []byte{0xab, 0xcd}
+	for _, c := range []struct {
+		name    string
+		invoice *lnrpc.Invoice
+		want    rp.InvoiceStatus
+	}{
+		{
+			name:    "open",
+			invoice: &lnrpc.Invoice{RHash: hash, Memo: "coffee", State: lnrpc.Invoice_OPEN},
+			want:    rp.InvoiceStatus{CheckingID: "abcd", Exists: true, Description: "coffee"},
+		},
+		{
+			name: "settled",
+			invoice: &lnrpc.Invoice{
+				RHash: hash, State: lnrpc.Invoice_SETTLED,
+				AmtPaidMsat: 5000, SettleIndex: 7, SettleDate: 1600000000,
+			},
+			want: rp.InvoiceStatus{
+				CheckingID: "abcd", Exists: true, Paid: true, Settlements: 1,
+				MSatoshiReceived: 5000, SettleIndex: 7, SettledAt: time.Unix(1600000000, 0),
+			},
+		},
+		{
+			name: "overpaid",
+			invoice: &lnrpc.Invoice{
+				RHash: hash, State: lnrpc.Invoice_SETTLED, ValueMsat: 5000, AmtPaidMsat: 6000,
+			},
+			want: rp.InvoiceStatus{
+				CheckingID: "abcd", Exists: true, Paid: true, Settlements: 1,
+				Msatoshi: 5000, MSatoshiReceived: 6000,
+			},
+		},
+		{
+			name: "amp paid twice",
+			invoice: &lnrpc.Invoice{
+				RHash: hash, State: lnrpc.Invoice_OPEN, IsAmp: true, AmtPaidMsat: 3000,
+				AmpInvoiceState: map[string]*lnrpc.AMPInvoiceState{
+					"01": {State: lnrpc.InvoiceHTLCState_SETTLED, SettleIndex: 4, SettleTime: 1600000000, AmtPaidMsat: 1000},
+					"02": {State: lnrpc.InvoiceHTLCState_SETTLED, SettleIndex: 9, SettleTime: 1600000100, AmtPaidMsat: 2000},
+				},
+			},
+			want: rp.InvoiceStatus{
+				CheckingID: "abcd", Exists: true, Paid: true, Settlements: 2,
+				MSatoshiReceived: 3000, SettleIndex: 9, SettledAt: time.Unix(1600000100, 0),
+			},
+		},
+		{
+			name:    "canceled",
+			invoice: &lnrpc.Invoice{RHash: hash, State: lnrpc.Invoice_CANCELED},
+			want:    rp.InvoiceStatus{CheckingID: "abcd", Exists: true, Canceled: true},
+		},
+		{
+			name: "expired",
+			invoice: &lnrpc.Invoice{
+				RHash: hash, State: lnrpc.Invoice_CANCELED,
+				CreationDate: 1600000000, Expiry: 3600,
+			},
+			want: rp.InvoiceStatus{CheckingID: "abcd", Exists: true, Canceled: true, Expired: true},
+		},
+		{
+			name:    "held",
+			invoice: &lnrpc.Invoice{RHash: hash, State: lnrpc.Invoice_ACCEPTED},
+			want:    rp.InvoiceStatus{CheckingID: "abcd", Exists: true, Held: true},
+		},
+	} {
+		if got := InvoiceToStatus(c.invoice); got != c.want {
+			t.Errorf("%s: got %+v, wanted %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestInvoiceSettlement_AMP(t *testing.T) {
+	invoice := &lnrpc.Invoice{
+		RHash: []byte{0xab}, State: lnrpc.Invoice_OPEN, IsAmp: true, AmtPaidMsat: 3000,
+		AmpInvoiceState: map[string]*lnrpc.AMPInvoiceState{
+			"01": {State: lnrpc.InvoiceHTLCState_SETTLED, SettleIndex: 4, AmtPaidMsat: 1000},
+			"02": {State: lnrpc.InvoiceHTLCState_SETTLED, SettleIndex: 9, AmtPaidMsat: 2000},
+		},
+	}
+	status, ok := invoiceSettlement(invoice)
+	if !ok || status.MSatoshiReceived != 2000 || status.SettleIndex != 9 {
+		t.Errorf("got %+v, wanted the second settlement only", status)
+	}
+}
+
+func TestInvoiceToHTLCs(t *testing.T) {
+	invoice := &lnrpc.Invoice{Htlcs: []*lnrpc.InvoiceHTLC{
+		{AmtMsat: 1000, State: lnrpc.InvoiceHTLCState_SETTLED, ResolveTime: 1600000000},
+		{AmtMsat: 500, State: lnrpc.InvoiceHTLCState_CANCELED},
+		{AmtMsat: 2000, State: lnrpc.InvoiceHTLCState_SETTLED, Amp: &lnrpc.AMP{SetId: []byte{2}}},
+	}}
+	want := []rp.InvoiceHTLC{
+		{Msatoshi: 1000, SettledAt: time.Unix(1600000000, 0)},
+		{Msatoshi: 2000, SetID: "02"},
+	}
+	got := InvoiceToHTLCs(invoice)
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, wanted %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %+v, wanted %+v", got[i], want[i])
+		}
+	}
+}
+
+func TestPaymentToStatus(t *testing.T) {
+	htlcs := []*lnrpc.HTLCAttempt{{ResolveTimeNs: 1000}, {ResolveTimeNs: 3000}}
+	for _, c := range []struct {
+		name    string
+		payment *lnrpc.Payment
+		want    rp.PaymentStatus
+	}{
+		{
+			name:    "in flight",
+			payment: &lnrpc.Payment{PaymentHash: "ab", Status: lnrpc.Payment_IN_FLIGHT, Htlcs: htlcs},
+			want:    rp.PaymentStatus{CheckingID: "ab", Status: rp.Pending},
+		},
+		{
+			name:    "failed without htlcs",
+			payment: &lnrpc.Payment{PaymentHash: "ab", Status: lnrpc.Payment_FAILED},
+			want:    rp.PaymentStatus{CheckingID: "ab", Status: rp.NeverTried},
+		},
+		{
+			name: "no route",
+			payment: &lnrpc.Payment{
+				PaymentHash: "ab", Status: lnrpc.Payment_FAILED,
+				FailureReason: lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE,
+			},
+			want: rp.PaymentStatus{CheckingID: "ab", Status: rp.NeverTried, FailureReason: rp.FailureNoRoute},
+		},
+		{
+			name:    "failed",
+			payment: &lnrpc.Payment{PaymentHash: "ab", Status: lnrpc.Payment_FAILED, Htlcs: htlcs},
+			want:    rp.PaymentStatus{CheckingID: "ab", Status: rp.Failed, ResolvedAt: time.Unix(0, 3000)},
+		},
+		{
+			name: "timed out",
+			payment: &lnrpc.Payment{
+				PaymentHash: "ab", Status: lnrpc.Payment_FAILED, Htlcs: htlcs,
+				FailureReason: lnrpc.PaymentFailureReason_FAILURE_REASON_TIMEOUT,
+			},
+			want: rp.PaymentStatus{
+				CheckingID: "ab", Status: rp.Failed, ResolvedAt: time.Unix(0, 3000),
+				FailureReason: rp.FailureTimeout,
+			},
+		},
+		{
+			name: "succeeded",
+			payment: &lnrpc.Payment{
+				PaymentHash: "ab", Status: lnrpc.Payment_SUCCEEDED, Htlcs: htlcs,
+				FeeMsat: 12, PaymentPreimage: "cd",
+			},
+			want: rp.PaymentStatus{
+				CheckingID: "ab", Status: rp.Complete, FeePaid: 12, Preimage: "cd",
+				ResolvedAt: time.Unix(0, 3000),
+			},
+		},
+		{
+			name:    "unknown",
+			payment: &lnrpc.Payment{PaymentHash: "ab", Status: lnrpc.Payment_UNKNOWN},
+			want:    rp.PaymentStatus{CheckingID: "ab", Status: rp.Unknown},
+		},
+	} {
+		if got := PaymentToStatus(c.payment); got != c.want {
+			t.Errorf("%s: got %+v, wanted %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestTransactionToOnchain(t *testing.T) {
+	got := TransactionToOnchain(&lnrpc.Transaction{
+		TxHash: "tx", Amount: -1000, TotalFees: 150, NumConfirmations: 3,
+		BlockHeight: 700000, DestAddresses: []string{"bc1q"},
+	})
+	if got.TxID != "tx" || got.Amount != -1000 || got.Fee != 150 || got.Confirmations != 3 ||
+		got.BlockHeight != 700000 || len(got.Addresses) != 1 || got.Addresses[0] != "bc1q" {
+		t.Errorf("got %+v, wanted every field converted", got)
+	}
+}
+
+func TestShortChannelIDToLnd(t *testing.T) {
+	for scid, want := range map[string]uint64{
+		"700000x1x0":         769658139443265536,
+		"769658139443265536": 769658139443265536,
+		"0x0x1":              1,
+	} {
+		if got, err := ShortChannelIDToLnd(scid); err != nil || got != want {
+			t.Errorf("%s: got %v %v, wanted %v", scid, got, err, want)
+		}
+	}
+	for _, scid := range []string{"", "1x2", "1x2x70000", "abc"} {
+		if _, err := ShortChannelIDToLnd(scid); err == nil {
+			t.Errorf("%s: got %v, wanted an error", scid, err)
+		}
+	}
+}
+
+func TestShortChannelIDFromLnd(t *testing.T) {
+	for _, scid := range []string{"700000x1x0", "0x0x1", "123456x789x3"} {
+		id, _ := ShortChannelIDToLnd(scid)
+		if got := ShortChannelIDFromLnd(id); got != scid {
+			t.Errorf("got %v, wanted %v", got, scid)
+		}
+	}
+}
+
+func TestChannelEdgeToGraph(t *testing.T) {
+	channel := ChannelEdgeToGraph(&lnrpc.ChannelEdge{
+		ChannelId: 769658139443265536,
+		Node1Pub:  "02a",
+		Node2Pub:  "03b",
+		Capacity:  1000000,
+		Node1Policy: &lnrpc.RoutingPolicy{
+			FeeBaseMsat:      1000,
+			FeeRateMilliMsat: 100,
+			TimeLockDelta:    40,
+			MaxHtlcMsat:      990000000,
+			LastUpdate:       1600000000,
+		},
+	})
+	want := rp.GraphChannel{
+		ShortChannelID: "700000x1x0",
+		Node1:          "02a",
+		Node2:          "03b",
+		CapacitySat:    1000000,
+		Node1Policy: &rp.RoutingPolicy{
+			FeeBaseMsatoshi:           1000,
+			FeeProportionalMillionths: 100,
+			TimeLockDelta:             40,
+			MaxHtlcMsatoshi:           990000000,
+			LastUpdate:                time.Unix(1600000000, 0),
+		},
+	}
+	if !reflect.DeepEqual(channel, want) {
+		t.Errorf("got %+v, wanted %+v", channel, want)
+	}
+}
+
+func TestSpendableMsatoshi(t *testing.T) {
+	channels := []*lnrpc.Channel{
+		{LocalBalance: 100000, LocalConstraints: &lnrpc.ChannelConstraints{ChanReserveSat: 10000}},
+		{LocalBalance: 50000, LocalChanReserveSat: 1000},
+		{LocalBalance: 500, LocalConstraints: &lnrpc.ChannelConstraints{ChanReserveSat: 1000}},
+	}
+	if got, want := SpendableMsatoshi(channels), int64(139000000); got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
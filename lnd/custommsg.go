@@ -0,0 +1,67 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.CustomMessenger
+var _ rp.CustomMessenger = (*LndWallet)(nil)
+
+func (l *LndWallet) SendCustomMessage(peer string, msgType uint32, data []byte) error {
+	pubkey, err := hex.DecodeString(peer)
+	if err != nil {
+		return fmt.Errorf("%w: invalid peer '%s'", rp.ErrInvalidParams, peer)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = l.Lightning.SendCustomMessage(ctx, &lnrpc.SendCustomMessageRequest{
+		Peer: pubkey,
+		Type: msgType,
+		Data: data,
+	})
+	if err != nil {
+		return fmt.Errorf("error calling SendCustomMessage: %w", err)
+	}
+	return nil
+}
+
+func (l *LndWallet) CustomMessages(ctx context.Context) (<-chan rp.CustomMessage, error) {
+	stream, err := l.Lightning.SubscribeCustomMessages(ctx, &lnrpc.SubscribeCustomMessagesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error calling SubscribeCustomMessages: %w", err)
+	}
+
+	messages := make(chan rp.CustomMessage)
+	go func() {
+		defer close(messages)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Error receiving custom message: %v", err)
+				}
+				return
+			}
+			select {
+			case messages <- rp.CustomMessage{
+				Peer: hex.EncodeToString(msg.Peer),
+				Type: msg.Type,
+				Data: msg.Data,
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
@@ -0,0 +1,208 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The usual misconfigurations, which Connect reports as a StartupError
+// matching one of these with errors.Is.
+var (
+	ErrCertMismatch    = errors.New("the tls cert doesn't match lnd's")
+	ErrInvalidMacaroon = errors.New("the macaroon was rejected")
+	ErrNotSynced       = errors.New("lnd is still starting or syncing")
+	ErrWrongNetwork    = errors.New("lnd is on another network")
+	ErrRESTPort        = errors.New("the port is lnd's REST port, not its gRPC one")
+
+	ErrMissingPermissions = errors.New("the macaroon lacks permissions")
+)
+
+// StartupError explains why Connect couldn't use lnd.
+type StartupError struct {
+	Reason error // one of the Err* above
+	Detail string
+	Err    error // the error given by grpc, if any
+}
+
+func (e *StartupError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Detail)
+}
+
+func (e *StartupError) Is(target error) bool {
+	return target == e.Reason
+}
+
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
+// dialError explains the connection errors caused by a cert that doesn't
+// match, the others are returned as they are.
+func dialError(host string, err error) error {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "certificate is valid for"):
+		return &StartupError{
+			Reason: ErrCertMismatch,
+			Detail: fmt.Sprintf("the cert isn't valid for %s, add it to lnd with tlsextradomain or tlsextraip and delete the cert so it's made again", host),
+			Err:    err,
+		}
+	case strings.Contains(msg, "x509:"), strings.Contains(msg, "authentication handshake failed"):
+		return &StartupError{
+			Reason: ErrCertMismatch,
+			Detail: fmt.Sprintf("%s presented a cert that isn't the given tls.cert, it may have been regenerated", host),
+			Err:    err,
+		}
+	}
+	return fmt.Errorf("failed to connect to %s: %w", host, err)
+}
+
+// rpcError explains the errors for the first calls made to lnd, nil when it
+// isn't a misconfiguration.
+func rpcError(host string, err error) *StartupError {
+	st, _ := status.FromError(err)
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "unexpected HTTP status code"),
+		strings.Contains(msg, "unexpected content-type"),
+		strings.Contains(msg, "malformed header"):
+		return &StartupError{
+			Reason: ErrRESTPort,
+			Detail: fmt.Sprintf("%s didn't answer gRPC, lnd serves it on port 10009 by default and REST on 8080", host),
+			Err:    err,
+		}
+	case strings.Contains(msg, "signature mismatch"),
+		strings.Contains(msg, "cannot get macaroon"),
+		strings.Contains(msg, "root key with id"),
+		strings.Contains(msg, "macaroon has expired"),
+		strings.Contains(msg, "invalid macaroon"),
+		strings.Contains(msg, "cannot determine data encoding"):
+		return &StartupError{
+			Reason: ErrInvalidMacaroon,
+			Detail: "it's expired, from another node or corrupted: " + st.Message(),
+			Err:    err,
+		}
+	case strings.Contains(msg, "wallet locked"),
+		strings.Contains(msg, "waiting to start"),
+		strings.Contains(msg, "in the process of starting"):
+		return &StartupError{
+			Reason: ErrNotSynced,
+			Detail: st.Message(),
+			Err:    err,
+		}
+	}
+	return nil
+}
+
+// checkPermissions fails with ErrMissingPermissions, before anything is
+// called, when the macaroons don't allow the required methods. The error
+// unwraps to an rp.PermissionError listing the missing permissions.
+//
+// Macaroons that can't be read, like the ones of some hosting proxies, aren't
+// checked; lnd will tell on the first call. Neither is a connection without
+// macaroons, to an lnd run with --no-macaroons.
+func checkPermissions(o *options) error {
+	if len(o.requiredMethods) == 0 {
+		return nil
+	}
+	if o.macaroon == nil && len(o.scopedMacaroons) == 0 {
+		return nil
+	}
+	var macs [][]byte
+	if o.macaroon != nil {
+		macs = append(macs, o.macaroon)
+	}
+	for _, scoped := range o.scopedMacaroons {
+		mac, _ := hex.DecodeString(scoped.hex)
+		macs = append(macs, mac)
+	}
+
+	missing, err := missingPermissions(macs, o.requiredMethods)
+	if err != nil {
+		log.Printf("Can't check the macaroon permissions: %v", err)
+		return nil
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &StartupError{
+		Reason: ErrMissingPermissions,
+		Detail: fmt.Sprintf("it needs %s, bake one that has them or use admin.macaroon",
+			strings.Join(missing, ", ")),
+		Err: &rp.PermissionError{
+			Method:      "Connect",
+			Permissions: missing,
+			Err:         errors.New("not granted by the macaroon"),
+		},
+	}
+}
+
+// checkStartup makes the first calls to lnd so Connect fails with a
+// StartupError for the common misconfigurations instead of every call failing
+// later. Other errors are only logged, as they may be temporary, and so is an
+// lnd that is starting, locked or syncing unless requireSynced is set.
+func (l *LndWallet) checkStartup(ctx context.Context, o *options) error {
+	notSynced := func(err error) error {
+		if o.requireSynced {
+			return err
+		}
+		log.Printf("Connected to lnd, but %v", err)
+		return nil
+	}
+
+	if l.State != nil {
+		state, err := l.State.GetState(ctx, &lnrpc.GetStateRequest{})
+		if err != nil {
+			// older lnd doesn't have the State service
+			if serr := rpcError(l.Host, err); serr != nil && serr.Reason == ErrNotSynced {
+				return notSynced(serr)
+			} else if serr != nil {
+				return serr
+			}
+			if status.Code(err) != codes.Unimplemented {
+				log.Printf("Failed to get lnd state: %v", err)
+			}
+		} else if state.State != lnrpc.WalletState_SERVER_ACTIVE &&
+			state.State != lnrpc.WalletState_RPC_ACTIVE {
+			return notSynced(&StartupError{
+				Reason: ErrNotSynced,
+				Detail: fmt.Sprintf("its state is %s", state.State),
+			})
+		}
+	}
+
+	info, err := l.Lightning.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		if serr := rpcError(l.Host, err); serr != nil && serr.Reason == ErrNotSynced {
+			return notSynced(serr)
+		} else if serr != nil {
+			return serr
+		}
+		log.Printf("Failed to GetInfo on startup: %v", err)
+		return nil
+	}
+
+	if o.network != "" && len(info.Chains) > 0 && info.Chains[0].Network != o.network {
+		return &StartupError{
+			Reason: ErrWrongNetwork,
+			Detail: fmt.Sprintf("wanted %s, lnd is on %s", o.network, info.Chains[0].Network),
+		}
+	}
+	if !info.SyncedToChain {
+		return notSynced(&StartupError{
+			Reason: ErrNotSynced,
+			Detail: fmt.Sprintf("it's at block %d and not synced to the chain yet", info.BlockHeight),
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package lnd
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.EventSource
+var _ rp.EventSource = (*LndWallet)(nil)
+
+// Events emits invoice, payment, channel and peer events until ctx is done.
+// Channel and peer events are only subscribed to once Events is first called.
+func (l *LndWallet) Events(ctx context.Context) (<-chan rp.Event, error) {
+	l.eventStreams.Do(func() {
+		go l.startChannelEventsStream()
+		go l.startPeerEventsStream()
+	})
+
+	listener, unsubscribe := l.events.Subscribe()
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+	return listener, nil
+}
+
+// publishInvoiceEvent is called for every invoice from SubscribeInvoices. lnd
+// cancels invoices once they expire, so expirations come as cancellations.
+func (l *LndWallet) publishInvoiceEvent(invoice *lnrpc.Invoice) {
+	status := InvoiceToStatus(invoice)
+	switch invoice.State {
+	case lnrpc.Invoice_OPEN:
+		if settlement, ok := invoiceSettlement(invoice); ok {
+			l.events.Publish(rp.InvoiceEvent(settlement)) // an AMP invoice paid again
+			return
+		}
+		l.events.Publish(rp.Event{
+			Type:    rp.InvoiceCreated,
+			Time:    unixTime(invoice.CreationDate),
+			Invoice: &status,
+		})
+	case lnrpc.Invoice_SETTLED, lnrpc.Invoice_CANCELED:
+		l.events.Publish(rp.InvoiceEvent(status))
+	}
+}
+
+func (l *LndWallet) startChannelEventsStream() {
+	for {
+		stream, err := l.Lightning.SubscribeChannelEvents(context.Background(),
+			&lnrpc.ChannelEventSubscription{})
+		if err != nil {
+			log.Printf("Failed to SubscribeChannelEvents: %v", err)
+			time.Sleep(resubscribeDelay)
+			continue
+		}
+
+		for {
+			update, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				log.Printf("Error receiving channel event: %v", err)
+				break
+			}
+			if event, ok := ChannelEventToEvent(update); ok {
+				l.events.Publish(event)
+			}
+		}
+
+		time.Sleep(resubscribeDelay)
+	}
+}
+
+func (l *LndWallet) startPeerEventsStream() {
+	for {
+		stream, err := l.Lightning.SubscribePeerEvents(context.Background(),
+			&lnrpc.PeerEventSubscription{})
+		if err != nil {
+			log.Printf("Failed to SubscribePeerEvents: %v", err)
+			time.Sleep(resubscribeDelay)
+			continue
+		}
+
+		for {
+			peer, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				log.Printf("Error receiving peer event: %v", err)
+				break
+			}
+
+			event := rp.Event{Type: rp.PeerOnline, Time: time.Now(), Peer: peer.PubKey}
+			if peer.Type == lnrpc.PeerEvent_PEER_OFFLINE {
+				event.Type = rp.PeerOffline
+			}
+			l.events.Publish(event)
+		}
+
+		time.Sleep(resubscribeDelay)
+	}
+}
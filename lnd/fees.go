@@ -0,0 +1,55 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	decodepay "github.com/fiatjaf/ln-decodepay"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.FeeEstimator
+var _ rp.FeeEstimator = (*LndWallet)(nil)
+
+func (l *LndWallet) EstimatePaymentFee(params rp.FeeEstimateParams) (rp.FeeEstimate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dest := params.Destination
+	msatoshi := params.Msatoshi
+	if params.Invoice != "" {
+		inv, err := decodepay.Decodepay(params.Invoice)
+		if err != nil {
+			return rp.FeeEstimate{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+		}
+		dest = inv.Payee
+		if msatoshi == 0 {
+			msatoshi = inv.MSatoshi
+		}
+	}
+	if msatoshi == 0 {
+		return rp.FeeEstimate{}, errors.New("can't estimate fees without an amount")
+	}
+
+	pubkey, err := hex.DecodeString(dest)
+	if err != nil {
+		return rp.FeeEstimate{}, fmt.Errorf("invalid destination '%s': %w", dest, err)
+	}
+
+	res, err := l.Router.EstimateRouteFee(ctx, &routerrpc.RouteFeeRequest{
+		Dest:   pubkey,
+		AmtSat: (msatoshi + 999) / 1000,
+	})
+	if err != nil {
+		return rp.FeeEstimate{}, fmt.Errorf("error calling EstimateRouteFee: %w", err)
+	}
+
+	return rp.FeeEstimate{
+		FeeMsatoshi:   res.RoutingFeeMsat,
+		TimeLockDelay: res.TimeLockDelay,
+	}, nil
+}
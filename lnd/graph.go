@@ -0,0 +1,93 @@
+package lnd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Compile time check to ensure that LndWallet implements rp.GraphReader
+var _ rp.GraphReader = (*LndWallet)(nil)
+
+func (l *LndWallet) GetNode(pubkey string) (rp.GraphNode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.GetNodeInfo(ctx, &lnrpc.NodeInfoRequest{PubKey: pubkey})
+	if err != nil {
+		return rp.GraphNode{}, graphError("GetNodeInfo", "node "+pubkey, err)
+	}
+	node := LightningNodeToGraph(res.Node)
+	node.Channels = int(res.NumChannels)
+	node.CapacitySat = res.TotalCapacity
+	return node, nil
+}
+
+// GetChannel also takes the integer lnd uses for channels.
+func (l *LndWallet) GetChannel(shortChannelID string) (rp.GraphChannel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := ShortChannelIDToLnd(shortChannelID)
+	if err != nil {
+		return rp.GraphChannel{}, err
+	}
+	edge, err := l.Lightning.GetChanInfo(ctx, &lnrpc.ChanInfoRequest{ChanId: id})
+	if err != nil {
+		return rp.GraphChannel{}, graphError("GetChanInfo", "channel "+shortChannelID, err)
+	}
+	return ChannelEdgeToGraph(edge), nil
+}
+
+// ListGraphNodes needs a bigger message size than the default on mainnet, see
+// WithMaxMessageSize.
+func (l *LndWallet) ListGraphNodes() ([]rp.GraphNode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	graph, err := l.Lightning.DescribeGraph(ctx, &lnrpc.ChannelGraphRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error calling DescribeGraph: %w", err)
+	}
+
+	type totals struct {
+		channels int
+		capacity int64
+	}
+	byNode := make(map[string]*totals, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		byNode[node.PubKey] = &totals{}
+	}
+	for _, edge := range graph.Edges {
+		for _, pubkey := range []string{edge.Node1Pub, edge.Node2Pub} {
+			if t, ok := byNode[pubkey]; ok {
+				t.channels++
+				t.capacity += edge.Capacity
+			}
+		}
+	}
+
+	nodes := make([]rp.GraphNode, len(graph.Nodes))
+	for i, node := range graph.Nodes {
+		nodes[i] = LightningNodeToGraph(node)
+		nodes[i].Channels = byNode[node.PubKey].channels
+		nodes[i].CapacitySat = byNode[node.PubKey].capacity
+	}
+	return nodes, nil
+}
+
+// graphError is rp.ErrNotFound for what isn't in the graph.
+func graphError(method, what string, err error) error {
+	if status.Code(err) == codes.NotFound ||
+		strings.Contains(err.Error(), "unable to find") ||
+		strings.Contains(err.Error(), "not found") {
+		return fmt.Errorf("%w: %s", rp.ErrNotFound, what)
+	}
+	return fmt.Errorf("error calling %s: %w", method, err)
+}
@@ -0,0 +1,47 @@
+package lnd
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+func (l *LndWallet) Health(ctx context.Context) (rp.HealthStatus, error) {
+	if l.State != nil {
+		// older lnd doesn't have the State service, so only a clear answer counts
+		state, err := l.State.GetState(ctx, &lnrpc.GetStateRequest{})
+		if err == nil && state.State != lnrpc.WalletState_RPC_ACTIVE &&
+			state.State != lnrpc.WalletState_SERVER_ACTIVE {
+			return rp.HealthStatus{
+				Connected: true,
+				Detail:    fmt.Sprintf("lnd is not ready, its state is %s", state.State),
+			}, nil
+		}
+	}
+
+	info, err := l.Lightning.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return rp.HealthStatus{}, fmt.Errorf("error calling GetInfo: %w", err)
+	}
+
+	health := rp.HealthStatus{
+		Connected:     true,
+		SyncedToChain: info.SyncedToChain,
+		SyncedToGraph: info.SyncedToGraph,
+		StreamsAlive:  atomic.LoadInt32(&l.invoicesStreamAlive) == 1,
+	}
+	if !health.StreamsAlive {
+		health.Detail = "not subscribed to invoices"
+	}
+
+	return health, nil
+}
+
+// WaitForSync blocks until lnd is synced to the chain and the graph or ctx is
+// done, see rp.WaitForSync.
+func (l *LndWallet) WaitForSync(ctx context.Context) error {
+	return rp.WaitForSync(ctx, l)
+}
@@ -0,0 +1,72 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.HoldInvoiceWallet
+var _ rp.HoldInvoiceWallet = (*LndWallet)(nil)
+
+func (l *LndWallet) createHoldInvoice(ctx context.Context, params rp.InvoiceParams) (rp.InvoiceData, error) {
+	args := &invoicesrpc.AddHoldInvoiceRequest{
+		Hash:            params.PaymentHash,
+		DescriptionHash: params.DescriptionHash,
+		ValueMsat:       params.Msatoshi,
+		Private:         params.Private,
+		FallbackAddr:    params.FallbackAddress,
+		CltvExpiry:      uint64(params.CltvExpiry),
+	}
+	if params.DescriptionHash == nil {
+		args.Memo = params.Description
+	}
+	if params.Expiry != nil {
+		args.Expiry = int64(params.Expiry.Seconds())
+	}
+	inv, err := l.Invoices.AddHoldInvoice(ctx, args)
+	if err != nil {
+		return rp.InvoiceData{}, fmt.Errorf("error calling AddHoldInvoice: %w", err)
+	}
+
+	return rp.InvoiceData{
+		CheckingID: hex.EncodeToString(params.PaymentHash),
+		Invoice:    inv.PaymentRequest,
+	}, nil
+}
+
+func (l *LndWallet) SettleHoldInvoice(preimage []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := l.Invoices.SettleInvoice(ctx, &invoicesrpc.SettleInvoiceMsg{
+		Preimage: preimage,
+	}); err != nil {
+		return fmt.Errorf("error calling SettleInvoice: %w", err)
+	}
+	return nil
+}
+
+func (l *LndWallet) CancelHoldInvoice(paymentHash []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := l.Invoices.CancelInvoice(ctx, &invoicesrpc.CancelInvoiceMsg{
+		PaymentHash: paymentHash,
+	}); err != nil {
+		return fmt.Errorf("error calling CancelInvoice: %w", err)
+	}
+	return nil
+}
+
+func (l *LndWallet) CancelInvoice(checkingID string) error {
+	paymentHash, err := hex.DecodeString(checkingID)
+	if err != nil {
+		return fmt.Errorf("invalid checkingID: %w", err)
+	}
+	return l.CancelHoldInvoice(paymentHash)
+}
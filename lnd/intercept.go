@@ -0,0 +1,102 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.HtlcInterceptor
+var _ rp.HtlcInterceptor = (*LndWallet)(nil)
+
+// InterceptHtlcs registers as the htlc interceptor of lnd. When the stream
+// ends lnd forwards the htlcs that weren't resolved, unless it runs with
+// requireinterceptor.
+func (l *LndWallet) InterceptHtlcs(ctx context.Context) (<-chan rp.InterceptedHtlc, error) {
+	stream, err := l.Router.HtlcInterceptor(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error calling HtlcInterceptor: %w", err)
+	}
+
+	// a stream can't be sent to concurrently
+	var sendMu sync.Mutex
+
+	htlcs := make(chan rp.InterceptedHtlc)
+	go func() {
+		defer close(htlcs)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Error receiving intercepted htlc: %v", err)
+				}
+				return
+			}
+
+			key := req.IncomingCircuitKey
+			htlc := InterceptRequestToHtlc(req)
+			htlc.Resolve = func(decision rp.HtlcDecision) error {
+				res, err := htlcResponse(key, decision)
+				if err != nil {
+					return err
+				}
+				sendMu.Lock()
+				defer sendMu.Unlock()
+				if err := stream.Send(res); err != nil {
+					return fmt.Errorf("error resolving htlc %s:%d: %w", htlc.IncomingChannel, htlc.IncomingHtlcID, err)
+				}
+				return nil
+			}
+
+			select {
+			case htlcs <- htlc:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return htlcs, nil
+}
+
+func InterceptRequestToHtlc(req *routerrpc.ForwardHtlcInterceptRequest) rp.InterceptedHtlc {
+	htlc := rp.InterceptedHtlc{
+		OutgoingChannel:  strconv.FormatUint(req.OutgoingRequestedChanId, 10),
+		PaymentHash:      hex.EncodeToString(req.PaymentHash),
+		IncomingMsatoshi: int64(req.IncomingAmountMsat),
+		OutgoingMsatoshi: int64(req.OutgoingAmountMsat),
+		IncomingExpiry:   req.IncomingExpiry,
+		OutgoingExpiry:   req.OutgoingExpiry,
+	}
+	if key := req.IncomingCircuitKey; key != nil {
+		htlc.IncomingChannel = strconv.FormatUint(key.ChanId, 10)
+		htlc.IncomingHtlcID = key.HtlcId
+	}
+	return htlc
+}
+
+func htlcResponse(key *routerrpc.CircuitKey, decision rp.HtlcDecision) (*routerrpc.ForwardHtlcInterceptResponse, error) {
+	res := &routerrpc.ForwardHtlcInterceptResponse{IncomingCircuitKey: key}
+	switch decision.Action {
+	case rp.HtlcAccept:
+		res.Action = routerrpc.ResolveHoldForwardAction_RESUME
+	case rp.HtlcReject:
+		res.Action = routerrpc.ResolveHoldForwardAction_FAIL
+	case rp.HtlcSettle:
+		preimage, err := hex.DecodeString(decision.Preimage)
+		if err != nil || len(preimage) != 32 {
+			return nil, fmt.Errorf("%w: invalid preimage '%s'", rp.ErrInvalidParams, decision.Preimage)
+		}
+		res.Action = routerrpc.ResolveHoldForwardAction_SETTLE
+		res.Preimage = preimage
+	default:
+		return nil, fmt.Errorf("%w: unknown htlc action '%s'", rp.ErrInvalidParams, decision.Action)
+	}
+	return res, nil
+}
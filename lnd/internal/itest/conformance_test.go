@@ -0,0 +1,17 @@
+//go:build itest
+// +build itest
+
+package itest
+
+import (
+	"testing"
+
+	"github.com/lnbits/relampago/internal/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	h := Start(t)
+
+	t.Run("AliceToBob", func(t *testing.T) { conformance.Run(t, h.Alice, h.Bob) })
+	t.Run("BobToAlice", func(t *testing.T) { conformance.Run(t, h.Bob, h.Alice) })
+}
@@ -0,0 +1,224 @@
+//go:build itest
+// +build itest
+
+// Package itest runs lnd nodes on regtest with docker compose, for tests that
+// need real backends. They only build with the itest tag:
+//
+//	cd lnd && go test -tags itest ./internal/itest
+package itest
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lnbits/relampago/lnd"
+)
+
+const (
+	project     = "relampago-itest"
+	macaroonDir = "/root/.lnd/data/chain/bitcoin/regtest"
+)
+
+// Harness has alice and bob connected by a channel opened by alice, with
+// half of it pushed to bob, so both can pay.
+type Harness struct {
+	Alice *lnd.LndWallet
+	Bob   *lnd.LndWallet
+
+	compose string
+}
+
+// Start brings the nodes up, which takes a while the first time as the images
+// are pulled. They are taken down when the test ends.
+func Start(t *testing.T) *Harness {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is needed for the integration tests")
+	}
+
+	_, file, _, _ := runtime.Caller(0)
+	h := &Harness{compose: filepath.Join(filepath.Dir(file), "docker-compose.yml")}
+	t.Cleanup(func() { h.docker("down", "--volumes") })
+
+	if _, err := h.docker("up", "--detach"); err != nil {
+		t.Fatalf("failed to start the nodes: %v", err)
+	}
+
+	var err error
+	if h.Alice, err = h.connect("alice", "localhost:10009"); err != nil {
+		t.Fatalf("failed to connect to alice: %v", err)
+	}
+	if h.Bob, err = h.connect("bob", "localhost:10010"); err != nil {
+		t.Fatalf("failed to connect to bob: %v", err)
+	}
+
+	if err := h.fund(); err != nil {
+		t.Fatalf("failed to fund alice: %v", err)
+	}
+	if err := h.openChannel(); err != nil {
+		t.Fatalf("failed to open the channel: %v", err)
+	}
+
+	return h
+}
+
+func (h *Harness) docker(args ...string) (string, error) {
+	out, err := h.dockerBytes(args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+func (h *Harness) dockerBytes(args ...string) ([]byte, error) {
+	args = append([]string{"compose", "--file", h.compose, "--project-name", project}, args...)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("docker %s: %w: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// BitcoinCLI runs bitcoin-cli on the bitcoind container.
+func (h *Harness) BitcoinCLI(args ...string) (string, error) {
+	args = append([]string{"exec", "-T", "bitcoind", "bitcoin-cli",
+		"-regtest", "-rpcuser=itest", "-rpcpassword=itest"}, args...)
+	return h.docker(args...)
+}
+
+// Mine mines blocks to a bitcoind address.
+func (h *Harness) Mine(blocks int) error {
+	address, err := h.BitcoinCLI("getnewaddress")
+	if err != nil {
+		return err
+	}
+	_, err = h.BitcoinCLI("generatetoaddress", fmt.Sprint(blocks), address)
+	return err
+}
+
+// connect waits for the node to write its credentials and connects to it.
+func (h *Harness) connect(node string, host string) (*lnd.LndWallet, error) {
+	var cert, macaroon []byte
+	err := retry(func() (err error) {
+		if cert, err = h.dockerBytes("exec", "-T", node, "cat", "/root/.lnd/tls.cert"); err != nil {
+			return err
+		}
+		macaroon, err = h.dockerBytes("exec", "-T", node, "cat", macaroonDir+"/admin.macaroon")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var wallet *lnd.LndWallet
+	err = retry(func() (err error) {
+		wallet, err = lnd.Connect(host,
+			lnd.WithCertBytes(cert),
+			lnd.WithMacaroonBytes(macaroon),
+			lnd.WithNetwork("regtest"),
+		)
+		return err
+	})
+	return wallet, err
+}
+
+func (h *Harness) fund() error {
+	if _, err := h.BitcoinCLI("createwallet", "itest"); err != nil {
+		return err
+	}
+	if err := h.Mine(101); err != nil {
+		return err
+	}
+
+	address, err := h.Alice.NewAddress()
+	if err != nil {
+		return err
+	}
+	if _, err := h.BitcoinCLI("sendtoaddress", address, "1"); err != nil {
+		return err
+	}
+	if err := h.Mine(6); err != nil {
+		return err
+	}
+
+	return retry(func() error {
+		balance, err := h.Alice.GetOnchainBalance()
+		if err != nil {
+			return err
+		}
+		if balance.Confirmed == 0 {
+			return fmt.Errorf("funds not confirmed yet")
+		}
+		return nil
+	})
+}
+
+func (h *Harness) openChannel() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	bob, err := h.Bob.Lightning.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return err
+	}
+	pubkey, _ := hex.DecodeString(bob.IdentityPubkey)
+
+	err = retry(func() error {
+		_, err := h.Alice.Lightning.ConnectPeer(ctx, &lnrpc.ConnectPeerRequest{
+			Addr: &lnrpc.LightningAddress{Pubkey: bob.IdentityPubkey, Host: "bob:9735"},
+		})
+		if err != nil && strings.Contains(err.Error(), "already connected") {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = retry(func() error {
+		_, err := h.Alice.Lightning.OpenChannelSync(ctx, &lnrpc.OpenChannelRequest{
+			NodePubkey:         pubkey,
+			LocalFundingAmount: 10000000,
+			PushSat:            5000000,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := h.Mine(6); err != nil {
+		return err
+	}
+
+	return retry(func() error {
+		res, err := h.Alice.Lightning.ListChannels(ctx, &lnrpc.ListChannelsRequest{ActiveOnly: true})
+		if err != nil {
+			return err
+		}
+		if len(res.Channels) == 0 {
+			return fmt.Errorf("channel not active yet")
+		}
+		return nil
+	})
+}
+
+// retry calls fn every second for up to a minute, until it succeeds.
+func retry(fn func() error) error {
+	deadline := time.Now().Add(time.Minute)
+	for {
+		err := fn()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
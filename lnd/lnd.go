@@ -2,25 +2,33 @@ package lnd
 
 import (
 	"context"
-	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	decodepay "github.com/fiatjaf/ln-decodepay"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/chainrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
-	"github.com/lightningnetwork/lnd/macaroons"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/wtclientrpc"
 	rp "github.com/lnbits/relampago"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 	macaroon "gopkg.in/macaroon.v2"
 )
 
+// PaymentPollInterval is how often new payments are listed on lnd versions
+// that can't stream htlc events.
 var PaymentPollInterval = 30 * time.Second
 
 type Params struct {
@@ -28,6 +36,10 @@ type Params struct {
 	CertPath       string
 	MacaroonPath   string
 	ConnectTimeout time.Duration
+
+	// SyncTimeout is how long Start waits for lnd to sync, it doesn't wait
+	// when zero.
+	SyncTimeout time.Duration
 }
 
 type LndWallet struct {
@@ -36,61 +48,179 @@ type LndWallet struct {
 	Conn      *grpc.ClientConn
 	Lightning lnrpc.LightningClient
 	Router    routerrpc.RouterClient
+	WalletKit walletrpc.WalletKitClient
+	Invoices  invoicesrpc.InvoicesClient
+	State     lnrpc.StateClient
+	Chain     chainrpc.ChainNotifierClient
+	Towers    wtclientrpc.WatchtowerClientClient
+
+	invoicesStreamAlive int32 // accessed atomically
+
+	featuresMu    sync.Mutex
+	featuresKnown bool
+	wumbo         bool   // from the node features, see detectWumbo
+	pubkey        string // see detectWumbo
 
-	invoiceStatusListeners []chan rp.InvoiceStatus
-	paymentStatusListeners []chan rp.PaymentStatus
+	trackingMu sync.Mutex
+	tracking   map[string]bool // payment hashes being tracked
+
+	invoices   rp.InvoiceBroadcaster
+	payments   rp.PaymentBroadcaster
+	onchainTxs rp.OnchainTxBroadcaster
+
+	events       rp.EventBroadcaster
+	eventStreams sync.Once
 }
 
+// Start connects using the file paths in params, see Connect for more options.
 func Start(params Params) (*LndWallet, error) {
+	l, err := Connect(params.Host,
+		WithCertPath(params.CertPath),
+		WithMacaroonPath(params.MacaroonPath),
+		WithTimeout(params.ConnectTimeout),
+		WithWaitForSync(params.SyncTimeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	l.Params = params
+	return l, nil
+}
+
+// Connect dials lnd at host and checks it can be used, failing with a
+// StartupError for the usual misconfigurations.
+func Connect(host string, opts ...Option) (*LndWallet, error) {
+	o := &options{timeout: 15 * time.Second, keepalive: DefaultKeepalive, requiredMethods: WalletMethods}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
 	var dialOpts []grpc.DialOption
 
 	// checks
-	if strings.HasPrefix(params.Host, "http") {
+	if strings.HasPrefix(host, "http") {
 		return nil, fmt.Errorf("lnd grpc host cannot have an http prefix.")
 	}
+	if o.macaroon == nil && len(o.scopedMacaroons) == 0 {
+		return nil, fmt.Errorf("a macaroon is required.")
+	}
+	if o.certPath != "" && len(o.certs) > 0 {
+		return nil, fmt.Errorf("a tls cert can't be given both as a path and as bytes.")
+	}
 
 	// TLS
-	tls, err := credentials.NewClientTLSFromFile(params.CertPath, "")
-	if err != nil {
-		return nil, err
+	var certFile *reloadingCredentials
+	if o.insecure {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	} else if o.certPath != "" {
+		tls, err := newReloadingCredentials(o.certPath, o.systemCerts)
+		if err != nil {
+			return nil, err
+		}
+		certFile = tls
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(tls))
+	} else {
+		if len(o.certs) == 0 && !o.systemCerts {
+			return nil, fmt.Errorf("a tls cert is required unless connecting insecurely.")
+		}
+		pool, err := certPool(o.certs, o.systemCerts)
+		if err != nil {
+			return nil, err
+		}
+		tls := credentials.NewClientTLSFromCert(pool, "")
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(tls))
 	}
-	dialOpts = append(dialOpts, grpc.WithTransportCredentials(tls))
 
 	// Macaroon Auth
-	macBytes, err := ioutil.ReadFile(params.MacaroonPath)
-	if err != nil {
-		return nil, err
+	if o.macaroon != nil {
+		m := &macaroon.Macaroon{}
+		if err := m.UnmarshalBinary(o.macaroon); err != nil {
+			return nil, &StartupError{Reason: ErrInvalidMacaroon, Detail: "it isn't a macaroon", Err: err}
+		}
 	}
-	m := &macaroon.Macaroon{}
-	err = m.UnmarshalBinary(macBytes)
-	if err != nil {
+	if err := checkPermissions(o); err != nil {
 		return nil, err
 	}
-	creds, err := macaroons.NewMacaroonCredential(m)
-	if err != nil {
-		return nil, err
+	macs := newMacaroonSet(o.macaroon, o.scopedMacaroons)
+	dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(macs.unaryInterceptor))
+	dialOpts = append(dialOpts, grpc.WithChainStreamInterceptor(macs.streamInterceptor))
+	dialOpts = append(dialOpts, grpc.WithKeepaliveParams(o.keepalive))
+	if o.maxMsgSize > 0 {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(o.maxMsgSize)))
+	}
+	if !o.nonBlocking {
+		// fail right away on errors like a bad cert instead of retrying them
+		// until the timeout, and say what they were
+		dialOpts = append(dialOpts, grpc.WithBlock(),
+			grpc.FailOnNonTempDialError(true), grpc.WithReturnConnectionError())
 	}
-	dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(creds))
-	dialOpts = append(dialOpts, grpc.WithBlock())
-	dialOpts = append(dialOpts, grpc.WithTimeout(params.ConnectTimeout))
+	dialOpts = append(dialOpts, o.dialOpts...)
 
 	// Connect
-	conn, err := grpc.Dial(params.Host, dialOpts...)
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, host, dialOpts...)
 	if err != nil {
-		return nil, err
+		return nil, dialError(host, err)
+	}
+	if certFile != nil {
+		go certFile.watch(conn)
 	}
 	ln := lnrpc.NewLightningClient(conn)
 	router := routerrpc.NewRouterClient(conn)
+	walletKit := walletrpc.NewWalletKitClient(conn)
 
 	l := &LndWallet{
-		Params:    params,
+		Params: Params{
+			Host:           host,
+			ConnectTimeout: o.timeout,
+		},
 		Conn:      conn,
 		Lightning: ln,
 		Router:    router,
+		WalletKit: walletKit,
+		Invoices:  invoicesrpc.NewInvoicesClient(conn),
+		State:     lnrpc.NewStateClient(conn),
+		Chain:     chainrpc.NewChainNotifierClient(conn),
+		Towers:    wtclientrpc.NewWatchtowerClientClient(conn),
+	}
+
+	if !o.nonBlocking {
+		ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+		defer cancel()
+		check := *o
+		if o.syncTimeout > 0 {
+			// waited for below
+			check.requireSynced = false
+		}
+		if err := l.checkStartup(ctx, &check); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if o.syncTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), o.syncTimeout)
+		defer cancel()
+		if err := l.WaitForSync(ctx); err != nil {
+			conn.Close()
+			return nil, &StartupError{
+				Reason: ErrNotSynced,
+				Detail: fmt.Sprintf("still not synced after %s", o.syncTimeout),
+				Err:    err,
+			}
+		}
+	}
+
+	if !o.nonBlocking {
+		l.detectWumbo()
 	}
 
 	go l.startPaymentsStream()
-	go l.startInvoicesStream()
+	go l.startInvoicesStream(o.settleIndex)
+	go l.startTransactionsStream()
 
 	return l, nil
 }
@@ -102,6 +232,31 @@ func (l *LndWallet) Kind() string {
 	return "lndgrpc"
 }
 
+// MaxPaymentMsatoshi is the largest payment lnd sends or receives without wumbo.
+const MaxPaymentMsatoshi = rp.MaxNonWumboMsatoshi
+
+func (l *LndWallet) Capabilities() rp.Capabilities {
+	wumbo, _ := l.detectWumbo()
+	var max int64 = MaxPaymentMsatoshi
+	if wumbo {
+		max = 0
+	}
+	return rp.Capabilities{
+		MaxInvoiceMsatoshi:   max,
+		MaxPaymentMsatoshi:   max,
+		MaxDescriptionLength: rp.MaxBolt11DescriptionLength,
+		CustomRecords:        true,
+		RouteHints:           true,
+		CustomRouteHints:     true,
+		HoldInvoices:         true,
+		CancelInvoices:       true,
+		FallbackAddresses:    true,
+		CltvExpiry:           true,
+		PeerRestrictions:     true,
+		Wumbo:                wumbo,
+	}
+}
+
 func (l *LndWallet) GetInfo() (rp.WalletInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -116,22 +271,64 @@ func (l *LndWallet) GetInfo() (rp.WalletInfo, error) {
 	}, nil
 }
 
+// Compile time check to ensure that LndWallet implements rp.NodeInfoProvider
+var _ rp.NodeInfoProvider = (*LndWallet)(nil)
+
+func (l *LndWallet) GetNodeInfo() (rp.NodeInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return rp.NodeInfo{}, fmt.Errorf("error calling GetInfo: %w", err)
+	}
+
+	info := rp.NodeInfo{
+		Pubkey:      res.IdentityPubkey,
+		Alias:       res.Alias,
+		BlockHeight: int64(res.BlockHeight),
+		Version:     res.Version,
+	}
+	if len(res.Chains) > 0 {
+		info.Network = res.Chains[0].Network
+	}
+
+	return info, nil
+}
+
 func (l *LndWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	preimage := make([]byte, 32)
-	rand.Read(preimage)
+	if err := rp.ValidateInvoiceParams(l.Capabilities(), params); err != nil {
+		return rp.InvoiceData{}, err
+	}
+	if params.PaymentHash != nil && params.Preimage == nil {
+		return l.createHoldInvoice(ctx, params)
+	}
+
+	preimage, err := rp.InvoicePreimage(params)
+	if err != nil {
+		return rp.InvoiceData{}, err
+	}
 
 	args := &lnrpc.Invoice{
-		Memo:            params.Description,
 		DescriptionHash: params.DescriptionHash,
 		ValueMsat:       params.Msatoshi,
 		RPreimage:       preimage,
+		Private:         params.Private,
+		FallbackAddr:    params.FallbackAddress,
+		CltvExpiry:      uint64(params.CltvExpiry),
+	}
+	if params.DescriptionHash == nil {
+		args.Memo = params.Description
 	}
 	if params.Expiry != nil {
 		args.Expiry = int64(params.Expiry.Seconds())
 	}
+	if args.RouteHints, err = RouteHintsToLnd(params.RouteHints); err != nil {
+		return rp.InvoiceData{}, err
+	}
 	inv, err := l.Lightning.AddInvoice(ctx, args)
 	if err != nil {
 		return rp.InvoiceData{}, fmt.Errorf("error calling AddInvoice: %w", err)
@@ -153,20 +350,44 @@ func (l *LndWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error
 		return rp.InvoiceStatus{}, fmt.Errorf("invalid checkingID: %w", err)
 	}
 	res, err := l.Lightning.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: rHash})
-	if err != nil || res == nil {
-		return rp.InvoiceStatus{
-			CheckingID:       checkingID,
-			Exists:           false,
-			Paid:             false,
-			MSatoshiReceived: 0,
-		}, nil
-	}
-	return rp.InvoiceStatus{
-		CheckingID:       checkingID,
-		Exists:           true,
-		Paid:             res.State == lnrpc.Invoice_SETTLED,
-		MSatoshiReceived: res.AmtPaidMsat,
-	}, nil
+	if err != nil {
+		if status.Code(err) == codes.NotFound ||
+			strings.Contains(err.Error(), "unable to locate invoice") {
+			return rp.InvoiceNotFound(checkingID)
+		}
+		return rp.InvoiceLookupFailed(checkingID, fmt.Errorf("error calling LookupInvoice: %w", err))
+	}
+	status := InvoiceToStatus(res)
+	status.CheckingID = checkingID
+	return status, nil
+}
+
+// Compile time check to ensure that LndWallet implements rp.InvoiceHTLCLister
+var _ rp.InvoiceHTLCLister = (*LndWallet)(nil)
+
+func (l *LndWallet) InvoiceHTLCs(checkingID string) ([]rp.InvoiceHTLC, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rHash, err := hex.DecodeString(checkingID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkingID: %w", err)
+	}
+	res, err := l.Lightning.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: rHash})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, fmt.Errorf("%w: invoice %s", rp.ErrNotFound, checkingID)
+		}
+		return nil, fmt.Errorf("error calling LookupInvoice: %w", err)
+	}
+	return InvoiceToHTLCs(res), nil
+}
+
+func unixTime(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
 }
 
 func (l *LndWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
@@ -177,11 +398,22 @@ func (l *LndWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error)
 	if err != nil {
 		return rp.PaymentData{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
 	}
+	if _, pubkey := l.detectWumbo(); pubkey != "" && inv.Payee == pubkey && !params.AllowSelfPayment {
+		return rp.PaymentData{}, fmt.Errorf("%w: lnd can't pay %s", rp.ErrSelfPayment, inv.PaymentHash)
+	}
+
+	amount := inv.MSatoshi
+	if params.CustomAmount != 0 {
+		amount = params.CustomAmount
+	}
+	if err := rp.ValidatePayment(l.Capabilities(), params, amount); err != nil {
+		return rp.PaymentData{}, err
+	}
 
 	req := &routerrpc.SendPaymentRequest{
 		PaymentRequest: params.Invoice,
 		TimeoutSeconds: 30,
-		FeeLimitMsat:   int64(float64(inv.MSatoshi) * 0.01),
+		FeeLimitMsat:   int64(float64(amount) * 0.01),
 	}
 	if params.CustomAmount != 0 {
 		req.AmtMsat = params.CustomAmount
@@ -190,6 +422,38 @@ func (l *LndWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error)
 	if req.FeeLimitMsat < 2000 {
 		req.FeeLimitMsat = 2000
 	}
+	if params.MaxFeeMsatoshi != 0 {
+		req.FeeLimitMsat = params.MaxFeeMsatoshi
+	}
+	if params.MaxParts != 0 {
+		req.MaxParts = params.MaxParts
+	}
+	if params.MaxShardMsatoshi != 0 {
+		req.MaxShardSizeMsat = uint64(params.MaxShardMsatoshi)
+	}
+	req.Amp = params.AMP
+	req.AllowSelfPayment = params.AllowSelfPayment
+	req.OutgoingChanIds = params.OutgoingChannelIDs
+	if params.LastHopPubkey != "" {
+		if req.LastHopPubkey, err = hex.DecodeString(params.LastHopPubkey); err != nil || len(req.LastHopPubkey) != 33 {
+			return rp.PaymentData{}, fmt.Errorf("%w: invalid last hop pubkey '%s'", rp.ErrInvalidParams, params.LastHopPubkey)
+		}
+	}
+	if len(params.RestrictToPeers) > 0 {
+		if err := l.restrictToPeers(ctx, req, inv, params.RestrictToPeers); err != nil {
+			return rp.PaymentData{}, err
+		}
+	}
+
+	if !params.AllowDuplicate {
+		// a payment to this hash that is in flight or done is the same payment,
+		// so calling this again is safe
+		if existing, err := l.GetPaymentStatus(inv.PaymentHash); err == nil &&
+			(existing.Status == rp.Pending || existing.Status == rp.Complete) {
+			go l.trackOutgoingPayment(inv.PaymentHash)
+			return rp.PaymentData{CheckingID: inv.PaymentHash}, nil
+		}
+	}
 
 	stream, err := l.Router.SendPaymentV2(ctx, req)
 	if err != nil {
@@ -198,10 +462,23 @@ func (l *LndWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error)
 
 	// listen to the first notification, which should be "in_flight"
 	if _, err := stream.Recv(); err != nil {
+		if isDuplicatePayment(err) && !params.AllowDuplicate {
+			// another call started it between the lookup and now
+			go l.trackOutgoingPayment(inv.PaymentHash)
+			return rp.PaymentData{CheckingID: inv.PaymentHash}, nil
+		}
+		if strings.Contains(err.Error(), "self-payments not allowed") {
+			return rp.PaymentData{}, fmt.Errorf("%w: lnd can't pay %s", rp.ErrSelfPayment, inv.PaymentHash)
+		}
 		return rp.PaymentData{}, fmt.Errorf("failed to stream.Recv() on MakePayment(%s): %w",
 			inv.PaymentHash, err)
 	}
 
+	l.events.Publish(rp.PaymentEvent(rp.PaymentStatus{
+		CheckingID: inv.PaymentHash,
+		Status:     rp.Pending,
+	}))
+
 	// track this so it can emit payment notifications
 	go l.trackOutgoingPayment(inv.PaymentHash)
 
@@ -211,6 +488,14 @@ func (l *LndWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error)
 	}, nil
 }
 
+// isDuplicatePayment tells if lnd refused a payment because one to the same
+// hash is in flight or already succeeded.
+func isDuplicatePayment(err error) bool {
+	return status.Code(err) == codes.AlreadyExists ||
+		strings.Contains(err.Error(), "payment is in transition") ||
+		strings.Contains(err.Error(), "invoice is already paid")
+}
+
 func (l *LndWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -238,81 +523,146 @@ func (l *LndWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error
 			fmt.Errorf("error calling Recv() on TrackPaymentV2: %w", err)
 	}
 
-	return paymentToPaymentStatus(payment), nil
-}
-
-func paymentToPaymentStatus(payment *lnrpc.Payment) rp.PaymentStatus {
-	status := rp.PaymentStatus{
-		CheckingID: payment.PaymentHash,
-		Status:     rp.Unknown,
-		FeePaid:    0,
-		Preimage:   "",
-	}
-
-	switch payment.Status {
-	case lnrpc.Payment_IN_FLIGHT:
-		status.Status = rp.Pending
-		return status
-	case lnrpc.Payment_FAILED:
-		if len(payment.Htlcs) == 0 {
-			status.Status = rp.NeverTried
-		} else {
-			status.Status = rp.Failed
-		}
-		return status
-	case lnrpc.Payment_SUCCEEDED:
-		status.Status = rp.Complete
-		status.FeePaid = payment.FeeMsat
-		status.Preimage = payment.PaymentPreimage
-		return status
-	default:
-		return status
-	}
+	return PaymentToStatus(payment), nil
 }
 
 func (l *LndWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
-	listener := make(chan rp.InvoiceStatus)
-	l.invoiceStatusListeners = append(l.invoiceStatusListeners, listener)
+	listener, _ := l.invoices.Subscribe()
 	return listener, nil
 }
 
 func (l *LndWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
-	listener := make(chan rp.PaymentStatus)
-	l.paymentStatusListeners = append(l.paymentStatusListeners, listener)
+	listener, _ := l.payments.Subscribe()
 	return listener, nil
 }
 
-func (l *LndWallet) startInvoicesStream() {
-	stream, err := l.Lightning.SubscribeInvoices(context.Background(), &lnrpc.InvoiceSubscription{})
+// Compile time check to ensure that LndWallet implements rp.Subscriber
+var _ rp.Subscriber = (*LndWallet)(nil)
+
+func (l *LndWallet) SubscribePaidInvoices() (<-chan rp.InvoiceStatus, func()) {
+	return l.invoices.Subscribe()
+}
+
+func (l *LndWallet) SubscribePayments() (<-chan rp.PaymentStatus, func()) {
+	return l.payments.Subscribe()
+}
+
+func (l *LndWallet) startInvoicesStream(settleIndex uint64) {
+	// resubscribe from where we were when the connection drops, like when lnd
+	// restarts with a new tls.cert
+	for {
+		stream, err := l.Lightning.SubscribeInvoices(context.Background(), &lnrpc.InvoiceSubscription{
+			SettleIndex: settleIndex,
+		})
+		if err != nil {
+			log.Printf("Failed to SubscribeInvoices: %v", err)
+			time.Sleep(resubscribeDelay)
+			continue
+		}
+		atomic.StoreInt32(&l.invoicesStreamAlive, 1)
+
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				log.Printf("Error receiving invoice event: %v", err)
+				atomic.StoreInt32(&l.invoicesStreamAlive, 0)
+				break
+			}
+
+			l.publishInvoiceEvent(res)
+			status, ok := invoiceSettlement(res)
+			if !ok {
+				continue // Only notify for paid invoices
+			}
+			if res.IsAmp && status.SettleIndex <= settleIndex {
+				continue // every update of an AMP invoice has its past settlements
+			}
+			if status.SettleIndex > settleIndex {
+				settleIndex = status.SettleIndex
+			}
+			l.invoices.Publish(status)
+		}
+
+		time.Sleep(resubscribeDelay)
+	}
+}
+
+// resubscribeDelay is how long streams wait before resubscribing after errors.
+var resubscribeDelay = 5 * time.Second
+
+// Compile time check to ensure that LndWallet implements rp.ResumableInvoiceStream
+var _ rp.ResumableInvoiceStream = (*LndWallet)(nil)
+
+// PaidInvoicesStreamSince opens a new subscription that first emits, in order,
+// all invoices settled after settleIndex and then keeps emitting new ones.
+func (l *LndWallet) PaidInvoicesStreamSince(settleIndex uint64) (<-chan rp.InvoiceStatus, error) {
+	stream, err := l.Lightning.SubscribeInvoices(context.Background(), &lnrpc.InvoiceSubscription{
+		SettleIndex: settleIndex,
+	})
 	if err != nil {
-		log.Fatalf("Failed to SubscribeInvoices: %v", err)
+		return nil, fmt.Errorf("error calling SubscribeInvoices: %w", err)
 	}
+
+	listener := make(chan rp.InvoiceStatus)
+	go func() {
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				log.Printf("Error receiving invoice event: %v", err)
+				return
+			}
+
+			status, ok := invoiceSettlement(res)
+			if !ok || status.SettleIndex <= settleIndex {
+				continue
+			}
+			listener <- status
+		}
+	}()
+
+	return listener, nil
+}
+
+func (l *LndWallet) startPaymentsStream() {
+	var lastPaidIndex uint64
+	var pending []*lnrpc.Payment
 	for {
-		res, err := stream.Recv()
-		if err == io.EOF {
+		var err error
+		lastPaidIndex, pending, err = l.pendingPayments()
+		if err == nil {
 			break
 		}
-		if err != nil {
-			log.Printf("Error receiving invoice event: %v", err)
+		if errors.Is(err, rp.ErrInsufficientPermissions) {
+			// like with only an invoice macaroon, there are no payments to stream
+			log.Printf("Not streaming payments: %v", err)
+			return
 		}
+		log.Printf("Failed to list pending payments: %v", err)
+		time.Sleep(resubscribeDelay)
+	}
 
-		if res.State != lnrpc.Invoice_SETTLED {
-			continue // Only notify for paid invoices
-		}
-		for _, listener := range l.invoiceStatusListeners {
-			go func(listener chan rp.InvoiceStatus) {
-				listener <- rp.InvoiceStatus{
-					CheckingID:       hex.EncodeToString(res.RHash),
-					Exists:           true,
-					Paid:             res.State == lnrpc.Invoice_SETTLED,
-					MSatoshiReceived: res.AmtPaidMsat,
-				}
-			}(listener)
+	// track all these pending payments
+	indexOffset := lastPaidIndex
+	for _, payment := range pending {
+		go l.trackOutgoingPayment(payment.PaymentHash)
+		if payment.PaymentIndex > indexOffset {
+			indexOffset = payment.PaymentIndex
 		}
 	}
+
+	// and the ones made from now on, also by other lnd clients
+	l.watchPayments(indexOffset)
 }
 
-func (l *LndWallet) startPaymentsStream() {
+// pendingPayments returns the index of the latest settled payment and the
+// payments after it.
+func (l *LndWallet) pendingPayments() (uint64, []*lnrpc.Payment, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -324,12 +674,12 @@ func (l *LndWallet) startPaymentsStream() {
 		Reversed:          true,
 	})
 	if err != nil {
-		panic(fmt.Errorf("error getting latest paid index: %w", err))
+		return 0, nil, fmt.Errorf("error getting latest paid index: %w", err)
 	}
-	if len(res.Payments) == 0 {
-		return
+	var lastPaidIndex uint64
+	if len(res.Payments) > 0 {
+		lastPaidIndex = res.Payments[0].PaymentIndex
 	}
-	lastPaidIndex := res.Payments[0].PaymentIndex
 
 	// get all pending payments
 	res, err = l.Lightning.ListPayments(ctx, &lnrpc.ListPaymentsRequest{
@@ -338,22 +688,64 @@ func (l *LndWallet) startPaymentsStream() {
 		Reversed:          false,
 	})
 	if err != nil {
-		panic(fmt.Errorf("error listing pending payments: %w", err))
-	}
-
-	// track all these pending payments
-	for _, payment := range res.Payments {
-		go l.trackOutgoingPayment(payment.PaymentHash)
+		return 0, nil, fmt.Errorf("error listing pending payments: %w", err)
 	}
+	return lastPaidIndex, res.Payments, nil
 }
 
+// trackOutgoingPayment publishes the payment once it succeeds or fails. It
+// resubscribes when the connection drops, like when lnd restarts with a new
+// tls.cert, and gives up on payments lnd doesn't know.
 func (l *LndWallet) trackOutgoingPayment(hash string) {
+	if !l.startTracking(hash) {
+		return
+	}
+	defer l.stopTracking(hash)
+
 	paymentHash, err := hex.DecodeString(hash)
 	if err != nil {
-		panic(fmt.Errorf("failed to decode hex on trackOutgoingPayment(%s): %w",
-			hash, err))
+		log.Printf("Failed to decode hex on trackOutgoingPayment(%s): %v", hash, err)
+		return
 	}
 
+	for {
+		payment, err := l.finalPayment(paymentHash)
+		switch {
+		case err == nil:
+		case status.Code(err) == codes.NotFound:
+			return // was never attempted
+		case errors.Is(err, rp.ErrInsufficientPermissions), status.Code(err) == codes.InvalidArgument:
+			// retrying won't help, and it may not even be a payment of ours
+			log.Printf("Can't track payment %s: %v", hash, err)
+			return
+		default:
+			log.Printf("Error tracking payment %s: %v", hash, err)
+			time.Sleep(resubscribeDelay)
+			continue
+		}
+
+		// the same record GetPaymentStatus gives, for consumers keeping accounts
+		resolved := PaymentToStatus(payment)
+		switch payment.Status {
+		case lnrpc.Payment_SUCCEEDED:
+		case lnrpc.Payment_FAILED:
+			// even without htlcs, the stream only has payments that resolved
+			resolved.Status = rp.Failed
+		default:
+			// was never attempted (but maybe it will still be in the next seconds?)
+			return
+		}
+
+		// at this point we know this payment either failed or succeeded
+		l.payments.Publish(resolved)
+		l.events.Publish(rp.PaymentEvent(resolved))
+		return
+	}
+}
+
+// finalPayment waits until the payment succeeds or fails. Errors are returned
+// as they come from grpc so their code can be checked.
+func (l *LndWallet) finalPayment(paymentHash []byte) (*lnrpc.Payment, error) {
 	stream, err := l.Router.TrackPaymentV2(
 		context.Background(),
 		&routerrpc.TrackPaymentRequest{
@@ -362,43 +754,16 @@ func (l *LndWallet) trackOutgoingPayment(hash string) {
 		},
 	)
 	if err != nil {
-		panic(fmt.Errorf(
-			"call to TrackPaymentV2 failed on trackOutgoingPayment(%s): %w", hash, err))
-	}
-
-	status := rp.PaymentStatus{
-		Status:     rp.Unknown,
-		CheckingID: hash,
+		return nil, err
 	}
 
-checkPaymentStatus:
 	for {
 		payment, err := stream.Recv()
 		if err != nil {
-			panic(fmt.Errorf("failed to stream.Recv() on trackOutgoingPayment(%s): %w",
-				hash, err))
+			return nil, err
 		}
-
-		switch payment.Status {
-		case lnrpc.Payment_UNKNOWN:
-			// was never attempted (but maybe it will still be in the next seconds?)
-			return
-		case lnrpc.Payment_SUCCEEDED:
-			status.Status = rp.Complete
-			status.FeePaid = payment.FeeMsat
-			status.Preimage = payment.PaymentPreimage
-			break checkPaymentStatus
-		case lnrpc.Payment_FAILED:
-			status.Status = rp.Failed
-			break checkPaymentStatus
-		default:
-			// all other cases are ignored
-			return
+		if payment.Status != lnrpc.Payment_IN_FLIGHT {
+			return payment, nil
 		}
 	}
-
-	// at this point we know this payment either failed or succeeded
-	for _, listener := range l.paymentStatusListeners {
-		listener <- status
-	}
 }
@@ -1,15 +1,38 @@
 package lnd
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
 	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	rp "github.com/lnbits/relampago"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/chainrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/wtclientrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	macaroon "gopkg.in/macaroon.v2"
 )
 
 //###############//
@@ -45,17 +68,108 @@ func TestGetInfo_Error(t *testing.T) {
 	}
 }
 
-func TestCreateInvoice(t *testing.T) {
+func TestSignMessage(t *testing.T) {
 	lightning, _, lnd := setupMocks()
-	lightning.AddInvoiceMock = func(_ *lnrpc.Invoice) (*lnrpc.AddInvoiceResponse, error) {
-		return &lnrpc.AddInvoiceResponse{RHash: []byte{255}}, nil
+	lightning.SignMessageMock = func(req *lnrpc.SignMessageRequest) (*lnrpc.SignMessageResponse, error) {
+		if string(req.Msg) != "login" {
+			t.Errorf("got %v, wanted %v", string(req.Msg), "login")
+		}
+		return &lnrpc.SignMessageResponse{Signature: "d7xyz"}, nil
 	}
-	lightning.LookupInvoiceMock = func(_ *lnrpc.PaymentHash) (*lnrpc.Invoice, error) {
-		return &lnrpc.Invoice{
-			RHash:          []byte{255},
-			RPreimage:      []byte{5},
-			PaymentRequest: "ln000",
-		}, nil
+	lightning.VerifyMessageMock = func(req *lnrpc.VerifyMessageRequest) (*lnrpc.VerifyMessageResponse, error) {
+		return &lnrpc.VerifyMessageResponse{Valid: req.Signature == "d7xyz", Pubkey: "02aa"}, nil
+	}
+
+	sig, err := lnd.SignMessage("login")
+	if err != nil || sig != "d7xyz" {
+		t.Errorf("got %v %v, wanted %v", sig, err, "d7xyz")
+	}
+	got, err := lnd.VerifyMessage("login", sig)
+	if want := (rp.MessageVerification{Valid: true, Pubkey: "02aa"}); err != nil || got != want {
+		t.Errorf("got %v %v, wanted %v", got, err, want)
+	}
+}
+
+func TestListTowers(t *testing.T) {
+	_, _, lnd := setupMocks()
+	towers := &MockWatchtowerClient{}
+	lnd.Towers = towers
+	towers.ListTowersMock = func(_ *wtclientrpc.ListTowersRequest) (*wtclientrpc.ListTowersResponse, error) {
+		return &wtclientrpc.ListTowersResponse{Towers: []*wtclientrpc.Tower{{
+			Pubkey:                 []byte{2, 0xab},
+			Addresses:              []string{"tower.example:9911"},
+			ActiveSessionCandidate: true,
+			NumSessions:            3,
+		}}}, nil
+	}
+
+	got, err := lnd.ListTowers()
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if len(got) != 1 || got[0].Pubkey != "02ab" || got[0].Addresses[0] != "tower.example:9911" ||
+		!got[0].Active || got[0].Sessions != 3 {
+		t.Errorf("got %v, wanted the tower", got)
+	}
+
+	towers.ListTowersMock = func(_ *wtclientrpc.ListTowersRequest) (*wtclientrpc.ListTowersResponse, error) {
+		return nil, status.Error(codes.Unknown, "watchtower client not active")
+	}
+	if _, err := lnd.ListTowers(); !errors.Is(err, rp.ErrUnsupported) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrUnsupported)
+	}
+}
+
+func TestInterceptHtlcs(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.Interceptor = &InterceptorStreamMock{
+		Requests:  make(chan *routerrpc.ForwardHtlcInterceptRequest),
+		Responses: make(chan *routerrpc.ForwardHtlcInterceptResponse, 1),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	htlcs, err := lnd.InterceptHtlcs(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	key := &routerrpc.CircuitKey{ChanId: 123, HtlcId: 4}
+	go func() {
+		router.Interceptor.Requests <- &routerrpc.ForwardHtlcInterceptRequest{
+			IncomingCircuitKey:      key,
+			IncomingAmountMsat:      101000,
+			OutgoingAmountMsat:      100000,
+			OutgoingRequestedChanId: 456,
+			PaymentHash:             []byte{0xab},
+		}
+	}()
+
+	htlc := <-htlcs
+	if htlc.IncomingChannel != "123" || htlc.IncomingHtlcID != 4 || htlc.OutgoingChannel != "456" ||
+		htlc.PaymentHash != "ab" || htlc.IncomingMsatoshi != 101000 || htlc.OutgoingMsatoshi != 100000 {
+		t.Errorf("got %+v, wanted the intercepted htlc", htlc)
+	}
+
+	if err := htlc.Resolve(rp.HtlcDecision{Action: rp.HtlcSettle, Preimage: "00"}); !errors.Is(err, rp.ErrInvalidParams) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrInvalidParams)
+	}
+	preimage := bytes.Repeat([]byte{1}, 32)
+	if err := htlc.Resolve(rp.HtlcDecision{Action: rp.HtlcSettle, Preimage: hex.EncodeToString(preimage)}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	res := <-router.Interceptor.Responses
+	if res.IncomingCircuitKey != key || res.Action != routerrpc.ResolveHoldForwardAction_SETTLE || !bytes.Equal(res.Preimage, preimage) {
+		t.Errorf("got %v, wanted a settle of the htlc", res)
+	}
+}
+
+func TestCreateInvoice(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	var called *lnrpc.Invoice
+	lightning.AddInvoiceMock = func(req *lnrpc.Invoice) (*lnrpc.AddInvoiceResponse, error) {
+		called = req
+		return &lnrpc.AddInvoiceResponse{RHash: []byte{255}, PaymentRequest: "ln000"}, nil
 	}
 
 	expiry := time.Second
@@ -65,18 +179,157 @@ func TestCreateInvoice(t *testing.T) {
 		DescriptionHash: nil,
 		Expiry:          &expiry,
 	}
+	got, err := lnd.CreateInvoice(params)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	// the preimage is made here and given to lnd
 	want := rp.InvoiceData{
 		CheckingID: "ff",
-		Preimage:   "05",
+		Preimage:   hex.EncodeToString(called.RPreimage),
 		Invoice:    "ln000",
 	}
-	got, err := lnd.CreateInvoice(params)
+	if len(called.RPreimage) != 32 || got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestCreateInvoice_AboveMaximum(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return &lnrpc.GetInfoResponse{}, nil
+	}
+	lightning.AddInvoiceMock = func(_ *lnrpc.Invoice) (*lnrpc.AddInvoiceResponse, error) {
+		t.Errorf("AddInvoice shouldn't be called")
+		return &lnrpc.AddInvoiceResponse{}, nil
+	}
+
+	_, err := lnd.CreateInvoice(rp.InvoiceParams{Msatoshi: MaxPaymentMsatoshi + 1})
+	if !errors.Is(err, rp.ErrInvalidParams) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrInvalidParams)
+	}
+}
+
+func TestCreateInvoice_Wumbo(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	lightning.AddInvoiceMock = func(_ *lnrpc.Invoice) (*lnrpc.AddInvoiceResponse, error) {
+		return &lnrpc.AddInvoiceResponse{}, nil
+	}
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+
+	_, err := lnd.CreateInvoice(rp.InvoiceParams{Msatoshi: MaxPaymentMsatoshi + 1})
+	if !errors.Is(err, rp.ErrWumboRequired) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrWumboRequired)
+	}
+
+	// detected once lnd answers
+
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return &lnrpc.GetInfoResponse{
+			Features: map[uint32]*lnrpc.Feature{
+				uint32(lnrpc.FeatureBit_WUMBO_CHANNELS_OPT): {Name: "wumbo-channels", IsKnown: true},
+			},
+		}, nil
+	}
+
+	_, err = lnd.CreateInvoice(rp.InvoiceParams{Msatoshi: MaxPaymentMsatoshi + 1})
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+}
+
+func TestCreateInvoice_Private(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	var called *lnrpc.Invoice
+	lightning.AddInvoiceMock = func(req *lnrpc.Invoice) (*lnrpc.AddInvoiceResponse, error) {
+		called = req
+		return &lnrpc.AddInvoiceResponse{RHash: []byte{1}, PaymentRequest: "ln000"}, nil
+	}
+
+	if _, err := lnd.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, Private: true}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if !called.Private {
+		t.Errorf("got %v, wanted %v for Private", called.Private, true)
+	}
+}
+
+func TestCreateInvoice_FallbackAddress(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	var called *lnrpc.Invoice
+	lightning.AddInvoiceMock = func(req *lnrpc.Invoice) (*lnrpc.AddInvoiceResponse, error) {
+		called = req
+		return &lnrpc.AddInvoiceResponse{RHash: []byte{1}, PaymentRequest: "ln000"}, nil
+	}
+
+	address := "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"
+	if _, err := lnd.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, FallbackAddress: address}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if called.FallbackAddr != address {
+		t.Errorf("got %v, wanted %v for FallbackAddr", called.FallbackAddr, address)
+	}
+}
+
+func TestCreateInvoice_Hold(t *testing.T) {
+	_, _, lnd := setupMocks()
+	invoices := &MockInvoicesClient{}
+	lnd.Invoices = invoices
+	var called *invoicesrpc.AddHoldInvoiceRequest
+	invoices.AddHoldInvoiceMock = func(req *invoicesrpc.AddHoldInvoiceRequest) (*invoicesrpc.AddHoldInvoiceResp, error) {
+		called = req
+		return &invoicesrpc.AddHoldInvoiceResp{PaymentRequest: "ln000"}, nil
+	}
+
+	hash := rp.DescriptionHash("preimage-holder")
+	want := rp.InvoiceData{CheckingID: hex.EncodeToString(hash), Invoice: "ln000"}
+	got, err := lnd.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, PaymentHash: hash})
 	if err != nil {
 		t.Errorf("got %v, wanted %v", err, nil)
 	}
 	if got != want {
 		t.Errorf("got %v, wanted %v", got, want)
 	}
+	if !bytes.Equal(called.Hash, hash) {
+		t.Errorf("got %x, wanted %x for Hash", called.Hash, hash)
+	}
+}
+
+func TestCancelInvoice(t *testing.T) {
+	_, _, lnd := setupMocks()
+	invoices := &MockInvoicesClient{}
+	lnd.Invoices = invoices
+	var called *invoicesrpc.CancelInvoiceMsg
+	invoices.CancelInvoiceMock = func(req *invoicesrpc.CancelInvoiceMsg) (*invoicesrpc.CancelInvoiceResp, error) {
+		called = req
+		return &invoicesrpc.CancelInvoiceResp{}, nil
+	}
+
+	if err := lnd.CancelInvoice("ff"); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if !bytes.Equal(called.PaymentHash, []byte{255}) {
+		t.Errorf("got %x, wanted %x for PaymentHash", called.PaymentHash, []byte{255})
+	}
+}
+
+func TestPublishInvoiceEvent_Canceled(t *testing.T) {
+	_, _, lnd := setupMocks()
+	events, unsubscribe := lnd.events.Subscribe()
+	defer unsubscribe()
+
+	now := time.Now().Unix()
+	lnd.publishInvoiceEvent(&lnrpc.Invoice{State: lnrpc.Invoice_CANCELED, CreationDate: now, Expiry: 3600})
+	if event := <-events; event.Type != rp.InvoiceCanceled {
+		t.Errorf("got %s, wanted %s", event.Type, rp.InvoiceCanceled)
+	}
+
+	lnd.publishInvoiceEvent(&lnrpc.Invoice{State: lnrpc.Invoice_CANCELED, CreationDate: now - 7200, Expiry: 3600})
+	if event := <-events; event.Type != rp.InvoiceExpired {
+		t.Errorf("got %s, wanted %s", event.Type, rp.InvoiceExpired)
+	}
 }
 
 func TestGetInvoiceStatus(t *testing.T) {
@@ -96,6 +349,8 @@ func TestGetInvoiceStatus(t *testing.T) {
 		Exists:           true,
 		Paid:             true,
 		MSatoshiReceived: 10000,
+		Settlements:      1,
+		Preimage:         "05",
 	}
 	got, err := lnd.GetInvoiceStatus(checkingID)
 	if err != nil {
@@ -105,6 +360,23 @@ func TestGetInvoiceStatus(t *testing.T) {
 		t.Errorf("got %v, wanted %v", got, want)
 	}
 }
+
+func TestPaymentToPaymentStatus_ResolvedAt(t *testing.T) {
+	payment := &lnrpc.Payment{
+		PaymentHash: "ff",
+		Status:      lnrpc.Payment_SUCCEEDED,
+		Htlcs: []*lnrpc.HTLCAttempt{
+			{ResolveTimeNs: 1600000000000000000},
+			{ResolveTimeNs: 1600000005000000000},
+		},
+	}
+
+	got := PaymentToStatus(payment).ResolvedAt
+	if want := time.Unix(1600000005, 0); !got.Equal(want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
 func TestGetInvoiceStatus_NotPaid(t *testing.T) {
 	lightning, _, lnd := setupMocks()
 	lightning.LookupInvoiceMock = func(_ *lnrpc.PaymentHash) (*lnrpc.Invoice, error) {
@@ -135,7 +407,7 @@ func TestGetInvoiceStatus_NotPaid(t *testing.T) {
 func TestGetInvoiceStatus_NotFound(t *testing.T) {
 	lightning, _, lnd := setupMocks()
 	lightning.LookupInvoiceMock = func(_ *lnrpc.PaymentHash) (*lnrpc.Invoice, error) {
-		return nil, errors.New("not found")
+		return nil, status.Error(codes.NotFound, "unable to locate invoice")
 	}
 	checkingID := "ff"
 	want := rp.InvoiceStatus{
@@ -145,22 +417,39 @@ func TestGetInvoiceStatus_NotFound(t *testing.T) {
 		MSatoshiReceived: 0,
 	}
 	got, err := lnd.GetInvoiceStatus(checkingID)
-	if err != nil {
-		t.Errorf("got %v, wanted %v", err, nil)
+	if !errors.Is(err, rp.ErrNotFound) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrNotFound)
 	}
 	if got != want {
 		t.Errorf("got %v, wanted %v", got, want)
 	}
 }
 
+func TestGetInvoiceStatus_Unreachable(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	lightning.LookupInvoiceMock = func(_ *lnrpc.PaymentHash) (*lnrpc.Invoice, error) {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+
+	_, err := lnd.GetInvoiceStatus("ff")
+	if err == nil || errors.Is(err, rp.ErrNotFound) {
+		t.Errorf("got %v, wanted a connection error", err)
+	}
+
+	rp.LegacyInvoiceLookups = true
+	defer func() { rp.LegacyInvoiceLookups = false }()
+	got, err := lnd.GetInvoiceStatus("ff")
+	if err != nil || got.Exists {
+		t.Errorf("got %v, %v, wanted the invoice to not exist and no error", got, err)
+	}
+}
+
 func TestMakePayment(t *testing.T) {
 	_, router, lnd := setupMocks()
 	router.SendPaymentV2Mock = func(req *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error) {
-		return []*lnrpc.Payment{}, nil
-	}
-	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
-		return []*lnrpc.Payment{}, nil
+		return []*lnrpc.Payment{{}}, nil
 	}
+	router.TrackPaymentV2Mock = trackNotFoundFirst()
 
 	params := rp.PaymentParams{
 		Invoice:      "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
@@ -183,9 +472,7 @@ func TestMakePayment_CustomAmount(t *testing.T) {
 		called = req
 		return []*lnrpc.Payment{{}}, nil
 	}
-	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
-		return []*lnrpc.Payment{}, nil
-	}
+	router.TrackPaymentV2Mock = trackNotFoundFirst()
 
 	params := rp.PaymentParams{
 		Invoice:      "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
@@ -204,53 +491,111 @@ func TestMakePayment_CustomAmount(t *testing.T) {
 	}
 }
 
-func TestMakePayment_SendPaymentError(t *testing.T) {
+func TestMakePayment_MaxFee(t *testing.T) {
 	_, router, lnd := setupMocks()
+	var called *routerrpc.SendPaymentRequest
 	router.SendPaymentV2Mock = func(req *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error) {
-		return nil, errors.New("error")
+		called = req
+		return []*lnrpc.Payment{{}}, nil
 	}
-	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
-		return []*lnrpc.Payment{}, nil
+	router.TrackPaymentV2Mock = trackNotFoundFirst()
+
+	_, err := lnd.MakePayment(rp.PaymentParams{
+		Invoice:        "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
+		MaxFeeMsatoshi: 500,
+	})
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if called.FeeLimitMsat != 500 {
+		t.Errorf("got %v, wanted %v for FeeLimitMsat", called.FeeLimitMsat, 500)
+	}
+}
+
+func TestMakePayment_RestrictToPeers(t *testing.T) {
+	lightning, router, lnd := setupMocks()
+	lightning.ListChannelsMock = func(*lnrpc.ListChannelsRequest) (*lnrpc.ListChannelsResponse, error) {
+		return &lnrpc.ListChannelsResponse{
+			Channels: []*lnrpc.Channel{
+				{ChanId: 1, RemotePubkey: "02aa"},
+				{ChanId: 2, RemotePubkey: "02bb"},
+				{ChanId: 3, RemotePubkey: "02aa"},
+			},
+		}, nil
+	}
+	var called *routerrpc.SendPaymentRequest
+	router.SendPaymentV2Mock = func(req *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error) {
+		called = req
+		return []*lnrpc.Payment{{}}, nil
 	}
+	router.TrackPaymentV2Mock = trackNotFoundFirst()
 
 	params := rp.PaymentParams{
-		Invoice:      "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
-		CustomAmount: 10000,
+		Invoice:         "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
+		RestrictToPeers: []string{"02aa"},
 	}
-	_, err := lnd.MakePayment(params)
-	if err == nil {
-		t.Errorf("got %v, wanted error", err)
+	if _, err := lnd.MakePayment(params); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if len(called.OutgoingChanIds) != 2 || called.OutgoingChanIds[0] != 1 || called.OutgoingChanIds[1] != 3 {
+		t.Errorf("got %v, wanted %v for OutgoingChanIds", called.OutgoingChanIds, []uint64{1, 3})
+	}
+
+	params.RestrictToPeers = []string{"02cc"}
+	if _, err := lnd.MakePayment(params); !errors.Is(err, rp.ErrInvalidParams) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrInvalidParams)
+	}
+
+	// only the given channels that are with the peers
+	params.RestrictToPeers = []string{"02aa"}
+	params.OutgoingChannelIDs = []uint64{2, 3}
+	params.AllowDuplicate = true
+	if _, err := lnd.MakePayment(params); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if len(called.OutgoingChanIds) != 1 || called.OutgoingChanIds[0] != 3 {
+		t.Errorf("got %v, wanted %v for OutgoingChanIds", called.OutgoingChanIds, []uint64{3})
 	}
 }
 
-func TestGetPaymentStatus(t *testing.T) {
+func TestMakePayment_OutgoingChannels(t *testing.T) {
 	_, router, lnd := setupMocks()
-	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
-		return []*lnrpc.Payment{{
-			PaymentHash:     "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
-			Status:          lnrpc.Payment_SUCCEEDED,
-			FeeMsat:         10000,
-			PaymentPreimage: "preimage",
-		}}, nil
+	var called *routerrpc.SendPaymentRequest
+	router.SendPaymentV2Mock = func(req *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error) {
+		called = req
+		return []*lnrpc.Payment{{}}, nil
 	}
+	router.TrackPaymentV2Mock = trackNotFoundFirst()
 
-	want := rp.PaymentStatus{
-		CheckingID: "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
-		Status:     rp.Complete,
-		FeePaid:    10000,
-		Preimage:   "preimage",
+	lastHop := "03864ef025fde8fb587d989186ce6a4a186895ee44a926bfc370e2c366597a3f8f"
+	params := rp.PaymentParams{
+		Invoice:            "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
+		OutgoingChannelIDs: []uint64{7},
+		LastHopPubkey:      lastHop,
 	}
-	got, err := lnd.GetPaymentStatus("3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7")
-	if err != nil {
-		t.Errorf("got %v, wanted %v", err, nil)
+	if _, err := lnd.MakePayment(params); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
 	}
-	if got != want {
-		t.Errorf("got %v, wanted %v", got, want)
+	if len(called.OutgoingChanIds) != 1 || called.OutgoingChanIds[0] != 7 {
+		t.Errorf("got %v, wanted %v for OutgoingChanIds", called.OutgoingChanIds, []uint64{7})
+	}
+	if hex.EncodeToString(called.LastHopPubkey) != lastHop {
+		t.Errorf("got %x, wanted %s for LastHopPubkey", called.LastHopPubkey, lastHop)
+	}
+
+	params.LastHopPubkey = "02aa"
+	if _, err := lnd.MakePayment(params); !errors.Is(err, rp.ErrInvalidParams) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrInvalidParams)
 	}
 }
 
-func TestGetPaymentStatus_Incomplete(t *testing.T) {
+func TestMakePayment_Duplicate(t *testing.T) {
 	_, router, lnd := setupMocks()
+	sent := false
+	router.SendPaymentV2Mock = func(req *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error) {
+		sent = true
+		return []*lnrpc.Payment{{}}, nil
+	}
 	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
 		return []*lnrpc.Payment{{
 			PaymentHash: "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
@@ -258,77 +603,750 @@ func TestGetPaymentStatus_Incomplete(t *testing.T) {
 		}}, nil
 	}
 
-	want := rp.PaymentStatus{
-		CheckingID: "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
-		Status:     rp.Pending,
-		FeePaid:    0,
-		Preimage:   "",
+	params := rp.PaymentParams{
+		Invoice: "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
 	}
-	got, err := lnd.GetPaymentStatus("3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7")
+	got, err := lnd.MakePayment(params)
 	if err != nil {
 		t.Errorf("got %v, wanted %v", err, nil)
 	}
-	if got != want {
-		t.Errorf("got %v, wanted %v", got, want)
+	if got.CheckingID != "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7" {
+		t.Errorf("got %v, wanted the existing payment", got)
+	}
+	if sent {
+		t.Errorf("got the payment sent again, wanted the pending one to be reused")
+	}
+
+	params.AllowDuplicate = true
+	if _, err := lnd.MakePayment(params); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if !sent {
+		t.Errorf("got no payment sent, wanted AllowDuplicate to skip the check")
 	}
 }
 
-func TestGetPaymentStatus_NotFound(t *testing.T) {
-	_, router, lnd := setupMocks()
-	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
-		return nil, errors.New("lnd will return an error when it can't find the payment or it wasn't initiated")
+func TestMakePayment_SelfPayment(t *testing.T) {
+	lightning, router, lnd := setupMocks()
+	router.SendPaymentV2Mock = func(req *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error) {
+		t.Errorf("got a payment sent, wanted the self payment refused before")
+		return nil, errors.New("self-payments not allowed")
+	}
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return &lnrpc.GetInfoResponse{
+			IdentityPubkey: "02a0c9089ace681ef4e6ae5310b028d9c2a09187bfbc616da6251e3d08801851b8",
+		}, nil
 	}
 
-	_, err := lnd.GetPaymentStatus("5")
-	if err == nil {
-		t.Errorf("got %v, wanted error", err)
+	params := rp.PaymentParams{
+		Invoice: "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
+	}
+	if _, err := lnd.MakePayment(params); !errors.Is(err, rp.ErrSelfPayment) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrSelfPayment)
 	}
 }
 
-func TestPaidInvoicesStream(t *testing.T) {
-	lightning, _, lnd := setupMocks()
-	PaymentPollInterval = time.Millisecond
-	lightning.SubscribeInvoicesMock = func(sub *lnrpc.InvoiceSubscription) ([]*lnrpc.Invoice, error) {
-		return []*lnrpc.Invoice{
-			{
-				RHash:       []byte{16},
-				State:       lnrpc.Invoice_OPEN,
-				AmtPaidMsat: 0,
-			},
+func TestIsDuplicatePayment(t *testing.T) {
+	if !isDuplicatePayment(status.Error(codes.AlreadyExists, "payment is in transition")) {
+		t.Errorf("got false, wanted an in flight payment to be a duplicate")
+	}
+	if isDuplicatePayment(errors.New("no route")) {
+		t.Errorf("got true, wanted other errors to not be duplicates")
+	}
+}
+
+func TestTrackPayment(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		return []*lnrpc.Payment{
 			{
-				RHash:       []byte{17},
-				State:       lnrpc.Invoice_SETTLED,
-				AmtPaidMsat: 1000,
+				PaymentHash: "ff",
+				Status:      lnrpc.Payment_IN_FLIGHT,
+				Htlcs: []*lnrpc.HTLCAttempt{
+					{Status: lnrpc.HTLCAttempt_IN_FLIGHT, Route: &lnrpc.Route{TotalAmtMsat: 6000, TotalFeesMsat: 1000}},
+					{Status: lnrpc.HTLCAttempt_FAILED, Route: &lnrpc.Route{TotalAmtMsat: 5000}},
+					{Status: lnrpc.HTLCAttempt_IN_FLIGHT, Route: &lnrpc.Route{TotalAmtMsat: 5000}},
+				},
 			},
 		}, nil
 	}
-	lightning.ListPaymentsMock = func(_ *lnrpc.ListPaymentsRequest) (*lnrpc.ListPaymentsResponse, error) {
-		return &lnrpc.ListPaymentsResponse{Payments: []*lnrpc.Payment{}}, nil
-	}
 
-	want := rp.InvoiceStatus{
-		CheckingID:       "11",
-		Exists:           true,
-		Paid:             true,
-		MSatoshiReceived: 1000,
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, err := lnd.TrackPayment(ctx, "ff")
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
 	}
 
-	go lnd.startInvoicesStream()
+	got := <-updates
+	if got.Status != rp.Pending || got.InFlightParts != 2 || got.InFlightMsatoshi != 10000 {
+		t.Errorf("got %v, wanted 2 parts and 10000 msat in flight", got)
+	}
+}
+
+func TestMakePayment_MultiPart(t *testing.T) {
+	_, router, lnd := setupMocks()
+	var called *routerrpc.SendPaymentRequest
+	router.SendPaymentV2Mock = func(req *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error) {
+		called = req
+		return []*lnrpc.Payment{{}}, nil
+	}
+	router.TrackPaymentV2Mock = trackNotFoundFirst()
+
+	params := rp.PaymentParams{
+		Invoice:          "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
+		MaxParts:         4,
+		MaxShardMsatoshi: 5000000,
+		AMP:              true,
+	}
+	if _, err := lnd.MakePayment(params); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if called.MaxParts != 4 || called.MaxShardSizeMsat != 5000000 || !called.Amp {
+		t.Errorf("got %v, wanted MaxParts=4 MaxShardSizeMsat=5000000 Amp=true", called)
+	}
+}
+
+func TestMakePayment_SendPaymentError(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.SendPaymentV2Mock = func(req *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error) {
+		return nil, errors.New("error")
+	}
+	router.TrackPaymentV2Mock = trackNotFoundFirst()
+
+	params := rp.PaymentParams{
+		Invoice:      "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
+		CustomAmount: 10000,
+	}
+	_, err := lnd.MakePayment(params)
+	if err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+}
+
+func TestGetPaymentStatus(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		return []*lnrpc.Payment{{
+			PaymentHash:     "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
+			Status:          lnrpc.Payment_SUCCEEDED,
+			FeeMsat:         10000,
+			PaymentPreimage: "preimage",
+		}}, nil
+	}
+
+	want := rp.PaymentStatus{
+		CheckingID: "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
+		Status:     rp.Complete,
+		FeePaid:    10000,
+		Preimage:   "preimage",
+	}
+	got, err := lnd.GetPaymentStatus("3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7")
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestGetPaymentStatus_Incomplete(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		return []*lnrpc.Payment{{
+			PaymentHash: "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
+			Status:      lnrpc.Payment_IN_FLIGHT,
+		}}, nil
+	}
+
+	want := rp.PaymentStatus{
+		CheckingID: "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
+		Status:     rp.Pending,
+		FeePaid:    0,
+		Preimage:   "",
+	}
+	got, err := lnd.GetPaymentStatus("3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7")
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestGetPaymentStatus_NotFound(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		return nil, errors.New("lnd will return an error when it can't find the payment or it wasn't initiated")
+	}
+
+	_, err := lnd.GetPaymentStatus("5")
+	if err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+}
+
+func TestTrackNewPayments(t *testing.T) {
+	lightning, router, lnd := setupMocks()
+	lightning.ListPaymentsMock = func(req *lnrpc.ListPaymentsRequest) (*lnrpc.ListPaymentsResponse, error) {
+		if req.IndexOffset != 3 || !req.IncludeIncomplete {
+			t.Errorf("got %v, wanted incomplete payments after 3", req)
+		}
+		return &lnrpc.ListPaymentsResponse{Payments: []*lnrpc.Payment{
+			{PaymentHash: "04", PaymentIndex: 4},
+			{PaymentHash: "05", PaymentIndex: 5},
+		}}, nil
+	}
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		return []*lnrpc.Payment{
+			{PaymentHash: hex.EncodeToString(req.PaymentHash), Status: lnrpc.Payment_SUCCEEDED},
+		}, nil
+	}
+
+	stream, _ := lnd.PaymentsStream()
+	if got := lnd.trackNewPayments(3); got != 5 {
+		t.Errorf("got %v, wanted %v", got, 5)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		status := <-stream
+		if status.Status != rp.Complete {
+			t.Errorf("got %v, wanted %v", status.Status, rp.Complete)
+		}
+		seen[status.CheckingID] = true
+	}
+	if !seen["04"] || !seen["05"] {
+		t.Errorf("got %v, wanted both payments", seen)
+	}
+}
+
+func TestStartPaymentsStream_InvoiceMacaroon(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	lightning.ListPaymentsMock = func(req *lnrpc.ListPaymentsRequest) (*lnrpc.ListPaymentsResponse, error) {
+		return nil, &rp.PermissionError{Method: "/lnrpc.Lightning/ListPayments", Err: errors.New("permission denied")}
+	}
+
+	// returns instead of panicking or retrying
+	lnd.startPaymentsStream()
+}
+
+func TestTrackNewPayments_Untrackable(t *testing.T) {
+	lightning, router, lnd := setupMocks()
+	lightning.ListPaymentsMock = func(req *lnrpc.ListPaymentsRequest) (*lnrpc.ListPaymentsResponse, error) {
+		// made by other clients of the node
+		return &lnrpc.ListPaymentsResponse{Payments: []*lnrpc.Payment{
+			{PaymentHash: "not hex", PaymentIndex: 1},
+			{PaymentHash: "02", PaymentIndex: 2},
+			{PaymentHash: "03", PaymentIndex: 3},
+		}}, nil
+	}
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		if hex.EncodeToString(req.PaymentHash) == "02" {
+			return nil, &rp.PermissionError{Method: "/routerrpc.Router/TrackPaymentV2", Err: errors.New("verification failed")}
+		}
+		return []*lnrpc.Payment{
+			{PaymentHash: hex.EncodeToString(req.PaymentHash), Status: lnrpc.Payment_FAILED},
+		}, nil
+	}
+
+	stream, _ := lnd.PaymentsStream()
+	if got := lnd.trackNewPayments(0); got != 3 {
+		t.Errorf("got %v, wanted %v", got, 3)
+	}
+	if got := <-stream; got.CheckingID != "03" || got.Status != rp.Failed {
+		t.Errorf("got %v, wanted 03 failed", got)
+	}
+}
+
+func TestTrackOutgoingPayment_Reconnect(t *testing.T) {
+	defer func(delay time.Duration) { resubscribeDelay = delay }(resubscribeDelay)
+	resubscribeDelay = time.Millisecond
+
+	_, router, lnd := setupMocks()
+	var calls int32
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, status.Error(codes.Unavailable, "lnd is restarting")
+		}
+		return []*lnrpc.Payment{{PaymentHash: "ff", Status: lnrpc.Payment_SUCCEEDED}}, nil
+	}
+
+	stream, _ := lnd.PaymentsStream()
+	go lnd.trackOutgoingPayment("ff")
+	if got := <-stream; got.Status != rp.Complete {
+		t.Errorf("got %v, wanted %v", got.Status, rp.Complete)
+	}
+}
+
+func TestTrackOutgoingPayment_Details(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		return []*lnrpc.Payment{{
+			PaymentHash:     "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
+			PaymentRequest:  "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3",
+			ValueMsat:       5000,
+			FeeMsat:         3,
+			PaymentPreimage: "00",
+			Status:          lnrpc.Payment_SUCCEEDED,
+		}}, nil
+	}
+
+	stream, _ := lnd.PaymentsStream()
+	go lnd.trackOutgoingPayment("3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7")
+	got := <-stream
+	want := rp.PaymentStatus{
+		CheckingID:  "3f06a81e0a0c2ad34ee9df2a30d87a810da9e3c3881f780755ace5e5e64d30a7",
+		Status:      rp.Complete,
+		FeePaid:     3,
+		Preimage:    "00",
+		Msatoshi:    5000,
+		Destination: "02a0c9089ace681ef4e6ae5310b028d9c2a09187bfbc616da6251e3d08801851b8",
+		Description: "test invoice",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, wanted %+v", got, want)
+	}
+}
+
+func TestTrackOutgoingPayment_FailureReason(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		return []*lnrpc.Payment{{
+			PaymentHash:   "ff",
+			Status:        lnrpc.Payment_FAILED,
+			FailureReason: lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE,
+		}}, nil
+	}
+
+	stream, _ := lnd.PaymentsStream()
+	go lnd.trackOutgoingPayment("ff")
+	got := <-stream
+	if got.Status != rp.Failed || got.FailureReason != rp.FailureNoRoute {
+		t.Errorf("got %v %v, wanted %v %v", got.Status, got.FailureReason, rp.Failed, rp.FailureNoRoute)
+	}
+}
+
+func TestTrackOutgoingPayment_NotFound(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.TrackPaymentV2Mock = func(req *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		return nil, status.Error(codes.NotFound, "payment isn't initiated")
+	}
+
+	// returns instead of retrying
+	lnd.trackOutgoingPayment("ff")
+}
+
+func TestBlockStream(t *testing.T) {
+	_, _, lnd := setupMocks()
+	lnd.Chain = &MockChainNotifierClient{Blocks: []*chainrpc.BlockEpoch{
+		{Height: 720000, Hash: []byte{3, 2, 1}},
+		{Height: 720001, Hash: []byte{6, 5, 4}},
+	}}
+
+	stream, err := lnd.BlockStream(context.Background())
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	var got []rp.BlockEpoch
+	for block := range stream {
+		got = append(got, block)
+	}
+	if len(got) != 2 || got[0] != (rp.BlockEpoch{Height: 720000, Hash: "010203"}) ||
+		got[1].Height != 720001 {
+		t.Errorf("got %v, wanted both blocks in order", got)
+	}
+}
+
+func TestPaidInvoicesStream(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	PaymentPollInterval = time.Millisecond
+	lightning.SubscribeInvoicesMock = func(sub *lnrpc.InvoiceSubscription) ([]*lnrpc.Invoice, error) {
+		return []*lnrpc.Invoice{
+			{
+				RHash:       []byte{16},
+				State:       lnrpc.Invoice_OPEN,
+				AmtPaidMsat: 0,
+			},
+			{
+				RHash:       []byte{17},
+				State:       lnrpc.Invoice_SETTLED,
+				AmtPaidMsat: 1000,
+			},
+		}, nil
+	}
+	lightning.ListPaymentsMock = func(_ *lnrpc.ListPaymentsRequest) (*lnrpc.ListPaymentsResponse, error) {
+		return &lnrpc.ListPaymentsResponse{Payments: []*lnrpc.Payment{}}, nil
+	}
+
+	want := rp.InvoiceStatus{
+		CheckingID:       "11",
+		Exists:           true,
+		Paid:             true,
+		MSatoshiReceived: 1000,
+		Settlements:      1,
+	}
+
+	go lnd.startInvoicesStream(0)
+
+	stream, err := lnd.PaidInvoicesStream()
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	got := <-stream
+	if got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestPaidInvoicesStream_SettleIndex(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	indexes := make(chan uint64, 1)
+	lightning.SubscribeInvoicesMock = func(sub *lnrpc.InvoiceSubscription) ([]*lnrpc.Invoice, error) {
+		indexes <- sub.SettleIndex
+		return []*lnrpc.Invoice{
+			{RHash: []byte{17}, State: lnrpc.Invoice_SETTLED, AmtPaidMsat: 1000, SettleIndex: 5},
+		}, nil
+	}
+
+	go lnd.startInvoicesStream(4)
+
+	if got := <-indexes; got != 4 {
+		t.Errorf("got %v, wanted %v", got, 4)
+	}
+}
+
+func TestNewAddress(t *testing.T) {
+	_, _, lnd := setupMocks()
+	lnd.WalletKit = &MockWalletKitClient{
+		NextAddrMock: func(_ *walletrpc.AddrRequest) (*walletrpc.AddrResponse, error) {
+			return &walletrpc.AddrResponse{Addr: "bcrt1qaddress"}, nil
+		},
+	}
+
+	got, err := lnd.NewAddress()
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if got != "bcrt1qaddress" {
+		t.Errorf("got %v, wanted %v", got, "bcrt1qaddress")
+	}
+}
+
+func TestSendOnchain(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	var called *lnrpc.SendCoinsRequest
+	lightning.SendCoinsMock = func(req *lnrpc.SendCoinsRequest) (*lnrpc.SendCoinsResponse, error) {
+		called = req
+		return &lnrpc.SendCoinsResponse{Txid: "txid"}, nil
+	}
+
+	got, err := lnd.SendOnchain("bcrt1qaddress", 50000, 3)
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if got != "txid" {
+		t.Errorf("got %v, wanted %v", got, "txid")
+	}
+	if called.Amount != 50000 || called.SatPerVbyte != 3 || called.Addr != "bcrt1qaddress" {
+		t.Errorf("got %v, wanted amount 50000 and feerate 3 to bcrt1qaddress", called)
+	}
+}
+
+func TestGetOnchainBalance(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	lightning.WalletBalanceMock = func(_ *lnrpc.WalletBalanceRequest) (*lnrpc.WalletBalanceResponse, error) {
+		return &lnrpc.WalletBalanceResponse{
+			TotalBalance:       150,
+			ConfirmedBalance:   100,
+			UnconfirmedBalance: 50,
+		}, nil
+	}
+
+	want := rp.OnchainBalance{Confirmed: 100, Unconfirmed: 50}
+	got, err := lnd.GetOnchainBalance()
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestEstimatePaymentFee(t *testing.T) {
+	_, router, lnd := setupMocks()
+	var called *routerrpc.RouteFeeRequest
+	router.EstimateRouteFeeMock = func(req *routerrpc.RouteFeeRequest) (*routerrpc.RouteFeeResponse, error) {
+		called = req
+		return &routerrpc.RouteFeeResponse{RoutingFeeMsat: 1200, TimeLockDelay: 144}, nil
+	}
+
+	want := rp.FeeEstimate{FeeMsatoshi: 1200, TimeLockDelay: 144}
+	got, err := lnd.EstimatePaymentFee(rp.FeeEstimateParams{
+		Destination: "02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		Msatoshi:    10500,
+	})
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	if called.AmtSat != 11 {
+		t.Errorf("got %v, wanted %v for AmtSat", called.AmtSat, 11)
+	}
+}
+
+func TestEstimatePaymentFee_NoAmount(t *testing.T) {
+	_, _, lnd := setupMocks()
+
+	_, err := lnd.EstimatePaymentFee(rp.FeeEstimateParams{
+		Destination: "02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+	})
+	if err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+}
+
+func TestMissionControlRoundTrip(t *testing.T) {
+	_, router, lnd := setupMocks()
+	router.QueryMissionControlMock = func(*routerrpc.QueryMissionControlRequest) (*routerrpc.QueryMissionControlResponse, error) {
+		return &routerrpc.QueryMissionControlResponse{
+			Pairs: []*routerrpc.PairHistory{
+				{
+					NodeFrom: []byte{0x02, 0xaa},
+					NodeTo:   []byte{0x03, 0xbb},
+					History:  &routerrpc.PairData{FailTime: 1600000000, FailAmtMsat: 50000},
+				},
+			},
+		}, nil
+	}
+	var imported *routerrpc.XImportMissionControlRequest
+	router.XImportMissionControlMock = func(req *routerrpc.XImportMissionControlRequest) (*routerrpc.XImportMissionControlResponse, error) {
+		imported = req
+		return &routerrpc.XImportMissionControlResponse{}, nil
+	}
+
+	pairs, err := lnd.ExportMissionControl()
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	want := rp.PairHistory{
+		From:         "02aa",
+		To:           "03bb",
+		FailTime:     time.Unix(1600000000, 0),
+		FailMsatoshi: 50000,
+	}
+	if len(pairs) != 1 || pairs[0] != want {
+		t.Errorf("got %v, wanted %v", pairs, []rp.PairHistory{want})
+	}
+
+	if err := lnd.ImportMissionControl(pairs); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	got := imported.Pairs[0].History
+	if got.FailTime != 1600000000 || got.FailAmtMsat != 50000 || got.SuccessTime != 0 {
+		t.Errorf("got %v, wanted the exported pair back", got)
+	}
+}
 
-	stream, err := lnd.PaidInvoicesStream()
+func TestPermissionError(t *testing.T) {
+	denied := status.Error(codes.Unknown, "verification failed: signature mismatch after caveat verification")
+	err := permissionError("/routerrpc.Router/SendPaymentV2", denied)
+	if !errors.Is(err, rp.ErrInsufficientPermissions) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrInsufficientPermissions)
+	}
+	var perr *rp.PermissionError
+	if !errors.As(err, &perr) || len(perr.Permissions) != 1 || perr.Permissions[0] != "offchain:write" {
+		t.Errorf("got %v, wanted it to name offchain:write", err)
+	}
+
+	other := status.Error(codes.Unavailable, "connection refused")
+	if err := permissionError("/routerrpc.Router/SendPaymentV2", other); err != other {
+		t.Errorf("got %v, wanted %v", err, other)
+	}
+}
+
+func TestGetNodeInfo(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return &lnrpc.GetInfoResponse{
+			IdentityPubkey: "02aa",
+			Alias:          "relampago",
+			BlockHeight:    720000,
+			Version:        "0.14.1-beta",
+			Chains:         []*lnrpc.Chain{{Chain: "bitcoin", Network: "signet"}},
+		}, nil
+	}
+
+	want := rp.NodeInfo{
+		Pubkey:      "02aa",
+		Alias:       "relampago",
+		Network:     "signet",
+		BlockHeight: 720000,
+		Version:     "0.14.1-beta",
+	}
+	got, err := lnd.GetNodeInfo()
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return &lnrpc.GetInfoResponse{SyncedToChain: true, SyncedToGraph: false}, nil
+	}
+
+	health, err := lnd.Health(context.Background())
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if !health.Connected || !health.SyncedToChain || health.SyncedToGraph {
+		t.Errorf("got %v, wanted connected and synced to chain only", health)
+	}
+	if health.Ready() {
+		t.Errorf("got ready, wanted not ready as invoices aren't subscribed")
+	}
+
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	health, err = lnd.Health(context.Background())
+	if err == nil || health.Connected {
+		t.Errorf("got %v, %v, wanted an error and not connected", health, err)
+	}
+}
+
+func TestPaidInvoicesStreamSince(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	var called *lnrpc.InvoiceSubscription
+	lightning.SubscribeInvoicesMock = func(sub *lnrpc.InvoiceSubscription) ([]*lnrpc.Invoice, error) {
+		called = sub
+		return []*lnrpc.Invoice{
+			{
+				RHash:       []byte{16},
+				State:       lnrpc.Invoice_SETTLED,
+				AmtPaidMsat: 1000,
+				SettleIndex: 3,
+			},
+			{
+				RHash:       []byte{17},
+				State:       lnrpc.Invoice_SETTLED,
+				AmtPaidMsat: 2000,
+				SettleIndex: 5,
+			},
+		}, nil
+	}
+
+	want := rp.InvoiceStatus{
+		CheckingID:       "11",
+		Exists:           true,
+		Paid:             true,
+		MSatoshiReceived: 2000,
+		SettleIndex:      5,
+		Settlements:      1,
+	}
+
+	stream, err := lnd.PaidInvoicesStreamSince(3)
 	if err != nil {
 		t.Errorf("got %v, wanted %v", err, nil)
 	}
+	if called.SettleIndex != 3 {
+		t.Errorf("got %v, wanted %v for SettleIndex", called.SettleIndex, 3)
+	}
 	got := <-stream
 	if got != want {
 		t.Errorf("got %v, wanted %v", got, want)
 	}
 }
 
+func TestChannelPolicies(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	chanPoint := strings.Repeat("ab", 32) + ":1"
+	lightning.ListChannelsMock = func(*lnrpc.ListChannelsRequest) (*lnrpc.ListChannelsResponse, error) {
+		return &lnrpc.ListChannelsResponse{Channels: []*lnrpc.Channel{
+			{ChanId: 1, RemotePubkey: "02a", ChannelPoint: chanPoint, Capacity: 1000000},
+			{ChanId: 2, RemotePubkey: "02b", ChannelPoint: strings.Repeat("cd", 32) + ":0"},
+		}}, nil
+	}
+	lightning.GetChanInfoMock = func(req *lnrpc.ChanInfoRequest) (*lnrpc.ChannelEdge, error) {
+		if req.ChanId == 2 {
+			return nil, status.Error(codes.Unknown, "edge not found")
+		}
+		return &lnrpc.ChannelEdge{
+			Node1Pub:    "02a",
+			Node2Pub:    "03c",
+			Node1Policy: &lnrpc.RoutingPolicy{FeeBaseMsat: 5, TimeLockDelta: 18},
+			Node2Policy: &lnrpc.RoutingPolicy{FeeBaseMsat: 1000, FeeRateMilliMsat: 100, TimeLockDelta: 40},
+		}, nil
+	}
+
+	policies, err := lnd.GetChannelPolicies()
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	want := rp.ChannelPolicy{
+		ChannelInfo:   rp.ChannelInfo{ID: "1", Peer: "02a", CapacitySat: 1000000},
+		ChannelPoint:  chanPoint,
+		RoutingPolicy: rp.RoutingPolicy{FeeBaseMsatoshi: 1000, FeeProportionalMillionths: 100, TimeLockDelta: 40},
+	}
+	if len(policies) != 1 || policies[0] != want {
+		t.Errorf("got %+v, wanted %+v", policies, []rp.ChannelPolicy{want})
+	}
+
+	var called *lnrpc.PolicyUpdateRequest
+	lightning.UpdateChannelPolicyMock = func(req *lnrpc.PolicyUpdateRequest) (*lnrpc.PolicyUpdateResponse, error) {
+		called = req
+		return &lnrpc.PolicyUpdateResponse{}, nil
+	}
+	if err := lnd.UpdateChannelPolicy(chanPoint, 0, 250, 0); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	scope := called.GetChanPoint()
+	if scope == nil || scope.GetFundingTxidStr() != strings.Repeat("ab", 32) || scope.OutputIndex != 1 {
+		t.Errorf("got %v, wanted the channel point %s", called.Scope, chanPoint)
+	}
+	if called.FeeRate != 0.00025 || called.BaseFeeMsat != 0 || called.TimeLockDelta != 40 {
+		t.Errorf("got %v, wanted 250 ppm keeping the time lock delta of 40", called)
+	}
+
+	if err := lnd.UpdateChannelPolicy("", 1000, 1, 0); !errors.Is(err, rp.ErrInvalidParams) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrInvalidParams)
+	}
+	if err := lnd.UpdateChannelPolicy(strings.Repeat("ef", 32)+":0", 1000, 1, 0); !errors.Is(err, rp.ErrNotFound) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrNotFound)
+	}
+	lightning.UpdateChannelPolicyMock = func(*lnrpc.PolicyUpdateRequest) (*lnrpc.PolicyUpdateResponse, error) {
+		return &lnrpc.PolicyUpdateResponse{FailedUpdates: []*lnrpc.FailedUpdate{
+			{Reason: lnrpc.UpdateFailure_UPDATE_FAILURE_NOT_FOUND},
+		}}, nil
+	}
+	if err := lnd.UpdateChannelPolicy(strings.Repeat("ef", 32)+":0", 1000, 1, 40); !errors.Is(err, rp.ErrNotFound) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrNotFound)
+	}
+}
+
 //#############//
 //  END TESTS  //
 //#############//
 
+// trackNotFoundFirst answers the lookup MakePayment does before sending the way
+// lnd does for unknown payments, and leaves the tracking that follows waiting.
+func trackNotFoundFirst() func(*routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+	var calls int32
+	return func(*routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, status.Error(codes.NotFound, "payment isn't initiated")
+		}
+		return []*lnrpc.Payment{}, nil
+	}
+}
+
 type PaymentStreamMock struct {
 	grpc.ClientStream
 	Data chan *lnrpc.Payment
@@ -347,6 +1365,26 @@ func (s InvoiceStreamMock) Recv() (*lnrpc.Invoice, error) {
 	return <-s.Data, nil
 }
 
+type InterceptorStreamMock struct {
+	grpc.ClientStream
+	Requests  chan *routerrpc.ForwardHtlcInterceptRequest
+	Responses chan *routerrpc.ForwardHtlcInterceptResponse
+}
+
+func (s *InterceptorStreamMock) Recv() (*routerrpc.ForwardHtlcInterceptRequest, error) {
+	return <-s.Requests, nil
+}
+
+func (s *InterceptorStreamMock) Send(res *routerrpc.ForwardHtlcInterceptResponse) error {
+	s.Responses <- res
+	return nil
+}
+
+func (m *MockRouterClient) HtlcInterceptor(
+	_ context.Context, _ ...grpc.CallOption) (routerrpc.Router_HtlcInterceptorClient, error) {
+	return m.Interceptor, nil
+}
+
 type MockLightningClient struct {
 	lnrpc.LightningClient
 
@@ -355,13 +1393,33 @@ type MockLightningClient struct {
 	LookupInvoiceMock     func(*lnrpc.PaymentHash) (*lnrpc.Invoice, error)
 	ListPaymentsMock      func(*lnrpc.ListPaymentsRequest) (*lnrpc.ListPaymentsResponse, error)
 	SubscribeInvoicesMock func(*lnrpc.InvoiceSubscription) ([]*lnrpc.Invoice, error)
+	WalletBalanceMock     func(*lnrpc.WalletBalanceRequest) (*lnrpc.WalletBalanceResponse, error)
+	SendCoinsMock         func(*lnrpc.SendCoinsRequest) (*lnrpc.SendCoinsResponse, error)
+	GetInfoMock           func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error)
+	ListChannelsMock      func(*lnrpc.ListChannelsRequest) (*lnrpc.ListChannelsResponse, error)
+	SignMessageMock       func(*lnrpc.SignMessageRequest) (*lnrpc.SignMessageResponse, error)
+	VerifyMessageMock     func(*lnrpc.VerifyMessageRequest) (*lnrpc.VerifyMessageResponse, error)
+	GetChanInfoMock       func(*lnrpc.ChanInfoRequest) (*lnrpc.ChannelEdge, error)
+
+	UpdateChannelPolicyMock func(*lnrpc.PolicyUpdateRequest) (*lnrpc.PolicyUpdateResponse, error)
+}
+
+func (m *MockLightningClient) ListChannels(
+	_ context.Context, req *lnrpc.ListChannelsRequest, _ ...grpc.CallOption) (*lnrpc.ListChannelsResponse, error) {
+	return m.ListChannelsMock(req)
 }
 
 type MockRouterClient struct {
 	routerrpc.RouterClient
 
-	SendPaymentV2Mock  func(request *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error)
-	TrackPaymentV2Mock func(request *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error)
+	SendPaymentV2Mock    func(request *routerrpc.SendPaymentRequest) ([]*lnrpc.Payment, error)
+	TrackPaymentV2Mock   func(request *routerrpc.TrackPaymentRequest) ([]*lnrpc.Payment, error)
+	EstimateRouteFeeMock func(request *routerrpc.RouteFeeRequest) (*routerrpc.RouteFeeResponse, error)
+
+	QueryMissionControlMock   func(*routerrpc.QueryMissionControlRequest) (*routerrpc.QueryMissionControlResponse, error)
+	XImportMissionControlMock func(*routerrpc.XImportMissionControlRequest) (*routerrpc.XImportMissionControlResponse, error)
+
+	Interceptor *InterceptorStreamMock
 }
 
 func (m *MockLightningClient) ChannelBalance(
@@ -398,6 +1456,109 @@ func (m *MockLightningClient) SubscribeInvoices(
 	return client, nil
 }
 
+func (m *MockLightningClient) WalletBalance(
+	_ context.Context, req *lnrpc.WalletBalanceRequest, _ ...grpc.CallOption) (*lnrpc.WalletBalanceResponse, error) {
+	return m.WalletBalanceMock(req)
+}
+
+func (m *MockLightningClient) SendCoins(
+	_ context.Context, req *lnrpc.SendCoinsRequest, _ ...grpc.CallOption) (*lnrpc.SendCoinsResponse, error) {
+	return m.SendCoinsMock(req)
+}
+
+func (m *MockLightningClient) GetInfo(
+	_ context.Context, req *lnrpc.GetInfoRequest, _ ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	return m.GetInfoMock(req)
+}
+
+func (m *MockLightningClient) SignMessage(
+	_ context.Context, req *lnrpc.SignMessageRequest, _ ...grpc.CallOption) (*lnrpc.SignMessageResponse, error) {
+	return m.SignMessageMock(req)
+}
+
+func (m *MockLightningClient) VerifyMessage(
+	_ context.Context, req *lnrpc.VerifyMessageRequest, _ ...grpc.CallOption) (*lnrpc.VerifyMessageResponse, error) {
+	return m.VerifyMessageMock(req)
+}
+
+func (m *MockLightningClient) GetChanInfo(
+	_ context.Context, req *lnrpc.ChanInfoRequest, _ ...grpc.CallOption) (*lnrpc.ChannelEdge, error) {
+	return m.GetChanInfoMock(req)
+}
+
+func (m *MockLightningClient) UpdateChannelPolicy(
+	_ context.Context, req *lnrpc.PolicyUpdateRequest, _ ...grpc.CallOption) (*lnrpc.PolicyUpdateResponse, error) {
+	return m.UpdateChannelPolicyMock(req)
+}
+
+type MockWatchtowerClient struct {
+	wtclientrpc.WatchtowerClientClient
+
+	ListTowersMock func(*wtclientrpc.ListTowersRequest) (*wtclientrpc.ListTowersResponse, error)
+}
+
+func (m *MockWatchtowerClient) ListTowers(
+	_ context.Context, req *wtclientrpc.ListTowersRequest, _ ...grpc.CallOption) (*wtclientrpc.ListTowersResponse, error) {
+	return m.ListTowersMock(req)
+}
+
+type MockInvoicesClient struct {
+	invoicesrpc.InvoicesClient
+
+	AddHoldInvoiceMock func(*invoicesrpc.AddHoldInvoiceRequest) (*invoicesrpc.AddHoldInvoiceResp, error)
+	CancelInvoiceMock  func(*invoicesrpc.CancelInvoiceMsg) (*invoicesrpc.CancelInvoiceResp, error)
+}
+
+func (m *MockInvoicesClient) CancelInvoice(
+	_ context.Context, req *invoicesrpc.CancelInvoiceMsg, _ ...grpc.CallOption) (*invoicesrpc.CancelInvoiceResp, error) {
+	return m.CancelInvoiceMock(req)
+}
+
+func (m *MockInvoicesClient) AddHoldInvoice(
+	_ context.Context, req *invoicesrpc.AddHoldInvoiceRequest, _ ...grpc.CallOption) (*invoicesrpc.AddHoldInvoiceResp, error) {
+	return m.AddHoldInvoiceMock(req)
+}
+
+type MockChainNotifierClient struct {
+	chainrpc.ChainNotifierClient
+
+	Blocks []*chainrpc.BlockEpoch
+}
+
+type BlockEpochStreamMock struct {
+	grpc.ClientStream
+	Data chan *chainrpc.BlockEpoch
+}
+
+func (s BlockEpochStreamMock) Recv() (*chainrpc.BlockEpoch, error) {
+	epoch, ok := <-s.Data
+	if !ok {
+		return nil, errors.New("stream ended")
+	}
+	return epoch, nil
+}
+
+func (m *MockChainNotifierClient) RegisterBlockEpochNtfn(
+	_ context.Context, _ *chainrpc.BlockEpoch, _ ...grpc.CallOption) (chainrpc.ChainNotifier_RegisterBlockEpochNtfnClient, error) {
+	client := BlockEpochStreamMock{Data: make(chan *chainrpc.BlockEpoch, len(m.Blocks))}
+	for _, block := range m.Blocks {
+		client.Data <- block
+	}
+	close(client.Data)
+	return client, nil
+}
+
+type MockWalletKitClient struct {
+	walletrpc.WalletKitClient
+
+	NextAddrMock func(*walletrpc.AddrRequest) (*walletrpc.AddrResponse, error)
+}
+
+func (m *MockWalletKitClient) NextAddr(
+	_ context.Context, req *walletrpc.AddrRequest, _ ...grpc.CallOption) (*walletrpc.AddrResponse, error) {
+	return m.NextAddrMock(req)
+}
+
 func (m *MockRouterClient) SendPaymentV2(
 	_ context.Context, req *routerrpc.SendPaymentRequest, _ ...grpc.CallOption) (routerrpc.Router_SendPaymentV2Client, error) {
 	client := PaymentStreamMock{Data: make(chan *lnrpc.Payment)}
@@ -426,11 +1587,316 @@ func (m *MockRouterClient) TrackPaymentV2(
 	return client, nil
 }
 
+func (m *MockRouterClient) EstimateRouteFee(
+	_ context.Context, req *routerrpc.RouteFeeRequest, _ ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error) {
+	return m.EstimateRouteFeeMock(req)
+}
+
+func (m *MockRouterClient) QueryMissionControl(
+	_ context.Context, req *routerrpc.QueryMissionControlRequest, _ ...grpc.CallOption) (*routerrpc.QueryMissionControlResponse, error) {
+	return m.QueryMissionControlMock(req)
+}
+
+func (m *MockRouterClient) XImportMissionControl(
+	_ context.Context, req *routerrpc.XImportMissionControlRequest, _ ...grpc.CallOption) (*routerrpc.XImportMissionControlResponse, error) {
+	return m.XImportMissionControlMock(req)
+}
+
 func setupMocks() (*MockLightningClient, *MockRouterClient, LndWallet) {
 	lightning := &MockLightningClient{}
+	// a wumbo node, asked by Capabilities and MakePayment, as the test invoice
+	// is for 17500 btc
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return &lnrpc.GetInfoResponse{
+			Features: map[uint32]*lnrpc.Feature{
+				uint32(lnrpc.FeatureBit_WUMBO_CHANNELS_OPT): {Name: "wumbo-channels", IsKnown: true},
+			},
+		}, nil
+	}
 	router := &MockRouterClient{}
 	return lightning, router, LndWallet{
 		Lightning: lightning,
 		Router:    router,
 	}
 }
+
+func TestChannelEvent(t *testing.T) {
+	event, ok := ChannelEventToEvent(&lnrpc.ChannelEventUpdate{
+		Type: lnrpc.ChannelEventUpdate_OPEN_CHANNEL,
+		Channel: &lnrpc.ChannelEventUpdate_OpenChannel{OpenChannel: &lnrpc.Channel{
+			ChanId: 123, RemotePubkey: "02abc", Capacity: 500000,
+		}},
+	})
+	if !ok || event.Type != rp.ChannelOpened {
+		t.Fatalf("got %v %v, wanted a %s event", event.Type, ok, rp.ChannelOpened)
+	}
+	if *event.Channel != (rp.ChannelInfo{ID: "123", Peer: "02abc", CapacitySat: 500000}) {
+		t.Errorf("got %v, wanted the channel info", *event.Channel)
+	}
+
+	if _, ok := ChannelEventToEvent(&lnrpc.ChannelEventUpdate{
+		Type: lnrpc.ChannelEventUpdate_ACTIVE_CHANNEL,
+	}); ok {
+		t.Errorf("got an event for an active channel update, wanted none")
+	}
+}
+
+func TestWithKeepalive(t *testing.T) {
+	o := &options{}
+	if err := WithKeepalive(time.Second, time.Second)(o); err == nil {
+		t.Errorf("got %v, wanted an error for pinging more often than lnd allows", err)
+	}
+
+	if err := WithKeepalive(30*time.Second, 10*time.Second)(o); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if o.keepalive.Time != 30*time.Second || o.keepalive.Timeout != 10*time.Second {
+		t.Errorf("got %v, wanted the given keepalive", o.keepalive)
+	}
+}
+
+func TestCloudHost(t *testing.T) {
+	for endpoint, expected := range map[string]string{
+		"mynode.m.voltageapp.io":               "mynode.m.voltageapp.io:10009",
+		"https://mynode.m.voltageapp.io/":      "mynode.m.voltageapp.io:10009",
+		"https://mynode.m.voltageapp.io:8080/": "mynode.m.voltageapp.io:8080",
+		" mynode.m.voltageapp.io:10009 ":       "mynode.m.voltageapp.io:10009",
+	} {
+		if got := cloudHost(endpoint); got != expected {
+			t.Errorf("%q: got %q, wanted %q", endpoint, got, expected)
+		}
+	}
+}
+
+func TestCheckStartup(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return &lnrpc.GetInfoResponse{
+			SyncedToChain: false,
+			Chains:        []*lnrpc.Chain{{Chain: "bitcoin", Network: "testnet"}},
+		}, nil
+	}
+
+	err := lnd.checkStartup(context.Background(), &options{network: "mainnet"})
+	if !errors.Is(err, ErrWrongNetwork) {
+		t.Errorf("got %v, wanted %v", err, ErrWrongNetwork)
+	}
+	err = lnd.checkStartup(context.Background(), &options{network: "testnet", requireSynced: true})
+	if !errors.Is(err, ErrNotSynced) {
+		t.Errorf("got %v, wanted %v", err, ErrNotSynced)
+	}
+	err = lnd.checkStartup(context.Background(), &options{network: "testnet"})
+	if err != nil {
+		t.Errorf("got %v, wanted it only logged", err)
+	}
+
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return nil, status.Error(codes.Unknown, "verification failed: signature mismatch after caveat verification")
+	}
+	err = lnd.checkStartup(context.Background(), &options{})
+	if !errors.Is(err, ErrInvalidMacaroon) {
+		t.Errorf("got %v, wanted %v", err, ErrInvalidMacaroon)
+	}
+
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	if err := lnd.checkStartup(context.Background(), &options{}); err != nil {
+		t.Errorf("got %v, wanted it only logged", err)
+	}
+}
+
+func TestStartupErrors(t *testing.T) {
+	rest := status.Error(codes.Unknown,
+		`unexpected HTTP status code received from server: 404 (Not Found); transport: received unexpected content-type "text/plain"`)
+	if err := rpcError("node:8080", rest); !errors.Is(err, ErrRESTPort) {
+		t.Errorf("got %v, wanted %v", err, ErrRESTPort)
+	}
+
+	handshake := errors.New(`context deadline exceeded: connection error: desc = "transport: authentication handshake failed: x509: certificate signed by unknown authority"`)
+	if err := dialError("node:10009", handshake); !errors.Is(err, ErrCertMismatch) {
+		t.Errorf("got %v, wanted %v", err, ErrCertMismatch)
+	}
+
+	refused := errors.New("connection refused")
+	if err := dialError("node:10009", refused); errors.Is(err, ErrCertMismatch) || !errors.Is(err, refused) {
+		t.Errorf("got %v, wanted the dial error", err)
+	}
+}
+
+func bakeTestMacaroon(t *testing.T, ops ...*lnrpc.Op) []byte {
+	id, err := proto.Marshal(&lnrpc.MacaroonId{Nonce: []byte{1}, StorageId: []byte("0"), Ops: ops})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := macaroon.New([]byte("root key"), append([]byte{3}, id...), "lnd", macaroon.LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mac
+}
+
+func TestCheckPermissions(t *testing.T) {
+	admin := bakeTestMacaroon(t,
+		&lnrpc.Op{Entity: "info", Actions: []string{"read"}},
+		&lnrpc.Op{Entity: "offchain", Actions: []string{"read", "write"}},
+		&lnrpc.Op{Entity: "onchain", Actions: []string{"read"}},
+		&lnrpc.Op{Entity: "invoices", Actions: []string{"read", "write"}},
+	)
+	if err := checkPermissions(&options{macaroon: admin, requiredMethods: WalletMethods}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+
+	invoice := bakeTestMacaroon(t,
+		&lnrpc.Op{Entity: "invoices", Actions: []string{"read", "write"}},
+		&lnrpc.Op{Entity: "onchain", Actions: []string{"read"}},
+		&lnrpc.Op{Entity: "uri", Actions: []string{"/lnrpc.Lightning/GetInfo"}},
+	)
+	err := checkPermissions(&options{macaroon: invoice, requiredMethods: WalletMethods})
+	if !errors.Is(err, ErrMissingPermissions) || !errors.Is(err, rp.ErrInsufficientPermissions) {
+		t.Fatalf("got %v, wanted %v", err, ErrMissingPermissions)
+	}
+	var permErr *rp.PermissionError
+	errors.As(err, &permErr)
+	if !reflect.DeepEqual(permErr.Permissions, []string{"offchain:read", "offchain:write"}) {
+		t.Errorf("got %v, wanted %v", permErr.Permissions, []string{"offchain:read", "offchain:write"})
+	}
+
+	// a readonly macaroon next to the invoice one
+	readonly := bakeTestMacaroon(t,
+		&lnrpc.Op{Entity: "info", Actions: []string{"read"}},
+		&lnrpc.Op{Entity: "offchain", Actions: []string{"read"}},
+	)
+	o := &options{macaroon: invoice, requiredMethods: ReadOnlyMethods}
+	WithScopedMacaroonBytes(readonlyMacaroonPermissions, readonly)(o)
+	if err := checkPermissions(o); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+
+	if err := checkPermissions(&options{macaroon: invoice}); err != nil {
+		t.Errorf("got %v, wanted nothing checked", err)
+	}
+	if err := checkPermissions(&options{requiredMethods: WalletMethods}); err != nil {
+		t.Errorf("got %v, wanted nothing checked without macaroons", err)
+	}
+
+	// a readonly.macaroon alone is enough for ReadOnlyMethods
+	var readonlyOps []*lnrpc.Op
+	for _, permission := range readonlyMacaroonPermissions {
+		spl := strings.Split(permission, ":")
+		readonlyOps = append(readonlyOps, &lnrpc.Op{Entity: spl[0], Actions: []string{spl[1]}})
+	}
+	o = &options{macaroon: bakeTestMacaroon(t, readonlyOps...), requiredMethods: ReadOnlyMethods}
+	if err := checkPermissions(o); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+
+	// Connect checks WalletMethods unless told otherwise
+	_, err = Connect("localhost:10009", WithInsecure(), WithMacaroonBytes(invoice))
+	if !errors.Is(err, ErrMissingPermissions) {
+		t.Errorf("got %v, wanted %v", err, ErrMissingPermissions)
+	}
+}
+
+type mockStateClient struct {
+	lnrpc.StateClient
+	state lnrpc.WalletState
+}
+
+func (m mockStateClient) GetState(context.Context, *lnrpc.GetStateRequest, ...grpc.CallOption) (*lnrpc.GetStateResponse, error) {
+	return &lnrpc.GetStateResponse{State: m.state}, nil
+}
+
+func TestCheckStartup_Starting(t *testing.T) {
+	lightning, _, lnd := setupMocks()
+	lnd.State = mockStateClient{state: lnrpc.WalletState_UNLOCKED}
+	lightning.GetInfoMock = func(*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+		return nil, status.Error(codes.Unknown, "waiting to start, RPC services not available")
+	}
+
+	err := lnd.checkStartup(context.Background(), &options{requireSynced: true})
+	if !errors.Is(err, ErrNotSynced) {
+		t.Errorf("got %v, wanted %v", err, ErrNotSynced)
+	}
+	if err := lnd.checkStartup(context.Background(), &options{}); err != nil {
+		t.Errorf("got %v, wanted it only logged", err)
+	}
+
+	lnd.State = nil
+	if err := lnd.checkStartup(context.Background(), &options{}); err != nil {
+		t.Errorf("got %v, wanted it only logged", err)
+	}
+}
+
+func testCert(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"lnd autogenerated cert"}},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestWithCertBytes(t *testing.T) {
+	der := testCert(t)
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	for _, raw := range [][]byte{der, pemCert} {
+		o := &options{}
+		if err := WithCertBytes(raw)(o); err != nil || len(o.certs) != 1 {
+			t.Errorf("got %v and %d certs, wanted %v and 1", err, len(o.certs), nil)
+		}
+	}
+	if err := WithCertBytes([]byte("not a cert"))(&options{}); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+
+	_, err := Connect("localhost:10009", WithMacaroonBytes([]byte{2}),
+		WithCertPath("tls.cert"), WithCertBytes(der))
+	if err == nil || !strings.Contains(err.Error(), "both") {
+		t.Errorf("got %v, wanted the cert path and bytes to be refused together", err)
+	}
+}
+
+func TestReloadingCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tls.cert")
+	write := func(modTime time.Time) {
+		pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testCert(t)})
+		if err := ioutil.WriteFile(path, pemCert, 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, modTime, modTime)
+	}
+	write(time.Unix(1600000000, 0))
+
+	creds, err := newReloadingCredentials(path, false)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if creds.reload() {
+		t.Errorf("got a reload, wanted none for the same file")
+	}
+
+	write(time.Unix(1600000060, 0))
+	if !creds.reload() {
+		t.Errorf("got no reload, wanted one for the rotated cert")
+	}
+
+	// half written, the last cert is kept
+	ioutil.WriteFile(path, []byte("-----BEGIN CERT"), 0600)
+	if _, err := creds.current(); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+}
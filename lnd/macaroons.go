@@ -0,0 +1,362 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	macaroon "gopkg.in/macaroon.v2"
+)
+
+// methodPermissions are the permissions lnd requires for each method we call.
+var methodPermissions = map[string][]string{
+	"/lnrpc.Lightning/GetInfo":                       {"info:read"},
+	"/lnrpc.Lightning/GetNodeInfo":                   {"info:read"},
+	"/lnrpc.Lightning/DescribeGraph":                 {"info:read"},
+	"/lnrpc.Lightning/GetChanInfo":                   {"info:read"},
+	"/lnrpc.Lightning/ChannelBalance":                {"offchain:read"},
+	"/lnrpc.Lightning/ListChannels":                  {"offchain:read"},
+	"/lnrpc.Lightning/UpdateChannelPolicy":           {"offchain:write"},
+	"/lnrpc.Lightning/WalletBalance":                 {"onchain:read"},
+	"/lnrpc.Lightning/AddInvoice":                    {"invoices:write"},
+	"/lnrpc.Lightning/LookupInvoice":                 {"invoices:read"},
+	"/lnrpc.Lightning/ListInvoices":                  {"invoices:read"},
+	"/lnrpc.Lightning/SubscribeInvoices":             {"invoices:read"},
+	"/lnrpc.Lightning/ListPayments":                  {"offchain:read"},
+	"/lnrpc.Lightning/SendCoins":                     {"onchain:write"},
+	"/lnrpc.Lightning/NewAddress":                    {"address:write"},
+	"/lnrpc.Lightning/GetTransactions":               {"onchain:read"},
+	"/lnrpc.Lightning/SubscribeTransactions":         {"onchain:read"},
+	"/lnrpc.Lightning/SubscribeChannelEvents":        {"offchain:read"},
+	"/lnrpc.Lightning/SubscribePeerEvents":           {"peers:read"},
+	"/lnrpc.State/GetState":                          {},
+	"/lnrpc.Lightning/BakeMacaroon":                  {"macaroon:generate"},
+	"/lnrpc.Lightning/SignMessage":                   {"message:write"},
+	"/lnrpc.Lightning/VerifyMessage":                 {"message:read"},
+	"/lnrpc.Lightning/SendCustomMessage":             {"offchain:write"},
+	"/lnrpc.Lightning/SubscribeCustomMessages":       {"offchain:read"},
+	"/routerrpc.Router/SendPaymentV2":                {"offchain:write"},
+	"/routerrpc.Router/TrackPaymentV2":               {"offchain:read"},
+	"/routerrpc.Router/SubscribeHtlcEvents":          {"offchain:read"},
+	"/routerrpc.Router/HtlcInterceptor":              {"offchain:read", "offchain:write"},
+	"/routerrpc.Router/EstimateRouteFee":             {"offchain:read"},
+	"/routerrpc.Router/QueryProbability":             {"offchain:read"},
+	"/routerrpc.Router/QueryMissionControl":          {"offchain:read"},
+	"/routerrpc.Router/XImportMissionControl":        {"offchain:write"},
+	"/invoicesrpc.Invoices/AddHoldInvoice":           {"invoices:write"},
+	"/invoicesrpc.Invoices/SettleInvoice":            {"invoices:write"},
+	"/invoicesrpc.Invoices/CancelInvoice":            {"invoices:write"},
+	"/walletrpc.WalletKit/NextAddr":                  {"address:write"},
+	"/chainrpc.ChainNotifier/RegisterBlockEpochNtfn": {"onchain:read"},
+	"/wtclientrpc.WatchtowerClient/AddTower":         {"offchain:write"},
+	"/wtclientrpc.WatchtowerClient/ListTowers":       {"offchain:read"},
+	"/wtclientrpc.WatchtowerClient/RemoveTower":      {"offchain:write"},
+}
+
+// WalletMethods are the calls made by the rp.Wallet methods and the streams
+// opened by Connect, which checks them unless told otherwise with
+// WithRequiredMethods.
+var WalletMethods = []string{
+	"/lnrpc.Lightning/GetInfo",
+	"/lnrpc.Lightning/ChannelBalance",
+	"/lnrpc.Lightning/AddInvoice",
+	"/lnrpc.Lightning/LookupInvoice",
+	"/lnrpc.Lightning/SubscribeInvoices",
+	"/lnrpc.Lightning/ListPayments",
+	"/routerrpc.Router/SendPaymentV2",
+	"/routerrpc.Router/TrackPaymentV2",
+	"/routerrpc.Router/SubscribeHtlcEvents",
+	"/lnrpc.Lightning/SubscribeTransactions",
+}
+
+// ReadOnlyMethods are the WalletMethods a readonly.macaroon allows, for
+// wallets that are only looked at, like by dashboards. CreateInvoice needs
+// invoices:write and fails when called.
+var ReadOnlyMethods = []string{
+	"/lnrpc.Lightning/GetInfo",
+	"/lnrpc.Lightning/ChannelBalance",
+	"/lnrpc.Lightning/LookupInvoice",
+	"/lnrpc.Lightning/SubscribeInvoices",
+	"/lnrpc.Lightning/ListPayments",
+	"/routerrpc.Router/TrackPaymentV2",
+	"/routerrpc.Router/SubscribeHtlcEvents",
+	"/lnrpc.Lightning/SubscribeTransactions",
+}
+
+var (
+	invoiceMacaroonPermissions = []string{
+		"invoices:read", "invoices:write", "address:read", "address:write", "onchain:read",
+	}
+	readonlyMacaroonPermissions = []string{
+		"onchain:read", "offchain:read", "address:read", "message:read", "peers:read",
+		"info:read", "invoices:read", "signer:read", "macaroon:read",
+	}
+)
+
+// WithInvoiceMacaroonPath adds an invoice.macaroon, used for invoice calls.
+func WithInvoiceMacaroonPath(path string) Option {
+	return withScopedMacaroonPath(invoiceMacaroonPermissions, path)
+}
+
+// WithReadonlyMacaroonPath adds a readonly.macaroon, used for all read calls.
+func WithReadonlyMacaroonPath(path string) Option {
+	return withScopedMacaroonPath(readonlyMacaroonPermissions, path)
+}
+
+// WithScopedMacaroonHex adds a macaroon, like one made by BakeMacaroon, that
+// will be used for every call that only needs the given permissions.
+func WithScopedMacaroonHex(permissions []string, macHex string) Option {
+	return func(o *options) error {
+		mac, err := hex.DecodeString(macHex)
+		if err != nil {
+			return fmt.Errorf("macaroon must be hex-encoded: %w", err)
+		}
+		return WithScopedMacaroonBytes(permissions, mac)(o)
+	}
+}
+
+// WithScopedMacaroonBytes is like WithScopedMacaroonHex for a binary macaroon.
+func WithScopedMacaroonBytes(permissions []string, mac []byte) Option {
+	return func(o *options) error {
+		scoped := scopedMacaroon{hex: hex.EncodeToString(mac), permissions: make(map[string]bool)}
+		for _, permission := range permissions {
+			scoped.permissions[permission] = true
+		}
+		o.scopedMacaroons = append(o.scopedMacaroons, scoped)
+		return nil
+	}
+}
+
+func withScopedMacaroonPath(permissions []string, path string) Option {
+	return func(o *options) error {
+		mac, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read macaroon: %w", err)
+		}
+		return WithScopedMacaroonBytes(permissions, mac)(o)
+	}
+}
+
+type scopedMacaroon struct {
+	hex         string
+	permissions map[string]bool // nil means it can do everything
+}
+
+func (s scopedMacaroon) allows(method string) bool {
+	if s.permissions == nil {
+		return true
+	}
+	required, ok := methodPermissions[method]
+	if !ok {
+		return false
+	}
+	for _, permission := range required {
+		if !s.permissions[permission] {
+			return false
+		}
+	}
+	return true
+}
+
+// macaroonOps reads the "entity:action" permissions baked into an lnd
+// macaroon, which lnd keeps in its id.
+func macaroonOps(mac []byte) (map[string]bool, error) {
+	m := &macaroon.Macaroon{}
+	if err := m.UnmarshalBinary(mac); err != nil {
+		return nil, err
+	}
+	id := m.Id()
+	if len(id) == 0 || id[0] != 3 {
+		return nil, errors.New("not an lnd macaroon id")
+	}
+	var decoded lnrpc.MacaroonId
+	if err := proto.Unmarshal(id[1:], &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode macaroon id: %w", err)
+	}
+	ops := make(map[string]bool)
+	for _, op := range decoded.Ops {
+		for _, action := range op.Actions {
+			ops[op.Entity+":"+action] = true
+		}
+	}
+	return ops, nil
+}
+
+// opsAllow tells if a macaroon with ops can call method, through the
+// permissions of the method or one baked for its uri.
+func opsAllow(ops map[string]bool, method string) bool {
+	if ops["uri:"+method] {
+		return true
+	}
+	required, ok := methodPermissions[method]
+	if !ok {
+		return false
+	}
+	for _, permission := range required {
+		if !ops[permission] {
+			return false
+		}
+	}
+	return true
+}
+
+// missingPermissions lists the permissions needed for the methods none of the
+// macaroons allow, sorted.
+func missingPermissions(macs [][]byte, methods []string) ([]string, error) {
+	var allOps []map[string]bool
+	for _, mac := range macs {
+		ops, err := macaroonOps(mac)
+		if err != nil {
+			return nil, err
+		}
+		allOps = append(allOps, ops)
+	}
+
+	seen := make(map[string]bool)
+	var missing []string
+	for _, method := range methods {
+		allowed := false
+		for _, ops := range allOps {
+			if opsAllow(ops, method) {
+				allowed = true
+				break
+			}
+		}
+		if allowed {
+			continue
+		}
+		for _, permission := range methodPermissions[method] {
+			if !seen[permission] {
+				seen[permission] = true
+				missing = append(missing, permission)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// macaroonSet sends every call with the least privileged macaroon that can
+// make it.
+type macaroonSet []scopedMacaroon
+
+func newMacaroonSet(main []byte, scoped []scopedMacaroon) macaroonSet {
+	set := make(macaroonSet, len(scoped))
+	copy(set, scoped)
+	sort.SliceStable(set, func(i, j int) bool {
+		return len(set[i].permissions) < len(set[j].permissions)
+	})
+	if main != nil {
+		set = append(set, scopedMacaroon{hex: hex.EncodeToString(main)})
+	}
+	return set
+}
+
+func (set macaroonSet) pick(method string) string {
+	for _, mac := range set {
+		if mac.allows(method) {
+			return mac.hex
+		}
+	}
+	// none will do, send the most privileged and let lnd complain
+	return set[len(set)-1].hex
+}
+
+func (set macaroonSet) unaryInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, "macaroon", set.pick(method))
+	return permissionError(method, invoker(ctx, method, req, reply, cc, opts...))
+}
+
+func (set macaroonSet) streamInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "macaroon", set.pick(method))
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, permissionError(method, err)
+	}
+	return permissionCheckedStream{stream, method}, nil
+}
+
+// permissionCheckedStream catches permission errors on streams, as lnd only
+// checks the macaroon once the first message is requested.
+type permissionCheckedStream struct {
+	grpc.ClientStream
+	method string
+}
+
+func (s permissionCheckedStream) RecvMsg(m interface{}) error {
+	return permissionError(s.method, s.ClientStream.RecvMsg(m))
+}
+
+// permissionError turns lnd macaroon rejections into an rp.PermissionError
+// naming what the method needs.
+func permissionError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	if st.Code() != codes.PermissionDenied &&
+		!strings.Contains(st.Message(), "permission denied") &&
+		!strings.Contains(st.Message(), "verification failed") {
+		return err
+	}
+	return &rp.PermissionError{
+		Method:      method,
+		Permissions: methodPermissions[method],
+		Err:         err,
+	}
+}
+
+// BakeMacaroon asks lnd for a new macaroon restricted to the given
+// "entity:action" permissions and returns it hex-encoded.
+func (l *LndWallet) BakeMacaroon(permissions []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &lnrpc.BakeMacaroonRequest{}
+	for _, permission := range permissions {
+		spl := strings.Split(permission, ":")
+		if len(spl) != 2 {
+			return "", fmt.Errorf("invalid permission '%s', must be 'entity:action'", permission)
+		}
+		req.Permissions = append(req.Permissions, &lnrpc.MacaroonPermission{
+			Entity: spl[0],
+			Action: spl[1],
+		})
+	}
+
+	res, err := l.Lightning.BakeMacaroon(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("error calling BakeMacaroon: %w", err)
+	}
+
+	return res.Macaroon, nil
+}
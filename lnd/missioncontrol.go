@@ -0,0 +1,86 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.MissionControl
+var _ rp.MissionControl = (*LndWallet)(nil)
+
+func (l *LndWallet) ExportMissionControl() ([]rp.PairHistory, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := l.Router.QueryMissionControl(ctx, &routerrpc.QueryMissionControlRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error calling QueryMissionControl: %w", err)
+	}
+
+	pairs := make([]rp.PairHistory, 0, len(res.Pairs))
+	for _, pair := range res.Pairs {
+		history := rp.PairHistory{
+			From: hex.EncodeToString(pair.NodeFrom),
+			To:   hex.EncodeToString(pair.NodeTo),
+		}
+		if data := pair.History; data != nil {
+			if data.FailTime != 0 {
+				history.FailTime = time.Unix(data.FailTime, 0)
+				history.FailMsatoshi = data.FailAmtMsat
+			}
+			if data.SuccessTime != 0 {
+				history.SuccessTime = time.Unix(data.SuccessTime, 0)
+				history.SuccessMsatoshi = data.SuccessAmtMsat
+			}
+		}
+		pairs = append(pairs, history)
+	}
+
+	return pairs, nil
+}
+
+func (l *LndWallet) ImportMissionControl(pairs []rp.PairHistory) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req := &routerrpc.XImportMissionControlRequest{}
+	for _, pair := range pairs {
+		from, err := hex.DecodeString(pair.From)
+		if err != nil {
+			return fmt.Errorf("invalid node '%s': %w", pair.From, err)
+		}
+		to, err := hex.DecodeString(pair.To)
+		if err != nil {
+			return fmt.Errorf("invalid node '%s': %w", pair.To, err)
+		}
+
+		data := &routerrpc.PairData{}
+		if !pair.FailTime.IsZero() {
+			data.FailTime = pair.FailTime.Unix()
+			data.FailAmtMsat = pair.FailMsatoshi
+			data.FailAmtSat = pair.FailMsatoshi / 1000
+		}
+		if !pair.SuccessTime.IsZero() {
+			data.SuccessTime = pair.SuccessTime.Unix()
+			data.SuccessAmtMsat = pair.SuccessMsatoshi
+			data.SuccessAmtSat = pair.SuccessMsatoshi / 1000
+		}
+
+		req.Pairs = append(req.Pairs, &routerrpc.PairHistory{
+			NodeFrom: from,
+			NodeTo:   to,
+			History:  data,
+		})
+	}
+
+	if _, err := l.Router.XImportMissionControl(ctx, req); err != nil {
+		return fmt.Errorf("error calling XImportMissionControl: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package lnd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.OnchainWallet
+var _ rp.OnchainWallet = (*LndWallet)(nil)
+
+func (l *LndWallet) NewAddress() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := l.WalletKit.NextAddr(ctx, &walletrpc.AddrRequest{})
+	if err != nil {
+		return "", fmt.Errorf("error calling NextAddr: %w", err)
+	}
+
+	return res.Addr, nil
+}
+
+func (l *LndWallet) SendOnchain(address string, satoshi int64, satPerVbyte int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.SendCoins(ctx, &lnrpc.SendCoinsRequest{
+		Addr:        address,
+		Amount:      satoshi,
+		SatPerVbyte: uint64(satPerVbyte),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error calling SendCoins to %s: %w", address, err)
+	}
+
+	return res.Txid, nil
+}
+
+func (l *LndWallet) GetOnchainBalance() (rp.OnchainBalance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.WalletBalance(ctx, &lnrpc.WalletBalanceRequest{})
+	if err != nil {
+		return rp.OnchainBalance{}, fmt.Errorf("error calling WalletBalance: %w", err)
+	}
+
+	return rp.OnchainBalance{
+		Confirmed:   res.ConfirmedBalance,
+		Unconfirmed: res.UnconfirmedBalance,
+	}, nil
+}
+
+func (l *LndWallet) OnchainTxStream() (<-chan rp.OnchainTransaction, error) {
+	listener, _ := l.onchainTxs.Subscribe()
+	return listener, nil
+}
+
+func (l *LndWallet) startTransactionsStream() {
+	for {
+		stream, err := l.Lightning.SubscribeTransactions(context.Background(),
+			&lnrpc.GetTransactionsRequest{})
+		if err != nil {
+			log.Printf("Failed to SubscribeTransactions: %v", err)
+			time.Sleep(resubscribeDelay)
+			continue
+		}
+
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				log.Printf("Error receiving transaction event: %v", err)
+				break
+			}
+
+			l.onchainTxs.Publish(TransactionToOnchain(res))
+		}
+
+		time.Sleep(resubscribeDelay)
+	}
+}
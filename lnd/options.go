@@ -0,0 +1,254 @@
+package lnd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/lnbits/relampago/proxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Option configures how Connect reaches lnd, so credentials can come from
+// files, memory, secret managers and so on.
+type Option func(*options) error
+
+type options struct {
+	certs       []*x509.Certificate
+	certPath    string
+	insecure    bool
+	systemCerts bool
+
+	macaroon        []byte
+	scopedMacaroons []scopedMacaroon
+	requiredMethods []string
+
+	timeout     time.Duration
+	nonBlocking bool
+	keepalive   keepalive.ClientParameters
+	maxMsgSize  int
+	dialOpts    []grpc.DialOption
+
+	network       string
+	requireSynced bool
+	syncTimeout   time.Duration
+
+	settleIndex uint64
+}
+
+// DefaultKeepalive pings lnd when the connection has been idle for a minute,
+// so connections silently dropped by NATs and Tor circuits are noticed and
+// the streams resubscribe.
+var DefaultKeepalive = keepalive.ClientParameters{
+	Time:                time.Minute,
+	Timeout:             20 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// WithCertPath loads the lnd tls.cert from a file. The file is watched and
+// read again when it changes, so certs rotated by lnd are picked up and the
+// connection is made again right away.
+func WithCertPath(path string) Option {
+	return func(o *options) error {
+		o.certPath = path
+		return nil
+	}
+}
+
+// WithCertBytes uses the given lnd tls.cert, PEM or DER-encoded like the one
+// in lndconnect urls. It can't be combined with WithCertPath.
+func WithCertBytes(raw []byte) Option {
+	return func(o *options) error {
+		certs, err := parseCerts(raw)
+		if err != nil {
+			return err
+		}
+		o.certs = append(o.certs, certs...)
+		return nil
+	}
+}
+
+// WithInsecure connects without TLS, for when lnd is behind a TLS-terminating
+// proxy or reached through a local tunnel.
+func WithInsecure() Option {
+	return func(o *options) error {
+		o.insecure = true
+		return nil
+	}
+}
+
+// WithSystemCerts verifies lnd's certificate against the system roots, for
+// nodes behind a publicly trusted certificate like the ones of hosting
+// providers. A tls.cert given too is trusted as well.
+func WithSystemCerts() Option {
+	return func(o *options) error {
+		o.systemCerts = true
+		return nil
+	}
+}
+
+// WithMacaroonPath loads the macaroon from a file.
+func WithMacaroonPath(path string) Option {
+	return func(o *options) error {
+		mac, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read macaroon: %w", err)
+		}
+		o.macaroon = mac
+		return nil
+	}
+}
+
+// WithMacaroonHex uses a hex-encoded macaroon, the format lncli and most
+// hosting providers hand out.
+func WithMacaroonHex(macHex string) Option {
+	return func(o *options) error {
+		mac, err := hex.DecodeString(macHex)
+		if err != nil {
+			return fmt.Errorf("macaroon must be hex-encoded: %w", err)
+		}
+		o.macaroon = mac
+		return nil
+	}
+}
+
+// WithMacaroonBytes uses a binary macaroon.
+func WithMacaroonBytes(mac []byte) Option {
+	return func(o *options) error {
+		o.macaroon = mac
+		return nil
+	}
+}
+
+// WithRequiredMethods makes Connect check the macaroons allow the given calls
+// instead of WalletMethods, like ReadOnlyMethods for a wallet that never pays.
+// Nothing is checked when no methods are given.
+func WithRequiredMethods(methods ...string) Option {
+	return func(o *options) error {
+		o.requiredMethods = methods
+		return nil
+	}
+}
+
+// WithTimeout limits how long Connect waits for the connection to be ready.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		o.timeout = timeout
+		return nil
+	}
+}
+
+// WithNonBlocking makes Connect return without waiting for the connection,
+// which is then made in the background and retried until lnd is reachable.
+// Calls made before that fail like when lnd is down.
+func WithNonBlocking() Option {
+	return func(o *options) error {
+		o.nonBlocking = true
+		return nil
+	}
+}
+
+// WithKeepalive sets how often the connection is pinged when idle and how long
+// to wait for the answer before closing it. lnd closes connections that ping
+// more often than every 5 seconds, see DefaultKeepalive for the default.
+func WithKeepalive(interval, timeout time.Duration) Option {
+	return func(o *options) error {
+		if interval < 5*time.Second {
+			return fmt.Errorf("keepalive interval must be at least 5s, got %s", interval)
+		}
+		o.keepalive = keepalive.ClientParameters{
+			Time:                interval,
+			Timeout:             timeout,
+			PermitWithoutStream: true,
+		}
+		return nil
+	}
+}
+
+// WithMaxMessageSize raises the size of the responses that can be received,
+// 4MB by default, which isn't enough for ListPayments or DescribeGraph on
+// bigger nodes.
+func WithMaxMessageSize(bytes int) Option {
+	return func(o *options) error {
+		o.maxMsgSize = bytes
+		return nil
+	}
+}
+
+// WithNetwork makes Connect fail with ErrWrongNetwork when lnd isn't on the
+// given network, one of mainnet, testnet, signet or regtest.
+func WithNetwork(network string) Option {
+	return func(o *options) error {
+		o.network = network
+		return nil
+	}
+}
+
+// WithRequireSynced makes Connect fail with ErrNotSynced while lnd is still
+// syncing to the chain, which is otherwise only logged.
+func WithRequireSynced() Option {
+	return func(o *options) error {
+		o.requireSynced = true
+		return nil
+	}
+}
+
+// WithAllowUnsynced lets Connect succeed while lnd is still syncing to the
+// chain.
+//
+// Deprecated: that's the default, see WithRequireSynced.
+func WithAllowUnsynced() Option {
+	return func(o *options) error {
+		o.requireSynced = false
+		return nil
+	}
+}
+
+// WithWaitForSync makes Connect wait up to timeout for lnd to be synced to
+// the chain and the graph, and fail with ErrNotSynced if it isn't by then.
+func WithWaitForSync(timeout time.Duration) Option {
+	return func(o *options) error {
+		o.syncTimeout = timeout
+		return nil
+	}
+}
+
+// WithSettleIndex makes the paid invoices stream start after the given
+// InvoiceStatus.SettleIndex, so invoices settled while the service was down
+// are emitted too. By default it starts with the invoices settled from now on.
+func WithSettleIndex(settleIndex uint64) Option {
+	return func(o *options) error {
+		o.settleIndex = settleIndex
+		return nil
+	}
+}
+
+// WithProxy connects through a SOCKS5 proxy, like Tor for nodes only reachable
+// as onion services. With isolate the connection gets its own Tor circuit.
+func WithProxy(address string, isolate bool) Option {
+	return func(o *options) error {
+		dialer, err := proxy.SOCKS5(address, isolate)
+		if err != nil {
+			return err
+		}
+		o.dialOpts = append(o.dialOpts, grpc.WithContextDialer(
+			func(ctx context.Context, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "tcp", addr)
+			},
+		))
+		return nil
+	}
+}
+
+// WithDialOptions appends extra grpc dial options.
+func WithDialOptions(dialOpts ...grpc.DialOption) Option {
+	return func(o *options) error {
+		o.dialOpts = append(o.dialOpts, dialOpts...)
+		return nil
+	}
+}
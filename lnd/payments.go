@@ -0,0 +1,101 @@
+package lnd
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watchPayments finds the payments made after indexOffset and tracks them.
+// New payments are listed as soon as lnd reports an outgoing htlc, so there
+// is no polling, except on lnd versions without SubscribeHtlcEvents.
+func (l *LndWallet) watchPayments(indexOffset uint64) {
+	for {
+		stream, err := l.Router.SubscribeHtlcEvents(context.Background(),
+			&routerrpc.SubscribeHtlcEventsRequest{})
+		if err == nil {
+			for {
+				var event *routerrpc.HtlcEvent
+				event, err = stream.Recv()
+				if err != nil {
+					break
+				}
+				if event.EventType != routerrpc.HtlcEvent_SEND {
+					continue
+				}
+				if _, ok := event.Event.(*routerrpc.HtlcEvent_ForwardEvent); !ok {
+					continue // only new htlcs can belong to new payments
+				}
+				indexOffset = l.trackNewPayments(indexOffset)
+			}
+		}
+
+		if status.Code(err) == codes.Unimplemented {
+			l.pollPayments(indexOffset)
+			return
+		}
+		log.Printf("Error receiving htlc event: %v", err)
+		time.Sleep(resubscribeDelay)
+
+		// catch up with what was missed while disconnected
+		indexOffset = l.trackNewPayments(indexOffset)
+	}
+}
+
+func (l *LndWallet) pollPayments(indexOffset uint64) {
+	for {
+		time.Sleep(PaymentPollInterval)
+		indexOffset = l.trackNewPayments(indexOffset)
+	}
+}
+
+// trackNewPayments tracks the payments after indexOffset that aren't tracked
+// yet and returns the new offset.
+func (l *LndWallet) trackNewPayments(indexOffset uint64) uint64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.ListPayments(ctx, &lnrpc.ListPaymentsRequest{
+		IncludeIncomplete: true,
+		IndexOffset:       indexOffset,
+	})
+	if err != nil {
+		log.Printf("Failed to ListPayments: %v", err)
+		return indexOffset
+	}
+
+	for _, payment := range res.Payments {
+		if payment.PaymentIndex > indexOffset {
+			indexOffset = payment.PaymentIndex
+		}
+		go l.trackOutgoingPayment(payment.PaymentHash)
+	}
+
+	return indexOffset
+}
+
+// startTracking returns false when the payment is already being tracked.
+func (l *LndWallet) startTracking(hash string) bool {
+	l.trackingMu.Lock()
+	defer l.trackingMu.Unlock()
+
+	if l.tracking == nil {
+		l.tracking = make(map[string]bool)
+	}
+	if l.tracking[hash] {
+		return false
+	}
+	l.tracking[hash] = true
+	return true
+}
+
+func (l *LndWallet) stopTracking(hash string) {
+	l.trackingMu.Lock()
+	defer l.trackingMu.Unlock()
+	delete(l.tracking, hash)
+}
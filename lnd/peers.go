@@ -0,0 +1,65 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	decodepay "github.com/fiatjaf/ln-decodepay"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// restrictToPeers makes the payment leave only through channels with the
+// given peers and arrive through one of them when a route hint allows it.
+// Outgoing channels and a last hop already in req narrow it further.
+func (l *LndWallet) restrictToPeers(
+	ctx context.Context,
+	req *routerrpc.SendPaymentRequest,
+	inv decodepay.Bolt11,
+	peers []string,
+) error {
+	allowed := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		allowed[peer] = true
+	}
+
+	res, err := l.Lightning.ListChannels(ctx, &lnrpc.ListChannelsRequest{ActiveOnly: true})
+	if err != nil {
+		return fmt.Errorf("error calling ListChannels: %w", err)
+	}
+	wanted := make(map[uint64]bool, len(req.OutgoingChanIds))
+	for _, id := range req.OutgoingChanIds {
+		wanted[id] = true
+	}
+	req.OutgoingChanIds = nil
+	for _, channel := range res.Channels {
+		if allowed[channel.RemotePubkey] && (len(wanted) == 0 || wanted[channel.ChanId]) {
+			req.OutgoingChanIds = append(req.OutgoingChanIds, channel.ChanId)
+		}
+	}
+	if len(req.OutgoingChanIds) == 0 {
+		return fmt.Errorf("%w: no active channels with any of the allowed peers", rp.ErrInvalidParams)
+	}
+
+	if req.LastHopPubkey != nil {
+		return nil
+	}
+	for _, route := range inv.Route {
+		if len(route) == 0 {
+			continue
+		}
+		lastHop := route[len(route)-1].PubKey
+		if allowed[lastHop] {
+			pubkey, err := hex.DecodeString(lastHop)
+			if err != nil {
+				return fmt.Errorf("invalid route hint pubkey '%s': %w", lastHop, err)
+			}
+			req.LastHopPubkey = pubkey
+			break
+		}
+	}
+
+	return nil
+}
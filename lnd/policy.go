@@ -0,0 +1,102 @@
+package lnd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.PolicyManager
+var _ rp.PolicyManager = (*LndWallet)(nil)
+
+// UpdateChannelPolicy needs a timeLockDelta to update every channel, lnd sets
+// them all at once.
+func (l *LndWallet) UpdateChannelPolicy(chanPoint string, baseFeeMsatoshi, feeRatePPM int64, timeLockDelta uint32) error {
+	if err := rp.ValidateChannelPolicy(chanPoint, baseFeeMsatoshi, feeRatePPM); err != nil {
+		return err
+	}
+
+	req := &lnrpc.PolicyUpdateRequest{
+		BaseFeeMsat:   baseFeeMsatoshi,
+		FeeRate:       float64(feeRatePPM) / 1e6, // lnd takes it as a fraction
+		TimeLockDelta: timeLockDelta,
+	}
+	if chanPoint == "" {
+		if timeLockDelta == 0 {
+			return fmt.Errorf("%w: a time lock delta is needed to update every channel", rp.ErrInvalidParams)
+		}
+		req.Scope = &lnrpc.PolicyUpdateRequest_Global{Global: true}
+	} else {
+		txid, index, _ := rp.ParseChannelPoint(chanPoint)
+		req.Scope = &lnrpc.PolicyUpdateRequest_ChanPoint{ChanPoint: &lnrpc.ChannelPoint{
+			FundingTxid: &lnrpc.ChannelPoint_FundingTxidStr{FundingTxidStr: txid},
+			OutputIndex: index,
+		}}
+	}
+	if req.TimeLockDelta == 0 {
+		current, err := l.channelPolicy(chanPoint)
+		if err != nil {
+			return err
+		}
+		req.TimeLockDelta = current.TimeLockDelta
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.UpdateChannelPolicy(ctx, req)
+	if err != nil {
+		return fmt.Errorf("error calling UpdateChannelPolicy: %w", err)
+	}
+	for _, failed := range res.FailedUpdates {
+		if failed.Reason == lnrpc.UpdateFailure_UPDATE_FAILURE_NOT_FOUND {
+			return fmt.Errorf("%w: channel %s", rp.ErrNotFound, chanPoint)
+		}
+		return fmt.Errorf("failed to update channel %s: %s", chanPoint, failed.UpdateError)
+	}
+	return nil
+}
+
+// GetChannelPolicies leaves out the channels that aren't in the graph yet,
+// which lnd adds them to when they are confirmed.
+func (l *LndWallet) GetChannelPolicies() ([]rp.ChannelPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	res, err := l.Lightning.ListChannels(ctx, &lnrpc.ListChannelsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error calling ListChannels: %w", err)
+	}
+	policies := make([]rp.ChannelPolicy, 0, len(res.Channels))
+	for _, channel := range res.Channels {
+		edge, err := l.Lightning.GetChanInfo(ctx, &lnrpc.ChanInfoRequest{ChanId: channel.ChanId})
+		if err != nil {
+			err = graphError("GetChanInfo", "channel "+channel.ChannelPoint, err)
+			if errors.Is(err, rp.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if policy, ok := ChannelPolicyToRP(channel, edge); ok {
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+func (l *LndWallet) channelPolicy(chanPoint string) (rp.ChannelPolicy, error) {
+	policies, err := l.GetChannelPolicies()
+	if err != nil {
+		return rp.ChannelPolicy{}, err
+	}
+	for _, policy := range policies {
+		if policy.ChannelPoint == chanPoint {
+			return policy, nil
+		}
+	}
+	return rp.ChannelPolicy{}, fmt.Errorf("%w: channel %s", rp.ErrNotFound, chanPoint)
+}
@@ -0,0 +1,92 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	decodepay "github.com/fiatjaf/ln-decodepay"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// MissionControlScorer advises on payments using the success probability lnd's
+// mission control assigns to reaching the destination with the amount. When
+// the probability is too low it advises splitting larger payments and delaying
+// smaller ones.
+type MissionControlScorer struct {
+	Wallet *LndWallet
+
+	MinProbability float64       // defaults to 0.05
+	SplitAbove     int64         // msatoshi, defaults to 100000000
+	SplitParts     uint32        // defaults to 16
+	RetryAfter     time.Duration // defaults to 1 minute
+}
+
+// Compile time check to ensure that MissionControlScorer implements rp.PaymentScorer
+var _ rp.PaymentScorer = (*MissionControlScorer)(nil)
+
+func (s *MissionControlScorer) ScorePayment(params rp.PaymentParams) (rp.PaymentAdvice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inv, err := decodepay.Decodepay(params.Invoice)
+	if err != nil {
+		return rp.PaymentAdvice{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+	}
+	amount := inv.MSatoshi
+	if params.CustomAmount != 0 {
+		amount = params.CustomAmount
+	}
+
+	info, err := s.Wallet.Lightning.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return rp.PaymentAdvice{}, fmt.Errorf("error calling GetInfo: %w", err)
+	}
+	from, _ := hex.DecodeString(info.IdentityPubkey)
+	to, err := hex.DecodeString(inv.Payee)
+	if err != nil {
+		return rp.PaymentAdvice{}, fmt.Errorf("invalid payee '%s': %w", inv.Payee, err)
+	}
+
+	res, err := s.Wallet.Router.QueryProbability(ctx, &routerrpc.QueryProbabilityRequest{
+		FromNode: from,
+		ToNode:   to,
+		AmtMsat:  amount,
+	})
+	if err != nil {
+		return rp.PaymentAdvice{}, fmt.Errorf("error calling QueryProbability: %w", err)
+	}
+
+	advice := rp.PaymentAdvice{Action: rp.Attempt, Probability: res.Probability}
+
+	minProbability := s.MinProbability
+	if minProbability == 0 {
+		minProbability = 0.05
+	}
+	if res.Probability >= minProbability {
+		return advice, nil
+	}
+
+	splitAbove := s.SplitAbove
+	if splitAbove == 0 {
+		splitAbove = 100000000
+	}
+	if amount > splitAbove {
+		advice.Action = rp.Split
+		advice.MaxParts = s.SplitParts
+		if advice.MaxParts == 0 {
+			advice.MaxParts = 16
+		}
+		return advice, nil
+	}
+
+	advice.Action = rp.Delay
+	advice.RetryAfter = s.RetryAfter
+	if advice.RetryAfter == 0 {
+		advice.RetryAfter = time.Minute
+	}
+	return advice, nil
+}
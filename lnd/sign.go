@@ -0,0 +1,39 @@
+package lnd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.MessageSigner
+var _ rp.MessageSigner = (*LndWallet)(nil)
+
+func (l *LndWallet) SignMessage(message string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.SignMessage(ctx, &lnrpc.SignMessageRequest{Msg: []byte(message)})
+	if err != nil {
+		return "", fmt.Errorf("error calling SignMessage: %w", err)
+	}
+	return res.Signature, nil
+}
+
+// VerifyMessage only recognizes signatures of nodes in the graph of lnd.
+func (l *LndWallet) VerifyMessage(message, signature string) (rp.MessageVerification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.VerifyMessage(ctx, &lnrpc.VerifyMessageRequest{
+		Msg:       []byte(message),
+		Signature: signature,
+	})
+	if err != nil {
+		return rp.MessageVerification{}, fmt.Errorf("error calling VerifyMessage: %w", err)
+	}
+	return rp.MessageVerification{Valid: res.Valid, Pubkey: res.Pubkey}, nil
+}
@@ -0,0 +1,192 @@
+package lnd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+)
+
+// CertCheckInterval is how often a tls.cert given by path is checked for
+// changes.
+var CertCheckInterval = 10 * time.Second
+
+// parseCerts reads PEM certs, or a single DER one.
+func parseCerts(raw []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := raw
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cert: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, errors.New("failed to parse cert, it must be PEM or DER-encoded")
+	}
+	return []*x509.Certificate{cert}, nil
+}
+
+// certPool trusts certs, on top of the system roots when system is set.
+func certPool(certs []*x509.Certificate, system bool) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if system {
+		var err error
+		if pool, err = x509.SystemCertPool(); err != nil {
+			return nil, fmt.Errorf("failed to load the system certs: %w", err)
+		}
+	}
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// reloadingCredentials reads the tls.cert again whenever the file changes, so
+// when lnd rotates it the next (re)connection just uses the new one instead of
+// failing until we're restarted.
+type reloadingCredentials struct {
+	path       string
+	system     bool
+	serverName string
+
+	mu      sync.Mutex
+	modTime time.Time
+	creds   credentials.TransportCredentials
+}
+
+func newReloadingCredentials(path string, system bool) (*reloadingCredentials, error) {
+	r := &reloadingCredentials{path: path, system: system}
+	if _, err := r.current(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *reloadingCredentials) current() (credentials.TransportCredentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stat, err := os.Stat(r.path)
+	if err != nil {
+		if r.creds != nil {
+			// maybe it's being replaced, keep using the one we have
+			return r.creds, nil
+		}
+		return nil, fmt.Errorf("failed to read cert: %w", err)
+	}
+	if r.creds != nil && stat.ModTime().Equal(r.modTime) {
+		return r.creds, nil
+	}
+
+	raw, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cert: %w", err)
+	}
+	certs, err := parseCerts(raw)
+	if err != nil {
+		if r.creds != nil {
+			// maybe it's half written, try again later
+			return r.creds, nil
+		}
+		return nil, err
+	}
+	pool, err := certPool(certs, r.system)
+	if err != nil {
+		return nil, err
+	}
+
+	r.creds = credentials.NewClientTLSFromCert(pool, r.serverName)
+	r.modTime = stat.ModTime()
+	return r.creds, nil
+}
+
+// reload reads the cert again if the file changed, telling if it did.
+func (r *reloadingCredentials) reload() bool {
+	r.mu.Lock()
+	before := r.modTime
+	r.mu.Unlock()
+
+	if _, err := r.current(); err != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.modTime.Equal(before)
+}
+
+// watch checks the file every CertCheckInterval until conn is closed. When
+// the cert changes conn dials again right away, instead of waiting out its
+// reconnection backoff after lnd restarted with the new cert.
+func (r *reloadingCredentials) watch(conn *grpc.ClientConn) {
+	for {
+		time.Sleep(CertCheckInterval)
+		if conn.GetState() == connectivity.Shutdown {
+			return
+		}
+		if r.reload() {
+			conn.ResetConnectBackoff()
+		}
+	}
+}
+
+func (r *reloadingCredentials) ClientHandshake(
+	ctx context.Context,
+	authority string,
+	rawConn net.Conn,
+) (net.Conn, credentials.AuthInfo, error) {
+	creds, err := r.current()
+	if err != nil {
+		return nil, nil, err
+	}
+	return creds.ClientHandshake(ctx, authority, rawConn)
+}
+
+func (r *reloadingCredentials) ServerHandshake(net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("reloadingCredentials are only for clients")
+}
+
+func (r *reloadingCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "tls",
+		SecurityVersion:  "1.2",
+		ServerName:       r.serverName,
+	}
+}
+
+func (r *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{path: r.path, system: r.system, serverName: r.serverName}
+}
+
+func (r *reloadingCredentials) OverrideServerName(serverName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.serverName = serverName
+	r.creds = nil
+	return nil
+}
@@ -0,0 +1,60 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	rp "github.com/lnbits/relampago"
+)
+
+// Compile time check to ensure that LndWallet implements rp.PaymentTracker
+var _ rp.PaymentTracker = (*LndWallet)(nil)
+
+func (l *LndWallet) TrackPayment(ctx context.Context, checkingID string) (<-chan rp.PaymentStatus, error) {
+	paymentHash, err := hex.DecodeString(checkingID)
+	if err != nil {
+		return nil, fmt.Errorf("checkingID must be a valid payment hash 32-byte hex, got '%s': %w", checkingID, err)
+	}
+
+	stream, err := l.Router.TrackPaymentV2(ctx, &routerrpc.TrackPaymentRequest{
+		PaymentHash: paymentHash,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calling TrackPaymentV2: %w", err)
+	}
+
+	updates := make(chan rp.PaymentStatus)
+	go func() {
+		defer close(updates)
+		for {
+			payment, err := stream.Recv()
+			if err != nil {
+				return
+			}
+
+			status := PaymentToStatus(payment)
+			for _, htlc := range payment.Htlcs {
+				if htlc.Status == lnrpc.HTLCAttempt_IN_FLIGHT {
+					status.InFlightParts++
+					if htlc.Route != nil {
+						status.InFlightMsatoshi += htlc.Route.TotalAmtMsat - htlc.Route.TotalFeesMsat
+					}
+				}
+			}
+
+			select {
+			case updates <- status:
+			case <-ctx.Done():
+				return
+			}
+			if status.Status.Final() {
+				return
+			}
+		}
+	}()
+
+	return updates, nil
+}
@@ -0,0 +1,79 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc/wtclientrpc"
+	rp "github.com/lnbits/relampago"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Compile time check to ensure that LndWallet implements rp.WatchtowerManager
+var _ rp.WatchtowerManager = (*LndWallet)(nil)
+
+func (l *LndWallet) AddTower(pubkey, address string) error {
+	key, err := hex.DecodeString(pubkey)
+	if err != nil || len(key) != 33 {
+		return fmt.Errorf("%w: invalid tower pubkey '%s'", rp.ErrInvalidParams, pubkey)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err = l.Towers.AddTower(ctx, &wtclientrpc.AddTowerRequest{Pubkey: key, Address: address})
+	if err != nil {
+		return towerError("AddTower", err)
+	}
+	return nil
+}
+
+func (l *LndWallet) ListTowers() ([]rp.Tower, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := l.Towers.ListTowers(ctx, &wtclientrpc.ListTowersRequest{})
+	if err != nil {
+		return nil, towerError("ListTowers", err)
+	}
+
+	towers := make([]rp.Tower, 0, len(res.Towers))
+	for _, tower := range res.Towers {
+		towers = append(towers, rp.Tower{
+			Pubkey:    hex.EncodeToString(tower.Pubkey),
+			Addresses: tower.Addresses,
+			Active:    tower.ActiveSessionCandidate,
+			Sessions:  int(tower.NumSessions),
+		})
+	}
+	return towers, nil
+}
+
+func (l *LndWallet) RemoveTower(pubkey, address string) error {
+	key, err := hex.DecodeString(pubkey)
+	if err != nil || len(key) != 33 {
+		return fmt.Errorf("%w: invalid tower pubkey '%s'", rp.ErrInvalidParams, pubkey)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err = l.Towers.RemoveTower(ctx, &wtclientrpc.RemoveTowerRequest{Pubkey: key, Address: address})
+	if err != nil {
+		return towerError("RemoveTower", err)
+	}
+	return nil
+}
+
+// towerError tells apart nodes running without the watchtower client, which
+// is off unless wtclient.active is set.
+func towerError(method string, err error) error {
+	if status.Code(err) == codes.Unimplemented || strings.Contains(err.Error(), "watchtower client not active") {
+		return fmt.Errorf("%w: the watchtower client of lnd is not active", rp.ErrUnsupported)
+	}
+	return fmt.Errorf("error calling %s: %w", method, err)
+}
@@ -0,0 +1,39 @@
+package lnd
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// detectWumbo checks whether the node advertises wumbo channels, which lift
+// the limit on how much a single payment can carry. It also returns the node
+// pubkey, to recognize invoices issued by this node.
+//
+// lnd is asked again on every call until it answers, as it may not be
+// reachable on Connect, like with WithNonBlocking.
+func (l *LndWallet) detectWumbo() (wumbo bool, pubkey string) {
+	l.featuresMu.Lock()
+	defer l.featuresMu.Unlock()
+	if l.featuresKnown {
+		return l.wumbo, l.pubkey
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := l.Lightning.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		log.Printf("Failed to GetInfo, assuming no wumbo for now: %v", err)
+		return false, ""
+	}
+
+	_, required := res.Features[uint32(lnrpc.FeatureBit_WUMBO_CHANNELS_REQ)]
+	_, optional := res.Features[uint32(lnrpc.FeatureBit_WUMBO_CHANNELS_OPT)]
+	l.wumbo = required || optional
+	l.pubkey = res.IdentityPubkey
+	l.featuresKnown = true
+	return l.wumbo, l.pubkey
+}
@@ -0,0 +1,133 @@
+// Package lnurl serves LNURL-pay and LNURL-withdraw endpoints backed by any
+// wallet, see PayHandler and WithdrawHandler.
+package lnurl
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Encode returns the bech32-encoded lnurl for a url, to be shown as a QR
+// code or link.
+func Encode(url string) string {
+	data := convertBits([]byte(url), 8, 5)
+	return strings.ToUpper(bech32Encode("lnurl", data))
+}
+
+// Decode returns the url of a bech32-encoded lnurl, with or without the
+// lightning: prefix.
+func Decode(lnurl string) (string, error) {
+	lnurl = strings.ToLower(strings.TrimSpace(lnurl))
+	lnurl = strings.TrimPrefix(lnurl, "lightning:")
+
+	sep := strings.LastIndexByte(lnurl, '1')
+	if sep < 0 || lnurl[:sep] != "lnurl" || len(lnurl)-sep-1 < 6 {
+		return "", errors.New("not an lnurl")
+	}
+	var data []byte
+	for _, c := range lnurl[sep+1:] {
+		v := strings.IndexRune(charset, c)
+		if v < 0 {
+			return "", errors.New("invalid lnurl character")
+		}
+		data = append(data, byte(v))
+	}
+	if bech32Polymod(append(hrpExpand("lnurl"), data...)) != 1 {
+		return "", errors.New("invalid lnurl checksum")
+	}
+
+	// the padding bits left at the end are dropped
+	url := convertBits(data[:len(data)-6], 5, 8)
+	if bits := (len(data) - 6) * 5; bits%8 != 0 {
+		url = url[:bits/8]
+	}
+	return string(url), nil
+}
+
+type errorResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type okResponse struct {
+	Status string `json:"status"`
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with the LNURL error format, which wallets expect with a
+// 200 status.
+func writeError(w http.ResponseWriter, reason string) {
+	writeJSON(w, errorResponse{Status: "ERROR", Reason: reason})
+}
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Encode(hrp string, data []byte) string {
+	values := append(hrpExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, d := range data {
+		b.WriteByte(charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return b.String()
+}
+
+func hrpExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// convertBits regroups bits, padding the last group with zeros.
+func convertBits(data []byte, from, to uint) []byte {
+	var acc uint32
+	var bits uint
+	var out []byte
+	maxv := uint32(1)<<to - 1
+	for _, b := range data {
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if bits > 0 {
+		out = append(out, byte(acc<<(to-bits)&maxv))
+	}
+	return out
+}
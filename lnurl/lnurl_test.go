@@ -0,0 +1,145 @@
+package lnurl
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+func TestEncode(t *testing.T) {
+	// from LUD-01
+	url := "https://service.com/api?q=3fc3645b439ce8e7f2553a69e5267081d96dcd340693afabe04be7b0ccd178df"
+	expected := "LNURL1DP68GURN8GHJ7UM9WFMXJCM99E3K7MF0V9CXJ0M385EKVCENXC6R2C35XVUKXEFCV5MKVV34X5EKZD3EV56NYD3HXQURZEPEXEJXXEPNXSCRVWFNV9NXZCN9XQ6XYEFHVGCXXCMYXYMNSERXFQ5FNS"
+	if got := Encode(url); got != expected {
+		t.Errorf("got %s, wanted %s", got, expected)
+	}
+}
+
+func TestPayHandler(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	var credited int64
+	h := NewPayHandler(PayParams{
+		Wallet:         tw,
+		URL:            "https://example.com/lnurlp",
+		Description:    "tips",
+		MinSendable:    1000,
+		MaxSendable:    1000000,
+		CommentAllowed: 10,
+		OnInvoice: func(invoice rp.InvoiceData, msatoshi int64, comment string) {
+			credited += msatoshi
+		},
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/lnurlp", nil))
+	var req payRequest
+	json.Unmarshal(w.Body.Bytes(), &req)
+	if req.Tag != "payRequest" || req.Callback != h.URL || req.Metadata != `[["text/plain","tips"]]` {
+		t.Errorf("got %+v, wanted the payRequest", req)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/lnurlp?amount=5000&comment=thanks", nil))
+	var res payResponse
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.PR == "" || credited != 5000 {
+		t.Errorf("got %s with %d credited, wanted an invoice for 5000", w.Body.String(), credited)
+	}
+
+	for _, query := range []string{"amount=10", "amount=5000&comment=too+long+comment"} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/lnurlp?"+query, nil))
+		var e errorResponse
+		json.Unmarshal(w.Body.Bytes(), &e)
+		if e.Status != "ERROR" {
+			t.Errorf("%s: got %s, wanted an error", query, w.Body.String())
+		}
+	}
+}
+
+func TestWithdrawHandler(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	h := NewWithdrawHandler(WithdrawParams{Wallet: tw, URL: "https://example.com/lnurlw"})
+
+	link, k1, err := h.NewLink(WithdrawLink{MinWithdrawable: 1000, MaxWithdrawable: 10000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", link, nil))
+	var req withdrawRequest
+	json.Unmarshal(w.Body.Bytes(), &req)
+	if req.Tag != "withdrawRequest" || req.K1 != k1 || req.MaxWithdrawable != 10000 {
+		t.Errorf("got %+v, wanted the withdrawRequest", req)
+	}
+
+	h.RevokeLink(k1)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", link, nil))
+	var e errorResponse
+	json.Unmarshal(w.Body.Bytes(), &e)
+	if e.Status != "ERROR" {
+		t.Errorf("got %s, wanted an error for a revoked link", w.Body.String())
+	}
+}
+
+type failingPayer struct {
+	*testwallet.TestWallet
+	status rp.Status
+}
+
+func (w failingPayer) MakePayment(rp.PaymentParams) (rp.PaymentData, error) {
+	return rp.PaymentData{}, errors.New("timeout")
+}
+
+func (w failingPayer) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	return rp.PaymentStatus{CheckingID: checkingID, Status: w.status}, nil
+}
+
+func TestWithdrawHandler_FailedPayment(t *testing.T) {
+	// from BOLT11, for 250000000 msat
+	pr := "lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srp"
+
+	tw, _ := testwallet.Start(testwallet.Params{})
+	for status, restored := range map[rp.Status]bool{
+		rp.NeverTried: true,
+		rp.Failed:     true,
+		rp.Pending:    false,
+		rp.Unknown:    false,
+	} {
+		h := NewWithdrawHandler(WithdrawParams{
+			Wallet: failingPayer{tw, status},
+			URL:    "https://example.com/lnurlw",
+		})
+		_, k1, _ := h.NewLink(WithdrawLink{MinWithdrawable: 1000, MaxWithdrawable: 300000000})
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/lnurlw?k1="+k1+"&pr="+pr, nil))
+		var e errorResponse
+		json.Unmarshal(w.Body.Bytes(), &e)
+		if e.Status != "ERROR" {
+			t.Errorf("%s: got %s, wanted an error", status, w.Body.String())
+		}
+		if _, ok := h.links[k1]; ok != restored {
+			t.Errorf("%s: got the link usable %v, wanted %v", status, ok, restored)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	url := "https://service.com/api?q=3fc3645b439ce8e7f2553a69e5267081d96dcd340693afabe04be7b0ccd178df"
+	for _, lnurl := range []string{Encode(url), "lightning:" + Encode(url), strings.ToLower(Encode(url))} {
+		if got, err := Decode(lnurl); err != nil || got != url {
+			t.Errorf("got %s %v, wanted %s", got, err, url)
+		}
+	}
+	if _, err := Decode(Encode(url)[:40]); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+}
@@ -0,0 +1,122 @@
+package lnurl
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type PayParams struct {
+	Wallet rp.Wallet
+
+	// URL is the absolute url the handler is served at, wallets are sent back
+	// to it with the amount to get the invoice.
+	URL string
+
+	Description string
+	MinSendable int64 // msatoshi
+	MaxSendable int64 // msatoshi
+
+	// CommentAllowed is the length of the comments payers can send, zero
+	// disables them.
+	CommentAllowed int
+
+	// Identifier is the lightning address the payRequest is served for, if
+	// any, which is then committed to in the invoice metadata.
+	Identifier string
+
+	// OnInvoice is called for every invoice created, so the payment can be
+	// credited to whoever this endpoint belongs to.
+	OnInvoice func(invoice rp.InvoiceData, msatoshi int64, comment string)
+}
+
+// PayHandler serves an LNURL-pay endpoint: the payRequest when called without
+// an amount and the invoice, committing to its metadata, when called with it.
+type PayHandler struct {
+	PayParams
+	metadata string
+}
+
+type payRequest struct {
+	Tag            string `json:"tag"`
+	Callback       string `json:"callback"`
+	MinSendable    int64  `json:"minSendable"`
+	MaxSendable    int64  `json:"maxSendable"`
+	Metadata       string `json:"metadata"`
+	CommentAllowed int    `json:"commentAllowed,omitempty"`
+}
+
+type payResponse struct {
+	PR     string        `json:"pr"`
+	Routes []interface{} `json:"routes"`
+}
+
+func NewPayHandler(params PayParams) *PayHandler {
+	metadata := [][]string{{"text/plain", params.Description}}
+	if params.Identifier != "" {
+		metadata = append(metadata, []string{"text/identifier", params.Identifier})
+	}
+	encoded, _ := json.Marshal(metadata)
+
+	return &PayHandler{PayParams: params, metadata: string(encoded)}
+}
+
+// Metadata is the metadata string invoices commit to.
+func (h *PayHandler) Metadata() string {
+	return h.metadata
+}
+
+func (h *PayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	amount := q.Get("amount")
+	if amount == "" {
+		writeJSON(w, payRequest{
+			Tag:            "payRequest",
+			Callback:       h.URL,
+			MinSendable:    h.MinSendable,
+			MaxSendable:    h.MaxSendable,
+			Metadata:       h.metadata,
+			CommentAllowed: h.CommentAllowed,
+		})
+		return
+	}
+
+	msatoshi, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil {
+		writeError(w, fmt.Sprintf("invalid amount '%s'", amount))
+		return
+	}
+	if msatoshi < h.MinSendable || msatoshi > h.MaxSendable {
+		writeError(w, fmt.Sprintf("amount must be between %d and %d msat",
+			h.MinSendable, h.MaxSendable))
+		return
+	}
+
+	comment := q.Get("comment")
+	if len(comment) > h.CommentAllowed {
+		writeError(w, fmt.Sprintf("comment can't be longer than %d characters", h.CommentAllowed))
+		return
+	}
+
+	invoice, err := h.Wallet.CreateInvoice(rp.InvoiceParams{
+		Msatoshi:        msatoshi,
+		Description:     h.metadata,
+		DescriptionHash: rp.DescriptionHash(h.metadata),
+	})
+	if err != nil {
+		log.Printf("lnurl-pay failed to create invoice: %v", err)
+		writeError(w, "failed to create invoice")
+		return
+	}
+
+	if h.OnInvoice != nil {
+		h.OnInvoice(invoice, msatoshi, comment)
+	}
+
+	writeJSON(w, payResponse{PR: invoice.Invoice, Routes: []interface{}{}})
+}
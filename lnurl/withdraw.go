@@ -0,0 +1,147 @@
+package lnurl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type WithdrawParams struct {
+	Wallet rp.Wallet
+
+	// URL is the absolute url the handler is served at, links point to it and
+	// wallets are sent back to it with the invoice to be paid.
+	URL string
+
+	// OnPayment is called for every invoice paid through a link.
+	OnPayment func(k1 string, payment rp.PaymentData)
+}
+
+type WithdrawLink struct {
+	MinWithdrawable    int64 // msatoshi
+	MaxWithdrawable    int64 // msatoshi
+	DefaultDescription string
+}
+
+// WithdrawHandler serves one-time LNURL-withdraw links, created with NewLink.
+type WithdrawHandler struct {
+	WithdrawParams
+
+	mu    sync.Mutex
+	links map[string]WithdrawLink // by k1
+}
+
+type withdrawRequest struct {
+	Tag                string `json:"tag"`
+	Callback           string `json:"callback"`
+	K1                 string `json:"k1"`
+	DefaultDescription string `json:"defaultDescription"`
+	MinWithdrawable    int64  `json:"minWithdrawable"`
+	MaxWithdrawable    int64  `json:"maxWithdrawable"`
+}
+
+func NewWithdrawHandler(params WithdrawParams) *WithdrawHandler {
+	return &WithdrawHandler{
+		WithdrawParams: params,
+		links:          make(map[string]WithdrawLink),
+	}
+}
+
+// NewLink returns the url of a new link, which can be used once, and its k1.
+// Pass the url to Encode to get the lnurl.
+func (h *WithdrawHandler) NewLink(link WithdrawLink) (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to make random k1: %w", err)
+	}
+	k1 := hex.EncodeToString(secret)
+
+	h.mu.Lock()
+	h.links[k1] = link
+	h.mu.Unlock()
+
+	return h.URL + "?k1=" + url.QueryEscape(k1), k1, nil
+}
+
+// RevokeLink makes a link that wasn't used yet unusable.
+func (h *WithdrawHandler) RevokeLink(k1 string) {
+	h.mu.Lock()
+	delete(h.links, k1)
+	h.mu.Unlock()
+}
+
+func (h *WithdrawHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	k1 := q.Get("k1")
+
+	h.mu.Lock()
+	link, ok := h.links[k1]
+	h.mu.Unlock()
+	if !ok {
+		writeError(w, "unknown or already used withdraw link")
+		return
+	}
+
+	pr := q.Get("pr")
+	if pr == "" {
+		writeJSON(w, withdrawRequest{
+			Tag:                "withdrawRequest",
+			Callback:           h.URL,
+			K1:                 k1,
+			DefaultDescription: link.DefaultDescription,
+			MinWithdrawable:    link.MinWithdrawable,
+			MaxWithdrawable:    link.MaxWithdrawable,
+		})
+		return
+	}
+
+	inv, err := rp.DecodeBolt11(pr)
+	if err != nil {
+		writeError(w, fmt.Sprintf("invalid invoice: %v", err))
+		return
+	}
+	if inv.MSatoshi < link.MinWithdrawable || inv.MSatoshi > link.MaxWithdrawable {
+		writeError(w, fmt.Sprintf("invoice amount must be between %d and %d msat",
+			link.MinWithdrawable, link.MaxWithdrawable))
+		return
+	}
+
+	// take the link before paying so concurrent callbacks can't both use it
+	h.mu.Lock()
+	if _, ok := h.links[k1]; !ok {
+		h.mu.Unlock()
+		writeError(w, "unknown or already used withdraw link")
+		return
+	}
+	delete(h.links, k1)
+	h.mu.Unlock()
+
+	payment, err := h.Wallet.MakePayment(rp.PaymentParams{Invoice: pr})
+	if err != nil {
+		log.Printf("lnurl-withdraw failed to pay invoice: %v", err)
+
+		// the link can be used again only when nothing was sent, after a
+		// timeout the payment may still be in flight
+		status, serr := h.Wallet.GetPaymentStatus(inv.PaymentHash)
+		if serr == nil && (status.Status == rp.Failed || status.Status == rp.NeverTried) {
+			h.mu.Lock()
+			h.links[k1] = link
+			h.mu.Unlock()
+		}
+
+		writeError(w, "failed to pay invoice")
+		return
+	}
+
+	if h.OnPayment != nil {
+		h.OnPayment(k1, payment)
+	}
+
+	writeJSON(w, okResponse{Status: "OK"})
+}
@@ -0,0 +1,189 @@
+// Package lnurlauth logs in to services with LNURL-auth (LUD-04) using the node
+// key of a wallet. Linking keys are derived as in LUD-13, from the signature of
+// the node over a fixed message, so each domain sees a different key which
+// stays the same every time the node logs in:
+//
+//	auth, err := lnurlauth.New(wallet.(rp.MessageSigner))
+//	err = auth.Login(ctx, "lnurl1...")
+//
+// Services that accept these logins can check the callbacks with Verify.
+package lnurlauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/lnurl"
+)
+
+// signed once to get the hashing key, from LUD-13
+const hashingKeyMessage = "DO NOT EVER SIGN THIS TEXT WITH YOUR PRIVATE KEYS! IT IS ONLY USED FOR DERIVATION OF LNURL-AUTH HASHING-KEY, DISCLOSING ITS SIGNATURE WILL COMPROMISE YOUR LNURL-AUTH IDENTITY AND MAY LEAD TO LOSS OF FUNDS!"
+
+var (
+	ErrInvalidChallenge = errors.New("invalid lnurl-auth challenge")
+	ErrLoginFailed      = errors.New("lnurl-auth login failed")
+	ErrInvalidSignature = errors.New("invalid lnurl-auth signature")
+)
+
+// Challenge is what a service asks to sign, read from its lnurl.
+type Challenge struct {
+	Domain   string
+	K1       []byte
+	Action   string // register, login, link or auth, may be empty
+	Callback string
+}
+
+// ParseChallenge reads a bech32 lnurl, a keyauth:// url (LUD-17) or the plain
+// https url with tag=login.
+func ParseChallenge(s string) (Challenge, error) {
+	raw := strings.TrimPrefix(strings.TrimSpace(s), "lightning:")
+	if decoded, err := lnurl.Decode(raw); err == nil {
+		raw = decoded
+	}
+	if strings.HasPrefix(strings.ToLower(raw), "keyauth://") {
+		raw = "https://" + raw[len("keyauth://"):]
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return Challenge{}, fmt.Errorf("%w: %q is not a url", ErrInvalidChallenge, s)
+	}
+	query := u.Query()
+	if query.Get("tag") != "login" {
+		return Challenge{}, fmt.Errorf("%w: %q is not a login", ErrInvalidChallenge, raw)
+	}
+	k1, err := hex.DecodeString(query.Get("k1"))
+	if err != nil || len(k1) != 32 {
+		return Challenge{}, fmt.Errorf("%w: k1 must be 32 bytes in hex", ErrInvalidChallenge)
+	}
+
+	return Challenge{
+		Domain:   u.Hostname(),
+		K1:       k1,
+		Action:   query.Get("action"),
+		Callback: u.String(),
+	}, nil
+}
+
+type Authenticator struct {
+	Client *http.Client // defaults to http.DefaultClient
+
+	hashingKey []byte
+}
+
+// New signs the LUD-13 message with the node key, which backends sign
+// deterministically, and keeps the hash of the signature as they return it.
+func New(signer rp.MessageSigner) (*Authenticator, error) {
+	sig, err := signer.SignMessage(hashingKeyMessage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the hashing key message: %w", err)
+	}
+	hashingKey := sha256.Sum256([]byte(sig))
+	return &Authenticator{hashingKey: hashingKey[:]}, nil
+}
+
+// LinkingKey is the secret key used on a domain and its compressed public key.
+func (a *Authenticator) LinkingKey(domain string) ([]byte, []byte, error) {
+	mac := hmac.New(sha256.New, a.hashingKey)
+	mac.Write([]byte(domain))
+	secret := mac.Sum(nil)
+
+	_, pub := btcec.PrivKeyFromBytes(secret)
+	return secret, pub.SerializeCompressed(), nil
+}
+
+// Sign returns the DER signature of the challenge k1 and the linking key that
+// made it.
+func (a *Authenticator) Sign(challenge Challenge) ([]byte, []byte, error) {
+	secret, key, err := a.LinkingKey(challenge.Domain)
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, _ := btcec.PrivKeyFromBytes(secret)
+	defer priv.Zero()
+	return ecdsa.Sign(priv, challenge.K1).Serialize(), key, nil
+}
+
+// Login signs the challenge of an lnurl and sends it to the service, returning
+// the hex linking key the service now knows the node by.
+func (a *Authenticator) Login(ctx context.Context, s string) (string, error) {
+	challenge, err := ParseChallenge(s)
+	if err != nil {
+		return "", err
+	}
+	sig, key, err := a.Sign(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	callback, _ := url.Parse(challenge.Callback)
+	query := callback.Query()
+	query.Set("sig", hex.EncodeToString(sig))
+	query.Set("key", hex.EncodeToString(key))
+	callback.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, callback.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call %s: %w", challenge.Domain, err)
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("%w: %s returned %s", ErrLoginFailed, challenge.Domain, resp.Status)
+	}
+	if !strings.EqualFold(res.Status, "OK") {
+		return "", fmt.Errorf("%w: %s", ErrLoginFailed, res.Reason)
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// Verify checks the hex k1, sig and key a wallet sent to a login callback.
+func Verify(k1, sig, key string) error {
+	k1Bytes, err := hex.DecodeString(k1)
+	if err != nil || len(k1Bytes) != 32 {
+		return fmt.Errorf("%w: k1 must be 32 bytes in hex", ErrInvalidChallenge)
+	}
+	der, err := hex.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("%w: not hex", ErrInvalidSignature)
+	}
+	signature, err := ecdsa.ParseDERSignature(der)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	pub, err := btcec.ParsePubKey(keyBytes)
+	if err != nil {
+		return fmt.Errorf("invalid key %q: %w", key, err)
+	}
+	if !signature.Verify(k1Bytes, pub) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
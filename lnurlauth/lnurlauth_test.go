@@ -0,0 +1,107 @@
+package lnurlauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/lnurl"
+)
+
+type signer struct{ node string }
+
+func (s signer) SignMessage(message string) (string, error) {
+	return "sig of " + message + " by " + s.node, nil
+}
+
+func (s signer) VerifyMessage(message, signature string) (rp.MessageVerification, error) {
+	return rp.MessageVerification{}, nil
+}
+
+const k1 = "e2af6254a8df433264fa23f67eb8188635d15ce883e8fc020989d5f82ae6f11e"
+
+func TestParseChallenge(t *testing.T) {
+	url := "https://site.com:8443/auth?tag=login&k1=" + k1 + "&action=login"
+	for _, s := range []string{url, lnurl.Encode(url), "lightning:" + lnurl.Encode(url), "keyauth://site.com:8443/auth?tag=login&k1=" + k1 + "&action=login"} {
+		challenge, err := ParseChallenge(s)
+		if err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+		if challenge.Domain != "site.com" || hex.EncodeToString(challenge.K1) != k1 || challenge.Action != "login" {
+			t.Errorf("got %+v, wanted a login to site.com", challenge)
+		}
+	}
+
+	for _, s := range []string{
+		"https://site.com/auth?tag=withdrawRequest&k1=" + k1,
+		"https://site.com/auth?tag=login&k1=abcd",
+		"not a url",
+	} {
+		if _, err := ParseChallenge(s); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("got %v, wanted %v", err, ErrInvalidChallenge)
+		}
+	}
+}
+
+func TestLinkingKey(t *testing.T) {
+	a, _ := New(signer{"alice"})
+	b, _ := New(signer{"bob"})
+
+	_, site1, _ := a.LinkingKey("site.com")
+	_, again, _ := a.LinkingKey("site.com")
+	_, site2, _ := a.LinkingKey("other.com")
+	_, bobs, _ := b.LinkingKey("site.com")
+
+	if !bytes.Equal(site1, again) {
+		t.Errorf("got %x, wanted %x", again, site1)
+	}
+	if bytes.Equal(site1, site2) || bytes.Equal(site1, bobs) {
+		t.Errorf("got the same key for different domains or nodes")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	var logins []string
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if err := Verify(query.Get("k1"), query.Get("sig"), query.Get("key")); err != nil {
+			fmt.Fprintf(w, `{"status": "ERROR", "reason": %q}`, err.Error())
+			return
+		}
+		logins = append(logins, query.Get("key"))
+		fmt.Fprint(w, `{"status": "OK"}`)
+	}))
+	defer service.Close()
+
+	a, err := New(signer{"alice"})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	key, err := a.Login(context.Background(), lnurl.Encode(service.URL+"?tag=login&k1="+k1))
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if len(logins) != 1 || logins[0] != key {
+		t.Errorf("got %v, wanted %v", logins, key)
+	}
+
+	// signed by another key
+	challenge, _ := ParseChallenge(service.URL + "?tag=login&k1=" + k1)
+	sig, _, _ := a.Sign(challenge)
+	_, other, _ := a.LinkingKey("other.com")
+	if err := Verify(k1, hex.EncodeToString(sig), hex.EncodeToString(other)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got %v, wanted %v", err, ErrInvalidSignature)
+	}
+
+	wrong := strings.Replace(k1, "e2", "e3", 1)
+	if err := Verify(wrong, hex.EncodeToString(sig), key); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got %v, wanted %v", err, ErrInvalidSignature)
+	}
+}
@@ -0,0 +1,170 @@
+// Package lsp gets inbound liquidity from a Lightning Service Provider, so a
+// node without channels can still receive. LSPS1 buys a channel up front,
+// LSPS2 has the LSP open one just in time for the first payment and take its
+// fee from it:
+//
+//	client, err := lsp.Start(lsp.Params{Wallet: wallet, LSP: pubkey})
+//	inv, err := client.CreateJITInvoice(ctx, rp.InvoiceParams{Msatoshi: 50000000})
+//
+// Requests go to the LSP as LSPS0 JSON-RPC over custom messages, so the
+// wallet must be an rp.CustomMessenger and its node connected to the LSP.
+package lsp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// the custom message type of LSPS0
+const messageType = 37913
+
+// Error is an error returned by the LSP.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("lsp error %d: %s", e.Code, e.Message)
+}
+
+type Params struct {
+	Wallet rp.Wallet
+
+	// LSP is the pubkey of the LSP node.
+	LSP string
+
+	// Token is given to the LSP with every request, for LSPs that need one.
+	Token string
+
+	// Timeout is how long the LSP has to answer each request, defaults to 30
+	// seconds.
+	Timeout time.Duration
+}
+
+type Client struct {
+	params    Params
+	messenger rp.CustomMessenger
+	stop      context.CancelFunc
+
+	mu      sync.Mutex
+	pending map[string]chan response
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+	ID      string      `json:"id"`
+}
+
+type response struct {
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+func Start(params Params) (*Client, error) {
+	messenger, ok := params.Wallet.(rp.CustomMessenger)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s can't send custom messages", rp.ErrUnsupported, params.Wallet.Kind())
+	}
+	if params.LSP == "" {
+		return nil, fmt.Errorf("%w: the LSP pubkey is needed", rp.ErrInvalidParams)
+	}
+	if params.Timeout == 0 {
+		params.Timeout = 30 * time.Second
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	messages, err := messenger.CustomMessages(ctx)
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to subscribe to custom messages: %w", err)
+	}
+
+	c := &Client{
+		params:    params,
+		messenger: messenger,
+		stop:      stop,
+		pending:   make(map[string]chan response),
+	}
+	go func() {
+		for msg := range messages {
+			if msg.Peer != params.LSP || msg.Type != messageType {
+				continue
+			}
+			var res response
+			if err := json.Unmarshal(msg.Data, &res); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			waiting, ok := c.pending[res.ID]
+			delete(c.pending, res.ID)
+			c.mu.Unlock()
+			if ok {
+				waiting <- res
+			}
+		}
+	}()
+
+	return c, nil
+}
+
+// Close stops listening for the answers of the LSP.
+func (c *Client) Close() {
+	c.stop()
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	req := request{JSONRPC: "2.0", Method: method, Params: params, ID: hex.EncodeToString(id)}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	waiting := make(chan response, 1)
+	c.mu.Lock()
+	c.pending[req.ID] = waiting
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, req.ID)
+		c.mu.Unlock()
+	}()
+
+	if err := c.messenger.SendCustomMessage(c.params.LSP, messageType, data); err != nil {
+		return fmt.Errorf("failed to send %s to the LSP: %w", method, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.params.Timeout)
+	defer cancel()
+	select {
+	case res := <-waiting:
+		if res.Error != nil {
+			return res.Error
+		}
+		if err := json.Unmarshal(res.Result, result); err != nil {
+			return fmt.Errorf("failed to decode the %s answer of the LSP: %w", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w: the LSP didn't answer %s", rp.ErrBackendUnavailable, method)
+		}
+		return ctx.Err()
+	}
+}
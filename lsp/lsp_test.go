@@ -0,0 +1,147 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+const lspPubkey = "02lsp"
+
+// fakeLSP answers the requests sent to it with handle.
+type fakeLSP struct {
+	*testwallet.TestWallet
+	handle   func(method string, params json.RawMessage) (interface{}, *Error)
+	messages chan rp.CustomMessage
+	invoices []rp.InvoiceParams
+}
+
+func (f *fakeLSP) SendCustomMessage(peer string, msgType uint32, data []byte) error {
+	var req struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+		ID     string          `json:"id"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+	result, rpcErr := f.handle(req.Method, req.Params)
+	res, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result, "error": rpcErr})
+	go func() { f.messages <- rp.CustomMessage{Peer: peer, Type: msgType, Data: res} }()
+	return nil
+}
+
+func (f *fakeLSP) CustomMessages(context.Context) (<-chan rp.CustomMessage, error) {
+	return f.messages, nil
+}
+
+func (f *fakeLSP) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	f.invoices = append(f.invoices, params)
+	return f.TestWallet.CreateInvoice(params)
+}
+
+func start(t *testing.T, handle func(string, json.RawMessage) (interface{}, *Error)) (*Client, *fakeLSP) {
+	wallet, _ := testwallet.Start(testwallet.Params{})
+	lsp := &fakeLSP{TestWallet: wallet, handle: handle, messages: make(chan rp.CustomMessage)}
+	client, err := Start(Params{Wallet: lsp, LSP: lspPubkey, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	t.Cleanup(client.Close)
+	return client, lsp
+}
+
+func TestFee(t *testing.T) {
+	params := OpeningFeeParams{MinFeeMsatoshi: 2000, Proportional: 1000}
+	for msatoshi, want := range map[int64]int64{100000: 2000, 10000000: 10000, 10000001: 10001} {
+		if got := params.Fee(msatoshi); got != want {
+			t.Errorf("%d msat: got %v, wanted %v", msatoshi, got, want)
+		}
+	}
+}
+
+func TestCreateJITInvoice(t *testing.T) {
+	validUntil := time.Now().Add(10 * time.Minute)
+	var bought map[string]interface{}
+	client, lsp := start(t, func(method string, params json.RawMessage) (interface{}, *Error) {
+		switch method {
+		case "lsps2.get_info":
+			return map[string]interface{}{"opening_fee_params_menu": []OpeningFeeParams{
+				{MinFeeMsatoshi: 1000, Proportional: 1000, ValidUntil: time.Now().Add(-time.Minute),
+					MinPaymentMsatoshi: 1000, MaxPaymentMsatoshi: 1e9},
+				{MinFeeMsatoshi: 2000, Proportional: 5000, ValidUntil: validUntil,
+					MinPaymentMsatoshi: 1000, MaxPaymentMsatoshi: 1e9, Promise: "signed"},
+			}}, nil
+		case "lsps2.buy":
+			json.Unmarshal(params, &bought)
+			return JITChannel{SCID: "700000x1x0", CltvExpiryDelta: 144}, nil
+		}
+		return nil, &Error{Code: -32601, Message: "method not found"}
+	})
+
+	inv, err := client.CreateJITInvoice(context.Background(), rp.InvoiceParams{Msatoshi: 1000000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if inv.FeeMsatoshi != 5000 || inv.ReceiveMsatoshi != 995000 {
+		t.Errorf("got fee %v and %v to receive, wanted %v and %v", inv.FeeMsatoshi, inv.ReceiveMsatoshi, 5000, 995000)
+	}
+	if bought["payment_size_msat"] != "1000000" || inv.FeeParams.Promise != "signed" {
+		t.Errorf("got %v, wanted to buy with the valid fee params", bought)
+	}
+
+	want := rp.HopHint{NodeID: lspPubkey, ShortChannelID: "700000x1x0", CltvExpiryDelta: 144}
+	params := lsp.invoices[0]
+	if len(params.RouteHints) != 1 || params.RouteHints[0][0] != want {
+		t.Errorf("got %v, wanted %v", params.RouteHints, want)
+	}
+	if params.Expiry == nil || *params.Expiry > 10*time.Minute {
+		t.Errorf("got expiry %v, wanted it before %v", params.Expiry, validUntil)
+	}
+
+	if _, err := client.CreateJITInvoice(context.Background(), rp.InvoiceParams{Msatoshi: 1e10}); !errors.Is(err, ErrNoFeeParams) {
+		t.Errorf("got %v, wanted %v", err, ErrNoFeeParams)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	client, lsp := start(t, func(method string, params json.RawMessage) (interface{}, *Error) {
+		if method != "lsps1.create_order" {
+			return nil, &Error{Code: -32601, Message: "method not found"}
+		}
+		var order Order
+		json.Unmarshal(params, &order.OrderParams)
+		if order.LSPBalanceSat > 1000000 {
+			return nil, &Error{Code: 100, Message: "option mismatch"}
+		}
+		order.OrderID = "order1"
+		order.State = "CREATED"
+		order.Payment.Bolt11 = &Bolt11Payment{OrderTotalSat: 5000, Invoice: "lntestunknown"}
+		return order, nil
+	})
+
+	order, err := client.CreateOrder(context.Background(), OrderParams{LSPBalanceSat: 1000000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if order.OrderID != "order1" || order.LSPBalanceSat != 1000000 || order.Payment.Bolt11.OrderTotalSat != 5000 {
+		t.Errorf("got %+v, wanted the order", order)
+	}
+	payment, err := client.PayOrder(order)
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if status, _ := lsp.GetPaymentStatus(payment.CheckingID); status.Status != rp.Pending {
+		t.Errorf("got %v, wanted %v", status.Status, rp.Pending)
+	}
+
+	var lspErr *Error
+	if _, err := client.CreateOrder(context.Background(), OrderParams{LSPBalanceSat: 2000000}); !errors.As(err, &lspErr) || lspErr.Code != 100 {
+		t.Errorf("got %v, wanted an option mismatch", err)
+	}
+}
@@ -0,0 +1,102 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Options are the channels an LSP sells with LSPS1.
+type Options struct {
+	MinRequiredChannelConfirmations uint16 `json:"min_required_channel_confirmations"`
+	MinFundingConfirmsWithinBlocks  uint16 `json:"min_funding_confirms_within_blocks"`
+	SupportsZeroChannelReserve      bool   `json:"supports_zero_channel_reserve"`
+	MaxChannelExpiryBlocks          uint32 `json:"max_channel_expiry_blocks"`
+
+	MinInitialClientBalanceSat int64 `json:"min_initial_client_balance_sat,string"`
+	MaxInitialClientBalanceSat int64 `json:"max_initial_client_balance_sat,string"`
+	MinInitialLSPBalanceSat    int64 `json:"min_initial_lsp_balance_sat,string"`
+	MaxInitialLSPBalanceSat    int64 `json:"max_initial_lsp_balance_sat,string"`
+	MinChannelBalanceSat       int64 `json:"min_channel_balance_sat,string"`
+	MaxChannelBalanceSat       int64 `json:"max_channel_balance_sat,string"`
+}
+
+// OrderParams is the channel to buy, LSPBalanceSat is the inbound liquidity.
+type OrderParams struct {
+	LSPBalanceSat                int64  `json:"lsp_balance_sat,string"`
+	ClientBalanceSat             int64  `json:"client_balance_sat,string"`
+	RequiredChannelConfirmations uint16 `json:"required_channel_confirmations"`
+	FundingConfirmsWithinBlocks  uint16 `json:"funding_confirms_within_blocks"`
+	ChannelExpiryBlocks          uint32 `json:"channel_expiry_blocks"`
+	Token                        string `json:"token,omitempty"`
+	RefundOnchainAddress         string `json:"refund_onchain_address,omitempty"`
+	AnnounceChannel              bool   `json:"announce_channel"`
+}
+
+type Order struct {
+	OrderParams
+
+	OrderID   string    `json:"order_id"`
+	CreatedAt time.Time `json:"created_at"`
+	State     string    `json:"order_state"` // CREATED, COMPLETED or FAILED
+
+	Payment struct {
+		Bolt11 *Bolt11Payment `json:"bolt11"`
+	} `json:"payment"`
+
+	// Channel is set once the channel is open.
+	Channel *OrderChannel `json:"channel"`
+}
+
+type Bolt11Payment struct {
+	State         string    `json:"state"` // EXPECT_PAYMENT, HOLD, PAID or REFUNDED
+	ExpiresAt     time.Time `json:"expires_at"`
+	FeeTotalSat   int64     `json:"fee_total_sat,string"`
+	OrderTotalSat int64     `json:"order_total_sat,string"`
+	Invoice       string    `json:"invoice"`
+}
+
+type OrderChannel struct {
+	FundedAt        time.Time `json:"funded_at"`
+	FundingOutpoint string    `json:"funding_outpoint"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+func (c *Client) Options(ctx context.Context) (Options, error) {
+	var options Options
+	err := c.call(ctx, "lsps1.get_info", struct{}{}, &options)
+	return options, err
+}
+
+// CreateOrder asks the LSP for a channel, which it opens once PayOrder pays
+// for it.
+func (c *Client) CreateOrder(ctx context.Context, params OrderParams) (Order, error) {
+	if params.Token == "" {
+		params.Token = c.params.Token
+	}
+	var order Order
+	err := c.call(ctx, "lsps1.create_order", params, &order)
+	return order, err
+}
+
+func (c *Client) GetOrder(ctx context.Context, orderID string) (Order, error) {
+	var order Order
+	err := c.call(ctx, "lsps1.get_order", map[string]string{"order_id": orderID}, &order)
+	return order, err
+}
+
+// PayOrder pays the invoice of an order after checking it is for the total
+// the LSP asked for.
+func (c *Client) PayOrder(order Order) (rp.PaymentData, error) {
+	payment := order.Payment.Bolt11
+	if payment == nil || payment.Invoice == "" {
+		return rp.PaymentData{}, fmt.Errorf("%w: order %s can't be paid over lightning", rp.ErrUnsupported, order.OrderID)
+	}
+	if inv, err := rp.DecodeBolt11(payment.Invoice); err == nil && inv.MSatoshi != payment.OrderTotalSat*1000 {
+		return rp.PaymentData{}, fmt.Errorf("%w: the invoice of order %s is for %d msat, the order total is %d sat",
+			rp.ErrInvalidParams, order.OrderID, inv.MSatoshi, payment.OrderTotalSat)
+	}
+	return c.params.Wallet.MakePayment(rp.PaymentParams{Invoice: payment.Invoice})
+}
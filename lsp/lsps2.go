@@ -0,0 +1,136 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+var ErrNoFeeParams = errors.New("the LSP has no opening fee for this payment")
+
+// OpeningFeeParams is one of the fees an LSP offers for just-in-time
+// channels with LSPS2, valid until ValidUntil.
+type OpeningFeeParams struct {
+	MinFeeMsatoshi       int64     `json:"min_fee_msat,string"`
+	Proportional         int64     `json:"proportional"` // ppm of the payment
+	ValidUntil           time.Time `json:"valid_until"`
+	MinLifetime          uint32    `json:"min_lifetime"`
+	MaxClientToSelfDelay uint32    `json:"max_client_to_self_delay"`
+	MinPaymentMsatoshi   int64     `json:"min_payment_size_msat,string"`
+	MaxPaymentMsatoshi   int64     `json:"max_payment_size_msat,string"`
+	Promise              string    `json:"promise"`
+}
+
+// Fee is what the LSP takes from a payment of msatoshi.
+func (p OpeningFeeParams) Fee(msatoshi int64) int64 {
+	fee := (msatoshi*p.Proportional + 999999) / 1000000
+	if fee < p.MinFeeMsatoshi {
+		fee = p.MinFeeMsatoshi
+	}
+	return fee
+}
+
+// JITChannel is the channel the LSP will open, invoices reach it through a
+// route hint with SCID.
+type JITChannel struct {
+	SCID            string `json:"jit_channel_scid"`
+	CltvExpiryDelta uint32 `json:"lsp_cltv_expiry_delta"`
+	ClientTrustsLSP bool   `json:"client_trusts_lsp"`
+}
+
+type JITInvoice struct {
+	rp.InvoiceData
+
+	Channel   JITChannel       `json:"channel"`
+	FeeParams OpeningFeeParams `json:"feeParams"`
+
+	// FeeMsatoshi and ReceiveMsatoshi are what the LSP takes and what is left
+	// for the node, only set for invoices with an amount.
+	FeeMsatoshi     int64 `json:"feeMsatoshi"`
+	ReceiveMsatoshi int64 `json:"receiveMsatoshi"`
+}
+
+// FeeParams lists the opening fees of the LSP, cheapest first.
+func (c *Client) FeeParams(ctx context.Context) ([]OpeningFeeParams, error) {
+	params := map[string]string{}
+	if c.params.Token != "" {
+		params["token"] = c.params.Token
+	}
+	var res struct {
+		Menu []OpeningFeeParams `json:"opening_fee_params_menu"`
+	}
+	err := c.call(ctx, "lsps2.get_info", params, &res)
+	return res.Menu, err
+}
+
+// Buy agrees to pay fee to the LSP for a channel opened on a payment of
+// msatoshi, or of any amount when zero.
+func (c *Client) Buy(ctx context.Context, fee OpeningFeeParams, msatoshi int64) (JITChannel, error) {
+	params := map[string]interface{}{"opening_fee_params": fee}
+	if msatoshi != 0 {
+		params["payment_size_msat"] = fmt.Sprint(msatoshi)
+	}
+	var channel JITChannel
+	err := c.call(ctx, "lsps2.buy", params, &channel)
+	return channel, err
+}
+
+// CreateJITInvoice buys a just-in-time channel at the cheapest fee that fits
+// the amount and creates an invoice that reaches it, expiring when the fee
+// does at the latest. The wallet must have Capabilities.CustomRouteHints.
+//
+// The LSP forwards the payment minus its fee, so for invoices with an amount
+// the node must accept htlcs below it, which lnd doesn't; invoices without an
+// amount work everywhere.
+func (c *Client) CreateJITInvoice(ctx context.Context, params rp.InvoiceParams) (JITInvoice, error) {
+	menu, err := c.FeeParams(ctx)
+	if err != nil {
+		return JITInvoice{}, err
+	}
+
+	var fee *OpeningFeeParams
+	for i, p := range menu {
+		if !p.ValidUntil.After(time.Now()) {
+			continue
+		}
+		if params.Msatoshi != 0 && (params.Msatoshi < p.MinPaymentMsatoshi || params.Msatoshi > p.MaxPaymentMsatoshi) {
+			continue
+		}
+		fee = &menu[i]
+		break
+	}
+	if fee == nil {
+		return JITInvoice{}, fmt.Errorf("%w: %d msat", ErrNoFeeParams, params.Msatoshi)
+	}
+	jit := JITInvoice{FeeParams: *fee}
+	if params.Msatoshi != 0 {
+		jit.FeeMsatoshi = fee.Fee(params.Msatoshi)
+		jit.ReceiveMsatoshi = params.Msatoshi - jit.FeeMsatoshi
+		if jit.ReceiveMsatoshi <= 0 {
+			return JITInvoice{}, fmt.Errorf("%w: the fee of %d msat is above the amount of %d msat",
+				ErrNoFeeParams, jit.FeeMsatoshi, params.Msatoshi)
+		}
+	}
+
+	jit.Channel, err = c.Buy(ctx, *fee, params.Msatoshi)
+	if err != nil {
+		return JITInvoice{}, err
+	}
+
+	if until := time.Until(fee.ValidUntil); params.Expiry == nil || *params.Expiry > until {
+		params.Expiry = &until
+	}
+	params.RouteHints = append(params.RouteHints, []rp.HopHint{{
+		NodeID:          c.params.LSP,
+		ShortChannelID:  jit.Channel.SCID,
+		CltvExpiryDelta: jit.Channel.CltvExpiryDelta,
+	}})
+	jit.InvoiceData, err = c.params.Wallet.CreateInvoice(params)
+	if err != nil {
+		return JITInvoice{}, err
+	}
+	return jit, nil
+}
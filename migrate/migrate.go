@@ -0,0 +1,131 @@
+// Package migrate moves what is still open in a store from one backend to
+// another, for when a node is being replaced, like going from lnd to CLN.
+package migrate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/store"
+)
+
+type Params struct {
+	Store store.Store
+
+	// From is the Kind of the backend being replaced, as saved in the store.
+	From string
+	To   rp.Wallet
+
+	// MinExpiry skips invoices that would expire sooner than this on the new
+	// backend, defaults to a minute.
+	MinExpiry time.Duration
+}
+
+type Result struct {
+	// Invoices are the invoices created again on the new backend.
+	Invoices []Moved `json:"invoices"`
+
+	// Expired are the checking ids of open invoices that were left alone as
+	// they expired or were about to.
+	Expired []string `json:"expired"`
+
+	// Review are the checking ids of the payments that were pending, now
+	// marked with NeedsReview as only the old backend can tell how they end.
+	Review []string `json:"review"`
+}
+
+type Moved struct {
+	From    string `json:"from"` // the old checking id
+	To      string `json:"to"`
+	Invoice string `json:"invoice"`
+}
+
+// Run creates every unexpired open invoice of the old backend again on the
+// new one, with the same amount, description, label and preimage, so it has
+// the same payment hash, and marks the pending payments for review.
+//
+// The new invoices have a different payee, so they must be given again to
+// whoever was going to pay the old ones. Run can be called again after an
+// error, moved invoices are not moved twice.
+func Run(params Params) (Result, error) {
+	if params.MinExpiry == 0 {
+		params.MinExpiry = time.Minute
+	}
+
+	var result Result
+	now := time.Now()
+
+	invoices, err := params.Store.Invoices(store.Filter{Backend: params.From, Open: true})
+	if err != nil {
+		return result, fmt.Errorf("failed to list open invoices: %w", err)
+	}
+	for _, old := range invoices {
+		expiry := old.ExpiresAt.Sub(now)
+		if old.ExpiresAt.IsZero() || expiry < params.MinExpiry {
+			result.Expired = append(result.Expired, old.CheckingID)
+			continue
+		}
+
+		moved, err := move(params, old, expiry)
+		if err != nil {
+			return result, err
+		}
+		result.Invoices = append(result.Invoices, moved)
+	}
+
+	payments, err := params.Store.Payments(store.Filter{Backend: params.From, Open: true})
+	if err != nil {
+		return result, fmt.Errorf("failed to list pending payments: %w", err)
+	}
+	for _, payment := range payments {
+		payment.NeedsReview = true
+		if err := params.Store.SavePayment(payment); err != nil {
+			return result, err
+		}
+		result.Review = append(result.Review, payment.CheckingID)
+	}
+
+	return result, nil
+}
+
+func move(params Params, old store.Invoice, expiry time.Duration) (Moved, error) {
+	invoiceParams := rp.InvoiceParams{
+		Msatoshi:    old.Msatoshi,
+		Description: old.Description,
+		Expiry:      &expiry,
+		Label:       old.Label,
+	}
+	var err error
+	if invoiceParams.Preimage, err = hex.DecodeString(old.Preimage); err != nil || len(invoiceParams.Preimage) == 0 {
+		return Moved{}, fmt.Errorf("invoice %s has no preimage to create it again", old.CheckingID)
+	}
+	if old.DescriptionHash != "" {
+		if invoiceParams.DescriptionHash, err = hex.DecodeString(old.DescriptionHash); err != nil {
+			return Moved{}, fmt.Errorf("invoice %s has an invalid description hash: %w", old.CheckingID, err)
+		}
+	}
+
+	data, err := params.To.CreateInvoice(invoiceParams)
+	if err != nil {
+		return Moved{}, fmt.Errorf("failed to create invoice %s again: %w", old.CheckingID, err)
+	}
+
+	created := old
+	created.CheckingID = data.CheckingID
+	created.Backend = params.To.Kind()
+	created.Invoice = data.Invoice
+	created.ExpiresAt = time.Now().Add(expiry)
+	if err := params.Store.SaveInvoice(created); err != nil {
+		return Moved{}, err
+	}
+	if data.CheckingID != old.CheckingID {
+		old.MovedTo = data.CheckingID
+		if err := params.Store.SaveInvoice(old); err != nil {
+			return Moved{}, err
+		}
+	}
+
+	return Moved{From: old.CheckingID, To: data.CheckingID, Invoice: data.Invoice}, nil
+}
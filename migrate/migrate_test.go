@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/store"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+func TestRun(t *testing.T) {
+	preimage := strings.Repeat("01", 32)
+	s := store.NewMemoryStore()
+	s.SaveInvoice(store.Invoice{
+		CheckingID: "open", Backend: "lndgrpc", Preimage: preimage, Msatoshi: 1000,
+		Label: "order-1", ExpiresAt: time.Now().Add(time.Hour),
+	})
+	s.SaveInvoice(store.Invoice{
+		CheckingID: "expired", Backend: "lndgrpc", Preimage: preimage,
+		ExpiresAt: time.Now().Add(-time.Hour),
+	})
+	s.SaveInvoice(store.Invoice{CheckingID: "paid", Backend: "lndgrpc", Paid: true})
+	s.SavePayment(store.Payment{CheckingID: "pending", Backend: "lndgrpc", Status: rp.Pending})
+	s.SavePayment(store.Payment{CheckingID: "done", Backend: "lndgrpc", Status: rp.Complete})
+
+	to, _ := testwallet.Start(testwallet.Params{})
+	result, err := Run(Params{Store: s, From: "lndgrpc", To: to})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if len(result.Invoices) != 1 || len(result.Expired) != 1 || len(result.Review) != 1 {
+		t.Fatalf("got %+v, wanted one invoice moved, one expired and one payment to review", result)
+	}
+
+	moved := result.Invoices[0]
+	if status, _ := to.GetInvoiceStatus(moved.To); status.Label != "order-1" {
+		t.Errorf("got %v, wanted the invoice on the new backend", status)
+	}
+	if old, _, _ := s.Invoice("open"); old.MovedTo != moved.To {
+		t.Errorf("got %v, wanted it marked as moved to %s", old, moved.To)
+	}
+	if created, _, _ := s.Invoice(moved.To); created.Backend != "test" || created.Msatoshi != 1000 {
+		t.Errorf("got %v, wanted the new invoice saved", created)
+	}
+	if payment, _, _ := s.Payment("pending"); !payment.NeedsReview {
+		t.Errorf("got %v, wanted it marked for review", payment)
+	}
+
+	// running again moves nothing twice
+	result, _ = Run(Params{Store: s, From: "lndgrpc", To: to})
+	if len(result.Invoices) != 0 {
+		t.Errorf("got %v, wanted nothing moved again", result.Invoices)
+	}
+}
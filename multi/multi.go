@@ -0,0 +1,352 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type Params struct {
+	// Wallets are the backends this wallet balances over. The first one is
+	// the primary: it issues invoices and is the default for payments.
+	Wallets []rp.Wallet
+
+	// Strategy picks the backend used for each payment, defaults to First or
+	// to Capacity with Aggregate.
+	Strategy Strategy
+
+	// Aggregate makes the backends look like a single wallet: GetInfo sums
+	// their balances and payments go through one that can send them.
+	Aggregate bool
+
+	// CanonicalIDs makes the checking ids given out and streamed canonical, see
+	// rp.CanonicalID. Canonical and legacy ids are accepted either way.
+	CanonicalIDs bool
+}
+
+type MultiWallet struct {
+	Params
+
+	mu       sync.Mutex
+	stats    []backendStats
+	payments map[string]*routedPayment
+	savings  SavingsReport
+
+	invoiceUpdates rp.InvoiceBroadcaster
+	paymentUpdates rp.PaymentBroadcaster
+}
+
+type backendStats struct {
+	succeeded int64
+	failed    int64
+}
+
+type routedPayment struct {
+	backend int
+	choice  Choice
+}
+
+func Start(params Params) (*MultiWallet, error) {
+	if len(params.Wallets) == 0 {
+		return nil, errors.New("multi wallet needs at least one backend")
+	}
+	if params.Strategy == nil && params.Aggregate {
+		params.Strategy = Capacity{}
+	} else if params.Strategy == nil {
+		params.Strategy = First{}
+	}
+
+	m := &MultiWallet{
+		Params:   params,
+		stats:    make([]backendStats, len(params.Wallets)),
+		payments: make(map[string]*routedPayment),
+	}
+
+	for i, wallet := range params.Wallets {
+		invoices, err := wallet.PaidInvoicesStream()
+		if err != nil {
+			return nil, fmt.Errorf("failed to subscribe to invoices on backend %d (%s): %w",
+				i, wallet.Kind(), err)
+		}
+		payments, err := wallet.PaymentsStream()
+		if err != nil {
+			return nil, fmt.Errorf("failed to subscribe to payments on backend %d (%s): %w",
+				i, wallet.Kind(), err)
+		}
+
+		kind := wallet.Kind()
+		go func() {
+			for status := range invoices {
+				status.CheckingID = m.id(kind, status.CheckingID)
+				m.invoiceUpdates.Publish(status)
+			}
+		}()
+		go func() {
+			for status := range payments {
+				m.recordOutcome(status)
+				status.CheckingID = m.id(kind, status.CheckingID)
+				m.paymentUpdates.Publish(status)
+			}
+		}()
+	}
+
+	return m, nil
+}
+
+// Compile time check to ensure that MultiWallet fully implements rp.Wallet
+var _ rp.Wallet = (*MultiWallet)(nil)
+
+// Compile time check to ensure that MultiWallet implements rp.Subscriber
+var _ rp.Subscriber = (*MultiWallet)(nil)
+
+func (m *MultiWallet) Kind() string {
+	return "multi"
+}
+
+func (m *MultiWallet) Capabilities() rp.Capabilities {
+	return m.Wallets[0].Capabilities()
+}
+
+// GetInfo is the info of the primary backend, or the sum of the balances of
+// every backend with Aggregate.
+func (m *MultiWallet) GetInfo() (rp.WalletInfo, error) {
+	if !m.Aggregate {
+		return m.Wallets[0].GetInfo()
+	}
+
+	var total rp.WalletInfo
+	for i, wallet := range m.Wallets {
+		info, err := wallet.GetInfo()
+		if err != nil {
+			return rp.WalletInfo{}, fmt.Errorf("failed to get info of backend %d (%s): %w",
+				i, wallet.Kind(), err)
+		}
+		total.Balance += info.Balance
+	}
+	return total, nil
+}
+
+// Health is the health of the primary backend, which handles invoices.
+func (m *MultiWallet) Health(ctx context.Context) (rp.HealthStatus, error) {
+	return m.Wallets[0].Health(ctx)
+}
+
+func (m *MultiWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	data, err := m.Wallets[0].CreateInvoice(params)
+	if err == nil {
+		data.CheckingID = m.id(m.Wallets[0].Kind(), data.CheckingID)
+	}
+	return data, err
+}
+
+// GetInvoiceStatus asks the primary backend about legacy ids. For canonical
+// ids the backends of the kind that issued it are asked first and then the
+// others, so invoices from a primary that was swapped are still found.
+func (m *MultiWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	kind, id := rp.ParseCanonicalID(checkingID)
+	if kind == "" {
+		return m.Wallets[0].GetInvoiceStatus(checkingID)
+	}
+
+	var status rp.InvoiceStatus
+	var err error
+	for _, wallet := range m.byKind(kind) {
+		status, err = wallet.GetInvoiceStatus(id)
+		if err == nil && status.Exists {
+			break
+		}
+	}
+	status.CheckingID = checkingID
+	return status, err
+}
+
+func (m *MultiWallet) CancelInvoice(checkingID string) error {
+	_, id := rp.ParseCanonicalID(checkingID)
+	return m.Wallets[0].CancelInvoice(id)
+}
+
+func (m *MultiWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	listener, _ := m.invoiceUpdates.Subscribe()
+	return listener, nil
+}
+
+func (m *MultiWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	choice, err := m.Strategy.Choose(params, m.candidates())
+	if err != nil {
+		return rp.PaymentData{}, fmt.Errorf("failed to choose a backend: %w", err)
+	}
+	return m.pay(choice, params)
+}
+
+// MakePaymentWith bypasses the strategy and sends the payment through the
+// backend at the given index of Params.Wallets.
+func (m *MultiWallet) MakePaymentWith(backend int, params rp.PaymentParams) (rp.PaymentData, error) {
+	if backend < 0 || backend >= len(m.Wallets) {
+		return rp.PaymentData{}, fmt.Errorf("there is no backend %d", backend)
+	}
+	return m.pay(Choice{Backend: backend, EstimatedFee: -1, BaselineFee: -1}, params)
+}
+
+func (m *MultiWallet) pay(choice Choice, params rp.PaymentParams) (rp.PaymentData, error) {
+	if choice.Backend < 0 || choice.Backend >= len(m.Wallets) {
+		return rp.PaymentData{}, fmt.Errorf("strategy chose unknown backend %d", choice.Backend)
+	}
+
+	data, err := m.Wallets[choice.Backend].MakePayment(params)
+	if err != nil {
+		m.mu.Lock()
+		m.stats[choice.Backend].failed++
+		m.mu.Unlock()
+		return data, err
+	}
+
+	m.mu.Lock()
+	m.payments[data.CheckingID] = &routedPayment{backend: choice.Backend, choice: choice}
+	m.mu.Unlock()
+
+	data.CheckingID = m.id(m.Wallets[choice.Backend].Kind(), data.CheckingID)
+	return data, nil
+}
+
+func (m *MultiWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	kind, id := rp.ParseCanonicalID(checkingID)
+
+	m.mu.Lock()
+	payment, ok := m.payments[id]
+	m.mu.Unlock()
+
+	if ok {
+		status, err := m.Wallets[payment.backend].GetPaymentStatus(id)
+		if err == nil {
+			m.recordOutcome(status)
+			status.CheckingID = checkingID
+		}
+		return status, err
+	}
+
+	// we don't know where this was sent from, so ask everybody, starting with
+	// the backends of the kind that issued it
+	var lastErr error
+	for _, wallet := range m.byKind(kind) {
+		status, err := wallet.GetPaymentStatus(id)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if status.Status != rp.NeverTried && status.Status != rp.Unknown {
+			status.CheckingID = checkingID
+			return status, nil
+		}
+	}
+	if lastErr != nil {
+		return rp.PaymentStatus{}, lastErr
+	}
+	return rp.PaymentStatus{CheckingID: checkingID, Status: rp.NeverTried}, nil
+}
+
+func (m *MultiWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	listener, _ := m.paymentUpdates.Subscribe()
+	return listener, nil
+}
+
+func (m *MultiWallet) SubscribePaidInvoices() (<-chan rp.InvoiceStatus, func()) {
+	return m.invoiceUpdates.Subscribe()
+}
+
+func (m *MultiWallet) SubscribePayments() (<-chan rp.PaymentStatus, func()) {
+	return m.paymentUpdates.Subscribe()
+}
+
+// Savings reports how much was spent on fees by the backends chosen by the
+// strategy compared to what the primary backend estimated for the same
+// payments.
+func (m *MultiWallet) Savings() SavingsReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.savings
+}
+
+// id is the checking id given out for one issued by a backend of kind.
+func (m *MultiWallet) id(kind string, checkingID string) string {
+	if !m.CanonicalIDs {
+		return checkingID
+	}
+	return rp.CanonicalID(kind, checkingID)
+}
+
+// byKind returns the backends with the backends of kind first.
+func (m *MultiWallet) byKind(kind string) []rp.Wallet {
+	wallets := make([]rp.Wallet, 0, len(m.Wallets))
+	for _, wallet := range m.Wallets {
+		if wallet.Kind() == kind {
+			wallets = append(wallets, wallet)
+		}
+	}
+	for _, wallet := range m.Wallets {
+		if wallet.Kind() != kind {
+			wallets = append(wallets, wallet)
+		}
+	}
+	return wallets
+}
+
+func (m *MultiWallet) candidates() []Candidate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	candidates := make([]Candidate, len(m.Wallets))
+	for i, wallet := range m.Wallets {
+		candidates[i] = Candidate{
+			Backend:     i,
+			Wallet:      wallet,
+			SuccessRate: m.stats[i].successRate(),
+		}
+	}
+	return candidates
+}
+
+// recordOutcome updates the success rates and the savings report once a
+// payment we routed reaches a terminal status. Each payment is counted once,
+// then forgotten, later lookups ask the backends.
+func (m *MultiWallet) recordOutcome(status rp.PaymentStatus) {
+	if status.Status != rp.Complete && status.Status != rp.Failed {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	payment, ok := m.payments[status.CheckingID]
+	if !ok {
+		return
+	}
+	delete(m.payments, status.CheckingID)
+
+	if status.Status == rp.Failed {
+		m.stats[payment.backend].failed++
+		return
+	}
+
+	m.stats[payment.backend].succeeded++
+	if payment.choice.BaselineFee >= 0 {
+		m.savings.Payments++
+		m.savings.BaselineFees += payment.choice.BaselineFee
+		m.savings.RealizedFees += status.FeePaid
+		m.savings.Saved = m.savings.BaselineFees - m.savings.RealizedFees
+	}
+}
+
+func (s backendStats) successRate() float64 {
+	// laplace smoothing so new backends aren't ruled out or favored too much
+	return float64(s.succeeded+1) / float64(s.succeeded+s.failed+2)
+}
+
+type SavingsReport struct {
+	Payments     int64 `json:"payments"`
+	BaselineFees int64 `json:"baselineFees"`
+	RealizedFees int64 `json:"realizedFees"`
+	Saved        int64 `json:"saved"`
+}
@@ -0,0 +1,214 @@
+package multi
+
+import (
+	"errors"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/simnet"
+	"github.com/lnbits/relampago/testwallet"
+	"github.com/lnbits/relampago/void"
+)
+
+type estimatingWallet struct {
+	void.VoidWallet
+	fee      int64
+	feeErr   error
+	paid     []rp.PaymentParams
+	statuses chan rp.PaymentStatus
+}
+
+func (w *estimatingWallet) EstimatePaymentFee(rp.FeeEstimateParams) (rp.FeeEstimate, error) {
+	return rp.FeeEstimate{FeeMsatoshi: w.fee}, w.feeErr
+}
+
+func (w *estimatingWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	w.paid = append(w.paid, params)
+	return rp.PaymentData{CheckingID: params.Invoice}, nil
+}
+
+func (w *estimatingWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	return w.statuses, nil
+}
+
+func newEstimatingWallet(fee int64) *estimatingWallet {
+	return &estimatingWallet{fee: fee, statuses: make(chan rp.PaymentStatus)}
+}
+
+func TestCheapestFee(t *testing.T) {
+	expensive := newEstimatingWallet(5000)
+	cheap := newEstimatingWallet(1000)
+	broken := newEstimatingWallet(0)
+	broken.feeErr = errors.New("no route")
+
+	m, err := Start(Params{
+		Wallets:  []rp.Wallet{expensive, broken, cheap},
+		Strategy: CheapestFee{},
+	})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	if _, err := m.MakePayment(rp.PaymentParams{Invoice: "a"}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if len(cheap.paid) != 1 {
+		t.Fatalf("got %v payments on the cheap backend, wanted %v", len(cheap.paid), 1)
+	}
+
+	cheap.statuses <- rp.PaymentStatus{CheckingID: "a", Status: rp.Complete, FeePaid: 800}
+	cheap.statuses <- rp.PaymentStatus{} // wait for the previous one to be processed
+
+	want := SavingsReport{Payments: 1, BaselineFees: 5000, RealizedFees: 800, Saved: 4200}
+	if got := m.Savings(); got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestCheapestFee_SuccessRate(t *testing.T) {
+	primary := newEstimatingWallet(1000)
+	flaky := newEstimatingWallet(900)
+
+	m, err := Start(Params{
+		Wallets:  []rp.Wallet{primary, flaky},
+		Strategy: CheapestFee{},
+	})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	m.MakePayment(rp.PaymentParams{Invoice: "a"})
+	if len(flaky.paid) != 1 {
+		t.Fatalf("got %v payments on the cheaper backend, wanted %v", len(flaky.paid), 1)
+	}
+	flaky.statuses <- rp.PaymentStatus{CheckingID: "a", Status: rp.Failed}
+	flaky.statuses <- rp.PaymentStatus{}
+
+	m.MakePayment(rp.PaymentParams{Invoice: "b"})
+	if len(primary.paid) != 1 || primary.paid[0].Invoice != "b" {
+		t.Errorf("got %v, wanted the primary backend to be used after failures", primary.paid)
+	}
+}
+
+func TestMakePaymentWith(t *testing.T) {
+	primary := newEstimatingWallet(1000)
+	other := newEstimatingWallet(1000)
+
+	m, err := Start(Params{Wallets: []rp.Wallet{primary, other}})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	if _, err := m.MakePaymentWith(1, rp.PaymentParams{Invoice: "a"}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if len(other.paid) != 1 {
+		t.Errorf("got %v payments on backend 1, wanted %v", len(other.paid), 1)
+	}
+	if _, err := m.MakePaymentWith(2, rp.PaymentParams{Invoice: "b"}); err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+}
+
+func TestResolvedPaymentsForgotten(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	m, _ := Start(Params{Wallets: []rp.Wallet{tw}})
+
+	complete, _ := m.MakePayment(rp.PaymentParams{Invoice: "lnbc1"})
+	failed, _ := m.MakePayment(rp.PaymentParams{Invoice: "lnbc2"})
+	pending, _ := m.MakePayment(rp.PaymentParams{Invoice: "lnbc3"})
+	tw.CompletePayment(complete.CheckingID, "", 0)
+	tw.FailPayment(failed.CheckingID)
+
+	for _, id := range []string{complete.CheckingID, failed.CheckingID, pending.CheckingID} {
+		if _, err := m.GetPaymentStatus(id); err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+	}
+	m.mu.Lock()
+	_, ok := m.payments[pending.CheckingID]
+	n := len(m.payments)
+	m.mu.Unlock()
+	if n != 1 || !ok {
+		t.Errorf("got %v routed payments, wanted only the pending one", n)
+	}
+
+	// still found by asking the backends
+	status, _ := m.GetPaymentStatus(complete.CheckingID)
+	if status.Status != rp.Complete {
+		t.Errorf("got %v, wanted %v", status.Status, rp.Complete)
+	}
+	m.mu.Lock()
+	succeeded := m.stats[0].succeeded
+	m.mu.Unlock()
+	if succeeded != 1 {
+		t.Errorf("got %v, wanted %v", succeeded, 1)
+	}
+}
+
+type kindWallet struct {
+	*testwallet.TestWallet
+	kind string
+}
+
+func (w kindWallet) Kind() string {
+	return w.kind
+}
+
+func TestCanonicalIDs(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	m, _ := Start(Params{Wallets: []rp.Wallet{kindWallet{tw, "eclair"}}, CanonicalIDs: true})
+
+	invoice, _ := m.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+	if kind, _ := rp.ParseCanonicalID(invoice.CheckingID); kind != "eclair" {
+		t.Fatalf("got %s, wanted a canonical id from eclair", invoice.CheckingID)
+	}
+	_, hash := rp.ParseCanonicalID(invoice.CheckingID)
+	tw.SettleInvoice(hash, 1000)
+
+	// the same node now behind another kind of backend
+	swapped, _ := Start(Params{Wallets: []rp.Wallet{kindWallet{tw, "lndgrpc"}}, CanonicalIDs: true})
+	status, err := swapped.GetInvoiceStatus(invoice.CheckingID)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if !status.Paid || status.CheckingID != invoice.CheckingID {
+		t.Errorf("got %v, wanted the invoice paid under the id it was stored with", status)
+	}
+
+	legacy, _ := swapped.GetInvoiceStatus(hash)
+	if !legacy.Paid {
+		t.Errorf("got %v, wanted legacy ids to still work", legacy)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	net := simnet.New(simnet.Params{})
+	small, _ := net.AddNode("small")
+	large, _ := net.AddNode("large")
+	shop, _ := net.AddNode("shop")
+	net.Connect(small, shop, 100000, 0)
+	net.Connect(large, shop, 1000000, 0)
+
+	m, err := Start(Params{Wallets: []rp.Wallet{small, large}, Aggregate: true})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if info, _ := m.GetInfo(); info.Balance != 1100 {
+		t.Errorf("got %v, wanted %v", info.Balance, 1100)
+	}
+
+	// simnet invoices can't be decoded, so the amount is given
+	inv, _ := shop.CreateInvoice(rp.InvoiceParams{Msatoshi: 500000})
+	if _, err := m.MakePayment(rp.PaymentParams{Invoice: inv.Invoice, CustomAmount: 500000}); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if balance := large.Balance(); balance != 500000 {
+		t.Errorf("got %v, wanted the payment from the large backend", balance)
+	}
+
+	inv, _ = shop.CreateInvoice(rp.InvoiceParams{Msatoshi: 5000000})
+	if _, err := m.MakePayment(rp.PaymentParams{Invoice: inv.Invoice, CustomAmount: 5000000}); !errors.Is(err, ErrInsufficientCapacity) {
+		t.Errorf("got %v, wanted %v", err, ErrInsufficientCapacity)
+	}
+}
@@ -0,0 +1,123 @@
+package multi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Strategy decides which backend will be used to send a payment.
+type Strategy interface {
+	Choose(params rp.PaymentParams, candidates []Candidate) (Choice, error)
+}
+
+type Candidate struct {
+	Backend     int
+	Wallet      rp.Wallet
+	SuccessRate float64
+}
+
+type Choice struct {
+	Backend int
+
+	// EstimatedFee is what the chosen backend expected to pay and BaselineFee
+	// is what the primary backend expected to pay, both are -1 when unknown.
+	EstimatedFee int64
+	BaselineFee  int64
+}
+
+// First always sends through the primary backend.
+type First struct{}
+
+func (First) Choose(_ rp.PaymentParams, candidates []Candidate) (Choice, error) {
+	if len(candidates) == 0 {
+		return Choice{}, errors.New("no backends available")
+	}
+	return Choice{Backend: candidates[0].Backend, EstimatedFee: -1, BaselineFee: -1}, nil
+}
+
+// ErrInsufficientCapacity is returned by Capacity when no backend can send a
+// payment by itself.
+var ErrInsufficientCapacity = errors.New("no backend can send the payment")
+
+// Capacity sends through the first backend that can send the whole payment,
+// going by the balance of the backends that aren't rp.OutboundCapacity. A
+// payment no backend can send alone isn't split across them, as a Wallet can
+// only pay the whole amount of an invoice.
+type Capacity struct{}
+
+func (Capacity) Choose(params rp.PaymentParams, candidates []Candidate) (Choice, error) {
+	msatoshi := params.CustomAmount
+	if msatoshi == 0 {
+		inv, err := rp.DecodeBolt11(params.Invoice)
+		if err != nil {
+			return Choice{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+		}
+		msatoshi = inv.MSatoshi
+	}
+
+	for _, candidate := range candidates {
+		if canSend(candidate.Wallet, msatoshi) {
+			return Choice{Backend: candidate.Backend, EstimatedFee: -1, BaselineFee: -1}, nil
+		}
+	}
+	return Choice{}, fmt.Errorf("%w: %d msat", ErrInsufficientCapacity, msatoshi)
+}
+
+func canSend(wallet rp.Wallet, msatoshi int64) bool {
+	if capacity, ok := wallet.(rp.OutboundCapacity); ok {
+		can, err := capacity.CanSend(msatoshi)
+		return err == nil && can
+	}
+	info, err := wallet.GetInfo()
+	return err == nil && info.Balance*1000 >= msatoshi
+}
+
+// CheapestFee sends through the backend with the lowest expected fee, which is
+// the estimated fee weighted by how often that backend has failed recently.
+// Backends that can't estimate fees are only used if no other can.
+type CheapestFee struct{}
+
+func (CheapestFee) Choose(params rp.PaymentParams, candidates []Candidate) (Choice, error) {
+	if len(candidates) == 0 {
+		return Choice{}, errors.New("no backends available")
+	}
+
+	choice := Choice{Backend: candidates[0].Backend, EstimatedFee: -1, BaselineFee: -1}
+	bestCost := math.Inf(1)
+
+	for i, candidate := range candidates {
+		estimator, ok := candidate.Wallet.(rp.FeeEstimator)
+		if !ok {
+			continue
+		}
+
+		estimate, err := estimator.EstimatePaymentFee(rp.FeeEstimateParams{
+			Invoice:  params.Invoice,
+			Msatoshi: params.CustomAmount,
+		})
+		if err != nil {
+			// probably no route from here
+			continue
+		}
+
+		if i == 0 {
+			choice.BaselineFee = estimate.FeeMsatoshi
+		}
+
+		rate := candidate.SuccessRate
+		if rate <= 0 {
+			rate = 0.01
+		}
+		cost := float64(estimate.FeeMsatoshi+1) / rate
+		if cost < bestCost {
+			bestCost = cost
+			choice.Backend = candidate.Backend
+			choice.EstimatedFee = estimate.FeeMsatoshi
+		}
+	}
+
+	return choice, nil
+}
@@ -0,0 +1,198 @@
+package nwc
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// nostr event kinds from NIP-47
+const (
+	kindInfo         = 13194
+	kindRequest      = 23194
+	kindResponse     = 23195
+	kindNotification = 23196
+)
+
+type event struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// hash is the event id, the hash of its NIP-01 serialization.
+func (e *event) hash() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode([]interface{}{0, e.PubKey, e.CreatedAt, e.Kind, e.Tags, e.Content}); err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return hash[:], nil
+}
+
+// privateKey parses a 32 bytes secret key, which btcec would otherwise reduce
+// silently when it is out of range.
+func privateKey(secret []byte) (*btcec.PrivateKey, error) {
+	var k btcec.ModNScalar
+	if len(secret) != 32 || k.SetByteSlice(secret) || k.IsZero() {
+		return nil, errors.New("invalid secret key")
+	}
+	return btcec.PrivKeyFromScalar(&k), nil
+}
+
+// publicKey is the hex x-only public key of a secret key, as nostr uses them.
+func publicKey(secret []byte) (string, error) {
+	key, err := privateKey(secret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(xOnly(key.PubKey())), nil
+}
+
+func (e *event) sign(secret []byte) error {
+	key, err := privateKey(secret)
+	if err != nil {
+		return err
+	}
+	e.PubKey = hex.EncodeToString(xOnly(key.PubKey()))
+	if e.CreatedAt == 0 {
+		e.CreatedAt = time.Now().Unix()
+	}
+	if e.Tags == nil {
+		e.Tags = [][]string{}
+	}
+
+	hash, err := e.hash()
+	if err != nil {
+		return err
+	}
+	var aux [32]byte
+	if _, err := rand.Read(aux[:]); err != nil {
+		return err
+	}
+	sig, err := schnorrSign(key, hash, aux[:])
+	if err != nil {
+		return err
+	}
+
+	e.ID = hex.EncodeToString(hash)
+	e.Sig = hex.EncodeToString(sig)
+	return nil
+}
+
+func (e *event) verify() bool {
+	hash, err := e.hash()
+	if err != nil || hex.EncodeToString(hash) != e.ID {
+		return false
+	}
+	pubBytes, err1 := hex.DecodeString(e.PubKey)
+	sigBytes, err2 := hex.DecodeString(e.Sig)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	pub, err := parseXOnly(pubBytes)
+	if err != nil {
+		return false
+	}
+	return schnorrVerify(pub, hash, sigBytes)
+}
+
+func (e *event) tag(name string) string {
+	for _, tag := range e.Tags {
+		if len(tag) >= 2 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// encrypt and decrypt implement NIP-04, which NIP-47 uses for its contents.
+func encrypt(secret []byte, pubkey string, plaintext []byte) (string, error) {
+	key, err := sharedKey(secret, pubkey)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	return base64.StdEncoding.EncodeToString(ciphertext) + "?iv=" +
+		base64.StdEncoding.EncodeToString(iv), nil
+}
+
+var errInvalidContent = errors.New("invalid encrypted content")
+
+func decrypt(secret []byte, pubkey string, content string) ([]byte, error) {
+	parts := strings.Split(content, "?iv=")
+	if len(parts) != 2 {
+		return nil, errInvalidContent
+	}
+	ciphertext, err1 := base64.StdEncoding.DecodeString(parts[0])
+	iv, err2 := base64.StdEncoding.DecodeString(parts[1])
+	if err1 != nil || err2 != nil || len(iv) != aes.BlockSize ||
+		len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errInvalidContent
+	}
+
+	key, err := sharedKey(secret, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errInvalidContent
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+func sharedKey(secret []byte, pubkey string) ([]byte, error) {
+	key, err := privateKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	pubBytes, err := hex.DecodeString(pubkey)
+	if err != nil || len(pubBytes) != 32 {
+		return nil, fmt.Errorf("invalid pubkey '%s'", pubkey)
+	}
+	pub, err := parseXOnly(pubBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubkey '%s': %w", pubkey, err)
+	}
+	return btcec.GenerateSharedSecret(key, pub), nil
+}
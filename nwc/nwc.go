@@ -0,0 +1,525 @@
+// Package nwc speaks Nostr Wallet Connect (NIP-47) on both sides: Start
+// exposes a wallet so nostr apps can pay and receive with it through a relay,
+// and Connect uses a remote NWC wallet as a backend.
+package nwc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type Params struct {
+	Wallet rp.Wallet
+
+	// SecretKey is the hex-encoded nostr secret key of the wallet service.
+	SecretKey string
+
+	// Relay is the url of the relay requests are received through.
+	Relay string
+
+	// Clients are the pubkeys of the apps allowed to use the wallet, more can
+	// be added with NewConnection.
+	Clients []string
+
+	// Methods limits the methods the apps can call, all of them when empty.
+	Methods []string
+
+	// PayTimeout is how long pay_invoice waits for the payment to complete,
+	// defaults to a minute.
+	PayTimeout time.Duration
+}
+
+// the methods and notifications implemented
+var (
+	allMethods = []string{
+		"pay_invoice", "make_invoice", "lookup_invoice", "get_balance", "get_info",
+	}
+	notifications = []string{"payment_received", "payment_sent"}
+)
+
+// NIP-47 error codes
+const (
+	ErrorRestricted          = "RESTRICTED"
+	ErrorUnauthorized        = "UNAUTHORIZED"
+	ErrorNotImplemented      = "NOT_IMPLEMENTED"
+	ErrorPaymentFailed       = "PAYMENT_FAILED"
+	ErrorInsufficientBalance = "INSUFFICIENT_BALANCE"
+	ErrorNotFound            = "NOT_FOUND"
+	ErrorInternal            = "INTERNAL"
+	ErrorOther               = "OTHER"
+)
+
+// Server answers NIP-47 requests from the allowed clients and sends them
+// notifications for payments received and sent. It reconnects to the relay
+// when the connection drops.
+type Server struct {
+	Params
+	secret []byte
+	pubkey string
+
+	mu      sync.Mutex
+	clients map[string]bool
+	relay   *relay
+}
+
+type request struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type response struct {
+	ResultType string         `json:"result_type"`
+	Error      *responseError `json:"error,omitempty"`
+	Result     interface{}    `json:"result,omitempty"`
+}
+
+type responseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type notification struct {
+	NotificationType string      `json:"notification_type"`
+	Notification     transaction `json:"notification"`
+}
+
+type transaction struct {
+	Type            string `json:"type"` // incoming or outgoing
+	State           string `json:"state,omitempty"`
+	Invoice         string `json:"invoice,omitempty"`
+	Description     string `json:"description,omitempty"`
+	DescriptionHash string `json:"description_hash,omitempty"`
+	Preimage        string `json:"preimage,omitempty"`
+	PaymentHash     string `json:"payment_hash"`
+	Amount          int64  `json:"amount"`
+	FeesPaid        int64  `json:"fees_paid"`
+	CreatedAt       int64  `json:"created_at,omitempty"`
+	ExpiresAt       int64  `json:"expires_at,omitempty"`
+	SettledAt       int64  `json:"settled_at,omitempty"`
+}
+
+func Start(params Params) (*Server, error) {
+	secret, err := hex.DecodeString(params.SecretKey)
+	if err != nil || len(secret) != 32 {
+		return nil, errors.New("secret key must be 32 hex-encoded bytes")
+	}
+	pubkey, err := publicKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Methods) == 0 {
+		params.Methods = allMethods
+	}
+	if params.PayTimeout == 0 {
+		params.PayTimeout = time.Minute
+	}
+
+	s := &Server{
+		Params:  params,
+		secret:  secret,
+		pubkey:  pubkey,
+		clients: make(map[string]bool),
+	}
+	for _, client := range params.Clients {
+		s.clients[client] = true
+	}
+
+	invoices, err := params.Wallet.PaidInvoicesStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to invoices: %w", err)
+	}
+	payments, err := params.Wallet.PaymentsStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+	}
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	go s.run()
+
+	go func() {
+		for status := range invoices {
+			s.notify("payment_received", transaction{
+				Type:        "incoming",
+				State:       "settled",
+				Description: status.Description,
+				PaymentHash: status.CheckingID,
+				Amount:      status.MSatoshiReceived,
+				SettledAt:   unix(status.SettledAt),
+			})
+		}
+	}()
+	go func() {
+		for status := range payments {
+			if status.Status != rp.Complete {
+				continue
+			}
+			s.notify("payment_sent", transaction{
+				Type:        "outgoing",
+				State:       "settled",
+				Preimage:    status.Preimage,
+				PaymentHash: status.CheckingID,
+				FeesPaid:    status.FeePaid,
+				SettledAt:   unix(status.ResolvedAt),
+			})
+		}
+	}()
+
+	return s, nil
+}
+
+// Pubkey is the nostr pubkey of the wallet service.
+func (s *Server) Pubkey() string {
+	return s.pubkey
+}
+
+// NewConnection allows a new app and returns the nostr+walletconnect uri to
+// give to it, along with its pubkey for RevokeConnection.
+func (s *Server) NewConnection() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to make random secret: %w", err)
+	}
+	client, err := publicKey(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	s.clients[client] = true
+	s.mu.Unlock()
+
+	uri := "nostr+walletconnect://" + s.pubkey + "?relay=" + url.QueryEscape(s.Relay) +
+		"&secret=" + hex.EncodeToString(secret)
+	return uri, client, nil
+}
+
+func (s *Server) RevokeConnection(client string) {
+	s.mu.Lock()
+	delete(s.clients, client)
+	s.mu.Unlock()
+}
+
+func (s *Server) connect() error {
+	r, err := dialRelay(s.Relay)
+	if err != nil {
+		return fmt.Errorf("failed to connect to relay %s: %w", s.Relay, err)
+	}
+
+	info := event{
+		Kind:    kindInfo,
+		Content: strings.Join(s.Methods, " "),
+		Tags:    [][]string{{"notifications", strings.Join(notifications, " ")}},
+	}
+	if err := info.sign(s.secret); err != nil {
+		r.close()
+		return err
+	}
+	if err := r.publish(info); err != nil {
+		r.close()
+		return fmt.Errorf("failed to publish info event: %w", err)
+	}
+	if err := r.subscribe("nwc", map[string]interface{}{
+		"kinds": []int{kindRequest},
+		"#p":    []string{s.pubkey},
+		"since": time.Now().Unix(),
+	}); err != nil {
+		r.close()
+		return fmt.Errorf("failed to subscribe to requests: %w", err)
+	}
+
+	s.mu.Lock()
+	s.relay = r
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Server) run() {
+	for {
+		s.mu.Lock()
+		r := s.relay
+		s.mu.Unlock()
+
+		for {
+			e, err := r.next()
+			if err != nil {
+				log.Printf("Lost connection to relay %s: %v", s.Relay, err)
+				break
+			}
+			if e.Kind != kindRequest || !e.verify() {
+				continue
+			}
+			go s.handleEvent(e)
+		}
+		r.close()
+
+		for {
+			time.Sleep(5 * time.Second)
+			if err := s.connect(); err != nil {
+				log.Printf("Failed to reconnect: %v", err)
+				continue
+			}
+			break
+		}
+	}
+}
+
+func (s *Server) handleEvent(e event) {
+	s.mu.Lock()
+	allowed := s.clients[e.PubKey]
+	s.mu.Unlock()
+
+	var res response
+	plaintext, err := decrypt(s.secret, e.PubKey, e.Content)
+	var req request
+	switch {
+	case !allowed:
+		res = errorResponse("", ErrorUnauthorized, "unknown connection")
+	case err != nil:
+		res = errorResponse("", ErrorOther, err.Error())
+	case json.Unmarshal(plaintext, &req) != nil:
+		res = errorResponse("", ErrorOther, "invalid request")
+	default:
+		res = s.handle(req)
+	}
+
+	if err := s.send(e.PubKey, kindResponse, res, []string{"e", e.ID}); err != nil {
+		log.Printf("Failed to respond to %s: %v", req.Method, err)
+	}
+}
+
+func (s *Server) notify(notificationType string, tx transaction) {
+	s.mu.Lock()
+	clients := make([]string, 0, len(s.clients))
+	for client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.mu.Unlock()
+
+	for _, client := range clients {
+		n := notification{NotificationType: notificationType, Notification: tx}
+		if err := s.send(client, kindNotification, n); err != nil {
+			log.Printf("Failed to send %s notification: %v", notificationType, err)
+		}
+	}
+}
+
+// send encrypts content to a client and publishes it.
+func (s *Server) send(client string, kind int, content interface{}, tags ...[]string) error {
+	plaintext, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encrypt(s.secret, client, plaintext)
+	if err != nil {
+		return err
+	}
+
+	e := event{
+		Kind:    kind,
+		Content: encrypted,
+		Tags:    append([][]string{{"p", client}}, tags...),
+	}
+	if err := e.sign(s.secret); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	r := s.relay
+	s.mu.Unlock()
+	return r.publish(e)
+}
+
+func (s *Server) handle(req request) response {
+	allowed := false
+	for _, method := range s.Methods {
+		if method == req.Method {
+			allowed = true
+		}
+	}
+	if !allowed {
+		for _, method := range allMethods {
+			if method == req.Method {
+				return errorResponse(req.Method, ErrorRestricted, "method not allowed")
+			}
+		}
+		return errorResponse(req.Method, ErrorNotImplemented, "unknown method")
+	}
+
+	switch req.Method {
+	case "pay_invoice":
+		var params struct {
+			Invoice string `json:"invoice"`
+			Amount  int64  `json:"amount"`
+		}
+		json.Unmarshal(req.Params, &params)
+		return s.payInvoice(params.Invoice, params.Amount)
+	case "make_invoice":
+		var params struct {
+			Amount          int64  `json:"amount"`
+			Description     string `json:"description"`
+			DescriptionHash string `json:"description_hash"`
+			Expiry          int64  `json:"expiry"`
+		}
+		json.Unmarshal(req.Params, &params)
+
+		invoiceParams := rp.InvoiceParams{Msatoshi: params.Amount, Description: params.Description}
+		if params.DescriptionHash != "" {
+			hash, err := hex.DecodeString(params.DescriptionHash)
+			if err != nil {
+				return errorResponse(req.Method, ErrorOther, "invalid description_hash")
+			}
+			invoiceParams.DescriptionHash = hash
+		}
+		if params.Expiry > 0 {
+			expiry := time.Duration(params.Expiry) * time.Second
+			invoiceParams.Expiry = &expiry
+		}
+
+		data, err := s.Wallet.CreateInvoice(invoiceParams)
+		if err != nil {
+			return errorResponse(req.Method, ErrorOther, err.Error())
+		}
+
+		tx := transaction{
+			Type:            "incoming",
+			State:           "pending",
+			Invoice:         data.Invoice,
+			Description:     params.Description,
+			DescriptionHash: params.DescriptionHash,
+			PaymentHash:     data.CheckingID,
+			Amount:          params.Amount,
+			CreatedAt:       time.Now().Unix(),
+		}
+		if inv, err := rp.DecodeBolt11(data.Invoice); err == nil {
+			tx.CreatedAt = inv.CreatedAt.Unix()
+			tx.ExpiresAt = inv.CreatedAt.Add(inv.Expiry).Unix()
+		}
+		return response{ResultType: req.Method, Result: tx}
+	case "lookup_invoice":
+		var params struct {
+			PaymentHash string `json:"payment_hash"`
+			Invoice     string `json:"invoice"`
+		}
+		json.Unmarshal(req.Params, &params)
+
+		hash := params.PaymentHash
+		if hash == "" {
+			inv, err := rp.DecodeBolt11(params.Invoice)
+			if err != nil {
+				return errorResponse(req.Method, ErrorOther, err.Error())
+			}
+			hash = inv.PaymentHash
+		}
+
+		status, err := s.Wallet.GetInvoiceStatus(hash)
+		if err != nil && !errors.Is(err, rp.ErrNotFound) {
+			return errorResponse(req.Method, ErrorInternal, err.Error())
+		}
+		if !status.Exists {
+			return errorResponse(req.Method, ErrorNotFound, "invoice not found")
+		}
+
+		tx := transaction{
+			Type:        "incoming",
+			State:       "pending",
+			Invoice:     params.Invoice,
+			Description: status.Description,
+			PaymentHash: hash,
+			Amount:      status.MSatoshiReceived,
+		}
+		switch {
+		case status.Paid:
+			tx.State = "settled"
+			tx.SettledAt = unix(status.SettledAt)
+		case status.Canceled:
+			tx.State = "failed"
+		}
+		return response{ResultType: req.Method, Result: tx}
+	case "get_balance":
+		info, err := s.Wallet.GetInfo()
+		if err != nil {
+			return errorResponse(req.Method, ErrorInternal, err.Error())
+		}
+		return response{ResultType: req.Method, Result: map[string]int64{
+			"balance": info.Balance * 1000,
+		}}
+	case "get_info":
+		result := map[string]interface{}{
+			"methods":       s.Methods,
+			"notifications": notifications,
+		}
+		if provider, ok := s.Wallet.(rp.NodeInfoProvider); ok {
+			if info, err := provider.GetNodeInfo(); err == nil {
+				result["alias"] = info.Alias
+				result["pubkey"] = info.Pubkey
+				result["network"] = info.Network
+				result["block_height"] = info.BlockHeight
+			}
+		}
+		return response{ResultType: req.Method, Result: result}
+	}
+
+	return errorResponse(req.Method, ErrorNotImplemented, "unknown method")
+}
+
+func (s *Server) payInvoice(invoice string, amount int64) response {
+	data, err := s.Wallet.MakePayment(rp.PaymentParams{Invoice: invoice, CustomAmount: amount})
+	if err != nil {
+		code := ErrorPaymentFailed
+		if errors.Is(err, rp.ErrInvalidParams) {
+			code = ErrorOther
+		}
+		return errorResponse("pay_invoice", code, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.PayTimeout)
+	defer cancel()
+	updates, err := rp.TrackPayment(ctx, s.Wallet, data.CheckingID)
+	if err != nil {
+		return errorResponse("pay_invoice", ErrorInternal, err.Error())
+	}
+
+	var last rp.PaymentStatus
+	for last = range updates {
+	}
+	switch last.Status {
+	case rp.Complete:
+		return response{ResultType: "pay_invoice", Result: map[string]interface{}{
+			"preimage":  last.Preimage,
+			"fees_paid": last.FeePaid,
+		}}
+	case rp.Failed:
+		if last.FailureReason == rp.FailureInsufficientBalance {
+			return errorResponse("pay_invoice", ErrorInsufficientBalance, "insufficient balance")
+		}
+		if last.FailureReason != "" {
+			return errorResponse("pay_invoice", ErrorPaymentFailed, "payment failed: "+string(last.FailureReason))
+		}
+		return errorResponse("pay_invoice", ErrorPaymentFailed, "payment failed")
+	}
+	return errorResponse("pay_invoice", ErrorInternal, "payment still pending")
+}
+
+func errorResponse(method string, code string, message string) response {
+	return response{ResultType: method, Error: &responseError{Code: code, Message: message}}
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
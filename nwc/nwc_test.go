@@ -0,0 +1,152 @@
+package nwc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+var (
+	serverSecret = bytes.Repeat([]byte{1}, 32)
+	clientSecret = bytes.Repeat([]byte{2}, 32)
+)
+
+func pubkey(secret []byte) string {
+	pub, _ := publicKey(secret)
+	return pub
+}
+
+func TestPublicKey(t *testing.T) {
+	// from the BIP340 test vectors
+	secret, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000003")
+	if got := pubkey(secret); got != "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9" {
+		t.Errorf("got %v, wanted the BIP340 key of 3", got)
+	}
+	for _, secret := range [][]byte{make([]byte, 32), bytes.Repeat([]byte{0xff}, 32), {1}} {
+		if _, err := publicKey(secret); err == nil {
+			t.Errorf("%x: got %v, wanted an error", secret, err)
+		}
+	}
+}
+
+func TestSchnorr(t *testing.T) {
+	// from the BIP340 test vectors, the second has an odd y key
+	for _, v := range []struct{ secret, aux, msg, sig string }{
+		{
+			"0000000000000000000000000000000000000000000000000000000000000003",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca821525f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0",
+		},
+		{
+			"b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef",
+			"0000000000000000000000000000000000000000000000000000000000000001",
+			"243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			"6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de33418906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a",
+		},
+	} {
+		secret, _ := hex.DecodeString(v.secret)
+		aux, _ := hex.DecodeString(v.aux)
+		msg, _ := hex.DecodeString(v.msg)
+		key, _ := privateKey(secret)
+
+		sig, err := schnorrSign(key, msg, aux)
+		if err != nil || hex.EncodeToString(sig) != v.sig {
+			t.Errorf("got %x, %v, wanted %v", sig, err, v.sig)
+		}
+		if !schnorrVerify(key.PubKey(), msg, sig) {
+			t.Errorf("%x: didn't verify", sig)
+		}
+		sig[63] ^= 1
+		if schnorrVerify(key.PubKey(), msg, sig) {
+			t.Errorf("%x: tampered signature verified", sig)
+		}
+	}
+}
+
+func TestEvent(t *testing.T) {
+	e := event{Kind: kindRequest, Content: "hello", Tags: [][]string{{"p", pubkey(serverSecret)}}}
+	if err := e.sign(clientSecret); err != nil {
+		t.Fatal(err)
+	}
+	if !e.verify() || e.PubKey != pubkey(clientSecret) || e.tag("p") != pubkey(serverSecret) {
+		t.Errorf("got %+v, wanted a valid event from the client", e)
+	}
+
+	e.Content = "tampered"
+	if e.verify() {
+		t.Error("tampered event verified")
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	content, err := encrypt(clientSecret, pubkey(serverSecret), []byte(`{"method":"get_info"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := decrypt(serverSecret, pubkey(clientSecret), content)
+	if err != nil || string(plaintext) != `{"method":"get_info"}` {
+		t.Errorf("got %s, %v, wanted the request back", plaintext, err)
+	}
+
+	if _, err := decrypt(serverSecret, pubkey(clientSecret), "garbage"); err == nil {
+		t.Error("got no error for invalid content")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	rp.TrackPollInterval = 10 * time.Millisecond
+
+	tw, _ := testwallet.Start(testwallet.Params{})
+	s := &Server{
+		Params: Params{Wallet: tw, Methods: allMethods, PayTimeout: time.Second},
+	}
+	call := func(method string, params interface{}) response {
+		raw, _ := json.Marshal(params)
+		return s.handle(request{Method: method, Params: raw})
+	}
+
+	res := call("make_invoice", map[string]interface{}{"amount": 5000, "description": "coffee"})
+	tx, _ := res.Result.(transaction)
+	if res.Error != nil || tx.Invoice == "" || tx.Amount != 5000 || tx.State != "pending" {
+		t.Fatalf("got %+v, wanted a pending invoice", res)
+	}
+
+	tw.SettleInvoice(tx.PaymentHash, 5000)
+	res = call("lookup_invoice", map[string]string{"payment_hash": tx.PaymentHash})
+	if tx, _ := res.Result.(transaction); res.Error != nil || tx.State != "settled" || tx.Amount != 5000 {
+		t.Errorf("got %+v, wanted a settled invoice", res)
+	}
+
+	res = call("lookup_invoice", map[string]string{"payment_hash": "00"})
+	if res.Error == nil || res.Error.Code != ErrorNotFound {
+		t.Errorf("got %+v, wanted NOT_FOUND", res)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		hash := sha256.Sum256([]byte("lnbc1")) // the testwallet checking id
+		tw.CompletePayment(hex.EncodeToString(hash[:]), "preimage", 12)
+	}()
+	res = call("pay_invoice", map[string]string{"invoice": "lnbc1"})
+	result, _ := res.Result.(map[string]interface{})
+	if res.Error != nil || result["preimage"] != "preimage" || result["fees_paid"] != int64(12) {
+		t.Errorf("got %+v, wanted the preimage and fees", res)
+	}
+
+	s.Methods = []string{"get_info"}
+	res = call("get_balance", nil)
+	if res.Error == nil || res.Error.Code != ErrorRestricted {
+		t.Errorf("got %+v, wanted RESTRICTED", res)
+	}
+	res = call("multi_pay_keysend", nil)
+	if res.Error == nil || res.Error.Code != ErrorNotImplemented {
+		t.Errorf("got %+v, wanted NOT_IMPLEMENTED", res)
+	}
+}
@@ -0,0 +1,63 @@
+package nwc
+
+import (
+	"encoding/json"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// relay is a connection to a nostr relay, only as much of NIP-01 as the wallet
+// service needs.
+type relay struct {
+	conn *websocket.Conn
+
+	mu sync.Mutex // for writes
+}
+
+func dialRelay(url string) (*relay, error) {
+	conn, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		return nil, err
+	}
+	return &relay{conn: conn}, nil
+}
+
+func (r *relay) send(msg ...interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return websocket.JSON.Send(r.conn, msg)
+}
+
+func (r *relay) publish(e event) error {
+	return r.send("EVENT", e)
+}
+
+func (r *relay) subscribe(id string, filter map[string]interface{}) error {
+	return r.send("REQ", id, filter)
+}
+
+// next returns the next event sent by the relay, skipping notices and the
+// other messages.
+func (r *relay) next() (event, error) {
+	for {
+		var msg []json.RawMessage
+		if err := websocket.JSON.Receive(r.conn, &msg); err != nil {
+			return event{}, err
+		}
+
+		var kind string
+		if len(msg) != 3 || json.Unmarshal(msg[0], &kind) != nil || kind != "EVENT" {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal(msg[2], &e); err != nil {
+			continue
+		}
+		return e, nil
+	}
+}
+
+func (r *relay) close() error {
+	return r.conn.Close()
+}
@@ -0,0 +1,101 @@
+package nwc
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// BIP-340 signatures, as nostr uses them. btcec's schnorr package would do
+// but it needs chainhash.TaggedHash, which the older btcd lnd v0.14 pins
+// doesn't have, so every module linking both wouldn't build.
+
+func taggedHash(tag string, msgs ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, msg := range msgs {
+		h.Write(msg)
+	}
+	return h.Sum(nil)
+}
+
+// xOnly serializes a public key as its x coordinate.
+func xOnly(pub *btcec.PublicKey) []byte {
+	return pub.SerializeCompressed()[1:]
+}
+
+// parseXOnly parses an x coordinate as the public key with an even y.
+func parseXOnly(x []byte) (*btcec.PublicKey, error) {
+	if len(x) != 32 {
+		return nil, errors.New("invalid x-only pubkey length")
+	}
+	return btcec.ParsePubKey(append([]byte{0x02}, x...))
+}
+
+func schnorrSign(key *btcec.PrivateKey, hash []byte, aux []byte) ([]byte, error) {
+	d := key.Key
+	pub := key.PubKey()
+	if pub.SerializeCompressed()[0] == 0x03 {
+		d.Negate()
+	}
+	px := xOnly(pub)
+
+	dBytes := d.Bytes()
+	t := taggedHash("BIP0340/aux", aux)
+	for i := range t {
+		t[i] ^= dBytes[i]
+	}
+
+	var k btcec.ModNScalar
+	k.SetByteSlice(taggedHash("BIP0340/nonce", t, px, hash))
+	if k.IsZero() {
+		return nil, errors.New("zero nonce")
+	}
+	var r btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&k, &r)
+	r.ToAffine()
+	if r.Y.IsOdd() {
+		k.Negate()
+	}
+	rx := r.X.Bytes()
+
+	var e btcec.ModNScalar
+	e.SetByteSlice(taggedHash("BIP0340/challenge", rx[:], px, hash))
+	s := e.Mul(&d).Add(&k).Bytes()
+
+	return append(rx[:], s[:]...), nil
+}
+
+func schnorrVerify(pub *btcec.PublicKey, hash []byte, sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+	var rx btcec.FieldVal
+	var s btcec.ModNScalar
+	if rx.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:]) {
+		return false
+	}
+
+	var e btcec.ModNScalar
+	e.SetByteSlice(taggedHash("BIP0340/challenge", sig[:32], xOnly(pub), hash))
+	e.Negate()
+
+	// R = sG - eP, P being the key with an even y
+	p, err := parseXOnly(xOnly(pub))
+	if err != nil {
+		return false
+	}
+	var P, sG, eP, R btcec.JacobianPoint
+	p.AsJacobian(&P)
+	btcec.ScalarBaseMultNonConst(&s, &sG)
+	btcec.ScalarMultNonConst(&e, &P, &eP)
+	btcec.AddNonConst(&sG, &eP, &R)
+	if (R.X.IsZero() && R.Y.IsZero()) || R.Z.IsZero() {
+		return false
+	}
+	R.ToAffine()
+	return !R.Y.IsOdd() && R.X.Equals(&rx)
+}
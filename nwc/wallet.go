@@ -0,0 +1,583 @@
+package nwc
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type WalletParams struct {
+	// URI is the nostr+walletconnect:// connection string given by the wallet
+	// service.
+	URI string
+
+	// Timeout is how long to wait for a response, defaults to 30 seconds.
+	Timeout time.Duration
+
+	// PayTimeout is how long pay_invoice can take, defaults to 5 minutes.
+	PayTimeout time.Duration
+}
+
+// NWCWallet is a backend that uses a remote wallet through Nostr Wallet
+// Connect, so any NWC provider can fund relampago apps.
+type NWCWallet struct {
+	WalletParams
+	walletPubkey string
+	relayURL     string
+	secret       []byte
+	pubkey       string
+
+	mu        sync.Mutex
+	relay     *relay
+	connected bool
+	pending   map[string]chan clientResponse // by request event id
+	payments  map[string]rp.PaymentStatus    // made by this process
+
+	invoices rp.InvoiceBroadcaster
+	updates  rp.PaymentBroadcaster
+}
+
+type clientResponse struct {
+	ResultType string          `json:"result_type"`
+	Error      *responseError  `json:"error"`
+	Result     json.RawMessage `json:"result"`
+}
+
+type clientNotification struct {
+	NotificationType string      `json:"notification_type"`
+	Notification     transaction `json:"notification"`
+}
+
+func Connect(params WalletParams) (*NWCWallet, error) {
+	u, err := url.Parse(params.URI)
+	if err != nil || (u.Scheme != "nostr+walletconnect" && u.Scheme != "nostrwalletconnect") {
+		return nil, fmt.Errorf("invalid nwc uri '%s'", params.URI)
+	}
+	q := u.Query()
+
+	walletPubkey := u.Host
+	if walletPubkey == "" {
+		walletPubkey = u.Opaque
+	}
+	if b, err := hex.DecodeString(walletPubkey); err != nil || len(b) != 32 {
+		return nil, fmt.Errorf("invalid wallet pubkey '%s'", walletPubkey)
+	}
+	secret, err := hex.DecodeString(q.Get("secret"))
+	if err != nil || len(secret) != 32 {
+		return nil, errors.New("nwc uri secret must be 32 hex-encoded bytes")
+	}
+	pubkey, err := publicKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	if q.Get("relay") == "" {
+		return nil, errors.New("nwc uri has no relay")
+	}
+
+	if params.Timeout == 0 {
+		params.Timeout = 30 * time.Second
+	}
+	if params.PayTimeout == 0 {
+		params.PayTimeout = 5 * time.Minute
+	}
+
+	w := &NWCWallet{
+		WalletParams: params,
+		walletPubkey: walletPubkey,
+		relayURL:     q.Get("relay"),
+		secret:       secret,
+		pubkey:       pubkey,
+		pending:      make(map[string]chan clientResponse),
+		payments:     make(map[string]rp.PaymentStatus),
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	go w.run()
+
+	return w, nil
+}
+
+// Compile time check to ensure that NWCWallet fully implements rp.Wallet
+var _ rp.Wallet = (*NWCWallet)(nil)
+
+func (w *NWCWallet) Kind() string {
+	return "nwc"
+}
+
+func (w *NWCWallet) Capabilities() rp.Capabilities {
+	return rp.Capabilities{
+		MaxDescriptionLength: rp.MaxBolt11DescriptionLength,
+	}
+}
+
+func (w *NWCWallet) GetInfo() (rp.WalletInfo, error) {
+	var res struct {
+		Balance int64 `json:"balance"`
+	}
+	if err := w.call("get_balance", nil, &res, w.Timeout); err != nil {
+		return rp.WalletInfo{}, err
+	}
+	return rp.WalletInfo{Balance: res.Balance / 1000}, nil
+}
+
+// Compile time check to ensure that NWCWallet implements rp.NodeInfoProvider
+var _ rp.NodeInfoProvider = (*NWCWallet)(nil)
+
+func (w *NWCWallet) GetNodeInfo() (rp.NodeInfo, error) {
+	var res struct {
+		Alias       string `json:"alias"`
+		Pubkey      string `json:"pubkey"`
+		Network     string `json:"network"`
+		BlockHeight int64  `json:"block_height"`
+	}
+	if err := w.call("get_info", nil, &res, w.Timeout); err != nil {
+		return rp.NodeInfo{}, err
+	}
+	return rp.NodeInfo{
+		Pubkey:      res.Pubkey,
+		Alias:       res.Alias,
+		Network:     res.Network,
+		BlockHeight: res.BlockHeight,
+	}, nil
+}
+
+func (w *NWCWallet) Health(ctx context.Context) (rp.HealthStatus, error) {
+	timeout := w.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if err := w.call("get_info", nil, nil, timeout); err != nil {
+		return rp.HealthStatus{}, err
+	}
+
+	w.mu.Lock()
+	connected := w.connected
+	w.mu.Unlock()
+
+	// the wallet service is trusted to follow the chain for us
+	return rp.HealthStatus{
+		Connected:     true,
+		SyncedToChain: true,
+		SyncedToGraph: true,
+		StreamsAlive:  connected,
+	}, nil
+}
+
+func (w *NWCWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	if err := rp.ValidateInvoiceParams(w.Capabilities(), params); err != nil {
+		return rp.InvoiceData{}, err
+	}
+	if params.Preimage != nil {
+		return rp.InvoiceData{}, fmt.Errorf("%w: nwc wallets pick their own preimages", rp.ErrUnsupported)
+	}
+
+	args := map[string]interface{}{
+		"amount":      params.Msatoshi,
+		"description": params.Description,
+	}
+	if params.DescriptionHash != nil {
+		args["description_hash"] = hex.EncodeToString(params.DescriptionHash)
+	}
+	if params.Expiry != nil {
+		args["expiry"] = int64(params.Expiry.Seconds())
+	}
+
+	var tx transaction
+	if err := w.call("make_invoice", args, &tx, w.Timeout); err != nil {
+		return rp.InvoiceData{}, err
+	}
+
+	checkingID := tx.PaymentHash
+	if checkingID == "" {
+		inv, err := rp.DecodeBolt11(tx.Invoice)
+		if err != nil {
+			return rp.InvoiceData{}, fmt.Errorf("failed to decode invoice '%s': %w", tx.Invoice, err)
+		}
+		checkingID = inv.PaymentHash
+	}
+
+	return rp.InvoiceData{
+		CheckingID: checkingID,
+		Invoice:    tx.Invoice,
+	}, nil
+}
+
+func (w *NWCWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	var tx transaction
+	err := w.call("lookup_invoice", map[string]string{"payment_hash": checkingID}, &tx, w.Timeout)
+	if errors.Is(err, rp.ErrNotFound) {
+		return rp.InvoiceNotFound(checkingID)
+	}
+	if err != nil {
+		return rp.InvoiceLookupFailed(checkingID,
+			fmt.Errorf("error looking up invoice %s: %w", checkingID, err))
+	}
+	return invoiceStatus(checkingID, tx), nil
+}
+
+func (w *NWCWallet) CancelInvoice(checkingID string) error {
+	return fmt.Errorf("%w: nwc can't cancel invoices", rp.ErrUnsupported)
+}
+
+func (w *NWCWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	listener, _ := w.invoices.Subscribe()
+	return listener, nil
+}
+
+func (w *NWCWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	inv, err := rp.DecodeBolt11(params.Invoice)
+	if err != nil {
+		return rp.PaymentData{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+	}
+
+	amount := inv.MSatoshi
+	if params.CustomAmount != 0 {
+		amount = params.CustomAmount
+	}
+	if err := rp.ValidatePayment(w.Capabilities(), params, amount); err != nil {
+		return rp.PaymentData{}, err
+	}
+
+	args := map[string]interface{}{"invoice": params.Invoice}
+	if params.CustomAmount != 0 {
+		args["amount"] = params.CustomAmount
+	}
+
+	w.mu.Lock()
+	w.payments[inv.PaymentHash] = rp.PaymentStatus{CheckingID: inv.PaymentHash, Status: rp.Pending}
+	w.mu.Unlock()
+
+	// pay_invoice only responds once the payment is resolved
+	go func() {
+		var res struct {
+			Preimage string `json:"preimage"`
+			FeesPaid int64  `json:"fees_paid"`
+		}
+		err := w.call("pay_invoice", args, &res, w.PayTimeout)
+
+		status := rp.PaymentStatus{
+			CheckingID: inv.PaymentHash,
+			Status:     rp.Complete,
+			FeePaid:    res.FeesPaid,
+			Preimage:   res.Preimage,
+			ResolvedAt: time.Now(),
+		}
+		var nwcErr *Error
+		switch {
+		case errors.As(err, &nwcErr) && nwcErr.Code == ErrorPaymentFailed:
+			status = rp.PaymentStatus{CheckingID: inv.PaymentHash, Status: rp.Failed, ResolvedAt: time.Now()}
+		case errors.As(err, &nwcErr) && nwcErr.Code == ErrorInsufficientBalance:
+			status = rp.PaymentStatus{
+				CheckingID:    inv.PaymentHash,
+				Status:        rp.Failed,
+				ResolvedAt:    time.Now(),
+				FailureReason: rp.FailureInsufficientBalance,
+			}
+		case err != nil:
+			// the payment may still go through, GetPaymentStatus will ask again
+			log.Printf("pay_invoice %s: %v", inv.PaymentHash, err)
+			return
+		}
+		w.resolvePayment(rp.FillPaymentDetails(status, params.Invoice))
+	}()
+
+	return rp.PaymentData{
+		CheckingID: inv.PaymentHash,
+	}, nil
+}
+
+func (w *NWCWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	w.mu.Lock()
+	known, ok := w.payments[checkingID]
+	w.mu.Unlock()
+	if ok && known.Status.Final() {
+		return known, nil
+	}
+
+	var tx transaction
+	err := w.call("lookup_invoice", map[string]string{"payment_hash": checkingID}, &tx, w.Timeout)
+	if errors.Is(err, rp.ErrNotFound) {
+		if ok {
+			return known, nil
+		}
+		return rp.PaymentStatus{CheckingID: checkingID, Status: rp.NeverTried}, nil
+	}
+	if err != nil {
+		return rp.PaymentStatus{}, fmt.Errorf("error getting payment %s: %w", checkingID, err)
+	}
+
+	status := paymentDetails(rp.PaymentStatus{CheckingID: checkingID, Status: rp.Pending}, tx)
+	switch tx.State {
+	case "settled":
+		status.Status = rp.Complete
+		status.Preimage = tx.Preimage
+		status.FeePaid = tx.FeesPaid
+		status.ResolvedAt = timeFromUnix(tx.SettledAt)
+	case "failed", "expired":
+		status.Status = rp.Failed
+	}
+	return status, nil
+}
+
+func (w *NWCWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	listener, _ := w.updates.Subscribe()
+	return listener, nil
+}
+
+// Compile time check to ensure that NWCWallet implements rp.Subscriber
+var _ rp.Subscriber = (*NWCWallet)(nil)
+
+func (w *NWCWallet) SubscribePaidInvoices() (<-chan rp.InvoiceStatus, func()) {
+	return w.invoices.Subscribe()
+}
+
+func (w *NWCWallet) SubscribePayments() (<-chan rp.PaymentStatus, func()) {
+	return w.updates.Subscribe()
+}
+
+// resolvePayment publishes a payment the first time it's seen resolved, as
+// both the pay_invoice response and the payment_sent notification tell it.
+func (w *NWCWallet) resolvePayment(status rp.PaymentStatus) {
+	w.mu.Lock()
+	known, ok := w.payments[status.CheckingID]
+	if ok && known.Status.Final() {
+		w.mu.Unlock()
+		return
+	}
+	w.payments[status.CheckingID] = status
+	w.mu.Unlock()
+
+	w.updates.Publish(status)
+}
+
+// Error is a NIP-47 error returned by the wallet service. It matches
+// rp.ErrNotFound and rp.ErrUnsupported with errors.Is for the codes meaning
+// those.
+type Error struct {
+	Method  string
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s failed with %s: %s", e.Method, e.Code, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch e.Code {
+	case ErrorNotFound:
+		return target == rp.ErrNotFound
+	case ErrorNotImplemented:
+		return target == rp.ErrUnsupported
+	}
+	return false
+}
+
+func (w *NWCWallet) call(method string, params interface{}, result interface{}, timeout time.Duration) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		raw = []byte("{}")
+	}
+	plaintext, err := json.Marshal(request{Method: method, Params: raw})
+	if err != nil {
+		return err
+	}
+	content, err := encrypt(w.secret, w.walletPubkey, plaintext)
+	if err != nil {
+		return err
+	}
+	e := event{
+		Kind:    kindRequest,
+		Content: content,
+		Tags:    [][]string{{"p", w.walletPubkey}},
+	}
+	if err := e.sign(w.secret); err != nil {
+		return err
+	}
+
+	responses := make(chan clientResponse, 1)
+	w.mu.Lock()
+	w.pending[e.ID] = responses
+	r := w.relay
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.pending, e.ID)
+		w.mu.Unlock()
+	}()
+
+	if err := r.publish(e); err != nil {
+		return fmt.Errorf("failed to send %s: %w", method, err)
+	}
+
+	select {
+	case res := <-responses:
+		if res.Error != nil {
+			if res.Error.Code == ErrorRestricted || res.Error.Code == ErrorUnauthorized {
+				return &rp.PermissionError{Method: method, Err: errors.New(res.Error.Message)}
+			}
+			return &Error{Method: method, Code: res.Error.Code, Message: res.Error.Message}
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(res.Result, result); err != nil {
+			return fmt.Errorf("invalid %s result: %w", method, err)
+		}
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("%s got no response after %s", method, timeout)
+	}
+}
+
+func (w *NWCWallet) connect() error {
+	r, err := dialRelay(w.relayURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to relay %s: %w", w.relayURL, err)
+	}
+	if err := r.subscribe("nwc", map[string]interface{}{
+		"kinds":   []int{kindResponse, kindNotification},
+		"authors": []string{w.walletPubkey},
+		"#p":      []string{w.pubkey},
+		"since":   time.Now().Unix(),
+	}); err != nil {
+		r.close()
+		return fmt.Errorf("failed to subscribe to responses: %w", err)
+	}
+
+	w.mu.Lock()
+	w.relay = r
+	w.connected = true
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *NWCWallet) run() {
+	for {
+		w.mu.Lock()
+		r := w.relay
+		w.mu.Unlock()
+
+		for {
+			e, err := r.next()
+			if err != nil {
+				log.Printf("Lost connection to relay %s: %v", w.relayURL, err)
+				break
+			}
+			w.dispatch(e)
+		}
+		r.close()
+
+		w.mu.Lock()
+		w.connected = false
+		w.mu.Unlock()
+
+		for {
+			time.Sleep(5 * time.Second)
+			if err := w.connect(); err != nil {
+				log.Printf("Failed to reconnect: %v", err)
+				continue
+			}
+			break
+		}
+	}
+}
+
+// dispatch hands responses to the calls waiting for them and publishes the
+// notifications.
+func (w *NWCWallet) dispatch(e event) {
+	if e.PubKey != w.walletPubkey || !e.verify() {
+		return
+	}
+	plaintext, err := decrypt(w.secret, w.walletPubkey, e.Content)
+	if err != nil {
+		return
+	}
+
+	switch e.Kind {
+	case kindResponse:
+		var res clientResponse
+		if err := json.Unmarshal(plaintext, &res); err != nil {
+			return
+		}
+		w.mu.Lock()
+		responses, ok := w.pending[e.tag("e")]
+		w.mu.Unlock()
+		if ok {
+			select {
+			case responses <- res:
+			default:
+			}
+		}
+	case kindNotification:
+		var n clientNotification
+		if err := json.Unmarshal(plaintext, &n); err != nil {
+			return
+		}
+		tx := n.Notification
+		switch n.NotificationType {
+		case "payment_received":
+			w.invoices.Publish(invoiceStatus(tx.PaymentHash, tx))
+		case "payment_sent":
+			w.resolvePayment(paymentDetails(rp.PaymentStatus{
+				CheckingID: tx.PaymentHash,
+				Status:     rp.Complete,
+				FeePaid:    tx.FeesPaid,
+				Preimage:   tx.Preimage,
+				ResolvedAt: timeFromUnix(tx.SettledAt),
+			}, tx))
+		}
+	}
+}
+
+func invoiceStatus(checkingID string, tx transaction) rp.InvoiceStatus {
+	status := rp.InvoiceStatus{
+		CheckingID:  checkingID,
+		Exists:      true,
+		Description: tx.Description,
+	}
+	switch tx.State {
+	case "settled":
+		status.Paid = true
+		status.MSatoshiReceived = tx.Amount
+		status.SettledAt = timeFromUnix(tx.SettledAt)
+		status.Preimage = tx.Preimage
+	case "failed", "expired":
+		status.Canceled = true
+	case "":
+		// services from before the state field only tell settled_at
+		if tx.SettledAt != 0 {
+			status.Paid = true
+			status.MSatoshiReceived = tx.Amount
+			status.SettledAt = timeFromUnix(tx.SettledAt)
+		}
+	}
+	return status
+}
+
+// paymentDetails fills the destination, amount and description of a payment
+// from the transaction.
+func paymentDetails(status rp.PaymentStatus, tx transaction) rp.PaymentStatus {
+	status.Msatoshi = tx.Amount
+	status.Description = tx.Description
+	return rp.FillPaymentDetails(status, tx.Invoice)
+}
+
+func timeFromUnix(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
@@ -0,0 +1,98 @@
+package nwc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+func TestConnectURI(t *testing.T) {
+	for _, uri := range []string{
+		"https://example.com",
+		"nostr+walletconnect://abcd?relay=wss://relay.example.com&secret=" + pubkey(clientSecret),
+		"nostr+walletconnect://" + pubkey(serverSecret) + "?relay=wss://relay.example.com&secret=zz",
+		"nostr+walletconnect://" + pubkey(serverSecret) + "?secret=" + pubkey(clientSecret),
+	} {
+		if _, err := Connect(WalletParams{URI: uri}); err == nil {
+			t.Errorf("%s: got no error", uri)
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	w := &NWCWallet{
+		walletPubkey: pubkey(serverSecret),
+		secret:       clientSecret,
+		pubkey:       pubkey(clientSecret),
+		pending:      make(map[string]chan clientResponse),
+		payments:     make(map[string]rp.PaymentStatus),
+	}
+	fromService := func(kind int, content interface{}, tags ...[]string) event {
+		plaintext, _ := json.Marshal(content)
+		encrypted, _ := encrypt(serverSecret, w.pubkey, plaintext)
+		e := event{Kind: kind, Content: encrypted, Tags: append([][]string{{"p", w.pubkey}}, tags...)}
+		e.sign(serverSecret)
+		return e
+	}
+
+	responses := make(chan clientResponse, 1)
+	w.pending["request"] = responses
+	w.dispatch(fromService(kindResponse,
+		errorResponse("lookup_invoice", ErrorNotFound, "invoice not found"), []string{"e", "request"}))
+	select {
+	case res := <-responses:
+		if res.Error == nil || res.Error.Code != ErrorNotFound {
+			t.Errorf("got %+v, wanted NOT_FOUND", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("got no response")
+	}
+
+	invoices, _ := w.SubscribePaidInvoices()
+	payments, _ := w.SubscribePayments()
+	w.payments["hash"] = rp.PaymentStatus{CheckingID: "hash", Status: rp.Pending}
+
+	go w.dispatch(fromService(kindNotification, notification{
+		NotificationType: "payment_received",
+		Notification:     transaction{Type: "incoming", State: "settled", PaymentHash: "inv", Amount: 5000},
+	}))
+	if status := <-invoices; !status.Paid || status.CheckingID != "inv" || status.MSatoshiReceived != 5000 {
+		t.Errorf("got %+v, wanted a paid invoice", status)
+	}
+
+	sent := fromService(kindNotification, notification{
+		NotificationType: "payment_sent",
+		Notification:     transaction{Type: "outgoing", State: "settled", PaymentHash: "hash", Preimage: "preimage"},
+	})
+	go w.dispatch(sent)
+	if status := <-payments; status.Status != rp.Complete || status.Preimage != "preimage" {
+		t.Errorf("got %+v, wanted a complete payment", status)
+	}
+
+	// only published once
+	go w.dispatch(sent)
+	select {
+	case status := <-payments:
+		t.Errorf("got %+v again", status)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// events not from the wallet service are ignored
+	forged := fromService(kindResponse, response{ResultType: "get_balance"}, []string{"e", "request"})
+	forged.sign(clientSecret)
+	w.pending["request"] = responses
+	w.dispatch(forged)
+	if len(responses) != 0 {
+		t.Error("got a response from someone else")
+	}
+}
+
+func TestError(t *testing.T) {
+	err := error(&Error{Method: "lookup_invoice", Code: ErrorNotFound, Message: "not found"})
+	if !errors.Is(err, rp.ErrNotFound) || errors.Is(err, rp.ErrUnsupported) {
+		t.Errorf("%v should only be rp.ErrNotFound", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Package payout makes many payments at once, like the withdrawals of an
+// exchange or a faucet, with a limit on how many are in flight and on the fee
+// of each one.
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+var ErrFeeTooHigh = errors.New("fee above the payout limit")
+
+type Policy struct {
+	// Concurrency is how many payments are in flight at once, defaults to 4.
+	Concurrency int
+
+	// MaxFeeMsatoshi and MaxFeePPM cap the fee of each payment, the lowest of
+	// the two applies. The cap is passed to the backend as
+	// PaymentParams.MaxFeeMsatoshi and payments whose estimated fee is above
+	// it are not made, for wallets that are rp.FeeEstimators.
+	MaxFeeMsatoshi int64
+	MaxFeePPM      int64
+
+	// Timeout is how long each payment is waited for once made, defaults to
+	// two minutes. Payments still in flight then are reported as pending.
+	Timeout time.Duration
+
+	// Progress, if set, gets every result as soon as it is known. It is
+	// never closed.
+	Progress chan<- Result
+}
+
+// Result is the outcome of one payment. Err is set when it couldn't be made,
+// Status when it was.
+type Result struct {
+	Index      int              `json:"index"` // in the payments given to PayMany
+	Invoice    string           `json:"invoice"`
+	CheckingID string           `json:"checkingID,omitempty"`
+	Status     rp.PaymentStatus `json:"status"`
+	Err        error            `json:"-"`
+}
+
+func (r Result) Succeeded() bool {
+	return r.Err == nil && r.Status.Status == rp.Complete
+}
+
+type Summary struct {
+	Results []Result `json:"results"` // in the order of the payments
+
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Pending   int `json:"pending"`
+
+	// Msatoshi is what the succeeded payments sent, without the fees.
+	Msatoshi    int64         `json:"msatoshi"`
+	FeeMsatoshi int64         `json:"feeMsatoshi"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// PayMany makes every payment and waits for them to complete or fail. Once
+// ctx is done no more payments are made, the ones left are reported as
+// failed with the ctx error.
+func PayMany(ctx context.Context, wallet rp.Wallet, payments []rp.PaymentParams, policy Policy) Summary {
+	if policy.Concurrency <= 0 {
+		policy.Concurrency = 4
+	}
+	if policy.Timeout == 0 {
+		policy.Timeout = 2 * time.Minute
+	}
+
+	start := time.Now()
+	results := make([]Result, len(payments))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < policy.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = pay(ctx, wallet, i, payments[i], policy)
+				if policy.Progress != nil {
+					policy.Progress <- results[i]
+				}
+			}
+		}()
+	}
+	for i := range payments {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	summary := Summary{Results: results, Duration: time.Since(start)}
+	for _, result := range results {
+		switch {
+		case result.Succeeded():
+			summary.Succeeded++
+			summary.Msatoshi += result.Status.Msatoshi
+			summary.FeeMsatoshi += result.Status.FeePaid
+		case result.Err == nil && !result.Status.Status.Final():
+			summary.Pending++
+		default:
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+func pay(ctx context.Context, wallet rp.Wallet, index int, params rp.PaymentParams, policy Policy) Result {
+	result := Result{Index: index, Invoice: params.Invoice}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	max, err := maxFee(policy, params)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if max > 0 {
+		if params.MaxFeeMsatoshi == 0 || params.MaxFeeMsatoshi > max {
+			params.MaxFeeMsatoshi = max
+		}
+		if estimator, ok := wallet.(rp.FeeEstimator); ok {
+			estimate, err := estimator.EstimatePaymentFee(rp.FeeEstimateParams{
+				Invoice:  params.Invoice,
+				Msatoshi: params.CustomAmount,
+			})
+			if err == nil && estimate.FeeMsatoshi > params.MaxFeeMsatoshi {
+				result.Err = fmt.Errorf("%w: estimated %d msat, the limit is %d msat",
+					ErrFeeTooHigh, estimate.FeeMsatoshi, params.MaxFeeMsatoshi)
+				return result
+			}
+		}
+	}
+
+	payment, err := wallet.MakePayment(params)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.CheckingID = payment.CheckingID
+	result.Status = rp.PaymentStatus{CheckingID: payment.CheckingID, Status: rp.Pending}
+
+	ctx, cancel := context.WithTimeout(ctx, policy.Timeout)
+	defer cancel()
+	updates, err := rp.TrackPayment(ctx, wallet, payment.CheckingID)
+	if err != nil {
+		return result // made, but can't tell how it ended
+	}
+	for status := range updates {
+		result.Status = status
+	}
+	return result
+}
+
+// maxFee is the fee cap of a payment, zero when there is none. The invoice is
+// only decoded when the cap depends on its amount.
+func maxFee(policy Policy, params rp.PaymentParams) (int64, error) {
+	max := policy.MaxFeeMsatoshi
+	if policy.MaxFeePPM == 0 {
+		return max, nil
+	}
+
+	msatoshi := params.CustomAmount
+	if msatoshi == 0 {
+		inv, err := rp.DecodeBolt11(params.Invoice)
+		if err != nil {
+			return 0, err
+		}
+		msatoshi = inv.MSatoshi
+	}
+	if relative := msatoshi * policy.MaxFeePPM / 1000000; max == 0 || relative < max {
+		max = relative
+	}
+	return max, nil
+}
@@ -0,0 +1,66 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/simnet"
+)
+
+func TestPayMany(t *testing.T) {
+	net := simnet.New(simnet.Params{})
+	exchange, _ := net.AddNode("exchange")
+	hub, _ := net.AddNode("hub")
+	net.Connect(exchange, hub, 10000000, 0)
+
+	var payments []rp.PaymentParams
+	for i, name := range []string{"alice", "bob", "carol"} {
+		user, _ := net.AddNode(name)
+		fee := int64(100)
+		if name == "carol" {
+			fee = 5000
+		}
+		net.Connect(hub, user, 10000000, 0).SetPolicy(hub, simnet.Policy{BaseFeeMsatoshi: fee})
+		inv, _ := user.CreateInvoice(rp.InvoiceParams{Msatoshi: int64(i+1) * 100000})
+		payments = append(payments, rp.PaymentParams{Invoice: inv.Invoice})
+	}
+	payments = append(payments, rp.PaymentParams{Invoice: "not an invoice"})
+
+	progress := make(chan Result, len(payments))
+	summary := PayMany(context.Background(), exchange, payments, Policy{
+		Concurrency:    2,
+		MaxFeeMsatoshi: 1000,
+		Progress:       progress,
+	})
+
+	if summary.Succeeded != 2 || summary.Failed != 2 || summary.Pending != 0 {
+		t.Errorf("got %+v, wanted 2 succeeded and 2 failed", summary)
+	}
+	if summary.Msatoshi != 300000 || summary.FeeMsatoshi != 200 {
+		t.Errorf("got %d msat sent with %d msat of fees, wanted 300000 with 200",
+			summary.Msatoshi, summary.FeeMsatoshi)
+	}
+	if carol := summary.Results[2]; carol.Status.FailureReason != rp.FailureNoRoute {
+		t.Errorf("got %+v, wanted the payment over the fee limit failed", carol)
+	}
+	if invalid := summary.Results[3]; !errors.Is(invalid.Err, rp.ErrInvalidBolt11) {
+		t.Errorf("got %v, wanted %v", invalid.Err, rp.ErrInvalidBolt11)
+	}
+	if len(progress) != len(payments) {
+		t.Errorf("got %d progress updates, wanted %d", len(progress), len(payments))
+	}
+}
+
+func TestPayMany_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	net := simnet.New(simnet.Params{})
+	wallet, _ := net.AddNode("exchange")
+	summary := PayMany(ctx, wallet, []rp.PaymentParams{{Invoice: "lnsim00"}}, Policy{})
+	if summary.Failed != 1 || !errors.Is(summary.Results[0].Err, context.Canceled) {
+		t.Errorf("got %+v, wanted the payment not made", summary)
+	}
+}
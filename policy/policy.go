@@ -0,0 +1,325 @@
+// Package policy puts guardrails on the payments of a wallet exposed to end
+// users: a maximum per payment, spending caps over sliding windows, a list of
+// allowed destinations and an approval step for large payments, either
+// through a callback or by holding them until someone approves them.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/screening"
+)
+
+var (
+	ErrAmountTooHigh         = errors.New("payment above the policy maximum")
+	ErrLimitReached          = errors.New("spending limit reached")
+	ErrDestinationNotAllowed = errors.New("destination not allowed by the policy")
+	ErrNotApproved           = errors.New("payment not approved")
+	ErrNotAwaitingApproval   = errors.New("payment is not awaiting approval")
+)
+
+// Limit caps what can be spent, fees included, over any Window, like
+// time.Hour or 24 * time.Hour.
+type Limit struct {
+	Window   time.Duration
+	Msatoshi int64
+}
+
+// Payment is what the approver gets to decide on.
+type Payment = screening.Destination
+
+// Approver decides on payments above Params.ApprovalThreshold, like by asking
+// an operator. Payments are refused when it errors.
+type Approver func(ctx context.Context, payment Payment) (bool, error)
+
+type Params struct {
+	Wallet rp.Wallet
+
+	// MaxPaymentMsatoshi is the largest single payment, no limit when zero.
+	MaxPaymentMsatoshi int64
+
+	Limits []Limit
+
+	// AllowedDestinations are the pubkeys that can be paid, any when empty.
+	AllowedDestinations []string
+
+	// Payments above ApprovalThreshold need Approve to say yes, they are
+	// refused when there is no Approve. ApprovalTimeout defaults to a minute.
+	ApprovalThreshold int64
+	Approve           Approver
+	ApprovalTimeout   time.Duration
+
+	// Payments above HoldThreshold aren't made right away, they are reported
+	// as rp.AwaitingApproval until ApprovePayment or RejectPayment is called.
+	// OnHold, if set, is told about each one, like to notify whoever approves
+	// them. Held payments count against the limits.
+	HoldThreshold int64
+	OnHold        func(Payment)
+}
+
+// PolicyWallet wraps another wallet and refuses the payments that break its
+// policy. Payments count against the limits from when they are made until
+// they fail, with their fees added once they complete.
+type PolicyWallet struct {
+	rp.Wallet
+	params  Params
+	allowed map[string]bool
+
+	holds screening.Holds
+
+	mu         sync.Mutex
+	spends     []*spend          // oldest first
+	heldSpends map[string]*spend // by checking id
+}
+
+type spend struct {
+	at         time.Time
+	checkingID string
+	msatoshi   int64
+}
+
+// for tests
+var now = time.Now
+
+func Start(params Params) (*PolicyWallet, error) {
+	if params.ApprovalTimeout == 0 {
+		params.ApprovalTimeout = time.Minute
+	}
+
+	payments, err := params.Wallet.PaymentsStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+	}
+
+	p := &PolicyWallet{
+		Wallet:     params.Wallet,
+		params:     params,
+		allowed:    make(map[string]bool),
+		heldSpends: make(map[string]*spend),
+	}
+	p.holds.HeldStatus = rp.AwaitingApproval
+	for _, pubkey := range params.AllowedDestinations {
+		p.allowed[pubkey] = true
+	}
+
+	go func() {
+		for status := range payments {
+			p.update(status)
+			p.holds.Publish(status)
+		}
+	}()
+
+	return p, nil
+}
+
+// Compile time check to ensure that PolicyWallet fully implements rp.Wallet
+var _ rp.Wallet = (*PolicyWallet)(nil)
+
+func (p *PolicyWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	payment, err := screening.DestinationOf(params)
+	if err != nil {
+		return rp.PaymentData{}, err
+	}
+
+	if max := p.params.MaxPaymentMsatoshi; max != 0 && payment.Msatoshi > max {
+		return rp.PaymentData{}, fmt.Errorf("%w: %d msat, the maximum is %d msat",
+			ErrAmountTooHigh, payment.Msatoshi, max)
+	}
+	if len(p.allowed) > 0 && !p.allowed[payment.Pubkey] {
+		return rp.PaymentData{}, fmt.Errorf("%w: %s", ErrDestinationNotAllowed, payment.Pubkey)
+	}
+	if err := p.approve(payment); err != nil {
+		return rp.PaymentData{}, err
+	}
+
+	// counted before it is made, so concurrent payments can't all fit
+	s := &spend{at: now(), checkingID: payment.PaymentHash, msatoshi: payment.Msatoshi}
+	p.mu.Lock()
+	if p.holds.IsHeld(payment.PaymentHash) {
+		p.mu.Unlock()
+		return rp.PaymentData{CheckingID: payment.PaymentHash}, nil
+	}
+	if err := p.check(s); err != nil {
+		p.mu.Unlock()
+		return rp.PaymentData{}, err
+	}
+	p.spends = append(p.spends, s)
+	if threshold := p.params.HoldThreshold; threshold != 0 && payment.Msatoshi > threshold {
+		p.holds.Hold(params, payment)
+		p.heldSpends[payment.PaymentHash] = s
+		p.mu.Unlock()
+
+		if p.params.OnHold != nil {
+			go p.params.OnHold(payment)
+		}
+		return rp.PaymentData{CheckingID: payment.PaymentHash}, nil
+	}
+	p.mu.Unlock()
+
+	data, err := p.Wallet.MakePayment(params)
+	if err != nil {
+		p.remove(s)
+	}
+	return data, err
+}
+
+// AwaitingApproval lists the held payments, oldest first.
+func (p *PolicyWallet) AwaitingApproval() []Payment {
+	return p.holds.Held()
+}
+
+// ApprovePayment makes a held payment. It still counts against the limits
+// from when it was held.
+func (p *PolicyWallet) ApprovePayment(checkingID string) (rp.PaymentData, error) {
+	params, ok := p.holds.Release(checkingID)
+	if !ok {
+		return rp.PaymentData{}, fmt.Errorf("%w: %s", ErrNotAwaitingApproval, checkingID)
+	}
+	s := p.takeHeldSpend(checkingID)
+
+	data, err := p.Wallet.MakePayment(params)
+	if err != nil {
+		p.remove(s)
+	}
+	return data, err
+}
+
+// RejectPayment drops a held payment, which is then reported as failed.
+func (p *PolicyWallet) RejectPayment(checkingID string) error {
+	if !p.holds.Reject(checkingID) {
+		return fmt.Errorf("%w: %s", ErrNotAwaitingApproval, checkingID)
+	}
+	p.remove(p.takeHeldSpend(checkingID))
+	return nil
+}
+
+func (p *PolicyWallet) takeHeldSpend(checkingID string) *spend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.heldSpends[checkingID]
+	delete(p.heldSpends, checkingID)
+	return s
+}
+
+func (p *PolicyWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	if status, ok := p.holds.Status(checkingID); ok {
+		return status, nil
+	}
+	return p.Wallet.GetPaymentStatus(checkingID)
+}
+
+// PaymentsStream reports rejected payments too, like the one of
+// screening.ScreeningWallet.
+func (p *PolicyWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	listener, _ := p.holds.Subscribe()
+	return listener, nil
+}
+
+func (p *PolicyWallet) approve(payment Payment) error {
+	threshold := p.params.ApprovalThreshold
+	if threshold == 0 || payment.Msatoshi <= threshold {
+		return nil
+	}
+	if p.params.Approve == nil {
+		return fmt.Errorf("%w: %d msat needs an approval and there is no approver",
+			ErrNotApproved, payment.Msatoshi)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.params.ApprovalTimeout)
+	defer cancel()
+
+	approved, err := p.params.Approve(ctx, payment)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotApproved, err)
+	}
+	if !approved {
+		return fmt.Errorf("%w: payment to %s", ErrNotApproved, payment.Pubkey)
+	}
+	return nil
+}
+
+// check must be called with p.mu held
+func (p *PolicyWallet) check(s *spend) error {
+	p.prune()
+	for _, limit := range p.params.Limits {
+		spent := p.spentSince(s.at.Add(-limit.Window))
+		if spent+s.msatoshi > limit.Msatoshi {
+			return fmt.Errorf("%w: %d msat spent in the last %s, the limit is %d msat",
+				ErrLimitReached, spent, limit.Window, limit.Msatoshi)
+		}
+	}
+	return nil
+}
+
+// prune drops the spends older than the longest window, with p.mu held.
+func (p *PolicyWallet) prune() {
+	var longest time.Duration
+	for _, limit := range p.params.Limits {
+		if limit.Window > longest {
+			longest = limit.Window
+		}
+	}
+	since := now().Add(-longest)
+
+	i := 0
+	for i < len(p.spends) && p.spends[i].at.Before(since) {
+		i++
+	}
+	p.spends = p.spends[i:]
+}
+
+func (p *PolicyWallet) spentSince(since time.Time) int64 {
+	var spent int64
+	for _, s := range p.spends {
+		if !s.at.Before(since) {
+			spent += s.msatoshi
+		}
+	}
+	return spent
+}
+
+// Spent is what was spent in the last window, fees included.
+func (p *PolicyWallet) Spent(window time.Duration) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.spentSince(now().Add(-window))
+}
+
+func (p *PolicyWallet) remove(s *spend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, other := range p.spends {
+		if other == s {
+			p.spends = append(p.spends[:i], p.spends[i+1:]...)
+			return
+		}
+	}
+}
+
+// update frees the spend of failed payments and adds the fee to the complete
+// ones.
+func (p *PolicyWallet) update(status rp.PaymentStatus) {
+	p.mu.Lock()
+	var found *spend
+	for _, s := range p.spends {
+		if s.checkingID == status.CheckingID {
+			found = s
+		}
+	}
+	if found != nil && status.Status == rp.Complete {
+		found.msatoshi += status.FeePaid
+		found.checkingID = "" // so the fee isn't added twice
+	}
+	p.mu.Unlock()
+
+	if found != nil && status.Status == rp.Failed {
+		p.remove(found)
+	}
+}
@@ -0,0 +1,241 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+const invoice = "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3"
+
+type payingWallet struct {
+	void.VoidWallet
+	paid     int
+	statuses chan rp.PaymentStatus
+}
+
+func (w *payingWallet) MakePayment(rp.PaymentParams) (rp.PaymentData, error) {
+	w.paid++
+	inv, _ := rp.DecodeBolt11(invoice)
+	return rp.PaymentData{CheckingID: inv.PaymentHash}, nil
+}
+
+func (w *payingWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	return w.statuses, nil
+}
+
+func start(t *testing.T, params Params) (*PolicyWallet, *payingWallet) {
+	wallet := &payingWallet{statuses: make(chan rp.PaymentStatus)}
+	params.Wallet = wallet
+	p, err := Start(params)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	return p, wallet
+}
+
+func pay(p *PolicyWallet, msatoshi int64) error {
+	_, err := p.MakePayment(rp.PaymentParams{Invoice: invoice, CustomAmount: msatoshi})
+	return err
+}
+
+func TestMaxPayment(t *testing.T) {
+	p, wallet := start(t, Params{MaxPaymentMsatoshi: 10000})
+
+	if err := pay(p, 10000); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if err := pay(p, 10001); !errors.Is(err, ErrAmountTooHigh) {
+		t.Errorf("got %v, wanted %v", err, ErrAmountTooHigh)
+	}
+	if wallet.paid != 1 {
+		t.Errorf("got %v, wanted %v payments", wallet.paid, 1)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	clock := time.Now()
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	p, wallet := start(t, Params{Limits: []Limit{
+		{Window: time.Hour, Msatoshi: 100000},
+		{Window: 24 * time.Hour, Msatoshi: 150000},
+	}})
+
+	if err := pay(p, 60000); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if err := pay(p, 60000); !errors.Is(err, ErrLimitReached) {
+		t.Errorf("got %v, wanted %v", err, ErrLimitReached)
+	}
+
+	// the hourly limit frees up, the daily one doesn't
+	clock = clock.Add(time.Hour + time.Second)
+	if err := pay(p, 60000); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if err := pay(p, 40000); !errors.Is(err, ErrLimitReached) {
+		t.Errorf("got %v, wanted %v", err, ErrLimitReached)
+	}
+	if spent := p.Spent(24 * time.Hour); spent != 120000 {
+		t.Errorf("got %v, wanted %v spent", spent, 120000)
+	}
+
+	// the whole day passed
+	clock = clock.Add(24*time.Hour + time.Second)
+	if spent := p.Spent(24 * time.Hour); spent != 0 {
+		t.Errorf("got %v, wanted %v spent", spent, 0)
+	}
+	if wallet.paid != 2 {
+		t.Errorf("got %v, wanted %v payments", wallet.paid, 2)
+	}
+}
+
+func TestFailedAndComplete(t *testing.T) {
+	p, wallet := start(t, Params{Limits: []Limit{{Window: time.Hour, Msatoshi: 100000}}})
+	inv, _ := rp.DecodeBolt11(invoice)
+
+	if err := pay(p, 90000); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	wallet.statuses <- rp.PaymentStatus{CheckingID: inv.PaymentHash, Status: rp.Failed}
+	wallet.statuses <- rp.PaymentStatus{} // the first one was handled once this is received
+	if spent := p.Spent(time.Hour); spent != 0 {
+		t.Errorf("got %v, wanted %v spent", spent, 0)
+	}
+
+	if err := pay(p, 90000); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	wallet.statuses <- rp.PaymentStatus{CheckingID: inv.PaymentHash, Status: rp.Complete, FeePaid: 500}
+	wallet.statuses <- rp.PaymentStatus{CheckingID: inv.PaymentHash, Status: rp.Complete, FeePaid: 500}
+	wallet.statuses <- rp.PaymentStatus{}
+	if spent := p.Spent(time.Hour); spent != 90500 {
+		t.Errorf("got %v, wanted %v spent", spent, 90500)
+	}
+}
+
+func TestAllowedDestinations(t *testing.T) {
+	inv, _ := rp.DecodeBolt11(invoice)
+
+	p, _ := start(t, Params{AllowedDestinations: []string{inv.Payee}})
+	if err := pay(p, 0); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+
+	p, _ = start(t, Params{AllowedDestinations: []string{"02aa"}})
+	if err := pay(p, 0); !errors.Is(err, ErrDestinationNotAllowed) {
+		t.Errorf("got %v, wanted %v", err, ErrDestinationNotAllowed)
+	}
+}
+
+func TestApproval(t *testing.T) {
+	var asked []Payment
+	approver := func(approved bool, err error) Approver {
+		return func(_ context.Context, payment Payment) (bool, error) {
+			asked = append(asked, payment)
+			return approved, err
+		}
+	}
+
+	for _, tc := range []struct {
+		approve Approver
+		amount  int64
+		err     error
+		asked   int
+	}{
+		{approver(false, nil), 1000, nil, 0},
+		{approver(true, nil), 5000, nil, 1},
+		{approver(false, nil), 5000, ErrNotApproved, 1},
+		{approver(true, errors.New("operator unreachable")), 5000, ErrNotApproved, 1},
+		{nil, 5000, ErrNotApproved, 0},
+	} {
+		asked = nil
+		p, _ := start(t, Params{ApprovalThreshold: 1000, Approve: tc.approve})
+
+		if err := pay(p, tc.amount); !errors.Is(err, tc.err) {
+			t.Errorf("got %v, wanted %v", err, tc.err)
+		}
+		if len(asked) != tc.asked {
+			t.Errorf("got %v, wanted %v approvals asked", len(asked), tc.asked)
+		}
+		if len(asked) > 0 && asked[0].Msatoshi != tc.amount {
+			t.Errorf("got %v, wanted %v", asked[0].Msatoshi, tc.amount)
+		}
+	}
+}
+
+func TestHold(t *testing.T) {
+	notified := make(chan Payment, 1)
+	p, wallet := start(t, Params{
+		Limits:        []Limit{{Window: time.Hour, Msatoshi: 100000}},
+		HoldThreshold: 10000,
+		OnHold:        func(payment Payment) { notified <- payment },
+	})
+
+	// below the threshold it goes through
+	if err := pay(p, 10000); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	wallet.paid = 0
+
+	data, err := p.MakePayment(rp.PaymentParams{Invoice: invoice, CustomAmount: 50000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if payment := <-notified; payment.Msatoshi != 50000 {
+		t.Errorf("got %v, wanted %v", payment.Msatoshi, 50000)
+	}
+	if wallet.paid != 0 {
+		t.Errorf("got %v, wanted %v payments", wallet.paid, 0)
+	}
+	if status, _ := p.GetPaymentStatus(data.CheckingID); status.Status != rp.AwaitingApproval {
+		t.Errorf("got %v, wanted %v", status.Status, rp.AwaitingApproval)
+	}
+	if held := p.AwaitingApproval(); len(held) != 1 || held[0].PaymentHash != data.CheckingID {
+		t.Errorf("got %v, wanted %v held", held, data.CheckingID)
+	}
+	if spent := p.Spent(time.Hour); spent != 60000 {
+		t.Errorf("got %v, wanted %v spent", spent, 60000)
+	}
+
+	if _, err := p.ApprovePayment(data.CheckingID); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if wallet.paid != 1 {
+		t.Errorf("got %v, wanted %v payments", wallet.paid, 1)
+	}
+	if _, err := p.ApprovePayment(data.CheckingID); !errors.Is(err, ErrNotAwaitingApproval) {
+		t.Errorf("got %v, wanted %v", err, ErrNotAwaitingApproval)
+	}
+}
+
+func TestReject(t *testing.T) {
+	p, wallet := start(t, Params{HoldThreshold: 10000})
+	payments, _ := p.PaymentsStream()
+
+	data, err := p.MakePayment(rp.PaymentParams{Invoice: invoice, CustomAmount: 50000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if err := p.RejectPayment(data.CheckingID); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if status := <-payments; status.CheckingID != data.CheckingID || status.Status != rp.Failed {
+		t.Errorf("got %v, wanted a failed %v", status, data.CheckingID)
+	}
+	if status, _ := p.GetPaymentStatus(data.CheckingID); status.Status != rp.Failed {
+		t.Errorf("got %v, wanted %v", status.Status, rp.Failed)
+	}
+	if wallet.paid != 0 {
+		t.Errorf("got %v, wanted %v payments", wallet.paid, 0)
+	}
+	if err := p.RejectPayment(data.CheckingID); !errors.Is(err, ErrNotAwaitingApproval) {
+		t.Errorf("got %v, wanted %v", err, ErrNotAwaitingApproval)
+	}
+}
@@ -0,0 +1,139 @@
+// Package pricing makes invoices for amounts in fiat currencies, converting
+// them at the rate of the moment the invoice is made:
+//
+//	inv, err := pricing.CreateInvoiceFiat(ctx, wallet, pricing.Kraken{}, "EUR", 5.00,
+//		rp.InvoiceParams{Description: "coffee"})
+//
+// The rate used is returned with the invoice, so it can be kept along the
+// order for accounting and refunds.
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+var ErrUnsupportedCurrency = errors.New("currency not supported")
+
+// Rate is the price of a bitcoin in a currency.
+type Rate struct {
+	Currency string    `json:"currency"` // ISO 4217, like EUR
+	Price    float64   `json:"price"`
+	Source   string    `json:"source"`
+	Time     time.Time `json:"time"`
+}
+
+// Msatoshi converts an amount in the rate currency, rounded to the msat.
+func (r Rate) Msatoshi(amount float64) int64 {
+	return int64(math.Round(amount / r.Price * 1e11))
+}
+
+// Fiat converts msatoshi to the rate currency.
+func (r Rate) Fiat(msatoshi int64) float64 {
+	return float64(msatoshi) / 1e11 * r.Price
+}
+
+// RateProvider is implemented by price sources, see Kraken, Coinbase and
+// Mempool.
+type RateProvider interface {
+	Rate(ctx context.Context, currency string) (Rate, error)
+}
+
+type FiatInvoice struct {
+	rp.InvoiceData
+
+	Msatoshi int64   `json:"msatoshi"`
+	Currency string  `json:"currency"`
+	Amount   float64 `json:"amount"`
+	Rate     Rate    `json:"rate"`
+}
+
+// Metadata is the conversion as strings, for stores that keep key value
+// pairs along invoices.
+func (f FiatInvoice) Metadata() map[string]string {
+	return map[string]string{
+		"fiat_currency": f.Currency,
+		"fiat_amount":   fmt.Sprint(f.Amount),
+		"rate":          fmt.Sprint(f.Rate.Price),
+		"rate_source":   f.Rate.Source,
+		"rate_time":     f.Rate.Time.UTC().Format(time.RFC3339),
+	}
+}
+
+// CreateInvoiceFiat creates an invoice for amount in currency, converted at
+// the rate given by provider. params.Msatoshi is replaced by the converted
+// amount.
+func CreateInvoiceFiat(ctx context.Context, wallet rp.Wallet, provider RateProvider,
+	currency string, amount float64, params rp.InvoiceParams) (FiatInvoice, error) {
+	if amount <= 0 {
+		return FiatInvoice{}, fmt.Errorf("%w: amount %v %s must be positive", rp.ErrInvalidParams, amount, currency)
+	}
+
+	currency = strings.ToUpper(currency)
+	rate, err := provider.Rate(ctx, currency)
+	if err != nil {
+		return FiatInvoice{}, fmt.Errorf("failed to get the %s rate: %w", currency, err)
+	}
+	if rate.Price <= 0 {
+		return FiatInvoice{}, fmt.Errorf("got an invalid %s rate from %s: %v", currency, rate.Source, rate.Price)
+	}
+
+	params.Msatoshi = rate.Msatoshi(amount)
+	inv, err := wallet.CreateInvoice(params)
+	if err != nil {
+		return FiatInvoice{}, err
+	}
+
+	return FiatInvoice{
+		InvoiceData: inv,
+		Msatoshi:    params.Msatoshi,
+		Currency:    currency,
+		Amount:      amount,
+		Rate:        rate,
+	}, nil
+}
+
+// Cache keeps the rates of a provider for ttl, as the public APIs limit how
+// often they can be called.
+func Cache(provider RateProvider, ttl time.Duration) RateProvider {
+	return &cache{provider: provider, ttl: ttl, rates: make(map[string]cached)}
+}
+
+type cache struct {
+	provider RateProvider
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	rates map[string]cached
+}
+
+type cached struct {
+	rate    Rate
+	fetched time.Time
+}
+
+func (c *cache) Rate(ctx context.Context, currency string) (Rate, error) {
+	c.mu.Lock()
+	entry, ok := c.rates[currency]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetched) < c.ttl {
+		return entry.rate, nil
+	}
+
+	rate, err := c.provider.Rate(ctx, currency)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	c.mu.Lock()
+	c.rates[currency] = cached{rate: rate, fetched: time.Now()}
+	c.mu.Unlock()
+	return rate, nil
+}
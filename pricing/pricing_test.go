@@ -0,0 +1,75 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+func serve(t *testing.T, path, body string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RequestURI() != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestProviders(t *testing.T) {
+	for name, provider := range map[string]RateProvider{
+		"kraken": Kraken{URL: serve(t, "/0/public/Ticker?pair=XBTEUR",
+			`{"error": [], "result": {"XXBTZEUR": {"c": ["50000.10000", "0.01"]}}}`)},
+		"coinbase": Coinbase{URL: serve(t, "/v2/prices/BTC-EUR/spot",
+			`{"data": {"amount": "50000.1", "base": "BTC", "currency": "EUR"}}`)},
+		"mempool": Mempool{URL: serve(t, "/api/v1/prices",
+			`{"time": 1700000000, "USD": 52000, "EUR": 50000.1}`)},
+	} {
+		rate, err := provider.Rate(context.Background(), "EUR")
+		if err != nil {
+			t.Errorf("%s: got %v, wanted %v", name, err, nil)
+			continue
+		}
+		if rate.Price != 50000.1 || rate.Source != name || rate.Currency != "EUR" {
+			t.Errorf("%s: got %+v, wanted 50000.1 EUR", name, rate)
+		}
+		if _, err := provider.Rate(context.Background(), "XYZ"); !errors.Is(err, ErrUnsupportedCurrency) {
+			t.Errorf("%s: got %v, wanted %v", name, err, ErrUnsupportedCurrency)
+		}
+	}
+}
+
+type fixed float64
+
+func (f fixed) Rate(_ context.Context, currency string) (Rate, error) {
+	return Rate{Currency: currency, Price: float64(f), Source: "fixed"}, nil
+}
+
+func TestCreateInvoiceFiat(t *testing.T) {
+	w, _ := testwallet.Start(testwallet.Params{})
+	inv, err := CreateInvoiceFiat(context.Background(), w, fixed(40000), "eur", 5,
+		rp.InvoiceParams{Description: "coffee"})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if inv.Msatoshi != 12500000 || inv.Currency != "EUR" || inv.Rate.Price != 40000 {
+		t.Errorf("got %+v, wanted 12500000 msat at 40000 EUR", inv)
+	}
+	if status, _ := w.GetInvoiceStatus(inv.CheckingID); status.Msatoshi != 12500000 {
+		t.Errorf("got %+v, wanted the invoice for the converted amount", status)
+	}
+	if got := inv.Metadata()["rate"]; got != "40000" {
+		t.Errorf("got rate %q, wanted %q", got, "40000")
+	}
+
+	if _, err := CreateInvoiceFiat(context.Background(), w, fixed(40000), "EUR", 0, rp.InvoiceParams{}); !errors.Is(err, rp.ErrInvalidParams) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrInvalidParams)
+	}
+}
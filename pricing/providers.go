@@ -0,0 +1,134 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kraken gets the last trade price from the Kraken public API.
+type Kraken struct {
+	Client *http.Client // defaults to http.DefaultClient
+	URL    string       // defaults to https://api.kraken.com
+}
+
+func (k Kraken) Rate(ctx context.Context, currency string) (Rate, error) {
+	var res struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			C []string `json:"c"` // price and volume of the last trade
+		} `json:"result"`
+	}
+	url := baseURL(k.URL, "https://api.kraken.com") + "/0/public/Ticker?pair=XBT" + currency
+	if err := getJSON(ctx, k.Client, url, &res); err != nil {
+		return Rate{}, err
+	}
+	if len(res.Error) > 0 {
+		if strings.Contains(res.Error[0], "Unknown asset pair") {
+			return Rate{}, fmt.Errorf("%w: kraken has no %s pair", ErrUnsupportedCurrency, currency)
+		}
+		return Rate{}, fmt.Errorf("kraken: %s", strings.Join(res.Error, ", "))
+	}
+
+	// the pair is named like XXBTZEUR in the result
+	for _, ticker := range res.Result {
+		if len(ticker.C) == 0 {
+			break
+		}
+		price, err := strconv.ParseFloat(ticker.C[0], 64)
+		if err != nil {
+			return Rate{}, fmt.Errorf("kraken returned an invalid price %q: %w", ticker.C[0], err)
+		}
+		return Rate{Currency: currency, Price: price, Source: "kraken", Time: time.Now()}, nil
+	}
+	return Rate{}, fmt.Errorf("%w: kraken returned no %s price", ErrUnsupportedCurrency, currency)
+}
+
+// Coinbase gets the spot price from the Coinbase API.
+type Coinbase struct {
+	Client *http.Client // defaults to http.DefaultClient
+	URL    string       // defaults to https://api.coinbase.com
+}
+
+func (c Coinbase) Rate(ctx context.Context, currency string) (Rate, error) {
+	var res struct {
+		Data struct {
+			Amount string `json:"amount"`
+		} `json:"data"`
+	}
+	url := baseURL(c.URL, "https://api.coinbase.com") + "/v2/prices/BTC-" + currency + "/spot"
+	if err := getJSON(ctx, c.Client, url, &res); err != nil {
+		return Rate{}, err
+	}
+	if res.Data.Amount == "" {
+		return Rate{}, fmt.Errorf("%w: coinbase returned no %s price", ErrUnsupportedCurrency, currency)
+	}
+	price, err := strconv.ParseFloat(res.Data.Amount, 64)
+	if err != nil {
+		return Rate{}, fmt.Errorf("coinbase returned an invalid price %q: %w", res.Data.Amount, err)
+	}
+	return Rate{Currency: currency, Price: price, Source: "coinbase", Time: time.Now()}, nil
+}
+
+// Mempool gets the prices published by a mempool.space instance, which only
+// has a few major currencies.
+type Mempool struct {
+	Client *http.Client // defaults to http.DefaultClient
+	URL    string       // defaults to https://mempool.space
+}
+
+func (m Mempool) Rate(ctx context.Context, currency string) (Rate, error) {
+	var res map[string]float64
+	url := baseURL(m.URL, "https://mempool.space") + "/api/v1/prices"
+	if err := getJSON(ctx, m.Client, url, &res); err != nil {
+		return Rate{}, err
+	}
+	price, ok := res[currency]
+	if !ok || currency == "time" {
+		return Rate{}, fmt.Errorf("%w: mempool has no %s price", ErrUnsupportedCurrency, currency)
+	}
+	rate := Rate{Currency: currency, Price: price, Source: "mempool", Time: time.Now()}
+	if t, ok := res["time"]; ok {
+		rate.Time = time.Unix(int64(t), 0)
+	}
+	return rate, nil
+}
+
+func baseURL(url, fallback string) string {
+	if url == "" {
+		return fallback
+	}
+	return strings.TrimSuffix(url, "/")
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	// coinbase answers unknown currencies like this, kraken with an error in
+	// the body
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%w: %s returned %s", ErrUnsupportedCurrency, url, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode the response of %s: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Package proxy lets backends reach nodes through a SOCKS5 proxy like Tor, as
+// many are only reachable as onion services.
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/proxy"
+)
+
+// Dialer opens connections through the proxy.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// SOCKS5 returns a Dialer for the proxy at address, like "127.0.0.1:9050" or
+// "socks5://127.0.0.1:9050". With isolate every Dialer uses its own random
+// credentials, which makes Tor (with IsolateSOCKSAuth, the default) build
+// separate circuits for it.
+func SOCKS5(address string, isolate bool) (Dialer, error) {
+	address = strings.TrimPrefix(address, "socks5://")
+	address = strings.TrimPrefix(address, "socks5h://")
+
+	var auth *proxy.Auth
+	if isolate {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return nil, fmt.Errorf("failed to generate isolation credentials: %w", err)
+		}
+		auth = &proxy.Auth{User: hex.EncodeToString(random[:8]), Password: hex.EncodeToString(random[8:])}
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", address, auth, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socks5 proxy '%s': %w", address, err)
+	}
+
+	return dialer.(Dialer), nil
+}
+
+// HTTPClient returns an http.Client that connects through the dialer.
+func HTTPClient(dialer Dialer) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: dialer.DialContext,
+		},
+	}
+}
+
+// Forward listens on a local port and forwards every connection to target
+// through the dialer. It is for client libraries that can't be given a
+// dialer: point them at the returned local address instead of target. As the
+// library will see a different host, this only works for plain http, which is
+// fine for onion services as they are already encrypted.
+func Forward(dialer Dialer, target string) (string, io.Closer, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to listen for proxy forwarding: %w", err)
+	}
+
+	go func() {
+		for {
+			local, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer local.Close()
+
+				remote, err := dialer.DialContext(context.Background(), "tcp", target)
+				if err != nil {
+					log.Printf("failed to reach %s through proxy: %s", target, err.Error())
+					return
+				}
+				defer remote.Close()
+
+				go io.Copy(remote, local)
+				io.Copy(local, remote)
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), ln, nil
+}
+
+// ForwardURL is Forward for an http url, returning the url to use instead.
+func ForwardURL(dialer Dialer, rawurl string) (string, io.Closer, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid url '%s': %w", rawurl, err)
+	}
+	if u.Scheme != "http" {
+		return "", nil, fmt.Errorf("only http urls can be forwarded through the proxy, got '%s'", rawurl)
+	}
+
+	target := u.Host
+	if u.Port() == "" {
+		target += ":80"
+	}
+
+	local, closer, err := Forward(dialer, target)
+	if err != nil {
+		return "", nil, err
+	}
+
+	u.Host = local
+	return u.String(), closer, nil
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordingDialer dials directly, recording where to.
+type recordingDialer struct {
+	dialed chan string
+}
+
+func (d recordingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.dialed <- address
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+func TestForwardURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "pong")
+	}))
+	defer srv.Close()
+
+	dialer := recordingDialer{dialed: make(chan string, 1)}
+	local, closer, err := ForwardURL(dialer, srv.URL+"/ping")
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if !strings.HasSuffix(local, "/ping") || strings.HasPrefix(local, srv.URL) {
+		t.Errorf("got %v, wanted a local url with the same path", local)
+	}
+
+	resp, err := http.Get(local)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "pong" {
+		t.Errorf("got %s, wanted %s", body, "pong")
+	}
+	if got, want := <-dialer.dialed, strings.TrimPrefix(srv.URL, "http://"); got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// closing stops the listener
+	closer.Close()
+	if _, err := (&http.Client{Transport: &http.Transport{}}).Get(local); err == nil {
+		t.Errorf("got %v, wanted the forwarder to be closed", err)
+	}
+}
+
+func TestForwardURL_Invalid(t *testing.T) {
+	dialer := recordingDialer{dialed: make(chan string, 1)}
+	if _, _, err := ForwardURL(dialer, "https://example.onion"); err == nil {
+		t.Errorf("got %v, wanted https to be refused", err)
+	}
+}
+
+func TestSOCKS5(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:9050", "socks5://127.0.0.1:9050", "socks5h://127.0.0.1:9050"} {
+		if _, err := SOCKS5(address, true); err != nil {
+			t.Errorf("%s: got %v, wanted %v", address, err, nil)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Class is the priority of a payment.
+type Class int
+
+const (
+	// Interactive payments are made while a user waits.
+	Interactive Class = iota
+
+	// Batch payments, like nightly payouts, only start when no interactive
+	// payment is waiting.
+	Batch
+)
+
+func (c Class) String() string {
+	switch c {
+	case Interactive:
+		return "interactive"
+	case Batch:
+		return "batch"
+	}
+	return fmt.Sprintf("class(%d)", int(c))
+}
+
+type Params struct {
+	Wallet rp.Wallet
+
+	// how many payments of each class can be in flight at the same time,
+	// default to 8 and 2
+	InteractiveConcurrency int
+	BatchConcurrency       int
+
+	// MaxInFlight limits both classes together, defaults to the sum of both.
+	MaxInFlight int
+}
+
+// QueueWallet wraps another wallet and holds payments until there is room for
+// them, counting a payment as in flight until it completes or fails. Waiting
+// interactive payments preempt waiting batch payments, but batch payments
+// that already started are left to finish as they can't be aborted.
+type QueueWallet struct {
+	rp.Wallet
+
+	limits      map[Class]int
+	maxInFlight int
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	running  map[Class]int
+	waiting  map[Class]int
+	inFlight map[string]Class
+	calling  int
+
+	// statuses that arrived while a MakePayment call was still in flight, in
+	// case they belong to it
+	early map[string]rp.PaymentStatus
+}
+
+func Start(params Params) (*QueueWallet, error) {
+	if params.InteractiveConcurrency == 0 {
+		params.InteractiveConcurrency = 8
+	}
+	if params.BatchConcurrency == 0 {
+		params.BatchConcurrency = 2
+	}
+	if params.MaxInFlight == 0 {
+		params.MaxInFlight = params.InteractiveConcurrency + params.BatchConcurrency
+	}
+
+	payments, err := params.Wallet.PaymentsStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+	}
+
+	q := &QueueWallet{
+		Wallet: params.Wallet,
+		limits: map[Class]int{
+			Interactive: params.InteractiveConcurrency,
+			Batch:       params.BatchConcurrency,
+		},
+		maxInFlight: params.MaxInFlight,
+		running:     make(map[Class]int),
+		waiting:     make(map[Class]int),
+		inFlight:    make(map[string]Class),
+		early:       make(map[string]rp.PaymentStatus),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	go func() {
+		for status := range payments {
+			q.mu.Lock()
+			q.resolve(status)
+			q.mu.Unlock()
+		}
+	}()
+
+	return q, nil
+}
+
+// MakePayment makes an interactive payment.
+func (q *QueueWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	return q.MakePaymentWithClass(Interactive, params)
+}
+
+// MakePaymentWithClass blocks until the payment can start, then makes it.
+func (q *QueueWallet) MakePaymentWithClass(class Class, params rp.PaymentParams) (rp.PaymentData, error) {
+	if _, ok := q.limits[class]; !ok {
+		return rp.PaymentData{}, fmt.Errorf("%w: unknown payment class %d", rp.ErrInvalidParams, class)
+	}
+
+	q.mu.Lock()
+	q.waiting[class]++
+	for !q.canStart(class) {
+		q.cond.Wait()
+	}
+	q.waiting[class]--
+	q.running[class]++
+	q.calling++
+	q.mu.Unlock()
+
+	data, err := q.Wallet.MakePayment(params)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.calling--
+	if err != nil {
+		q.release(class)
+	} else {
+		q.inFlight[data.CheckingID] = class
+		if status, ok := q.early[data.CheckingID]; ok {
+			q.resolve(status)
+		}
+	}
+	if q.calling == 0 {
+		q.early = make(map[string]rp.PaymentStatus)
+	}
+
+	return data, err
+}
+
+func (q *QueueWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	status, err := q.Wallet.GetPaymentStatus(checkingID)
+	if err == nil {
+		q.mu.Lock()
+		q.resolve(status)
+		q.mu.Unlock()
+	}
+	return status, err
+}
+
+// Running is how many payments of the class are in flight.
+func (q *QueueWallet) Running(class Class) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.running[class]
+}
+
+// Waiting is how many payments of the class are waiting for room.
+func (q *QueueWallet) Waiting(class Class) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting[class]
+}
+
+func (q *QueueWallet) canStart(class Class) bool {
+	if q.running[class] >= q.limits[class] {
+		return false
+	}
+	if q.running[Interactive]+q.running[Batch] >= q.maxInFlight {
+		return false
+	}
+	if class == Batch && q.waiting[Interactive] > 0 {
+		return false
+	}
+	return true
+}
+
+func (q *QueueWallet) resolve(status rp.PaymentStatus) {
+	if status.Status != rp.Complete && status.Status != rp.Failed && status.Status != rp.NeverTried {
+		return
+	}
+
+	class, ok := q.inFlight[status.CheckingID]
+	if !ok {
+		if q.calling > 0 {
+			q.early[status.CheckingID] = status
+		}
+		return
+	}
+
+	delete(q.inFlight, status.CheckingID)
+	q.release(class)
+}
+
+func (q *QueueWallet) release(class Class) {
+	q.running[class]--
+	q.cond.Broadcast()
+}
@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+type made struct {
+	class      Class
+	checkingID string
+}
+
+func TestInteractivePreemptsBatch(t *testing.T) {
+	wallet, _ := testwallet.Start(testwallet.Params{})
+	q, err := Start(Params{Wallet: wallet, InteractiveConcurrency: 1, BatchConcurrency: 1, MaxInFlight: 1})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	// a batch payment takes the only slot
+	first, err := q.MakePaymentWithClass(Batch, rp.PaymentParams{Invoice: "lnbc1"})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	order := make(chan made, 2)
+	go func() {
+		payment, _ := q.MakePaymentWithClass(Batch, rp.PaymentParams{Invoice: "lnbc2"})
+		order <- made{Batch, payment.CheckingID}
+	}()
+	waitFor(t, func() bool { return q.Waiting(Batch) == 1 })
+	go func() {
+		payment, _ := q.MakePayment(rp.PaymentParams{Invoice: "lnbc3"})
+		order <- made{Interactive, payment.CheckingID}
+	}()
+	waitFor(t, func() bool { return q.Waiting(Interactive) == 1 })
+
+	// the first payment finishes, the interactive one should go next
+	wallet.CompletePayment(first.CheckingID, "", 0)
+	next := <-order
+	if next.class != Interactive {
+		t.Errorf("got %v, wanted %v", next.class, Interactive)
+	}
+
+	wallet.FailPayment(next.checkingID)
+	if got := <-order; got.class != Batch {
+		t.Errorf("got %v, wanted %v", got.class, Batch)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("condition not met")
+}
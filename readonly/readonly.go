@@ -0,0 +1,40 @@
+// Package readonly wraps a wallet so it can't spend, for dashboards and audit
+// tools that are only given an invoice or readonly macaroon anyway and
+// shouldn't even try:
+//
+//	wallet, err := readonly.Start(readonly.Params{Wallet: backend})
+package readonly
+
+import (
+	"fmt"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type Params struct {
+	Wallet rp.Wallet
+}
+
+// ReadOnlyWallet creates invoices and answers status queries with the wallet
+// it wraps, while MakePayment fails with rp.ErrReadOnly without reaching it.
+//
+// Only the methods of rp.Wallet are exposed, so the optional interfaces of the
+// backend, and their spend paths like SendOnchain or SettleHoldInvoice, are
+// hidden too.
+type ReadOnlyWallet struct {
+	rp.Wallet
+}
+
+func Start(params Params) (*ReadOnlyWallet, error) {
+	if params.Wallet == nil {
+		return nil, fmt.Errorf("%w: a wallet is needed", rp.ErrInvalidParams)
+	}
+	return &ReadOnlyWallet{Wallet: params.Wallet}, nil
+}
+
+// Compile time check to ensure that ReadOnlyWallet fully implements rp.Wallet
+var _ rp.Wallet = (*ReadOnlyWallet)(nil)
+
+func (r *ReadOnlyWallet) MakePayment(rp.PaymentParams) (rp.PaymentData, error) {
+	return rp.PaymentData{}, fmt.Errorf("%w: payments are disabled", rp.ErrReadOnly)
+}
@@ -0,0 +1,34 @@
+package readonly
+
+import (
+	"errors"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+func TestReadOnly(t *testing.T) {
+	backend, _ := testwallet.Start(testwallet.Params{})
+	wallet, err := Start(Params{Wallet: backend})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	inv, err := wallet.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, Description: "audit"})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	backend.SettleInvoice(inv.CheckingID, 1000)
+	status, err := wallet.GetInvoiceStatus(inv.CheckingID)
+	if err != nil || !status.Paid {
+		t.Errorf("got %+v %v, wanted a paid invoice", status, err)
+	}
+
+	if _, err := wallet.MakePayment(rp.PaymentParams{Invoice: inv.Invoice}); !errors.Is(err, rp.ErrReadOnly) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrReadOnly)
+	}
+	if _, ok := interface{}(wallet).(rp.OnchainWallet); ok {
+		t.Errorf("got an onchain wallet, wanted the spend paths hidden")
+	}
+}
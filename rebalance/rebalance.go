@@ -0,0 +1,283 @@
+// Package rebalance moves liquidity between the channels of a node with
+// circular payments: the node pays itself an invoice leaving through a
+// channel with too much local balance and coming back through one with too
+// little, paying only the routing fees.
+//
+//	r, err := rebalance.Start(rebalance.Params{Wallet: wallet})
+//	result, err := r.Rebalance(ctx, rebalance.Request{})
+//
+// The wallet must be an rp.ChannelLister with Capabilities.PeerRestrictions
+// that can pay itself with PaymentParams.AllowSelfPayment, like lnd. The
+// invoices it pays are the node's own, so they show up as paid invoices to
+// anything that streams them.
+package rebalance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	rp "github.com/lnbits/relampago"
+)
+
+var (
+	ErrNoChannels = errors.New("no channels to rebalance")
+	ErrFailed     = errors.New("rebalance failed")
+)
+
+type Params struct {
+	Wallet rp.Wallet
+
+	// MaxFeePPM is the most paid in fees, in parts per million of the amount
+	// moved, when a request has no MaxFeeMsatoshi. Defaults to 500.
+	MaxFeePPM int64
+
+	// Attempts is how many channel pairs are tried before giving up,
+	// defaults to 3.
+	Attempts int
+
+	// OnProgress is called as each attempt is made and resolved.
+	OnProgress func(Progress)
+}
+
+// Request moves Msatoshi out of channel From and into channel To. When From
+// or To are empty the channel is picked, From among the ones with the most
+// local balance and To among the ones with the least, and with no Msatoshi
+// what brings both closer to half is moved.
+type Request struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Msatoshi int64  `json:"msatoshi"`
+
+	// MaxFeeMsatoshi caps the fee of the rebalance, failed attempts cost
+	// nothing.
+	MaxFeeMsatoshi int64 `json:"maxFeeMsatoshi"`
+}
+
+type Result struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Msatoshi    int64  `json:"msatoshi"`
+	FeeMsatoshi int64  `json:"feeMsatoshi"`
+	Attempts    int    `json:"attempts"`
+}
+
+type Stage string
+
+const (
+	Attempting Stage = "attempting"
+	Failed     Stage = "failed"
+	Succeeded  Stage = "succeeded"
+)
+
+// Progress is an attempt of a rebalance, Err is set when it failed and
+// FeeMsatoshi when it succeeded.
+type Progress struct {
+	Stage       Stage  `json:"stage"`
+	Attempt     int    `json:"attempt"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Msatoshi    int64  `json:"msatoshi"`
+	FeeMsatoshi int64  `json:"feeMsatoshi,omitempty"`
+	Err         error  `json:"-"`
+}
+
+type Rebalancer struct {
+	params Params
+	lister rp.ChannelLister
+}
+
+func Start(params Params) (*Rebalancer, error) {
+	lister, ok := params.Wallet.(rp.ChannelLister)
+	if !ok || !params.Wallet.Capabilities().PeerRestrictions {
+		return nil, fmt.Errorf("%w: %s can't choose the channels of a payment",
+			rp.ErrUnsupported, params.Wallet.Kind())
+	}
+	if params.MaxFeePPM == 0 {
+		params.MaxFeePPM = 500
+	}
+	if params.Attempts == 0 {
+		params.Attempts = 3
+	}
+	if params.OnProgress == nil {
+		params.OnProgress = func(Progress) {}
+	}
+	return &Rebalancer{params: params, lister: lister}, nil
+}
+
+// Rebalance tries the channel pairs of the request one after the other until
+// a payment goes through or Params.Attempts were made.
+func (r *Rebalancer) Rebalance(ctx context.Context, req Request) (Result, error) {
+	channels, err := r.lister.ListChannels()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to list channels: %w", err)
+	}
+	pairs, err := candidates(channels, req)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var lastErr error
+	attempts := 0
+	for _, pair := range pairs {
+		if attempts == r.params.Attempts {
+			break
+		}
+		progress := Progress{
+			Stage:    Attempting,
+			From:     pair.from.ID,
+			To:       pair.to.ID,
+			Msatoshi: req.Msatoshi,
+		}
+		if progress.Msatoshi == 0 {
+			progress.Msatoshi = balancingAmount(pair.from, pair.to)
+		}
+		if progress.Msatoshi <= 0 {
+			continue
+		}
+		attempts++
+		progress.Attempt = attempts
+		r.params.OnProgress(progress)
+
+		fee, err := r.attempt(ctx, pair, progress.Msatoshi, req.MaxFeeMsatoshi)
+		if err != nil {
+			progress.Stage = Failed
+			progress.Err = err
+			r.params.OnProgress(progress)
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		progress.Stage = Succeeded
+		progress.FeeMsatoshi = fee
+		r.params.OnProgress(progress)
+		return Result{
+			From:        progress.From,
+			To:          progress.To,
+			Msatoshi:    progress.Msatoshi,
+			FeeMsatoshi: fee,
+			Attempts:    progress.Attempt,
+		}, nil
+	}
+
+	if lastErr == nil {
+		return Result{}, fmt.Errorf("%w: the channels are already balanced", ErrNoChannels)
+	}
+	return Result{}, fmt.Errorf("%w: %s", ErrFailed, lastErr)
+}
+
+func (r *Rebalancer) attempt(ctx context.Context, pair pair, msatoshi, maxFee int64) (int64, error) {
+	outgoing, err := strconv.ParseUint(pair.from.ID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: channel id %s isn't a number", rp.ErrUnsupported, pair.from.ID)
+	}
+	if maxFee == 0 {
+		maxFee = msatoshi * r.params.MaxFeePPM / 1000000
+	}
+
+	inv, err := r.params.Wallet.CreateInvoice(rp.InvoiceParams{
+		Msatoshi:    msatoshi,
+		Description: fmt.Sprintf("rebalance from %s to %s", pair.from.ID, pair.to.ID),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the invoice: %w", err)
+	}
+	payment, err := r.params.Wallet.MakePayment(rp.PaymentParams{
+		Invoice:            inv.Invoice,
+		OutgoingChannelIDs: []uint64{outgoing},
+		LastHopPubkey:      pair.to.Peer,
+		MaxFeeMsatoshi:     maxFee,
+		AllowSelfPayment:   true,
+	})
+	if err != nil {
+		r.params.Wallet.CancelInvoice(inv.CheckingID)
+		return 0, err
+	}
+
+	updates, err := rp.TrackPayment(ctx, r.params.Wallet, payment.CheckingID)
+	if err != nil {
+		return 0, err
+	}
+	for status := range updates {
+		switch status.Status {
+		case rp.Complete:
+			return status.FeePaid, nil
+		case rp.Failed:
+			r.params.Wallet.CancelInvoice(inv.CheckingID)
+			if status.FailureReason == "" {
+				return 0, errors.New("payment failed")
+			}
+			return 0, fmt.Errorf("payment failed: %s", status.FailureReason)
+		}
+	}
+	return 0, fmt.Errorf("stopped waiting for the payment: %w", ctx.Err())
+}
+
+type pair struct {
+	from, to rp.Channel
+}
+
+// candidates pairs the channels to move from with the ones to move into, the
+// ones furthest apart in local balance first.
+func candidates(channels []rp.Channel, req Request) ([]pair, error) {
+	var from, to []rp.Channel
+	for _, channel := range channels {
+		if !channel.Active {
+			continue
+		}
+		if req.From == "" || channel.ID == req.From {
+			from = append(from, channel)
+		}
+		if req.To == "" || channel.ID == req.To {
+			to = append(to, channel)
+		}
+	}
+	if len(from) == 0 || len(to) == 0 {
+		return nil, fmt.Errorf("%w: no active channels to move from and into", ErrNoChannels)
+	}
+	var pairs []pair
+	for _, f := range from {
+		for _, t := range to {
+			// the payment can't leave and come back through the same peer
+			if f.Peer == t.Peer {
+				continue
+			}
+			if req.Msatoshi != 0 && (f.LocalMsatoshi < req.Msatoshi || t.RemoteMsatoshi < req.Msatoshi) {
+				continue
+			}
+			pairs = append(pairs, pair{f, t})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return localRatio(pairs[i].from)-localRatio(pairs[i].to) >
+			localRatio(pairs[j].from)-localRatio(pairs[j].to)
+	})
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("%w: no pair of channels with different peers has the balance", ErrNoChannels)
+	}
+	return pairs, nil
+}
+
+func localRatio(channel rp.Channel) float64 {
+	total := channel.LocalMsatoshi + channel.RemoteMsatoshi
+	if total == 0 {
+		return 0
+	}
+	return float64(channel.LocalMsatoshi) / float64(total)
+}
+
+// balancingAmount is what takes one of the channels to half its balance
+// without taking the other past it.
+func balancingAmount(from, to rp.Channel) int64 {
+	out := from.LocalMsatoshi - (from.LocalMsatoshi+from.RemoteMsatoshi)/2
+	in := (to.LocalMsatoshi+to.RemoteMsatoshi)/2 - to.LocalMsatoshi
+	if in < out {
+		return in
+	}
+	return out
+}
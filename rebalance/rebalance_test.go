@@ -0,0 +1,148 @@
+package rebalance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+// node pays its own invoices right away, failing the ones that come back
+// through the peers in fail.
+type node struct {
+	void.VoidWallet
+	channels []rp.Channel
+	fail     map[string]bool
+
+	invoices int
+	paid     []rp.PaymentParams
+	statuses map[string]rp.PaymentStatus
+	canceled []string
+}
+
+func (n *node) Capabilities() rp.Capabilities {
+	return rp.Capabilities{PeerRestrictions: true}
+}
+
+func (n *node) ListChannels() ([]rp.Channel, error) {
+	return n.channels, nil
+}
+
+func (n *node) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	n.invoices++
+	id := fmt.Sprint(n.invoices)
+	return rp.InvoiceData{CheckingID: id, Invoice: "lnself" + id}, nil
+}
+
+func (n *node) CancelInvoice(checkingID string) error {
+	n.canceled = append(n.canceled, checkingID)
+	return nil
+}
+
+func (n *node) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	n.paid = append(n.paid, params)
+	id := params.Invoice[len("lnself"):]
+	status := rp.PaymentStatus{CheckingID: id, Status: rp.Complete, FeePaid: 10}
+	if n.fail[params.LastHopPubkey] {
+		status = rp.PaymentStatus{CheckingID: id, Status: rp.Failed, FailureReason: rp.FailureNoRoute}
+	}
+	n.statuses[id] = status
+	return rp.PaymentData{CheckingID: id}, nil
+}
+
+func (n *node) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	return n.statuses[checkingID], nil
+}
+
+func channel(id, peer string, local, remote int64) rp.Channel {
+	return rp.Channel{
+		ChannelInfo:    rp.ChannelInfo{ID: id, Peer: peer},
+		Active:         true,
+		LocalMsatoshi:  local,
+		RemoteMsatoshi: remote,
+	}
+}
+
+func newNode() *node {
+	return &node{
+		channels: []rp.Channel{
+			channel("1", "02a", 900000, 100000),
+			channel("2", "02b", 100000, 900000),
+			channel("3", "02c", 300000, 700000),
+		},
+		fail:     make(map[string]bool),
+		statuses: make(map[string]rp.PaymentStatus),
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	n := newNode()
+	r, err := Start(Params{Wallet: n})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	result, err := r.Rebalance(context.Background(), Request{})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	want := Result{From: "1", To: "2", Msatoshi: 400000, FeeMsatoshi: 10, Attempts: 1}
+	if result != want {
+		t.Errorf("got %+v, wanted %+v", result, want)
+	}
+	paid := n.paid[0]
+	if len(paid.OutgoingChannelIDs) != 1 || paid.OutgoingChannelIDs[0] != 1 ||
+		paid.LastHopPubkey != "02b" || !paid.AllowSelfPayment || paid.MaxFeeMsatoshi != 200 {
+		t.Errorf("got %+v, wanted a self payment out of 1 and into 2 paying 200 msat at most", paid)
+	}
+
+	// a given pair and amount
+	result, err = r.Rebalance(context.Background(), Request{From: "3", To: "2", Msatoshi: 50000, MaxFeeMsatoshi: 5})
+	if err != nil || result.From != "3" || result.To != "2" || result.Msatoshi != 50000 {
+		t.Errorf("got %+v %v, wanted 50000 msat from 3 to 2", result, err)
+	}
+	if n.paid[1].MaxFeeMsatoshi != 5 {
+		t.Errorf("got %v, wanted %v", n.paid[1].MaxFeeMsatoshi, 5)
+	}
+}
+
+func TestRebalance_Retry(t *testing.T) {
+	n := newNode()
+	n.fail["02b"] = true
+	var progress []Progress
+	r, _ := Start(Params{Wallet: n, OnProgress: func(p Progress) { progress = append(progress, p) }})
+
+	result, err := r.Rebalance(context.Background(), Request{})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	want := Result{From: "1", To: "3", Msatoshi: 200000, FeeMsatoshi: 10, Attempts: 2}
+	if result != want {
+		t.Errorf("got %+v, wanted %+v", result, want)
+	}
+
+	var stages []Stage
+	for _, p := range progress {
+		stages = append(stages, p.Stage)
+	}
+	if fmt.Sprint(stages) != fmt.Sprint([]Stage{Attempting, Failed, Attempting, Succeeded}) {
+		t.Errorf("got %v, wanted an attempt failing and one succeeding", stages)
+	}
+	if len(n.canceled) != 1 || n.canceled[0] != "1" {
+		t.Errorf("got %v, wanted the invoice of the failed attempt canceled", n.canceled)
+	}
+
+	n.fail["02c"] = true
+	if _, err := r.Rebalance(context.Background(), Request{}); !errors.Is(err, ErrFailed) {
+		t.Errorf("got %v, wanted %v", err, ErrFailed)
+	}
+}
+
+func TestStart(t *testing.T) {
+	if _, err := Start(Params{Wallet: void.VoidWallet{}}); !errors.Is(err, rp.ErrUnsupported) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrUnsupported)
+	}
+}
@@ -0,0 +1,149 @@
+package receipts
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type Receipt struct {
+	Kind        string    `json:"kind"` // "invoice" or "payment"
+	CheckingID  string    `json:"checkingID"`
+	Msatoshi    int64     `json:"msatoshi"`
+	FeeMsatoshi int64     `json:"feeMsatoshi,omitempty"`
+	Preimage    string    `json:"preimage,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Fiat        *Fiat     `json:"fiat,omitempty"`
+	Merchant    Merchant  `json:"merchant"`
+	Time        time.Time `json:"time"`
+}
+
+type Fiat struct {
+	Currency string  `json:"currency"`
+	Amount   float64 `json:"amount"`
+}
+
+type Merchant struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+	Email   string `json:"email,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+func FromInvoice(status rp.InvoiceStatus, merchant Merchant) Receipt {
+	receipt := Receipt{
+		Kind:        "invoice",
+		CheckingID:  status.CheckingID,
+		Msatoshi:    status.MSatoshiReceived,
+		Preimage:    status.Preimage,
+		Description: status.Description,
+		Merchant:    merchant,
+		Time:        status.SettledAt,
+	}
+	if receipt.Time.IsZero() {
+		receipt.Time = time.Now()
+	}
+	return receipt
+}
+
+func FromPayment(status rp.PaymentStatus, msatoshi int64, merchant Merchant) Receipt {
+	return Receipt{
+		Kind:        "payment",
+		CheckingID:  status.CheckingID,
+		Msatoshi:    msatoshi,
+		FeeMsatoshi: status.FeePaid,
+		Preimage:    status.Preimage,
+		Merchant:    merchant,
+		Time:        time.Now(),
+	}
+}
+
+func (r Receipt) Satoshi() string {
+	if r.Msatoshi%1000 == 0 {
+		return fmt.Sprintf("%d", r.Msatoshi/1000)
+	}
+	return fmt.Sprintf("%.3f", float64(r.Msatoshi)/1000)
+}
+
+// Renderer turns a receipt into a document. A PDF renderer can be plugged in
+// by implementing this.
+type Renderer interface {
+	ContentType() string
+	Render(w io.Writer, receipt Receipt) error
+}
+
+type HTMLRenderer struct {
+	Template *template.Template
+}
+
+var DefaultTemplate = template.Must(template.New("receipt").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Receipt {{.CheckingID}}</title></head>
+<body>
+  <h1>{{.Merchant.Name}}</h1>
+  {{if .Merchant.Address}}<p>{{.Merchant.Address}}</p>{{end}}
+  {{if .Merchant.Email}}<p>{{.Merchant.Email}}</p>{{end}}
+  {{if .Merchant.URL}}<p><a href="{{.Merchant.URL}}">{{.Merchant.URL}}</a></p>{{end}}
+  <table>
+    <tr><th>Date</th><td>{{.Time.UTC.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+    {{if .Description}}<tr><th>Description</th><td>{{.Description}}</td></tr>{{end}}
+    <tr><th>Amount</th><td>{{.Satoshi}} sat</td></tr>
+    {{if .Fiat}}<tr><th>Value</th><td>{{printf "%.2f" .Fiat.Amount}} {{.Fiat.Currency}}</td></tr>{{end}}
+    {{if .FeeMsatoshi}}<tr><th>Fee</th><td>{{.FeeMsatoshi}} msat</td></tr>{{end}}
+    <tr><th>Payment hash</th><td><code>{{.CheckingID}}</code></td></tr>
+    {{if .Preimage}}<tr><th>Proof of payment</th><td><code>{{.Preimage}}</code></td></tr>{{end}}
+  </table>
+</body>
+</html>
+`))
+
+func (h HTMLRenderer) ContentType() string { return "text/html; charset=utf-8" }
+
+func (h HTMLRenderer) Render(w io.Writer, receipt Receipt) error {
+	tmpl := h.Template
+	if tmpl == nil {
+		tmpl = DefaultTemplate
+	}
+	return tmpl.Execute(w, receipt)
+}
+
+// Notify renders a receipt for every paid invoice on the wallet and hands it
+// to send, which can email it, post it to a webhook and so on. complete can
+// fill in what the wallet doesn't know, like the description or fiat value.
+func Notify(
+	wallet rp.Wallet,
+	merchant Merchant,
+	renderer Renderer,
+	complete func(*Receipt),
+	send func(receipt Receipt, contentType string, document []byte) error,
+) error {
+	invoices, err := wallet.PaidInvoicesStream()
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to invoices: %w", err)
+	}
+
+	go func() {
+		for status := range invoices {
+			receipt := FromInvoice(status, merchant)
+			if complete != nil {
+				complete(&receipt)
+			}
+
+			var document bytes.Buffer
+			if err := renderer.Render(&document, receipt); err != nil {
+				log.Printf("Failed to render receipt for %s: %v", receipt.CheckingID, err)
+				continue
+			}
+			if err := send(receipt, renderer.ContentType(), document.Bytes()); err != nil {
+				log.Printf("Failed to send receipt for %s: %v", receipt.CheckingID, err)
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package receipts
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+func TestFromInvoice(t *testing.T) {
+	settledAt := time.Unix(1600000000, 0)
+	receipt := FromInvoice(rp.InvoiceStatus{
+		CheckingID: "hash", Paid: true, MSatoshiReceived: 5500, Description: "coffee",
+		Preimage: "0102", SettledAt: settledAt,
+	}, Merchant{Name: "Cafe"})
+
+	if receipt.Preimage != "0102" || receipt.Description != "coffee" || !receipt.Time.Equal(settledAt) {
+		t.Errorf("got %+v, wanted the preimage, description and settlement time", receipt)
+	}
+	if got := receipt.Satoshi(); got != "5.500" {
+		t.Errorf("got %v, wanted %v", got, "5.500")
+	}
+}
+
+func TestHTMLRenderer(t *testing.T) {
+	var document bytes.Buffer
+	err := HTMLRenderer{}.Render(&document, Receipt{
+		CheckingID: "hash", Msatoshi: 5000, Preimage: "0102",
+		Description: "<script>", Merchant: Merchant{Name: "Cafe"},
+	})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	html := document.String()
+	for _, want := range []string{"Cafe", "5 sat", "<code>0102</code>", "&lt;script&gt;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("got %s, wanted it to contain %s", html, want)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	sent := make(chan Receipt, 1)
+	err := Notify(tw, Merchant{Name: "Cafe"}, HTMLRenderer{},
+		func(r *Receipt) { r.Fiat = &Fiat{Currency: "USD", Amount: 1.5} },
+		func(r Receipt, contentType string, document []byte) error {
+			sent <- r
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	invoice, _ := tw.CreateInvoice(rp.InvoiceParams{Msatoshi: 5000, Description: "coffee"})
+	tw.SettleInvoice(invoice.CheckingID, 5000)
+
+	receipt := <-sent
+	if receipt.Preimage != invoice.Preimage || receipt.Fiat == nil || receipt.Msatoshi != 5000 {
+		t.Errorf("got %+v, wanted a completed receipt with the preimage %s", receipt, invoice.Preimage)
+	}
+}
@@ -0,0 +1,74 @@
+package relampago
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// RedactionMode is what happens to invoice descriptions, which often carry
+// personal data, before they go to logs, audit trails or metrics.
+type RedactionMode int
+
+const (
+	RedactNone     RedactionMode = iota // kept as they are
+	RedactHash                          // replaced by a short hash, so equal ones can still be matched
+	RedactTruncate                      // cut to TruncateAt characters
+	RedactDrop                          // removed
+)
+
+type RedactionPolicy struct {
+	Mode RedactionMode
+
+	// TruncateAt is how many characters RedactTruncate keeps, 16 by default.
+	TruncateAt int
+
+	// Func, when set, is used instead of Mode.
+	Func func(description string) string
+}
+
+// Redaction is the policy applied by RedactDescription and the other Redact*
+// functions, which anything logging or exporting invoice data should use.
+// Set it once at startup.
+var Redaction RedactionPolicy
+
+// Description applies the policy to a description.
+func (p RedactionPolicy) Description(description string) string {
+	if p.Func != nil {
+		return p.Func(description)
+	}
+	if description == "" {
+		return ""
+	}
+
+	switch p.Mode {
+	case RedactHash:
+		hash := sha256.Sum256([]byte(description))
+		return "sha256:" + hex.EncodeToString(hash[:6])
+	case RedactTruncate:
+		max := p.TruncateAt
+		if max == 0 {
+			max = 16
+		}
+		if runes := []rune(description); len(runes) > max {
+			return string(runes[:max]) + "…"
+		}
+		return description
+	case RedactDrop:
+		return ""
+	}
+	return description
+}
+
+func RedactDescription(description string) string {
+	return Redaction.Description(description)
+}
+
+func RedactInvoiceParams(params InvoiceParams) InvoiceParams {
+	params.Description = Redaction.Description(params.Description)
+	return params
+}
+
+func RedactInvoiceStatus(status InvoiceStatus) InvoiceStatus {
+	status.Description = Redaction.Description(status.Description)
+	return status
+}
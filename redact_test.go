@@ -0,0 +1,41 @@
+package relampago_test
+
+import (
+	"strings"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+)
+
+func TestRedaction(t *testing.T) {
+	description := "Coffee for Alice Example, 42 Main St"
+
+	for _, c := range []struct {
+		policy   rp.RedactionPolicy
+		expected string
+	}{
+		{rp.RedactionPolicy{}, description},
+		{rp.RedactionPolicy{Mode: rp.RedactDrop}, ""},
+		{rp.RedactionPolicy{Mode: rp.RedactTruncate, TruncateAt: 6}, "Coffee…"},
+		{rp.RedactionPolicy{Mode: rp.RedactTruncate}, "Coffee for Alice…"},
+		{rp.RedactionPolicy{Func: strings.ToUpper}, strings.ToUpper(description)},
+	} {
+		if got := c.policy.Description(description); got != c.expected {
+			t.Errorf("%+v: got %q, wanted %q", c.policy, got, c.expected)
+		}
+	}
+
+	hashing := rp.RedactionPolicy{Mode: rp.RedactHash}
+	hashed := hashing.Description(description)
+	if !strings.HasPrefix(hashed, "sha256:") || strings.Contains(hashed, "Alice") ||
+		hashed != hashing.Description(description) || hashed == hashing.Description("other") {
+		t.Errorf("got %q, wanted a stable hash", hashed)
+	}
+
+	rp.Redaction = rp.RedactionPolicy{Mode: rp.RedactDrop}
+	defer func() { rp.Redaction = rp.RedactionPolicy{} }()
+	status := rp.RedactInvoiceStatus(rp.InvoiceStatus{CheckingID: "abc", Description: description})
+	if status.Description != "" || status.CheckingID != "abc" {
+		t.Errorf("got %+v, wanted only the description dropped", status)
+	}
+}
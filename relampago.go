@@ -1,29 +1,180 @@
 package relampago
 
-import "time"
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"time"
+)
 
 type Wallet interface {
 	Kind() string
+	Capabilities() Capabilities
 	GetInfo() (WalletInfo, error)
+	Health(context.Context) (HealthStatus, error)
 
 	CreateInvoice(InvoiceParams) (InvoiceData, error)
 	GetInvoiceStatus(string) (InvoiceStatus, error)
 	PaidInvoicesStream() (<-chan InvoiceStatus, error)
+	CancelInvoice(string) error
 
 	MakePayment(PaymentParams) (PaymentData, error)
 	GetPaymentStatus(string) (PaymentStatus, error)
 	PaymentsStream() (<-chan PaymentStatus, error)
 }
 
+// NodeInfoProvider is implemented by backends that can tell about the node
+// behind them, like the pubkey needed to build route hints.
+type NodeInfoProvider interface {
+	GetNodeInfo() (NodeInfo, error)
+}
+
+type NodeInfo struct {
+	Pubkey      string `json:"pubkey"`
+	Alias       string `json:"alias"`
+	Network     string `json:"network"` // mainnet, testnet, signet or regtest
+	BlockHeight int64  `json:"blockHeight"`
+	Version     string `json:"version"`
+}
+
+// ChainWatcher is implemented by backends that follow the chain tip, so
+// things like hold invoice CLTV deadlines can be checked against the block
+// height instead of the clock.
+type ChainWatcher interface {
+	BlockHeight() (int64, error)
+
+	// BlockStream emits every new block until ctx is done.
+	BlockStream(ctx context.Context) (<-chan BlockEpoch, error)
+}
+
+type BlockEpoch struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// HealthStatus tells if a backend can be used, for readiness probes and such.
+// An error is returned along with it when the node can't be reached.
+type HealthStatus struct {
+	Connected     bool `json:"connected"`
+	SyncedToChain bool `json:"syncedToChain"`
+	SyncedToGraph bool `json:"syncedToGraph"`
+
+	// StreamsAlive is false when the connection to the backend event streams
+	// is known to be broken, so paid invoices would be missed.
+	StreamsAlive bool `json:"streamsAlive"`
+
+	Detail string `json:"detail,omitempty"`
+}
+
+// Ready is true when the backend can take invoices and payments.
+func (h HealthStatus) Ready() bool {
+	return h.Connected && h.SyncedToChain && h.StreamsAlive
+}
+
+// Capabilities describes the operational limits of a backend, zero values mean
+// there is no limit.
+type Capabilities struct {
+	MaxInvoiceMsatoshi   int64         `json:"maxInvoiceMsatoshi"`
+	MaxPaymentMsatoshi   int64         `json:"maxPaymentMsatoshi"`
+	MinExpiry            time.Duration `json:"minExpiry"`
+	MaxDescriptionLength int           `json:"maxDescriptionLength"`
+	CustomRecords        bool          `json:"customRecords"`
+	RouteHints           bool          `json:"routeHints"`
+	CustomRouteHints     bool          `json:"customRouteHints"`
+	HoldInvoices         bool          `json:"holdInvoices"`
+	CancelInvoices       bool          `json:"cancelInvoices"`
+	FallbackAddresses    bool          `json:"fallbackAddresses"`
+	CltvExpiry           bool          `json:"cltvExpiry"`
+	PeerRestrictions     bool          `json:"peerRestrictions"`
+	Labels               bool          `json:"labels"`
+
+	// Wumbo is true when the node can send and receive payments above
+	// MaxNonWumboMsatoshi.
+	Wumbo bool `json:"wumbo"`
+}
+
 type WalletInfo struct {
 	Balance int64 `json:"balance"`
 }
 
+// When DescriptionHash is given the invoice only commits to it, Description is
+// then optional and, if given, must be what was hashed.
 type InvoiceParams struct {
+	// Msatoshi zero makes an invoice for any amount, the payer chooses how
+	// much to pay and GetInvoiceStatus tells how much was received.
 	Msatoshi        int64          `json:"msatoshi"`
 	Description     string         `json:"description"`
 	DescriptionHash []byte         `json:"descriptionHash"`
 	Expiry          *time.Duration `json:"expiry"`
+
+	// Preimage is optional, a random one is generated when it's not given.
+	Preimage []byte `json:"preimage,omitempty"`
+
+	// PaymentHash without Preimage creates a hold invoice, for backends that
+	// are HoldInvoiceWallets: payments to it are held until the preimage is
+	// given to SettleHoldInvoice.
+	PaymentHash []byte `json:"paymentHash,omitempty"`
+
+	// Private includes route hints for unannounced channels, so nodes that
+	// only have those can still be paid.
+	Private bool `json:"private,omitempty"`
+
+	// RouteHints are added to the invoice as given, for backends with
+	// Capabilities.CustomRouteHints. They are how payers reach channels the
+	// node doesn't have yet, like just-in-time channels from an LSP.
+	RouteHints [][]HopHint `json:"routeHints,omitempty"`
+
+	// CltvExpiry is the min_final_cltv_expiry of the invoice, the blocks the
+	// last htlc must still have to run when it arrives, for swaps and other
+	// flows that need time to act on it. The backend default is used when
+	// zero, for backends with Capabilities.CltvExpiry.
+	CltvExpiry uint32 `json:"cltvExpiry,omitempty"`
+
+	// FallbackAddress is an on-chain address included in the invoice for
+	// payers that can't pay over lightning.
+	FallbackAddress string `json:"fallbackAddress,omitempty"`
+
+	// Label is returned in InvoiceStatus, so invoices can be matched to what
+	// they are for without a table of checking ids. It is kept by backends
+	// with Capabilities.Labels and by sidecar for the others.
+	Label string `json:"label,omitempty"`
+}
+
+// DescriptionHash is the hash committed to in invoices created with a
+// description hash, like the ones for LNURL-pay, where the description is the
+// metadata string.
+func DescriptionHash(description string) []byte {
+	hash := sha256.Sum256([]byte(description))
+	return hash[:]
+}
+
+func VerifyDescriptionHash(description string, hash []byte) bool {
+	return subtle.ConstantTimeCompare(DescriptionHash(description), hash) == 1
+}
+
+// InvoicePreimage returns the preimage requested in params or a new random one.
+func InvoicePreimage(params InvoiceParams) ([]byte, error) {
+	if params.Preimage != nil {
+		if len(params.Preimage) != 32 {
+			return nil, fmt.Errorf("preimage must be 32 bytes, got %d", len(params.Preimage))
+		}
+		return params.Preimage, nil
+	}
+
+	preimage := make([]byte, 32)
+	if _, err := rand.Read(preimage); err != nil {
+		return nil, fmt.Errorf("failed to make random preimage: %w", err)
+	}
+	return preimage, nil
+}
+
+// HoldInvoiceWallet is implemented by backends that can create invoices for
+// which only the payment hash is known, see InvoiceParams.PaymentHash.
+type HoldInvoiceWallet interface {
+	SettleHoldInvoice(preimage []byte) error
+	CancelHoldInvoice(paymentHash []byte) error
 }
 
 type InvoiceData struct {
@@ -37,13 +188,123 @@ type InvoiceStatus struct {
 	Exists           bool   `json:"exists"`
 	Paid             bool   `json:"paid"`
 	MSatoshiReceived int64  `json:"msatoshiReceived"`
+	Description      string `json:"description,omitempty"`
+
+	// Msatoshi is the amount requested, zero for invoices without one or when
+	// the backend doesn't report it.
+	Msatoshi int64 `json:"msatoshi,omitempty"`
+
+	// Settlements is how many times the invoice was paid, for backends that
+	// report it. Only AMP invoices can be paid more than once, then every
+	// settlement is a stream event with the amount of that settlement in
+	// MSatoshiReceived, while GetInvoiceStatus has the total.
+	Settlements int `json:"settlements,omitempty"`
+
+	// SettledAt is when the node settled the invoice, when known.
+	SettledAt time.Time `json:"settledAt,omitempty"`
+
+	// Preimage is the hex preimage of a paid invoice, the proof of payment, on
+	// backends that report it.
+	Preimage string `json:"preimage,omitempty"`
+
+	// Canceled is true when the invoice was canceled and can't be paid anymore.
+	Canceled bool `json:"canceled,omitempty"`
+
+	// Expired is true when the invoice expired unpaid, as far as the backend
+	// can tell. It is canceled too on backends that cancel expired invoices.
+	Expired bool `json:"expired,omitempty"`
+
+	// Held is true when a hold invoice was paid and is waiting to be settled
+	// or canceled.
+	Held bool `json:"held,omitempty"`
+
+	// SettleIndex is only set by backends that support resuming streams.
+	SettleIndex uint64 `json:"settleIndex,omitempty"`
+
+	// Label is the one given in InvoiceParams.
+	Label string `json:"label,omitempty"`
+}
+
+// Overpaid is how much more than requested was received, zero for invoices
+// without an amount.
+func (s InvoiceStatus) Overpaid() int64 {
+	if s.Msatoshi == 0 || s.MSatoshiReceived <= s.Msatoshi {
+		return 0
+	}
+	return s.MSatoshiReceived - s.Msatoshi
+}
+
+// InvoiceHTLCLister is implemented by backends that can list the htlcs that
+// paid an invoice, to see how a payment was split or what each AMP
+// settlement was made of.
+type InvoiceHTLCLister interface {
+	InvoiceHTLCs(checkingID string) ([]InvoiceHTLC, error)
+}
+
+type InvoiceHTLC struct {
+	Msatoshi  int64     `json:"msatoshi"`
+	SettledAt time.Time `json:"settledAt,omitempty"`
+
+	// SetID is the AMP settlement the htlc was part of, empty for other
+	// invoices.
+	SetID string `json:"setId,omitempty"`
+}
+
+// ResumableInvoiceStream is implemented by wallets that can replay every
+// settlement that happened after a given settle index, so consumers can
+// checkpoint the last SettleIndex they processed and resume from it.
+type ResumableInvoiceStream interface {
+	PaidInvoicesStreamSince(settleIndex uint64) (<-chan InvoiceStatus, error)
 }
 
 type PaymentParams struct {
 	Invoice      string `json:"invoice"`
 	CustomAmount int64  `json:"customAmount"`
+
+	// MaxParts and MaxShardMsatoshi tune multi-part payments and AMP sends an
+	// atomic multi-path payment, which is required to pay reusable invoices.
+	// They are ignored by backends that don't support them.
+	MaxParts         uint32 `json:"maxParts,omitempty"`
+	MaxShardMsatoshi int64  `json:"maxShardMsatoshi,omitempty"`
+	AMP              bool   `json:"amp,omitempty"`
+
+	// TrampolineNodeID makes the payment be relayed by that trampoline node,
+	// which must be a peer, so no knowledge of the graph is needed. Only eclair
+	// based backends support this.
+	TrampolineNodeID      string `json:"trampolineNodeId,omitempty"`
+	TrampolineFeeMsatoshi int64  `json:"trampolineFeeMsatoshi,omitempty"`
+	TrampolineCltvExpiry  int64  `json:"trampolineCltvExpiry,omitempty"`
+
+	// RestrictToPeers limits the payment to leave through channels with these
+	// peers and, when the invoice has route hints through one of them, to
+	// arrive through it. Backends that can't enforce it refuse the payment.
+	RestrictToPeers []string `json:"restrictToPeers,omitempty"`
+
+	// OutgoingChannelIDs limits the payment to leave through these channels,
+	// in lnd's uint64 format, and LastHopPubkey to arrive through that node,
+	// for rebalancing and liquidity management. Backends that can't enforce
+	// them refuse the payment, like with RestrictToPeers.
+	OutgoingChannelIDs []uint64 `json:"outgoingChannelIds,omitempty"`
+	LastHopPubkey      string   `json:"lastHopPubkey,omitempty"`
+
+	// AllowSelfPayment pays invoices of the node itself through the network,
+	// which is how circular rebalances move liquidity between channels.
+	// Backends that can't return ErrSelfPayment.
+	AllowSelfPayment bool `json:"allowSelfPayment,omitempty"`
+
+	// MaxFeeMsatoshi caps the routing fee instead of the backend default, for
+	// backends that support it.
+	MaxFeeMsatoshi int64 `json:"maxFeeMsatoshi,omitempty"`
+
+	// AllowDuplicate skips the check for a payment to the same hash that is
+	// pending or complete, which otherwise makes MakePayment return that
+	// payment's CheckingID without sending again.
+	AllowDuplicate bool `json:"allowDuplicate,omitempty"`
 }
 
+// CheckingID is the hex payment hash on every backend, so checking ids stored
+// by callers keep working when the backend is swapped. Backend-specific ids,
+// like eclair payment ids, stay internal.
 type PaymentData struct {
 	CheckingID string `json:"checkingID"`
 }
@@ -56,6 +317,26 @@ const (
 	Pending    Status = "pending"
 	Failed     Status = "failed"
 	Complete   Status = "complete"
+
+	// AwaitingApproval is for payments held until someone approves them, see
+	// the policy package.
+	AwaitingApproval Status = "awaiting-approval"
+)
+
+// Final is true for statuses that won't change anymore.
+func (s Status) Final() bool {
+	return s == Complete || s == Failed
+}
+
+// FailureReason tells why a payment failed, for backends that report it.
+type FailureReason string
+
+const (
+	FailureTimeout                 FailureReason = "timeout"
+	FailureNoRoute                 FailureReason = "no_route"
+	FailureInsufficientBalance     FailureReason = "insufficient_balance"
+	FailureIncorrectPaymentDetails FailureReason = "incorrect_payment_details"
+	FailureError                   FailureReason = "error" // an unexpected error
 )
 
 type PaymentStatus struct {
@@ -63,4 +344,303 @@ type PaymentStatus struct {
 	Status     Status `json:"status"`
 	FeePaid    int64  `json:"feePaid"`
 	Preimage   string `json:"preimage"`
+
+	// FailureReason is set for failed and never tried payments when known.
+	FailureReason FailureReason `json:"failureReason,omitempty"`
+
+	// ResolvedAt is when the node saw the payment complete or fail, when known.
+	ResolvedAt time.Time `json:"resolvedAt,omitempty"`
+
+	// Destination, Msatoshi (without fees) and Description come from the
+	// invoice paid, so payment records are complete for accounting.
+	Destination string `json:"destination,omitempty"`
+	Msatoshi    int64  `json:"msatoshi,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// InFlightParts and InFlightMsatoshi describe the htlcs still pending
+	// while the payment is, for backends that report them.
+	InFlightParts    int   `json:"inFlightParts,omitempty"`
+	InFlightMsatoshi int64 `json:"inFlightMsatoshi,omitempty"`
+}
+
+// FeeEstimator is implemented by wallets that can quote the routing fee of a
+// payment before it is attempted.
+type FeeEstimator interface {
+	EstimatePaymentFee(FeeEstimateParams) (FeeEstimate, error)
+}
+
+type FeeEstimateParams struct {
+	Invoice     string `json:"invoice"`
+	Destination string `json:"destination"`
+	Msatoshi    int64  `json:"msatoshi"`
+}
+
+type FeeEstimate struct {
+	FeeMsatoshi   int64 `json:"feeMsatoshi"`
+	TimeLockDelay int64 `json:"timeLockDelay"`
+}
+
+// OnchainWallet is implemented by wallets that also control on-chain funds.
+type OnchainWallet interface {
+	NewAddress() (string, error)
+	SendOnchain(address string, satoshi int64, satPerVbyte int64) (string, error)
+	GetOnchainBalance() (OnchainBalance, error)
+	OnchainTxStream() (<-chan OnchainTransaction, error)
+}
+
+type OnchainBalance struct {
+	Confirmed   int64 `json:"confirmed"`
+	Unconfirmed int64 `json:"unconfirmed"`
+}
+
+type OnchainTransaction struct {
+	TxID          string `json:"txid"`
+	Amount        int64  `json:"amount"`
+	Fee           int64  `json:"fee"`
+	Confirmations int32  `json:"confirmations"`
+	BlockHeight   int32  `json:"blockHeight"`
+
+	// Addresses are the addresses paid by the transaction outputs.
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// PaymentScorer advises whether a payment should be attempted now, delayed or
+// split into more parts, based on mission control data or external knowledge.
+type PaymentScorer interface {
+	ScorePayment(PaymentParams) (PaymentAdvice, error)
+}
+
+type PaymentAction string
+
+const (
+	Attempt PaymentAction = "attempt"
+	Delay   PaymentAction = "delay"
+	Split   PaymentAction = "split"
+)
+
+type PaymentAdvice struct {
+	Action      PaymentAction `json:"action"`
+	Probability float64       `json:"probability"`
+
+	// RetryAfter is set when delaying and MaxParts when splitting.
+	RetryAfter time.Duration `json:"retryAfter,omitempty"`
+	MaxParts   uint32        `json:"maxParts,omitempty"`
+}
+
+// MissionControl is implemented by backends that can share what they learned
+// about the network while paying, so a fleet of senders can pathfind with the
+// knowledge of all of them.
+type MissionControl interface {
+	ExportMissionControl() ([]PairHistory, error)
+	ImportMissionControl([]PairHistory) error
+}
+
+// MessageSigner is implemented by backends that can sign messages with the
+// node key, for logins that prove the identity of a node. Signatures are the
+// zbase32 ones of lnd and core lightning, which sign the message prefixed by
+// "Lightning Signed Message:".
+type MessageSigner interface {
+	SignMessage(message string) (string, error)
+	VerifyMessage(message, signature string) (MessageVerification, error)
+}
+
+// MessageVerification tells whether a signature is valid and which node made
+// it. Valid is false for signatures of nodes the backend doesn't know about.
+type MessageVerification struct {
+	Valid  bool   `json:"valid"`
+	Pubkey string `json:"pubkey"`
+}
+
+// WatchtowerManager is implemented by backends with a watchtower client, so
+// node management tools can configure the towers that watch their channels.
+type WatchtowerManager interface {
+	// AddTower adds a tower or a new address to a known one, address is
+	// host:port.
+	AddTower(pubkey, address string) error
+	ListTowers() ([]Tower, error)
+
+	// RemoveTower removes one address of a tower, or the whole tower when
+	// address is empty.
+	RemoveTower(pubkey, address string) error
+}
+
+type Tower struct {
+	Pubkey    string   `json:"pubkey"`
+	Addresses []string `json:"addresses"`
+
+	// Active is true for towers that new sessions can be made with.
+	Active   bool `json:"active"`
+	Sessions int  `json:"sessions"`
+}
+
+// HtlcInterceptor is implemented by backends that can hold the htlcs forwarded
+// through the node and decide what to do with each one, which is what LSPs
+// and just-in-time channels are built on.
+type HtlcInterceptor interface {
+	// InterceptHtlcs streams the forwarded htlcs until ctx is done, each one
+	// is held until it is resolved. Only one interceptor can run at a time.
+	InterceptHtlcs(ctx context.Context) (<-chan InterceptedHtlc, error)
+}
+
+type InterceptedHtlc struct {
+	IncomingChannel string `json:"incomingChannel"`
+	IncomingHtlcID  uint64 `json:"incomingHtlcId"`
+
+	// OutgoingChannel is the channel the sender asked for, which may not
+	// exist yet, like the alias of a just-in-time channel.
+	OutgoingChannel string `json:"outgoingChannel"`
+
+	PaymentHash      string `json:"paymentHash"`
+	IncomingMsatoshi int64  `json:"incomingMsatoshi"`
+	OutgoingMsatoshi int64  `json:"outgoingMsatoshi"`
+	IncomingExpiry   uint32 `json:"incomingExpiry"`
+	OutgoingExpiry   uint32 `json:"outgoingExpiry"`
+
+	// Resolve tells the node what to do with the htlc, it must be called once.
+	Resolve func(HtlcDecision) error `json:"-"`
+}
+
+type HtlcAction string
+
+const (
+	HtlcAccept HtlcAction = "accept" // forward it as the sender asked
+	HtlcReject HtlcAction = "reject" // fail it back to the sender
+	HtlcSettle HtlcAction = "settle" // settle it with Preimage
+)
+
+type HtlcDecision struct {
+	Action   HtlcAction `json:"action"`
+	Preimage string     `json:"preimage,omitempty"` // hex
+}
+
+// OutboundCapacity is implemented by backends that can tell how much they can
+// send right now, so apps can disable a withdrawal before MakePayment fails.
+type OutboundCapacity interface {
+	// SpendableMsatoshi is the local balance of the active channels minus
+	// their reserves and pending htlcs.
+	SpendableMsatoshi() (int64, error)
+
+	// CanSend is true when msatoshi fits in SpendableMsatoshi. Routing fees
+	// aren't counted, so payments that barely fit may still fail.
+	CanSend(msatoshi int64) (bool, error)
+}
+
+// ChannelLister is implemented by backends that can list their channels with
+// the balance on each side, for liquidity tools like rebalance.
+type ChannelLister interface {
+	ListChannels() ([]Channel, error)
+}
+
+// Channel is a channel of the node, ChannelInfo.ID is in lnd's uint64 format
+// where backends have it. Balances don't have the reserves taken out.
+type Channel struct {
+	ChannelInfo
+	Active         bool  `json:"active"`
+	LocalMsatoshi  int64 `json:"localMsatoshi"`
+	RemoteMsatoshi int64 `json:"remoteMsatoshi"`
+}
+
+// GraphReader is implemented by backends that can look up the nodes and
+// channels of the network graph, so apps can show aliases and capacities
+// without a client of their own. Unknown nodes and channels are ErrNotFound.
+type GraphReader interface {
+	GetNode(pubkey string) (GraphNode, error)
+
+	// GetChannel takes a short channel id like 700000x1x0.
+	GetChannel(shortChannelID string) (GraphChannel, error)
+
+	// ListGraphNodes lists every node in the graph, which can be big.
+	ListGraphNodes() ([]GraphNode, error)
+}
+
+type GraphNode struct {
+	Pubkey     string    `json:"pubkey"`
+	Alias      string    `json:"alias"`
+	Color      string    `json:"color"`
+	Addresses  []string  `json:"addresses"` // host:port
+	LastUpdate time.Time `json:"lastUpdate"`
+
+	// Channels and CapacitySat are only known by some backends.
+	Channels    int   `json:"channels,omitempty"`
+	CapacitySat int64 `json:"capacitySat,omitempty"`
+}
+
+// GraphChannel is a public channel, Node1 is the node with the lower pubkey.
+// A policy is nil while its node hasn't announced one.
+type GraphChannel struct {
+	ShortChannelID string         `json:"shortChannelId"`
+	Node1          string         `json:"node1"`
+	Node2          string         `json:"node2"`
+	CapacitySat    int64          `json:"capacitySat"`
+	Node1Policy    *RoutingPolicy `json:"node1Policy"`
+	Node2Policy    *RoutingPolicy `json:"node2Policy"`
+}
+
+// RoutingPolicy is what a node asks to forward payments through a channel.
+type RoutingPolicy struct {
+	FeeBaseMsatoshi           int64     `json:"feeBaseMsatoshi"`
+	FeeProportionalMillionths int64     `json:"feeProportionalMillionths"`
+	TimeLockDelta             uint32    `json:"timeLockDelta"`
+	MinHtlcMsatoshi           int64     `json:"minHtlcMsatoshi"`
+	MaxHtlcMsatoshi           int64     `json:"maxHtlcMsatoshi"`
+	Disabled                  bool      `json:"disabled"`
+	LastUpdate                time.Time `json:"lastUpdate"`
+}
+
+// PolicyManager is implemented by backends that can set the fees the node
+// charges for forwarding through its channels, for fee automation tools.
+type PolicyManager interface {
+	// UpdateChannelPolicy sets the policy of the channel funded at chanPoint,
+	// as "txid:index", or of every channel when it is empty. A timeLockDelta
+	// of zero keeps the current one, the only value lightningd takes as it
+	// has a single one for all channels. Unknown channels are ErrNotFound.
+	UpdateChannelPolicy(chanPoint string, baseFeeMsatoshi, feeRatePPM int64, timeLockDelta uint32) error
+
+	// GetChannelPolicies lists the policies of the open channels of the node,
+	// the side of them it sets.
+	GetChannelPolicies() ([]ChannelPolicy, error)
+}
+
+type ChannelPolicy struct {
+	ChannelInfo
+	ChannelPoint string `json:"channelPoint"`
+	RoutingPolicy
+}
+
+// HopHint is one hop of a route hint, ending at the node of the invoice.
+type HopHint struct {
+	NodeID string `json:"nodeId"`
+
+	// ShortChannelID is like 700000x1x0.
+	ShortChannelID            string `json:"shortChannelId"`
+	FeeBaseMsatoshi           int64  `json:"feeBaseMsatoshi"`
+	FeeProportionalMillionths int64  `json:"feeProportionalMillionths"`
+	CltvExpiryDelta           uint32 `json:"cltvExpiryDelta"`
+}
+
+// CustomMessenger is implemented by backends that can exchange custom
+// messages (BOLT1 types above 32768) with their peers, which protocols like
+// the LSP specs are built on.
+type CustomMessenger interface {
+	SendCustomMessage(peer string, msgType uint32, data []byte) error
+
+	// CustomMessages streams the custom messages received until ctx is done.
+	CustomMessages(ctx context.Context) (<-chan CustomMessage, error)
+}
+
+type CustomMessage struct {
+	Peer string `json:"peer"`
+	Type uint32 `json:"type"`
+	Data []byte `json:"data"`
+}
+
+// PairHistory is the last result of sending from one node to another.
+type PairHistory struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	FailTime        time.Time `json:"failTime,omitempty"`
+	FailMsatoshi    int64     `json:"failMsatoshi,omitempty"`
+	SuccessTime     time.Time `json:"successTime,omitempty"`
+	SuccessMsatoshi int64     `json:"successMsatoshi,omitempty"`
 }
@@ -0,0 +1,88 @@
+// Command relampagod serves a backend over the JSON-RPC API of the server
+// package. It's configured with flags or the matching environment variables:
+//
+//	RELAMPAGO_BACKEND=lnd://host:10009?cert=...&macaroon=... \
+//	RELAMPAGO_ADMIN_KEYS=secret1 RELAMPAGO_INVOICE_KEYS=secret2,secret3 \
+//	relampagod -listen 127.0.0.1:5000
+//
+// RELAMPAGO_GRANT_KEY, a hex ed25519 public key, lets edge services create
+// invoices with grants signed by the matching private key instead of an api
+// key, see the grant package.
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/lnbits/relampago/config"
+	"github.com/lnbits/relampago/server"
+)
+
+func main() {
+	backend := flag.String("backend", os.Getenv("RELAMPAGO_BACKEND"),
+		"backend uri, see config.FromURI")
+	listen := flag.String("listen", envOr("RELAMPAGO_LISTEN", "127.0.0.1:5000"),
+		"address to listen on")
+	adminKeys := flag.String("admin-keys", os.Getenv("RELAMPAGO_ADMIN_KEYS"),
+		"comma-separated api keys that can make payments")
+	invoiceKeys := flag.String("invoice-keys", os.Getenv("RELAMPAGO_INVOICE_KEYS"),
+		"comma-separated api keys that can only create and check invoices and payments")
+	grantKey := flag.String("grant-key", os.Getenv("RELAMPAGO_GRANT_KEY"),
+		"hex ed25519 public key that signs invoice grants")
+	stringAmounts := flag.Bool("string-amounts", os.Getenv("RELAMPAGO_STRING_AMOUNTS") == "true",
+		"encode msat amounts as strings")
+	flag.Parse()
+
+	if *backend == "" {
+		log.Fatal("a backend uri is required")
+	}
+	var grantPub ed25519.PublicKey
+	if *grantKey != "" {
+		key, err := hex.DecodeString(*grantKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			log.Fatalf("Invalid grant key '%s'", *grantKey)
+		}
+		grantPub = key
+	}
+
+	wallet, err := config.FromURI(*backend)
+	if err != nil {
+		log.Fatalf("Failed to start backend: %v", err)
+	}
+
+	s, err := server.NewServer(server.Params{
+		Wallet:        wallet,
+		AdminKeys:     splitKeys(*adminKeys),
+		InvoiceKeys:   splitKeys(*invoiceKeys),
+		GrantKey:      grantPub,
+		StringAmounts: *stringAmounts,
+	})
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+
+	log.Printf("Serving %s backend on %s", wallet.Kind(), *listen)
+	log.Fatal(http.ListenAndServe(*listen, s))
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func splitKeys(keys string) []string {
+	var split []string
+	for _, key := range strings.Split(keys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			split = append(split, key)
+		}
+	}
+	return split
+}
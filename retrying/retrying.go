@@ -0,0 +1,154 @@
+package retrying
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type Policy struct {
+	// MaxAttempts counts the first call, defaults to 3.
+	MaxAttempts int
+
+	// InitialBackoff is the base wait before the first retry, doubled on each
+	// one up to MaxBackoff. The actual waits are random up to that, so
+	// callers that failed together don't retry together. Defaults to 100ms
+	// and 2 seconds.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// MaxElapsed bounds the time spent on a call, retries included, so no
+	// retry is made when its wait would go past it. Zero means no limit.
+	MaxElapsed time.Duration
+
+	// Retryable tells which errors are worth retrying, defaults to
+	// IsTransient.
+	Retryable func(error) bool
+}
+
+// RetryingWallet retries the calls that only read, GetInfo, GetInvoiceStatus
+// and GetPaymentStatus, when they fail with transient errors. Calls that
+// change something are never retried, as the first attempt may have gone
+// through.
+type RetryingWallet struct {
+	rp.Wallet
+	policy Policy
+}
+
+func Wrap(wallet rp.Wallet, policy Policy) *RetryingWallet {
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.InitialBackoff == 0 {
+		policy.InitialBackoff = 100 * time.Millisecond
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = 2 * time.Second
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = IsTransient
+	}
+	return &RetryingWallet{Wallet: wallet, policy: policy}
+}
+
+// Compile time check to ensure that RetryingWallet fully implements rp.Wallet
+var _ rp.Wallet = (*RetryingWallet)(nil)
+
+func (r *RetryingWallet) GetInfo() (info rp.WalletInfo, err error) {
+	err = r.retry(func() error {
+		info, err = r.Wallet.GetInfo()
+		return err
+	})
+	return info, err
+}
+
+func (r *RetryingWallet) GetInvoiceStatus(checkingID string) (status rp.InvoiceStatus, err error) {
+	err = r.retry(func() error {
+		status, err = r.Wallet.GetInvoiceStatus(checkingID)
+		return err
+	})
+	return status, err
+}
+
+func (r *RetryingWallet) GetPaymentStatus(checkingID string) (status rp.PaymentStatus, err error) {
+	err = r.retry(func() error {
+		status, err = r.Wallet.GetPaymentStatus(checkingID)
+		return err
+	})
+	return status, err
+}
+
+func (r *RetryingWallet) retry(call func() error) error {
+	ctx := context.Background()
+	if r.policy.MaxElapsed > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.policy.MaxElapsed)
+		defer cancel()
+	}
+	return Do(ctx, r.policy, call)
+}
+
+// Do calls call until it succeeds, fails with an error that isn't retryable,
+// runs out of attempts or would have to wait past the deadline of ctx. It
+// returns the last error.
+func Do(ctx context.Context, policy Policy, call func() error) error {
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= policy.MaxAttempts || !policy.Retryable(err) {
+			return err
+		}
+
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// IsTransient tells if err looks like the backend was briefly unreachable or
+// overloaded: timeouts, dropped connections and the gRPC codes Unavailable,
+// DeadlineExceeded, ResourceExhausted and Aborted.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := err.Error()
+	for _, transient := range []string{
+		// grpc status errors, matched by their text as the core doesn't
+		// depend on grpc
+		"code = Unavailable",
+		"code = DeadlineExceeded",
+		"code = ResourceExhausted",
+		"code = Aborted",
+		"connection refused",
+		"connection reset",
+		"broken pipe",
+		"EOF",
+	} {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
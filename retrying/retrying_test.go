@@ -0,0 +1,69 @@
+package retrying
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+type flakyWallet struct {
+	void.VoidWallet
+	errs  []error
+	calls int
+}
+
+func (w *flakyWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	w.calls++
+	if len(w.errs) > 0 {
+		err := w.errs[0]
+		w.errs = w.errs[1:]
+		return rp.InvoiceStatus{}, err
+	}
+	return rp.InvoiceStatus{CheckingID: checkingID, Exists: true}, nil
+}
+
+func TestRetry(t *testing.T) {
+	unavailable := errors.New("rpc error: code = Unavailable desc = connection refused")
+	wallet := &flakyWallet{errs: []error{unavailable, unavailable}}
+	r := Wrap(wallet, Policy{InitialBackoff: time.Millisecond})
+
+	got, err := r.GetInvoiceStatus("ff")
+	if err != nil || !got.Exists {
+		t.Errorf("got %v, %v, wanted the invoice after retrying", got, err)
+	}
+	if wallet.calls != 3 {
+		t.Errorf("got %d calls, wanted %d", wallet.calls, 3)
+	}
+
+	wallet = &flakyWallet{errs: []error{unavailable, unavailable, unavailable}}
+	r = Wrap(wallet, Policy{InitialBackoff: time.Millisecond})
+	if _, err := r.GetInvoiceStatus("ff"); err != unavailable {
+		t.Errorf("got %v, wanted %v after running out of attempts", err, unavailable)
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	wallet := &flakyWallet{errs: []error{rp.ErrNotFound}}
+	r := Wrap(wallet, Policy{InitialBackoff: time.Millisecond})
+	if _, err := r.GetInvoiceStatus("ff"); err != rp.ErrNotFound || wallet.calls != 1 {
+		t.Errorf("got %v after %d calls, wanted %v after one", err, wallet.calls, rp.ErrNotFound)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := Do(ctx, Policy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: time.Second, Retryable: IsTransient},
+		func() error {
+			return context.DeadlineExceeded
+		})
+	if err == nil || time.Since(start) > time.Second {
+		t.Errorf("got %v after %v, wanted to give up at the deadline", err, time.Since(start))
+	}
+}
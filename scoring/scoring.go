@@ -0,0 +1,67 @@
+package scoring
+
+import (
+	"fmt"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// DelayedError is returned by MakePayment when the scorer advised to wait.
+type DelayedError struct {
+	Probability float64
+	RetryAfter  time.Duration
+}
+
+func (e *DelayedError) Error() string {
+	return fmt.Sprintf("payment delayed, success probability is %.2f, retry after %s",
+		e.Probability, e.RetryAfter)
+}
+
+type Params struct {
+	Wallet rp.Wallet
+	Scorer rp.PaymentScorer
+
+	// FailOpen makes payments go through when the scorer itself fails.
+	FailOpen bool
+}
+
+// ScoringWallet wraps another wallet and consults the scorer before every
+// payment.
+type ScoringWallet struct {
+	rp.Wallet
+	scorer   rp.PaymentScorer
+	failOpen bool
+}
+
+func Start(params Params) (*ScoringWallet, error) {
+	return &ScoringWallet{
+		Wallet:   params.Wallet,
+		scorer:   params.Scorer,
+		failOpen: params.FailOpen,
+	}, nil
+}
+
+func (s *ScoringWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	advice, err := s.scorer.ScorePayment(params)
+	if err != nil {
+		if s.failOpen {
+			return s.Wallet.MakePayment(params)
+		}
+		return rp.PaymentData{}, fmt.Errorf("failed to score payment: %w", err)
+	}
+
+	switch advice.Action {
+	case rp.Delay:
+		return rp.PaymentData{}, &DelayedError{
+			Probability: advice.Probability,
+			RetryAfter:  advice.RetryAfter,
+		}
+	case rp.Split:
+		if advice.MaxParts > params.MaxParts {
+			params.MaxParts = advice.MaxParts
+		}
+	}
+
+	return s.Wallet.MakePayment(params)
+}
@@ -0,0 +1,70 @@
+package scoring
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+type recordingWallet struct {
+	void.VoidWallet
+	paid []rp.PaymentParams
+}
+
+func (w *recordingWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	w.paid = append(w.paid, params)
+	return rp.PaymentData{CheckingID: "hash"}, nil
+}
+
+type fixedScorer struct {
+	advice rp.PaymentAdvice
+	err    error
+}
+
+func (s fixedScorer) ScorePayment(rp.PaymentParams) (rp.PaymentAdvice, error) {
+	return s.advice, s.err
+}
+
+func TestScoringWallet(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		scorer   fixedScorer
+		failOpen bool
+		paid     bool
+		maxParts uint32
+	}{
+		{name: "attempt", scorer: fixedScorer{advice: rp.PaymentAdvice{Action: rp.Attempt}}, paid: true, maxParts: 2},
+		{name: "split", scorer: fixedScorer{advice: rp.PaymentAdvice{Action: rp.Split, MaxParts: 8}}, paid: true, maxParts: 8},
+		{name: "split less", scorer: fixedScorer{advice: rp.PaymentAdvice{Action: rp.Split, MaxParts: 1}}, paid: true, maxParts: 2},
+		{name: "delay", scorer: fixedScorer{advice: rp.PaymentAdvice{Action: rp.Delay}}},
+		{name: "scorer failed", scorer: fixedScorer{err: errors.New("unreachable")}},
+		{name: "scorer failed open", scorer: fixedScorer{err: errors.New("unreachable")}, failOpen: true, paid: true, maxParts: 2},
+	} {
+		wallet := &recordingWallet{}
+		s, _ := Start(Params{Wallet: wallet, Scorer: c.scorer, FailOpen: c.failOpen})
+
+		_, err := s.MakePayment(rp.PaymentParams{Invoice: "lnbc1", MaxParts: 2})
+		if c.paid != (err == nil) || c.paid != (len(wallet.paid) == 1) {
+			t.Errorf("%s: got %v and %d payments, wanted paid %v", c.name, err, len(wallet.paid), c.paid)
+			continue
+		}
+		if c.paid && wallet.paid[0].MaxParts != c.maxParts {
+			t.Errorf("%s: got %v, wanted %v parts", c.name, wallet.paid[0].MaxParts, c.maxParts)
+		}
+	}
+}
+
+func TestScoringWallet_Delay(t *testing.T) {
+	s, _ := Start(Params{Wallet: &recordingWallet{}, Scorer: fixedScorer{advice: rp.PaymentAdvice{
+		Action: rp.Delay, Probability: 0.1, RetryAfter: time.Minute,
+	}}})
+
+	_, err := s.MakePayment(rp.PaymentParams{Invoice: "lnbc1"})
+	var delayed *DelayedError
+	if !errors.As(err, &delayed) || delayed.RetryAfter != time.Minute || delayed.Probability != 0.1 {
+		t.Errorf("got %v, wanted a DelayedError to retry after %s", err, time.Minute)
+	}
+}
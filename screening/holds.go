@@ -0,0 +1,165 @@
+package screening
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Holds keeps the payments waiting for a review until they are released or
+// rejected. ScreeningWallet holds payments with it, and so can other wallets
+// that review payments, like the policy one. The zero value is ready to use.
+type Holds struct {
+	// HeldStatus is what held payments are reported as, rp.Pending when empty.
+	HeldStatus rp.Status
+
+	// KeepRejected is how long Status still reports rejected payments, a day
+	// when zero.
+	KeepRejected time.Duration
+
+	mu       sync.Mutex
+	held     map[string]hold
+	rejected map[string]rp.PaymentStatus
+	updates  rp.PaymentBroadcaster
+}
+
+type hold struct {
+	params rp.PaymentParams
+	dest   Destination
+	at     time.Time
+}
+
+// Hold keeps the payment to dest, unless one to the same payment hash is
+// held already, in which case it returns false.
+func (h *Holds) Hold(params rp.PaymentParams, dest Destination) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.held == nil {
+		h.held = make(map[string]hold)
+		h.rejected = make(map[string]rp.PaymentStatus)
+	}
+	if _, ok := h.held[dest.PaymentHash]; ok {
+		return false
+	}
+	h.held[dest.PaymentHash] = hold{params: params, dest: dest, at: time.Now()}
+	delete(h.rejected, dest.PaymentHash)
+	return true
+}
+
+func (h *Holds) IsHeld(checkingID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.held[checkingID]
+	return ok
+}
+
+// Held lists the held payments, oldest first.
+func (h *Holds) Held() []Destination {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	holds := make([]hold, 0, len(h.held))
+	for _, held := range h.held {
+		holds = append(holds, held)
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].at.Before(holds[j].at) })
+
+	dests := make([]Destination, len(holds))
+	for i, held := range holds {
+		dests[i] = held.dest
+	}
+	return dests
+}
+
+// Release stops holding a payment and returns its params, for the caller to
+// make it.
+func (h *Holds) Release(checkingID string) (rp.PaymentParams, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	held, ok := h.held[checkingID]
+	delete(h.held, checkingID)
+	return held.params, ok
+}
+
+// Reject drops a held payment, which is then reported as failed.
+func (h *Holds) Reject(checkingID string) bool {
+	h.mu.Lock()
+	held, ok := h.held[checkingID]
+	if !ok {
+		h.mu.Unlock()
+		return false
+	}
+	delete(h.held, checkingID)
+	status := rp.PaymentStatus{
+		CheckingID:  checkingID,
+		Status:      rp.Failed,
+		ResolvedAt:  time.Now(),
+		Destination: held.dest.Pubkey,
+		Msatoshi:    held.dest.Msatoshi,
+		Description: held.dest.Description,
+	}
+	h.pruneRejected(status.ResolvedAt)
+	h.rejected[checkingID] = status
+	h.mu.Unlock()
+
+	h.updates.Publish(status)
+	return true
+}
+
+// Status is the status of a held or rejected payment, ok is false for the
+// others.
+func (h *Holds) Status(checkingID string) (status rp.PaymentStatus, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if held, ok := h.held[checkingID]; ok {
+		status := rp.PaymentStatus{
+			CheckingID:  checkingID,
+			Status:      h.HeldStatus,
+			Destination: held.dest.Pubkey,
+			Msatoshi:    held.dest.Msatoshi,
+			Description: held.dest.Description,
+		}
+		if status.Status == "" {
+			status.Status = rp.Pending
+		}
+		return status, true
+	}
+	status, ok = h.rejected[checkingID]
+	if ok && time.Since(status.ResolvedAt) > h.keepRejected() {
+		delete(h.rejected, checkingID)
+		return rp.PaymentStatus{}, false
+	}
+	return status, ok
+}
+
+// pruneRejected forgets the rejections older than KeepRejected, so they don't
+// pile up when nobody asks for them.
+func (h *Holds) pruneRejected(now time.Time) {
+	for checkingID, status := range h.rejected {
+		if now.Sub(status.ResolvedAt) > h.keepRejected() {
+			delete(h.rejected, checkingID)
+		}
+	}
+}
+
+func (h *Holds) keepRejected() time.Duration {
+	if h.KeepRejected == 0 {
+		return 24 * time.Hour
+	}
+	return h.KeepRejected
+}
+
+// Publish passes on an update of a payment that was made, for Subscribe.
+func (h *Holds) Publish(status rp.PaymentStatus) {
+	h.updates.Publish(status)
+}
+
+// Subscribe streams the updates given to Publish along with the rejections.
+func (h *Holds) Subscribe() (<-chan rp.PaymentStatus, func()) {
+	return h.updates.Subscribe()
+}
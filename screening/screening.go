@@ -0,0 +1,198 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Decision is what a Screener says about a payment.
+type Decision int
+
+const (
+	Allow Decision = iota
+	Deny
+
+	// Hold keeps the payment until it is released or rejected, for cases
+	// that need a manual review.
+	Hold
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	case Hold:
+		return "hold"
+	}
+	return fmt.Sprintf("decision(%d)", int(d))
+}
+
+var (
+	ErrDenied     = errors.New("payment denied by screening")
+	ErrNotHeld    = errors.New("payment is not held")
+	ErrScreenFail = errors.New("screening failed")
+)
+
+// Destination is what the screener gets to decide on, taken from the decoded
+// invoice.
+type Destination struct {
+	Pubkey      string
+	PaymentHash string
+	Msatoshi    int64
+	Description string
+	Invoice     string
+}
+
+// DestinationOf decodes the invoice of a payment, with the custom amount if
+// there is one.
+func DestinationOf(params rp.PaymentParams) (Destination, error) {
+	inv, err := rp.DecodeBolt11(params.Invoice)
+	if err != nil {
+		return Destination{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+	}
+
+	dest := Destination{
+		Pubkey:      inv.Payee,
+		PaymentHash: inv.PaymentHash,
+		Msatoshi:    inv.MSatoshi,
+		Description: inv.Description,
+		Invoice:     params.Invoice,
+	}
+	if params.CustomAmount != 0 {
+		dest.Msatoshi = params.CustomAmount
+	}
+	return dest, nil
+}
+
+// Screener is implemented by compliance screening providers.
+type Screener interface {
+	Screen(ctx context.Context, dest Destination) (Decision, error)
+}
+
+// ScreenerFunc lets a plain function be used as a Screener.
+type ScreenerFunc func(ctx context.Context, dest Destination) (Decision, error)
+
+func (f ScreenerFunc) Screen(ctx context.Context, dest Destination) (Decision, error) {
+	return f(ctx, dest)
+}
+
+type Params struct {
+	Wallet   rp.Wallet
+	Screener Screener
+
+	// Timeout for each Screen call, defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// ScreeningWallet wraps another wallet and asks the screener about every
+// payment before it is made. Payments are refused when the screener errors,
+// so an unreachable provider never lets a payment through unscreened.
+type ScreeningWallet struct {
+	rp.Wallet
+	screener Screener
+	timeout  time.Duration
+	holds    Holds
+}
+
+func Start(params Params) (*ScreeningWallet, error) {
+	if params.Screener == nil {
+		return nil, errors.New("a screener is required")
+	}
+	if params.Timeout == 0 {
+		params.Timeout = 10 * time.Second
+	}
+
+	payments, err := params.Wallet.PaymentsStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+	}
+
+	s := &ScreeningWallet{
+		Wallet:   params.Wallet,
+		screener: params.Screener,
+		timeout:  params.Timeout,
+	}
+
+	go func() {
+		for status := range payments {
+			s.holds.Publish(status)
+		}
+	}()
+
+	return s, nil
+}
+
+// Compile time check to ensure that ScreeningWallet fully implements rp.Wallet
+var _ rp.Wallet = (*ScreeningWallet)(nil)
+
+func (s *ScreeningWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	dest, err := DestinationOf(params)
+	if err != nil {
+		return rp.PaymentData{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	decision, err := s.screener.Screen(ctx, dest)
+	if err != nil {
+		return rp.PaymentData{}, fmt.Errorf("%w for payment to %s: %v", ErrScreenFail, dest.Pubkey, err)
+	}
+
+	switch decision {
+	case Allow:
+		return s.Wallet.MakePayment(params)
+	case Hold:
+		s.holds.Hold(params, dest)
+		return rp.PaymentData{CheckingID: dest.PaymentHash}, nil
+	default:
+		return rp.PaymentData{}, fmt.Errorf("%w: payment to %s", ErrDenied, dest.Pubkey)
+	}
+}
+
+func (s *ScreeningWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	if status, ok := s.holds.Status(checkingID); ok {
+		return status, nil
+	}
+	return s.Wallet.GetPaymentStatus(checkingID)
+}
+
+// PaymentsStream also reports held payments that get rejected as failed.
+func (s *ScreeningWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	listener, _ := s.holds.Subscribe()
+	return listener, nil
+}
+
+// Held lists the checking ids of the payments waiting for a review, oldest
+// first.
+func (s *ScreeningWallet) Held() []string {
+	held := s.holds.Held()
+	ids := make([]string, len(held))
+	for i, dest := range held {
+		ids[i] = dest.PaymentHash
+	}
+	return ids
+}
+
+// Release makes a held payment.
+func (s *ScreeningWallet) Release(checkingID string) (rp.PaymentData, error) {
+	params, ok := s.holds.Release(checkingID)
+	if !ok {
+		return rp.PaymentData{}, ErrNotHeld
+	}
+	return s.Wallet.MakePayment(params)
+}
+
+// Reject drops a held payment, which is then reported as failed.
+func (s *ScreeningWallet) Reject(checkingID string) error {
+	if !s.holds.Reject(checkingID) {
+		return ErrNotHeld
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+const invoice = "lnbc175001ps6e5udpp58ur2s8s2ps4dxnhfmu4rpkr6syx6nc7r3q0hsp644nj7tejdxznsdq5w3jhxapqd9h8vmmfvdjscqzpgxqyz5vqsp50cs6gww9y96g84635a7apkwmmmlv69a2sah89qq03ngdgrvdf4ts9qyyssqs9kx2rngh4ty3h5t9hkrx4dxhfrne2jccluw6eq42hutaejvh474wvfg8untkk484v77043aus92mfshmq6psp487r34c5huglpnf0cq24eqg3"
+
+type payingWallet struct {
+	void.VoidWallet
+	paid int
+}
+
+func (w *payingWallet) MakePayment(rp.PaymentParams) (rp.PaymentData, error) {
+	w.paid++
+	return rp.PaymentData{CheckingID: "paid"}, nil
+}
+
+func decide(decision Decision, err error) Screener {
+	return ScreenerFunc(func(context.Context, Destination) (Decision, error) {
+		return decision, err
+	})
+}
+
+func TestMakePayment(t *testing.T) {
+	for _, tc := range []struct {
+		screener Screener
+		err      error
+		paid     int
+	}{
+		{decide(Allow, nil), nil, 1},
+		{decide(Deny, nil), ErrDenied, 0},
+		{decide(Allow, errors.New("provider unreachable")), ErrScreenFail, 0},
+	} {
+		wallet := &payingWallet{}
+		s, err := Start(Params{Wallet: wallet, Screener: tc.screener})
+		if err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+
+		_, err = s.MakePayment(rp.PaymentParams{Invoice: invoice})
+		if !errors.Is(err, tc.err) {
+			t.Errorf("got %v, wanted %v", err, tc.err)
+		}
+		if wallet.paid != tc.paid {
+			t.Errorf("got %v, wanted %v payments", wallet.paid, tc.paid)
+		}
+	}
+}
+
+func TestHold(t *testing.T) {
+	wallet := &payingWallet{}
+	s, _ := Start(Params{Wallet: wallet, Screener: decide(Hold, nil)})
+
+	data, err := s.MakePayment(rp.PaymentParams{Invoice: invoice})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if held := s.Held(); len(held) != 1 || held[0] != data.CheckingID {
+		t.Errorf("got %v, wanted %v held", held, data.CheckingID)
+	}
+	if status, _ := s.GetPaymentStatus(data.CheckingID); status.Status != rp.Pending {
+		t.Errorf("got %v, wanted %v", status.Status, rp.Pending)
+	}
+
+	if _, err := s.Release(data.CheckingID); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if wallet.paid != 1 {
+		t.Errorf("got %v, wanted %v payments", wallet.paid, 1)
+	}
+	if _, err := s.Release(data.CheckingID); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("got %v, wanted %v", err, ErrNotHeld)
+	}
+
+	data, _ = s.MakePayment(rp.PaymentParams{Invoice: invoice})
+	if err := s.Reject(data.CheckingID); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if status, _ := s.GetPaymentStatus(data.CheckingID); status.Status != rp.Failed {
+		t.Errorf("got %v, wanted %v", status.Status, rp.Failed)
+	}
+	if wallet.paid != 1 {
+		t.Errorf("got %v, wanted %v payments", wallet.paid, 1)
+	}
+}
+
+func TestHolds_KeepRejected(t *testing.T) {
+	h := &Holds{KeepRejected: time.Millisecond}
+
+	h.Hold(rp.PaymentParams{}, Destination{PaymentHash: "a"})
+	h.Reject("a")
+	if _, ok := h.Status("a"); !ok {
+		t.Errorf("got %v, wanted %v", ok, true)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	h.Hold(rp.PaymentParams{}, Destination{PaymentHash: "b"})
+	h.Reject("b")
+	if n := len(h.rejected); n != 1 {
+		t.Errorf("got %v rejections, wanted %v", n, 1)
+	}
+	if _, ok := h.Status("a"); ok {
+		t.Errorf("got %v, wanted %v", ok, false)
+	}
+}
@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// MasterKey derives invoice preimages deterministically from order ids, so
+// anyone holding the same key can regenerate and verify settlement proofs.
+// It never prints its contents and should be destroyed when no longer needed.
+type MasterKey struct {
+	key []byte
+}
+
+func NewMasterKey(key []byte) (*MasterKey, error) {
+	if len(key) < 32 {
+		return nil, fmt.Errorf("master key must have at least 32 bytes, got %d", len(key))
+	}
+
+	k := &MasterKey{key: make([]byte, len(key))}
+	copy(k.key, key)
+	return k, nil
+}
+
+// LoadMasterKey reads a hex-encoded key from a file that must not be readable
+// by other users.
+func LoadMasterKey(path string) (*MasterKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("master key file %s has permissions %s, it must only be readable by its owner",
+			path, info.Mode().Perm())
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(contents)
+
+	return parseHex(strings.TrimSpace(string(contents)))
+}
+
+// MasterKeyFromEnv reads a hex-encoded key from an environment variable and
+// removes it from the environment so child processes don't inherit it.
+func MasterKeyFromEnv(name string) (*MasterKey, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	os.Unsetenv(name)
+
+	return parseHex(value)
+}
+
+func parseHex(value string) (*MasterKey, error) {
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("master key must be hex-encoded")
+	}
+	defer wipe(key)
+
+	return NewMasterKey(key)
+}
+
+// Preimage returns HMAC-SHA256(key, orderID).
+func (k *MasterKey) Preimage(orderID string) []byte {
+	if k.key == nil {
+		panic("using a destroyed master key")
+	}
+
+	mac := hmac.New(sha256.New, k.key)
+	mac.Write([]byte(orderID))
+	return mac.Sum(nil)
+}
+
+func (k *MasterKey) PaymentHash(orderID string) []byte {
+	hash := sha256.Sum256(k.Preimage(orderID))
+	return hash[:]
+}
+
+// VerifyPreimage checks in constant time that preimage was derived for orderID.
+func (k *MasterKey) VerifyPreimage(orderID string, preimage []byte) bool {
+	return hmac.Equal(k.Preimage(orderID), preimage)
+}
+
+// Destroy zeroes the key, it can't be used afterwards.
+func (k *MasterKey) Destroy() {
+	wipe(k.key)
+	k.key = nil
+}
+
+func (k *MasterKey) String() string   { return "MasterKey(redacted)" }
+func (k *MasterKey) GoString() string { return k.String() }
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKey() []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func TestPreimage(t *testing.T) {
+	k, err := NewMasterKey(testKey())
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	// HMAC-SHA256 with the key 000102...1f
+	want := "ba54fb2c6b49158ea7f3095a8c06bd20ad26258fb7f440be274961ec34d4c187"
+	preimage := k.Preimage("order-1")
+	if got := hex.EncodeToString(preimage); got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	if !k.VerifyPreimage("order-1", preimage) {
+		t.Errorf("got %v, wanted %v", false, true)
+	}
+	if k.VerifyPreimage("order-2", preimage) {
+		t.Errorf("got %v, wanted %v for another order", true, false)
+	}
+}
+
+func TestNewMasterKey_Short(t *testing.T) {
+	if _, err := NewMasterKey(make([]byte, 31)); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.key")
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(testKey())+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMasterKey(path); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMasterKey(path); err == nil {
+		t.Errorf("got %v, wanted a world-readable key to be refused", err)
+	}
+}
+
+func TestMasterKeyFromEnv(t *testing.T) {
+	os.Setenv("RELAMPAGO_TEST_MASTER_KEY", hex.EncodeToString(testKey()))
+	if _, err := MasterKeyFromEnv("RELAMPAGO_TEST_MASTER_KEY"); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if _, ok := os.LookupEnv("RELAMPAGO_TEST_MASTER_KEY"); ok {
+		t.Errorf("got the variable still set, wanted it removed")
+	}
+
+	os.Setenv("RELAMPAGO_TEST_MASTER_KEY", "not hex")
+	defer os.Unsetenv("RELAMPAGO_TEST_MASTER_KEY")
+	if _, err := MasterKeyFromEnv("RELAMPAGO_TEST_MASTER_KEY"); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	k, _ := NewMasterKey(testKey())
+	if got := fmt.Sprintf("%v %#v", k, k); got != "MasterKey(redacted) MasterKey(redacted)" {
+		t.Errorf("got %v, wanted the key redacted", got)
+	}
+
+	k.Destroy()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("got no panic, wanted a destroyed key to panic")
+		}
+	}()
+	k.Preimage("order-1")
+}
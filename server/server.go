@@ -0,0 +1,371 @@
+// Package server exposes a wallet over JSON-RPC 2.0 on HTTP, mirroring the
+// Wallet interface, so services that aren't written in Go can use relampago.
+// Paid invoices and payment updates are streamed as server-sent events.
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/grant"
+)
+
+type Params struct {
+	Wallet rp.Wallet
+
+	// AdminKeys can call every method, InvoiceKeys everything but
+	// makePayment and cancelInvoice. Keys are sent as "Authorization: Bearer
+	// <key>" or in the X-Api-Key header.
+	AdminKeys   []string
+	InvoiceKeys []string
+
+	// GrantKey lets holders of grants signed by its private key call
+	// createInvoice within the grant limits without an api key, by sending
+	// "Authorization: Grant <token>", see the grant package.
+	GrantKey ed25519.PublicKey
+
+	// StringAmounts encodes msat amounts as strings, see rp.MarshalJSON.
+	StringAmounts bool
+}
+
+// JSON-RPC error codes, the ones below -32000 are ours.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeUnauthorized   = -32001
+	CodeNotFound       = -32004
+	CodeUnsupported    = -32005
+)
+
+// Server is an http.Handler answering JSON-RPC calls on POST / and streaming
+// events on GET /events.
+type Server struct {
+	Params
+	mux *http.ServeMux
+
+	invoices rp.InvoiceBroadcaster
+	payments rp.PaymentBroadcaster
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var adminOnly = map[string]bool{"makePayment": true, "cancelInvoice": true}
+
+var methods = map[string]handler{
+	"kind": func(s *Server, _ json.RawMessage) (interface{}, error) {
+		return s.Wallet.Kind(), nil
+	},
+	"capabilities": func(s *Server, _ json.RawMessage) (interface{}, error) {
+		return s.Wallet.Capabilities(), nil
+	},
+	"getInfo": func(s *Server, _ json.RawMessage) (interface{}, error) {
+		return s.Wallet.GetInfo()
+	},
+	"health": func(s *Server, _ json.RawMessage) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return s.Wallet.Health(ctx)
+	},
+	"createInvoice": func(s *Server, raw json.RawMessage) (interface{}, error) {
+		var params rp.InvoiceParams
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return s.Wallet.CreateInvoice(params)
+	},
+	"getInvoiceStatus": func(s *Server, raw json.RawMessage) (interface{}, error) {
+		var params struct {
+			CheckingID string `json:"checkingID"`
+		}
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return s.Wallet.GetInvoiceStatus(params.CheckingID)
+	},
+	"cancelInvoice": func(s *Server, raw json.RawMessage) (interface{}, error) {
+		var params struct {
+			CheckingID string `json:"checkingID"`
+		}
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return true, s.Wallet.CancelInvoice(params.CheckingID)
+	},
+	"makePayment": func(s *Server, raw json.RawMessage) (interface{}, error) {
+		var params rp.PaymentParams
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return s.Wallet.MakePayment(params)
+	},
+	"getPaymentStatus": func(s *Server, raw json.RawMessage) (interface{}, error) {
+		var params struct {
+			CheckingID string `json:"checkingID"`
+		}
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return s.Wallet.GetPaymentStatus(params.CheckingID)
+	},
+}
+
+func NewServer(params Params) (*Server, error) {
+	if len(params.AdminKeys) == 0 && len(params.InvoiceKeys) == 0 && params.GrantKey == nil {
+		return nil, errors.New("at least one api key or a grant key is required")
+	}
+
+	invoices, err := params.Wallet.PaidInvoicesStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to invoices: %w", err)
+	}
+	payments, err := params.Wallet.PaymentsStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+	}
+
+	s := &Server{Params: params, mux: http.NewServeMux()}
+	// a stalled /events client misses events instead of holding them back
+	// from the others
+	s.invoices.Policy = rp.Drop
+	s.payments.Policy = rp.Drop
+	s.mux.HandleFunc("/", s.serveRPC)
+	s.mux.HandleFunc("/events", s.serveEvents)
+
+	go func() {
+		for status := range invoices {
+			s.invoices.Publish(status)
+		}
+	}()
+	go func() {
+		for status := range payments {
+			s.payments.Publish(status)
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorize returns whether the request has a key and if it's an admin key.
+func (s *Server) authorize(r *http.Request) (ok bool, admin bool) {
+	key := r.Header.Get("X-Api-Key")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key == "" {
+		return false, false
+	}
+
+	for _, k := range s.AdminKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true, true
+		}
+	}
+	for _, k := range s.InvoiceKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// grantToken returns the grant sent instead of an api key, if any.
+func (s *Server) grantToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if s.GrantKey == nil || !strings.HasPrefix(auth, "Grant ") {
+		return ""
+	}
+	return strings.TrimPrefix(auth, "Grant ")
+}
+
+func (s *Server) serveRPC(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req request
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil || json.Unmarshal(body, &req) != nil {
+		s.write(w, response{Error: &Error{CodeParseError, "invalid json"}})
+		return
+	}
+
+	res := response{ID: req.ID}
+	authorized, admin := s.authorize(r)
+	handle, found := methods[req.Method]
+	token := ""
+	if !authorized {
+		token = s.grantToken(r)
+	}
+	switch {
+	case req.JSONRPC != "2.0":
+		res.Error = &Error{CodeInvalidRequest, "jsonrpc must be 2.0"}
+	case !authorized && token == "":
+		res.Error = &Error{CodeUnauthorized, "invalid api key"}
+	case token != "" && req.Method != "createInvoice":
+		res.Error = &Error{CodeUnauthorized, "grants can only be used to create invoices"}
+	case token != "":
+		var params rp.InvoiceParams
+		err := decodeParams(req.Params, &params)
+		if err == nil {
+			res.Result, err = grant.CreateInvoice(s.Wallet, s.GrantKey, token, params)
+		}
+		if err != nil {
+			res.Error = rpcError(err)
+		}
+	case !found:
+		res.Error = &Error{CodeMethodNotFound, fmt.Sprintf("unknown method '%s'", req.Method)}
+	case adminOnly[req.Method] && !admin:
+		res.Error = &Error{CodeUnauthorized, req.Method + " needs an admin key"}
+	default:
+		result, err := handle(s, req.Params)
+		if err != nil {
+			res.Error = rpcError(err)
+		} else {
+			res.Result = result
+		}
+	}
+	if !authorized && (token == "" || res.Error != nil && res.Error.Code == CodeUnauthorized) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	s.write(w, res)
+}
+
+// serveEvents streams paid invoices and payment updates as server-sent events
+// of the invoice.paid and payment.updated types.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	if ok, _ := s.authorize(r); !ok {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	invoices, unsubscribeInvoices := s.invoices.Subscribe()
+	defer unsubscribeInvoices()
+	payments, unsubscribePayments := s.payments.Subscribe()
+	defer unsubscribePayments()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		var (
+			eventType string
+			data      interface{}
+		)
+		select {
+		case status := <-invoices:
+			eventType, data = "invoice.paid", status
+		case status := <-payments:
+			eventType, data = "payment.updated", status
+		case <-r.Context().Done():
+			return
+		}
+
+		encoded, err := rp.MarshalJSON(data, s.StringAmounts)
+		if err != nil {
+			log.Printf("Failed to encode %s event: %v", eventType, err)
+			continue
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, encoded)
+		flusher.Flush()
+	}
+}
+
+func (s *Server) write(w http.ResponseWriter, res response) {
+	res.JSONRPC = "2.0"
+	if res.ID == nil {
+		res.ID = json.RawMessage("null")
+	}
+	body, err := rp.MarshalJSON(res, s.StringAmounts)
+	if err != nil {
+		body, _ = json.Marshal(response{
+			JSONRPC: "2.0",
+			ID:      res.ID,
+			Error:   &Error{CodeInternalError, "failed to encode result"},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func decodeParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := rp.UnmarshalJSON(raw, v); err != nil {
+		return &Error{CodeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+func rpcError(err error) *Error {
+	var rpcErr *Error
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.Is(err, rp.ErrInvalidParams):
+		return &Error{CodeInvalidParams, err.Error()}
+	case errors.Is(err, rp.ErrNotFound):
+		return &Error{CodeNotFound, err.Error()}
+	case errors.Is(err, rp.ErrUnsupported):
+		return &Error{CodeUnsupported, err.Error()}
+	case errors.Is(err, rp.ErrInsufficientPermissions), errors.Is(err, rp.ErrReadOnly),
+		errors.Is(err, grant.ErrMalformed), errors.Is(err, grant.ErrInvalidSig),
+		errors.Is(err, grant.ErrExpired):
+		return &Error{CodeUnauthorized, err.Error()}
+	case errors.Is(err, grant.ErrAmountNotInRange), errors.Is(err, grant.ErrExpiryTooLong):
+		return &Error{CodeInvalidParams, err.Error()}
+	}
+	return &Error{CodeInternalError, err.Error()}
+}
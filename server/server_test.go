@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/grant"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+func call(t *testing.T, url, key, method string, params interface{}) (json.RawMessage, *Error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0", "id": 1, "method": method, "params": params,
+	})
+	req, _ := http.NewRequest("POST", url, bytes.NewReader(body))
+	if !strings.HasPrefix(key, "Grant ") {
+		key = "Bearer " + key
+	}
+	req.Header.Set("Authorization", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&res)
+	return res.Result, res.Error
+}
+
+func TestServer(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	s, err := NewServer(Params{
+		Wallet:        tw,
+		AdminKeys:     []string{"admin"},
+		InvoiceKeys:   []string{"invoice"},
+		StringAmounts: true,
+	})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	result, rpcErr := call(t, srv.URL, "invoice", "createInvoice", map[string]interface{}{
+		"msatoshi": "5000", "description": "coffee",
+	})
+	var invoice rp.InvoiceData
+	json.Unmarshal(result, &invoice)
+	if rpcErr != nil || invoice.CheckingID == "" {
+		t.Fatalf("got %s, %v, wanted an invoice", result, rpcErr)
+	}
+
+	tw.SettleInvoice(invoice.CheckingID, 5000)
+	result, rpcErr = call(t, srv.URL, "invoice", "getInvoiceStatus", map[string]string{
+		"checkingID": invoice.CheckingID,
+	})
+	if rpcErr != nil || !strings.Contains(string(result), `"msatoshiReceived":"5000"`) {
+		t.Errorf("got %s, %v, wanted it paid with a string amount", result, rpcErr)
+	}
+
+	_, rpcErr = call(t, srv.URL, "invoice", "makePayment", map[string]string{"invoice": "lnbc1"})
+	if rpcErr == nil || rpcErr.Code != CodeUnauthorized {
+		t.Errorf("got %v, wanted an invoice key to be denied payments", rpcErr)
+	}
+	result, rpcErr = call(t, srv.URL, "admin", "makePayment", map[string]string{"invoice": "lnbc1"})
+	if rpcErr != nil {
+		t.Errorf("got %s, %v, wanted a payment", result, rpcErr)
+	}
+
+	for key, code := range map[string]int{"wrong": CodeUnauthorized, "admin": CodeMethodNotFound} {
+		if _, rpcErr := call(t, srv.URL, key, "openChannel", nil); rpcErr == nil || rpcErr.Code != code {
+			t.Errorf("%s: got %v, wanted %d", key, rpcErr, code)
+		}
+	}
+
+	_, rpcErr = call(t, srv.URL, "admin", "getInvoiceStatus", map[string]string{"checkingID": "unknown"})
+	if rpcErr == nil || rpcErr.Code != CodeNotFound {
+		t.Errorf("got %v, wanted %d", rpcErr, CodeNotFound)
+	}
+}
+
+func TestServer_Grants(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	tw, _ := testwallet.Start(testwallet.Params{})
+	s, err := NewServer(Params{Wallet: tw, GrantKey: pub})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	token, _ := grant.Issue(priv, grant.Grant{MinMsatoshi: 1000, MaxMsatoshi: 50000}, time.Hour)
+	result, rpcErr := call(t, srv.URL, "Grant "+token, "createInvoice", map[string]interface{}{
+		"msatoshi": 5000, "description": "coffee",
+	})
+	var invoice rp.InvoiceData
+	json.Unmarshal(result, &invoice)
+	if rpcErr != nil || invoice.CheckingID == "" {
+		t.Fatalf("got %s, %v, wanted an invoice", result, rpcErr)
+	}
+
+	_, rpcErr = call(t, srv.URL, "Grant "+token, "createInvoice", map[string]interface{}{"msatoshi": 100000})
+	if rpcErr == nil || rpcErr.Code != CodeInvalidParams {
+		t.Errorf("got %v, wanted %d", rpcErr, CodeInvalidParams)
+	}
+	_, rpcErr = call(t, srv.URL, "Grant "+token, "getInvoiceStatus", map[string]string{
+		"checkingID": invoice.CheckingID,
+	})
+	if rpcErr == nil || rpcErr.Code != CodeUnauthorized {
+		t.Errorf("got %v, wanted grants to only create invoices", rpcErr)
+	}
+
+	_, other, _ := ed25519.GenerateKey(nil)
+	forged, _ := grant.Issue(other, grant.Grant{MaxMsatoshi: 50000}, time.Hour)
+	_, rpcErr = call(t, srv.URL, "Grant "+forged, "createInvoice", map[string]interface{}{"msatoshi": 5000})
+	if rpcErr == nil || rpcErr.Code != CodeUnauthorized {
+		t.Errorf("got %v, wanted %d", rpcErr, CodeUnauthorized)
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	s, _ := NewServer(Params{Wallet: tw, InvoiceKeys: []string{"invoice"}})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/events", nil)
+	req.Header.Set("X-Api-Key", "invoice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("got %v, %v, wanted the stream", resp, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := tw.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tw.SettleInvoice(data.CheckingID, 1000)
+	}()
+
+	lines := bufio.NewScanner(resp.Body)
+	lines.Scan()
+	if lines.Text() != "event: invoice.paid" {
+		t.Errorf("got %s, wanted an invoice.paid event", lines.Text())
+	}
+	lines.Scan()
+	if !strings.Contains(lines.Text(), data.CheckingID) {
+		t.Errorf("got %s, wanted the paid invoice", lines.Text())
+	}
+}
+
+func TestServerEvents_StalledClient(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	s, _ := NewServer(Params{Wallet: tw, InvoiceKeys: []string{"invoice"}})
+	stalled, unsubscribe := s.invoices.Subscribe()
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*rp.StreamBufferSize; i++ {
+			s.invoices.Publish(rp.InvoiceStatus{Paid: true})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("got publishing blocked, wanted the stalled client skipped")
+	}
+	if len(stalled) != rp.StreamBufferSize {
+		t.Errorf("got %d, wanted %d buffered", len(stalled), rp.StreamBufferSize)
+	}
+}
@@ -0,0 +1,164 @@
+package sidecar
+
+import (
+	"fmt"
+	"sync"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Store keeps invoice data that the backend can't, like the full description
+// of invoices that only commit to its hash.
+type Store interface {
+	SaveDescription(checkingID string, description string) error
+	Description(checkingID string) (string, bool, error)
+}
+
+// LabelStore is implemented by stores that can also keep the labels of
+// invoices made with backends that can't, see InvoiceParams.Label.
+type LabelStore interface {
+	SaveLabel(checkingID string, label string) error
+	Label(checkingID string) (string, bool, error)
+}
+
+type Params struct {
+	Wallet rp.Wallet
+	Store  Store
+}
+
+// SidecarWallet wraps another wallet and saves what it can't keep to the
+// store, filling it back in statuses and stream events.
+type SidecarWallet struct {
+	rp.Wallet
+	store Store
+
+	invoiceUpdates rp.InvoiceBroadcaster
+}
+
+func Start(params Params) (*SidecarWallet, error) {
+	if params.Store == nil {
+		params.Store = NewMemoryStore()
+	}
+
+	invoices, err := params.Wallet.PaidInvoicesStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to invoices: %w", err)
+	}
+
+	s := &SidecarWallet{
+		Wallet: params.Wallet,
+		store:  params.Store,
+	}
+
+	go func() {
+		for status := range invoices {
+			s.invoiceUpdates.Publish(s.fill(status))
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *SidecarWallet) Capabilities() rp.Capabilities {
+	caps := s.Wallet.Capabilities()
+	if _, ok := s.store.(LabelStore); ok {
+		caps.Labels = true
+	}
+	return caps
+}
+
+func (s *SidecarWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	saveDescription := params.DescriptionHash != nil && params.Description != ""
+	if saveDescription && !rp.VerifyDescriptionHash(params.Description, params.DescriptionHash) {
+		return rp.InvoiceData{}, fmt.Errorf("%w: description doesn't match the description hash",
+			rp.ErrInvalidParams)
+	}
+	labels, saveLabel := s.store.(LabelStore)
+	saveLabel = saveLabel && params.Label != "" && !s.Wallet.Capabilities().Labels
+
+	data, err := s.Wallet.CreateInvoice(params)
+	if err != nil {
+		return data, err
+	}
+
+	if saveDescription {
+		if err := s.store.SaveDescription(data.CheckingID, params.Description); err != nil {
+			return data, fmt.Errorf("invoice created but failed to save its description: %w", err)
+		}
+	}
+	if saveLabel {
+		if err := labels.SaveLabel(data.CheckingID, params.Label); err != nil {
+			return data, fmt.Errorf("invoice created but failed to save its label: %w", err)
+		}
+	}
+
+	return data, nil
+}
+
+func (s *SidecarWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	status, err := s.Wallet.GetInvoiceStatus(checkingID)
+	if err != nil {
+		return status, err
+	}
+	return s.fill(status), nil
+}
+
+func (s *SidecarWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	listener, _ := s.invoiceUpdates.Subscribe()
+	return listener, nil
+}
+
+func (s *SidecarWallet) fill(status rp.InvoiceStatus) rp.InvoiceStatus {
+	if status.Description == "" {
+		if description, ok, err := s.store.Description(status.CheckingID); err == nil && ok {
+			status.Description = description
+		}
+	}
+	if labels, ok := s.store.(LabelStore); ok && status.Label == "" {
+		if label, ok, err := labels.Label(status.CheckingID); err == nil && ok {
+			status.Label = label
+		}
+	}
+	return status
+}
+
+type MemoryStore struct {
+	mu           sync.Mutex
+	descriptions map[string]string
+	labels       map[string]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		descriptions: make(map[string]string),
+		labels:       make(map[string]string),
+	}
+}
+
+func (m *MemoryStore) SaveDescription(checkingID string, description string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.descriptions[checkingID] = description
+	return nil
+}
+
+func (m *MemoryStore) Description(checkingID string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	description, ok := m.descriptions[checkingID]
+	return description, ok, nil
+}
+
+func (m *MemoryStore) SaveLabel(checkingID string, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.labels[checkingID] = label
+	return nil
+}
+
+func (m *MemoryStore) Label(checkingID string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	label, ok := m.labels[checkingID]
+	return label, ok, nil
+}
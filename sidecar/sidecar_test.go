@@ -0,0 +1,41 @@
+package sidecar
+
+import (
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+// unlabeled is a backend that can't keep labels.
+type unlabeled struct{ *testwallet.TestWallet }
+
+func (u unlabeled) Capabilities() rp.Capabilities {
+	caps := u.TestWallet.Capabilities()
+	caps.Labels = false
+	return caps
+}
+
+func (u unlabeled) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	params.Label = ""
+	return u.TestWallet.CreateInvoice(params)
+}
+
+func TestLabels(t *testing.T) {
+	backend, _ := testwallet.Start(testwallet.Params{})
+	s, err := Start(Params{Wallet: unlabeled{backend}})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if !s.Capabilities().Labels {
+		t.Errorf("got no label support, wanted the store to keep them")
+	}
+
+	inv, err := s.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, Label: "order-42"})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if status, _ := s.GetInvoiceStatus(inv.CheckingID); status.Label != "order-42" {
+		t.Errorf("got label %q, wanted %q", status.Label, "order-42")
+	}
+}
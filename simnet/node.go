@@ -0,0 +1,391 @@
+package simnet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// invoices are the prefix followed by the payment hash, the network knows
+// which node issued each one
+const invoicePrefix = "lnsim"
+
+const defaultExpiry = time.Hour
+
+// Node is a wallet on the network. It can only pay invoices issued by other
+// nodes of the same network and tries a single route for each payment.
+type Node struct {
+	net    *Network
+	name   string
+	pubkey string
+
+	// guarded by net.mu
+	invoices map[string]*invoice
+	payments map[string]*rp.PaymentStatus
+	offline  bool
+
+	invoiceUpdates rp.InvoiceBroadcaster
+	paymentUpdates rp.PaymentBroadcaster
+}
+
+type invoice struct {
+	status    rp.InvoiceStatus
+	preimage  string
+	msatoshi  int64
+	expiresAt time.Time
+}
+
+func newNode(net *Network, name string) *Node {
+	pubkey := sha256.Sum256([]byte(name))
+	return &Node{
+		net:      net,
+		name:     name,
+		pubkey:   "02" + hex.EncodeToString(pubkey[:]),
+		invoices: make(map[string]*invoice),
+		payments: make(map[string]*rp.PaymentStatus),
+	}
+}
+
+// Compile time check to ensure that Node fully implements rp.Wallet
+var _ rp.Wallet = (*Node)(nil)
+
+// Compile time check to ensure that Node implements rp.NodeInfoProvider
+var _ rp.NodeInfoProvider = (*Node)(nil)
+
+func (n *Node) Kind() string {
+	return "simnet"
+}
+
+func (n *Node) Capabilities() rp.Capabilities {
+	return rp.Capabilities{
+		MaxDescriptionLength: rp.MaxBolt11DescriptionLength,
+		CancelInvoices:       true,
+		Labels:               true,
+	}
+}
+
+// SetOffline makes the node unreachable, its calls fail with
+// rp.ErrBackendUnavailable and payments can't go to it or through it.
+func (n *Node) SetOffline(offline bool) {
+	n.net.mu.Lock()
+	n.offline = offline
+	n.net.mu.Unlock()
+}
+
+// check must be called with net.mu held
+func (n *Node) check() error {
+	if n.offline {
+		return fmt.Errorf("%w: node %s is offline", rp.ErrBackendUnavailable, n.name)
+	}
+	return nil
+}
+
+// Balance is the sum of the balances on the side of the node in all its
+// channels, in msatoshi.
+func (n *Node) Balance() int64 {
+	n.net.mu.Lock()
+	defer n.net.mu.Unlock()
+	return n.balance()
+}
+
+func (n *Node) balance() int64 {
+	var balance int64
+	for _, c := range n.net.channels {
+		if side := c.side(n); side >= 0 && !c.closed {
+			balance += c.balance[side]
+		}
+	}
+	return balance
+}
+
+// Compile time check to ensure that Node implements rp.OutboundCapacity
+var _ rp.OutboundCapacity = (*Node)(nil)
+
+// SpendableMsatoshi is the balance of the node, simnet channels have no
+// reserves.
+func (n *Node) SpendableMsatoshi() (int64, error) {
+	n.net.mu.Lock()
+	defer n.net.mu.Unlock()
+
+	if err := n.check(); err != nil {
+		return 0, err
+	}
+	return n.balance(), nil
+}
+
+func (n *Node) CanSend(msatoshi int64) (bool, error) {
+	spendable, err := n.SpendableMsatoshi()
+	if err != nil {
+		return false, err
+	}
+	return msatoshi <= spendable, nil
+}
+
+func (n *Node) GetInfo() (rp.WalletInfo, error) {
+	n.net.mu.Lock()
+	defer n.net.mu.Unlock()
+
+	if err := n.check(); err != nil {
+		return rp.WalletInfo{}, err
+	}
+	return rp.WalletInfo{Balance: n.balance() / 1000}, nil
+}
+
+func (n *Node) GetNodeInfo() (rp.NodeInfo, error) {
+	return rp.NodeInfo{Pubkey: n.pubkey, Alias: n.name, Network: "regtest"}, nil
+}
+
+func (n *Node) Health(context.Context) (rp.HealthStatus, error) {
+	n.net.mu.Lock()
+	defer n.net.mu.Unlock()
+
+	if err := n.check(); err != nil {
+		return rp.HealthStatus{}, err
+	}
+	return rp.HealthStatus{
+		Connected:     true,
+		SyncedToChain: true,
+		SyncedToGraph: true,
+		StreamsAlive:  true,
+	}, nil
+}
+
+func (n *Node) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	if err := rp.ValidateInvoiceParams(n.Capabilities(), params); err != nil {
+		return rp.InvoiceData{}, err
+	}
+	preimage, err := rp.InvoicePreimage(params)
+	if err != nil {
+		return rp.InvoiceData{}, err
+	}
+	hash := sha256.Sum256(preimage)
+	checkingID := hex.EncodeToString(hash[:])
+
+	expiry := defaultExpiry
+	if params.Expiry != nil {
+		expiry = *params.Expiry
+	}
+
+	n.net.mu.Lock()
+	defer n.net.mu.Unlock()
+
+	if err := n.check(); err != nil {
+		return rp.InvoiceData{}, err
+	}
+	if _, ok := n.net.payees[checkingID]; ok {
+		return rp.InvoiceData{}, fmt.Errorf("%w: payment hash %s is already used", rp.ErrInvalidParams, checkingID)
+	}
+	n.net.payees[checkingID] = n
+	n.invoices[checkingID] = &invoice{
+		status: rp.InvoiceStatus{
+			CheckingID:  checkingID,
+			Exists:      true,
+			Msatoshi:    params.Msatoshi,
+			Description: params.Description,
+			Label:       params.Label,
+		},
+		preimage:  hex.EncodeToString(preimage),
+		msatoshi:  params.Msatoshi,
+		expiresAt: time.Now().Add(expiry),
+	}
+
+	return rp.InvoiceData{
+		CheckingID: checkingID,
+		Preimage:   hex.EncodeToString(preimage),
+		Invoice:    invoicePrefix + checkingID,
+	}, nil
+}
+
+func (n *Node) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	n.net.mu.Lock()
+	defer n.net.mu.Unlock()
+
+	if err := n.check(); err != nil {
+		return rp.InvoiceLookupFailed(checkingID, err)
+	}
+	inv, ok := n.invoices[checkingID]
+	if !ok {
+		return rp.InvoiceNotFound(checkingID)
+	}
+	return inv.status, nil
+}
+
+func (n *Node) CancelInvoice(checkingID string) error {
+	n.net.mu.Lock()
+	defer n.net.mu.Unlock()
+
+	if err := n.check(); err != nil {
+		return err
+	}
+	inv, ok := n.invoices[checkingID]
+	if !ok {
+		return fmt.Errorf("%w: invoice %s", rp.ErrNotFound, checkingID)
+	}
+	if inv.status.Paid {
+		return errors.New("invoice is already paid")
+	}
+	inv.status.Canceled = true
+	return nil
+}
+
+func (n *Node) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	listener, _ := n.invoiceUpdates.Subscribe()
+	return listener, nil
+}
+
+// MakePayment locks the amount and fees along the cheapest route with enough
+// liquidity, then settles or fails the payment once every hop has forwarded
+// it. Paying an invoice that is already paid fails at the payee, like on the
+// real network.
+func (n *Node) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	if !strings.HasPrefix(params.Invoice, invoicePrefix) {
+		return rp.PaymentData{}, fmt.Errorf("%w: %q", rp.ErrInvalidBolt11, params.Invoice)
+	}
+	hash := strings.TrimPrefix(params.Invoice, invoicePrefix)
+
+	net := n.net
+	net.mu.Lock()
+	if err := n.check(); err != nil {
+		net.mu.Unlock()
+		return rp.PaymentData{}, err
+	}
+	payee, ok := net.payees[hash]
+	if !ok {
+		net.mu.Unlock()
+		return rp.PaymentData{}, fmt.Errorf("%w: %q is not an invoice of this network", rp.ErrInvalidBolt11, params.Invoice)
+	}
+	if payee == n {
+		net.mu.Unlock()
+		return rp.PaymentData{}, fmt.Errorf("%w: simnet can't pay %s", rp.ErrSelfPayment, hash)
+	}
+	if existing, ok := n.payments[hash]; ok && existing.Status != rp.Failed && !params.AllowDuplicate {
+		net.mu.Unlock()
+		return rp.PaymentData{CheckingID: hash}, nil
+	}
+
+	inv := payee.invoices[hash]
+	msatoshi := inv.msatoshi
+	if params.CustomAmount != 0 {
+		msatoshi = params.CustomAmount
+	}
+	if msatoshi <= 0 {
+		net.mu.Unlock()
+		return rp.PaymentData{}, fmt.Errorf("%w: an amount is needed to pay %s", rp.ErrInvalidParams, hash)
+	}
+
+	n.payments[hash] = &rp.PaymentStatus{
+		CheckingID:  hash,
+		Status:      rp.Pending,
+		Destination: payee.pubkey,
+		Msatoshi:    msatoshi,
+		Description: inv.status.Description,
+	}
+
+	var route []hop
+	if !payee.offline {
+		route = net.findRoute(n, payee, msatoshi)
+	}
+	if len(route) > 0 && params.MaxFeeMsatoshi != 0 && route[0].amount-msatoshi > params.MaxFeeMsatoshi {
+		route = nil // too expensive, there is no other route
+	}
+	for _, h := range route {
+		h.channel.balance[h.from] -= h.amount
+	}
+	delay := net.delay(len(route))
+	net.mu.Unlock()
+
+	resolve := func() { net.resolve(n, payee, hash, msatoshi, route) }
+	if delay == 0 {
+		resolve()
+	} else {
+		time.AfterFunc(delay, resolve)
+	}
+	return rp.PaymentData{CheckingID: hash}, nil
+}
+
+// resolve forwards a payment along its route, where the amount of each hop was
+// already taken from the sending side, and publishes how it ended.
+func (net *Network) resolve(payer, payee *Node, hash string, msatoshi int64, route []hop) {
+	net.mu.Lock()
+
+	payment := *payer.payments[hash]
+	payment.ResolvedAt = time.Now()
+
+	var reason rp.FailureReason
+	switch {
+	case len(route) == 0 && payer.balance() < msatoshi:
+		reason = rp.FailureInsufficientBalance
+	case len(route) == 0:
+		reason = rp.FailureNoRoute
+	default:
+		for _, h := range route {
+			if net.failed() || h.channel.nodes[1-h.from].offline {
+				reason = rp.FailureNoRoute
+				break
+			}
+		}
+	}
+
+	inv := payee.invoices[hash]
+	if reason == "" {
+		received := route[len(route)-1].amount
+		if inv.status.Paid || inv.status.Canceled || received < inv.msatoshi || payment.ResolvedAt.After(inv.expiresAt) {
+			reason = rp.FailureIncorrectPaymentDetails
+		}
+	}
+
+	var settled *rp.InvoiceStatus
+	if reason == "" {
+		for _, h := range route {
+			h.channel.balance[1-h.from] += h.amount
+		}
+		inv.status.Paid = true
+		inv.status.Settlements = 1
+		inv.status.MSatoshiReceived = route[len(route)-1].amount
+		inv.status.SettledAt = payment.ResolvedAt
+		status := inv.status
+		settled = &status
+
+		payment.Status = rp.Complete
+		payment.Preimage = inv.preimage
+		payment.FeePaid = route[0].amount - msatoshi
+	} else {
+		for _, h := range route {
+			h.channel.balance[h.from] += h.amount
+		}
+		payment.Status = rp.Failed
+		payment.FailureReason = reason
+	}
+	payer.payments[hash] = &payment
+	net.mu.Unlock()
+
+	if settled != nil {
+		go payee.invoiceUpdates.Publish(*settled)
+	}
+	go payer.paymentUpdates.Publish(payment)
+}
+
+func (n *Node) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	n.net.mu.Lock()
+	defer n.net.mu.Unlock()
+
+	if err := n.check(); err != nil {
+		return rp.PaymentStatus{}, err
+	}
+	status, ok := n.payments[checkingID]
+	if !ok {
+		return rp.PaymentStatus{CheckingID: checkingID, Status: rp.NeverTried}, nil
+	}
+	return *status, nil
+}
+
+func (n *Node) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	listener, _ := n.paymentUpdates.Subscribe()
+	return listener, nil
+}
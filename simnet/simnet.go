@@ -0,0 +1,230 @@
+// Package simnet is a lightning network in memory, made of nodes that are
+// wallets and of channels between them, so applications can be tested against
+// routing fees, slow payments, failures and liquidity running out without
+// running nodes:
+//
+//	net := simnet.New(simnet.Params{Seed: 1})
+//	alice, _ := net.AddNode("alice")
+//	bob, _ := net.AddNode("bob")
+//	carol, _ := net.AddNode("carol")
+//	net.Connect(alice, bob, 1000000, 0).SetPolicy(bob, simnet.Policy{BaseFeeMsatoshi: 1000})
+//	net.Connect(bob, carol, 1000000, 0)
+//
+// Payments from alice to carol are then forwarded by bob for a fee.
+package simnet
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type Params struct {
+	// HopLatency is how long every hop takes to forward a payment, plus up to
+	// Jitter more. When both are zero payments are resolved before MakePayment
+	// returns, for deterministic tests.
+	HopLatency time.Duration
+	Jitter     time.Duration
+
+	// FailureRate is the chance that each hop fails to forward a payment, like
+	// peers that are flaky or channels out of sync.
+	FailureRate float64
+
+	// Seed makes runs with the same payments reproducible.
+	Seed int64
+}
+
+// Policy is what a node charges to forward payments out through a channel.
+type Policy struct {
+	BaseFeeMsatoshi int64
+	FeeRatePPM      int64
+}
+
+func (p Policy) fee(msatoshi int64) int64 {
+	return p.BaseFeeMsatoshi + msatoshi*p.FeeRatePPM/1000000
+}
+
+// Network is safe for concurrent use, everything in it, nodes and channels
+// included, is guarded by a single lock.
+type Network struct {
+	Params
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	nodes    []*Node
+	channels []*Channel
+	payees   map[string]*Node // by payment hash
+}
+
+func New(params Params) *Network {
+	return &Network{
+		Params: params,
+		rng:    rand.New(rand.NewSource(params.Seed)),
+		payees: make(map[string]*Node),
+	}
+}
+
+// AddNode adds a node with no channels.
+func (net *Network) AddNode(name string) (*Node, error) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+
+	for _, node := range net.nodes {
+		if node.name == name {
+			return nil, fmt.Errorf("node %s already exists", name)
+		}
+	}
+	node := newNode(net, name)
+	net.nodes = append(net.nodes, node)
+	return node, nil
+}
+
+// Channel has a balance, in msatoshi, on the side of each node, which moves
+// from one side to the other as payments go through.
+type Channel struct {
+	net     *Network
+	nodes   [2]*Node
+	balance [2]int64
+	policy  [2]Policy
+	closed  bool
+}
+
+// Connect opens a channel between a and b with the given balances on each
+// side. It forwards payments for free until SetPolicy is called.
+func (net *Network) Connect(a, b *Node, balanceA, balanceB int64) *Channel {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+
+	channel := &Channel{
+		net:     net,
+		nodes:   [2]*Node{a, b},
+		balance: [2]int64{balanceA, balanceB},
+	}
+	net.channels = append(net.channels, channel)
+	return channel
+}
+
+var errNotInChannel = errors.New("node is not in the channel")
+
+// SetPolicy sets what node charges to forward payments out through the
+// channel.
+func (c *Channel) SetPolicy(node *Node, policy Policy) error {
+	c.net.mu.Lock()
+	defer c.net.mu.Unlock()
+
+	side := c.side(node)
+	if side < 0 {
+		return errNotInChannel
+	}
+	c.policy[side] = policy
+	return nil
+}
+
+// Balance is the balance on the side of node, without what is locked in
+// payments in flight.
+func (c *Channel) Balance(node *Node) int64 {
+	c.net.mu.Lock()
+	defer c.net.mu.Unlock()
+
+	side := c.side(node)
+	if side < 0 {
+		return 0
+	}
+	return c.balance[side]
+}
+
+// Close stops new payments from going through the channel. Payments already in
+// flight still resolve.
+func (c *Channel) Close() {
+	c.net.mu.Lock()
+	c.closed = true
+	c.net.mu.Unlock()
+}
+
+func (c *Channel) side(node *Node) int {
+	for i, n := range c.nodes {
+		if n == node {
+			return i
+		}
+	}
+	return -1
+}
+
+type hop struct {
+	channel *Channel
+	from    int   // side the payment leaves from
+	amount  int64 // sent through the channel, with the fees of the next hops
+}
+
+// findRoute finds the cheapest route with enough liquidity, with net.mu held.
+// It starts from the payee, like real nodes do, as each hop charges on the
+// amount it forwards.
+func (net *Network) findRoute(payer, payee *Node, msatoshi int64) []hop {
+	need := map[*Node]int64{payee: msatoshi} // what each node must receive
+	next := make(map[*Node]hop)
+	done := make(map[*Node]bool)
+
+	for {
+		var v *Node
+		for _, node := range net.nodes {
+			amount, ok := need[node]
+			if ok && !done[node] && (v == nil || amount < need[v]) {
+				v = node
+			}
+		}
+		if v == nil {
+			return nil
+		}
+		if v == payer {
+			break
+		}
+		done[v] = true
+
+		for _, c := range net.channels {
+			side := c.side(v)
+			if side < 0 || c.closed {
+				continue
+			}
+			from := 1 - side
+			u := c.nodes[from]
+			if done[u] || (u.offline && u != payer) || c.balance[from] < need[v] {
+				continue
+			}
+			amount := need[v]
+			if u != payer {
+				amount += c.policy[from].fee(need[v])
+			}
+			if old, ok := need[u]; !ok || amount < old {
+				need[u] = amount
+				next[u] = hop{channel: c, from: from, amount: need[v]}
+			}
+		}
+	}
+
+	var route []hop
+	for node := payer; node != payee; {
+		h := next[node]
+		route = append(route, h)
+		node = h.channel.nodes[1-h.from]
+	}
+	return route
+}
+
+// delay draws how long a payment through hops takes, with net.mu held.
+func (net *Network) delay(hops int) time.Duration {
+	var delay time.Duration
+	for i := 0; i < hops; i++ {
+		delay += net.HopLatency
+		if net.Jitter > 0 {
+			delay += time.Duration(net.rng.Int63n(int64(net.Jitter)))
+		}
+	}
+	return delay
+}
+
+// failed draws whether a hop fails to forward, with net.mu held.
+func (net *Network) failed() bool {
+	return net.FailureRate > 0 && net.rng.Float64() < net.FailureRate
+}
@@ -0,0 +1,139 @@
+package simnet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/walletest"
+)
+
+// alice has a channel with bob and bob has one with carol
+func line(params Params) (*Network, *Node, *Node, *Node) {
+	net := New(params)
+	alice, _ := net.AddNode("alice")
+	bob, _ := net.AddNode("bob")
+	carol, _ := net.AddNode("carol")
+	net.Connect(alice, bob, 1000000, 0)
+	net.Connect(bob, carol, 1000000, 0).SetPolicy(bob, Policy{BaseFeeMsatoshi: 1000, FeeRatePPM: 1000})
+	return net, alice, bob, carol
+}
+
+func TestPay(t *testing.T) {
+	_, alice, bob, carol := line(Params{})
+	invoices, _ := carol.PaidInvoicesStream()
+
+	inv, _ := carol.CreateInvoice(rp.InvoiceParams{Msatoshi: 100000})
+	payment, err := alice.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	status, _ := alice.GetPaymentStatus(payment.CheckingID)
+	if status.Status != rp.Complete || status.FeePaid != 1100 || status.Preimage != inv.Preimage {
+		t.Errorf("got %+v, wanted it complete with 1100 msat of fees", status)
+	}
+	if paid := <-invoices; !paid.Paid || paid.MSatoshiReceived != 100000 {
+		t.Errorf("got %+v, wanted 100000 msat received", paid)
+	}
+	for node, expected := range map[*Node]int64{alice: 898900, bob: 1001100, carol: 100000} {
+		if balance := node.Balance(); balance != expected {
+			t.Errorf("%s: got balance %d, wanted %d", node.name, balance, expected)
+		}
+	}
+
+	// paying again fails at carol
+	payment, _ = bob.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if status, _ := bob.GetPaymentStatus(payment.CheckingID); status.FailureReason != rp.FailureIncorrectPaymentDetails {
+		t.Errorf("got %+v, wanted %s", status, rp.FailureIncorrectPaymentDetails)
+	}
+}
+
+func TestPay_CheapestRoute(t *testing.T) {
+	net, alice, bob, carol := line(Params{})
+	dave, _ := net.AddNode("dave")
+	net.Connect(alice, dave, 1000000, 0)
+	net.Connect(dave, carol, 1000000, 0).SetPolicy(dave, Policy{BaseFeeMsatoshi: 10})
+
+	inv, _ := carol.CreateInvoice(rp.InvoiceParams{Msatoshi: 100000})
+	payment, _ := alice.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if status, _ := alice.GetPaymentStatus(payment.CheckingID); status.FeePaid != 10 {
+		t.Errorf("got %+v, wanted it through dave", status)
+	}
+
+	// without dave it goes through bob
+	dave.SetOffline(true)
+	inv, _ = carol.CreateInvoice(rp.InvoiceParams{Msatoshi: 100000})
+	payment, _ = alice.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if status, _ := alice.GetPaymentStatus(payment.CheckingID); status.FeePaid != 1100 {
+		t.Errorf("got %+v, wanted it through bob", status)
+	}
+	if _, err := dave.GetInfo(); !errors.Is(err, rp.ErrBackendUnavailable) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrBackendUnavailable)
+	}
+	if balance := bob.Balance(); balance != 1001100 {
+		t.Errorf("got balance %d, wanted bob to have earned the fee", balance)
+	}
+}
+
+func TestPay_Failures(t *testing.T) {
+	_, alice, _, carol := line(Params{})
+	for name, c := range map[string]struct {
+		msatoshi int64
+		reason   rp.FailureReason
+	}{
+		"insufficient balance": {2000000, rp.FailureInsufficientBalance},
+		"no route":             {999900, rp.FailureNoRoute}, // not enough left for the fees
+	} {
+		inv, _ := carol.CreateInvoice(rp.InvoiceParams{Msatoshi: c.msatoshi})
+		payment, _ := alice.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+		status, _ := alice.GetPaymentStatus(payment.CheckingID)
+		if status.Status != rp.Failed || status.FailureReason != c.reason {
+			t.Errorf("%s: got %+v, wanted %s", name, status, c.reason)
+		}
+	}
+	if balance := alice.Balance(); balance != 1000000 {
+		t.Errorf("got balance %d, wanted nothing taken from failed payments", balance)
+	}
+
+	_, alice, _, carol = line(Params{FailureRate: 1})
+	inv, _ := carol.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+	payment, _ := alice.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if status, _ := alice.GetPaymentStatus(payment.CheckingID); status.FailureReason != rp.FailureNoRoute {
+		t.Errorf("got %+v, wanted %s", status, rp.FailureNoRoute)
+	}
+	if status, _ := carol.GetInvoiceStatus(inv.CheckingID); status.Paid {
+		t.Errorf("got %+v, wanted the invoice unpaid", status)
+	}
+}
+
+func TestPay_Latency(t *testing.T) {
+	_, alice, _, carol := line(Params{HopLatency: 20 * time.Millisecond})
+	payments, _ := alice.PaymentsStream()
+
+	inv, _ := carol.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+	payment, _ := alice.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if status, _ := alice.GetPaymentStatus(payment.CheckingID); status.Status != rp.Pending {
+		t.Errorf("got %+v, wanted it pending while in flight", status)
+	}
+	if balance := alice.Balance(); balance != 1000000-1000-1001 {
+		t.Errorf("got balance %d, wanted the amount locked", balance)
+	}
+
+	select {
+	case status := <-payments:
+		if status.Status != rp.Complete {
+			t.Errorf("got %+v, wanted it complete", status)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("got no payment event")
+	}
+}
+
+func TestWallet(t *testing.T) {
+	walletest.Run(t, func() rp.Wallet {
+		node, _ := New(Params{}).AddNode("alice")
+		return node
+	})
+}
@@ -0,0 +1,217 @@
+package sparko
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/tidwall/gjson"
+)
+
+// The conversions between lightningd and relampago types, for apps that call
+// lightningd directly too and want the same results as the backend.
+
+// InvoiceToStatus converts an entry of the invoices listed by listinvoices,
+// the checking id is the invoice label. The label is returned as Label too,
+// for invoices made without one that is the generated label.
+func InvoiceToStatus(checkingID string, invoice gjson.Result) rp.InvoiceStatus {
+	if !invoice.Exists() {
+		return rp.InvoiceStatus{CheckingID: checkingID}
+	}
+
+	// newer lightningd versions only have amount_received_msat
+	received := invoice.Get("msatoshi_received").Int()
+	if !invoice.Get("msatoshi_received").Exists() {
+		received = msat(invoice.Get("amount_received_msat"))
+	}
+
+	return rp.InvoiceStatus{
+		CheckingID:       checkingID,
+		Exists:           true,
+		Paid:             invoice.Get("status").String() == "paid",
+		MSatoshiReceived: received,
+		Description:      invoice.Get("description").String(),
+		SettledAt:        unixTime(invoice.Get("paid_at")),
+		Preimage:         invoice.Get("payment_preimage").String(),
+		Label:            invoice.Get("label").String(),
+	}
+}
+
+// PayToStatus converts an entry of the payments listed by listpays, the
+// checking id is the payment hash. A missing entry was never tried.
+func PayToStatus(checkingID string, pay gjson.Result) rp.PaymentStatus {
+	status := rp.PaymentStatus{CheckingID: checkingID}
+	if !pay.Exists() {
+		status.Status = rp.NeverTried
+		return status
+	}
+
+	status.ResolvedAt = unixTime(pay.Get("completed_at"))
+	status.Destination = pay.Get("destination").String()
+	status.Msatoshi = msat(pay.Get("amount_msat"))
+	status.Description = pay.Get("description").String()
+	status = rp.FillPaymentDetails(status, pay.Get("bolt11").String())
+
+	switch pay.Get("status").String() {
+	case "complete":
+		status.Status = rp.Complete
+		status.FeePaid = msat(pay.Get("amount_sent_msat")) - msat(pay.Get("amount_msat"))
+		status.Preimage = pay.Get("preimage").String()
+	case "failed":
+		status.Status = rp.Failed
+	case "pending":
+		status.Status = rp.Pending
+	}
+
+	return status
+}
+
+// SpendableMsatoshi sums the spendable_msat of the usable channels, given the
+// result of listpeerchannels or of listpeers on older lightningd versions.
+// lightningd already takes the reserves and pending htlcs out of it.
+func SpendableMsatoshi(res gjson.Result) int64 {
+	channels := res.Get("channels").Array()
+	for _, peer := range res.Get("peers").Array() {
+		if peer.Get("connected").Bool() {
+			channels = append(channels, peer.Get("channels").Array()...)
+		}
+	}
+
+	var spendable int64
+	for _, channel := range channels {
+		if channel.Get("state").String() != "CHANNELD_NORMAL" {
+			continue
+		}
+		if connected := channel.Get("peer_connected"); connected.Exists() && !connected.Bool() {
+			continue
+		}
+		spendable += msat(channel.Get("spendable_msat"))
+	}
+	return spendable
+}
+
+// ChannelPolicies lists the policies of the usable channels, given the result
+// of listpeerchannels or of listpeers on older lightningd versions, which
+// don't have the time lock delta. The channel id is the short channel id.
+func ChannelPolicies(res gjson.Result) []rp.ChannelPolicy {
+	channels := res.Get("channels").Array()
+	peers := make([]string, len(channels))
+	for i, channel := range channels {
+		peers[i] = channel.Get("peer_id").String()
+	}
+	for _, peer := range res.Get("peers").Array() {
+		for _, channel := range peer.Get("channels").Array() {
+			channels = append(channels, channel)
+			peers = append(peers, peer.Get("id").String())
+		}
+	}
+
+	var policies []rp.ChannelPolicy
+	for i, channel := range channels {
+		if channel.Get("state").String() != "CHANNELD_NORMAL" {
+			continue
+		}
+		capacity := msat(channel.Get("total_msat"))
+		if capacity == 0 {
+			capacity = channel.Get("msatoshi_total").Int()
+		}
+		local := channel.Get("updates.local")
+		policy := rp.ChannelPolicy{
+			ChannelInfo: rp.ChannelInfo{
+				ID:          channel.Get("short_channel_id").String(),
+				Peer:        peers[i],
+				CapacitySat: capacity / 1000,
+			},
+			ChannelPoint: channel.Get("funding_txid").String() + ":" + channel.Get("funding_outnum").String(),
+			RoutingPolicy: rp.RoutingPolicy{
+				FeeBaseMsatoshi:           msat(channel.Get("fee_base_msat")),
+				FeeProportionalMillionths: channel.Get("fee_proportional_millionths").Int(),
+				TimeLockDelta:             uint32(local.Get("cltv_expiry_delta").Uint()),
+				MinHtlcMsatoshi:           msat(local.Get("htlc_minimum_msat")),
+				MaxHtlcMsatoshi:           msat(local.Get("htlc_maximum_msat")),
+			},
+		}
+		if !local.Exists() {
+			policy.MinHtlcMsatoshi = msat(channel.Get("minimum_htlc_out_msat"))
+			policy.MaxHtlcMsatoshi = msat(channel.Get("maximum_htlc_out_msat"))
+		}
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+// NodeToGraph converts a node listed by listnodes. Nodes that haven't sent an
+// announcement only have a pubkey.
+func NodeToGraph(node gjson.Result) rp.GraphNode {
+	graphNode := rp.GraphNode{
+		Pubkey:     node.Get("nodeid").String(),
+		Alias:      node.Get("alias").String(),
+		Color:      node.Get("color").String(),
+		LastUpdate: unixTime(node.Get("last_timestamp")),
+	}
+	for _, address := range node.Get("addresses").Array() {
+		graphNode.Addresses = append(graphNode.Addresses,
+			net.JoinHostPort(address.Get("address").String(), address.Get("port").String()))
+	}
+	return graphNode
+}
+
+// ChannelToGraph converts the directions of a channel listed by listchannels
+// with its short_channel_id, which are one per node that sent a policy. It is
+// false when there are none.
+func ChannelToGraph(res gjson.Result) (rp.GraphChannel, bool) {
+	directions := res.Get("channels").Array()
+	if len(directions) == 0 {
+		return rp.GraphChannel{}, false
+	}
+
+	first := directions[0]
+	channel := rp.GraphChannel{
+		ShortChannelID: first.Get("short_channel_id").String(),
+		Node1:          first.Get("source").String(),
+		Node2:          first.Get("destination").String(),
+		CapacitySat:    msat(first.Get("amount_msat")) / 1000,
+	}
+	if channel.CapacitySat == 0 {
+		channel.CapacitySat = first.Get("satoshis").Int()
+	}
+	if channel.Node2 < channel.Node1 {
+		channel.Node1, channel.Node2 = channel.Node2, channel.Node1
+	}
+	for _, direction := range directions {
+		policy := &rp.RoutingPolicy{
+			FeeBaseMsatoshi:           direction.Get("base_fee_millisatoshi").Int(),
+			FeeProportionalMillionths: direction.Get("fee_per_millionth").Int(),
+			TimeLockDelta:             uint32(direction.Get("delay").Uint()),
+			MinHtlcMsatoshi:           msat(direction.Get("htlc_minimum_msat")),
+			MaxHtlcMsatoshi:           msat(direction.Get("htlc_maximum_msat")),
+			Disabled:                  !direction.Get("active").Bool(),
+			LastUpdate:                unixTime(direction.Get("last_update")),
+		}
+		if direction.Get("source").String() == channel.Node1 {
+			channel.Node1Policy = policy
+		} else {
+			channel.Node2Policy = policy
+		}
+	}
+	return channel, true
+}
+
+// msat reads an amount field, which older lightningd versions give as a string
+// like "1000msat".
+func msat(field gjson.Result) int64 {
+	amount, _ := strconv.ParseInt(strings.TrimSuffix(field.String(), "msat"), 10, 64)
+	return amount
+}
+
+// unixTime is the time in a lightningd timestamp field, which is zero when the
+// field isn't there.
+func unixTime(field gjson.Result) time.Time {
+	if !field.Exists() || field.Float() == 0 {
+		return time.Time{}
+	}
+	seconds := field.Float()
+	return time.Unix(int64(seconds), int64((seconds-float64(int64(seconds)))*1e9))
+}
@@ -0,0 +1,256 @@
+package sparko
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/tidwall/gjson"
+)
+
+func TestInvoiceToStatus(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		invoice string
+		want    rp.InvoiceStatus
+	}{
+		{
+			name:    "missing",
+			invoice: `{}`,
+			want:    rp.InvoiceStatus{CheckingID: "label"},
+		},
+		{
+			name:    "unpaid",
+			invoice: `{"invoices": [{"status": "unpaid", "description": "coffee"}]}`,
+			want:    rp.InvoiceStatus{CheckingID: "label", Exists: true, Description: "coffee"},
+		},
+		{
+			name:    "paid",
+			invoice: `{"invoices": [{"status": "paid", "msatoshi_received": 5000, "paid_at": 1600000000}]}`,
+			want: rp.InvoiceStatus{
+				CheckingID: "label", Exists: true, Paid: true,
+				MSatoshiReceived: 5000, SettledAt: time.Unix(1600000000, 0),
+			},
+		},
+		{
+			name:    "paid with amount_received_msat",
+			invoice: `{"invoices": [{"status": "paid", "amount_received_msat": 5000}]}`,
+			want:    rp.InvoiceStatus{CheckingID: "label", Exists: true, Paid: true, MSatoshiReceived: 5000},
+		},
+		{
+			name:    "paid with preimage",
+			invoice: `{"invoices": [{"status": "paid", "amount_received_msat": 5000, "payment_preimage": "0102"}]}`,
+			want: rp.InvoiceStatus{
+				CheckingID: "label", Exists: true, Paid: true, MSatoshiReceived: 5000, Preimage: "0102",
+			},
+		},
+		{
+			name:    "labeled",
+			invoice: `{"invoices": [{"status": "unpaid", "label": "order-42"}]}`,
+			want:    rp.InvoiceStatus{CheckingID: "label", Exists: true, Label: "order-42"},
+		},
+	} {
+		got := InvoiceToStatus("label", gjson.Get(c.invoice, "invoices.0"))
+		if got != c.want {
+			t.Errorf("%s: got %+v, wanted %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPayToStatus(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		pays string
+		want rp.PaymentStatus
+	}{
+		{
+			name: "never tried",
+			pays: `{"pays": []}`,
+			want: rp.PaymentStatus{CheckingID: "hash", Status: rp.NeverTried},
+		},
+		{
+			name: "pending",
+			pays: `{"pays": [{"status": "pending"}]}`,
+			want: rp.PaymentStatus{CheckingID: "hash", Status: rp.Pending},
+		},
+		{
+			name: "failed",
+			pays: `{"pays": [{"status": "failed", "completed_at": 1600000000}]}`,
+			want: rp.PaymentStatus{CheckingID: "hash", Status: rp.Failed, ResolvedAt: time.Unix(1600000000, 0)},
+		},
+		{
+			name: "complete",
+			pays: `{"pays": [{"status": "complete", "amount_msat": "10000msat", "amount_sent_msat": "10012msat",
+				"preimage": "cd", "completed_at": 1600000000}]}`,
+			want: rp.PaymentStatus{
+				CheckingID: "hash", Status: rp.Complete, FeePaid: 12, Preimage: "cd",
+				ResolvedAt: time.Unix(1600000000, 0), Msatoshi: 10000,
+			},
+		},
+		{
+			name: "complete with numeric amounts",
+			pays: `{"pays": [{"status": "complete", "amount_msat": 10000, "amount_sent_msat": 10005}]}`,
+			want: rp.PaymentStatus{CheckingID: "hash", Status: rp.Complete, FeePaid: 5, Msatoshi: 10000},
+		},
+		{
+			name: "details",
+			pays: `{"pays": [{"status": "pending", "destination": "02ab", "amount_msat": 10000, "description": "coffee"}]}`,
+			want: rp.PaymentStatus{
+				CheckingID: "hash", Status: rp.Pending,
+				Destination: "02ab", Msatoshi: 10000, Description: "coffee",
+			},
+		},
+	} {
+		if got := PayToStatus("hash", gjson.Get(c.pays, "pays.0")); got != c.want {
+			t.Errorf("%s: got %+v, wanted %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSpendableMsatoshi(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		res  string
+		want int64
+	}{
+		{
+			name: "listpeerchannels",
+			res: `{"channels": [
+				{"state": "CHANNELD_NORMAL", "peer_connected": true, "spendable_msat": 5000},
+				{"state": "CHANNELD_NORMAL", "peer_connected": false, "spendable_msat": 7000},
+				{"state": "CHANNELD_AWAITING_LOCKIN", "peer_connected": true, "spendable_msat": 9000}
+			]}`,
+			want: 5000,
+		},
+		{
+			name: "listpeers",
+			res: `{"peers": [
+				{"connected": true, "channels": [{"state": "CHANNELD_NORMAL", "spendable_msat": "3000msat"}]},
+				{"connected": false, "channels": [{"state": "CHANNELD_NORMAL", "spendable_msat": "4000msat"}]}
+			]}`,
+			want: 3000,
+		},
+	} {
+		if got := SpendableMsatoshi(gjson.Parse(c.res)); got != c.want {
+			t.Errorf("%s: got %v, wanted %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNodeToGraph(t *testing.T) {
+	node := NodeToGraph(gjson.Parse(`{
+		"nodeid": "02a", "alias": "ACINQ", "color": "49daaa", "last_timestamp": 1600000000,
+		"addresses": [{"type": "ipv4", "address": "3.33.236.230", "port": 9735}, {"type": "ipv6", "address": "::1", "port": 9735}]
+	}`))
+	want := rp.GraphNode{
+		Pubkey:     "02a",
+		Alias:      "ACINQ",
+		Color:      "49daaa",
+		Addresses:  []string{"3.33.236.230:9735", "[::1]:9735"},
+		LastUpdate: time.Unix(1600000000, 0),
+	}
+	if !reflect.DeepEqual(node, want) {
+		t.Errorf("got %+v, wanted %+v", node, want)
+	}
+}
+
+func TestChannelToGraph(t *testing.T) {
+	if _, ok := ChannelToGraph(gjson.Parse(`{"channels": []}`)); ok {
+		t.Errorf("got %v, wanted %v", ok, false)
+	}
+
+	channel, ok := ChannelToGraph(gjson.Parse(`{"channels": [
+		{"source": "03b", "destination": "02a", "short_channel_id": "700000x1x0", "amount_msat": "1000000000msat",
+		 "base_fee_millisatoshi": 1000, "fee_per_millionth": 100, "delay": 40, "active": false,
+		 "htlc_minimum_msat": "1msat", "htlc_maximum_msat": "990000000msat", "last_update": 1600000000}
+	]}`))
+	want := rp.GraphChannel{
+		ShortChannelID: "700000x1x0",
+		Node1:          "02a",
+		Node2:          "03b",
+		CapacitySat:    1000000,
+		Node2Policy: &rp.RoutingPolicy{
+			FeeBaseMsatoshi:           1000,
+			FeeProportionalMillionths: 100,
+			TimeLockDelta:             40,
+			MinHtlcMsatoshi:           1,
+			MaxHtlcMsatoshi:           990000000,
+			Disabled:                  true,
+			LastUpdate:                time.Unix(1600000000, 0),
+		},
+	}
+	if !ok || !reflect.DeepEqual(channel, want) {
+		t.Errorf("got %+v %v, wanted %+v", channel, ok, want)
+	}
+}
+
+func TestChannelPolicies(t *testing.T) {
+	txid := "ab" + strings.Repeat("0", 62)
+	for _, c := range []struct {
+		name string
+		res  string
+		want rp.ChannelPolicy
+	}{
+		{
+			name: "listpeerchannels",
+			res: `{"channels": [
+				{"state": "CHANNELD_NORMAL", "peer_id": "02a", "short_channel_id": "700000x1x0", "funding_txid": "` + txid + `",
+				 "funding_outnum": 1, "total_msat": 1000000000, "fee_base_msat": 1000, "fee_proportional_millionths": 10,
+				 "updates": {"local": {"cltv_expiry_delta": 34, "htlc_minimum_msat": 1, "htlc_maximum_msat": 990000000}}},
+				{"state": "CHANNELD_AWAITING_LOCKIN", "peer_id": "02b"}
+			]}`,
+			want: rp.ChannelPolicy{
+				ChannelInfo:  rp.ChannelInfo{ID: "700000x1x0", Peer: "02a", CapacitySat: 1000000},
+				ChannelPoint: txid + ":1",
+				RoutingPolicy: rp.RoutingPolicy{
+					FeeBaseMsatoshi:           1000,
+					FeeProportionalMillionths: 10,
+					TimeLockDelta:             34,
+					MinHtlcMsatoshi:           1,
+					MaxHtlcMsatoshi:           990000000,
+				},
+			},
+		},
+		{
+			name: "listpeers",
+			res: `{"peers": [{"id": "02a", "channels": [
+				{"state": "CHANNELD_NORMAL", "short_channel_id": "700000x1x0", "funding_txid": "` + txid + `",
+				 "funding_outnum": 1, "msatoshi_total": 1000000000, "fee_base_msat": "1000msat", "fee_proportional_millionths": 10,
+				 "minimum_htlc_out_msat": "1msat", "maximum_htlc_out_msat": "990000000msat"}
+			]}]}`,
+			want: rp.ChannelPolicy{
+				ChannelInfo:  rp.ChannelInfo{ID: "700000x1x0", Peer: "02a", CapacitySat: 1000000},
+				ChannelPoint: txid + ":1",
+				RoutingPolicy: rp.RoutingPolicy{
+					FeeBaseMsatoshi:           1000,
+					FeeProportionalMillionths: 10,
+					MinHtlcMsatoshi:           1,
+					MaxHtlcMsatoshi:           990000000,
+				},
+			},
+		},
+	} {
+		policies := ChannelPolicies(gjson.Parse(c.res))
+		if len(policies) != 1 || policies[0] != c.want {
+			t.Errorf("%s: got %+v, wanted %+v", c.name, policies, []rp.ChannelPolicy{c.want})
+		}
+	}
+}
+
+func TestUnixTime(t *testing.T) {
+	for _, c := range []struct {
+		json string
+		want time.Time
+	}{
+		{`{}`, time.Time{}},
+		{`{"at": 0}`, time.Time{}},
+		{`{"at": 1640995200}`, time.Unix(1640995200, 0)},
+		{`{"at": 1640995200.5}`, time.Unix(1640995200, 5e8)},
+	} {
+		if got := unixTime(gjson.Get(c.json, "at")); !got.Equal(c.want) {
+			t.Errorf("got %v, wanted %v for %s", got, c.want, c.json)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package sparko
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/tidwall/gjson"
+)
+
+// Caller runs a lightningd command and returns its result, however the node is
+// reached: through sparko, commando or the RPC socket. It gives up when ctx is
+// done.
+type Caller interface {
+	Call(ctx context.Context, method string, params map[string]interface{}) (gjson.Result, error)
+}
+
+// Lightningd implements the wallet methods that only differ between the Core
+// Lightning backends in how commands reach the node. The backends embed it and
+// add the payment and invoice streams, which they get in different ways.
+type Lightningd struct {
+	Caller Caller
+
+	// LabelPrefix starts the labels of invoices made without one, defaults to
+	// 'relampago'.
+	LabelPrefix string
+
+	// labels of the invoices deleted by CancelInvoice, since delinvoice leaves
+	// nothing behind for listinvoices to find
+	canceled sync.Map
+}
+
+func (l *Lightningd) call(method string, params map[string]interface{}) (gjson.Result, error) {
+	return l.Caller.Call(context.Background(), method, params)
+}
+
+var capabilities = rp.Capabilities{
+	MaxDescriptionLength: rp.MaxBolt11DescriptionLength,
+	RouteHints:           true,
+	FallbackAddresses:    true,
+	CancelInvoices:       true,
+	CltvExpiry:           true,
+	Labels:               true,
+}
+
+func (l *Lightningd) Capabilities() rp.Capabilities {
+	return capabilities
+}
+
+func (l *Lightningd) GetInfo() (rp.WalletInfo, error) {
+	res, err := l.call("listfunds", nil)
+	if err != nil {
+		return rp.WalletInfo{}, fmt.Errorf("error calling listfunds: %w", err)
+	}
+
+	var balance int64
+	for _, channel := range res.Get("channels").Array() {
+		balance += channel.Get("channel_sat").Int()
+	}
+
+	return rp.WalletInfo{Balance: balance}, nil
+}
+
+// Compile time check to ensure that Lightningd implements rp.OutboundCapacity
+var _ rp.OutboundCapacity = (*Lightningd)(nil)
+
+func (l *Lightningd) SpendableMsatoshi() (int64, error) {
+	res, err := l.listPeerChannels()
+	if err != nil {
+		return 0, err
+	}
+	return SpendableMsatoshi(res), nil
+}
+
+func (l *Lightningd) CanSend(msatoshi int64) (bool, error) {
+	spendable, err := l.SpendableMsatoshi()
+	if err != nil {
+		return false, err
+	}
+	return msatoshi <= spendable, nil
+}
+
+func (l *Lightningd) listPeerChannels() (gjson.Result, error) {
+	res, err := l.call("listpeerchannels", nil)
+	if err != nil {
+		// lightningd before 23.02 only has listpeers
+		res, err = l.call("listpeers", nil)
+		if err != nil {
+			return gjson.Result{}, fmt.Errorf("error calling listpeers: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// Compile time check to ensure that Lightningd implements rp.NodeInfoProvider
+var _ rp.NodeInfoProvider = (*Lightningd)(nil)
+
+func (l *Lightningd) GetNodeInfo() (rp.NodeInfo, error) {
+	res, err := l.call("getinfo", nil)
+	if err != nil {
+		return rp.NodeInfo{}, fmt.Errorf("error calling getinfo: %w", err)
+	}
+
+	network := res.Get("network").String()
+	if network == "bitcoin" {
+		network = "mainnet"
+	}
+
+	return rp.NodeInfo{
+		Pubkey:      res.Get("id").String(),
+		Alias:       res.Get("alias").String(),
+		Network:     network,
+		BlockHeight: res.Get("blockheight").Int(),
+		Version:     res.Get("version").String(),
+	}, nil
+}
+
+// Compile time check to ensure that Lightningd implements rp.GraphReader
+var _ rp.GraphReader = (*Lightningd)(nil)
+
+func (l *Lightningd) GetNode(pubkey string) (rp.GraphNode, error) {
+	res, err := l.call("listnodes", map[string]interface{}{"id": pubkey})
+	if err != nil {
+		return rp.GraphNode{}, fmt.Errorf("error calling listnodes: %w", err)
+	}
+	nodes := res.Get("nodes").Array()
+	if len(nodes) == 0 {
+		return rp.GraphNode{}, fmt.Errorf("%w: node %s", rp.ErrNotFound, pubkey)
+	}
+	return NodeToGraph(nodes[0]), nil
+}
+
+func (l *Lightningd) GetChannel(shortChannelID string) (rp.GraphChannel, error) {
+	res, err := l.call("listchannels", map[string]interface{}{"short_channel_id": shortChannelID})
+	if err != nil {
+		return rp.GraphChannel{}, fmt.Errorf("error calling listchannels: %w", err)
+	}
+	channel, ok := ChannelToGraph(res)
+	if !ok {
+		return rp.GraphChannel{}, fmt.Errorf("%w: channel %s", rp.ErrNotFound, shortChannelID)
+	}
+	return channel, nil
+}
+
+// ListGraphNodes leaves the channels and capacity of the nodes out, which
+// lightningd would have to list the whole graph for.
+func (l *Lightningd) ListGraphNodes() ([]rp.GraphNode, error) {
+	res, err := l.call("listnodes", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error calling listnodes: %w", err)
+	}
+	var nodes []rp.GraphNode
+	for _, node := range res.Get("nodes").Array() {
+		nodes = append(nodes, NodeToGraph(node))
+	}
+	return nodes, nil
+}
+
+// Compile time check to ensure that Lightningd implements rp.PolicyManager
+var _ rp.PolicyManager = (*Lightningd)(nil)
+
+// UpdateChannelPolicy only takes a timeLockDelta of zero, lightningd has one
+// for all channels in its config.
+func (l *Lightningd) UpdateChannelPolicy(chanPoint string, baseFeeMsatoshi, feeRatePPM int64, timeLockDelta uint32) error {
+	if err := rp.ValidateChannelPolicy(chanPoint, baseFeeMsatoshi, feeRatePPM); err != nil {
+		return err
+	}
+	if timeLockDelta != 0 {
+		return fmt.Errorf("%w: lightningd can't set the time lock delta of a channel", rp.ErrUnsupported)
+	}
+
+	id := "all"
+	if chanPoint != "" {
+		policies, err := l.GetChannelPolicies()
+		if err != nil {
+			return err
+		}
+		id = ""
+		for _, policy := range policies {
+			if policy.ChannelPoint == chanPoint {
+				id = policy.ID
+			}
+		}
+		if id == "" {
+			return fmt.Errorf("%w: channel %s", rp.ErrNotFound, chanPoint)
+		}
+	}
+
+	_, err := l.call("setchannel", map[string]interface{}{
+		"id":      id,
+		"feebase": baseFeeMsatoshi,
+		"feeppm":  feeRatePPM,
+	})
+	if err != nil {
+		return fmt.Errorf("error calling setchannel: %w", err)
+	}
+	return nil
+}
+
+func (l *Lightningd) GetChannelPolicies() ([]rp.ChannelPolicy, error) {
+	res, err := l.listPeerChannels()
+	if err != nil {
+		return nil, err
+	}
+	return ChannelPolicies(res), nil
+}
+
+// Compile time check to ensure that Lightningd implements rp.MessageSigner
+var _ rp.MessageSigner = (*Lightningd)(nil)
+
+func (l *Lightningd) SignMessage(message string) (string, error) {
+	res, err := l.call("signmessage", map[string]interface{}{"message": message})
+	if err != nil {
+		return "", fmt.Errorf("error calling signmessage: %w", err)
+	}
+	return res.Get("zbase").String(), nil
+}
+
+// VerifyMessage only recognizes signatures of nodes in the graph of the node.
+func (l *Lightningd) VerifyMessage(message, signature string) (rp.MessageVerification, error) {
+	res, err := l.call("checkmessage", map[string]interface{}{
+		"message": message,
+		"zbase":   signature,
+	})
+	if err != nil {
+		return rp.MessageVerification{}, fmt.Errorf("error calling checkmessage: %w", err)
+	}
+	return rp.MessageVerification{
+		Valid:  res.Get("verified").Bool(),
+		Pubkey: res.Get("pubkey").String(),
+	}, nil
+}
+
+// Health reports the streams as alive, as both backends resubscribe by
+// themselves.
+func (l *Lightningd) Health(ctx context.Context) (rp.HealthStatus, error) {
+	res, err := l.Caller.Call(ctx, "getinfo", nil)
+	if err != nil {
+		return rp.HealthStatus{}, fmt.Errorf("error calling getinfo: %w", err)
+	}
+
+	// lightningd only shows these while it is catching up
+	bitcoindWarning := res.Get("warning_bitcoind_sync").String()
+	lightningdWarning := res.Get("warning_lightningd_sync").String()
+	synced := bitcoindWarning == "" && lightningdWarning == ""
+
+	return rp.HealthStatus{
+		Connected:     true,
+		SyncedToChain: synced,
+		SyncedToGraph: synced,
+		StreamsAlive:  true,
+		Detail:        strings.TrimSpace(bitcoindWarning + " " + lightningdWarning),
+	}, nil
+}
+
+// CreateInvoice makes invoices with a description hash with deschashonly when
+// the description is given, and with the invoicewithdescriptionhash plugin
+// otherwise.
+func (l *Lightningd) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	if err := rp.ValidateInvoiceParams(l.Capabilities(), params); err != nil {
+		return rp.InvoiceData{}, err
+	}
+
+	method := "invoice"
+	args := map[string]interface{}{
+		"amount_msat": params.Msatoshi,
+		"description": params.Description,
+	}
+	if params.Msatoshi == 0 {
+		args["amount_msat"] = "any"
+	}
+	if params.Private {
+		args["exposeprivatechannels"] = true
+	} else {
+		args["exposeprivatechannels"] = make([]struct{}, 0) // to suppress route hints
+	}
+
+	// lightningd can only commit to the hash of a description it is given
+	if params.DescriptionHash != nil {
+		if params.Description != "" {
+			args["deschashonly"] = true
+		} else {
+			method = "invoicewithdescriptionhash"
+			delete(args, "description")
+			args["description_hash"] = hex.EncodeToString(params.DescriptionHash)
+		}
+	}
+
+	// lightningd labels must be unique, a given one is also the checking id
+	if params.Label != "" {
+		args["label"] = params.Label
+	} else {
+		labelPrefix := l.LabelPrefix
+		if labelPrefix == "" {
+			labelPrefix = "relampago"
+		}
+		args["label"] = labelPrefix + "/" + strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	preimage, err := rp.InvoicePreimage(params)
+	if err != nil {
+		return rp.InvoiceData{}, err
+	}
+	args["preimage"] = hex.EncodeToString(preimage)
+
+	if params.Expiry != nil {
+		args["expiry"] = params.Expiry.Seconds()
+	}
+
+	if params.FallbackAddress != "" {
+		args["fallbacks"] = []string{params.FallbackAddress}
+	}
+
+	if params.CltvExpiry != 0 {
+		args["cltv"] = params.CltvExpiry
+	}
+
+	inv, err := l.call(method, args)
+	if err != nil {
+		return rp.InvoiceData{}, fmt.Errorf("%s call failed: %w", method, err)
+	}
+	return rp.InvoiceData{
+		Invoice:    inv.Get("bolt11").String(),
+		Preimage:   args["preimage"].(string),
+		CheckingID: args["label"].(string),
+	}, nil
+}
+
+func (l *Lightningd) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	res, err := l.call("listinvoices", map[string]interface{}{"label": checkingID})
+	if err != nil {
+		return rp.InvoiceLookupFailed(checkingID,
+			fmt.Errorf("error getting invoice label=%s: %w", checkingID, err))
+	}
+	if res.Get("invoices.#").Int() == 0 {
+		if _, ok := l.canceled.Load(checkingID); ok {
+			return rp.InvoiceStatus{CheckingID: checkingID, Exists: true, Canceled: true}, nil
+		}
+		return rp.InvoiceNotFound(checkingID)
+	}
+
+	return InvoiceToStatus(checkingID, res.Get("invoices.0")), nil
+}
+
+// CancelInvoice deletes the unpaid invoice with delinvoice. Core Lightning
+// keeps no trace of it, so GetInvoiceStatus reports it as canceled only until
+// the wallet is restarted, and as not found after that.
+func (l *Lightningd) CancelInvoice(checkingID string) error {
+	_, err := l.call("delinvoice", map[string]interface{}{
+		"label":  checkingID,
+		"status": "unpaid",
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting invoice label=%s: %w", checkingID, err)
+	}
+	l.canceled.Store(checkingID, struct{}{})
+	return nil
+}
+
+// PayArgs checks a payment can be made and returns the arguments of the pay
+// command for it, and its checking id. The backends run pay themselves, as
+// they learn how it ended in different ways.
+func PayArgs(params rp.PaymentParams) (map[string]interface{}, string, error) {
+	inv, err := rp.DecodeBolt11(params.Invoice)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+	}
+
+	amount := inv.MSatoshi
+	if params.CustomAmount != 0 {
+		amount = params.CustomAmount
+	}
+	if err := rp.ValidatePayment(capabilities, params, amount); err != nil {
+		return nil, "", err
+	}
+
+	args := map[string]interface{}{
+		"bolt11": params.Invoice,
+	}
+	if params.CustomAmount != 0 {
+		args["amount_msat"] = params.CustomAmount
+	}
+	return args, inv.PaymentHash, nil
+}
+
+func (l *Lightningd) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	res, err := l.call("listpays", map[string]interface{}{
+		"payment_hash": checkingID,
+	})
+	if err != nil {
+		return rp.PaymentStatus{}, fmt.Errorf("error getting payment %s: %w", checkingID, err)
+	}
+
+	return PayToStatus(checkingID, res.Get("pays.0")), nil
+}
+
+// Compile time check to ensure that Lightningd implements rp.FeeEstimator
+var _ rp.FeeEstimator = (*Lightningd)(nil)
+
+func (l *Lightningd) EstimatePaymentFee(params rp.FeeEstimateParams) (rp.FeeEstimate, error) {
+	dest := params.Destination
+	msatoshi := params.Msatoshi
+	if params.Invoice != "" {
+		inv, err := rp.DecodeBolt11(params.Invoice)
+		if err != nil {
+			return rp.FeeEstimate{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
+		}
+		dest = inv.Payee
+		if msatoshi == 0 {
+			msatoshi = inv.MSatoshi
+		}
+	}
+	if msatoshi == 0 {
+		return rp.FeeEstimate{}, fmt.Errorf("can't estimate fees without an amount")
+	}
+
+	res, err := l.call("getroute", map[string]interface{}{
+		"id":          dest,
+		"amount_msat": msatoshi,
+		"riskfactor":  10,
+	})
+	if err != nil {
+		return rp.FeeEstimate{}, fmt.Errorf("error calling getroute to %s: %w", dest, err)
+	}
+
+	hops := res.Get("route").Array()
+	if len(hops) == 0 {
+		return rp.FeeEstimate{}, fmt.Errorf("no route found to %s", dest)
+	}
+
+	// older lightningd versions only have msatoshi
+	first := msat(hops[0].Get("amount_msat"))
+	if !hops[0].Get("amount_msat").Exists() {
+		first = hops[0].Get("msatoshi").Int()
+	}
+
+	return rp.FeeEstimate{
+		FeeMsatoshi:   first - msatoshi,
+		TimeLockDelay: hops[0].Get("delay").Int(),
+	}, nil
+}
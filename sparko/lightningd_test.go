@@ -0,0 +1,109 @@
+package sparko
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/tidwall/gjson"
+)
+
+// fakeCaller answers commands with the json in results, and fails the others.
+type fakeCaller struct {
+	results map[string]string
+	calls   []string
+	args    []map[string]interface{}
+}
+
+func (f *fakeCaller) Call(ctx context.Context, method string, params map[string]interface{}) (gjson.Result, error) {
+	f.calls = append(f.calls, method)
+	f.args = append(f.args, params)
+	result, ok := f.results[method]
+	if !ok {
+		return gjson.Result{}, errors.New("Unknown command '" + method + "'")
+	}
+	return gjson.Parse(result), nil
+}
+
+func TestLightningd_CreateInvoice(t *testing.T) {
+	caller := &fakeCaller{results: map[string]string{
+		"invoice":                    `{"bolt11": "lnbc1"}`,
+		"invoicewithdescriptionhash": `{"bolt11": "lnbc2"}`,
+	}}
+	l := &Lightningd{Caller: caller, LabelPrefix: "shop"}
+
+	invoice, err := l.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, Description: "coffee"})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if invoice.Invoice != "lnbc1" || !strings.HasPrefix(invoice.CheckingID, "shop/") {
+		t.Errorf("got %v, wanted lnbc1 with a shop/ label", invoice)
+	}
+	if got := caller.args[0]["amount_msat"]; got != int64(1000) {
+		t.Errorf("got %v, wanted %v", got, 1000)
+	}
+
+	hash := sha256.Sum256([]byte("coffee"))
+	l.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, Description: "coffee", DescriptionHash: hash[:]})
+	if caller.calls[1] != "invoice" || caller.args[1]["deschashonly"] != true {
+		t.Errorf("got %s %v, wanted invoice with deschashonly", caller.calls[1], caller.args[1])
+	}
+
+	// without the description only the plugin can make it
+	l.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, DescriptionHash: hash[:], Label: "given"})
+	if caller.calls[2] != "invoicewithdescriptionhash" || caller.args[2]["label"] != "given" {
+		t.Errorf("got %s %v, wanted invoicewithdescriptionhash with the given label", caller.calls[2], caller.args[2])
+	}
+}
+
+func TestLightningd_CancelInvoice(t *testing.T) {
+	caller := &fakeCaller{results: map[string]string{
+		"delinvoice":   `{}`,
+		"listinvoices": `{"invoices": []}`,
+	}}
+	l := &Lightningd{Caller: caller}
+
+	if status, _ := l.GetInvoiceStatus("a"); status.Exists {
+		t.Errorf("got %v, wanted it not found", status)
+	}
+	if err := l.CancelInvoice("a"); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if status, _ := l.GetInvoiceStatus("a"); !status.Exists || !status.Canceled {
+		t.Errorf("got %v, wanted it canceled", status)
+	}
+}
+
+func TestLightningd_ListPeersFallback(t *testing.T) {
+	caller := &fakeCaller{results: map[string]string{
+		"listpeers": `{"peers": [{"id": "02aa", "connected": true, "channels": [
+			{"state": "CHANNELD_NORMAL", "short_channel_id": "1x2x3", "spendable_msat": "5000msat"}
+		]}]}`,
+	}}
+	l := &Lightningd{Caller: caller}
+
+	if got, _ := l.SpendableMsatoshi(); got != 5000 {
+		t.Errorf("got %v, wanted %v", got, 5000)
+	}
+	if caller.calls[0] != "listpeerchannels" || caller.calls[1] != "listpeers" {
+		t.Errorf("got %v, wanted listpeers after listpeerchannels failed", caller.calls)
+	}
+}
+
+func TestPayArgs(t *testing.T) {
+	if _, _, err := PayArgs(rp.PaymentParams{Invoice: "not an invoice"}); err == nil {
+		t.Errorf("got %v, wanted an error", err)
+	}
+
+	coffee := "lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srp"
+	args, checkingID, err := PayArgs(rp.PaymentParams{Invoice: coffee})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if checkingID != "0001020304050607080900010203040506070809000102030405060708090102" || args["bolt11"] != coffee {
+		t.Errorf("got %s %v, wanted the payment hash and the invoice", checkingID, args)
+	}
+}
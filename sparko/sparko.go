@@ -1,16 +1,14 @@
 package sparko
 
 import (
-	"crypto/rand"
-	"encoding/hex"
-	"fmt"
-	"strconv"
+	"context"
+	"io"
 	"strings"
 	"time"
 
 	lightning "github.com/fiatjaf/lightningd-gjson-rpc"
-	decodepay "github.com/fiatjaf/ln-decodepay"
 	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/proxy"
 	sse "github.com/r3labs/sse/v2"
 	"github.com/tidwall/gjson"
 )
@@ -21,14 +19,21 @@ type Params struct {
 	ConnectTimeout time.Duration
 
 	InvoiceLabelPrefix string // optional, defaults to 'relampago'
+
+	// optional, a socks5 proxy like tor's at 127.0.0.1:9050, only for http hosts
+	Proxy        string
+	IsolateProxy bool
 }
 
 type SparkoWallet struct {
 	Params
-	client *lightning.Client
+	*Lightningd
+
+	client    *lightning.Client
+	forwarder io.Closer // to the proxy, if any
 
-	invoiceStatusListeners []chan rp.InvoiceStatus
-	paymentStatusListeners []chan rp.PaymentStatus
+	invoices rp.InvoiceBroadcaster
+	payments rp.PaymentBroadcaster
 }
 
 func Start(params Params) (*SparkoWallet, error) {
@@ -39,31 +44,50 @@ func Start(params Params) (*SparkoWallet, error) {
 		params.Host = params.Host[0 : len(params.Host)-4]
 	}
 
+	host := params.Host
+	var forwarder io.Closer
+	if params.Proxy != "" {
+		dialer, err := proxy.SOCKS5(params.Proxy, params.IsolateProxy)
+		if err != nil {
+			return nil, err
+		}
+		host, forwarder, err = proxy.ForwardURL(dialer, params.Host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	spark := &lightning.Client{
-		SparkURL:    params.Host + "/rpc",
+		SparkURL:    host + "/rpc",
 		SparkToken:  params.Key,
 		CallTimeout: params.ConnectTimeout,
 	}
 
 	s := &SparkoWallet{
 		Params: params,
-		client: spark,
+		Lightningd: &Lightningd{
+			Caller:      caller{spark},
+			LabelPrefix: params.InvoiceLabelPrefix,
+		},
+		client:    spark,
+		forwarder: forwarder,
 	}
 
-	sseClient := sse.NewClient(params.Host + "/stream?access-key=" + params.Key)
+	sseClient := sse.NewClient(host + "/stream?access-key=" + params.Key)
 	go sseClient.Subscribe("", func(ev *sse.Event) {
 		data := gjson.ParseBytes(ev.Data)
 		switch string(ev.Event) {
 		case "sendpay_success":
 			success := data.Get("sendpay_success")
-			for _, listener := range s.paymentStatusListeners {
-				listener <- rp.PaymentStatus{
-					CheckingID: success.Get("payment_hash").String(),
-					Status:     rp.Complete,
-					FeePaid:    success.Get("msatoshi_sent").Int() - success.Get("msatoshi").Int(),
-					Preimage:   success.Get("payment_preimage").String(),
-				}
-			}
+			s.payments.Publish(rp.PaymentStatus{
+				CheckingID:  success.Get("payment_hash").String(),
+				Status:      rp.Complete,
+				FeePaid:     success.Get("msatoshi_sent").Int() - success.Get("msatoshi").Int(),
+				Preimage:    success.Get("payment_preimage").String(),
+				ResolvedAt:  unixTime(success.Get("completed_at")),
+				Destination: success.Get("destination").String(),
+				Msatoshi:    success.Get("msatoshi").Int(),
+			})
 		case "sendpay_failure":
 			hash := data.Get("sendpay_failure.data.payment_hash").String()
 			status, err := s.GetPaymentStatus(hash)
@@ -71,9 +95,7 @@ func Start(params Params) (*SparkoWallet, error) {
 				return
 			}
 
-			for _, listener := range s.paymentStatusListeners {
-				listener <- status
-			}
+			s.payments.Publish(status)
 		case "invoice_payment":
 			label := data.Get("invoice_payment.label").String()
 			status, err := s.GetInvoiceStatus(label)
@@ -81,9 +103,7 @@ func Start(params Params) (*SparkoWallet, error) {
 				return
 			}
 
-			for _, listener := range s.invoiceStatusListeners {
-				listener <- status
-			}
+			s.invoices.Publish(status)
 		}
 	})
 
@@ -93,100 +113,43 @@ func Start(params Params) (*SparkoWallet, error) {
 // Compile time check to ensure that SparkoWallet fully implements rp.Wallet
 var _ rp.Wallet = (*SparkoWallet)(nil)
 
+// Close stops forwarding connections through the proxy, when one is used.
+func (s *SparkoWallet) Close() error {
+	if s.forwarder == nil {
+		return nil
+	}
+	return s.forwarder.Close()
+}
+
 func (s *SparkoWallet) Kind() string {
 	return "sparko"
 }
 
-func (s *SparkoWallet) GetInfo() (rp.WalletInfo, error) {
-	res, err := s.client.Call("listfunds")
-	if err != nil {
-		return rp.WalletInfo{}, fmt.Errorf("error calling listfunds: %w", err)
-	}
-
-	var balance int64
-	for _, channel := range res.Get("channels").Array() {
-		balance += channel.Get("channel_sat").Int()
-	}
-
-	return rp.WalletInfo{balance}, nil
+// caller runs commands through sparko's /rpc endpoint.
+type caller struct {
+	client *lightning.Client
 }
 
-func (s *SparkoWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
-	var (
-		method string
-		args   = make(map[string]interface{})
-	)
-
-	args["msatoshi"] = params.Msatoshi
-	args["exposeprivatechannels"] = make([]struct{}, 0) // to suppress route hints
-
-	if params.DescriptionHash == nil {
-		method = "invoice"
-		args["description"] = params.Description
-	} else {
-		method = "invoicewithdescriptionhash"
-		args["description_hash"] = hex.EncodeToString(params.DescriptionHash)
-	}
-
-	labelPrefix := s.InvoiceLabelPrefix
-	if labelPrefix == "" {
-		labelPrefix = "relampago"
+func (c caller) Call(ctx context.Context, method string, params map[string]interface{}) (gjson.Result, error) {
+	args := []interface{}{}
+	if params != nil {
+		args = append(args, params)
 	}
-	args["label"] = labelPrefix + "/" + strconv.FormatInt(time.Now().Unix(), 16)
-
-	preimage := make([]byte, 32)
-	if _, err := rand.Read(preimage); err != nil {
-		return rp.InvoiceData{}, fmt.Errorf("failed to make random preimage: %w", err)
-	} else {
-		args["preimage"] = hex.EncodeToString(preimage)
-	}
-
-	if params.Expiry != nil {
-		args["expiry"] = params.Expiry.Seconds()
+	if deadline, ok := ctx.Deadline(); ok {
+		return c.client.CallWithCustomTimeout(time.Until(deadline), method, args...)
 	}
-
-	inv, err := s.client.Call(method, args)
-	if err != nil {
-		return rp.InvoiceData{}, fmt.Errorf("%s call failed: %w", method, err)
-	}
-	return rp.InvoiceData{
-		Invoice:    inv.Get("bolt11").String(),
-		Preimage:   args["preimage"].(string),
-		CheckingID: args["label"].(string),
-	}, nil
-}
-
-func (s *SparkoWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
-	res, err := s.client.Call("listinvoices", map[string]interface{}{"label": checkingID})
-	if err != nil {
-		return rp.InvoiceStatus{}, fmt.Errorf("error getting invoice label=%s: %w", checkingID, err)
-	}
-
-	return rp.InvoiceStatus{
-		CheckingID:       checkingID,
-		Exists:           res.Get("invoices.#").Int() == 1,
-		Paid:             res.Get("invoices.0.status").String() == "paid",
-		MSatoshiReceived: res.Get("invoices.0.msatoshi_received").Int(),
-	}, nil
+	return c.client.Call(method, args...)
 }
 
 func (s *SparkoWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
-	listener := make(chan rp.InvoiceStatus)
-	s.invoiceStatusListeners = append(s.invoiceStatusListeners, listener)
+	listener, _ := s.invoices.Subscribe()
 	return listener, nil
 }
 
 func (s *SparkoWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
-	inv, err := decodepay.Decodepay(params.Invoice)
+	args, checkingID, err := PayArgs(params)
 	if err != nil {
-		return rp.PaymentData{}, fmt.Errorf("failed to decode invoice '%s': %w", params.Invoice, err)
-	}
-
-	args := map[string]interface{}{
-		"bolt11": params.Invoice,
-	}
-	if params.CustomAmount != 0 {
-		args["msatoshi"] = params.CustomAmount
+		return rp.PaymentData{}, err
 	}
 	go func() {
 		// I think we need some time here just so the caller can update their DB with
@@ -196,41 +159,22 @@ func (s *SparkoWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, err
 	}()
 
 	return rp.PaymentData{
-		CheckingID: inv.PaymentHash,
+		CheckingID: checkingID,
 	}, nil
 }
 
-func (s *SparkoWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
-	res, err := s.client.Call("listpays", map[string]interface{}{
-		"payment_hash": checkingID,
-	})
-	if err != nil {
-		return rp.PaymentStatus{}, fmt.Errorf("error getting payment %s: %w", checkingID, err)
-	}
+func (s *SparkoWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	listener, _ := s.payments.Subscribe()
+	return listener, nil
+}
 
-	status := rp.PaymentStatus{CheckingID: checkingID}
-
-	switch res.Get("pays.0.status").String() {
-	case "complete":
-		status.Status = rp.Complete
-		needed, _ := strconv.ParseInt(res.Get("pays.0.amount_msat").String(), 10, 64)
-		sent, _ := strconv.ParseInt(res.Get("pays.0.amount_sent_msat").String(), 10, 64)
-		status.FeePaid = sent - needed
-		status.Preimage = res.Get("pays.0.preimage").String()
-	case "failed":
-		status.Status = rp.Failed
-	case "pending":
-		status.Status = rp.Pending
-	}
-	if res.Get("pays.#").Int() == 0 {
-		status.Status = rp.NeverTried
-	}
+// Compile time check to ensure that SparkoWallet implements rp.Subscriber
+var _ rp.Subscriber = (*SparkoWallet)(nil)
 
-	return status, nil
+func (s *SparkoWallet) SubscribePaidInvoices() (<-chan rp.InvoiceStatus, func()) {
+	return s.invoices.Subscribe()
 }
 
-func (s *SparkoWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
-	listener := make(chan rp.PaymentStatus)
-	s.paymentStatusListeners = append(s.paymentStatusListeners, listener)
-	return listener, nil
+func (s *SparkoWallet) SubscribePayments() (<-chan rp.PaymentStatus, func()) {
+	return s.payments.Subscribe()
 }
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/internal/sqldialect"
+)
+
+// SQLStore keeps invoices and payments in two tables on any database/sql
+// database, named after prefix. The driver must be registered by the caller,
+// both "sqlite" and "postgres" dialects are supported.
+type SQLStore struct {
+	db       *sql.DB
+	invoices string
+	payments string
+	dialect  string
+}
+
+func NewSQLStore(db *sql.DB, dialect string, prefix string) (*SQLStore, error) {
+	if err := sqldialect.Check(dialect); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		prefix = "relampago"
+	}
+
+	s := &SQLStore{
+		db:       db,
+		invoices: prefix + "_invoices",
+		payments: prefix + "_payments",
+		dialect:  dialect,
+	}
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS ` + s.invoices + ` (
+  checking_id TEXT PRIMARY KEY,
+  backend TEXT NOT NULL,
+  invoice TEXT NOT NULL,
+  preimage TEXT NOT NULL DEFAULT '',
+  msatoshi BIGINT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  description_hash TEXT NOT NULL DEFAULT '',
+  label TEXT NOT NULL DEFAULT '',
+  created_at BIGINT NOT NULL,
+  expires_at BIGINT NOT NULL,
+  paid BOOLEAN NOT NULL DEFAULT false,
+  canceled BOOLEAN NOT NULL DEFAULT false,
+  msatoshi_received BIGINT NOT NULL DEFAULT 0,
+  settled_at BIGINT NOT NULL DEFAULT 0,
+  moved_to TEXT NOT NULL DEFAULT ''
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table %s: %w", s.invoices, err)
+	}
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS ` + s.payments + ` (
+  checking_id TEXT PRIMARY KEY,
+  backend TEXT NOT NULL,
+  invoice TEXT NOT NULL,
+  msatoshi BIGINT NOT NULL,
+  destination TEXT NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  created_at BIGINT NOT NULL,
+  status TEXT NOT NULL,
+  fee_paid BIGINT NOT NULL DEFAULT 0,
+  preimage TEXT NOT NULL DEFAULT '',
+  resolved_at BIGINT NOT NULL DEFAULT 0,
+  needs_review BOOLEAN NOT NULL DEFAULT false
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table %s: %w", s.payments, err)
+	}
+	for _, table := range []string{s.invoices, s.payments} {
+		_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + table + `_backend_created ON ` +
+			table + ` (backend, created_at)`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create index on %s: %w", table, err)
+		}
+	}
+
+	return s, nil
+}
+
+const invoiceColumns = `checking_id, backend, invoice, preimage, msatoshi, description,
+description_hash, label, created_at, expires_at, paid, canceled, msatoshi_received, settled_at,
+moved_to`
+
+func (s *SQLStore) SaveInvoice(invoice Invoice) error {
+	_, err := s.db.Exec(s.rebind(`
+INSERT INTO `+s.invoices+` (`+invoiceColumns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (checking_id) DO UPDATE SET
+  backend = excluded.backend, invoice = excluded.invoice, preimage = excluded.preimage,
+  msatoshi = excluded.msatoshi, description = excluded.description,
+  description_hash = excluded.description_hash, label = excluded.label,
+  created_at = excluded.created_at, expires_at = excluded.expires_at,
+  paid = excluded.paid, canceled = excluded.canceled,
+  msatoshi_received = excluded.msatoshi_received, settled_at = excluded.settled_at,
+  moved_to = excluded.moved_to`),
+		invoice.CheckingID, invoice.Backend, invoice.Invoice, invoice.Preimage,
+		invoice.Msatoshi, invoice.Description, invoice.DescriptionHash, invoice.Label,
+		unixNano(invoice.CreatedAt), unixNano(invoice.ExpiresAt),
+		invoice.Paid, invoice.Canceled, invoice.MSatoshiReceived, unixNano(invoice.SettledAt),
+		invoice.MovedTo)
+	if err != nil {
+		return fmt.Errorf("failed to save invoice %s: %w", invoice.CheckingID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Invoice(checkingID string) (Invoice, bool, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT `+invoiceColumns+` FROM `+s.invoices+
+		` WHERE checking_id = ?`), checkingID)
+	if err != nil {
+		return Invoice{}, false, fmt.Errorf("failed to get invoice %s: %w", checkingID, err)
+	}
+	invoices, err := scanInvoices(rows)
+	if err != nil || len(invoices) == 0 {
+		return Invoice{}, false, err
+	}
+	return invoices[0], true, nil
+}
+
+func (s *SQLStore) Invoices(filter Filter) ([]Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM ` + s.invoices + ` WHERE 1 = 1`
+	var args []interface{}
+	if filter.Backend != "" {
+		query += ` AND backend = ?`
+		args = append(args, filter.Backend)
+	}
+	if filter.Open {
+		query += ` AND NOT paid AND NOT canceled AND moved_to = ''`
+	}
+	query += ` ORDER BY created_at`
+
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invoices: %w", err)
+	}
+	return scanInvoices(rows)
+}
+
+func scanInvoices(rows *sql.Rows) ([]Invoice, error) {
+	defer rows.Close()
+
+	var invoices []Invoice
+	for rows.Next() {
+		var invoice Invoice
+		var createdAt, expiresAt, settledAt int64
+		err := rows.Scan(&invoice.CheckingID, &invoice.Backend, &invoice.Invoice,
+			&invoice.Preimage, &invoice.Msatoshi, &invoice.Description,
+			&invoice.DescriptionHash, &invoice.Label, &createdAt, &expiresAt,
+			&invoice.Paid, &invoice.Canceled, &invoice.MSatoshiReceived, &settledAt,
+			&invoice.MovedTo)
+		if err != nil {
+			return nil, err
+		}
+		invoice.CreatedAt = fromUnixNano(createdAt)
+		invoice.ExpiresAt = fromUnixNano(expiresAt)
+		invoice.SettledAt = fromUnixNano(settledAt)
+		invoices = append(invoices, invoice)
+	}
+	return invoices, rows.Err()
+}
+
+const paymentColumns = `checking_id, backend, invoice, msatoshi, destination, description,
+created_at, status, fee_paid, preimage, resolved_at, needs_review`
+
+func (s *SQLStore) SavePayment(payment Payment) error {
+	_, err := s.db.Exec(s.rebind(`
+INSERT INTO `+s.payments+` (`+paymentColumns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (checking_id) DO UPDATE SET
+  backend = excluded.backend, invoice = excluded.invoice, msatoshi = excluded.msatoshi,
+  destination = excluded.destination, description = excluded.description,
+  created_at = excluded.created_at, status = excluded.status,
+  fee_paid = excluded.fee_paid, preimage = excluded.preimage,
+  resolved_at = excluded.resolved_at, needs_review = excluded.needs_review`),
+		payment.CheckingID, payment.Backend, payment.Invoice, payment.Msatoshi,
+		payment.Destination, payment.Description, unixNano(payment.CreatedAt),
+		string(payment.Status), payment.FeePaid, payment.Preimage, unixNano(payment.ResolvedAt),
+		payment.NeedsReview)
+	if err != nil {
+		return fmt.Errorf("failed to save payment %s: %w", payment.CheckingID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Payment(checkingID string) (Payment, bool, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT `+paymentColumns+` FROM `+s.payments+
+		` WHERE checking_id = ?`), checkingID)
+	if err != nil {
+		return Payment{}, false, fmt.Errorf("failed to get payment %s: %w", checkingID, err)
+	}
+	payments, err := scanPayments(rows)
+	if err != nil || len(payments) == 0 {
+		return Payment{}, false, err
+	}
+	return payments[0], true, nil
+}
+
+func (s *SQLStore) Payments(filter Filter) ([]Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM ` + s.payments + ` WHERE 1 = 1`
+	var args []interface{}
+	if filter.Backend != "" {
+		query += ` AND backend = ?`
+		args = append(args, filter.Backend)
+	}
+	if filter.Open {
+		query += ` AND status IN (?, ?)`
+		args = append(args, string(rp.Pending), string(rp.AwaitingApproval))
+	}
+	query += ` ORDER BY created_at`
+
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payments: %w", err)
+	}
+	return scanPayments(rows)
+}
+
+func scanPayments(rows *sql.Rows) ([]Payment, error) {
+	defer rows.Close()
+
+	var payments []Payment
+	for rows.Next() {
+		var payment Payment
+		var status string
+		var createdAt, resolvedAt int64
+		err := rows.Scan(&payment.CheckingID, &payment.Backend, &payment.Invoice,
+			&payment.Msatoshi, &payment.Destination, &payment.Description, &createdAt,
+			&status, &payment.FeePaid, &payment.Preimage, &resolvedAt, &payment.NeedsReview)
+		if err != nil {
+			return nil, err
+		}
+		payment.Status = rp.Status(status)
+		payment.CreatedAt = fromUnixNano(createdAt)
+		payment.ResolvedAt = fromUnixNano(resolvedAt)
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// zero times are stored as 0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+func (s *SQLStore) rebind(query string) string {
+	return sqldialect.Rebind(s.dialect, query)
+}
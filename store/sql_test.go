@@ -0,0 +1,162 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func testSQLStore(t *testing.T) *SQLStore {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s, err := NewSQLStore(db, "sqlite", "")
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	return s
+}
+
+func TestSQLStore_SaveInvoice(t *testing.T) {
+	s := testSQLStore(t)
+	createdAt := time.Date(2022, 1, 3, 12, 0, 0, 123456789, time.UTC)
+
+	invoice := Invoice{CheckingID: "a", Backend: "lnd", Invoice: "lnbc1", Msatoshi: 1000,
+		CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Hour)}
+	if err := s.SaveInvoice(invoice); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	invoice.Paid = true
+	invoice.MSatoshiReceived = 1000
+	invoice.SettledAt = createdAt.Add(time.Minute)
+	if err := s.SaveInvoice(invoice); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	got, ok, err := s.Invoice("a")
+	if err != nil || !ok {
+		t.Fatalf("got %v %v, wanted the invoice", ok, err)
+	}
+	if !got.Paid || got.MSatoshiReceived != 1000 {
+		t.Errorf("got %v, wanted it paid", got)
+	}
+	if !got.CreatedAt.Equal(invoice.CreatedAt) || !got.SettledAt.Equal(invoice.SettledAt) {
+		t.Errorf("got %s %s, wanted %s %s", got.CreatedAt, got.SettledAt,
+			invoice.CreatedAt, invoice.SettledAt)
+	}
+
+	if _, ok, _ := s.Invoice("b"); ok {
+		t.Errorf("got %v, wanted %v", ok, false)
+	}
+}
+
+func TestSQLStore_Invoices(t *testing.T) {
+	s := testSQLStore(t)
+	now := time.Now()
+
+	for _, invoice := range []Invoice{
+		{CheckingID: "paid", Backend: "lnd", Paid: true, CreatedAt: now},
+		{CheckingID: "open", Backend: "lnd", CreatedAt: now.Add(time.Second)},
+		{CheckingID: "moved", Backend: "lnd", MovedTo: "other", CreatedAt: now.Add(2 * time.Second)},
+		{CheckingID: "other", Backend: "sparko", CreatedAt: now.Add(3 * time.Second)},
+	} {
+		if err := s.SaveInvoice(invoice); err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+	}
+
+	for _, tc := range []struct {
+		filter Filter
+		want   []string
+	}{
+		{Filter{}, []string{"paid", "open", "moved", "other"}},
+		{Filter{Backend: "lnd"}, []string{"paid", "open", "moved"}},
+		{Filter{Open: true}, []string{"open", "other"}},
+		{Filter{Backend: "lnd", Open: true}, []string{"open"}},
+	} {
+		invoices, err := s.Invoices(tc.filter)
+		if err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+		var got []string
+		for _, invoice := range invoices {
+			got = append(got, invoice.CheckingID)
+		}
+		if !equal(got, tc.want) {
+			t.Errorf("got %v, wanted %v for %+v", got, tc.want, tc.filter)
+		}
+	}
+}
+
+func TestSQLStore_Payments(t *testing.T) {
+	s := testSQLStore(t)
+	now := time.Now()
+
+	for _, payment := range []Payment{
+		{CheckingID: "pending", Backend: "lnd", Status: rp.Pending, CreatedAt: now},
+		{CheckingID: "approval", Backend: "lnd", Status: rp.AwaitingApproval, CreatedAt: now.Add(time.Second)},
+		{CheckingID: "failed", Backend: "sparko", Status: rp.Failed, CreatedAt: now.Add(2 * time.Second)},
+	} {
+		if err := s.SavePayment(payment); err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+	}
+
+	// resolving a payment replaces it
+	resolvedAt := now.Add(time.Minute)
+	err := s.SavePayment(Payment{CheckingID: "pending", Backend: "lnd", Status: rp.Complete,
+		FeePaid: 3, Preimage: "00", CreatedAt: now, ResolvedAt: resolvedAt})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	got, ok, err := s.Payment("pending")
+	if err != nil || !ok {
+		t.Fatalf("got %v %v, wanted the payment", ok, err)
+	}
+	if got.Status != rp.Complete || got.FeePaid != 3 || !got.ResolvedAt.Equal(resolvedAt) {
+		t.Errorf("got %v, wanted it complete at %s", got, resolvedAt)
+	}
+	if !got.CreatedAt.Equal(now) {
+		t.Errorf("got %s, wanted %s", got.CreatedAt, now)
+	}
+
+	for _, tc := range []struct {
+		filter Filter
+		want   []string
+	}{
+		{Filter{}, []string{"pending", "approval", "failed"}},
+		{Filter{Backend: "sparko"}, []string{"failed"}},
+		{Filter{Open: true}, []string{"approval"}},
+	} {
+		payments, err := s.Payments(tc.filter)
+		if err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+		var got []string
+		for _, payment := range payments {
+			got = append(got, payment.CheckingID)
+		}
+		if !equal(got, tc.want) {
+			t.Errorf("got %v, wanted %v for %+v", got, tc.want, tc.filter)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
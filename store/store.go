@@ -0,0 +1,419 @@
+package store
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Invoice is what is kept of an invoice created through StoreWallet, enough
+// to create it again on another backend.
+type Invoice struct {
+	CheckingID      string    `json:"checkingID"`
+	Backend         string    `json:"backend"` // the wallet Kind
+	Invoice         string    `json:"invoice"`
+	Preimage        string    `json:"preimage,omitempty"`
+	Msatoshi        int64     `json:"msatoshi"`
+	Description     string    `json:"description,omitempty"`
+	DescriptionHash string    `json:"descriptionHash,omitempty"`
+	Label           string    `json:"label,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+
+	Paid             bool      `json:"paid"`
+	Canceled         bool      `json:"canceled,omitempty"`
+	MSatoshiReceived int64     `json:"msatoshiReceived"`
+	SettledAt        time.Time `json:"settledAt"`
+
+	// MovedTo is the CheckingID of the invoice created in its place on
+	// another backend, see the migrate package.
+	MovedTo string `json:"movedTo,omitempty"`
+}
+
+// Open is true for invoices that can still be paid.
+func (i Invoice) Open(now time.Time) bool {
+	return !i.Paid && !i.Canceled && i.MovedTo == "" &&
+		(i.ExpiresAt.IsZero() || now.Before(i.ExpiresAt))
+}
+
+type Payment struct {
+	CheckingID  string    `json:"checkingID"`
+	Backend     string    `json:"backend"`
+	Invoice     string    `json:"invoice"`
+	Msatoshi    int64     `json:"msatoshi"`
+	Destination string    `json:"destination,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	Status     rp.Status `json:"status"`
+	FeePaid    int64     `json:"feePaid"`
+	Preimage   string    `json:"preimage,omitempty"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+
+	// NeedsReview marks payments that were still pending when their backend
+	// was replaced, so someone has to check how they ended.
+	NeedsReview bool `json:"needsReview,omitempty"`
+}
+
+// Filter selects records by backend and state, zero values match everything.
+type Filter struct {
+	Backend string
+
+	// Open only matches unpaid invoices that weren't moved, expired ones
+	// included, and pending payments or awaiting approval.
+	Open bool
+}
+
+type Store interface {
+	// SaveInvoice inserts the invoice or replaces the one with the same
+	// CheckingID, likewise for SavePayment.
+	SaveInvoice(Invoice) error
+	Invoice(checkingID string) (Invoice, bool, error)
+	Invoices(Filter) ([]Invoice, error)
+
+	SavePayment(Payment) error
+	Payment(checkingID string) (Payment, bool, error)
+	Payments(Filter) ([]Payment, error)
+}
+
+type Params struct {
+	Wallet rp.Wallet
+	Store  Store
+}
+
+// StoreWallet wraps another wallet and mirrors every invoice and payment made
+// through it to the store, keeping their statuses updated from the lookups
+// and the streams. The history survives the backend being replaced and can
+// be checked against it with Reconcile.
+type StoreWallet struct {
+	rp.Wallet
+	store Store
+	now   func() time.Time
+
+	mu sync.Mutex // serializes the read-modify-write of records
+}
+
+func Start(params Params) (*StoreWallet, error) {
+	if params.Store == nil {
+		params.Store = NewMemoryStore()
+	}
+
+	invoices, err := params.Wallet.PaidInvoicesStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to invoices: %w", err)
+	}
+	payments, err := params.Wallet.PaymentsStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+	}
+
+	s := &StoreWallet{
+		Wallet: params.Wallet,
+		store:  params.Store,
+		now:    time.Now,
+	}
+
+	go func() {
+		for status := range invoices {
+			s.updateInvoice(status)
+		}
+	}()
+	go func() {
+		for status := range payments {
+			s.updatePayment(status)
+		}
+	}()
+
+	return s, nil
+}
+
+// Compile time check to ensure that StoreWallet fully implements rp.Wallet
+var _ rp.Wallet = (*StoreWallet)(nil)
+
+// Store is where the invoices and payments are kept, for queries.
+func (s *StoreWallet) Store() Store {
+	return s.store
+}
+
+func (s *StoreWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	data, err := s.Wallet.CreateInvoice(params)
+	if err != nil {
+		return data, err
+	}
+
+	invoice := Invoice{
+		CheckingID:      data.CheckingID,
+		Backend:         s.Wallet.Kind(),
+		Invoice:         data.Invoice,
+		Preimage:        data.Preimage,
+		Msatoshi:        params.Msatoshi,
+		Description:     params.Description,
+		DescriptionHash: hex.EncodeToString(params.DescriptionHash),
+		Label:           params.Label,
+		CreatedAt:       s.now(),
+	}
+	if inv, err := rp.DecodeBolt11(data.Invoice); err == nil {
+		invoice.ExpiresAt = inv.CreatedAt.Add(inv.Expiry)
+	} else if params.Expiry != nil {
+		invoice.ExpiresAt = invoice.CreatedAt.Add(*params.Expiry)
+	}
+
+	// the invoice exists anyway, so failing to save it isn't an error
+	s.store.SaveInvoice(invoice)
+	return data, nil
+}
+
+func (s *StoreWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	status, err := s.Wallet.GetInvoiceStatus(checkingID)
+	if err == nil {
+		s.updateInvoice(status)
+	}
+	return status, err
+}
+
+func (s *StoreWallet) CancelInvoice(checkingID string) error {
+	if err := s.Wallet.CancelInvoice(checkingID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if invoice, ok, err := s.store.Invoice(checkingID); err == nil && ok {
+		invoice.Canceled = true
+		s.store.SaveInvoice(invoice)
+	}
+	return nil
+}
+
+func (s *StoreWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	data, err := s.Wallet.MakePayment(params)
+	if err != nil {
+		return data, err
+	}
+
+	payment := Payment{
+		CheckingID: data.CheckingID,
+		Backend:    s.Wallet.Kind(),
+		Invoice:    params.Invoice,
+		Msatoshi:   params.CustomAmount,
+		CreatedAt:  s.now(),
+		Status:     rp.Pending,
+	}
+	if inv, err := rp.DecodeBolt11(params.Invoice); err == nil {
+		payment.Destination = inv.Payee
+		payment.Description = inv.Description
+		if payment.Msatoshi == 0 {
+			payment.Msatoshi = inv.MSatoshi
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok, err := s.store.Payment(data.CheckingID); err == nil && ok && existing.Status != rp.Pending {
+		// a stream event got here first
+		payment.Status = existing.Status
+		payment.FeePaid = existing.FeePaid
+		payment.Preimage = existing.Preimage
+		payment.ResolvedAt = existing.ResolvedAt
+	}
+
+	s.store.SavePayment(payment)
+	return data, nil
+}
+
+func (s *StoreWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	status, err := s.Wallet.GetPaymentStatus(checkingID)
+	if err == nil {
+		s.updatePayment(status)
+	}
+	return status, err
+}
+
+// updateInvoice only updates invoices that were created through this wallet.
+func (s *StoreWallet) updateInvoice(status rp.InvoiceStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoice, ok, err := s.store.Invoice(status.CheckingID)
+	if err != nil || !ok {
+		return err
+	}
+
+	invoice.Paid = status.Paid && !status.Held
+	invoice.Canceled = invoice.Canceled || status.Canceled
+	invoice.MSatoshiReceived = status.MSatoshiReceived
+	invoice.SettledAt = status.SettledAt
+	return s.store.SaveInvoice(invoice)
+}
+
+// updatePayment saves the status even for payments it doesn't know yet, as
+// their stream events can arrive before MakePayment returns.
+func (s *StoreWallet) updatePayment(status rp.PaymentStatus) error {
+	if status.Status == rp.Unknown {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok, err := s.store.Payment(status.CheckingID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		payment = Payment{
+			CheckingID:  status.CheckingID,
+			Backend:     s.Wallet.Kind(),
+			Msatoshi:    status.Msatoshi,
+			Destination: status.Destination,
+			Description: status.Description,
+			CreatedAt:   s.now(),
+		}
+	}
+	payment.Status = status.Status
+	payment.FeePaid = status.FeePaid
+	payment.Preimage = status.Preimage
+	payment.ResolvedAt = status.ResolvedAt
+	return s.store.SavePayment(payment)
+}
+
+// Report says what Reconcile found.
+type Report struct {
+	// Updated are the checking ids of the records whose status changed.
+	Updated []string `json:"updated"`
+
+	// Missing are the checking ids of the records the backend didn't know.
+	Missing []string `json:"missing"`
+}
+
+// Reconcile looks up every open invoice and pending payment made on this
+// backend and updates the store with what the backend says.
+func (s *StoreWallet) Reconcile() (Report, error) {
+	var report Report
+	filter := Filter{Backend: s.Wallet.Kind(), Open: true}
+
+	invoices, err := s.store.Invoices(filter)
+	if err != nil {
+		return report, fmt.Errorf("failed to list invoices: %w", err)
+	}
+	for _, invoice := range invoices {
+		status, err := s.Wallet.GetInvoiceStatus(invoice.CheckingID)
+		if errors.Is(err, rp.ErrNotFound) || (err == nil && !status.Exists) {
+			report.Missing = append(report.Missing, invoice.CheckingID)
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to get invoice %s: %w", invoice.CheckingID, err)
+		}
+		if status.Paid != invoice.Paid || status.Canceled != invoice.Canceled {
+			report.Updated = append(report.Updated, invoice.CheckingID)
+		}
+		s.updateInvoice(status)
+	}
+
+	payments, err := s.store.Payments(filter)
+	if err != nil {
+		return report, fmt.Errorf("failed to list payments: %w", err)
+	}
+	for _, payment := range payments {
+		status, err := s.Wallet.GetPaymentStatus(payment.CheckingID)
+		if err != nil {
+			return report, fmt.Errorf("failed to get payment %s: %w", payment.CheckingID, err)
+		}
+		if status.Status == rp.NeverTried {
+			report.Missing = append(report.Missing, payment.CheckingID)
+			continue
+		}
+		if status.Status != payment.Status {
+			report.Updated = append(report.Updated, payment.CheckingID)
+		}
+		s.updatePayment(status)
+	}
+
+	return report, nil
+}
+
+type MemoryStore struct {
+	mu       sync.Mutex
+	invoices map[string]Invoice
+	payments map[string]Payment
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		invoices: make(map[string]Invoice),
+		payments: make(map[string]Payment),
+	}
+}
+
+func (m *MemoryStore) SaveInvoice(invoice Invoice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.invoices[invoice.CheckingID] = invoice
+	return nil
+}
+
+func (m *MemoryStore) Invoice(checkingID string) (Invoice, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	invoice, ok := m.invoices[checkingID]
+	return invoice, ok, nil
+}
+
+// Invoices are returned oldest first, likewise for Payments.
+func (m *MemoryStore) Invoices(filter Filter) ([]Invoice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var invoices []Invoice
+	for _, invoice := range m.invoices {
+		if filter.Backend != "" && invoice.Backend != filter.Backend {
+			continue
+		}
+		if filter.Open && (invoice.Paid || invoice.Canceled || invoice.MovedTo != "") {
+			continue
+		}
+		invoices = append(invoices, invoice)
+	}
+	sort.Slice(invoices, func(i, j int) bool {
+		return invoices[i].CreatedAt.Before(invoices[j].CreatedAt)
+	})
+	return invoices, nil
+}
+
+func (m *MemoryStore) SavePayment(payment Payment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.payments[payment.CheckingID] = payment
+	return nil
+}
+
+func (m *MemoryStore) Payment(checkingID string) (Payment, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment, ok := m.payments[checkingID]
+	return payment, ok, nil
+}
+
+func (m *MemoryStore) Payments(filter Filter) ([]Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var payments []Payment
+	for _, payment := range m.payments {
+		if filter.Backend != "" && payment.Backend != filter.Backend {
+			continue
+		}
+		if filter.Open && payment.Status != rp.Pending && payment.Status != rp.AwaitingApproval {
+			continue
+		}
+		payments = append(payments, payment)
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].CreatedAt.Before(payments[j].CreatedAt)
+	})
+	return payments, nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+func TestMirror(t *testing.T) {
+	// stream events are held, so Reconcile is what finds the settlements
+	backend, _ := testwallet.Start(testwallet.Params{Scenario: testwallet.StatusFirst})
+	s, err := Start(Params{Wallet: backend})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	inv, err := s.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, Description: "coffee", Label: "order-1"})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	saved, ok, _ := s.Store().Invoice(inv.CheckingID)
+	if !ok || saved.Backend != "test" || saved.Msatoshi != 1000 || saved.Label != "order-1" || saved.Paid {
+		t.Errorf("got %v, wanted the unpaid invoice saved", saved)
+	}
+
+	payment, _ := s.MakePayment(rp.PaymentParams{Invoice: "lntest", CustomAmount: 500})
+	if saved, ok, _ := s.Store().Payment(payment.CheckingID); !ok || saved.Status != rp.Pending {
+		t.Errorf("got %v, wanted the pending payment saved", saved)
+	}
+
+	backend.SettleInvoice(inv.CheckingID, 1000)
+	backend.CompletePayment(payment.CheckingID, "00", 1)
+	report, err := s.Reconcile()
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if len(report.Updated) != 2 || len(report.Missing) != 0 {
+		t.Errorf("got %v, wanted both records updated", report)
+	}
+	if saved, _, _ := s.Store().Invoice(inv.CheckingID); !saved.Paid || saved.MSatoshiReceived != 1000 {
+		t.Errorf("got %v, wanted the invoice paid", saved)
+	}
+	if saved, _, _ := s.Store().Payment(payment.CheckingID); saved.Status != rp.Complete || saved.FeePaid != 1 {
+		t.Errorf("got %v, wanted the payment complete", saved)
+	}
+
+	open, _ := s.Store().Invoices(Filter{Open: true})
+	if len(open) != 0 {
+		t.Errorf("got %v, wanted no open invoices", open)
+	}
+}
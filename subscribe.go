@@ -0,0 +1,102 @@
+package relampago
+
+import "context"
+
+// SubscribePaidInvoices subscribes to the wallet paid invoices until the
+// returned func is called or ctx is done, and the channel is closed then.
+// Wallets that aren't Subscribers can't drop the listener, so their updates
+// keep being read and discarded.
+func SubscribePaidInvoices(ctx context.Context, wallet Wallet) (<-chan InvoiceStatus, func(), error) {
+	if subscriber, ok := wallet.(Subscriber); ok {
+		stream, unsubscribe := subscriber.SubscribePaidInvoices()
+		ctx, cancel := context.WithCancel(ctx)
+		go func() {
+			<-ctx.Done()
+			unsubscribe()
+		}()
+		return stream, cancel, nil
+	}
+
+	inner, err := wallet.PaidInvoicesStream()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	listener := make(chan InvoiceStatus)
+	go func() {
+		defer close(listener)
+		for {
+			select {
+			case status, ok := <-inner:
+				if !ok {
+					return
+				}
+				select {
+				case listener <- status:
+				case <-ctx.Done():
+					go drainInvoices(inner)
+					return
+				}
+			case <-ctx.Done():
+				go drainInvoices(inner)
+				return
+			}
+		}
+	}()
+
+	return listener, cancel, nil
+}
+
+// SubscribePayments is like SubscribePaidInvoices for payment updates.
+func SubscribePayments(ctx context.Context, wallet Wallet) (<-chan PaymentStatus, func(), error) {
+	if subscriber, ok := wallet.(Subscriber); ok {
+		stream, unsubscribe := subscriber.SubscribePayments()
+		ctx, cancel := context.WithCancel(ctx)
+		go func() {
+			<-ctx.Done()
+			unsubscribe()
+		}()
+		return stream, cancel, nil
+	}
+
+	inner, err := wallet.PaymentsStream()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	listener := make(chan PaymentStatus)
+	go func() {
+		defer close(listener)
+		for {
+			select {
+			case status, ok := <-inner:
+				if !ok {
+					return
+				}
+				select {
+				case listener <- status:
+				case <-ctx.Done():
+					go drainPayments(inner)
+					return
+				}
+			case <-ctx.Done():
+				go drainPayments(inner)
+				return
+			}
+		}
+	}()
+
+	return listener, cancel, nil
+}
+
+func drainInvoices(stream <-chan InvoiceStatus) {
+	for range stream {
+	}
+}
+
+func drainPayments(stream <-chan PaymentStatus) {
+	for range stream {
+	}
+}
@@ -0,0 +1,85 @@
+package relampago_test
+
+import (
+	"context"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+	"github.com/lnbits/relampago/void"
+)
+
+func TestSubscribePaidInvoices(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	for _, wallet := range []rp.Wallet{tw, void.VoidWallet{}} {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, unsubscribe, err := rp.SubscribePaidInvoices(ctx, wallet)
+		if err != nil {
+			t.Fatalf("got %v, wanted %v", err, nil)
+		}
+
+		cancel()
+		if _, ok := <-stream; ok {
+			t.Errorf("%s: got an update, wanted the stream closed", wallet.Kind())
+		}
+		unsubscribe() // after the context is done it's a no-op
+	}
+}
+
+func TestEvents(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := rp.Events(ctx, tw)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	invoice, _ := tw.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+	if err := tw.SettleInvoice(invoice.CheckingID, 1000); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	event := <-events
+	if event.Type != rp.InvoiceSettled {
+		t.Errorf("got %s, wanted %s", event.Type, rp.InvoiceSettled)
+	}
+	if event.Invoice == nil || event.Invoice.CheckingID != invoice.CheckingID {
+		t.Errorf("got %v, wanted invoice %s", event.Invoice, invoice.CheckingID)
+	}
+}
+
+type eventWallet struct {
+	*testwallet.TestWallet
+	events rp.EventBroadcaster
+}
+
+func (w *eventWallet) Events(ctx context.Context) (<-chan rp.Event, error) {
+	listener, unsubscribe := w.events.Subscribe()
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+	return listener, nil
+}
+
+func TestEvents_Source(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	wallet := &eventWallet{TestWallet: tw}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, err := rp.Events(ctx, wallet)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	wallet.events.Publish(rp.Event{Type: rp.PeerOnline})
+	if event := <-events; event.Type != rp.PeerOnline {
+		t.Errorf("got %s, wanted %s", event.Type, rp.PeerOnline)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Errorf("got an event, wanted the stream closed")
+	}
+}
@@ -0,0 +1,44 @@
+package relampago
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SyncPollInterval is how often WaitForSync asks the backend if it is synced.
+var SyncPollInterval = 5 * time.Second
+
+// WaitForSync blocks until the backend is synced to the chain and the graph,
+// as creating invoices or paying before that fails in confusing ways. Errors
+// reaching the backend are retried, as it may still be starting. When ctx is
+// done first its error is returned along with what the backend last said.
+func WaitForSync(ctx context.Context, wallet Wallet) error {
+	ticker := time.NewTicker(SyncPollInterval)
+	defer ticker.Stop()
+
+	for {
+		health, err := wallet.Health(ctx)
+		if err == nil && health.SyncedToChain && health.SyncedToGraph {
+			return nil
+		}
+
+		var last string
+		switch {
+		case err != nil:
+			last = err.Error()
+		case health.Detail != "":
+			last = health.Detail
+		case !health.SyncedToChain:
+			last = "not synced to the chain"
+		default:
+			last = "not synced to the graph"
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%s is %s: %w", wallet.Kind(), last, ctx.Err())
+		}
+	}
+}
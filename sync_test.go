@@ -0,0 +1,44 @@
+package relampago_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+type syncingWallet struct {
+	void.VoidWallet
+	checks int
+}
+
+func (w *syncingWallet) Health(context.Context) (rp.HealthStatus, error) {
+	w.checks++
+	if w.checks < 3 {
+		return rp.HealthStatus{Connected: true, SyncedToChain: true}, nil
+	}
+	return rp.HealthStatus{Connected: true, SyncedToChain: true, SyncedToGraph: true}, nil
+}
+
+func TestWaitForSync(t *testing.T) {
+	rp.SyncPollInterval = time.Millisecond
+	defer func() { rp.SyncPollInterval = 5 * time.Second }()
+
+	wallet := &syncingWallet{}
+	if err := rp.WaitForSync(context.Background(), wallet); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if wallet.checks != 3 {
+		t.Errorf("got %d checks, wanted %d", wallet.checks, 3)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	wallet = &syncingWallet{checks: -1000000}
+	if err := rp.WaitForSync(ctx, wallet); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, wanted %v", err, context.DeadlineExceeded)
+	}
+}
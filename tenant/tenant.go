@@ -0,0 +1,154 @@
+package tenant
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	rp "github.com/lnbits/relampago"
+)
+
+var ErrConflict = errors.New("already used by another tenant")
+
+// Policy is what happens when a tenant uses an order id or payment hash
+// already used by another tenant.
+type Policy int
+
+const (
+	// Reject refuses to create the invoice.
+	Reject Policy = iota
+
+	// Flag creates the invoice anyway and reports the conflict to OnConflict.
+	Flag
+)
+
+// Conflict describes an order id or payment hash used by two tenants.
+type Conflict struct {
+	Kind   string // "order id" or "payment hash"
+	Value  string
+	Tenant string // the tenant trying to use it now
+	Owner  string // the tenant that used it first
+}
+
+func (c Conflict) Error() string {
+	return fmt.Sprintf("%s %s of tenant %s was already used by tenant %s",
+		c.Kind, c.Value, c.Tenant, c.Owner)
+}
+
+func (c Conflict) Unwrap() error {
+	return ErrConflict
+}
+
+type Params struct {
+	// Wallet is shared by all tenants.
+	Wallet rp.Wallet
+
+	Policy     Policy
+	OnConflict func(Conflict) // optional, called on every conflict
+}
+
+// Manager creates invoices on a shared wallet for many tenants, like the
+// sellers on a marketplace, and remembers which tenant each invoice belongs
+// to so a settlement is never credited to the wrong one.
+//
+// Payment hashes generated by the backend are random, so only those given by
+// the caller, through a preimage or a hold invoice hash, can collide.
+type Manager struct {
+	Params
+
+	mu       sync.Mutex
+	orderIDs map[string]string // order id -> tenant
+	hashes   map[string]string // payment hash -> tenant
+	invoices map[string]string // checking id -> tenant
+}
+
+func Start(params Params) (*Manager, error) {
+	if params.Wallet == nil {
+		return nil, errors.New("a wallet is required")
+	}
+
+	return &Manager{
+		Params:   params,
+		orderIDs: make(map[string]string),
+		hashes:   make(map[string]string),
+		invoices: make(map[string]string),
+	}, nil
+}
+
+// CreateInvoice creates an invoice for tenant. orderID is the tenant's own
+// reference for it and is optional. A tenant reusing its own order id, like
+// when retrying, is not a conflict.
+func (m *Manager) CreateInvoice(tenant, orderID string, params rp.InvoiceParams) (rp.InvoiceData, error) {
+	var hash string
+	if params.PaymentHash != nil {
+		hash = hex.EncodeToString(params.PaymentHash)
+	} else if params.Preimage != nil {
+		sum := sha256.Sum256(params.Preimage)
+		hash = hex.EncodeToString(sum[:])
+	}
+
+	m.mu.Lock()
+	var conflicts []Conflict
+	if owner, ok := m.orderIDs[orderID]; ok && orderID != "" && owner != tenant {
+		conflicts = append(conflicts, Conflict{"order id", orderID, tenant, owner})
+	}
+	if owner, ok := m.hashes[hash]; ok && hash != "" && owner != tenant {
+		conflicts = append(conflicts, Conflict{"payment hash", hash, tenant, owner})
+	}
+	if len(conflicts) > 0 && m.Policy == Reject {
+		m.mu.Unlock()
+		m.report(conflicts)
+		return rp.InvoiceData{}, conflicts[0]
+	}
+	// claim them now so a concurrent call from another tenant sees them
+	var claimedOrderID, claimedHash bool
+	if _, ok := m.orderIDs[orderID]; !ok && orderID != "" {
+		m.orderIDs[orderID] = tenant
+		claimedOrderID = true
+	}
+	if _, ok := m.hashes[hash]; !ok && hash != "" {
+		m.hashes[hash] = tenant
+		claimedHash = true
+	}
+	m.mu.Unlock()
+	m.report(conflicts)
+
+	data, err := m.Wallet.CreateInvoice(params)
+	if err != nil {
+		// no invoice was made, so they're free for any tenant again
+		m.mu.Lock()
+		if claimedOrderID {
+			delete(m.orderIDs, orderID)
+		}
+		if claimedHash {
+			delete(m.hashes, hash)
+		}
+		m.mu.Unlock()
+		return data, err
+	}
+
+	m.mu.Lock()
+	m.invoices[data.CheckingID] = tenant
+	m.mu.Unlock()
+
+	return data, nil
+}
+
+func (m *Manager) report(conflicts []Conflict) {
+	if m.OnConflict == nil {
+		return
+	}
+	for _, conflict := range conflicts {
+		m.OnConflict(conflict)
+	}
+}
+
+// TenantOf tells which tenant created the invoice with the given checking id.
+func (m *Manager) TenantOf(checkingID string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenant, ok := m.invoices[checkingID]
+	return tenant, ok
+}
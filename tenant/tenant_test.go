@@ -0,0 +1,94 @@
+package tenant
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+type countingWallet struct {
+	void.VoidWallet
+	n   int
+	err error
+}
+
+func (w *countingWallet) CreateInvoice(rp.InvoiceParams) (rp.InvoiceData, error) {
+	if w.err != nil {
+		return rp.InvoiceData{}, w.err
+	}
+	w.n++
+	return rp.InvoiceData{CheckingID: strconv.Itoa(w.n)}, nil
+}
+
+func TestConflicts(t *testing.T) {
+	m, _ := Start(Params{Wallet: &countingWallet{}})
+	preimage := bytes.Repeat([]byte{1}, 32)
+
+	data, err := m.CreateInvoice("alice", "order-1", rp.InvoiceParams{Preimage: preimage})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if tenant, _ := m.TenantOf(data.CheckingID); tenant != "alice" {
+		t.Errorf("got %v, wanted %v", tenant, "alice")
+	}
+
+	// retrying is fine
+	if _, err := m.CreateInvoice("alice", "order-1", rp.InvoiceParams{Preimage: preimage}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+
+	var conflict Conflict
+	_, err = m.CreateInvoice("bob", "order-1", rp.InvoiceParams{})
+	if !errors.Is(err, ErrConflict) || !errors.As(err, &conflict) || conflict.Owner != "alice" {
+		t.Errorf("got %v, wanted an order id conflict with alice", err)
+	}
+	_, err = m.CreateInvoice("bob", "order-2", rp.InvoiceParams{Preimage: preimage})
+	if !errors.As(err, &conflict) || conflict.Kind != "payment hash" {
+		t.Errorf("got %v, wanted a payment hash conflict", err)
+	}
+	if _, err := m.CreateInvoice("bob", "order-2", rp.InvoiceParams{}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+}
+
+func TestConflicts_FailedCreate(t *testing.T) {
+	wallet := &countingWallet{err: rp.ErrBackendUnavailable}
+	m, _ := Start(Params{Wallet: wallet})
+	preimage := bytes.Repeat([]byte{1}, 32)
+
+	_, err := m.CreateInvoice("alice", "order-1", rp.InvoiceParams{Preimage: preimage})
+	if !errors.Is(err, rp.ErrBackendUnavailable) {
+		t.Fatalf("got %v, wanted %v", err, rp.ErrBackendUnavailable)
+	}
+
+	// nothing was created, so nothing is alice's
+	wallet.err = nil
+	if _, err := m.CreateInvoice("bob", "order-1", rp.InvoiceParams{Preimage: preimage}); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+}
+
+func TestFlag(t *testing.T) {
+	var flagged []Conflict
+	m, _ := Start(Params{
+		Wallet:     &countingWallet{},
+		Policy:     Flag,
+		OnConflict: func(c Conflict) { flagged = append(flagged, c) },
+	})
+
+	m.CreateInvoice("alice", "order-1", rp.InvoiceParams{})
+	data, err := m.CreateInvoice("bob", "order-1", rp.InvoiceParams{})
+	if err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+	if tenant, _ := m.TenantOf(data.CheckingID); tenant != "bob" {
+		t.Errorf("got %v, wanted %v", tenant, "bob")
+	}
+	if len(flagged) != 1 || flagged[0].Tenant != "bob" {
+		t.Errorf("got %v, wanted one conflict for bob", flagged)
+	}
+}
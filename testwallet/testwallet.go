@@ -0,0 +1,371 @@
+// Package testwallet is an in-memory wallet for testing applications, able to
+// reproduce the races between statuses and stream events that happen with
+// real backends.
+package testwallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Scenario is the order in which a settlement shows up in statuses and in the
+// streams.
+type Scenario int
+
+const (
+	// InOrder updates the status and then sends the stream event.
+	InOrder Scenario = iota
+
+	// StreamFirst sends the stream event while GetInvoiceStatus and
+	// GetPaymentStatus still say the invoice or payment is pending.
+	StreamFirst
+
+	// StatusFirst updates the status but only sends the stream event later.
+	StatusFirst
+)
+
+type Params struct {
+	Scenario Scenario
+
+	// Lag is how long the side that is behind takes to catch up. When zero it
+	// only catches up when Release is called, for deterministic tests.
+	Lag time.Duration
+}
+
+type TestWallet struct {
+	Params
+
+	mu       sync.Mutex
+	invoices map[string]*rp.InvoiceStatus
+	issued   map[string]issued // what is needed to pay our own invoices
+	payments map[string]*rp.PaymentStatus
+	held     []func()
+
+	invoiceUpdates rp.InvoiceBroadcaster
+	paymentUpdates rp.PaymentBroadcaster
+}
+
+var ErrUnknown = errors.New("unknown invoice or payment")
+
+type issued struct {
+	invoice  string
+	preimage string
+	msatoshi int64
+}
+
+func Start(params Params) (*TestWallet, error) {
+	return &TestWallet{
+		Params:   params,
+		invoices: make(map[string]*rp.InvoiceStatus),
+		issued:   make(map[string]issued),
+		payments: make(map[string]*rp.PaymentStatus),
+	}, nil
+}
+
+// Compile time check to ensure that TestWallet fully implements rp.Wallet
+var _ rp.Wallet = (*TestWallet)(nil)
+
+// Compile time check to ensure that TestWallet implements rp.Subscriber
+var _ rp.Subscriber = (*TestWallet)(nil)
+
+func (t *TestWallet) Kind() string {
+	return "test"
+}
+
+func (t *TestWallet) Capabilities() rp.Capabilities {
+	return rp.Capabilities{
+		MaxDescriptionLength: rp.MaxBolt11DescriptionLength,
+		RouteHints:           true,
+		CustomRouteHints:     true,
+		CancelInvoices:       true,
+		Labels:               true,
+	}
+}
+
+func (t *TestWallet) GetInfo() (rp.WalletInfo, error) {
+	return rp.WalletInfo{}, nil
+}
+
+func (t *TestWallet) Health(context.Context) (rp.HealthStatus, error) {
+	return rp.HealthStatus{
+		Connected:     true,
+		SyncedToChain: true,
+		SyncedToGraph: true,
+		StreamsAlive:  true,
+	}, nil
+}
+
+func (t *TestWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	if err := rp.ValidateInvoiceParams(t.Capabilities(), params); err != nil {
+		return rp.InvoiceData{}, err
+	}
+
+	preimage, err := rp.InvoicePreimage(params)
+	if err != nil {
+		return rp.InvoiceData{}, err
+	}
+	hash := sha256.Sum256(preimage)
+	checkingID := hex.EncodeToString(hash[:])
+
+	t.mu.Lock()
+	t.invoices[checkingID] = &rp.InvoiceStatus{
+		CheckingID:  checkingID,
+		Exists:      true,
+		Msatoshi:    params.Msatoshi,
+		Description: params.Description,
+		Label:       params.Label,
+	}
+	t.issued[checkingID] = issued{
+		invoice:  "lntest" + checkingID,
+		preimage: hex.EncodeToString(preimage),
+		msatoshi: params.Msatoshi,
+	}
+	t.mu.Unlock()
+
+	return rp.InvoiceData{
+		CheckingID: checkingID,
+		Preimage:   hex.EncodeToString(preimage),
+		Invoice:    "lntest" + checkingID,
+	}, nil
+}
+
+func (t *TestWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status, ok := t.invoices[checkingID]
+	if !ok {
+		return rp.InvoiceNotFound(checkingID)
+	}
+	return *status, nil
+}
+
+func (t *TestWallet) CancelInvoice(checkingID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status, ok := t.invoices[checkingID]
+	if !ok {
+		return ErrUnknown
+	}
+	if status.Paid {
+		return errors.New("invoice is already paid")
+	}
+	canceled := *status
+	canceled.Canceled = true
+	t.invoices[checkingID] = &canceled
+	return nil
+}
+
+func (t *TestWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	listener, _ := t.invoiceUpdates.Subscribe()
+	return listener, nil
+}
+
+func (t *TestWallet) SubscribePaidInvoices() (<-chan rp.InvoiceStatus, func()) {
+	return t.invoiceUpdates.Subscribe()
+}
+
+// SettleInvoice marks an invoice created by CreateInvoice as paid, updating
+// its status and sending the stream event in the order of the scenario.
+// Settling it again is like paying an AMP invoice again, the amounts add up
+// and the event has the amount of that settlement.
+func (t *TestWallet) SettleInvoice(checkingID string, msatoshi int64) error {
+	t.mu.Lock()
+	status, ok := t.invoices[checkingID]
+	preimage := t.issued[checkingID].preimage
+	t.mu.Unlock()
+	if !ok {
+		return ErrUnknown
+	}
+	if status.Canceled {
+		return errors.New("invoice was canceled")
+	}
+
+	paid := *status
+	paid.Paid = true
+	paid.Preimage = preimage
+	paid.Settlements++
+	paid.MSatoshiReceived += msatoshi
+	paid.SettledAt = time.Now()
+	event := paid
+	event.MSatoshiReceived = msatoshi
+
+	update := func() {
+		t.mu.Lock()
+		t.invoices[checkingID] = &paid
+		t.mu.Unlock()
+	}
+	notify := func() {
+		go t.invoiceUpdates.Publish(event)
+	}
+
+	t.run(update, notify)
+	return nil
+}
+
+// MakePayment of an invoice made by CreateInvoice settles it internally, the
+// payment completing with no fees. Other payments stay pending until they are
+// resolved with CompletePayment or FailPayment.
+func (t *TestWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	if !strings.HasPrefix(params.Invoice, "ln") {
+		return rp.PaymentData{}, fmt.Errorf("%w: %q", rp.ErrInvalidBolt11, params.Invoice)
+	}
+	if own, ok := t.ownInvoice(params.Invoice); ok {
+		return t.payInternally(own, params)
+	}
+
+	hash := sha256.Sum256([]byte(params.Invoice))
+	checkingID := hex.EncodeToString(hash[:])
+
+	t.mu.Lock()
+	t.payments[checkingID] = &rp.PaymentStatus{
+		CheckingID: checkingID,
+		Status:     rp.Pending,
+	}
+	t.mu.Unlock()
+
+	return rp.PaymentData{CheckingID: checkingID}, nil
+}
+
+func (t *TestWallet) ownInvoice(invoice string) (string, bool) {
+	checkingID := strings.TrimPrefix(invoice, "lntest")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	own, ok := t.issued[checkingID]
+	return checkingID, ok && own.invoice == invoice
+}
+
+func (t *TestWallet) payInternally(checkingID string, params rp.PaymentParams) (rp.PaymentData, error) {
+	t.mu.Lock()
+	own := t.issued[checkingID]
+	status := *t.invoices[checkingID]
+	if _, ok := t.payments[checkingID]; ok || status.Paid {
+		t.mu.Unlock()
+		return rp.PaymentData{}, errors.New("invoice is already paid")
+	}
+	t.payments[checkingID] = &rp.PaymentStatus{
+		CheckingID: checkingID,
+		Status:     rp.Pending,
+	}
+	t.mu.Unlock()
+
+	msatoshi := own.msatoshi
+	if params.CustomAmount != 0 {
+		msatoshi = params.CustomAmount
+	}
+	if err := t.SettleInvoice(checkingID, msatoshi); err != nil {
+		t.FailPayment(checkingID)
+		return rp.PaymentData{}, err
+	}
+	if err := t.CompletePayment(checkingID, own.preimage, 0); err != nil {
+		return rp.PaymentData{}, err
+	}
+	return rp.PaymentData{CheckingID: checkingID}, nil
+}
+
+func (t *TestWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status, ok := t.payments[checkingID]
+	if !ok {
+		return rp.PaymentStatus{CheckingID: checkingID, Status: rp.NeverTried}, nil
+	}
+	return *status, nil
+}
+
+func (t *TestWallet) PaymentsStream() (<-chan rp.PaymentStatus, error) {
+	listener, _ := t.paymentUpdates.Subscribe()
+	return listener, nil
+}
+
+func (t *TestWallet) SubscribePayments() (<-chan rp.PaymentStatus, func()) {
+	return t.paymentUpdates.Subscribe()
+}
+
+// CompletePayment resolves a payment made with MakePayment as successful.
+func (t *TestWallet) CompletePayment(checkingID string, preimage string, feePaid int64) error {
+	return t.resolvePayment(rp.PaymentStatus{
+		CheckingID: checkingID,
+		Status:     rp.Complete,
+		FeePaid:    feePaid,
+		Preimage:   preimage,
+	})
+}
+
+// FailPayment resolves a payment made with MakePayment as failed.
+func (t *TestWallet) FailPayment(checkingID string) error {
+	return t.resolvePayment(rp.PaymentStatus{
+		CheckingID: checkingID,
+		Status:     rp.Failed,
+	})
+}
+
+func (t *TestWallet) resolvePayment(resolved rp.PaymentStatus) error {
+	resolved.ResolvedAt = time.Now()
+
+	t.mu.Lock()
+	_, ok := t.payments[resolved.CheckingID]
+	t.mu.Unlock()
+	if !ok {
+		return ErrUnknown
+	}
+
+	update := func() {
+		t.mu.Lock()
+		t.payments[resolved.CheckingID] = &resolved
+		t.mu.Unlock()
+	}
+	notify := func() {
+		go t.paymentUpdates.Publish(resolved)
+	}
+
+	t.run(update, notify)
+	return nil
+}
+
+// Release makes everything that is behind catch up, when Lag is zero.
+func (t *TestWallet) Release() {
+	t.mu.Lock()
+	held := t.held
+	t.held = nil
+	t.mu.Unlock()
+
+	for _, fn := range held {
+		fn()
+	}
+}
+
+func (t *TestWallet) run(update func(), notify func()) {
+	switch t.Scenario {
+	case StreamFirst:
+		notify()
+		t.later(update)
+	case StatusFirst:
+		update()
+		t.later(notify)
+	default:
+		update()
+		notify()
+	}
+}
+
+func (t *TestWallet) later(fn func()) {
+	if t.Lag == 0 {
+		t.mu.Lock()
+		t.held = append(t.held, fn)
+		t.mu.Unlock()
+		return
+	}
+	time.AfterFunc(t.Lag, fn)
+}
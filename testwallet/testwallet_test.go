@@ -0,0 +1,100 @@
+package testwallet
+
+import (
+	"testing"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/walletest"
+)
+
+func TestStreamFirst(t *testing.T) {
+	w, _ := Start(Params{Scenario: StreamFirst})
+	stream, _ := w.PaidInvoicesStream()
+	inv, err := w.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	if err := w.SettleInvoice(inv.CheckingID, 1000); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if got := <-stream; !got.Paid {
+		t.Errorf("got %v, wanted a paid event", got)
+	}
+	if status, _ := w.GetInvoiceStatus(inv.CheckingID); status.Paid {
+		t.Errorf("got paid status, wanted it to lag behind the event")
+	}
+
+	w.Release()
+	if status, _ := w.GetInvoiceStatus(inv.CheckingID); !status.Paid {
+		t.Errorf("got unpaid status, wanted it to catch up")
+	}
+}
+
+func TestStatusFirst(t *testing.T) {
+	w, _ := Start(Params{Scenario: StatusFirst})
+	stream, _ := w.PaymentsStream()
+	payment, _ := w.MakePayment(rp.PaymentParams{Invoice: "lntest"})
+
+	if err := w.CompletePayment(payment.CheckingID, "00", 10); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if status, _ := w.GetPaymentStatus(payment.CheckingID); status.Status != rp.Complete {
+		t.Errorf("got %v, wanted %v", status.Status, rp.Complete)
+	}
+	select {
+	case got := <-stream:
+		t.Errorf("got %v, wanted no event before release", got)
+	default:
+	}
+
+	w.Release()
+	if got := <-stream; got.Status != rp.Complete {
+		t.Errorf("got %v, wanted %v", got.Status, rp.Complete)
+	}
+}
+
+func TestSelfPayment(t *testing.T) {
+	w, _ := Start(Params{})
+	inv, _ := w.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+
+	payment, err := w.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if got, _ := w.GetPaymentStatus(payment.CheckingID); got.Status != rp.Complete || got.Preimage != inv.Preimage {
+		t.Errorf("got %v, wanted it complete with the invoice preimage", got)
+	}
+	if got, _ := w.GetInvoiceStatus(inv.CheckingID); !got.Paid || got.MSatoshiReceived != 1000 {
+		t.Errorf("got %v, wanted the invoice paid with 1000 msat", got)
+	}
+
+	if _, err := w.MakePayment(rp.PaymentParams{Invoice: inv.Invoice}); err == nil {
+		t.Errorf("got %v, wanted the second payment to fail", err)
+	}
+}
+
+func TestSettleInvoice_Again(t *testing.T) {
+	w, _ := Start(Params{})
+	stream, _ := w.PaidInvoicesStream()
+	inv, _ := w.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+
+	w.SettleInvoice(inv.CheckingID, 1000)
+	<-stream
+	w.SettleInvoice(inv.CheckingID, 1500)
+	if got := <-stream; got.MSatoshiReceived != 1500 || got.Settlements != 2 {
+		t.Errorf("got %+v, wanted an event for the second settlement", got)
+	}
+
+	got, _ := w.GetInvoiceStatus(inv.CheckingID)
+	if got.MSatoshiReceived != 2500 || got.Settlements != 2 || got.Overpaid() != 1500 {
+		t.Errorf("got %+v, wanted 2500 msat received in two settlements", got)
+	}
+}
+
+func TestWalletest(t *testing.T) {
+	walletest.Run(t, func() rp.Wallet {
+		w, _ := Start(Params{})
+		return w
+	})
+}
@@ -0,0 +1,223 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+var ErrRateLimited = errors.New("rate limited")
+
+type Params struct {
+	Wallet rp.Wallet
+
+	// Limits are keyed by method name, like "MakePayment". Methods without a
+	// limit can be called as often as wanted.
+	Limits map[string]Limit
+
+	// Threshold is how many consecutive backend errors open the circuit,
+	// defaults to 5.
+	Threshold int
+
+	// Cooldown is how long the circuit stays open before a call is let
+	// through to see if the backend is back, defaults to 30 seconds.
+	Cooldown time.Duration
+}
+
+// Limit allows Burst calls at once, refilled at PerSecond calls per second.
+type Limit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// ThrottleWallet wraps another wallet so bursty consumers can't overload a
+// shared node: calls over the limits fail with ErrRateLimited, and after
+// Threshold consecutive backend errors every call fails right away with
+// rp.ErrBackendUnavailable until the cooldown is over and a call succeeds.
+//
+// Errors caused by the call itself, like invalid params or invoices that
+// don't exist, don't count towards the threshold. Streams aren't throttled.
+type ThrottleWallet struct {
+	rp.Wallet
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	failures  int
+	openUntil time.Time
+	probing   bool // a call is seeing if the backend is back
+}
+
+type bucket struct {
+	Limit
+	tokens float64
+	last   time.Time
+}
+
+func Start(params Params) (*ThrottleWallet, error) {
+	if params.Threshold == 0 {
+		params.Threshold = 5
+	}
+	if params.Cooldown == 0 {
+		params.Cooldown = 30 * time.Second
+	}
+
+	t := &ThrottleWallet{
+		Wallet:    params.Wallet,
+		threshold: params.Threshold,
+		cooldown:  params.Cooldown,
+		now:       time.Now,
+		buckets:   make(map[string]*bucket),
+	}
+	for method, limit := range params.Limits {
+		if limit.PerSecond <= 0 || limit.Burst <= 0 {
+			return nil, fmt.Errorf("%w: limit for %s must allow some calls", rp.ErrInvalidParams, method)
+		}
+		t.buckets[method] = &bucket{Limit: limit, tokens: float64(limit.Burst)}
+	}
+
+	return t, nil
+}
+
+// Compile time check to ensure that ThrottleWallet fully implements rp.Wallet
+var _ rp.Wallet = (*ThrottleWallet)(nil)
+
+func (t *ThrottleWallet) GetInfo() (rp.WalletInfo, error) {
+	if err := t.acquire("GetInfo"); err != nil {
+		return rp.WalletInfo{}, err
+	}
+	info, err := t.Wallet.GetInfo()
+	t.record(err)
+	return info, err
+}
+
+func (t *ThrottleWallet) Health(ctx context.Context) (rp.HealthStatus, error) {
+	if err := t.acquire("Health"); err != nil {
+		return rp.HealthStatus{}, err
+	}
+	health, err := t.Wallet.Health(ctx)
+	t.record(err)
+	return health, err
+}
+
+func (t *ThrottleWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	if err := t.acquire("CreateInvoice"); err != nil {
+		return rp.InvoiceData{}, err
+	}
+	data, err := t.Wallet.CreateInvoice(params)
+	t.record(err)
+	return data, err
+}
+
+func (t *ThrottleWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	if err := t.acquire("GetInvoiceStatus"); err != nil {
+		return rp.InvoiceStatus{}, err
+	}
+	status, err := t.Wallet.GetInvoiceStatus(checkingID)
+	t.record(err)
+	return status, err
+}
+
+func (t *ThrottleWallet) CancelInvoice(checkingID string) error {
+	if err := t.acquire("CancelInvoice"); err != nil {
+		return err
+	}
+	err := t.Wallet.CancelInvoice(checkingID)
+	t.record(err)
+	return err
+}
+
+func (t *ThrottleWallet) MakePayment(params rp.PaymentParams) (rp.PaymentData, error) {
+	if err := t.acquire("MakePayment"); err != nil {
+		return rp.PaymentData{}, err
+	}
+	data, err := t.Wallet.MakePayment(params)
+	t.record(err)
+	return data, err
+}
+
+func (t *ThrottleWallet) GetPaymentStatus(checkingID string) (rp.PaymentStatus, error) {
+	if err := t.acquire("GetPaymentStatus"); err != nil {
+		return rp.PaymentStatus{}, err
+	}
+	status, err := t.Wallet.GetPaymentStatus(checkingID)
+	t.record(err)
+	return status, err
+}
+
+// acquire checks the circuit and takes a token for the method.
+func (t *ThrottleWallet) acquire(method string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if t.failures >= t.threshold {
+		if now.Before(t.openUntil) || t.probing {
+			return fmt.Errorf("%w: %d consecutive errors, calls resume at %s",
+				rp.ErrBackendUnavailable, t.failures, t.openUntil.Format(time.RFC3339))
+		}
+		// let this one through, its result decides if the circuit closes
+		t.probing = true
+	}
+
+	if b, ok := t.buckets[method]; ok {
+		b.refill(now)
+		if b.tokens < 1 {
+			t.probing = false
+			return fmt.Errorf("%w: %s is limited to %g calls per second",
+				ErrRateLimited, method, b.PerSecond)
+		}
+		b.tokens--
+	}
+
+	return nil
+}
+
+// record counts consecutive backend errors, opening the circuit when there
+// are too many of them.
+func (t *ThrottleWallet) record(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.probing = false
+	if err == nil || !isBackendError(err) {
+		t.failures = 0
+		return
+	}
+
+	t.failures++
+	if t.failures >= t.threshold {
+		t.openUntil = t.now().Add(t.cooldown)
+	}
+}
+
+func isBackendError(err error) bool {
+	for _, caller := range []error{
+		rp.ErrInvalidParams,
+		rp.ErrNotFound,
+		rp.ErrUnsupported,
+		rp.ErrInsufficientPermissions,
+		rp.ErrSelfPayment,
+	} {
+		if errors.Is(err, caller) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.PerSecond
+		if b.tokens > float64(b.Burst) {
+			b.tokens = float64(b.Burst)
+		}
+	}
+	b.last = now
+}
@@ -0,0 +1,90 @@
+package throttle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/void"
+)
+
+type flakyWallet struct {
+	void.VoidWallet
+	err error
+}
+
+func (w *flakyWallet) GetInfo() (rp.WalletInfo, error) {
+	return rp.WalletInfo{}, w.err
+}
+
+func TestRateLimit(t *testing.T) {
+	th, err := Start(Params{
+		Wallet: &flakyWallet{},
+		Limits: map[string]Limit{"GetInfo": {PerSecond: 2, Burst: 2}},
+	})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	now := time.Unix(1600000000, 0)
+	th.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := th.GetInfo(); err != nil {
+			t.Errorf("got %v, wanted %v", err, nil)
+		}
+	}
+	if _, err := th.GetInfo(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("got %v, wanted %v", err, ErrRateLimited)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if _, err := th.GetInfo(); err != nil {
+		t.Errorf("got %v, wanted a token refilled", err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	wallet := &flakyWallet{err: errors.New("connection refused")}
+	th, _ := Start(Params{Wallet: wallet, Threshold: 3, Cooldown: time.Minute})
+	now := time.Unix(1600000000, 0)
+	th.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := th.GetInfo(); errors.Is(err, rp.ErrBackendUnavailable) {
+			t.Errorf("got %v, wanted the backend error", err)
+		}
+	}
+	if _, err := th.GetInfo(); !errors.Is(err, rp.ErrBackendUnavailable) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrBackendUnavailable)
+	}
+
+	// after the cooldown a failing call opens it again
+	now = now.Add(time.Minute)
+	if _, err := th.GetInfo(); errors.Is(err, rp.ErrBackendUnavailable) {
+		t.Errorf("got %v, wanted a call to be let through", err)
+	}
+	if _, err := th.GetInfo(); !errors.Is(err, rp.ErrBackendUnavailable) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrBackendUnavailable)
+	}
+
+	// and a successful one closes it
+	now = now.Add(time.Minute)
+	wallet.err = nil
+	for i := 0; i < 2; i++ {
+		if _, err := th.GetInfo(); err != nil {
+			t.Errorf("got %v, wanted %v", err, nil)
+		}
+	}
+}
+
+func TestCallerErrorsDontCount(t *testing.T) {
+	wallet := &flakyWallet{err: rp.ErrInvalidParams}
+	th, _ := Start(Params{Wallet: wallet, Threshold: 1})
+
+	for i := 0; i < 3; i++ {
+		if _, err := th.GetInfo(); !errors.Is(err, rp.ErrInvalidParams) {
+			t.Errorf("got %v, wanted %v", err, rp.ErrInvalidParams)
+		}
+	}
+}
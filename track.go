@@ -0,0 +1,65 @@
+package relampago
+
+import (
+	"context"
+	"time"
+)
+
+// PaymentTracker is implemented by backends that can stream the progress of a
+// single payment as its htlcs are sent and resolved.
+type PaymentTracker interface {
+	TrackPayment(ctx context.Context, checkingID string) (<-chan PaymentStatus, error)
+}
+
+// TrackPollInterval is how often TrackPayment polls backends that aren't
+// PaymentTrackers.
+var TrackPollInterval = 5 * time.Second
+
+// TrackPayment streams the status of a payment until it completes or fails or
+// ctx is done, then closes the channel. It uses the backend's own tracking when
+// it is a PaymentTracker and polls GetPaymentStatus otherwise.
+func TrackPayment(ctx context.Context, wallet Wallet, checkingID string) (<-chan PaymentStatus, error) {
+	if tracker, ok := wallet.(PaymentTracker); ok {
+		return tracker.TrackPayment(ctx, checkingID)
+	}
+
+	first, err := wallet.GetPaymentStatus(checkingID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan PaymentStatus)
+	go func() {
+		defer close(updates)
+
+		last := first
+		select {
+		case updates <- last:
+		case <-ctx.Done():
+			return
+		}
+
+		ticker := time.NewTicker(TrackPollInterval)
+		defer ticker.Stop()
+		for !last.Status.Final() {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			status, err := wallet.GetPaymentStatus(checkingID)
+			if err != nil || status == last {
+				continue
+			}
+			last = status
+			select {
+			case updates <- last:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return updates, nil
+}
@@ -0,0 +1,47 @@
+package relampago_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+func TestTrackPayment_Polling(t *testing.T) {
+	defer func(interval time.Duration) { rp.TrackPollInterval = interval }(rp.TrackPollInterval)
+	rp.TrackPollInterval = 10 * time.Millisecond
+
+	// testwallet isn't a PaymentTracker, so its status is polled
+	tw, _ := testwallet.Start(testwallet.Params{})
+	payment, _ := tw.MakePayment(rp.PaymentParams{Invoice: "lnbc1"})
+	updates, err := rp.TrackPayment(context.Background(), tw, payment.CheckingID)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	if got := <-updates; got.Status != rp.Pending {
+		t.Errorf("got %v, wanted %v", got.Status, rp.Pending)
+	}
+	tw.CompletePayment(payment.CheckingID, "", 0)
+	if got := <-updates; got.Status != rp.Complete {
+		t.Errorf("got %v, wanted %v", got.Status, rp.Complete)
+	}
+	if _, ok := <-updates; ok {
+		t.Errorf("got an update, wanted the channel closed once final")
+	}
+}
+
+func TestTrackPayment_Canceled(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	payment, _ := tw.MakePayment(rp.PaymentParams{Invoice: "lnbc1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, _ := rp.TrackPayment(ctx, tw, payment.CheckingID)
+	<-updates
+	cancel()
+	if _, ok := <-updates; ok {
+		t.Errorf("got an update, wanted the channel closed")
+	}
+}
@@ -0,0 +1,367 @@
+// Package unified creates BIP21 invoices that can be paid either over
+// lightning or on-chain, and settles them the same way whichever leg is used.
+package unified
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type Params struct {
+	// Wallet must be able to cancel invoices and also be an rp.OnchainWallet
+	// and, for MinConfirmations above 1, an rp.ChainWatcher.
+	Wallet rp.Wallet
+
+	// MinConfirmations is how many confirmations an on-chain payment needs
+	// before the invoice is settled, defaults to 1.
+	MinConfirmations int32
+
+	// ZeroConfMaxSatoshi settles on-chain payments of up to this amount as
+	// soon as they are seen in the mempool.
+	ZeroConfMaxSatoshi int64
+
+	// OnReplaced is called when an unconfirmed payment to an invoice address
+	// is replaced by another transaction, including after a zero-conf
+	// settlement, in which case the payment may have been taken back.
+	OnReplaced func(checkingID string, replaced string, replacement string)
+
+	// OnPaidTwice is called when an invoice settled on-chain is paid over
+	// lightning too, because the lightning invoice couldn't be canceled in
+	// time, so the second payment can be refunded.
+	OnPaidTwice func(checkingID string, lightning rp.InvoiceStatus)
+}
+
+// UnifiedWallet wraps another wallet so invoices get an on-chain address too.
+// Its PaidInvoicesStream emits the invoices paid over lightning and the ones
+// paid on-chain once the payment is confirmed enough.
+//
+// Each on-chain transaction is judged by what it pays itself, so a replacement
+// that pays less than the invoice doesn't settle it.
+type UnifiedWallet struct {
+	rp.Wallet
+	params  Params
+	onchain rp.OnchainWallet
+
+	mu        sync.Mutex
+	addresses map[string]*unifiedInvoice // by address, while watched
+	invoices  map[string]*unifiedInvoice // by checking id
+
+	invoiceUpdates rp.InvoiceBroadcaster
+}
+
+type unifiedInvoice struct {
+	checkingID string
+	address    string
+	msatoshi   int64
+
+	// the latest transaction paying enough to the address
+	tx *rp.OnchainTransaction
+
+	settled *rp.InvoiceStatus
+}
+
+// Invoice is an invoice created by CreateUnifiedInvoice.
+type Invoice struct {
+	rp.InvoiceData
+	Address string `json:"address"`
+	URI     string `json:"uri"`
+}
+
+var (
+	ErrNotOnchainWallet = errors.New("wallet can't receive on-chain")
+	ErrNotChainWatcher  = errors.New("wallet can't follow the chain to count confirmations")
+	ErrCantCancel       = errors.New("wallet can't cancel the lightning invoices paid on-chain")
+)
+
+func Start(params Params) (*UnifiedWallet, error) {
+	onchain, ok := params.Wallet.(rp.OnchainWallet)
+	if !ok {
+		return nil, ErrNotOnchainWallet
+	}
+	if !params.Wallet.Capabilities().CancelInvoices {
+		return nil, ErrCantCancel
+	}
+	if params.MinConfirmations == 0 {
+		params.MinConfirmations = 1
+	}
+
+	// transactions are only streamed again when they get their first
+	// confirmation, the ones after it are counted from the blocks
+	var blocks <-chan rp.BlockEpoch
+	if params.MinConfirmations > 1 {
+		watcher, ok := params.Wallet.(rp.ChainWatcher)
+		if !ok {
+			return nil, ErrNotChainWatcher
+		}
+		var err error
+		blocks, err = watcher.BlockStream(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to subscribe to blocks: %w", err)
+		}
+	}
+
+	invoices, err := params.Wallet.PaidInvoicesStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to invoices: %w", err)
+	}
+	txs, err := onchain.OnchainTxStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to on-chain transactions: %w", err)
+	}
+
+	u := &UnifiedWallet{
+		Wallet:    params.Wallet,
+		params:    params,
+		onchain:   onchain,
+		addresses: make(map[string]*unifiedInvoice),
+		invoices:  make(map[string]*unifiedInvoice),
+	}
+
+	go func() {
+		for status := range invoices {
+			u.paidOverLightning(status)
+		}
+	}()
+	go func() {
+		for tx := range txs {
+			u.paidOnchain(tx)
+		}
+	}()
+	go func() {
+		for block := range blocks {
+			u.newBlock(block)
+		}
+	}()
+
+	return u, nil
+}
+
+// Compile time check to ensure that UnifiedWallet fully implements rp.Wallet
+var _ rp.Wallet = (*UnifiedWallet)(nil)
+
+func (u *UnifiedWallet) Kind() string {
+	return "unified"
+}
+
+func (u *UnifiedWallet) CreateInvoice(params rp.InvoiceParams) (rp.InvoiceData, error) {
+	invoice, err := u.CreateUnifiedInvoice(params)
+	return invoice.InvoiceData, err
+}
+
+// CreateUnifiedInvoice creates the lightning invoice with a new address as
+// its fallback and returns both with the BIP21 URI for them.
+func (u *UnifiedWallet) CreateUnifiedInvoice(params rp.InvoiceParams) (Invoice, error) {
+	if params.Msatoshi <= 0 {
+		return Invoice{}, fmt.Errorf("%w: unified invoices need an amount", rp.ErrInvalidParams)
+	}
+
+	address, err := u.onchain.NewAddress()
+	if err != nil {
+		return Invoice{}, fmt.Errorf("failed to get a new address: %w", err)
+	}
+	if u.Wallet.Capabilities().FallbackAddresses {
+		params.FallbackAddress = address
+	}
+
+	data, err := u.Wallet.CreateInvoice(params)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	invoice := &unifiedInvoice{
+		checkingID: data.CheckingID,
+		address:    address,
+		msatoshi:   params.Msatoshi,
+	}
+	u.mu.Lock()
+	u.addresses[address] = invoice
+	u.invoices[data.CheckingID] = invoice
+	u.mu.Unlock()
+
+	return Invoice{
+		InvoiceData: data,
+		Address:     address,
+		URI:         URI(address, params.Msatoshi, data.Invoice, params.Description),
+	}, nil
+}
+
+// GetInvoiceStatus also reports invoices paid on-chain as paid.
+func (u *UnifiedWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error) {
+	u.mu.Lock()
+	invoice, ok := u.invoices[checkingID]
+	if ok && invoice.settled != nil {
+		status := *invoice.settled
+		u.mu.Unlock()
+		return status, nil
+	}
+	u.mu.Unlock()
+
+	return u.Wallet.GetInvoiceStatus(checkingID)
+}
+
+func (u *UnifiedWallet) CancelInvoice(checkingID string) error {
+	if err := u.Wallet.CancelInvoice(checkingID); err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	if invoice, ok := u.invoices[checkingID]; ok && invoice.settled == nil {
+		delete(u.addresses, invoice.address)
+		delete(u.invoices, invoice.checkingID)
+	}
+	u.mu.Unlock()
+	return nil
+}
+
+func (u *UnifiedWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
+	listener, _ := u.invoiceUpdates.Subscribe()
+	return listener, nil
+}
+
+func (u *UnifiedWallet) paidOverLightning(status rp.InvoiceStatus) {
+	u.mu.Lock()
+	if invoice, ok := u.invoices[status.CheckingID]; ok {
+		if invoice.settled != nil {
+			// already settled on-chain, the lightning cancel must have raced
+			// or failed
+			u.mu.Unlock()
+			if u.params.OnPaidTwice != nil {
+				u.params.OnPaidTwice(status.CheckingID, status)
+			}
+			return
+		}
+		delete(u.addresses, invoice.address)
+		delete(u.invoices, invoice.checkingID)
+	}
+	u.mu.Unlock()
+
+	u.invoiceUpdates.Publish(status)
+}
+
+func (u *UnifiedWallet) paidOnchain(tx rp.OnchainTransaction) {
+	u.mu.Lock()
+	var invoice *unifiedInvoice
+	for _, address := range tx.Addresses {
+		if invoice = u.addresses[address]; invoice != nil {
+			break
+		}
+	}
+	if invoice == nil {
+		u.mu.Unlock()
+		return
+	}
+
+	var replaced string
+	if tx.Confirmations == 0 && invoice.tx != nil && invoice.tx.TxID != tx.TxID &&
+		invoice.tx.Confirmations == 0 {
+		replaced = invoice.tx.TxID
+	}
+	if tx.Amount*1000 >= invoice.msatoshi || replaced != "" {
+		invoice.tx = &tx
+	}
+
+	var settled *rp.InvoiceStatus
+	if invoice.tx == nil || invoice.tx.TxID != tx.TxID {
+		// doesn't pay enough
+	} else if invoice.settled == nil {
+		settled = u.check(invoice, tx.Confirmations)
+	} else if tx.Confirmations > 0 {
+		// the zero-conf payment confirmed, nothing to watch anymore
+		delete(u.addresses, invoice.address)
+	}
+	u.mu.Unlock()
+
+	if replaced != "" && u.params.OnReplaced != nil {
+		u.params.OnReplaced(invoice.checkingID, replaced, tx.TxID)
+	}
+	if settled != nil {
+		u.settle(*settled)
+	}
+}
+
+func (u *UnifiedWallet) newBlock(block rp.BlockEpoch) {
+	var settled []rp.InvoiceStatus
+
+	u.mu.Lock()
+	for _, invoice := range u.addresses {
+		if invoice.settled != nil || invoice.tx == nil || invoice.tx.BlockHeight == 0 {
+			continue
+		}
+		confirmations := int32(block.Height) - invoice.tx.BlockHeight + 1
+		if status := u.check(invoice, confirmations); status != nil {
+			settled = append(settled, *status)
+		}
+	}
+	u.mu.Unlock()
+
+	for _, status := range settled {
+		u.settle(status)
+	}
+}
+
+// check settles the invoice when its transaction is confirmed enough, with
+// u.mu held.
+func (u *UnifiedWallet) check(invoice *unifiedInvoice, confirmations int32) *rp.InvoiceStatus {
+	tx := invoice.tx
+	if tx == nil || tx.Amount*1000 < invoice.msatoshi {
+		return nil
+	}
+
+	zeroConf := confirmations == 0 && tx.Amount <= u.params.ZeroConfMaxSatoshi
+	if confirmations < u.params.MinConfirmations && !zeroConf {
+		return nil
+	}
+
+	invoice.settled = &rp.InvoiceStatus{
+		CheckingID:       invoice.checkingID,
+		Exists:           true,
+		Paid:             true,
+		MSatoshiReceived: tx.Amount * 1000,
+		SettledAt:        time.Now(),
+	}
+	if !zeroConf {
+		// zero-conf payments are watched until they confirm, in case they're
+		// replaced
+		delete(u.addresses, invoice.address)
+	}
+	return invoice.settled
+}
+
+func (u *UnifiedWallet) settle(status rp.InvoiceStatus) {
+	// so it can't be paid again over lightning, if it still is OnPaidTwice
+	// tells
+	if err := u.Wallet.CancelInvoice(status.CheckingID); err != nil {
+		log.Printf("Failed to cancel invoice %s paid on-chain: %v", status.CheckingID, err)
+	}
+
+	u.invoiceUpdates.Publish(status)
+}
+
+// URI is the BIP21 URI to pay msatoshi to address or, for wallets that support
+// it, to the lightning invoice.
+func URI(address string, msatoshi int64, invoice string, label string) string {
+	query := []string{"amount=" + btcAmount(msatoshi)}
+	if label != "" {
+		query = append(query, "label="+url.QueryEscape(label))
+	}
+	if invoice != "" {
+		query = append(query, "lightning="+strings.ToUpper(invoice))
+	}
+	return "bitcoin:" + address + "?" + strings.Join(query, "&")
+}
+
+// btcAmount formats msatoshi rounded up to the satoshi as bitcoins, without
+// trailing zeros.
+func btcAmount(msatoshi int64) string {
+	sat := (msatoshi + 999) / 1000
+	amount := fmt.Sprintf("%d.%08d", sat/100000000, sat%100000000)
+	return strings.TrimSuffix(strings.TrimRight(amount, "0"), ".")
+}
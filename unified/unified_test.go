@@ -0,0 +1,199 @@
+package unified
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+	"github.com/lnbits/relampago/testwallet"
+)
+
+type onchainTestWallet struct {
+	*testwallet.TestWallet
+	addresses int
+	txs       rp.OnchainTxBroadcaster
+	cancelErr error
+}
+
+func (w *onchainTestWallet) CancelInvoice(checkingID string) error {
+	if w.cancelErr != nil {
+		return w.cancelErr
+	}
+	return w.TestWallet.CancelInvoice(checkingID)
+}
+
+func (w *onchainTestWallet) NewAddress() (string, error) {
+	w.addresses++
+	return fmt.Sprintf("bc1qtest%d", w.addresses), nil
+}
+
+func (w *onchainTestWallet) SendOnchain(string, int64, int64) (string, error) {
+	return "", nil
+}
+
+func (w *onchainTestWallet) GetOnchainBalance() (rp.OnchainBalance, error) {
+	return rp.OnchainBalance{}, nil
+}
+
+func (w *onchainTestWallet) OnchainTxStream() (<-chan rp.OnchainTransaction, error) {
+	listener, _ := w.txs.Subscribe()
+	return listener, nil
+}
+
+func setup(t *testing.T, params Params) (*onchainTestWallet, *UnifiedWallet, <-chan rp.InvoiceStatus) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	wallet := &onchainTestWallet{TestWallet: tw}
+	params.Wallet = wallet
+
+	u, err := Start(params)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	paid, _ := u.PaidInvoicesStream()
+	return wallet, u, paid
+}
+
+func expectSettled(t *testing.T, paid <-chan rp.InvoiceStatus, checkingID string) {
+	select {
+	case status := <-paid:
+		if status.CheckingID != checkingID || !status.Paid {
+			t.Errorf("got %v, wanted invoice %s paid", status, checkingID)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("got nothing, wanted invoice %s paid", checkingID)
+	}
+}
+
+func expectNothing(t *testing.T, paid <-chan rp.InvoiceStatus) {
+	select {
+	case status := <-paid:
+		t.Errorf("got %v, wanted no settlement", status)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("bc1qtest", 150000500, "lnbc1500u1test", "coffee & cake")
+	expected := "bitcoin:bc1qtest?amount=0.00150001&label=coffee+%26+cake&lightning=LNBC1500U1TEST"
+	if uri != expected {
+		t.Errorf("got %s, wanted %s", uri, expected)
+	}
+
+	if uri := URI("bc1qtest", 100000000000, "", ""); uri != "bitcoin:bc1qtest?amount=1" {
+		t.Errorf("got %s, wanted a whole bitcoin", uri)
+	}
+}
+
+func TestZeroConf(t *testing.T) {
+	wallet, u, paid := setup(t, Params{ZeroConfMaxSatoshi: 10000})
+
+	invoice, _ := u.CreateUnifiedInvoice(rp.InvoiceParams{Msatoshi: 5000000})
+	wallet.txs.Publish(rp.OnchainTransaction{
+		TxID: "a", Amount: 5000, Addresses: []string{invoice.Address},
+	})
+	expectSettled(t, paid, invoice.CheckingID)
+
+	status, _ := u.GetInvoiceStatus(invoice.CheckingID)
+	if !status.Paid || status.MSatoshiReceived != 5000000 {
+		t.Errorf("got %v, wanted the invoice paid on-chain", status)
+	}
+}
+
+func TestAboveZeroConf(t *testing.T) {
+	wallet, u, paid := setup(t, Params{ZeroConfMaxSatoshi: 10000})
+
+	invoice, _ := u.CreateUnifiedInvoice(rp.InvoiceParams{Msatoshi: 50000000})
+	wallet.txs.Publish(rp.OnchainTransaction{
+		TxID: "a", Amount: 50000, Addresses: []string{invoice.Address},
+	})
+	expectNothing(t, paid)
+
+	wallet.txs.Publish(rp.OnchainTransaction{
+		TxID: "a", Amount: 50000, Confirmations: 1, BlockHeight: 800000,
+		Addresses: []string{invoice.Address},
+	})
+	expectSettled(t, paid, invoice.CheckingID)
+}
+
+func TestReplacement(t *testing.T) {
+	replaced := make(chan [2]string, 1)
+	wallet, u, paid := setup(t, Params{
+		ZeroConfMaxSatoshi: 10000,
+		OnReplaced: func(checkingID string, old string, new string) {
+			replaced <- [2]string{old, new}
+		},
+	})
+
+	invoice, _ := u.CreateUnifiedInvoice(rp.InvoiceParams{Msatoshi: 50000000})
+	wallet.txs.Publish(rp.OnchainTransaction{
+		TxID: "a", Amount: 50000, Addresses: []string{invoice.Address},
+	})
+	wallet.txs.Publish(rp.OnchainTransaction{
+		TxID: "b", Amount: 40000, Addresses: []string{invoice.Address},
+	})
+	wallet.txs.Publish(rp.OnchainTransaction{
+		TxID: "b", Amount: 40000, Confirmations: 1, BlockHeight: 800000,
+		Addresses: []string{invoice.Address},
+	})
+	expectNothing(t, paid)
+
+	if got := <-replaced; got != [2]string{"a", "b"} {
+		t.Errorf("got %v, wanted a replaced by b", got)
+	}
+}
+
+func TestMinConfirmations_NeedsChainWatcher(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	_, err := Start(Params{Wallet: &onchainTestWallet{TestWallet: tw}, MinConfirmations: 3})
+	if err != ErrNotChainWatcher {
+		t.Errorf("got %v, wanted %v", err, ErrNotChainWatcher)
+	}
+}
+
+func TestPaidTwice(t *testing.T) {
+	paidTwice := make(chan rp.InvoiceStatus, 1)
+	wallet, u, paid := setup(t, Params{
+		ZeroConfMaxSatoshi: 10000,
+		OnPaidTwice: func(checkingID string, lightning rp.InvoiceStatus) {
+			paidTwice <- lightning
+		},
+	})
+	wallet.cancelErr = errors.New("node unreachable")
+
+	invoice, _ := u.CreateUnifiedInvoice(rp.InvoiceParams{Msatoshi: 5000000})
+	wallet.txs.Publish(rp.OnchainTransaction{
+		TxID: "a", Amount: 5000, Addresses: []string{invoice.Address},
+	})
+	expectSettled(t, paid, invoice.CheckingID)
+
+	if err := wallet.SettleInvoice(invoice.CheckingID, 5000000); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	expectNothing(t, paid)
+	select {
+	case status := <-paidTwice:
+		if status.CheckingID != invoice.CheckingID {
+			t.Errorf("got %s, wanted %s", status.CheckingID, invoice.CheckingID)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("got nothing, wanted invoice %s paid twice", invoice.CheckingID)
+	}
+}
+
+type noCancelWallet struct {
+	*onchainTestWallet
+}
+
+func (w noCancelWallet) Capabilities() rp.Capabilities {
+	return rp.Capabilities{}
+}
+
+func TestStart_CantCancel(t *testing.T) {
+	tw, _ := testwallet.Start(testwallet.Params{})
+	_, err := Start(Params{Wallet: noCancelWallet{&onchainTestWallet{TestWallet: tw}}})
+	if err != ErrCantCancel {
+		t.Errorf("got %v, wanted %v", err, ErrCantCancel)
+	}
+}
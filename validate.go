@@ -0,0 +1,161 @@
+package relampago
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidParams = errors.New("invalid params")
+
+// ErrWumboRequired is returned, wrapping ErrInvalidParams, for amounts only a
+// node with wumbo support could handle.
+var ErrWumboRequired = fmt.Errorf("%w: wumbo required", ErrInvalidParams)
+
+// MaxNonWumboMsatoshi is the largest payment, about 0.043 BTC, that nodes
+// without wumbo (option_support_large_channel) will send or receive.
+const MaxNonWumboMsatoshi = 4294967295
+
+// MaxBolt11DescriptionLength is the longest description that fits in a
+// BOLT11 invoice.
+const MaxBolt11DescriptionLength = 639
+
+// ValidateInvoiceParams checks params against the backend limits so invalid
+// invoices fail early with a clear error.
+func ValidateInvoiceParams(caps Capabilities, params InvoiceParams) error {
+	if params.Msatoshi < 0 {
+		return fmt.Errorf("%w: amount %d msat is negative, 0 makes an invoice for any amount",
+			ErrInvalidParams, params.Msatoshi)
+	}
+	if caps.MaxInvoiceMsatoshi != 0 && params.Msatoshi > caps.MaxInvoiceMsatoshi {
+		if err := checkWumbo(caps, params.Msatoshi, caps.MaxInvoiceMsatoshi); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: amount %d msat is above the backend maximum of %d msat",
+			ErrInvalidParams, params.Msatoshi, caps.MaxInvoiceMsatoshi)
+	}
+	if params.DescriptionHash == nil {
+		if caps.MaxDescriptionLength != 0 && len(params.Description) > caps.MaxDescriptionLength {
+			return fmt.Errorf("%w: description has %d bytes, the backend maximum is %d",
+				ErrInvalidParams, len(params.Description), caps.MaxDescriptionLength)
+		}
+	} else {
+		if len(params.DescriptionHash) != 32 {
+			return fmt.Errorf("%w: description hash must be 32 bytes, got %d",
+				ErrInvalidParams, len(params.DescriptionHash))
+		}
+		if params.Description != "" && !VerifyDescriptionHash(params.Description, params.DescriptionHash) {
+			return fmt.Errorf("%w: description doesn't match the description hash", ErrInvalidParams)
+		}
+	}
+	if params.PaymentHash != nil {
+		if len(params.PaymentHash) != 32 {
+			return fmt.Errorf("%w: payment hash must be 32 bytes, got %d",
+				ErrInvalidParams, len(params.PaymentHash))
+		}
+		if params.Preimage != nil {
+			hash := sha256.Sum256(params.Preimage)
+			if subtle.ConstantTimeCompare(hash[:], params.PaymentHash) != 1 {
+				return fmt.Errorf("%w: preimage doesn't match the payment hash", ErrInvalidParams)
+			}
+		} else if !caps.HoldInvoices {
+			return fmt.Errorf("%w: the backend can't create hold invoices, a preimage is needed",
+				ErrInvalidParams)
+		}
+	}
+	if params.FallbackAddress != "" && !caps.FallbackAddresses {
+		return fmt.Errorf("%w: the backend can't add fallback addresses to invoices",
+			ErrInvalidParams)
+	}
+	if params.CltvExpiry != 0 && !caps.CltvExpiry {
+		return fmt.Errorf("%w: the backend can't set the cltv expiry of invoices",
+			ErrInvalidParams)
+	}
+	if params.Private && !caps.RouteHints {
+		return fmt.Errorf("%w: the backend can't add route hints for private channels",
+			ErrInvalidParams)
+	}
+	if len(params.RouteHints) > 0 && !caps.CustomRouteHints {
+		return fmt.Errorf("%w: the backend can't add custom route hints to invoices",
+			ErrInvalidParams)
+	}
+	if params.Expiry != nil && *params.Expiry < caps.MinExpiry {
+		return fmt.Errorf("%w: expiry %s is below the backend minimum of %s",
+			ErrInvalidParams, *params.Expiry, caps.MinExpiry)
+	}
+	return nil
+}
+
+// ValidatePayment checks the amount being paid, either the invoice amount or
+// the custom amount, and the params against the backend limits. Invoices
+// without an amount need a custom amount.
+func ValidatePayment(caps Capabilities, params PaymentParams, msatoshi int64) error {
+	if params.CustomAmount < 0 {
+		return fmt.Errorf("%w: custom amount %d msat is negative", ErrInvalidParams, params.CustomAmount)
+	}
+	if msatoshi == 0 {
+		return fmt.Errorf("%w: the invoice has no amount, a custom amount is needed", ErrInvalidParams)
+	}
+	if caps.MaxPaymentMsatoshi != 0 && msatoshi > caps.MaxPaymentMsatoshi {
+		if err := checkWumbo(caps, msatoshi, caps.MaxPaymentMsatoshi); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: amount %d msat is above the backend maximum of %d msat",
+			ErrInvalidParams, msatoshi, caps.MaxPaymentMsatoshi)
+	}
+	if len(params.RestrictToPeers) > 0 && !caps.PeerRestrictions {
+		return fmt.Errorf("%w: the backend can't restrict payments to peers", ErrInvalidParams)
+	}
+	if (len(params.OutgoingChannelIDs) > 0 || params.LastHopPubkey != "") && !caps.PeerRestrictions {
+		return fmt.Errorf("%w: the backend can't restrict payments to channels or a last hop",
+			ErrInvalidParams)
+	}
+	return nil
+}
+
+// ValidateChannelPolicy checks the params of PolicyManager.UpdateChannelPolicy.
+func ValidateChannelPolicy(chanPoint string, baseFeeMsatoshi, feeRatePPM int64) error {
+	if baseFeeMsatoshi < 0 || feeRatePPM < 0 {
+		return fmt.Errorf("%w: fees of %d msat and %d ppm can't be negative",
+			ErrInvalidParams, baseFeeMsatoshi, feeRatePPM)
+	}
+	if feeRatePPM > 1<<32-1 {
+		return fmt.Errorf("%w: fee rate of %d ppm is too high", ErrInvalidParams, feeRatePPM)
+	}
+	if chanPoint != "" {
+		if _, _, err := ParseChannelPoint(chanPoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseChannelPoint splits a funding outpoint like "txid:index".
+func ParseChannelPoint(chanPoint string) (txid string, index uint32, err error) {
+	parts := strings.Split(chanPoint, ":")
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("%w: channel point %q isn't txid:index", ErrInvalidParams, chanPoint)
+	}
+	if b, err := hex.DecodeString(parts[0]); err != nil || len(b) != 32 {
+		return "", 0, fmt.Errorf("%w: channel point %q has an invalid txid", ErrInvalidParams, chanPoint)
+	}
+	n, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: channel point %q has an invalid index", ErrInvalidParams, chanPoint)
+	}
+	return parts[0], uint32(n), nil
+}
+
+// checkWumbo explains a limit that only exists because the node lacks wumbo,
+// instead of letting the payment fail later with an opaque route error.
+func checkWumbo(caps Capabilities, msatoshi, limit int64) error {
+	if caps.Wumbo || limit != MaxNonWumboMsatoshi {
+		return nil
+	}
+	return fmt.Errorf("%w: amount %d msat is above %d msat and the node doesn't support wumbo",
+		ErrWumboRequired, msatoshi, MaxNonWumboMsatoshi)
+}
@@ -0,0 +1,67 @@
+package relampago
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateInvoiceParams_Amount(t *testing.T) {
+	for msatoshi, valid := range map[int64]bool{0: true, 1000: true, -1: false} {
+		err := ValidateInvoiceParams(Capabilities{}, InvoiceParams{Msatoshi: msatoshi})
+		if valid != (err == nil) || (err != nil && !errors.Is(err, ErrInvalidParams)) {
+			t.Errorf("%d msat: got %v, wanted valid %v", msatoshi, err, valid)
+		}
+	}
+}
+
+func TestValidateInvoiceParams_CltvExpiry(t *testing.T) {
+	params := InvoiceParams{Msatoshi: 1000, CltvExpiry: 144}
+	if err := ValidateInvoiceParams(Capabilities{}, params); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("got %v, wanted %v", err, ErrInvalidParams)
+	}
+	if err := ValidateInvoiceParams(Capabilities{CltvExpiry: true}, params); err != nil {
+		t.Errorf("got %v, wanted %v", err, nil)
+	}
+}
+
+func TestValidatePayment_Amount(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		params   PaymentParams
+		msatoshi int64
+		valid    bool
+	}{
+		{"invoice amount", PaymentParams{}, 1000, true},
+		{"custom amount", PaymentParams{CustomAmount: 500}, 500, true},
+		{"any amount without custom amount", PaymentParams{}, 0, false},
+		{"negative custom amount", PaymentParams{CustomAmount: -5}, -5, false},
+	} {
+		err := ValidatePayment(Capabilities{}, c.params, c.msatoshi)
+		if c.valid != (err == nil) || (err != nil && !errors.Is(err, ErrInvalidParams)) {
+			t.Errorf("%s: got %v, wanted valid %v", c.name, err, c.valid)
+		}
+	}
+}
+
+func TestValidateChannelPolicy(t *testing.T) {
+	txid := strings.Repeat("ab", 32)
+	for _, c := range []struct {
+		chanPoint string
+		base, ppm int64
+		valid     bool
+	}{
+		{"", 1000, 1, true},
+		{txid + ":1", 0, 0, true},
+		{txid, 1000, 1, false},
+		{"abcd:1", 1000, 1, false},
+		{txid + ":x", 1000, 1, false},
+		{txid + ":1", -1, 1, false},
+		{txid + ":1", 1000, 1 << 32, false},
+	} {
+		err := ValidateChannelPolicy(c.chanPoint, c.base, c.ppm)
+		if c.valid != (err == nil) || (err != nil && !errors.Is(err, ErrInvalidParams)) {
+			t.Errorf("%s %d %d: got %v, wanted valid %v", c.chanPoint, c.base, c.ppm, err, c.valid)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package void
 
-import rp "github.com/lnbits/relampago"
+import (
+	"context"
+
+	rp "github.com/lnbits/relampago"
+)
 
 type VoidWallet struct{}
 
@@ -15,12 +19,25 @@ func (v VoidWallet) Kind() string {
 	return "void"
 }
 
+func (v VoidWallet) Capabilities() rp.Capabilities {
+	return rp.Capabilities{}
+}
+
 func (v VoidWallet) GetInfo() (rp.WalletInfo, error) {
 	return rp.WalletInfo{
 		Balance: 0,
 	}, nil
 }
 
+func (v VoidWallet) Health(context.Context) (rp.HealthStatus, error) {
+	return rp.HealthStatus{
+		Connected:     true,
+		SyncedToChain: true,
+		SyncedToGraph: true,
+		StreamsAlive:  true,
+	}, nil
+}
+
 func (v VoidWallet) CreateInvoice(rp.InvoiceParams) (rp.InvoiceData, error) {
 	return rp.InvoiceData{
 		CheckingID: "void",
@@ -38,6 +55,10 @@ func (v VoidWallet) GetInvoiceStatus(checkingID string) (rp.InvoiceStatus, error
 	}, nil
 }
 
+func (v VoidWallet) CancelInvoice(string) error {
+	return nil
+}
+
 func (v VoidWallet) PaidInvoicesStream() (<-chan rp.InvoiceStatus, error) {
 	return make(chan rp.InvoiceStatus), nil
 }
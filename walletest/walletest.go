@@ -0,0 +1,255 @@
+// Package walletest checks that a backend behaves like the Wallet interface
+// says, so new backends can be tested for parity with one call:
+//
+//	func TestWallet(t *testing.T) {
+//		walletest.Run(t, func() rp.Wallet { return startWallet(t) })
+//	}
+//
+// Parts that need a paid invoice only run when the wallet can settle its own
+// invoices, by paying them or by implementing Settler, like testwallet does.
+package walletest
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+// Timeout bounds each wait for a stream event or a status.
+var Timeout = 30 * time.Second
+
+// Settler is implemented by fake wallets that can mark their own invoices as
+// paid.
+type Settler interface {
+	SettleInvoice(checkingID string, msatoshi int64) error
+}
+
+// Run calls newWallet for each part of the suite, so they don't see each
+// other's invoices and payments.
+func Run(t *testing.T, newWallet func() rp.Wallet) {
+	for _, c := range []struct {
+		name string
+		fn   func(*testing.T, rp.Wallet)
+	}{
+		{"Kind", kind},
+		{"CreateInvoice", createInvoice},
+		{"CustomPreimage", customPreimage},
+		{"DescriptionTooLong", descriptionTooLong},
+		{"UnknownInvoice", unknownInvoice},
+		{"CancelInvoice", cancelInvoice},
+		{"InvalidInvoice", invalidInvoice},
+		{"UnknownPayment", unknownPayment},
+		{"Settlement", settlement},
+		{"SelfPayment", selfPayment},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) { c.fn(t, newWallet()) })
+	}
+}
+
+func kind(t *testing.T, w rp.Wallet) {
+	if w.Kind() == "" {
+		t.Errorf("got an empty Kind, wanted the backend name")
+	}
+}
+
+func createInvoice(t *testing.T, w rp.Wallet) {
+	params := rp.InvoiceParams{Msatoshi: 21000, Description: "walletest"}
+	if w.Capabilities().Labels {
+		params.Label = "walletest-label"
+	}
+	inv, err := w.CreateInvoice(params)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if inv.CheckingID == "" || inv.Invoice == "" {
+		t.Errorf("got %+v, wanted a checking id and an invoice", inv)
+	}
+	if preimage, err := hex.DecodeString(inv.Preimage); err != nil || len(preimage) != 32 {
+		t.Errorf("got preimage %q, wanted 32 bytes of hex", inv.Preimage)
+	}
+
+	status, err := w.GetInvoiceStatus(inv.CheckingID)
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if status.CheckingID != inv.CheckingID || !status.Exists || status.Paid || status.Canceled {
+		t.Errorf("got %+v, wanted an unpaid invoice", status)
+	}
+	if params.Label != "" && status.Label != params.Label {
+		t.Errorf("got label %q, wanted %q", status.Label, params.Label)
+	}
+}
+
+func customPreimage(t *testing.T, w rp.Wallet) {
+	preimage := []byte(strings.Repeat("w", 32))
+	inv, err := w.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000, Preimage: preimage})
+	if errors.Is(err, rp.ErrUnsupported) {
+		t.Skip("the backend can't take a preimage")
+	}
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if inv.Preimage != hex.EncodeToString(preimage) {
+		t.Errorf("got preimage %s, wanted %x", inv.Preimage, preimage)
+	}
+}
+
+func descriptionTooLong(t *testing.T, w rp.Wallet) {
+	max := w.Capabilities().MaxDescriptionLength
+	if max == 0 {
+		t.Skip("the backend has no description limit")
+	}
+	_, err := w.CreateInvoice(rp.InvoiceParams{
+		Msatoshi:    1000,
+		Description: strings.Repeat("x", max+1),
+	})
+	if !errors.Is(err, rp.ErrInvalidParams) {
+		t.Errorf("got %v, wanted %v", err, rp.ErrInvalidParams)
+	}
+}
+
+func unknownInvoice(t *testing.T, w rp.Wallet) {
+	if rp.LegacyInvoiceLookups {
+		t.Skip("legacy lookups don't return ErrNotFound")
+	}
+	status, err := w.GetInvoiceStatus(strings.Repeat("ab", 32))
+	if !errors.Is(err, rp.ErrNotFound) || status.Exists {
+		t.Errorf("got %+v, %v, wanted %v", status, err, rp.ErrNotFound)
+	}
+}
+
+func cancelInvoice(t *testing.T, w rp.Wallet) {
+	inv, err := w.CreateInvoice(rp.InvoiceParams{Msatoshi: 1000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	err = w.CancelInvoice(inv.CheckingID)
+	if errors.Is(err, rp.ErrUnsupported) {
+		t.Skip("the backend can't cancel invoices")
+	}
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if status, err := w.GetInvoiceStatus(inv.CheckingID); err != nil || !status.Canceled || status.Paid {
+		t.Errorf("got %+v, %v, wanted the invoice canceled", status, err)
+	}
+}
+
+func invalidInvoice(t *testing.T, w rp.Wallet) {
+	if _, err := w.MakePayment(rp.PaymentParams{Invoice: "not an invoice"}); err == nil {
+		t.Errorf("got no error, wanted invalid invoices refused")
+	}
+}
+
+// unknownPayment accepts an error too, as some backends can't tell payments
+// they never made from failed lookups.
+func unknownPayment(t *testing.T, w rp.Wallet) {
+	status, err := w.GetPaymentStatus(strings.Repeat("cd", 32))
+	if err == nil && status.Status != rp.NeverTried {
+		t.Errorf("got %+v, wanted %s", status, rp.NeverTried)
+	}
+}
+
+func settlement(t *testing.T, w rp.Wallet) {
+	settler, ok := w.(Settler)
+	if !ok {
+		t.Skip("the wallet can't settle invoices by itself")
+	}
+
+	// every subscriber gets the event
+	first, err := w.PaidInvoicesStream()
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	second, err := w.PaidInvoicesStream()
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	inv, err := w.CreateInvoice(rp.InvoiceParams{Msatoshi: 5000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	if err := settler.SettleInvoice(inv.CheckingID, 5000); err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	for _, stream := range []<-chan rp.InvoiceStatus{first, second} {
+		status, ok := waitInvoice(stream, inv.CheckingID)
+		if !ok {
+			t.Fatalf("got no event after %v, wanted the settlement", Timeout)
+		}
+		if !status.Paid || status.MSatoshiReceived != 5000 {
+			t.Errorf("got %+v, wanted 5000 msat paid", status)
+		}
+	}
+	waitInvoiceStatus(t, w, inv.CheckingID)
+}
+
+func selfPayment(t *testing.T, w rp.Wallet) {
+	payments, err := w.PaymentsStream()
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	inv, err := w.CreateInvoice(rp.InvoiceParams{Msatoshi: 3000})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+	payment, err := w.MakePayment(rp.PaymentParams{Invoice: inv.Invoice})
+	if errors.Is(err, rp.ErrSelfPayment) {
+		t.Skip("the backend can't pay its own invoices")
+	}
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	deadline := time.After(Timeout)
+	for {
+		select {
+		case status := <-payments:
+			if status.CheckingID != payment.CheckingID || status.Status == rp.Pending {
+				continue
+			}
+			if status.Status != rp.Complete || status.Preimage != inv.Preimage {
+				t.Errorf("got %+v, wanted it complete with preimage %s", status, inv.Preimage)
+			}
+			waitInvoiceStatus(t, w, inv.CheckingID)
+			return
+		case <-deadline:
+			t.Fatalf("got no payment event after %v", Timeout)
+		}
+	}
+}
+
+func waitInvoice(stream <-chan rp.InvoiceStatus, checkingID string) (rp.InvoiceStatus, bool) {
+	deadline := time.After(Timeout)
+	for {
+		select {
+		case status := <-stream:
+			if status.CheckingID == checkingID {
+				return status, true
+			}
+		case <-deadline:
+			return rp.InvoiceStatus{}, false
+		}
+	}
+}
+
+// waitInvoiceStatus gives the status time to catch up with the stream, as
+// backends don't promise which one is updated first.
+func waitInvoiceStatus(t *testing.T, w rp.Wallet, checkingID string) {
+	deadline := time.Now().Add(Timeout)
+	for time.Now().Before(deadline) {
+		if status, err := w.GetInvoiceStatus(checkingID); err == nil && status.Paid {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("got the invoice still unpaid after %v", Timeout)
+}
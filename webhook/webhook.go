@@ -0,0 +1,376 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+type Endpoint struct {
+	URL string
+
+	// Secret, if set, is used to sign the body with HMAC-SHA256, the signature
+	// is sent hex-encoded in the X-Relampago-Signature header.
+	Secret string
+
+	// Events are the event types delivered to this endpoint, all of them when
+	// empty.
+	Events []string
+
+	// StringAmounts sends msat amounts as strings, see rp.MarshalJSON.
+	StringAmounts bool
+}
+
+type Params struct {
+	Wallet    rp.Wallet
+	Endpoints []Endpoint
+	Client    *http.Client
+
+	MaxAttempts  int           // per event, defaults to 5
+	BaseBackoff  time.Duration // defaults to 1 second
+	MaxBackoff   time.Duration // defaults to 5 minutes
+	SuspendAfter int           // consecutive failures, defaults to 10
+	SuspendFor   time.Duration // defaults to 1 hour
+	QueueSize    int           // per endpoint, defaults to 1000
+}
+
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+const (
+	InvoicePaid    = "invoice.paid"
+	PaymentUpdated = "payment.updated"
+
+	// only for wallets that are rp.EventSources
+	InvoiceExpired = "invoice.expired"
+	ChannelOpened  = "channel.opened"
+	ChannelClosed  = "channel.closed"
+
+	// only for wallets that are rp.OnchainWallets
+	OnchainUnconfirmed = "onchain.unconfirmed"
+	OnchainConfirmed   = "onchain.confirmed"
+)
+
+// Dispatcher delivers wallet events to webhook endpoints. Each endpoint has its
+// own queue and retry loop, so a slow or dead consumer doesn't delay the
+// others, and endpoints that keep failing are suspended for a while instead of
+// having every event retried against them.
+type Dispatcher struct {
+	Params
+	endpoints []*endpoint
+	stop      context.CancelFunc
+}
+
+type endpoint struct {
+	Endpoint
+	queue chan Event
+
+	mu                  sync.Mutex
+	score               float64
+	consecutiveFailures int
+	suspendedUntil      time.Time
+	delivered           int64
+	failed              int64
+	dropped             int64
+}
+
+type EndpointHealth struct {
+	URL                 string    `json:"url"`
+	Score               float64   `json:"score"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	Suspended           bool      `json:"suspended"`
+	SuspendedUntil      time.Time `json:"suspendedUntil,omitempty"`
+	Delivered           int64     `json:"delivered"`
+	Failed              int64     `json:"failed"`
+	Dropped             int64     `json:"dropped"`
+}
+
+func Start(params Params) (*Dispatcher, error) {
+	if params.Client == nil {
+		params.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if params.MaxAttempts == 0 {
+		params.MaxAttempts = 5
+	}
+	if params.BaseBackoff == 0 {
+		params.BaseBackoff = time.Second
+	}
+	if params.MaxBackoff == 0 {
+		params.MaxBackoff = 5 * time.Minute
+	}
+	if params.SuspendAfter == 0 {
+		params.SuspendAfter = 10
+	}
+	if params.SuspendFor == 0 {
+		params.SuspendFor = time.Hour
+	}
+	if params.QueueSize == 0 {
+		params.QueueSize = 1000
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	d := &Dispatcher{Params: params, stop: stop}
+	for _, e := range params.Endpoints {
+		ep := &endpoint{
+			Endpoint: e,
+			queue:    make(chan Event, params.QueueSize),
+			score:    1,
+		}
+		d.endpoints = append(d.endpoints, ep)
+		go d.deliverLoop(ep)
+	}
+
+	if params.Wallet != nil {
+		invoices, _, err := rp.SubscribePaidInvoices(ctx, params.Wallet)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("failed to subscribe to invoices: %w", err)
+		}
+		payments, _, err := rp.SubscribePayments(ctx, params.Wallet)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("failed to subscribe to payments: %w", err)
+		}
+
+		go func() {
+			for status := range invoices {
+				d.Dispatch(InvoicePaid, status)
+			}
+		}()
+		go func() {
+			for status := range payments {
+				d.Dispatch(PaymentUpdated, status)
+			}
+		}()
+
+		if source, ok := params.Wallet.(rp.EventSource); ok {
+			events, err := source.Events(ctx)
+			if err != nil {
+				stop()
+				return nil, fmt.Errorf("failed to subscribe to events: %w", err)
+			}
+			go func() {
+				for event := range events {
+					// paid invoices and payments already come from their streams
+					switch event.Type {
+					case rp.InvoiceExpired:
+						d.Dispatch(InvoiceExpired, event.Invoice)
+					case rp.ChannelOpened:
+						d.Dispatch(ChannelOpened, event.Channel)
+					case rp.ChannelClosed:
+						d.Dispatch(ChannelClosed, event.Channel)
+					}
+				}
+			}()
+		}
+
+		if onchain, ok := params.Wallet.(rp.OnchainWallet); ok {
+			txs, err := onchain.OnchainTxStream()
+			if err != nil {
+				stop()
+				return nil, fmt.Errorf("failed to subscribe to on-chain transactions: %w", err)
+			}
+			go func() {
+				for tx := range txs {
+					if tx.Confirmations > 0 {
+						d.Dispatch(OnchainConfirmed, tx)
+					} else {
+						d.Dispatch(OnchainUnconfirmed, tx)
+					}
+				}
+			}()
+		}
+	}
+
+	return d, nil
+}
+
+// Stop unsubscribes from the wallet streams. Events already queued are still
+// delivered.
+func (d *Dispatcher) Stop() {
+	d.stop()
+}
+
+// Dispatch queues an event for delivery to all endpoints that take its type
+// and aren't suspended.
+func (d *Dispatcher) Dispatch(eventType string, data interface{}) {
+	event := Event{Type: eventType, Time: time.Now(), Data: data}
+
+	for _, ep := range d.endpoints {
+		if !ep.wants(eventType) {
+			continue
+		}
+		if ep.isSuspended() {
+			ep.mu.Lock()
+			ep.dropped++
+			ep.mu.Unlock()
+			continue
+		}
+
+		select {
+		case ep.queue <- event:
+		default:
+			ep.mu.Lock()
+			ep.dropped++
+			ep.mu.Unlock()
+		}
+	}
+}
+
+func (d *Dispatcher) deliverLoop(ep *endpoint) {
+	for event := range ep.queue {
+		body, err := rp.MarshalJSON(event, ep.StringAmounts)
+		if err != nil {
+			log.Printf("Failed to encode webhook event %s: %v", event.Type, err)
+			continue
+		}
+
+		for attempt := 0; attempt < d.MaxAttempts; attempt++ {
+			if ep.isSuspended() {
+				ep.mu.Lock()
+				ep.dropped++
+				ep.mu.Unlock()
+				break
+			}
+
+			err := d.post(ep, body)
+			if err == nil {
+				ep.recordSuccess()
+				break
+			}
+
+			ep.recordFailure(d.SuspendAfter, d.SuspendFor)
+			log.Printf("Webhook delivery to %s failed (attempt %d): %v", ep.URL, attempt+1, err)
+			if attempt+1 < d.MaxAttempts {
+				time.Sleep(d.backoff(ep, attempt))
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) post(ep *endpoint, body []byte) error {
+	req, err := http.NewRequest("POST", ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ep.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(ep.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Relampago-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("got status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// backoff grows exponentially with the attempt number and is stretched for
+// endpoints with a bad health score, with some jitter.
+func (d *Dispatcher) backoff(ep *endpoint, attempt int) time.Duration {
+	ep.mu.Lock()
+	score := ep.score
+	ep.mu.Unlock()
+
+	backoff := float64(d.BaseBackoff) * float64(int64(1)<<uint(attempt)) * (2 - score)
+	backoff *= 0.8 + 0.4*rand.Float64()
+	if backoff > float64(d.MaxBackoff) {
+		backoff = float64(d.MaxBackoff)
+	}
+	return time.Duration(backoff)
+}
+
+// Health reports the current state of every endpoint.
+func (d *Dispatcher) Health() []EndpointHealth {
+	health := make([]EndpointHealth, len(d.endpoints))
+	for i, ep := range d.endpoints {
+		ep.mu.Lock()
+		health[i] = EndpointHealth{
+			URL:                 ep.URL,
+			Score:               ep.score,
+			ConsecutiveFailures: ep.consecutiveFailures,
+			Suspended:           time.Now().Before(ep.suspendedUntil),
+			Delivered:           ep.delivered,
+			Failed:              ep.failed,
+			Dropped:             ep.dropped,
+		}
+		if health[i].Suspended {
+			health[i].SuspendedUntil = ep.suspendedUntil
+		}
+		ep.mu.Unlock()
+	}
+	return health
+}
+
+// Resume lifts the suspension of an endpoint, for when it's known to be back.
+func (d *Dispatcher) Resume(url string) error {
+	for _, ep := range d.endpoints {
+		if ep.URL == url {
+			ep.mu.Lock()
+			ep.suspendedUntil = time.Time{}
+			ep.consecutiveFailures = 0
+			ep.mu.Unlock()
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown endpoint %s", url)
+}
+
+func (ep *endpoint) wants(eventType string) bool {
+	if len(ep.Events) == 0 {
+		return true
+	}
+	for _, t := range ep.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (ep *endpoint) isSuspended() bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return time.Now().Before(ep.suspendedUntil)
+}
+
+func (ep *endpoint) recordSuccess() {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	ep.delivered++
+	ep.consecutiveFailures = 0
+	ep.score = 0.8*ep.score + 0.2
+}
+
+func (ep *endpoint) recordFailure(suspendAfter int, suspendFor time.Duration) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	ep.failed++
+	ep.consecutiveFailures++
+	ep.score = 0.8 * ep.score
+	if ep.consecutiveFailures >= suspendAfter {
+		ep.suspendedUntil = time.Now().Add(suspendFor)
+	}
+}
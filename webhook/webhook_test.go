@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rp "github.com/lnbits/relampago"
+)
+
+func TestDispatch_EventRouting(t *testing.T) {
+	received := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- r.URL.Path + " " + event.Type
+	}))
+	defer srv.Close()
+
+	d, err := Start(Params{Endpoints: []Endpoint{
+		{URL: srv.URL + "/ops", Events: []string{ChannelOpened, ChannelClosed}},
+		{URL: srv.URL + "/all"},
+	}})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	d.Dispatch(InvoicePaid, nil)
+	d.Dispatch(ChannelOpened, nil)
+
+	got := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case delivery := <-received:
+			got[delivery] = true
+		case <-time.After(time.Second):
+			t.Fatalf("got %v, wanted 3 deliveries", got)
+		}
+	}
+	for _, expected := range []string{"/all invoice.paid", "/all channel.opened", "/ops channel.opened"} {
+		if !got[expected] {
+			t.Errorf("got %v, wanted %s", got, expected)
+		}
+	}
+
+	select {
+	case delivery := <-received:
+		t.Errorf("got %s, wanted no more deliveries", delivery)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDispatch_StringAmounts(t *testing.T) {
+	received := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r.URL.Path + " " + string(body)
+	}))
+	defer srv.Close()
+
+	d, err := Start(Params{Endpoints: []Endpoint{
+		{URL: srv.URL + "/numbers"},
+		{URL: srv.URL + "/strings", StringAmounts: true},
+	}})
+	if err != nil {
+		t.Fatalf("got %v, wanted %v", err, nil)
+	}
+
+	d.Dispatch(InvoicePaid, rp.InvoiceStatus{CheckingID: "abc", Paid: true, MSatoshiReceived: 9007199254740993})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case delivery := <-received:
+			expected := `"msatoshiReceived":9007199254740993`
+			if strings.HasPrefix(delivery, "/strings") {
+				expected = `"msatoshiReceived":"9007199254740993"`
+			}
+			if !strings.Contains(delivery, expected) {
+				t.Errorf("got %s, wanted %s", delivery, expected)
+			}
+
+			var event Event
+			body := delivery[strings.Index(delivery, " ")+1:]
+			if err := rp.UnmarshalJSON([]byte(body), &event); err != nil || event.Type != InvoicePaid {
+				t.Errorf("got %v, %v, wanted the event back", event, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("got no delivery")
+		}
+	}
+}